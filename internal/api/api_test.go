@@ -0,0 +1,417 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/metrics"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+func TestNewRequiresLoopback(t *testing.T) {
+	testCases := []struct {
+		listen string
+		valid  bool
+	}{
+		{"", true},
+		{"127.0.0.1:7780", true},
+		{"localhost:0", true},
+		{"[::1]:7780", true},
+		{"0.0.0.0:7780", false},
+		{"192.168.100.1:7780", false},
+		{"127.0.0.1", false},
+	}
+
+	for _, tc := range testCases {
+		_, err := New(Config{Listen: tc.listen})
+		if (err == nil) != tc.valid {
+			t.Errorf("New(%q) error = %v, expected valid = %t", tc.listen, err, tc.valid)
+		}
+	}
+}
+
+func TestDiagnosticsEndpoints(t *testing.T) {
+	server, err := New(Config{Diagnostics: true, Token: "secret"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/runtime"} {
+		for _, token := range []string{"", "wrong"} {
+			if rec := get(path, token); rec.Code != http.StatusUnauthorized {
+				t.Errorf("Expected 401 from %s with token %q, got %d", path, token, rec.Code)
+			}
+		}
+	}
+
+	rec := get("/debug/runtime", "secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from /debug/runtime, got %d", rec.Code)
+	}
+
+	var stats RuntimeStats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode runtime stats: %v", err)
+	}
+	if stats.Goroutines == 0 || stats.GoVersion == "" {
+		t.Errorf("Unexpected runtime stats: %+v", stats)
+	}
+
+	if rec := get("/debug/pprof/", "secret"); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 from /debug/pprof/, got %d", rec.Code)
+	}
+}
+
+func TestDiagnosticsDisabled(t *testing.T) {
+	server, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/runtime"} {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 from %s with diagnostics disabled, got %d", path, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 from /healthz, got %d", rec.Code)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.NewHistogram("test_duration_seconds", "Test durations.", "op").Observe("start", time.Millisecond)
+
+	server, err := New(Config{Metrics: registry})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `test_duration_seconds_count{op="start"} 1`) {
+		t.Errorf("Unexpected /metrics response %d:\n%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestListenAndServe(t *testing.T) {
+	server, err := New(Config{Listen: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	listener, err := server.Listen()
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- server.Serve(ctx, listener) }()
+
+	resp, err := http.Get("http://" + server.Addr().String() + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz failed: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned error: %v", err)
+	}
+}
+
+func TestAuditedRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := audit.Open(path, "default")
+	if err != nil {
+		t.Fatalf("audit.Open failed: %v", err)
+	}
+
+	server, err := New(Config{Audit: log})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	for _, target := range []string{"/healthz", "/debug/runtime?verbose=1"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("User-Agent", "curl/8.7.1")
+		server.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	_ = log.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	entries, err := audit.Read(file, audit.Query{Source: audit.SourceAPI})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected 2 audited requests, got %d, %v", len(entries), err)
+	}
+
+	missing := entries[1]
+	if missing.Action != "GET /debug/runtime" || missing.Target != "verbose=1" || missing.Result != "404" {
+		t.Errorf("Unexpected audit entry: %+v", missing)
+	}
+	if missing.Actor != "192.0.2.1" || missing.Detail != "curl/8.7.1" {
+		t.Errorf("Expected caller address and user agent, got %+v", missing)
+	}
+}
+
+// stubController serves fixed data and records changes
+type stubController struct {
+	forwards []config.PortForward
+	running  bool
+}
+
+func (c *stubController) Status() (*nat.Status, error) {
+	return &nat.Status{Active: c.running}, nil
+}
+
+func (c *stubController) Devices() ([]nat.Device, error) {
+	return []nat.Device{{IP: "192.168.100.10", MAC: "aa:bb:cc:dd:ee:ff"}}, nil
+}
+
+func (c *stubController) Connections() ([]nat.Connection, error) {
+	return []nat.Connection{}, nil
+}
+
+func (c *stubController) KillConnections(ip string) (int, error) {
+	if ip != "192.168.100.10" {
+		return 0, fmt.Errorf("%w: %q is not a device", ErrInvalid, ip)
+	}
+	return 3, nil
+}
+
+func (c *stubController) Forwards() ([]config.PortForward, error) {
+	return c.forwards, nil
+}
+
+func (c *stubController) AddForward(forward config.PortForward) error {
+	if forward.ExternalPort == 0 {
+		return fmt.Errorf("%w: external port missing", ErrInvalid)
+	}
+	c.forwards = append(c.forwards, forward)
+	return nil
+}
+
+func (c *stubController) RemoveForward(port int) error {
+	for i, f := range c.forwards {
+		if f.ExternalPort == port {
+			c.forwards = append(c.forwards[:i], c.forwards[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no port forward for port %d", ErrNotFound, port)
+}
+
+func (c *stubController) Start() (*nat.Status, error) {
+	if c.running {
+		return nil, nat.ErrAlreadyRunning
+	}
+	c.running = true
+	return c.Status()
+}
+
+func (c *stubController) Stop() (*nat.Status, error) {
+	if !c.running {
+		return nil, nat.ErrNotRunning
+	}
+	c.running = false
+	return c.Status()
+}
+
+func TestREST(t *testing.T) {
+	server, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctrl := &stubController{}
+	server.RegisterREST(ctrl, "secret")
+
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, token := range []string{"", "wrong"} {
+		if rec := request(http.MethodGet, "/api/v1/status", token, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Token %q: expected 401, got %d", token, rec.Code)
+		}
+	}
+	if rec := request(http.MethodGet, "/healthz", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("/healthz should not need a token, got %d", rec.Code)
+	}
+
+	rec := request(http.MethodGet, "/api/v1/devices", "secret", "")
+	var devices []nat.Device
+	if err := json.NewDecoder(rec.Body).Decode(&devices); err != nil || rec.Code != http.StatusOK || len(devices) != 1 {
+		t.Errorf("GET devices = %d %v %v", rec.Code, devices, err)
+	}
+
+	steps := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/api/v1/start", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/start", "", http.StatusConflict},
+		{http.MethodPost, "/api/v1/forwards", `{"protocol":"tcp","external_port":8080,"internal_ip":"192.168.100.50","internal_port":80}`, http.StatusCreated},
+		{http.MethodPost, "/api/v1/forwards", `{"protocol":"tcp"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/forwards", `{"port":1}`, http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/forwards/9090", "", http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/forwards/http", "", http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/forwards/8080", "", http.StatusNoContent},
+		{http.MethodDelete, "/api/v1/connections/192.168.100.10", "", http.StatusOK},
+		{http.MethodDelete, "/api/v1/connections/all", "", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/stop", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/stop", "", http.StatusConflict},
+		{http.MethodGet, "/api/v1/nothing", "", http.StatusNotFound},
+	}
+	for _, step := range steps {
+		rec := request(step.method, step.path, "secret", step.body)
+		if rec.Code != step.status {
+			t.Errorf("%s %s = %d, expected %d: %s", step.method, step.path, rec.Code, step.status, rec.Body.String())
+		}
+		if rec.Code >= 400 && !strings.Contains(rec.Body.String(), `"error"`) {
+			t.Errorf("%s %s: error body missing: %s", step.method, step.path, rec.Body.String())
+		}
+	}
+	if len(ctrl.forwards) != 0 || ctrl.running {
+		t.Errorf("Unexpected controller state: %+v", ctrl)
+	}
+}
+
+func TestLoadToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nat-manager", "api-token")
+	token, err := LoadToken(path)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("LoadToken = %q, %v", token, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Token file mode = %v, %v", info, err)
+	}
+	if again, err := LoadToken(path); err != nil || again != token {
+		t.Errorf("LoadToken should return the stored token, got %q, %v", again, err)
+	}
+}
+
+func TestSummaryAndEvents(t *testing.T) {
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.log"), "default")
+	if err != nil {
+		t.Fatalf("audit.Open failed: %v", err)
+	}
+	defer func() { _ = log.Close() }()
+	server, err := New(Config{Audit: log})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	server.RegisterREST(&stubController{running: true}, "secret")
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	get := func(ctx context.Context, path string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		return http.DefaultClient.Do(req)
+	}
+
+	resp, err := get(context.Background(), "/api/v1/summary")
+	if err != nil {
+		t.Fatalf("GET summary: %v", err)
+	}
+	var summary Summary
+	err = json.NewDecoder(resp.Body).Decode(&summary)
+	_ = resp.Body.Close()
+	if err != nil || !summary.Active || summary.Devices != 0 {
+		t.Errorf("GET summary = %+v, %v", summary, err)
+	}
+
+	if resp, err := get(context.Background(), "/api/v1/events?interval=soon"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid interval, got %v, %v", resp, err)
+	}
+
+	// The first summary arrives through the audit wrapper without waiting
+	// for the stream to end
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err = get(ctx, "/api/v1/events")
+	if err != nil {
+		t.Fatalf("GET events: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Content-Type = %s", resp.Header.Get("Content-Type"))
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "event: summary\n" {
+		t.Errorf("First line = %q, %v", line, err)
+	}
+}
+
+func TestWriteChanges(t *testing.T) {
+	laptop := nat.Device{IP: "192.168.100.50", MAC: "aa:bb:cc:dd:ee:01", Online: true}
+	phone := nat.Device{IP: "192.168.100.51", MAC: "aa:bb:cc:dd:ee:02", Online: true}
+	var b strings.Builder
+
+	if err := writeChanges(&b, nil, Summary{Active: true, Devices: 1}, nil, map[string]nat.Device{laptop.MAC: laptop}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(b.String(), "event: ") != 1 {
+		t.Errorf("Expected only the summary first, got %q", b.String())
+	}
+
+	b.Reset()
+	err := writeChanges(&b, &Summary{Active: true, Devices: 1}, Summary{Active: false, Devices: 1},
+		map[string]nat.Device{laptop.MAC: laptop}, map[string]nat.Device{phone.MAC: phone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"event: nat.stopped\ndata: {\"active\":false",
+		"event: device.joined\ndata: {\"ip\":\"192.168.100.51\"",
+		"event: device.left\ndata: {\"ip\":\"192.168.100.50\"",
+		"event: summary\n",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("Missing %q in %q", expected, b.String())
+		}
+	}
+}
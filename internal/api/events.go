@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// How often the event stream polls the controller by default and at most
+const (
+	DefaultEventInterval = 2 * time.Second
+	minEventInterval     = 500 * time.Millisecond
+)
+
+// Summary is the short status shown by menu bar apps
+type Summary struct {
+	Active      bool    `json:"active"`
+	ExternalIP  string  `json:"external_ip,omitempty"`
+	Uptime      string  `json:"uptime,omitempty"`
+	Devices     int     `json:"devices"` // online
+	Connections int     `json:"connections"`
+	BytesIn     uint64  `json:"bytes_in"`
+	BytesOut    uint64  `json:"bytes_out"`
+	RateIn      float64 `json:"rate_in"` // bytes per second, in the event stream
+	RateOut     float64 `json:"rate_out"`
+}
+
+// Summarize returns the summary of a status and the devices
+func Summarize(status *nat.Status, devices []nat.Device) Summary {
+	summary := Summary{
+		Active:      status.Active,
+		ExternalIP:  status.ExternalIP,
+		Uptime:      status.Uptime,
+		Connections: len(status.ActiveConnections),
+		BytesIn:     status.BytesIn,
+		BytesOut:    status.BytesOut,
+	}
+	for _, d := range devices {
+		if d.Online {
+			summary.Devices++
+		}
+	}
+	if status.Throughput != nil {
+		summary.RateIn, summary.RateOut = status.Throughput.In, status.Throughput.Out
+	}
+	return summary
+}
+
+// summarize reads the summary and the online devices, by MAC or address,
+// from ctrl
+func summarize(ctrl Controller) (Summary, map[string]nat.Device, error) {
+	status, err := ctrl.Status()
+	if err != nil {
+		return Summary{}, nil, err
+	}
+	devices, err := ctrl.Devices()
+	if err != nil {
+		return Summary{}, nil, err
+	}
+	online := make(map[string]nat.Device)
+	for _, d := range devices {
+		if d.Online {
+			key := d.MAC
+			if key == "" {
+				key = d.IP
+			}
+			online[key] = d
+		}
+	}
+	return Summarize(status, devices), online, nil
+}
+
+// streamEvents sends server-sent events until the client goes away: the
+// summary after every poll, with rates since the previous one, nat.started
+// and nat.stopped with the summary when NAT starts or stops, and
+// device.joined and device.left with the device when it comes online or
+// goes offline
+func streamEvents(w http.ResponseWriter, r *http.Request, ctrl Controller) {
+	interval := DefaultEventInterval
+	if value := r.URL.Query().Get("interval"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			writeError(w, fmt.Errorf("%w: invalid interval %q", ErrInvalid, value))
+			return
+		}
+		interval = max(parsed, minEventInterval)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher := http.NewResponseController(w)
+
+	var previous *Summary
+	var devices map[string]nat.Device
+	var polled time.Time
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		summary, online, err := summarize(ctrl)
+		now := time.Now()
+		if err != nil {
+			err = writeEvent(w, "error", errorResponse{Error: err.Error()})
+		} else {
+			if previous != nil {
+				elapsed := now.Sub(polled).Seconds()
+				summary.RateIn = rate(previous.BytesIn, summary.BytesIn, elapsed)
+				summary.RateOut = rate(previous.BytesOut, summary.BytesOut, elapsed)
+			}
+			err = writeChanges(w, previous, summary, devices, online)
+			previous, devices, polled = &summary, online, now
+		}
+		if err != nil || flusher.Flush() != nil {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeChanges writes the events since the previous poll, none but the
+// summary on the first
+func writeChanges(w io.Writer, previous *Summary, summary Summary, before, after map[string]nat.Device) error {
+	if previous != nil {
+		if previous.Active != summary.Active {
+			typ := event.NATStopped
+			if summary.Active {
+				typ = event.NATStarted
+			}
+			if err := writeEvent(w, typ, summary); err != nil {
+				return err
+			}
+		}
+		for key, d := range after {
+			if _, ok := before[key]; !ok {
+				if err := writeEvent(w, event.DeviceJoined, d); err != nil {
+					return err
+				}
+			}
+		}
+		for key, d := range before {
+			if _, ok := after[key]; !ok {
+				if err := writeEvent(w, event.DeviceLeft, d); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return writeEvent(w, "summary", summary)
+}
+
+// writeEvent writes a server-sent event with v as JSON data
+func writeEvent(w io.Writer, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
+
+// rate returns the bytes per second between two counter readings, 0 when
+// the counters were reset
+func rate(before, after uint64, elapsed float64) float64 {
+	if after < before || elapsed <= 0 {
+		return 0
+	}
+	return float64(after-before) / elapsed
+}
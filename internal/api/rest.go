@@ -0,0 +1,196 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// RESTPrefix is the path prefix of the REST API
+const RESTPrefix = "/api/v1/"
+
+var (
+	// ErrInvalid marks controller errors caused by the request, answered
+	// with 400 Bad Request
+	ErrInvalid = errors.New("invalid request")
+	// ErrNotFound marks controller errors about missing objects, answered
+	// with 404 Not Found
+	ErrNotFound = errors.New("not found")
+)
+
+// Controller is what the REST API reads and changes
+type Controller interface {
+	Status() (*nat.Status, error)
+	Devices() ([]nat.Device, error)
+	Connections() ([]nat.Connection, error)
+	KillConnections(ip string) (int, error)
+	Forwards() ([]config.PortForward, error)
+	AddForward(forward config.PortForward) error
+	RemoveForward(externalPort int) error
+	Start() (*nat.Status, error)
+	Stop() (*nat.Status, error)
+}
+
+// KillResult is the body of a DELETE of a device's connections
+type KillResult struct {
+	Killed int `json:"killed"` // dropped pf states
+}
+
+// errorResponse is the body of failed REST requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// RegisterREST adds the REST endpoints served by ctrl. Every request must
+// carry token as a bearer token.
+func (s *Server) RegisterREST(ctrl Controller, token string) {
+	s.mux.Handle(RESTPrefix, authorized(token, RESTHandler(ctrl)))
+}
+
+// RESTHandler returns the REST endpoints served by ctrl, without
+// authentication
+func RESTHandler(ctrl Controller) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+RESTPrefix+"status", func(w http.ResponseWriter, _ *http.Request) {
+		respond(w, http.StatusOK)(ctrl.Status())
+	})
+	mux.HandleFunc("GET "+RESTPrefix+"summary", func(w http.ResponseWriter, _ *http.Request) {
+		summary, _, err := summarize(ctrl)
+		respond(w, http.StatusOK)(summary, err)
+	})
+	mux.HandleFunc("GET "+RESTPrefix+"events", func(w http.ResponseWriter, r *http.Request) {
+		streamEvents(w, r, ctrl)
+	})
+	mux.HandleFunc("GET "+RESTPrefix+"devices", func(w http.ResponseWriter, _ *http.Request) {
+		respond(w, http.StatusOK)(ctrl.Devices())
+	})
+	mux.HandleFunc("GET "+RESTPrefix+"connections", func(w http.ResponseWriter, _ *http.Request) {
+		respond(w, http.StatusOK)(ctrl.Connections())
+	})
+	mux.HandleFunc("DELETE "+RESTPrefix+"connections/{ip}", func(w http.ResponseWriter, r *http.Request) {
+		killed, err := ctrl.KillConnections(r.PathValue("ip"))
+		respond(w, http.StatusOK)(KillResult{Killed: killed}, err)
+	})
+	mux.HandleFunc("GET "+RESTPrefix+"forwards", func(w http.ResponseWriter, _ *http.Request) {
+		respond(w, http.StatusOK)(ctrl.Forwards())
+	})
+	mux.HandleFunc("POST "+RESTPrefix+"forwards", func(w http.ResponseWriter, r *http.Request) {
+		var forward config.PortForward
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&forward); err != nil {
+			writeError(w, fmt.Errorf("%w: %w", ErrInvalid, err))
+			return
+		}
+		if err := ctrl.AddForward(forward); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(forward)
+	})
+	mux.HandleFunc("DELETE "+RESTPrefix+"forwards/{port}", func(w http.ResponseWriter, r *http.Request) {
+		port, err := strconv.Atoi(r.PathValue("port"))
+		if err != nil {
+			writeError(w, fmt.Errorf("%w: invalid port %q", ErrInvalid, r.PathValue("port")))
+			return
+		}
+		if err := ctrl.RemoveForward(port); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST "+RESTPrefix+"start", func(w http.ResponseWriter, _ *http.Request) {
+		respond(w, http.StatusOK)(ctrl.Start())
+	})
+	mux.HandleFunc("POST "+RESTPrefix+"stop", func(w http.ResponseWriter, _ *http.Request) {
+		respond(w, http.StatusOK)(ctrl.Stop())
+	})
+	mux.HandleFunc(RESTPrefix, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, fmt.Errorf("%w: %s %s", ErrNotFound, r.Method, r.URL.Path))
+	})
+	return mux
+}
+
+// authorized rejects requests without the bearer token
+func authorized(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nat-manager"`)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(errorResponse{Error: "missing or invalid API token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// respond returns a function writing a controller's result, or its error
+func respond(w http.ResponseWriter, status int) func(any, error) {
+	return func(v any, err error) {
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+// writeError answers with err and the status code its kind maps to
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, nat.ErrConflict), errors.Is(err, nat.ErrNotRunning):
+		status = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
+
+// LoadToken returns the API token stored at path, creating a random one
+// readable only by its owner if there is none
+func LoadToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if token := strings.TrimSpace(string(data)); token != "" {
+			return token, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read API token: %w", err)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	token := hex.EncodeToString(secret)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write API token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,246 @@
+// Package api provides the localhost HTTP listener used by long-running
+// nat-manager processes for diagnostics and local integrations
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/metrics"
+)
+
+// DefaultListen is the address the API binds to when none is configured
+const DefaultListen = "127.0.0.1:7780"
+
+// Config configures the API server
+type Config struct {
+	Listen      string            // loopback host:port, defaults to DefaultListen
+	Diagnostics bool              // expose /debug/pprof and /debug/runtime
+	Token       string            // bearer token the diagnostics require
+	Audit       *audit.Log        // records every request when set
+	Metrics     *metrics.Registry // served at /metrics when set
+}
+
+// RuntimeStats is a snapshot of Go runtime health served at /debug/runtime
+type RuntimeStats struct {
+	GoVersion    string  `json:"go_version"`
+	Uptime       string  `json:"uptime"`
+	Goroutines   int     `json:"goroutines"`
+	GOMAXPROCS   int     `json:"gomaxprocs"`
+	HeapAlloc    uint64  `json:"heap_alloc_bytes"`
+	HeapObjects  uint64  `json:"heap_objects"`
+	Sys          uint64  `json:"sys_bytes"`
+	NumGC        uint32  `json:"num_gc"`
+	PauseTotalMs float64 `json:"gc_pause_total_ms"`
+}
+
+// Server is the localhost API listener
+type Server struct {
+	listen  string
+	mux     *http.ServeMux
+	audit   *audit.Log
+	started time.Time
+
+	mu   sync.Mutex
+	addr net.Addr
+}
+
+// New creates an API server. The listen address must be a loopback address
+// so diagnostics are never exposed to the network.
+func New(cfg Config) (*Server, error) {
+	listen := cfg.Listen
+	if listen == "" {
+		listen = DefaultListen
+	}
+	if err := ValidateLoopback(listen); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listen:  listen,
+		mux:     http.NewServeMux(),
+		audit:   cfg.Audit,
+		started: time.Now(),
+	}
+
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, map[string]string{"status": "ok"})
+	})
+	if cfg.Metrics != nil {
+		s.mux.Handle("/metrics", cfg.Metrics.Handler())
+	}
+	if cfg.Diagnostics {
+		s.registerDiagnostics(cfg.Token)
+	}
+
+	return s, nil
+}
+
+// Handle registers an additional handler on the API
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	if s.audit == nil {
+		return s.mux
+	}
+	return s.audited(s.mux)
+}
+
+// Addr returns the bound address once the server is listening
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// ListenAndServe serves the API until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := s.Listen()
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Listen binds the configured address
+func (s *Server) Listen() (net.Listener, error) {
+	listener, err := net.Listen("tcp", s.listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.listen, err)
+	}
+
+	s.mu.Lock()
+	s.addr = listener.Addr()
+	s.mu.Unlock()
+	return listener, nil
+}
+
+// Serve serves the API on listener until ctx is cancelled
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// StatusRecorder captures the status code written by a handler, for
+// middleware recording how requests were answered
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+}
+
+// NewStatusRecorder wraps w, reporting 200 until a handler writes another
+// status
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w, Status: http.StatusOK}
+}
+
+// WriteHeader records status and writes it
+func (r *StatusRecorder) WriteHeader(status int) {
+	r.Status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController flush event streams
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// audited records who called which endpoint and how it was answered
+func (s *Server) audited(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		actor := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(actor); err == nil {
+			actor = host
+		}
+		_ = s.audit.Record(audit.Entry{
+			Source: audit.SourceAPI,
+			Actor:  actor,
+			Action: r.Method + " " + r.URL.Path,
+			Target: r.URL.RawQuery,
+			Result: fmt.Sprint(rec.Status),
+			Detail: r.UserAgent(),
+		})
+	})
+}
+
+// registerDiagnostics adds the pprof and runtime endpoints. Profiles
+// reveal memory contents and command lines, so every request must carry
+// token as a bearer token, as other local users can reach the loopback
+// address too.
+func (s *Server) registerDiagnostics(token string) {
+	s.mux.Handle("/debug/pprof/", authorized(token, http.HandlerFunc(pprof.Index)))
+	s.mux.Handle("/debug/pprof/cmdline", authorized(token, http.HandlerFunc(pprof.Cmdline)))
+	s.mux.Handle("/debug/pprof/profile", authorized(token, http.HandlerFunc(pprof.Profile)))
+	s.mux.Handle("/debug/pprof/symbol", authorized(token, http.HandlerFunc(pprof.Symbol)))
+	s.mux.Handle("/debug/pprof/trace", authorized(token, http.HandlerFunc(pprof.Trace)))
+	s.mux.Handle("/debug/runtime", authorized(token, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, s.runtimeStats())
+	})))
+}
+
+// runtimeStats collects the current runtime snapshot
+func (s *Server) runtimeStats() RuntimeStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return RuntimeStats{
+		GoVersion:    runtime.Version(),
+		Uptime:       time.Since(s.started).Round(time.Second).String(),
+		Goroutines:   runtime.NumGoroutine(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		HeapAlloc:    mem.HeapAlloc,
+		HeapObjects:  mem.HeapObjects,
+		Sys:          mem.Sys,
+		NumGC:        mem.NumGC,
+		PauseTotalMs: float64(mem.PauseTotalNs) / float64(time.Millisecond),
+	}
+}
+
+// ValidateLoopback rejects listen addresses that are not on a loopback interface
+func ValidateLoopback(listen string) error {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("invalid API listen address %q: %w", listen, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("API listen address %q must be a loopback address", listen)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,163 @@
+// Package audit keeps a trail of who did what through the NAT manager's
+// network-facing services, such as API calls and captive portal redemptions,
+// and of the changes it made to the machine, and lets it be queried
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry sources
+const (
+	SourceAPI    = "api"
+	SourcePortal = "portal"
+	SourceSystem = "system" // system commands that changed the machine
+	SourceEvent  = "event"  // notable events, such as NAT starting or a server restarted
+)
+
+// Entry is a single audit record as stored on disk
+type Entry struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source"`
+	Instance string    `json:"instance,omitempty"`
+	Actor    string    `json:"actor"`            // client IP or MAC, or user for system changes
+	Action   string    `json:"action"`           // e.g. "GET /healthz" or "redeem"
+	Target   string    `json:"target,omitempty"` // what the action applied to
+	Result   string    `json:"result"`           // e.g. "200" or "granted"
+	Detail   string    `json:"detail,omitempty"`
+}
+
+// Log appends entries to a JSON Lines file shared by all instances. A nil
+// Log discards entries.
+type Log struct {
+	mu       sync.Mutex
+	instance string
+	file     *os.File
+}
+
+// Open opens the audit log for appending, tagging entries with instance
+func Open(path, instance string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Log{instance: instance, file: file}, nil
+}
+
+// forward receives every entry recorded, when set
+var forward atomic.Pointer[func(Entry)]
+
+// Forward passes every entry recorded from now on to f as well, even by a
+// nil Log, such as to send the trail to syslog; nil stops forwarding
+func Forward(f func(Entry)) {
+	if f == nil {
+		forward.Store(nil)
+		return
+	}
+	forward.Store(&f)
+}
+
+// Record appends an entry, stamping its time and instance when unset
+func (l *Log) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if l != nil && entry.Instance == "" {
+		entry.Instance = l.instance
+	}
+	if f := forward.Load(); f != nil {
+		(*f)(entry)
+	}
+	if l == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed")
+	}
+	// A single write per line keeps concurrent writers from interleaving
+	_, err = l.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Query selects audit entries; zero fields match everything
+type Query struct {
+	Source string
+	Actor  string // matched as a substring
+	Action string // matched as a case-insensitive substring
+	Since  time.Time
+	Limit  int // most recent entries only
+}
+
+// Match reports whether entry satisfies the query's filters
+func (q Query) Match(entry Entry) bool {
+	if q.Source != "" && entry.Source != q.Source {
+		return false
+	}
+	if q.Actor != "" && !strings.Contains(entry.Actor, q.Actor) {
+		return false
+	}
+	if q.Action != "" && !strings.Contains(strings.ToLower(entry.Action), strings.ToLower(q.Action)) {
+		return false
+	}
+	return q.Since.IsZero() || !entry.Time.Before(q.Since)
+}
+
+// Read reads the entries matching q, oldest first. Malformed lines, such as
+// a partially written last line, are skipped.
+func Read(r io.Reader, q Query) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if q.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+	return entries, nil
+}
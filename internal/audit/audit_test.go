@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := Open(path, "lab")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: start, Source: SourceAPI, Actor: "127.0.0.1", Action: "GET /healthz", Result: "200"},
+		{Time: start.Add(time.Minute), Source: SourcePortal, Actor: "aa:bb:cc:dd:ee:ff", Action: "redeem", Result: "granted"},
+		{Time: start.Add(2 * time.Minute), Source: SourceAPI, Actor: "127.0.0.1", Action: "GET /debug/runtime", Result: "404"},
+	}
+	for _, entry := range entries {
+		if err := log.Record(entry); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := log.Record(entries[0]); err == nil {
+		t.Error("Record should fail after Close")
+	}
+
+	// A torn last line is skipped
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	_, _ = file.WriteString(`{"time":"2026-10-16T09:03`)
+	_ = file.Close()
+
+	testCases := []struct {
+		name     string
+		query    Query
+		expected int
+	}{
+		{"everything", Query{}, 3},
+		{"by source", Query{Source: SourceAPI}, 2},
+		{"by actor", Query{Actor: "aa:bb"}, 1},
+		{"by action", Query{Action: "DEBUG"}, 1},
+		{"since", Query{Since: start.Add(time.Minute)}, 2},
+		{"limit keeps newest", Query{Limit: 1}, 1},
+	}
+
+	for _, tc := range testCases {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Read(file, tc.query)
+		_ = file.Close()
+		if err != nil || len(got) != tc.expected {
+			t.Errorf("%s: Read() = %d entries, %v; expected %d", tc.name, len(got), err, tc.expected)
+		}
+		if len(got) > 0 && got[0].Instance != "lab" {
+			t.Errorf("%s: expected instance to be stamped, got %q", tc.name, got[0].Instance)
+		}
+	}
+
+	file, _ = os.Open(path)
+	defer func() { _ = file.Close() }()
+	if got, _ := Read(file, Query{Limit: 1}); len(got) != 1 || !strings.Contains(got[0].Action, "runtime") {
+		t.Errorf("Limit should keep the most recent entry, got %+v", got)
+	}
+}
+
+func TestNilLogDiscards(t *testing.T) {
+	var log *Log
+	if err := log.Record(Entry{Source: SourceAPI}); err != nil {
+		t.Errorf("nil Log should discard entries, got %v", err)
+	}
+	if err := log.Close(); err != nil {
+		t.Errorf("nil Log Close should succeed, got %v", err)
+	}
+}
+
+func TestMutating(t *testing.T) {
+	testCases := []struct {
+		args     []string
+		expected bool
+	}{
+		{[]string{"pfctl", "-a", "com.apple/nat-manager", "-f", "-"}, true},
+		{[]string{"pfctl", "-a", "com.apple/nat-manager", "-F", "all"}, true},
+		{[]string{"pfctl", "-k", "192.168.100.20"}, true},
+		{[]string{"pfctl", "-a", "com.apple/nat-manager", "-s", "rules"}, false},
+		{[]string{"pfctl", "-sr"}, false},
+		{[]string{"pfctl", "-t", "blocked", "-T", "show"}, false},
+		{[]string{"ifconfig", "bridge100", "create"}, true},
+		{[]string{"ifconfig", "-v", "en0"}, false},
+		{[]string{"sysctl", "-w", "net.inet.ip.forwarding=1"}, true},
+		{[]string{"sysctl", "net.inet.ip.forwarding"}, false},
+		{[]string{"route", "-n", "get", "default"}, false},
+		{[]string{"dnctl", "pipe", "1", "config", "bw", "10Kbit/s"}, true},
+		{[]string{"/bin/launchctl", "load", "-w", "/Library/LaunchDaemons/x.plist"}, true},
+		{[]string{"launchctl", "list"}, false},
+		{[]string{"arp", "-an"}, false},
+		{[]string{"arp", "-d", "192.168.100.20"}, true},
+		{[]string{"netstat", "-rn"}, false},
+		{[]string{"killall", "dnsmasq"}, true},
+		{nil, false},
+	}
+	for _, tc := range testCases {
+		if got := Mutating(tc.args); got != tc.expected {
+			t.Errorf("Mutating(%q) = %v, expected %v", tc.args, got, tc.expected)
+		}
+	}
+}
+
+func TestSystemChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := Open(path, "default")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = log.Close() }()
+	t.Setenv("SUDO_USER", "alice")
+
+	Command([]string{"sysctl", "-w", "net.inet.ip.forwarding=1"}, nil)
+	SetSystem(log)
+	defer SetSystem(nil)
+	Command([]string{"sysctl", "-w", "net.inet.ip.forwarding=1"}, nil)
+	Command([]string{"pfctl", "-s", "info"}, nil)
+	Change("kill", "pid 42", errors.New("no such process"))
+	Event("nat started", "en0 -> bridge100")
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	entries, err := Read(file, Query{Source: SourceSystem})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected the 2 changes made while recording, got %+v, %v", entries, err)
+	}
+	if e := entries[0]; e.Actor != "alice" || e.Action != "sysctl" || e.Target != "-w net.inet.ip.forwarding=1" || e.Result != "ok" {
+		t.Errorf("unexpected command entry %+v", e)
+	}
+	if e := entries[1]; e.Result != "failed" || e.Detail != "no such process" || e.Instance != "default" {
+		t.Errorf("unexpected change entry %+v", e)
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	events, err := Read(file, Query{Source: SourceEvent})
+	if err != nil || len(events) != 1 || events[0].Action != "nat started" || events[0].Actor != "alice" {
+		t.Errorf("expected the NAT start event, got %+v, %v", events, err)
+	}
+}
+
+func TestForward(t *testing.T) {
+	var forwarded []Entry
+	Forward(func(e Entry) { forwarded = append(forwarded, e) })
+	defer Forward(nil)
+
+	Command([]string{"pfctl", "-a", "nat-manager", "-f", "-"}, nil)
+	Command([]string{"pfctl", "-s", "info"}, nil)
+	log, err := Open(filepath.Join(t.TempDir(), "audit.log"), "lab")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = log.Close() }()
+	if err := log.Record(Entry{Source: SourceAPI, Actor: "127.0.0.1", Action: "POST /api/v1/stop", Result: "200"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(forwarded) != 2 {
+		t.Fatalf("expected 2 forwarded entries, got %+v", forwarded)
+	}
+	if e := forwarded[0]; e.Source != SourceSystem || e.Action != "pfctl" || e.Time.IsZero() {
+		t.Errorf("unexpected system entry %+v", e)
+	}
+	if e := forwarded[1]; e.Instance != "lab" || e.Action != "POST /api/v1/stop" {
+		t.Errorf("unexpected API entry %+v", e)
+	}
+}
@@ -0,0 +1,108 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// system is the log recording changes to the machine, nil when disabled
+var system atomic.Pointer[Log]
+
+// readVerbs are arguments that make a command only read the system state,
+// e.g. "route get" or "launchctl list"
+var readVerbs = map[string]bool{
+	"get": true, "show": true, "list": true, "print": true, "read": true, "status": true,
+	"getpacket": true, "getifaddr": true, "getoption": true, "--dns": true, "--proxy": true, "--get": true,
+}
+
+// readOnly are commands that never change the system
+var readOnly = map[string]bool{"netstat": true, "ps": true, "ping": true, "dig": true, "host": true, "true": true}
+
+// mutators decide from their arguments whether commands that both read and
+// change the system change it
+var mutators = map[string]func(args []string) bool{
+	"pfctl": func(args []string) bool {
+		return !slices.ContainsFunc(args, func(arg string) bool { return strings.HasPrefix(arg, "-s") || readVerbs[arg] })
+	},
+	"ifconfig": func(args []string) bool { return len(operands(args)) > 1 },
+	"sysctl": func(args []string) bool {
+		return slices.Contains(args, "-w") || slices.ContainsFunc(args, func(arg string) bool { return strings.Contains(arg, "=") })
+	},
+	"arp": func(args []string) bool {
+		return slices.ContainsFunc(args, func(arg string) bool { return arg == "-d" || arg == "-s" || arg == "-S" })
+	},
+}
+
+// SetSystem sets the log recording the system commands that change the
+// machine; nil stops recording
+func SetSystem(l *Log) {
+	system.Store(l)
+}
+
+// Mutating reports whether a system command changes the machine's state
+// rather than only reading it. Unknown commands count as changes.
+func Mutating(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	name, rest := filepath.Base(args[0]), args[1:]
+	if readOnly[name] {
+		return false
+	}
+	if mutator, ok := mutators[name]; ok {
+		return mutator(rest)
+	}
+	return !slices.ContainsFunc(rest, func(arg string) bool { return readVerbs[arg] })
+}
+
+// Command records a system command and its outcome if it changes the
+// machine
+func Command(args []string, err error) {
+	if !Mutating(args) {
+		return
+	}
+	Change(filepath.Base(args[0]), strings.Join(args[1:], " "), err)
+}
+
+// Change records a change to the machine made by the current user, such as
+// a command run or a process signalled, and its outcome. Without a system
+// log it is only forwarded.
+func Change(action, target string, err error) {
+	entry := Entry{Source: SourceSystem, Actor: currentUser(), Action: action, Target: target, Result: "ok"}
+	if err != nil {
+		entry.Result = "failed"
+		entry.Detail = err.Error()
+	}
+	_ = system.Load().Record(entry)
+}
+
+// Event records a notable event of the instance, such as NAT starting or
+// the DHCP server being restarted, for the event timeline
+func Event(action, target string) {
+	_ = system.Load().Record(Entry{Source: SourceEvent, Actor: currentUser(), Action: action, Target: target, Result: "ok"})
+}
+
+// operands returns the arguments that are not flags
+func operands(args []string) []string {
+	var ops []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			ops = append(ops, arg)
+		}
+	}
+	return ops
+}
+
+// currentUser returns the user who ran nat-manager, looking through sudo
+func currentUser() string {
+	for _, name := range []string{"SUDO_USER", "USER"} {
+		if user := os.Getenv(name); user != "" {
+			return user
+		}
+	}
+	return "uid " + strconv.Itoa(os.Getuid())
+}
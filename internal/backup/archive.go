@@ -0,0 +1,247 @@
+// Package backup archives the NAT manager's configuration and state,
+// stores the archives on a local, scp or S3 target with rotation and
+// restores them
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version is the current archive format version
+const Version = 1
+
+const (
+	namePrefix   = "nat-manager-backup-"
+	nameSuffix   = ".tar.gz"
+	manifestName = "manifest.json"
+)
+
+// Manifest describes the contents of an archive
+type Manifest struct {
+	Version  int       `json:"version"`
+	Created  time.Time `json:"created"`
+	Hostname string    `json:"hostname"`
+	Files    []string  `json:"files"`
+}
+
+// ArchiveName names an archive after its creation time so that names sort
+// oldest first
+func ArchiveName(at time.Time) string {
+	return namePrefix + at.UTC().Format("20060102-150405") + nameSuffix
+}
+
+// isArchiveName reports whether name was produced by ArchiveName
+func isArchiveName(name string) bool {
+	return strings.HasPrefix(name, namePrefix) && strings.HasSuffix(name, nameSuffix)
+}
+
+// DefaultInclude accepts configuration and state files and skips runtime
+// files that are recreated on start, such as pidfiles, the event script,
+// the traffic ledger and the generated DHCP and DNS server configuration,
+// as well as logs and locally stored backups
+func DefaultInclude(rel string) bool {
+	if rel == "backups" || strings.HasPrefix(rel, "backups"+string(filepath.Separator)) {
+		return false
+	}
+	switch filepath.Ext(rel) {
+	case ".pid", ".sh", ".tmp":
+		return false
+	}
+	base := filepath.Base(rel)
+	if base == "coredns-hosts" || base == "accounting.json" || strings.HasSuffix(base, "-health.json") {
+		return false
+	}
+	for _, server := range []string{"dnsmasq", "kea", "coredns"} {
+		if base == server+".conf" || strings.HasPrefix(base, server+".log") {
+			return false
+		}
+	}
+	return rel != "backup.log"
+}
+
+// FullInclude accepts what DefaultInclude does plus the traffic ledgers,
+// for moving the complete state to another machine
+func FullInclude(rel string) bool {
+	return DefaultInclude(rel) || filepath.Base(rel) == "accounting.json"
+}
+
+// Create writes a gzipped tarball of the regular files below dir accepted
+// by include, preceded by a manifest
+func Create(w io.Writer, dir string, include func(rel string) bool, at time.Time) (*Manifest, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !include(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+	sort.Strings(files)
+
+	hostname, _ := os.Hostname()
+	manifest := &Manifest{Version: Version, Created: at, Hostname: hostname, Files: files}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeManifest(tw, manifest); err != nil {
+		return nil, err
+	}
+	for _, rel := range files {
+		if err := addFile(tw, dir, rel); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return manifest, nil
+}
+
+func writeManifest(tw *tar.Writer, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: manifestName, Mode: 0644, Size: int64(len(data)), ModTime: manifest.Created}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+func addFile(tw *tar.Writer, dir, rel string) error {
+	file, err := os.Open(filepath.Join(dir, rel))
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", rel, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", rel, err)
+	}
+	header := &tar.Header{
+		Name:    filepath.ToSlash(filepath.Join("files", rel)),
+		Mode:    int64(info.Mode().Perm()),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := io.Copy(tw, file); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", rel, err)
+	}
+	return nil
+}
+
+// Extract restores the files of an archive into dir, replacing existing
+// files, and returns its manifest
+func Extract(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var manifest *Manifest
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if header.Name == manifestName {
+			if manifest, err = readManifest(tr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if manifest == nil {
+			return nil, fmt.Errorf("not a backup archive: missing manifest")
+		}
+		if err := extractFile(tr, header, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("not a backup archive: missing manifest")
+	}
+	return manifest, nil
+}
+
+func readManifest(r io.Reader) (*Manifest, error) {
+	var manifest Manifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid backup manifest: %w", err)
+	}
+	if manifest.Version != Version {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+	return &manifest, nil
+}
+
+// extractFile writes a single archived file below dir, refusing paths that
+// would escape it
+func extractFile(r io.Reader, header *tar.Header, dir string) error {
+	rel, ok := strings.CutPrefix(header.Name, "files/")
+	if !ok || header.Typeflag != tar.TypeReg || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return fmt.Errorf("refusing to restore %q", header.Name)
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", rel, err)
+	}
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fs.FileMode(header.Mode).Perm())
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", rel, err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to restore %s: %w", rel, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", rel, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", rel, err)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreateAndExtract(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"config.yaml":                       "external_interface: en0\n",
+		"state.yaml":                        "instances: {}\n",
+		"instances/lab/config.yaml":         "internal_network: 10.10.0\n",
+		"dnsmasq.pid":                       "123\n",
+		"dhcp-event.sh":                     "#!/bin/sh\n",
+		"backups/old-backup.tar.gz":         "old",
+		"dhcp-fingerprints.json":            "{}",
+		"instances/lab/dnsmasq.leases":      "0 aa:bb:cc:dd:ee:ff 10.10.0.100 * *\n",
+		"instances/lab/dnsmasq.conf":        "interface=bridge100\n",
+		"instances/lab/dnsmasq.log.1":       "dnsmasq: started\n",
+		"instances/lab/kea.conf":            "{}\n",
+		"instances/lab/kea-leases4.csv":     "address,hwaddr\n",
+		"instances/lab/coredns-health.json": "{}",
+		"instances/lab/accounting.json":     "{}",
+	})
+
+	var buf bytes.Buffer
+	at := time.Date(2026, 10, 16, 2, 0, 0, 0, time.UTC)
+	manifest, err := Create(&buf, src, DefaultInclude, at)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	expected := []string{"config.yaml", "dhcp-fingerprints.json", "instances/lab/config.yaml", "instances/lab/dnsmasq.leases", "instances/lab/kea-leases4.csv", "state.yaml"}
+	if strings.Join(manifest.Files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Archived files = %v, expected %v", manifest.Files, expected)
+	}
+
+	dst := t.TempDir()
+	writeFiles(t, dst, map[string]string{"config.yaml": "stale\n"})
+	restored, err := Extract(&buf, dst)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if !restored.Created.Equal(at) || len(restored.Files) != len(expected) {
+		t.Errorf("Unexpected manifest %+v", restored)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "instances", "lab", "config.yaml"))
+	if err != nil || string(data) != "internal_network: 10.10.0\n" {
+		t.Errorf("Nested file not restored: %q, %v", data, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "config.yaml")); string(data) != "external_interface: en0\n" {
+		t.Errorf("Existing file not replaced: %q", data)
+	}
+	if info, err := os.Stat(filepath.Join(dst, "state.yaml")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("File permissions not restored: %v", err)
+	}
+
+	full, err := Create(io.Discard, src, FullInclude, at)
+	if err != nil {
+		t.Fatalf("Create with FullInclude failed: %v", err)
+	}
+	expected = append([]string{"config.yaml", "dhcp-fingerprints.json", "instances/lab/accounting.json"}, expected[2:]...)
+	if strings.Join(full.Files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Fully archived files = %v, expected %v", full.Files, expected)
+	}
+}
+
+func TestExtractRejectsUnsafePaths(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := writeManifest(tw, &Manifest{Version: Version}); err != nil {
+		t.Fatal(err)
+	}
+	_ = tw.WriteHeader(&tar.Header{Name: "files/../../escape", Mode: 0644, Size: 1})
+	_, _ = tw.Write([]byte("x"))
+	_ = tw.Close()
+	_ = gz.Close()
+
+	dir := t.TempDir()
+	if _, err := Extract(&buf, filepath.Join(dir, "config")); err == nil {
+		t.Error("Extract should refuse paths outside the target directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape")); err == nil {
+		t.Error("Unsafe path was written")
+	}
+
+	if _, err := Extract(strings.NewReader("not gzip"), dir); err == nil {
+		t.Error("Extract should reject non-archives")
+	}
+}
+
+func TestRunRotatesLocalTarget(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{"config.yaml": "external_interface: en0\n"})
+
+	target, err := ParseTarget(filepath.Join(t.TempDir(), "backups"))
+	if err != nil {
+		t.Fatalf("ParseTarget failed: %v", err)
+	}
+	local := target.(localTarget)
+	if err := os.MkdirAll(local.dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		ArchiveName(time.Date(2026, 10, 13, 2, 0, 0, 0, time.UTC)),
+		ArchiveName(time.Date(2026, 10, 14, 2, 0, 0, 0, time.UTC)),
+		ArchiveName(time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC)),
+		"notes.txt",
+	} {
+		writeFiles(t, local.dir, map[string]string{name: "x"})
+	}
+
+	name, manifest, err := Run(target, src, DefaultInclude, 2)
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(manifest.Files) != 1 {
+		t.Errorf("Expected 1 archived file, got %v", manifest.Files)
+	}
+
+	archives, err := target.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(archives) != 2 || archives[1] != name || !strings.Contains(archives[0], "20261015") {
+		t.Errorf("Expected the two newest archives, got %v", archives)
+	}
+	if _, err := os.Stat(filepath.Join(local.dir, "notes.txt")); err != nil {
+		t.Error("Rotation should leave unrelated files alone")
+	}
+
+	restored := filepath.Join(t.TempDir(), "restore.tar.gz")
+	if err := target.Download(name, restored); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	file, _ := os.Open(restored)
+	defer func() { _ = file.Close() }()
+	if _, err := Extract(file, t.TempDir()); err != nil {
+		t.Errorf("Downloaded archive does not extract: %v", err)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	testCases := []struct {
+		dest     string
+		expected string
+		valid    bool
+	}{
+		{"/Volumes/Backup/nat", "/Volumes/Backup/nat", true},
+		{"scp://backup@nas.local/volume1/nat", "scp://backup@nas.local/volume1/nat", true},
+		{"scp://nas.local:2222/srv/nat", "scp://nas.local:2222/srv/nat", true},
+		{"s3://lab-backups/nat-manager/", "s3://lab-backups/nat-manager", true},
+		{"s3://lab-backups", "s3://lab-backups", true},
+		{"scp://nas.local", "", false},
+		{"scp://-oProxyCommand=sh/srv/nat", "", false},
+		{"scp://-oProxyCommand=sh@nas.local/srv/nat", "", false},
+		{"ftp://nas.local/nat", "", false},
+		{"", "", false},
+	}
+
+	for _, tc := range testCases {
+		target, err := ParseTarget(tc.dest)
+		if (err == nil) != tc.valid {
+			t.Errorf("ParseTarget(%q) error = %v, expected valid=%v", tc.dest, err, tc.valid)
+			continue
+		}
+		if tc.valid && target.String() != tc.expected {
+			t.Errorf("ParseTarget(%q) = %s, expected %s", tc.dest, target, tc.expected)
+		}
+	}
+}
+
+func TestRemoteCommands(t *testing.T) {
+	target, _ := ParseTarget("scp://backup@nas.local:2222/srv/nat's")
+	scp := target.(scpTarget)
+
+	args := strings.Join(scp.scpArgs("/tmp/a.tar.gz", scp.remote("b.tar.gz")), " ")
+	if args != `-q -o BatchMode=yes -P 2222 -- /tmp/a.tar.gz backup@nas.local:'/srv/nat'\''s/b.tar.gz'` {
+		t.Errorf("Unexpected scp arguments: %s", args)
+	}
+	args = strings.Join(scp.sshArgs("true"), " ")
+	if args != "-p 2222 -o BatchMode=yes -- backup@nas.local true" {
+		t.Errorf("Unexpected ssh arguments: %s", args)
+	}
+
+	listing := "2026-10-15 02:00:01      10240 nat-manager-backup-20261015-020000.tar.gz\n" +
+		"                           PRE old/\n" +
+		"2026-10-14 02:00:01      10240 nat-manager-backup-20261014-020000.tar.gz\n"
+	names := sortArchives(parseS3Listing(listing))
+	if len(names) != 2 || names[0] != "nat-manager-backup-20261014-020000.tar.gz" {
+		t.Errorf("Unexpected S3 listing parse: %v", names)
+	}
+}
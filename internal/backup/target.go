@@ -0,0 +1,301 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Target stores backup archives
+type Target interface {
+	String() string
+	Upload(localPath, name string) error
+	Download(name, localPath string) error
+	List() ([]string, error) // archive names, oldest first
+	Remove(name string) error
+}
+
+// ParseTarget parses a backup destination: a local directory,
+// scp://[user@]host[:port]/path or s3://bucket/prefix
+func ParseTarget(dest string) (Target, error) {
+	switch {
+	case dest == "":
+		return nil, fmt.Errorf("no backup target configured")
+	case strings.HasPrefix(dest, "scp://"):
+		return parseSCPTarget(dest)
+	case strings.HasPrefix(dest, "s3://"):
+		u, err := url.Parse(dest)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid S3 target %q", dest)
+		}
+		return s3Target{bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+	case strings.Contains(dest, "://"):
+		return nil, fmt.Errorf("unsupported backup target %q (use a directory, scp:// or s3://)", dest)
+	}
+
+	if rest, ok := strings.CutPrefix(dest, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dest = filepath.Join(home, rest)
+	}
+	return localTarget{dir: dest}, nil
+}
+
+// sortArchives keeps archive names and sorts them oldest first
+func sortArchives(names []string) []string {
+	archives := make([]string, 0, len(names))
+	for _, name := range names {
+		if isArchiveName(name) {
+			archives = append(archives, name)
+		}
+	}
+	sort.Strings(archives)
+	return archives
+}
+
+// localTarget stores archives in a directory
+type localTarget struct {
+	dir string
+}
+
+func (t localTarget) String() string { return t.dir }
+
+func (t localTarget) Upload(localPath, name string) error {
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", t.dir, err)
+	}
+	return copyFile(localPath, filepath.Join(t.dir, name))
+}
+
+func (t localTarget) Download(name, localPath string) error {
+	return copyFile(filepath.Join(t.dir, name), localPath)
+}
+
+func (t localTarget) List() ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", t.dir, err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return sortArchives(names), nil
+}
+
+func (t localTarget) Remove(name string) error {
+	return os.Remove(filepath.Join(t.dir, name))
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to copy backup: %w", err)
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to copy backup: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("failed to copy backup: %w", err)
+	}
+	return out.Close()
+}
+
+// scpTarget stores archives on an SSH host using scp and ssh
+type scpTarget struct {
+	host string // [user@]host
+	port string
+	dir  string
+}
+
+func parseSCPTarget(dest string) (Target, error) {
+	u, err := url.Parse(dest)
+	if err != nil || u.Hostname() == "" || u.Path == "" {
+		return nil, fmt.Errorf("invalid scp target %q (expected scp://[user@]host[:port]/path)", dest)
+	}
+	host := u.Hostname()
+	if strings.HasPrefix(host, "-") {
+		return nil, fmt.Errorf("invalid scp target %q: host must not start with '-'", dest)
+	}
+	if u.User != nil {
+		if strings.HasPrefix(u.User.Username(), "-") {
+			return nil, fmt.Errorf("invalid scp target %q: user must not start with '-'", dest)
+		}
+		host = u.User.Username() + "@" + host
+	}
+	return scpTarget{host: host, port: u.Port(), dir: u.Path}, nil
+}
+
+func (t scpTarget) String() string {
+	if t.port != "" {
+		return "scp://" + t.host + ":" + t.port + t.dir
+	}
+	return "scp://" + t.host + t.dir
+}
+
+// sshArgs returns the ssh arguments running command on the host. The
+// operands follow "--" so that they are never read as options.
+func (t scpTarget) sshArgs(command string) []string {
+	var args []string
+	if t.port != "" {
+		args = append(args, "-p", t.port)
+	}
+	return append(args, "-o", "BatchMode=yes", "--", t.host, command)
+}
+
+// scpArgs returns the scp arguments copying from src to dst
+func (t scpTarget) scpArgs(src, dst string) []string {
+	args := []string{"-q", "-o", "BatchMode=yes"}
+	if t.port != "" {
+		args = append(args, "-P", t.port)
+	}
+	return append(args, "--", src, dst)
+}
+
+func (t scpTarget) remote(name string) string {
+	return t.host + ":" + shellQuote(path.Join(t.dir, name))
+}
+
+func (t scpTarget) Upload(localPath, name string) error {
+	if err := run("ssh", t.sshArgs("mkdir -p "+shellQuote(t.dir))...); err != nil {
+		return err
+	}
+	return run("scp", t.scpArgs(localPath, t.remote(name))...)
+}
+
+func (t scpTarget) Download(name, localPath string) error {
+	return run("scp", t.scpArgs(t.remote(name), localPath)...)
+}
+
+func (t scpTarget) List() ([]string, error) {
+	output, err := exec.Command("ssh", t.sshArgs("ls -1 "+shellQuote(t.dir)+" 2>/dev/null || true")...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", t, err)
+	}
+	return sortArchives(strings.Fields(string(output))), nil
+}
+
+func (t scpTarget) Remove(name string) error {
+	return run("ssh", t.sshArgs("rm -f "+shellQuote(path.Join(t.dir, name)))...)
+}
+
+// s3Target stores archives in an S3 bucket using the aws CLI
+type s3Target struct {
+	bucket string
+	prefix string
+}
+
+func (t s3Target) String() string {
+	return "s3://" + path.Join(t.bucket, t.prefix)
+}
+
+func (t s3Target) url(name string) string {
+	return "s3://" + path.Join(t.bucket, t.prefix, name)
+}
+
+func (t s3Target) Upload(localPath, name string) error {
+	return run("aws", "s3", "cp", "--only-show-errors", localPath, t.url(name))
+}
+
+func (t s3Target) Download(name, localPath string) error {
+	return run("aws", "s3", "cp", "--only-show-errors", t.url(name), localPath)
+}
+
+func (t s3Target) List() ([]string, error) {
+	output, err := exec.Command("aws", "s3", "ls", t.String()+"/").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", t, err)
+	}
+	return sortArchives(parseS3Listing(string(output))), nil
+}
+
+func (t s3Target) Remove(name string) error {
+	return run("aws", "s3", "rm", "--only-show-errors", t.url(name))
+}
+
+// parseS3Listing returns the object names of an `aws s3 ls` listing, whose
+// lines end with the object name
+func parseS3Listing(listing string) []string {
+	var names []string
+	for _, line := range strings.Split(listing, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			names = append(names, fields[len(fields)-1])
+		}
+	}
+	return names
+}
+
+// shellQuote quotes s for a remote POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// run runs a command, including its output in the error
+func run(name string, args ...string) error {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Run archives the files below dir accepted by include, uploads the archive
+// to target and keeps only the newest keep archives there (all if keep is 0)
+func Run(target Target, dir string, include func(string) bool, keep int) (string, *Manifest, error) {
+	tmp, err := os.CreateTemp("", "nat-manager-backup-*")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	at := time.Now()
+	manifest, err := Create(tmp, dir, include, at)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := ArchiveName(at)
+	if err := target.Upload(tmp.Name(), name); err != nil {
+		return "", nil, fmt.Errorf("failed to upload backup to %s: %w", target, err)
+	}
+	if err := Rotate(target, keep); err != nil {
+		return name, manifest, err
+	}
+	return name, manifest, nil
+}
+
+// Rotate removes the oldest archives on target beyond keep
+func Rotate(target Target, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	archives, err := target.List()
+	if err != nil {
+		return err
+	}
+	for len(archives) > keep {
+		if err := target.Remove(archives[0]); err != nil {
+			return fmt.Errorf("failed to rotate backups: %w", err)
+		}
+		archives = archives[1:]
+	}
+	return nil
+}
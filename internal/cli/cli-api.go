@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/metrics"
+)
+
+// startAPIServer runs the localhost API listener in the background until ctx
+// is cancelled when it is enabled in the configuration. Every request is
+// recorded in the audit log. The returned server is nil when the API is
+// disabled or failed to start.
+func startAPIServer(ctx context.Context, cfg *config.Config) *api.Server {
+	if !cfg.API.Enabled {
+		return nil
+	}
+
+	// the diagnostics require the token of the REST API
+	var token string
+	if cfg.API.Diagnostics {
+		tokenPath, err := config.GetAPITokenPath()
+		if err == nil {
+			token, err = api.LoadToken(tokenPath)
+		}
+		if err != nil {
+			logging.Component(logging.API).Warn("API disabled", "error", err)
+			return nil
+		}
+	}
+
+	auditLog := openAuditLog()
+	go func() {
+		<-ctx.Done()
+		_ = auditLog.Close()
+	}()
+
+	server, err := api.New(api.Config{
+		Listen:      cfg.API.Listen,
+		Diagnostics: cfg.API.Diagnostics,
+		Token:       token,
+		Audit:       auditLog,
+		Metrics:     metrics.Default,
+	})
+	if err != nil {
+		logging.Component(logging.API).Warn("API disabled", "error", err)
+		return nil
+	}
+
+	listener, err := server.Listen()
+	if err != nil {
+		logging.Component(logging.API).Warn("API disabled", "error", err)
+		return nil
+	}
+
+	go func() {
+		if err := server.Serve(ctx, listener); err != nil {
+			logging.Component(logging.API).Error("API server failed", "error", err)
+		}
+	}()
+
+	fmt.Fprintf(stdout, "🩺 API listening on http://%s (metrics at /metrics)", server.Addr())
+	if cfg.API.Diagnostics {
+		fmt.Fprintf(stdout, " (pprof at /debug/pprof/, with the API token)")
+	}
+	fmt.Fprintln(stdout)
+	return server
+}
+
+// openAuditLog opens the shared audit log, warning and returning nil (which
+// discards entries) when it cannot be opened
+func openAuditLog() *audit.Log {
+	path, err := config.GetAuditLogPath()
+	if err == nil {
+		var log *audit.Log
+		if log, err = audit.Open(path, config.Instance()); err == nil {
+			return log
+		}
+	}
+	logging.Component(logging.API).Warn("audit log disabled", "error", err)
+	return nil
+}
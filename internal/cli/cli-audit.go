@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+)
+
+var (
+	auditSource string
+	auditActor  string
+	auditAction string
+	auditSince  time.Duration
+	auditLines  int
+	auditJSON   bool
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the audit trail",
+	Long: `Show who did what through the API and the captive portal, and every
+change nat-manager made to the machine.
+
+Every API call is recorded with the calling address, method and path and the
+response status, and every captive portal accept attempt with the device's
+address and whether access was granted. Every system command that changes
+the machine, such as loading pf rules, creating a bridge, setting IP
+forwarding or installing a launchd job, is recorded with the user who ran
+nat-manager, the full command line and whether it succeeded, as are DHCP
+servers started and stopped. Commands that only read the system state are
+not recorded. Entries from all instances are kept in one log.
+
+Example:
+  nat-manager audit
+  nat-manager audit --source system -n 0  # everything done to this machine
+  nat-manager audit --source api --since 24h
+  nat-manager audit --actor 192.168.100.50 --json`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		query := audit.Query{
+			Source: auditSource,
+			Actor:  auditActor,
+			Action: auditAction,
+			Limit:  auditLines,
+		}
+		if auditSince > 0 {
+			query.Since = time.Now().Add(-auditSince)
+		}
+
+		entries, err := readAuditLog(query)
+		if err != nil {
+			return err
+		}
+
+		if format := selectedOutput(auditJSON); format != outputTable {
+			return writeOutput(os.Stdout, format, entries)
+		}
+
+		if len(entries) == 0 {
+			fmt.Fprintf(stdout, "No audit entries\n")
+			return nil
+		}
+		fmt.Fprintf(stdout, "%-19s %-7s %-10s %-15s %-30s %s\n", "TIME", "SOURCE", "INSTANCE", "ACTOR", "ACTION", "RESULT")
+		for _, entry := range entries {
+			printAuditEntry(entry)
+		}
+		return nil
+	},
+}
+
+// readAuditLog reads the entries of the audit log matching query
+func readAuditLog(query audit.Query) ([]audit.Entry, error) {
+	path, err := config.GetAuditLogPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log path: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []audit.Entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	return audit.Read(file, query)
+}
+
+func printAuditEntry(entry audit.Entry) {
+	action := entry.Action
+	if entry.Target != "" {
+		action += " " + entry.Target
+	}
+	if len(action) > 30 {
+		action = action[:27] + "..."
+	}
+	fmt.Fprintf(stdout, "%-19s %-7s %-10s %-15s %-30s %s\n",
+		entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Source,
+		entry.Instance, entry.Actor, action, entry.Result)
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().StringVar(&auditSource, "source", "", "only show entries from this source (api, portal or system)")
+	auditCmd.Flags().StringVar(&auditActor, "actor", "", "only show entries from this client address, MAC or user")
+	auditCmd.Flags().StringVar(&auditAction, "action", "", "only show actions containing this text")
+	auditCmd.Flags().DurationVar(&auditSince, "since", 0, "only show entries newer than this (e.g. 1h)")
+	auditCmd.Flags().IntVarP(&auditLines, "lines", "n", 50, "number of most recent entries to show (0 for all)")
+	auditCmd.Flags().BoolVar(&auditJSON, "json", false, "output entries as JSON")
+}
@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// automationVersion is the version of the automation output; fields are
+// only ever added within a version
+const automationVersion = 1
+
+// automationResult is the JSON object every automation command prints
+type automationResult struct {
+	Version  int          `json:"version"`
+	OK       bool         `json:"ok"`
+	Action   string       `json:"action"`
+	Instance string       `json:"instance"`
+	Changed  bool         `json:"changed"` // NAT was started or stopped
+	Error    string       `json:"error,omitempty"`
+	State    *api.Summary `json:"state,omitempty"`
+	Devices  []nat.Device `json:"devices,omitempty"`
+	Profiles []string     `json:"profiles,omitempty"`
+}
+
+// automationCmd represents the automation command
+var automationCmd = &cobra.Command{
+	Use:   "automation",
+	Short: "One-shot JSON commands for Shortcuts and AppleScript",
+	Long: `One-shot commands for Apple Shortcuts, AppleScript and other automation.
+Each prints a single JSON object and exits with 0 on success or the usual
+exit codes on failure (3 not running, 4 permission, 5 conflict):
+
+  {"version":1,"ok":true,"action":"toggle","instance":"default",
+   "changed":true,"state":{"active":true,"devices":3,"connections":42,...}}
+  {"version":1,"ok":false,"action":"start","instance":"default",
+   "changed":false,"error":"..."}
+
+The output is stable: within a version fields are only added. start and
+stop succeed without a change when NAT already is in the state asked for.
+Without root, every command but switch runs through the privileged helper
+('sudo nat-manager helper install'), so Shortcuts' "Run Shell Script"
+action works without a password.
+
+Example:
+  nat-manager automation status
+  nat-manager automation toggle
+  nat-manager automation devices
+  sudo nat-manager automation switch travel
+  osascript -e 'do shell script "/opt/homebrew/bin/nat-manager automation toggle"'`,
+}
+
+// automationStatusCmd represents the automation status command
+var automationStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Print the NAT state and device count",
+	RunE: automation("status", func(api.Controller, *automationResult) error {
+		return nil
+	}),
+}
+
+// automationStartCmd represents the automation start command
+var automationStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start NAT with the saved configuration",
+	RunE: automation("start", func(ctrl api.Controller, result *automationResult) error {
+		return automationSet(ctrl, result, true)
+	}),
+}
+
+// automationStopCmd represents the automation stop command
+var automationStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop NAT",
+	RunE: automation("stop", func(ctrl api.Controller, result *automationResult) error {
+		return automationSet(ctrl, result, false)
+	}),
+}
+
+// automationToggleCmd represents the automation toggle command
+var automationToggleCmd = &cobra.Command{
+	Use:   "toggle",
+	Short: "Start NAT if it is stopped, stop it if it runs",
+	RunE: automation("toggle", func(ctrl api.Controller, result *automationResult) error {
+		status, err := ctrl.Status()
+		if err != nil {
+			return err
+		}
+		return automationSet(ctrl, result, !status.Active)
+	}),
+}
+
+// automationDevicesCmd represents the automation devices command
+var automationDevicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "Print the NAT state and the devices online",
+	RunE: automation("devices", func(ctrl api.Controller, result *automationResult) error {
+		devices, err := ctrl.Devices()
+		if err != nil {
+			return err
+		}
+		result.Devices = []nat.Device{}
+		for _, d := range devices {
+			if d.Online {
+				result.Devices = append(result.Devices, d)
+			}
+		}
+		return nil
+	}),
+}
+
+// automationProfilesCmd represents the automation profiles command
+var automationProfilesCmd = &cobra.Command{
+	Use:         "profiles",
+	Short:       "Print the profiles",
+	Annotations: map[string]string{helperAnnotation: helperNone},
+	Args:        cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		result := automationResult{Version: automationVersion, Action: "profiles", Instance: config.Instance()}
+		profiles, err := config.ListProfiles()
+		if profiles == nil {
+			profiles = []string{}
+		}
+		result.Profiles = profiles
+		return printAutomation(result, err)
+	},
+}
+
+// automationSwitchCmd represents the automation switch command
+var automationSwitchCmd = &cobra.Command{
+	Use:   "switch <profile>",
+	Short: "Run NAT with a profile, restarting it if it runs",
+	Long: `Run NAT with the settings of a profile: NAT is stopped if it runs and
+started with the profile. Needs root.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeProfiles,
+	RunE: func(_ *cobra.Command, args []string) error {
+		result := automationResult{Version: automationVersion, Action: "switch", Instance: config.Instance()}
+		if !config.ProfileExists(args[0]) {
+			return printAutomation(result, exitWith(ExitUsage, fmt.Errorf("no profile %q", args[0])))
+		}
+		if err := config.SetProfile(args[0]); err != nil {
+			return printAutomation(result, exitWith(ExitUsage, err))
+		}
+		ctrl := &restController{}
+		_, err := ctrl.Stop()
+		if err != nil && !errors.Is(err, nat.ErrNotRunning) {
+			return printAutomation(result, err)
+		}
+		if _, err := ctrl.Start(); err != nil {
+			return printAutomation(result, err)
+		}
+		result.Changed = true
+		return printAutomation(result, automationState(ctrl, &result))
+	},
+}
+
+// automation returns the RunE of a command acting through the helper
+// without root, printing the result with the state after the action
+func automation(action string, run func(ctrl api.Controller, result *automationResult) error) func(*cobra.Command, []string) error {
+	return func(_ *cobra.Command, _ []string) error {
+		result := automationResult{Version: automationVersion, Action: action, Instance: config.Instance()}
+		var ctrl api.Controller = &restController{}
+		if os.Geteuid() != 0 {
+			if !connectHelper() {
+				return printAutomation(result, exitWith(ExitPermission,
+					fmt.Errorf("run as root or install the helper ('sudo nat-manager helper install')")))
+			}
+			ctrl = helperClient
+		}
+		if err := run(ctrl, &result); err != nil {
+			return printAutomation(result, err)
+		}
+		return printAutomation(result, automationState(ctrl, &result))
+	}
+}
+
+// automationSet starts or stops NAT unless it already is in that state
+func automationSet(ctrl api.Controller, result *automationResult, active bool) error {
+	var err error
+	if active {
+		_, err = ctrl.Start()
+	} else {
+		_, err = ctrl.Stop()
+	}
+	switch {
+	case err == nil:
+		result.Changed = true
+		return nil
+	case active && errors.Is(err, nat.ErrConflict), !active && errors.Is(err, nat.ErrNotRunning):
+		status, statusErr := ctrl.Status()
+		if statusErr == nil && status.Active == active {
+			return nil
+		}
+	}
+	return err
+}
+
+// automationState adds the state of NAT to result
+func automationState(ctrl api.Controller, result *automationResult) error {
+	status, err := ctrl.Status()
+	if err != nil {
+		return err
+	}
+	devices, err := ctrl.Devices()
+	if err != nil {
+		return err
+	}
+	summary := api.Summarize(status, devices)
+	result.State = &summary
+	return nil
+}
+
+// printAutomation prints result, failed with err if set, and returns err
+// with its exit code but without a message
+func printAutomation(result automationResult, err error) error {
+	result.OK = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	if encodeErr := encoder.Encode(result); encodeErr != nil {
+		return encodeErr
+	}
+	if err != nil {
+		return exitWith(ExitCode(err), nil)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(automationCmd)
+	for _, cmd := range []*cobra.Command{automationStatusCmd, automationStartCmd, automationStopCmd, automationToggleCmd, automationDevicesCmd} {
+		cmd.Args = cobra.NoArgs
+		cmd.Annotations = map[string]string{helperAnnotation: helperNone}
+		automationCmd.AddCommand(cmd)
+	}
+	automationCmd.AddCommand(automationProfilesCmd)
+	automationCmd.AddCommand(automationSwitchCmd)
+}
@@ -0,0 +1,356 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/backup"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/launchd"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// backupJobLabel is the launchd label of the scheduled backup job
+const backupJobLabel = launchd.LabelPrefix + "backup"
+
+var backupScheduleRemove bool
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Back up and restore configuration and state",
+	Long: `Back up the configuration of every instance, the device inventory,
+DHCP leases and the DNS query and audit history, and restore them after a
+machine reinstall.
+
+Archives are stored on backup.target: a local directory (the default is
+~/.config/nat-manager/backups), scp://[user@]host[:port]/path or
+s3://bucket/prefix. scp targets use ssh keys and S3 targets use the aws CLI
+and its configured credentials. Only the newest backup.keep archives (7 by
+default) are kept.
+
+'backup create' writes the complete state, traffic counters included, to a
+single local archive instead, for moving NAT to another machine.
+
+Example:
+  nat-manager backup run
+  nat-manager backup create nat-manager.tar.gz
+  nat-manager backup schedule
+  nat-manager backup list
+  nat-manager backup restore`,
+}
+
+// backupRunCmd represents the backup run command
+var backupRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Back up now",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, target, err := loadBackupTarget()
+		if err != nil {
+			return err
+		}
+		dir, err := config.BaseDir()
+		if err != nil {
+			return fmt.Errorf("failed to get config directory: %w", err)
+		}
+
+		name, manifest, err := backup.Run(target, dir, backup.DefaultInclude, cfg.Backup.GetKeep())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Backed up %d files to %s/%s\n", len(manifest.Files), target, name)
+		return nil
+	},
+}
+
+// backupCreateCmd represents the backup create command
+var backupCreateCmd = &cobra.Command{
+	Use:   "create [file|-]",
+	Short: "Snapshot the complete state to a local archive",
+	Long: `Write the configuration of every instance, DHCP reservations and
+leases, port forwards, blocklists, the device inventory, the DNS query and
+audit history and the traffic counters to a gzipped tarball, by default
+named after the current time in the current directory, or to stdout for
+"-".
+
+Restore it on another machine with 'backup restore <file>', or stream it
+there directly.
+
+Example:
+  nat-manager backup create
+  nat-manager backup create /Volumes/USB/nat-manager.tar.gz
+  nat-manager backup create - | ssh newmac sudo nat-manager backup restore -`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		dir, err := config.BaseDir()
+		if err != nil {
+			return fmt.Errorf("failed to get config directory: %w", err)
+		}
+
+		now := time.Now()
+		path := backup.ArchiveName(now)
+		if len(args) == 1 {
+			path = args[0]
+		}
+		if path == "-" {
+			_, err := backup.Create(os.Stdout, dir, backup.FullInclude, now)
+			return err
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create backup: %w", err)
+		}
+		manifest, err := backup.Create(file, dir, backup.FullInclude, now)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(path)
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Backed up %d files to %s\n", len(manifest.Files), path)
+		return nil
+	},
+}
+
+// backupListCmd represents the backup list command
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List backups on the target",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		_, target, err := loadBackupTarget()
+		if err != nil {
+			return err
+		}
+		archives, err := target.List()
+		if err != nil {
+			return err
+		}
+
+		if len(archives) == 0 {
+			fmt.Fprintf(stdout, "No backups in %s\n", target)
+			return nil
+		}
+		fmt.Fprintf(stdout, "Backups in %s:\n", target)
+		for _, name := range archives {
+			fmt.Fprintf(stdout, "   %s\n", name)
+		}
+		return nil
+	},
+}
+
+// backupRestoreCmd represents the backup restore command
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore [archive|-]",
+	Short: "Restore a backup",
+	Long: `Restore a backup, by default the newest one on the target. The
+archive may also be given as a name listed by 'backup list', as a path to a
+local file, such as one written by 'backup create', or as "-" to read it
+from stdin.
+
+The current configuration and state are archived to
+~/.config/nat-manager/backups first. Restart NAT afterwards to apply the
+restored configuration.
+
+Example:
+  nat-manager backup restore
+  nat-manager backup restore nat-manager-backup-20261016-020000.tar.gz
+  nat-manager backup restore ~/Downloads/nat-manager-backup-20261016-020000.tar.gz`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		archive, cleanup, err := fetchArchive(args)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+
+		dir, err := config.BaseDir()
+		if err != nil {
+			return fmt.Errorf("failed to get config directory: %w", err)
+		}
+
+		// Keep the state being replaced in case the wrong archive was picked
+		safety, err := backup.ParseTarget(filepath.Join(dir, "backups"))
+		if err == nil {
+			_, _, err = backup.Run(safety, dir, backup.DefaultInclude, 0)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save current state before restoring: %w", err)
+		}
+
+		file, err := os.Open(archive)
+		if err != nil {
+			return fmt.Errorf("failed to open backup: %w", err)
+		}
+		defer func() { _ = file.Close() }()
+
+		manifest, err := backup.Extract(file, dir)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Restored %d files backed up on %s at %s\n",
+			len(manifest.Files), manifest.Hostname, manifest.Created.Local().Format("2006-01-02 15:04"))
+		fmt.Fprintf(stdout, "   Previous state saved in %s\n", safety)
+		fmt.Fprintf(stdout, "   Restart NAT to apply the restored configuration\n")
+		return nil
+	},
+}
+
+// backupScheduleCmd represents the backup schedule command
+var backupScheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Run backups regularly with launchd",
+	Long: `Install a launchd job running 'backup run' every backup.interval
+(24h by default). When run with sudo the job is installed as a
+LaunchDaemon so it can read state files owned by root.
+
+Example:
+  nat-manager backup schedule
+  nat-manager backup schedule --remove`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if backupScheduleRemove {
+			if err := launchd.Uninstall(backupJobLabel); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "✅ Scheduled backups removed\n")
+			return nil
+		}
+
+		cfg, target, err := loadBackupTarget()
+		if err != nil {
+			return err
+		}
+		job, err := backupJob(cfg.Backup.GetInterval())
+		if err != nil {
+			return err
+		}
+		path, err := launchd.Install(job)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Backing up to %s every %s (%s)\n", target, cfg.Backup.GetInterval(), path)
+		return nil
+	},
+}
+
+// loadBackupTarget loads the configuration and its backup target
+func loadBackupTarget() (*config.Config, backup.Target, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	dest, err := cfg.Backup.GetTarget()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get backup target: %w", err)
+	}
+	target, err := backup.ParseTarget(dest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, target, nil
+}
+
+// fetchArchive returns a local path of the archive to restore: the given
+// file, the named archive or the newest archive on the target
+func fetchArchive(args []string) (string, func(), error) {
+	noop := func() {}
+	if len(args) == 1 && args[0] == "-" {
+		return stdinArchive()
+	}
+	if len(args) == 1 {
+		if _, err := os.Stat(args[0]); err == nil {
+			return args[0], noop, nil
+		}
+	}
+
+	_, target, err := loadBackupTarget()
+	if err != nil {
+		return "", noop, err
+	}
+
+	var name string
+	if len(args) == 1 {
+		name = filepath.Base(args[0])
+	} else {
+		archives, err := target.List()
+		if err != nil {
+			return "", noop, err
+		}
+		if len(archives) == 0 {
+			return "", noop, fmt.Errorf("no backups in %s", target)
+		}
+		name = archives[len(archives)-1]
+	}
+
+	tmp, err := os.CreateTemp("", "nat-manager-restore-*")
+	if err != nil {
+		return "", noop, fmt.Errorf("failed to download backup: %w", err)
+	}
+	_ = tmp.Close()
+	cleanup := func() { _ = os.Remove(tmp.Name()) }
+	if err := target.Download(name, tmp.Name()); err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("failed to download %s from %s: %w", name, target, err)
+	}
+	fmt.Fprintf(stdout, "📦 Restoring %s from %s\n", name, target)
+	return tmp.Name(), cleanup, nil
+}
+
+// stdinArchive copies an archive read from stdin to a temporary file
+func stdinArchive() (string, func(), error) {
+	tmp, err := os.CreateTemp("", "nat-manager-restore-*")
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to read backup: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(tmp.Name()) }
+	_, err = io.Copy(tmp, os.Stdin)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", func() {}, fmt.Errorf("failed to read backup from stdin: %w", err)
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// backupJob returns the launchd job running backups every interval
+func backupJob(interval time.Duration) (launchd.Job, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return launchd.Job{}, fmt.Errorf("failed to locate nat-manager: %w", err)
+	}
+	dir, err := config.BaseDir()
+	if err != nil {
+		return launchd.Job{}, fmt.Errorf("failed to get config directory: %w", err)
+	}
+
+	program := []string{exe}
+	if instance := config.Instance(); instance != nat.DefaultInstance {
+		program = append(program, "--instance", instance)
+	}
+	return launchd.Job{
+		Label:         backupJobLabel,
+		Program:       append(program, "backup", "run"),
+		StartInterval: int(interval.Seconds()),
+		Environment:   map[string]string{"HOME": os.Getenv("HOME")},
+		LogPath:       filepath.Join(dir, "backup.log"),
+	}, nil
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+	backupCmd.AddCommand(backupRunCmd)
+	backupCmd.AddCommand(backupCreateCmd)
+	backupCmd.AddCommand(backupListCmd)
+	backupCmd.AddCommand(backupRestoreCmd)
+	backupCmd.AddCommand(backupScheduleCmd)
+
+	backupScheduleCmd.Flags().BoolVar(&backupScheduleRemove, "remove", false, "remove the scheduled backup job")
+}
@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+)
+
+var batchContinueOnError bool
+
+// batchCmd represents the batch command
+var batchCmd = &cobra.Command{
+	Use:   "batch [file|-]",
+	Short: "Run nat-manager commands read from a file or stdin",
+	Long: `Run a sequence of nat-manager commands, one per line, read from a file
+or from stdin when the file is "-" or omitted. The privilege check runs and
+configuration files are read once for the whole batch, which suits
+provisioning scripts and CI.
+
+Lines are split like a shell would split them: words separated by spaces,
+with single quotes, double quotes and backslashes to keep spaces in a word.
+Empty lines and lines starting with # are skipped. Global flags given to
+batch, such as --instance or --profile, apply to every line.
+
+The batch stops at the first command that fails, unless --continue-on-error
+is set, and fails if any command failed.
+
+Example:
+  nat-manager batch - <<'EOF'
+  # lab network
+  config set internal_network 192.168.50
+  port-forward add --port 8080 --to 192.168.50.10:80 -d "web server"
+  devices block aa:bb:cc:dd:ee:ff
+  start --external en0 --internal bridge100
+  EOF
+
+  nat-manager --instance lab batch provision.txt`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := "-"
+		if len(args) == 1 {
+			source = args[0]
+		}
+		lines, err := readBatch(source)
+		if err != nil {
+			return err
+		}
+		return runBatch(cmd, lines)
+	},
+}
+
+// batchLine is one command of a batch
+type batchLine struct {
+	number int
+	text   string
+	args   []string
+}
+
+// readBatch reads the commands of a batch from a file, or stdin for "-"
+func readBatch(source string) ([]batchLine, error) {
+	in := io.Reader(os.Stdin)
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open batch file: %w", err)
+		}
+		defer func() { _ = file.Close() }()
+		in = file
+	}
+	return parseBatch(in)
+}
+
+// parseBatch splits the lines of a batch into arguments, skipping empty
+// lines and comments
+func parseBatch(in io.Reader) ([]batchLine, error) {
+	var lines []batchLine
+	scanner := bufio.NewScanner(in)
+	for number := 1; scanner.Scan(); number++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		args, err := splitCommandLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number, err)
+		}
+		if len(args) > 0 && args[0] == "nat-manager" {
+			args = args[1:]
+		}
+		lines = append(lines, batchLine{number: number, text: text, args: args})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch: %w", err)
+	}
+	return lines, nil
+}
+
+// splitCommandLine splits a line into words like a shell, honoring single
+// quotes, double quotes and backslash escapes
+func splitCommandLine(line string) ([]string, error) {
+	var s lineSplitter
+	for _, r := range line {
+		s.add(r)
+	}
+	if s.quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", s.quote)
+	}
+	if s.escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	s.endWord()
+	return s.words, nil
+}
+
+// lineSplitter holds the state of splitCommandLine
+type lineSplitter struct {
+	words   []string
+	word    strings.Builder
+	inWord  bool
+	quote   rune // the open quote, 0 outside quotes
+	escaped bool // the previous rune was a backslash
+}
+
+func (s *lineSplitter) add(r rune) {
+	switch {
+	case s.escaped:
+		s.word.WriteRune(r)
+		s.escaped = false
+	case s.quote != 0:
+		s.addQuoted(r)
+	case r == '\\':
+		s.escaped, s.inWord = true, true
+	case r == '\'' || r == '"':
+		s.quote, s.inWord = r, true
+	case r == ' ' || r == '\t':
+		s.endWord()
+	default:
+		s.word.WriteRune(r)
+		s.inWord = true
+	}
+}
+
+// addQuoted adds a rune inside quotes, where only a backslash within double
+// quotes escapes
+func (s *lineSplitter) addQuoted(r rune) {
+	switch {
+	case r == s.quote:
+		s.quote = 0
+	case r == '\\' && s.quote == '"':
+		s.escaped = true
+	default:
+		s.word.WriteRune(r)
+	}
+}
+
+func (s *lineSplitter) endWord() {
+	if s.inWord {
+		s.words = append(s.words, s.word.String())
+		s.word.Reset()
+		s.inWord = false
+	}
+}
+
+// runBatch runs the commands of a batch in order
+func runBatch(cmd *cobra.Command, lines []batchLine) error {
+	continueOnError := batchContinueOnError
+	global := changedFlags(cmd.Root().PersistentFlags())
+	config.CacheConfigFiles(true)
+	defer config.CacheConfigFiles(false)
+
+	failed := 0
+	for _, line := range lines {
+		err := runBatchLine(cmd, line, global)
+		if err == nil {
+			continue
+		}
+		if !continueOnError {
+			return fmt.Errorf("line %d: %w", line.number, err)
+		}
+		failed++
+		fmt.Fprintf(os.Stderr, "❌ line %d: %v\n", line.number, err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d commands failed", failed, len(lines))
+	}
+	return nil
+}
+
+// runBatchLine runs one command of a batch with the flags of earlier
+// commands reset and the global flags of the batch applied
+func runBatchLine(cmd *cobra.Command, line batchLine, global []string) error {
+	root := cmd.Root()
+	target, _, err := root.Find(line.args)
+	switch {
+	case err == nil && target == cmd:
+		return fmt.Errorf("batch cannot run batch")
+	case err == nil && target == root:
+		return fmt.Errorf("%q is not a command", line.text)
+	}
+
+	fmt.Fprintf(os.Stderr, "▶ %s\n", line.text)
+	resetFlags(root)
+	root.SetArgs(append(append([]string{}, global...), line.args...))
+	return root.Execute()
+}
+
+// changedFlags returns the flags set on the command line as arguments
+func changedFlags(flags *pflag.FlagSet) []string {
+	var args []string
+	flags.Visit(func(f *pflag.Flag) {
+		args = append(args, fmt.Sprintf("--%s=%s", f.Name, f.Value.String()))
+	})
+	return args
+}
+
+// resetFlags returns the flags of a command tree to their defaults, so that
+// flags set by one command of a batch do not leak into the next
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if !f.Changed {
+			return
+		}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(sliceDefault(f.DefValue))
+		} else {
+			_ = f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, child := range cmd.Commands() {
+		resetFlags(child)
+	}
+}
+
+// sliceDefault parses the default of a slice flag, printed as "[a,b]"
+func sliceDefault(def string) []string {
+	def = strings.TrimSuffix(strings.TrimPrefix(def, "["), "]")
+	if def == "" {
+		return []string{}
+	}
+	return strings.Split(def, ",")
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+
+	batchCmd.Flags().BoolVar(&batchContinueOnError, "continue-on-error", false, "run the remaining commands when one fails")
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// blockCmd represents the block command
+var blockCmd = &cobra.Command{
+	Use:   "block <device|ip|domain>...",
+	Short: "Cut a device off or block a domain",
+	Long: `Cut devices off the network or block domains in one step.
+
+Devices may be given by MAC, IP or the hostname shown by 'devices'; they
+are added to the block list and the pf rules are reloaded at once. Anything
+else with a dot in it is taken as a domain and blocked, with its
+subdomains, by the embedded DNS forwarder, even if allowlisted. Blocking a
+domain enables DNS blocking, and a running 'dns serve' picks it up within
+seconds. Every entry is saved in the configuration.
+
+Example:
+  nat-manager block aa:bb:cc:dd:ee:ff
+  nat-manager block kids-ipad
+  nat-manager block 192.168.100.50 tiktok.com`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return quickBlock(args, true)
+	},
+}
+
+// allowCmd represents the allow command
+var allowCmd = &cobra.Command{
+	Use:   "allow <device|ip|domain>...",
+	Short: "Undo a block of a device or domain",
+	Long: `Let blocked devices back onto the network and unblock domains.
+
+Devices are given like for 'block' and removed from the block list. Domains
+are no longer blocked by hand and are added to the allowlist, so that they
+resolve even when a downloaded blocklist contains them.
+
+Example:
+  nat-manager allow kids-ipad
+  nat-manager allow tiktok.com`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return quickBlock(args, false)
+	},
+}
+
+// quickBlock blocks or allows devices and domains and applies the change
+func quickBlock(args []string, block bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	manager := nat.NewManager(cfg.ToNATConfig())
+	devices, domains, err := nat.BlockTargets(args, func() []nat.Device {
+		known, _ := manager.Devices()
+		return known
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg.UpdateBlocks(devices, domains, block)
+	if len(devices) > 0 {
+		if err := saveAndApplyRules(cfg); err != nil {
+			return err
+		}
+	} else if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	verb := "Allowed"
+	if block {
+		verb = "Blocked"
+	}
+	fmt.Fprintf(stdout, "✅ %s %s\n", verb, strings.Join(append(devices, domains...), ", "))
+	if len(domains) > 0 && !cfg.DNSForwarder.Enabled {
+		fmt.Fprintf(stdout, "⚠️  Domain blocking requires the embedded DNS forwarder (dns_forwarder.enabled)\n")
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(blockCmd)
+	rootCmd.AddCommand(allowCmd)
+}
@@ -0,0 +1,354 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// blocklistReloadInterval is how often a running forwarder picks up
+// blocklist changes saved by other commands
+const blocklistReloadInterval = 10 * time.Second
+
+var (
+	blocklistRemove bool
+	blocklistClient string
+)
+
+// dnsBlocklistCmd represents the dns blocklist command
+var dnsBlocklistCmd = &cobra.Command{
+	Use:   "blocklist",
+	Short: "Manage DNS blocklists for the internal network",
+	Long: `Manage Pi-hole-style DNS blocklists applied by the embedded DNS forwarder.
+
+Blocklists are hosts-format files ("0.0.0.0 ads.example.com") fetched from
+URLs and refreshed on a schedule while 'nat-manager dns serve' runs. Blocked
+names (and their subdomains) resolve to 0.0.0.0. Allowlisted domains are
+never blocked and bypass devices are never filtered.
+
+Without a subcommand, shows the blocklist configuration.
+
+Example:
+  nat-manager dns blocklist add https://raw.githubusercontent.com/StevenBlack/hosts/master/hosts
+  nat-manager dns blocklist allow example.com
+  nat-manager dns blocklist bypass aa:bb:cc:dd:ee:ff
+  nat-manager dns blocklist update
+  nat-manager dns blocklist enable`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		bl := cfg.DNSBlocklist
+		fmt.Fprintf(stdout, "Blocklist: %s\n", formatBool(bl.Enabled))
+		fmt.Fprintf(stdout, "Refresh Interval: %s\n", bl.GetRefreshInterval())
+		printList("Lists", bl.URLs)
+		printList("Allowlist", bl.Allowlist)
+		printList("Blocked By Hand", bl.Domains)
+		printList("Bypass Devices", bl.Bypass)
+
+		if domains, err := loadSavedBlocklist(); err == nil {
+			fmt.Fprintf(stdout, "\nBlocked domains: %d\n", len(domains))
+		} else {
+			fmt.Fprintf(stdout, "\nBlocked domains: not downloaded yet (run 'nat-manager dns blocklist update')\n")
+		}
+
+		if bl.Enabled && !cfg.DNSForwarder.Enabled {
+			fmt.Fprintf(stdout, "\n⚠️  Blocking requires the embedded DNS forwarder (dns_forwarder.enabled)\n")
+		}
+		return nil
+	},
+}
+
+var dnsBlocklistEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Enable DNS blocking",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return updateBlocklistConfig(func(bl *config.DNSBlocklistConfig) { bl.Enabled = true })
+	},
+}
+
+var dnsBlocklistDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Disable DNS blocking",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return updateBlocklistConfig(func(bl *config.DNSBlocklistConfig) { bl.Enabled = false })
+	},
+}
+
+var dnsBlocklistAddCmd = &cobra.Command{
+	Use:   "add <url>...",
+	Short: "Add hosts-format blocklist URLs",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateBlocklistConfig(func(bl *config.DNSBlocklistConfig) {
+			bl.URLs = config.AddItems(bl.URLs, args)
+		})
+	},
+}
+
+var dnsBlocklistRemoveCmd = &cobra.Command{
+	Use:   "remove <url>...",
+	Short: "Remove blocklist URLs",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateBlocklistConfig(func(bl *config.DNSBlocklistConfig) {
+			bl.URLs = config.RemoveItems(bl.URLs, args)
+		})
+	},
+}
+
+var dnsBlocklistAllowCmd = &cobra.Command{
+	Use:   "allow <domain>...",
+	Short: "Never block these domains (use --remove to undo)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateBlocklistConfig(func(bl *config.DNSBlocklistConfig) {
+			if blocklistRemove {
+				bl.Allowlist = config.RemoveItems(bl.Allowlist, args)
+			} else {
+				bl.Allowlist = config.AddItems(bl.Allowlist, args)
+			}
+		})
+	},
+}
+
+var dnsBlocklistBypassCmd = &cobra.Command{
+	Use:   "bypass <ip-or-mac>...",
+	Short: "Exempt devices from DNS blocking (use --remove to undo)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		for _, device := range args {
+			if net.ParseIP(device) == nil {
+				if _, err := net.ParseMAC(device); err != nil {
+					return fmt.Errorf("invalid device %q: expected an IP or MAC address", device)
+				}
+			}
+		}
+		return updateBlocklistConfig(func(bl *config.DNSBlocklistConfig) {
+			if blocklistRemove {
+				bl.Bypass = config.RemoveItems(bl.Bypass, args)
+			} else {
+				bl.Bypass = config.AddItems(bl.Bypass, args)
+			}
+		})
+	},
+}
+
+var dnsBlocklistUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Download the configured blocklists now",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if len(cfg.DNSBlocklist.URLs) == 0 {
+			return fmt.Errorf("no blocklists configured (use 'nat-manager dns blocklist add <url>')")
+		}
+
+		count, err := refreshBlocklist(context.Background(), cfg, nil)
+		if count == 0 && err != nil {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(stdout, "⚠️  %v\n", err)
+		}
+		fmt.Fprintf(stdout, "✅ Blocklist updated: %d domains\n", count)
+		return nil
+	},
+}
+
+var dnsBlocklistCheckCmd = &cobra.Command{
+	Use:   "check <domain>",
+	Short: "Check whether a domain is blocked",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		blocklist := newBlocklist(cfg, nat.NewManager(cfg.ToNATConfig()))
+		if blocklist.Blocked(blocklistClient, args[0]) {
+			fmt.Fprintf(stdout, "🚫 %s is blocked\n", args[0])
+		} else {
+			fmt.Fprintf(stdout, "✅ %s is allowed\n", args[0])
+		}
+		return nil
+	},
+}
+
+// newBlocklist builds the blocklist from the saved domains and configuration,
+// resolving bypass MAC addresses to their leased IPs
+func newBlocklist(cfg *config.Config, manager *nat.Manager) *dns.Blocklist {
+	domains, _ := loadSavedBlocklist()
+	blocklist := dns.NewBlocklist(domains, cfg.DNSBlocklist.Allowlist, resolveBypass(cfg.DNSBlocklist.Bypass, manager))
+	blocklist.SetCustom(cfg.DNSBlocklist.Domains)
+	return blocklist
+}
+
+// refreshBlocklist downloads the configured lists, saves them and swaps them
+// into blocklist if given. It returns the number of blocked domains.
+func refreshBlocklist(ctx context.Context, cfg *config.Config, blocklist *dns.Blocklist) (int, error) {
+	domains, fetchErr := dns.FetchBlocklists(ctx, cfg.DNSBlocklist.URLs)
+	if len(domains) == 0 {
+		return 0, fetchErr
+	}
+
+	path, err := config.GetBlocklistPath()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get blocklist path: %w", err)
+	}
+	if err := dns.SaveDomains(path, domains); err != nil {
+		return 0, err
+	}
+	if blocklist != nil {
+		blocklist.Replace(domains)
+	}
+	return len(domains), fetchErr
+}
+
+// resolveBypass maps bypass entries to client IPs; MACs are looked up in the DHCP leases
+func resolveBypass(devices []string, manager *nat.Manager) []string {
+	var ips []string
+	var leases []nat.Lease
+	for _, device := range devices {
+		if net.ParseIP(device) != nil {
+			ips = append(ips, device)
+			continue
+		}
+		if leases == nil {
+			leases, _ = manager.GetLeases()
+		}
+		for _, lease := range leases {
+			if strings.EqualFold(lease.MAC, device) {
+				ips = append(ips, lease.IP)
+			}
+		}
+	}
+	return ips
+}
+
+func loadSavedBlocklist() ([]string, error) {
+	path, err := config.GetBlocklistPath()
+	if err != nil {
+		return nil, err
+	}
+	return dns.LoadDomains(path)
+}
+
+// blocklistPathExists reports whether blocklists have been downloaded
+func blocklistPathExists() bool {
+	path, err := config.GetBlocklistPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+func updateBlocklistConfig(update func(*config.DNSBlocklistConfig)) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	update(&cfg.DNSBlocklist)
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "✅ Blocklist configuration updated\n")
+	return nil
+}
+
+func printList(title string, items []string) {
+	if len(items) == 0 {
+		fmt.Fprintf(stdout, "%s: none\n", title)
+		return
+	}
+	fmt.Fprintf(stdout, "%s:\n", title)
+	for _, item := range items {
+		fmt.Fprintf(stdout, "   %s\n", item)
+	}
+}
+
+// maintainBlocklist refreshes the blocklist on schedule, picks up changes
+// to the allowlist, bypass devices and domains blocked by hand, and
+// re-resolves bypass devices as DHCP leases change, until ctx is cancelled
+func maintainBlocklist(ctx context.Context, cfg *config.Config, manager *nat.Manager, blocklist *dns.Blocklist) {
+	refresh := func() {
+		if len(cfg.DNSBlocklist.URLs) == 0 {
+			return
+		}
+		count, err := refreshBlocklist(ctx, cfg, blocklist)
+		if err != nil {
+			logging.Component(logging.DNS).Warn("blocklist refresh failed", "error", err)
+		}
+		if count > 0 {
+			logging.Component(logging.DNS).Info("blocklist refreshed", "domains", count)
+		}
+	}
+
+	if !blocklistPathExists() {
+		refresh()
+	}
+
+	refreshTicker := time.NewTicker(cfg.DNSBlocklist.GetRefreshInterval())
+	defer refreshTicker.Stop()
+	reloadTicker := time.NewTicker(blocklistReloadInterval)
+	defer reloadTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-refreshTicker.C:
+			refresh()
+		case <-reloadTicker.C:
+			reloadBlocklist(cfg, manager, blocklist)
+		}
+	}
+}
+
+// reloadBlocklist applies the blocklist settings saved since the last
+// reload, such as by 'block' and 'allow'
+func reloadBlocklist(cfg *config.Config, manager *nat.Manager, blocklist *dns.Blocklist) {
+	if latest, err := config.Load(); err == nil {
+		cfg.DNSBlocklist = latest.DNSBlocklist
+	}
+	blocklist.SetAllowlist(cfg.DNSBlocklist.Allowlist)
+	blocklist.SetCustom(cfg.DNSBlocklist.Domains)
+	blocklist.SetBypass(resolveBypass(cfg.DNSBlocklist.Bypass, manager))
+}
+
+func init() {
+	dnsCmd.AddCommand(dnsBlocklistCmd)
+	dnsBlocklistCmd.AddCommand(dnsBlocklistEnableCmd)
+	dnsBlocklistCmd.AddCommand(dnsBlocklistDisableCmd)
+	dnsBlocklistCmd.AddCommand(dnsBlocklistAddCmd)
+	dnsBlocklistCmd.AddCommand(dnsBlocklistRemoveCmd)
+	dnsBlocklistCmd.AddCommand(dnsBlocklistAllowCmd)
+	dnsBlocklistCmd.AddCommand(dnsBlocklistBypassCmd)
+	dnsBlocklistCmd.AddCommand(dnsBlocklistUpdateCmd)
+	dnsBlocklistCmd.AddCommand(dnsBlocklistCheckCmd)
+
+	dnsBlocklistAllowCmd.Flags().BoolVar(&blocklistRemove, "remove", false, "remove the domains from the allowlist")
+	dnsBlocklistBypassCmd.Flags().BoolVar(&blocklistRemove, "remove", false, "remove the devices from the bypass list")
+	dnsBlocklistCheckCmd.Flags().StringVar(&blocklistClient, "client", "", "check as seen by this client IP")
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var cleanupDryRun bool
+
+// cleanupCmd represents the cleanup command
+var cleanupCmd = &cobra.Command{
+	Use:   "cleanup",
+	Short: "Remove leftovers of crashed runs",
+	Long: `Find and remove what crashed runs of any instance left behind:
+
+- DHCP and DNS servers still running for an instance that is stopped
+- pidfiles of processes that are gone and files of interrupted writes
+- pf anchors holding rules of instances that are not registered
+- bridges an instance created that still carry its gateway address
+- registry entries of instances that no longer run
+
+Running instances are left alone, as are bridges with members, such as
+those of Internet Sharing or virtual machines. From a terminal the
+leftovers are listed and removed after confirmation, unless --yes is given.
+
+Example:
+  nat-manager cleanup --dry-run
+  nat-manager cleanup`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		stateFile, err := config.GetStateFilePath()
+		if err != nil {
+			return fmt.Errorf("failed to get state file path: %w", err)
+		}
+		instances, err := instanceConfigs()
+		if err != nil {
+			return err
+		}
+		orphans, err := nat.FindOrphans(stateFile, instances)
+		if err != nil {
+			return fmt.Errorf("failed to look for leftovers: %w", err)
+		}
+
+		if len(orphans) == 0 {
+			fmt.Fprintf(stdout, "✅ Nothing to clean up\n")
+			return nil
+		}
+		if cleanupDryRun || isTerminal(os.Stdin) && !assumeYes {
+			fmt.Fprintf(stdout, "Would remove %d leftovers:\n", len(orphans))
+			for _, orphan := range orphans {
+				printOrphan("•", orphan)
+			}
+		}
+		if cleanupDryRun {
+			return nil
+		}
+		if err := confirmDestructive(fmt.Sprintf("Remove %d leftovers?", len(orphans))); err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, orphan := range orphans {
+			if err := orphan.Remove(); err != nil {
+				failed++
+				printOrphan("❌", orphan)
+				fmt.Fprintf(stdout, "     %v\n", err)
+				continue
+			}
+			printOrphan("✅", orphan)
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d leftovers could not be removed", failed, len(orphans))
+		}
+		return nil
+	},
+}
+
+func printOrphan(mark string, orphan nat.Orphan) {
+	instance := orphan.Instance
+	if instance == "" {
+		instance = "-"
+	}
+	fmt.Fprintf(stdout, "  %s %-9s %-10s %s (%s)\n", mark, orphan.Kind, instance, orphan.Name, orphan.Reason)
+}
+
+// instanceConfigs returns the NAT configuration of every instance, the
+// defaults for instances without a configuration file
+func instanceConfigs() ([]*nat.Config, error) {
+	names, err := config.Instances()
+	if err != nil {
+		return nil, err
+	}
+	selected, profile := config.Instance(), config.Profile()
+	defer func() {
+		_ = config.SetInstance(selected)
+		_ = config.SetProfile(profile)
+	}()
+	_ = config.SetProfile("")
+
+	configs := make([]*nat.Config, 0, len(names))
+	for _, name := range names {
+		if err := config.SetInstance(name); err != nil {
+			return nil, err
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			cfg = config.Default()
+		}
+		configs = append(configs, cfg.ToNATConfig())
+	}
+	return configs, nil
+}
+
+func init() {
+	rootCmd.AddCommand(cleanupCmd)
+
+	cleanupCmd.Flags().BoolVar(&cleanupDryRun, "dry-run", false, "list what would be removed without removing it")
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// completing reports whether the shell asked for completions, which work
+// without root so tab completion needs no sudo
+func completing() bool {
+	return len(os.Args) > 1 &&
+		(os.Args[1] == cobra.ShellCompRequestCmd || os.Args[1] == cobra.ShellCompNoDescRequestCmd)
+}
+
+// completionManager returns a manager for the instance's configuration
+func completionManager() *nat.Manager {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.Default()
+	}
+	return nat.NewManager(cfg.ToNATConfig())
+}
+
+// completeInterfaces completes interface names, described by their type and
+// address
+func completeInterfaces(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	interfaces, err := nat.NewManager(nil).GetNetworkInterfaces()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for _, iface := range interfaces {
+		if !strings.HasPrefix(iface.Name, toComplete) {
+			continue
+		}
+		description := iface.Type
+		if iface.IP != "" {
+			description += " " + iface.IP
+		}
+		completions = append(completions, iface.Name+"\t"+description)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeLeaseIPs completes the addresses of devices holding a DHCP lease,
+// described by their hostname
+func completeLeaseIPs(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	leases, err := completionManager().GetLeases()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for _, lease := range leases {
+		if strings.HasPrefix(lease.IP, toComplete) {
+			completions = append(completions, lease.IP+"\t"+orDash(lease.Hostname))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeStateSources completes the internal addresses with active pf
+// states
+func completeStateSources(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for _, source := range completionManager().StateSources() {
+		if strings.HasPrefix(source, toComplete) {
+			completions = append(completions, source)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProfiles completes profile names
+func completeProfiles(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	names, err := config.ListProfiles()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []string
+	for _, name := range names {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,234 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Read and change configuration settings",
+	Long: `Read and change individual settings of the instance's config.yaml.
+
+Keys are the YAML keys joined with dots, and list elements are addressed by
+their index. Values are parsed as YAML, so lists can be given as [a, b].
+Changes are validated before they are saved: unknown keys, values of the
+wrong type and values that make the configuration invalid are rejected.
+
+Example:
+  nat-manager config list
+  nat-manager config get dhcp_range.start
+  nat-manager config set dhcp_range.start 192.168.100.50
+  nat-manager config set dns_servers "[1.1.1.1, 9.9.9.9]"
+  nat-manager config unset backends.dhcp
+  nat-manager config edit`,
+}
+
+// configGetCmd represents the config get command
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "Print the value of a setting",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		value, err := cfg.Get(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, value)
+		return nil
+	},
+}
+
+// configSetCmd represents the config set command
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Change a setting",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateConfig(func(cfg *config.Config) error {
+			return cfg.Set(args[0], args[1])
+		}, fmt.Sprintf("%s set to %s", args[0], args[1]))
+	},
+}
+
+// configUnsetCmd represents the config unset command
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <key>",
+	Short: "Restore the default of a setting or remove a list element",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateConfig(func(cfg *config.Config) error {
+			return cfg.Unset(args[0])
+		}, args[0]+" unset")
+	},
+}
+
+// configListCmd represents the config list command
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all settings",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		settings, err := cfg.List()
+		if err != nil {
+			return err
+		}
+		for _, setting := range settings {
+			fmt.Fprintf(stdout, "%s = %s\n", setting.Key, setting.Value)
+		}
+		return nil
+	},
+}
+
+// configEditCmd represents the config edit command
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit the configuration in $EDITOR",
+	Long: `Open the instance's config.yaml in $VISUAL or $EDITOR (vi by
+default). The edited file is validated before it replaces the configuration
+and can be edited again if it is invalid.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		path, err := config.GetConfigPath()
+		if err != nil {
+			return fmt.Errorf("failed to get config path: %w", err)
+		}
+		original, err := configFileContent(path)
+		if err != nil {
+			return err
+		}
+
+		tmp, err := os.CreateTemp("", "nat-manager-config-*.yaml")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary file: %w", err)
+		}
+		defer func() { _ = os.Remove(tmp.Name()) }()
+		_ = tmp.Close()
+		if err := os.WriteFile(tmp.Name(), original, 0600); err != nil {
+			return fmt.Errorf("failed to write temporary file: %w", err)
+		}
+
+		data, err := editUntilValid(tmp.Name())
+		if err != nil || data == nil {
+			return err
+		}
+		if string(data) == string(original) {
+			fmt.Fprintf(stdout, "No changes made\n")
+			return nil
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write config file: %w", err)
+		}
+		fmt.Fprintf(stdout, "✅ Configuration saved to %s\n", path)
+		return nil
+	},
+}
+
+// updateConfig applies a change to the configuration and saves it
+func updateConfig(change func(cfg *config.Config) error, done string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := change(cfg); err != nil {
+		return fmt.Errorf("no changes made: %w", err)
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Fprintf(stdout, "✅ %s\n", done)
+	if nat.NewManager(cfg.ToNATConfig()).IsActive() {
+		fmt.Fprintf(stdout, "   Restart NAT to apply the change\n")
+	}
+	return nil
+}
+
+// configFileContent returns the configuration file, or the defaults when
+// there is none yet
+func configFileContent(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return yaml.Marshal(config.Default())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return data, nil
+}
+
+// editUntilValid opens path in the editor until it holds a valid
+// configuration and returns its content, or nil if editing was abandoned
+func editUntilValid(path string) ([]byte, error) {
+	stdin := bufio.NewReader(os.Stdin)
+	for {
+		if err := runEditor(path); err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read edited config: %w", err)
+		}
+
+		cfg, err := config.Parse(data)
+		if err == nil {
+			err = cfg.ValidateSettings()
+		}
+		if err == nil {
+			return data, nil
+		}
+
+		fmt.Fprintf(stdout, "❌ %v\n", err)
+		fmt.Fprintf(stdout, "Edit again? [Y/n] ")
+		answer, err := stdin.ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); err != nil || answer == "n" || answer == "no" {
+			fmt.Fprintf(stdout, "No changes made\n")
+			return nil, nil
+		}
+	}
+}
+
+// runEditor opens path in $VISUAL or $EDITOR, which may include arguments
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor %s failed: %w", editor, err)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configGetCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configListCmd)
+	configCmd.AddCommand(configEditCmd)
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// assumeYes answers every confirmation prompt with yes, for automation
+var assumeYes bool
+
+// errAborted is returned when a confirmation prompt is declined
+var errAborted = errors.New("aborted")
+
+// confirmDestructive asks before a destructive operation when stdin is a
+// terminal. Without a terminal, or with --yes, it goes ahead.
+func confirmDestructive(prompt string) error {
+	return confirmOn(os.Stdin, isTerminal(os.Stdin), prompt)
+}
+
+// confirmOn asks prompt on in if it is a terminal and --yes is not set
+func confirmOn(in io.Reader, terminal bool, prompt string) error {
+	if assumeYes || !terminal {
+		return nil
+	}
+	if !confirm(in, prompt+" [y/N] ") {
+		return errAborted
+	}
+	return nil
+}
+
+// confirm asks a yes/no question, defaulting to no. The prompt goes to
+// stderr so that it shows with --quiet.
+func confirm(in io.Reader, prompt string) bool {
+	fmt.Fprint(os.Stderr, prompt)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
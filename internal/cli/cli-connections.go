@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// connectionsCmd represents the connections command
+var connectionsCmd = &cobra.Command{
+	Use:     "connections",
+	Aliases: []string{"conns"},
+	Short:   "List active connections",
+	Long: `List the active network connections with their protocol, source,
+destination and state.
+
+Example:
+  nat-manager connections
+  nat-manager connections -o json
+  nat-manager connections kill 192.168.100.50`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{helperAnnotation: helperRequired},
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		connections, err := listConnections(nat.NewManager(cfg.ToNATConfig()))
+		if err != nil {
+			return fmt.Errorf("failed to list connections: %w", err)
+		}
+
+		if outputFormat != outputTable {
+			return writeOutput(os.Stdout, outputFormat, connections)
+		}
+		if len(connections) == 0 {
+			fmt.Fprintf(stdout, "No active connections\n")
+			return nil
+		}
+		fmt.Fprintf(stdout, "%-6s %-30s %-30s %s\n", "PROTO", "SOURCE", "DESTINATION", "STATE")
+		for _, conn := range connections {
+			fmt.Fprintf(stdout, "%-6s %-30s %-30s %s\n", conn.Protocol,
+				truncate(conn.Source, 30), truncate(conn.Destination, 30), conn.State)
+		}
+		return nil
+	},
+}
+
+// listConnections returns the connections from the helper when running
+// through it, or from manager
+func listConnections(manager *nat.Manager) ([]nat.Connection, error) {
+	if helperClient != nil {
+		return helperClient.Connections()
+	}
+	return manager.GetActiveConnections()
+}
+
+// connectionsKillCmd represents the connections kill command
+var connectionsKillCmd = &cobra.Command{
+	Use:   "kill <ip>",
+	Short: "Drop the connections of a device",
+	Long: `Drop the pf states of a device's connections. Its open connections
+stop working and have to be reestablished. From a terminal, asks for
+confirmation unless --yes is given.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeStateSources,
+	Annotations:       map[string]string{helperAnnotation: helperRequired},
+	RunE: func(_ *cobra.Command, args []string) error {
+		if err := confirmDestructive(fmt.Sprintf("Drop all connections of %s?", args[0])); err != nil {
+			return err
+		}
+		killed, err := killConnections(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Dropped %d connection states of %s\n", killed, args[0])
+		return nil
+	},
+}
+
+// killConnections drops the connections of ip through the helper when
+// running through it, or itself
+func killConnections(ip string) (int, error) {
+	if helperClient != nil {
+		return helperClient.KillConnections(ip)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load config: %w", err)
+	}
+	return nat.NewManager(cfg.ToNATConfig()).KillStates(ip)
+}
+
+func init() {
+	rootCmd.AddCommand(connectionsCmd)
+	connectionsCmd.AddCommand(connectionsKillCmd)
+}
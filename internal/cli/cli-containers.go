@@ -0,0 +1,294 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/vmnet"
+)
+
+// containerVMInterval is how often attached VMs are moved back into the
+// internal bridge, which they leave when restarted
+const containerVMInterval = 30 * time.Second
+
+// containerVM is a Lima or Colima VM with where its network is attached
+type containerVM struct {
+	vmnet.Instance
+	Bridge   string `json:"bridge,omitempty"`
+	Member   string `json:"member,omitempty"`
+	Attached bool   `json:"attached"` // kept in the internal bridge
+}
+
+// containersCmd represents the containers command
+var containersCmd = &cobra.Command{
+	Use:     "containers",
+	Aliases: []string{"vms"},
+	Short:   "Bridge Lima and Colima VMs into the internal network",
+	Long: `Attach the VMs that Lima and Colima run containers in to the internal
+network, so containers reach the outside through the managed NAT and get
+their address from its DHCP server, and show among the devices.
+
+A VM needs a vmnet network to be attached, e.g. one started with
+'colima start --network-address' or a Lima VM with 'networks: [{vzNAT:
+true}]' or a socket_vmnet network. Its interface is moved from the vmnet
+bridge into the internal bridge and the guest asks for a new lease.
+'start --foreground' and the daemon move it back whenever the VM restarts.
+
+Docker Desktop runs its VM without a host interface and cannot be
+attached; run Docker in Colima instead.
+
+Example:
+  nat-manager containers list
+  nat-manager containers attach colima
+  nat-manager devices
+  nat-manager containers detach colima`,
+}
+
+// containersListCmd represents the containers list command
+var containersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List Lima and Colima VMs and their networks",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		instances, err := vmnet.Instances()
+		if err != nil {
+			return err
+		}
+		vms := make([]containerVM, 0, len(instances))
+		for _, instance := range instances {
+			vm := containerVM{Instance: instance}
+			vm.Attached = slices.ContainsFunc(cfg.ContainerVMs, func(c config.ContainerVMConfig) bool {
+				return c.Name == instance.Name && c.Runtime == instance.Runtime
+			})
+			if len(instance.Networks) > 0 {
+				if loc, err := vmnet.Locate(instance.Networks[0].MAC); err == nil {
+					vm.Bridge, vm.Member = loc.Bridge, loc.Member
+				}
+			}
+			vms = append(vms, vm)
+		}
+		if outputFormat != outputTable {
+			return writeOutput(os.Stdout, outputFormat, vms)
+		}
+
+		if len(vms) == 0 {
+			fmt.Fprintf(stdout, "No Lima or Colima VMs found\n")
+			return nil
+		}
+		fmt.Fprintf(stdout, "%-20s %-8s %-9s %-18s %-10s %s\n", "NAME", "RUNTIME", "STATUS", "MAC", "BRIDGE", "ATTACHED")
+		for _, vm := range vms {
+			mac := "-"
+			if len(vm.Networks) > 0 {
+				mac = vm.Networks[0].MAC
+			}
+			bridge := vm.Bridge
+			if bridge == "" {
+				bridge = "-"
+			}
+			attached := "no"
+			if vm.Attached {
+				attached = "yes"
+			}
+			fmt.Fprintf(stdout, "%-20s %-8s %-9s %-18s %-10s %s\n", truncate(vm.Name, 20), vm.Runtime, vm.Status, mac, bridge, attached)
+		}
+		return nil
+	},
+}
+
+// containersAttachCmd represents the containers attach command
+var containersAttachCmd = &cobra.Command{
+	Use:   "attach <name>",
+	Short: "Move a VM's network into the internal bridge",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if !strings.HasPrefix(cfg.InternalInterface, "bridge") {
+			return exitWith(ExitUsage, fmt.Errorf("VMs can only join a bridge, not %s (set internal_interface to e.g. bridge100)", cfg.InternalInterface))
+		}
+		instance, err := vmnet.FindInstance(args[0])
+		if err != nil {
+			return exitWith(ExitUsage, err)
+		}
+		if len(instance.Networks) == 0 {
+			return exitWith(ExitUsage, fmt.Errorf("%s has no vmnet network (e.g. 'colima start --network-address')", instance.Name))
+		}
+		if instance.Status != "Running" {
+			return exitWith(ExitUsage, fmt.Errorf("%s is %s, start it first", instance.Name, strings.ToLower(instance.Status)))
+		}
+
+		vm := config.ContainerVMConfig{
+			Name:      instance.Name,
+			Runtime:   instance.Runtime,
+			MAC:       instance.Networks[0].MAC,
+			Interface: instance.Networks[0].Interface,
+		}
+		cfg, err = updateContainerVMs(func(vms []config.ContainerVMConfig) ([]config.ContainerVMConfig, error) {
+			vms = slices.DeleteFunc(vms, func(c config.ContainerVMConfig) bool {
+				return c.Name == vm.Name && c.Runtime == vm.Runtime
+			})
+			return append(vms, vm), nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := attachContainerVM(cfg, vm); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ %s attached to %s\n", vm.Name, cfg.InternalInterface)
+
+		manager := nat.NewManager(cfg.ToNATConfig())
+		fmt.Fprintf(stdout, "⏳ Waiting for a lease...\n")
+		for deadline := time.Now().Add(15 * time.Second); time.Now().Before(deadline); time.Sleep(time.Second) {
+			if ip := containerVMLease(manager, vm.MAC); ip != "" {
+				fmt.Fprintf(stdout, "🖥️  %s has %s\n", vm.Name, ip)
+				return nil
+			}
+		}
+		fmt.Fprintf(stdout, "⚠️  No lease for %s yet (is NAT running? see 'nat-manager devices')\n", vm.Name)
+		return nil
+	},
+}
+
+// containersDetachCmd represents the containers detach command
+var containersDetachCmd = &cobra.Command{
+	Use:   "detach <name>",
+	Short: "Stop keeping a VM in the internal bridge",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		var vm config.ContainerVMConfig
+		cfg, err := updateContainerVMs(func(vms []config.ContainerVMConfig) ([]config.ContainerVMConfig, error) {
+			i := slices.IndexFunc(vms, func(c config.ContainerVMConfig) bool { return c.Name == args[0] })
+			if i < 0 {
+				return nil, fmt.Errorf("%s is not attached", args[0])
+			}
+			vm = vms[i]
+			return slices.Delete(slices.Clone(vms), i, i+1), nil
+		})
+		if err != nil {
+			return err
+		}
+		if loc, err := vmnet.Locate(vm.MAC); err == nil && loc.Bridge == cfg.InternalInterface {
+			if err := vmnet.Remove(loc.Bridge, loc.Member); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(stdout, "✅ %s detached\n", vm.Name)
+		fmt.Fprintf(stdout, "💡 Restart the VM to get its own network back, e.g. '%s restart %s'\n", restartCommand(vm.Runtime), vm.Name)
+		return nil
+	},
+}
+
+// restartCommand returns the command restarting a VM of runtime
+func restartCommand(runtime string) string {
+	if runtime == vmnet.RuntimeColima {
+		return "colima"
+	}
+	return "limactl"
+}
+
+// updateContainerVMs validates and saves the VMs update returns
+func updateContainerVMs(update func([]config.ContainerVMConfig) ([]config.ContainerVMConfig, error)) (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.ContainerVMs, err = update(cfg.ContainerVMs); err != nil {
+		return nil, err
+	}
+	if err := config.ValidateContainerVMs(cfg.ContainerVMs); err != nil {
+		return nil, exitWith(ExitUsage, err)
+	}
+	if err := cfg.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save config: %w", err)
+	}
+	return cfg, nil
+}
+
+// attachContainerVM moves the interface of vm into the internal bridge and
+// renews its lease, unless it is there already
+func attachContainerVM(cfg *config.Config, vm config.ContainerVMConfig) error {
+	loc, err := vmnet.Locate(vm.MAC)
+	if err != nil {
+		return err
+	}
+	if loc.Bridge == cfg.InternalInterface {
+		return nil
+	}
+	if err := vmnet.Move(loc, cfg.InternalInterface); err != nil {
+		return err
+	}
+	if vm.Interface == "" {
+		return nil
+	}
+	return vmnet.Renew(vm.Runtime, vm.Name, vm.Interface)
+}
+
+// containerVMLease returns the address leased to mac, if any
+func containerVMLease(manager *nat.Manager, mac string) string {
+	leases, err := manager.GetLeases()
+	if err != nil {
+		return ""
+	}
+	for _, lease := range leases {
+		if leased, ok := vmnet.NormalizeMAC(lease.MAC); ok && leased == mac {
+			return lease.IP
+		}
+	}
+	return ""
+}
+
+// startContainerVMs keeps the attached VMs of cfg in the internal bridge in
+// the background until ctx is done, moving them back after they restart
+func startContainerVMs(ctx context.Context, cfg *config.Config) {
+	if len(cfg.ContainerVMs) == 0 || !strings.HasPrefix(cfg.InternalInterface, "bridge") {
+		return
+	}
+	attach := func() {
+		for _, vm := range cfg.ContainerVMs {
+			// a stopped VM is not on any bridge, which is no error
+			if _, err := vmnet.Locate(vm.MAC); err != nil {
+				continue
+			}
+			if err := attachContainerVM(cfg, vm); err != nil {
+				logging.Component(logging.NAT).Warn("failed to attach container VM", "vm", vm.Name, "error", err)
+			}
+		}
+	}
+	attach()
+	go func() {
+		ticker := time.NewTicker(containerVMInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				attach()
+			}
+		}
+	}()
+	fmt.Fprintf(stdout, "🖥️  Keeping %d container VMs in %s\n", len(cfg.ContainerVMs), cfg.InternalInterface)
+}
+
+func init() {
+	rootCmd.AddCommand(containersCmd)
+	containersCmd.AddCommand(containersListCmd)
+	containersCmd.AddCommand(containersAttachCmd)
+	containersCmd.AddCommand(containersDetachCmd)
+}
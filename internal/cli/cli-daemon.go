@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/launchd"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// daemonRetry is how long the daemon waits before trying to start NAT
+// again, e.g. while the uplink is not up yet at boot
+const daemonRetry = 15 * time.Second
+
+// DaemonStatus is the state of the instance's LaunchDaemon
+type DaemonStatus struct {
+	Instance  string `json:"instance"`
+	Installed bool   `json:"installed"`
+	Plist     string `json:"plist,omitempty"`
+	PID       int    `json:"pid,omitempty"`
+	NATActive bool   `json:"nat_active"`
+	Log       string `json:"log"`
+}
+
+// daemonCmd represents the daemon command
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep NAT running with a LaunchDaemon",
+	Long: `Install a LaunchDaemon that starts NAT at boot with the saved
+configuration (or --profile) and supervises it like 'start --foreground':
+rules are re-applied when the uplink changes, the DHCP server is restarted
+when it dies and the whole configuration is re-applied after the Mac wakes
+from sleep. launchd restarts the daemon if it crashes, and the new daemon
+adopts the NAT still in place.
+
+Example:
+  sudo nat-manager daemon install
+  sudo nat-manager --profile lab daemon install
+  nat-manager daemon status
+  sudo nat-manager daemon uninstall`,
+}
+
+// daemonInstallCmd represents the daemon install command
+var daemonInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install and start the LaunchDaemon",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if cfg.ExternalInterface == "" || cfg.InternalInterface == "" {
+			return fmt.Errorf("no saved configuration, run 'start' once or use --profile")
+		}
+
+		job, err := daemonJob()
+		if err != nil {
+			return err
+		}
+		path, err := launchd.Install(job)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ NAT daemon installed (%s)\n", path)
+		fmt.Fprintf(stdout, "   External: %s, Internal: %s\n", cfg.ExternalInterface, cfg.InternalInterface)
+		fmt.Fprintf(stdout, "   Log: %s\n", job.LogPath)
+		return nil
+	},
+}
+
+// daemonUninstallCmd represents the daemon uninstall command
+var daemonUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop the daemon and remove its LaunchDaemon",
+	Long: `Unload the LaunchDaemon, which stops the daemon and with it NAT, and
+remove its plist.`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if !launchd.Installed(daemonLabel()) {
+			fmt.Fprintf(stdout, "NAT daemon is not installed\n")
+			return nil
+		}
+		if err := launchd.Uninstall(daemonLabel()); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ NAT daemon removed\n")
+		return nil
+	},
+}
+
+// daemonStatusCmd represents the daemon status command
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the daemon is installed and running",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		status, err := daemonStatus()
+		if err != nil {
+			return err
+		}
+		if outputFormat != outputTable {
+			return writeOutput(os.Stdout, outputFormat, status)
+		}
+
+		if !status.Installed {
+			fmt.Fprintf(stdout, "NAT daemon is not installed (run 'sudo nat-manager daemon install')\n")
+			return nil
+		}
+		running := "not running"
+		if status.PID > 0 {
+			running = fmt.Sprintf("running (PID %d)", status.PID)
+		}
+		state := "inactive"
+		if status.NATActive {
+			state = "active"
+		}
+		fmt.Fprintf(stdout, "Daemon:   %s\n", running)
+		fmt.Fprintf(stdout, "NAT:      %s\n", state)
+		fmt.Fprintf(stdout, "Plist:    %s\n", status.Plist)
+		fmt.Fprintf(stdout, "Log:      %s\n", status.Log)
+		return nil
+	},
+}
+
+// daemonRunCmd represents the daemon run command, which launchd runs
+var daemonRunCmd = &cobra.Command{
+	Use:    "run",
+	Short:  "Run the NAT daemon in the foreground (used by launchd)",
+	Hidden: true,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		logger := logging.Component(logging.NAT)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		manager := nat.NewManager(cfg.ToNATConfig())
+		if !daemonStart(ctx, manager, logger) {
+			return nil
+		}
+		startAPIServer(ctx, cfg)
+		startMQTT(ctx, cfg, manager)
+		startFlowExport(ctx, cfg, manager)
+		startInflux(ctx, cfg, natPoints(manager))
+		startSNMP(ctx, cfg, manager)
+		startDDNS(ctx, cfg, manager)
+		startContainerVMs(ctx, cfg)
+		startVMNetworks(ctx, cfg)
+		defer startWireGuard(cfg)()
+		manager.RunForeground(ctx, slog.Default())
+
+		logger.Info("stopping NAT")
+		if err := manager.StopNAT(); err != nil {
+			return fmt.Errorf("failed to stop NAT: %w", err)
+		}
+		logger.Info("NAT stopped")
+		return nil
+	},
+}
+
+// daemonStart adopts NAT left running by a previous daemon or starts it,
+// retrying until it starts or ctx is done, and reports whether NAT runs
+func daemonStart(ctx context.Context, manager *nat.Manager, logger *slog.Logger) bool {
+	cfg := manager.GetConfig()
+	if manager.RulesLoaded() {
+		logger.Info("adopting running NAT", "external", cfg.ExternalInterface, "internal", cfg.InternalInterface)
+		err := manager.Reapply()
+		if err == nil {
+			return true
+		}
+		logger.Error("failed to re-apply configuration, restarting NAT", "error", err)
+	}
+
+	for {
+		err := manager.StartNAT()
+		if err == nil {
+			logger.Info("NAT started", "external", cfg.ExternalInterface, "internal", cfg.InternalInterface)
+			return true
+		}
+		logger.Error("failed to start NAT, retrying", "error", err, "retry", daemonRetry)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(daemonRetry):
+		}
+	}
+}
+
+// daemonLabel returns the launchd label of the instance's daemon
+func daemonLabel() string {
+	return launchd.LabelPrefix + "daemon." + config.Instance()
+}
+
+// daemonLogPath returns the log file of the instance's daemon
+func daemonLogPath() (string, error) {
+	dir, err := config.BaseDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(dir, "daemon.log"), nil
+}
+
+// daemonJob returns the LaunchDaemon running the daemon at boot and again
+// whenever it exits
+func daemonJob() (launchd.Job, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return launchd.Job{}, fmt.Errorf("failed to locate nat-manager: %w", err)
+	}
+	logPath, err := daemonLogPath()
+	if err != nil {
+		return launchd.Job{}, err
+	}
+
+	program := []string{exe}
+	if instance := config.Instance(); instance != nat.DefaultInstance {
+		program = append(program, "--instance", instance)
+	}
+	if profile := config.Profile(); profile != "" {
+		program = append(program, "--profile", profile)
+	}
+	return launchd.Job{
+		Label:       daemonLabel(),
+		Program:     append(program, "daemon", "run"),
+		RunAtLoad:   true,
+		KeepAlive:   true,
+		Environment: map[string]string{"HOME": os.Getenv("HOME")},
+		LogPath:     logPath,
+	}, nil
+}
+
+// daemonStatus reports the instance's daemon
+func daemonStatus() (DaemonStatus, error) {
+	logPath, err := daemonLogPath()
+	if err != nil {
+		return DaemonStatus{}, err
+	}
+	status := DaemonStatus{Instance: config.Instance(), Log: logPath}
+	if !launchd.Installed(daemonLabel()) {
+		return status, nil
+	}
+	status.Installed = true
+	if status.Plist, err = launchd.PlistPath(daemonLabel()); err != nil {
+		return DaemonStatus{}, fmt.Errorf("failed to get launchd plist path: %w", err)
+	}
+	status.PID = launchd.PID(daemonLabel())
+
+	cfg, err := config.Load()
+	if err != nil {
+		return DaemonStatus{}, fmt.Errorf("failed to load config: %w", err)
+	}
+	status.NATActive = nat.NewManager(cfg.ToNATConfig()).RulesLoaded()
+	return status, nil
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.AddCommand(daemonInstallCmd)
+	daemonCmd.AddCommand(daemonUninstallCmd)
+	daemonCmd.AddCommand(daemonStatusCmd)
+	daemonCmd.AddCommand(daemonRunCmd)
+}
@@ -0,0 +1,304 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/ddns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var (
+	ddnsRecord config.DDNSRecord
+	ddnsDryRun bool
+)
+
+// ddnsCmd represents the ddns command
+var ddnsCmd = &cobra.Command{
+	Use:   "ddns",
+	Short: "Keep dynamic DNS records at the external address",
+	Long: `Manage dynamic DNS records that are kept pointing at the external address
+of the instance, so port-forwarded services stay reachable. Once
+ddns.enabled is set, 'start --foreground' and the daemon check the address
+every ddns.interval (5m) and right away when the uplink gets a new address,
+and update the records whose address changed.
+
+The address is the one a web service sees (ddns.ip_source web, asking
+ddns.ip_url, https://api.ipify.org by default), which works behind another
+router, or the address of the external interface (ddns.ip_source
+interface). An IPv4 address updates A records, an IPv6 address AAAA
+records.
+
+Providers:
+  cloudflare   --token with DNS edit permission; --zone is the zone name or
+               ID, the last two labels of the name by default
+  duckdns      --token; the name is the duckdns.org subdomain
+  route53      --zone hosted zone ID, --access-key and --secret-key of a
+               user allowed route53:ChangeResourceRecordSets
+  command      --command run by /bin/sh for any other provider, with
+               NAT_MANAGER_DDNS_NAME, NAT_MANAGER_DDNS_TYPE,
+               NAT_MANAGER_DDNS_IP and NAT_MANAGER_DDNS_TTL set
+
+Example:
+  nat-manager ddns add lab.example.com --provider cloudflare --token s3cret
+  nat-manager ddns add mylab --provider duckdns --token s3cret
+  nat-manager ddns add lab.example.org --provider command --command '/usr/local/bin/update-dns'
+  nat-manager ddns update --dry-run
+  nat-manager config set ddns.enabled true`,
+}
+
+// ddnsListCmd represents the ddns list command
+var ddnsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List dynamic DNS records",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if outputFormat != outputTable {
+			records := cfg.DDNS.Records
+			if records == nil {
+				records = []config.DDNSRecord{}
+			}
+			return writeOutput(os.Stdout, outputFormat, records)
+		}
+
+		if len(cfg.DDNS.Records) == 0 {
+			fmt.Fprintf(stdout, "No dynamic DNS records configured\n")
+			return nil
+		}
+		fmt.Fprintf(stdout, "%-40s %-11s %s\n", "NAME", "PROVIDER", "ZONE")
+		for _, r := range cfg.DDNS.Records {
+			fmt.Fprintf(stdout, "%-40s %-11s %s\n", truncate(r.Name, 40), r.Provider, r.Zone)
+		}
+		return nil
+	},
+}
+
+// ddnsAddCmd represents the ddns add command
+var ddnsAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Keep a name at the external address",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		record := ddnsRecord
+		record.Name = args[0]
+		err := updateDDNSRecords(func(records []config.DDNSRecord) ([]config.DDNSRecord, error) {
+			records = slices.DeleteFunc(records, func(r config.DDNSRecord) bool {
+				return r.Name == record.Name && r.Provider == record.Provider
+			})
+			return append(records, record), nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ %s added (%s)\n", record.Name, record.Provider)
+		return nil
+	},
+}
+
+// ddnsRemoveCmd represents the ddns remove command
+var ddnsRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Stop updating a name",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		err := updateDDNSRecords(func(records []config.DDNSRecord) ([]config.DDNSRecord, error) {
+			kept := slices.DeleteFunc(slices.Clone(records), func(r config.DDNSRecord) bool { return r.Name == args[0] })
+			if len(kept) == len(records) {
+				return nil, fmt.Errorf("no dynamic DNS record for %s", args[0])
+			}
+			return kept, nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ %s removed\n", args[0])
+		return nil
+	},
+}
+
+// ddnsUpdateCmd represents the ddns update command
+var ddnsUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update the records now",
+	Long: `Look up the external address and update every record once, e.g. to check
+the provider settings. With --dry-run the records are only reported.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, updater, err := newDDNSUpdater()
+		if err != nil {
+			return err
+		}
+		results, err := updater.Sync(context.Background())
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, result := range results {
+			switch {
+			case result.Err != nil:
+				fmt.Fprintf(stdout, "❌ %s: %v\n", result.Record.Name, result.Err)
+				failed++
+			case result.DryRun:
+				fmt.Fprintf(stdout, "🔍 %s (%s) would point at %s\n", result.Record.Name, result.Record.Provider, result.Addr)
+			default:
+				fmt.Fprintf(stdout, "✅ %s (%s) points at %s\n", result.Record.Name, result.Record.Provider, result.Addr)
+			}
+		}
+		if cfg.DDNS.IPSource != ddns.SourceInterface && len(results) > 0 && !results[0].Addr.IsGlobalUnicast() {
+			fmt.Fprintf(stdout, "⚠️  %s is not a public address\n", results[0].Addr)
+		}
+		if failed > 0 {
+			return exitWith(ExitError, nil)
+		}
+		return nil
+	},
+}
+
+// ddnsRunCmd represents the ddns run command
+var ddnsRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Keep updating until interrupted",
+	Long: `Keep the records at the external address until interrupted, for NAT that
+is not run by 'start --foreground' or the daemon, which update on their
+own.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, updater, err := newDDNSUpdater()
+		if err != nil {
+			return err
+		}
+		interval, err := cfg.DDNS.GetInterval()
+		if err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Fprintf(stdout, "🌐 Keeping %d dynamic DNS records up to date - press Ctrl+C to stop\n", len(cfg.DDNS.Records))
+		updater.Run(ctx, interval, logDDNSResult, logDDNSError)
+		return nil
+	},
+}
+
+// updateDDNSRecords validates and saves the records update returns
+func updateDDNSRecords(update func([]config.DDNSRecord) ([]config.DDNSRecord, error)) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.DDNS.Records, err = update(cfg.DDNS.Records); err != nil {
+		return err
+	}
+	if err := config.ValidateDDNSRecords(cfg.DDNS.Records); err != nil {
+		return exitWith(ExitUsage, err)
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// newDDNSUpdater returns the updater of the instance's records
+func newDDNSUpdater() (*config.Config, *ddns.Updater, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if len(cfg.DDNS.Records) == 0 {
+		return nil, nil, exitWith(ExitUsage, fmt.Errorf("no dynamic DNS records (use 'nat-manager ddns add NAME --provider PROVIDER')"))
+	}
+	updater, err := ddns.New(cfg.DDNSRecords(), ddnsLookup(cfg, nat.NewManager(cfg.ToNATConfig())), ddnsDryRun)
+	if err != nil {
+		return nil, nil, exitWith(ExitUsage, err)
+	}
+	return cfg, updater, nil
+}
+
+// ddnsLookup returns how the external address of manager's instance is
+// looked up
+func ddnsLookup(cfg *config.Config, manager *nat.Manager) ddns.Lookup {
+	if cfg.DDNS.IPSource != ddns.SourceInterface {
+		return ddns.WebLookup(cfg.DDNS.GetIPURL())
+	}
+	return func(context.Context) (netip.Addr, error) {
+		ip := manager.NetworkState().ExternalIP
+		if ip == "" {
+			return netip.Addr{}, fmt.Errorf("%s has no address", cfg.ExternalInterface)
+		}
+		return netip.ParseAddr(ip)
+	}
+}
+
+func logDDNSResult(result ddns.Result) {
+	log := logging.Component(logging.Events)
+	switch {
+	case result.Err != nil:
+		log.Warn("dynamic DNS update failed", "name", result.Record.Name, "provider", result.Record.Provider, "error", result.Err)
+	case result.DryRun:
+		log.Info("dynamic DNS update skipped (dry run)", "name", result.Record.Name, "provider", result.Record.Provider, "ip", result.Addr)
+	default:
+		log.Info("dynamic DNS updated", "name", result.Record.Name, "provider", result.Record.Provider, "ip", result.Addr)
+	}
+}
+
+func logDDNSError(err error) {
+	logging.Component(logging.Events).Warn("dynamic DNS check failed", "error", err)
+}
+
+// startDDNS keeps the records of cfg at the external address of manager's
+// instance in the background until ctx is done, when enabled. The updater
+// receives the command's events to react to address changes.
+func startDDNS(ctx context.Context, cfg *config.Config, manager *nat.Manager) {
+	if !cfg.DDNS.Enabled {
+		return
+	}
+	interval, err := cfg.DDNS.GetInterval()
+	if err != nil {
+		logging.Component(logging.Events).Warn("dynamic DNS disabled", "error", err)
+		return
+	}
+	updater, err := ddns.New(cfg.DDNSRecords(), ddnsLookup(cfg, manager), false)
+	if err != nil {
+		logging.Component(logging.Events).Warn("dynamic DNS disabled", "error", err)
+		return
+	}
+	event.Register(updater)
+	go updater.Run(ctx, interval, logDDNSResult, logDDNSError)
+	fmt.Fprintf(stdout, "🌐 Keeping %d dynamic DNS records up to date\n", len(cfg.DDNS.Records))
+}
+
+func init() {
+	rootCmd.AddCommand(ddnsCmd)
+	ddnsCmd.AddCommand(ddnsListCmd)
+	ddnsCmd.AddCommand(ddnsAddCmd)
+	ddnsCmd.AddCommand(ddnsRemoveCmd)
+	ddnsCmd.AddCommand(ddnsUpdateCmd)
+	ddnsCmd.AddCommand(ddnsRunCmd)
+
+	ddnsAddCmd.Flags().StringVar(&ddnsRecord.Provider, "provider", "", fmt.Sprintf("provider updating the name (%s)", strings.Join(ddns.Providers(), ", ")))
+	ddnsAddCmd.Flags().StringVar(&ddnsRecord.Token, "token", "", "API token (cloudflare, duckdns)")
+	ddnsAddCmd.Flags().StringVar(&ddnsRecord.Zone, "zone", "", "zone name or ID (cloudflare), hosted zone ID (route53)")
+	ddnsAddCmd.Flags().StringVar(&ddnsRecord.AccessKey, "access-key", "", "AWS access key ID (route53)")
+	ddnsAddCmd.Flags().StringVar(&ddnsRecord.SecretKey, "secret-key", "", "AWS secret access key (route53)")
+	ddnsAddCmd.Flags().StringVar(&ddnsRecord.Command, "command", "", "shell command updating the name (command)")
+	ddnsAddCmd.Flags().IntVar(&ddnsRecord.TTL, "ttl", 0, fmt.Sprintf("TTL of the record in seconds (default %d)", ddns.DefaultTTL))
+	_ = ddnsAddCmd.MarkFlagRequired("provider")
+	for _, cmd := range []*cobra.Command{ddnsUpdateCmd, ddnsRunCmd} {
+		cmd.Flags().BoolVar(&ddnsDryRun, "dry-run", false, "report the records to update without updating them")
+	}
+}
@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var (
+	devicesFile     string
+	devicesJSON     bool
+	devicesWatch    bool
+	devicesInterval time.Duration
+)
+
+// devicesCmd represents the devices command
+var devicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "List and manage devices on the internal network",
+	Long: `List and manage devices on the internal network.
+
+Without a subcommand, devices holding a DHCP lease or present in the ARP
+table of the internal interface are listed with their IP and MAC address,
+hardware vendor, name, type, remaining lease time and when they were first
+and last seen. Devices with a static address show up from the ARP table.
+
+Example:
+  nat-manager devices
+  nat-manager devices --json
+  nat-manager devices -o yaml
+  nat-manager devices --watch --interval 5s
+  nat-manager devices block aa:bb:cc:dd:ee:ff
+  nat-manager devices block --file macs.txt
+  nat-manager devices unblock 192.168.100.50`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{helperAnnotation: helperRequired},
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		manager := nat.NewManager(cfg.ToNATConfig())
+		if !devicesWatch {
+			return printDevices(manager, false)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return watch(ctx, devicesInterval, false, func() error {
+			return printDevices(manager, selectedOutput(devicesJSON) == outputTable)
+		})
+	},
+}
+
+// printDevices prints the devices as a table, JSON or YAML, clearing the
+// screen before a table when watching
+func printDevices(manager *nat.Manager, clear bool) error {
+	devices, err := listDevices(manager)
+	if err != nil {
+		return fmt.Errorf("failed to list devices: %w", err)
+	}
+	if format := selectedOutput(devicesJSON); format != outputTable {
+		return writeOutput(os.Stdout, format, devices)
+	}
+
+	if clear {
+		fmt.Fprint(stdout, clearScreen)
+		fmt.Fprintf(stdout, "📱 Devices - %s (Ctrl+C to stop)\n\n", time.Now().Format("2006-01-02 15:04:05"))
+	}
+	if len(devices) == 0 {
+		fmt.Fprintf(stdout, "No devices on the internal network\n")
+		return nil
+	}
+	fmt.Fprintf(stdout, "%-15s %-17s %-12s %-20s %-12s %-9s %-16s %s\n",
+		"IP", "MAC", "VENDOR", "HOSTNAME", "TYPE", "LEASE", "FIRST SEEN", "LAST SEEN")
+	for _, device := range devices {
+		printDevice(device)
+	}
+	return nil
+}
+
+// listDevices returns the devices from the helper when running through it,
+// or from manager
+func listDevices(manager *nat.Manager) ([]nat.Device, error) {
+	if helperClient != nil {
+		return helperClient.Devices()
+	}
+	return manager.Devices()
+}
+
+func printDevice(device nat.Device) {
+	lease := device.LeaseRemaining
+	if lease == "" {
+		lease = "static"
+	}
+	lastSeen := formatSeen(device.LastSeen)
+	if device.Online {
+		lastSeen = "online"
+	}
+	fmt.Fprintf(stdout, "%-15s %-17s %-12s %-20s %-12s %-9s %-16s %s\n",
+		device.IP, device.MAC, truncate(orDash(device.Vendor), 12), truncate(orDash(device.Hostname), 20),
+		truncate(orDash(device.Type), 12), lease, formatSeen(device.FirstSeen), lastSeen)
+}
+
+// formatSeen formats a sighting, "-" if the device was never seen
+func formatSeen(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// truncate shortens s to width characters
+func truncate(s string, width int) string {
+	if len(s) > width {
+		return s[:width-3] + "..."
+	}
+	return s
+}
+
+// devicesBlockCmd represents the devices block command
+var devicesBlockCmd = &cobra.Command{
+	Use:   "block [mac|ip]...",
+	Short: "Block devices from reaching the network",
+	Long: `Block devices by MAC or IP address.
+
+Devices may be given as arguments and/or read from --file (one per line,
+"#" starts a comment, "-" reads stdin). The whole batch is validated before
+anything changes and applied with a single pf anchor reload.
+
+Example:
+  nat-manager devices block aa:bb:cc:dd:ee:ff 192.168.100.50
+  nat-manager devices block --file macs.txt`,
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateBlockedDevices(args, config.AddItems)
+	},
+}
+
+// devicesUnblockCmd represents the devices unblock command
+var devicesUnblockCmd = &cobra.Command{
+	Use:   "unblock [mac|ip]...",
+	Short: "Remove devices from the block list",
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateBlockedDevices(args, config.RemoveItems)
+	},
+}
+
+// updateBlockedDevices validates the batch, updates the block list and
+// applies it
+func updateBlockedDevices(args []string, update func(list, items []string) []string) error {
+	devices, err := collectBatch(args, devicesFile)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, device := range devices {
+		errs = append(errs, nat.ValidateDevice(device))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("no changes made:\n%w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	before := len(cfg.BlockedDevices)
+	cfg.BlockedDevices = update(cfg.BlockedDevices, devices)
+	if err := saveAndApplyRules(cfg); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "✅ Block list updated (%d → %d devices)\n", before, len(cfg.BlockedDevices))
+	return nil
+}
+
+// collectBatch combines command arguments with entries read from file
+func collectBatch(args []string, file string) ([]string, error) {
+	items := append([]string{}, args...)
+	if file != "" {
+		fromFile, err := readListFile(file)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, fromFile...)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no devices given")
+	}
+	return items, nil
+}
+
+// readListFile reads one entry per line, skipping blanks and # comments.
+// A path of "-" reads stdin.
+func readListFile(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer func() { _ = file.Close() }()
+		r = file
+	}
+
+	var items []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return items, nil
+}
+
+// saveAndApplyRules validates the forwards and blocked devices, reloads the
+// pf anchor when NAT is running and saves the configuration. Nothing is
+// saved if validation or the reload fails.
+func saveAndApplyRules(cfg *config.Config) error {
+	manager := nat.NewManager(cfg.ToNATConfig())
+	if err := manager.ApplyRules(); err != nil {
+		return fmt.Errorf("no changes made:\n%w", err)
+	}
+
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	if manager.RulesLoaded() {
+		fmt.Fprintf(stdout, "🔄 NAT rules reloaded\n")
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(devicesCmd)
+	devicesCmd.AddCommand(devicesBlockCmd)
+	devicesCmd.AddCommand(devicesUnblockCmd)
+
+	devicesCmd.Flags().BoolVar(&devicesJSON, "json", false, "output devices as JSON")
+	devicesCmd.Flags().BoolVarP(&devicesWatch, "watch", "w", false, "refresh the list until interrupted")
+	devicesCmd.Flags().DurationVarP(&devicesInterval, "interval", "i", 2*time.Second, "refresh interval for --watch")
+	devicesBlockCmd.Flags().StringVarP(&devicesFile, "file", "f", "", "read devices from file, one per line (- for stdin)")
+	devicesUnblockCmd.Flags().StringVarP(&devicesFile, "file", "f", "", "read devices from file, one per line (- for stdin)")
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/fingerprint"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// dhcpEventCmd is run by dnsmasq on every lease change to record the
+// requesting device's DHCP fingerprint and apply device class policies to
+// new devices
+var dhcpEventCmd = &cobra.Command{
+	Use:    "dhcp-event <add|old|del> <mac> <ip> [hostname]",
+	Short:  "Record a DHCP lease event (run by dnsmasq)",
+	Hidden: true,
+	Args:   cobra.RangeArgs(3, 4),
+	RunE: func(_ *cobra.Command, args []string) error {
+		emitLeaseEvent(args)
+		if args[0] != "add" && args[0] != "old" {
+			return nil
+		}
+
+		path, err := config.GetFingerprintPath()
+		if err != nil {
+			return fmt.Errorf("failed to get fingerprint path: %w", err)
+		}
+
+		obs := fingerprint.Observation{
+			MAC:         args[1],
+			VendorClass: os.Getenv("DNSMASQ_VENDOR_CLASS"),
+			Options:     os.Getenv("DNSMASQ_REQUESTED_OPTIONS"),
+		}
+		if len(args) > 3 {
+			obs.Hostname = args[3]
+		}
+		if err := fingerprint.Record(path, obs); err != nil {
+			return err
+		}
+		if args[0] == "add" {
+			return applyClassPolicies()
+		}
+		return nil
+	},
+}
+
+// emitLeaseEvent announces a device getting or releasing a lease
+func emitLeaseEvent(args []string) {
+	typ := map[string]string{"add": event.DeviceJoined, "del": event.DeviceLeft}[args[0]]
+	if typ == "" {
+		return
+	}
+	data := map[string]string{"mac": args[1], "ip": args[2]}
+	if len(args) > 3 {
+		data["hostname"] = args[3]
+	}
+	if typ == event.DeviceJoined {
+		if cfg, err := config.Load(); err == nil {
+			data["known"] = strconv.FormatBool(cfg.KnownDevice(args[1]))
+		}
+	}
+	event.Emit(event.Event{Type: typ, Instance: config.Instance(), Data: data})
+}
+
+// applyClassPolicies reloads the rules so a new device gets the defaults
+// of its class
+func applyClassPolicies() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if len(cfg.DeviceClasses) == 0 {
+		return nil
+	}
+	return nat.NewManager(cfg.ToNATConfig()).ApplyRules()
+}
+
+func init() {
+	rootCmd.AddCommand(dhcpEventCmd)
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// dhcpWatchInterval is how often long-running commands check that the DHCP
+// supervisor is still alive
+const dhcpWatchInterval = 10 * time.Second
+
+// dhcpSuperviseCmd is started by 'start' to keep the instance's dnsmasq
+// running and capture its log until 'stop'
+var dhcpSuperviseCmd = &cobra.Command{
+	Use:    "dhcp-supervise",
+	Short:  "Run and restart the DHCP and DNS servers (started by start)",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		return nat.NewManager(cfg.ToNATConfig()).SuperviseDHCP(ctx)
+	},
+}
+
+// watchDHCP restarts the DHCP supervisor from long-running commands should
+// it die, until ctx is done
+func watchDHCP(ctx context.Context, manager *nat.Manager) {
+	go manager.WatchDHCP(ctx, dhcpWatchInterval, func(msg string) {
+		logging.Component(logging.DHCP).Warn(msg)
+	})
+}
+
+func init() {
+	rootCmd.AddCommand(dhcpSuperviseCmd)
+}
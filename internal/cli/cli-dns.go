@@ -0,0 +1,391 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/influx"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var (
+	dnsStatsInterval   time.Duration
+	dnsServeSupervised bool
+)
+
+// dnsCmd represents the dns command
+var dnsCmd = &cobra.Command{
+	Use:   "dns",
+	Short: "Manage DNS for the internal network",
+	Long: `Manage DNS for devices on the internal network.
+
+DHCP clients that send a hostname are registered automatically in the
+local zone (local_domain in the configuration, "nat.lan" by default), so
+internal devices can reach each other by name, e.g. laptop.nat.lan.
+
+The upstream resolvers, static records, blocklists and query log can all be
+managed with subcommands instead of editing the configuration.
+
+Example:
+  nat-manager dns upstreams add 1.1.1.1
+  nat-manager dns records add nas.lab A 192.168.100.10
+  nat-manager dns serve
+  nat-manager dns log enable
+  nat-manager dns blocklist`,
+}
+
+// dnsRecordsCmd represents the dns records command
+var dnsRecordsCmd = &cobra.Command{
+	Use:   "records",
+	Short: "List names registered in the local DNS zone",
+	Long: `List the static DNS records from dns_records and the names published
+in the local zone for DHCP clients.
+
+Example:
+  nat-manager dns records
+  nat-manager dns records add nas.lab A 192.168.100.10
+  nat-manager dns records remove nas.lab`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		manager := nat.NewManager(cfg.ToNATConfig())
+		records, err := manager.GetDNSRecords()
+		if err != nil {
+			return fmt.Errorf("failed to read DNS records: %w", err)
+		}
+
+		if len(records) == 0 {
+			fmt.Fprintf(stdout, "No local DNS zone or static records configured\n")
+			return nil
+		}
+
+		if cfg.LocalDomain != "" {
+			fmt.Fprintf(stdout, "Zone: %s\n\n", cfg.LocalDomain)
+		}
+		fmt.Fprintf(stdout, "%-40s %-6s %s\n", "NAME", "TYPE", "VALUE")
+		fmt.Fprintf(stdout, "%-40s %-6s %s\n",
+			strings.Repeat("-", 40),
+			strings.Repeat("-", 6),
+			strings.Repeat("-", 15))
+		for _, record := range records {
+			fmt.Fprintf(stdout, "%-40s %-6s %s\n", record.Name, record.Type, record.Value)
+		}
+
+		return nil
+	},
+}
+
+// dnsRecordsAddCmd represents the dns records add command
+var dnsRecordsAddCmd = &cobra.Command{
+	Use:   "add <name> <A|AAAA|CNAME> <value>",
+	Short: "Add a static DNS record",
+	Long: `Add a static record to dns_records, answered by dnsmasq or the embedded
+forwarder. A name may have A and AAAA records, or a single CNAME.
+
+Example:
+  nat-manager dns records add nas.lab A 192.168.100.10
+  nat-manager dns records add files.lab CNAME nas.lab`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(_ *cobra.Command, args []string) error {
+		record := config.DNSRecord{Name: args[0], Type: strings.ToUpper(args[1]), Value: args[2]}
+		return updateConfig(func(cfg *config.Config) error {
+			for _, existing := range cfg.DNSRecords {
+				if sameRecord(existing, record.Name, record.Type) && existing.Value == record.Value {
+					return fmt.Errorf("record %s %s %s already exists", record.Name, record.Type, record.Value)
+				}
+			}
+			records := append(cfg.DNSRecords, record)
+			if err := dns.ValidateRecords(staticRecords(records)); err != nil {
+				return err
+			}
+			cfg.DNSRecords = records
+			return nil
+		}, fmt.Sprintf("Added %s %s %s", record.Name, record.Type, record.Value))
+	},
+}
+
+// dnsRecordsRemoveCmd represents the dns records remove command
+var dnsRecordsRemoveCmd = &cobra.Command{
+	Use:   "remove <name> [type]",
+	Short: "Remove static DNS records",
+	Long: `Remove the static records of a name, or only those of the given type.
+
+Example:
+  nat-manager dns records remove nas.lab
+  nat-manager dns records remove nas.lab AAAA`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		typ := ""
+		if len(args) == 2 {
+			typ = args[1]
+		}
+		removed := 0
+		return updateConfig(func(cfg *config.Config) error {
+			kept := make([]config.DNSRecord, 0, len(cfg.DNSRecords))
+			for _, record := range cfg.DNSRecords {
+				if sameRecord(record, args[0], typ) {
+					removed++
+					continue
+				}
+				kept = append(kept, record)
+			}
+			if removed == 0 {
+				return fmt.Errorf("no records for %s", args[0])
+			}
+			cfg.DNSRecords = kept
+			return nil
+		}, fmt.Sprintf("Removed the records of %s", args[0]))
+	},
+}
+
+// sameRecord reports whether record has the name, ignoring case and a
+// trailing dot, and the type unless typ is empty
+func sameRecord(record config.DNSRecord, name, typ string) bool {
+	normalize := func(s string) string { return strings.ToLower(strings.TrimSuffix(s, ".")) }
+	return normalize(record.Name) == normalize(name) && (typ == "" || strings.EqualFold(record.Type, typ))
+}
+
+// dnsServeCmd represents the dns serve command
+var dnsServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the embedded caching DNS forwarder",
+	Long: `Run the embedded caching DNS forwarder in the foreground.
+
+The forwarder binds to the gateway IP (dns_forwarder.listen), answers names
+in the local zone from DHCP leases, caches upstream answers for their TTL
+and forwards everything else to dns_forwarder.upstreams (dns_servers by
+default). Enable dns_forwarder.enabled so NAT hands clients the gateway as
+their DNS server and dnsmasq only serves DHCP; 'start' and the daemon then
+run the forwarder under the DHCP supervisor, which restarts it and logs to
+forwarder.log, and 'stop' stops it. Run serve by hand only for a
+forwarder without NAT.
+
+Example:
+  nat-manager dns serve
+  nat-manager dns serve --stats-interval 1m  # Print metrics every minute`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		manager := nat.NewManager(cfg.ToNATConfig())
+
+		var blocklist *dns.Blocklist
+		if cfg.DNSBlocklist.Enabled {
+			blocklist = newBlocklist(cfg, manager)
+		}
+
+		var onQuery func(dns.QueryLog)
+		if cfg.DNSForwarder.QueryLog.Enabled {
+			logger, err := newQueryLogger(cfg, manager)
+			if err != nil {
+				return fmt.Errorf("failed to open DNS query log: %w", err)
+			}
+			defer func() { _ = logger.Close() }()
+			onQuery = logger.Log
+		}
+
+		forwarder, err := newDNSForwarder(cfg, manager, blocklist, onQuery)
+		if err != nil {
+			return fmt.Errorf("failed to create DNS forwarder: %w", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		// under the supervisor, NAT's own command serves the API and
+		// watches the supervisor
+		if !dnsServeSupervised {
+			startAPIServer(ctx, cfg)
+			watchDHCP(ctx, manager)
+		}
+		startInflux(ctx, cfg, func(now time.Time) ([]influx.Point, error) {
+			return influx.DNSPoints(config.Instance(), forwarder.Stats(), now), nil
+		})
+
+		if blocklist != nil {
+			go maintainBlocklist(ctx, cfg, manager, blocklist)
+		}
+
+		if dnsStatsInterval > 0 {
+			go func() {
+				ticker := time.NewTicker(dnsStatsInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-ticker.C:
+						printDNSStats(forwarder.Stats())
+					}
+				}
+			}()
+		}
+
+		fmt.Fprintf(stdout, "🔎 DNS forwarder listening on %s (upstreams: %s)\n",
+			cfg.GetDNSListenAddr(), strings.Join(cfg.GetDNSUpstreams(), ", "))
+		if onQuery != nil {
+			fmt.Fprintf(stdout, "   Query log: on (retention %s)\n", cfg.DNSForwarder.QueryLog.GetRetention())
+		}
+		if len(cfg.DNSForwarder.Fallbacks) > 0 {
+			fmt.Fprintf(stdout, "   Fallbacks: %s\n", strings.Join(cfg.DNSForwarder.Fallbacks, ", "))
+		}
+		for _, forward := range cfg.DNSForwarder.Conditional {
+			fmt.Fprintf(stdout, "   %s → %s\n", forward.Domain, strings.Join(forward.Upstreams, ", "))
+		}
+		for _, policy := range cfg.DNSForwarder.Policies {
+			fmt.Fprintf(stdout, "   Policy %s (%d devices) → %s\n", policy.Name, len(policy.Devices), strings.Join(policy.Upstreams, ", "))
+		}
+		if err := forwarder.ListenAndServe(ctx); err != nil {
+			return err
+		}
+
+		printDNSStats(forwarder.Stats())
+		return nil
+	},
+}
+
+// newDNSForwarder creates the embedded DNS forwarder for the configuration,
+// answering the local zone from the manager's DHCP leases, applying the
+// devices' DNS policies, filtering with blocklist when it is non-nil,
+// passing answered queries to onQuery and, in lockdown, adding the
+// addresses of allowed domains to the pf table
+func newDNSForwarder(cfg *config.Config, manager *nat.Manager, blocklist *dns.Blocklist, onQuery func(dns.QueryLog)) (*dns.Forwarder, error) {
+	var onAnswer func(string, []net.IP)
+	if cfg.Lockdown.Enabled {
+		onAnswer = allowResolved(manager)
+	}
+
+	return dns.NewForwarder(dns.Config{
+		Listen:      cfg.GetDNSListenAddr(),
+		Upstreams:   cfg.GetDNSUpstreams(),
+		Fallbacks:   cfg.DNSForwarder.Fallbacks,
+		Conditional: conditionalForwards(cfg.DNSForwarder.Conditional),
+		Policies:    dnsPolicies(cfg.DNSForwarder.Policies),
+		PolicyFor:   newPolicyMap(cfg.DNSForwarder.Policies, manager).PolicyFor,
+		Records:     staticRecords(cfg.DNSRecords),
+		CacheSize:   cfg.DNSForwarder.CacheSize,
+		LocalDomain: cfg.LocalDomain,
+		Blocklist:   blocklist,
+		OnQuery:     onQuery,
+		OnAnswer:    onAnswer,
+		LocalLookup: func(name string) net.IP {
+			records, err := manager.GetDNSRecords()
+			if err != nil {
+				return nil
+			}
+			for _, record := range records {
+				if strings.EqualFold(record.Name, name) {
+					return net.ParseIP(record.Value)
+				}
+			}
+			return nil
+		},
+	})
+}
+
+// staticRecords converts the configured static DNS records
+func staticRecords(records []config.DNSRecord) []dns.Record {
+	result := make([]dns.Record, 0, len(records))
+	for _, record := range records {
+		result = append(result, dns.Record{Name: record.Name, Type: record.Type, Value: record.Value})
+	}
+	return result
+}
+
+// conditionalForwards converts the configured conditional forwards
+func conditionalForwards(forwards []config.ConditionalForward) []dns.ConditionalForward {
+	result := make([]dns.ConditionalForward, 0, len(forwards))
+	for _, forward := range forwards {
+		result = append(result, dns.ConditionalForward{Domain: forward.Domain, Upstreams: forward.Upstreams})
+	}
+	return result
+}
+
+// dnsPolicies converts the configured DNS policies
+func dnsPolicies(policies []config.DNSPolicy) []dns.Policy {
+	result := make([]dns.Policy, 0, len(policies))
+	for _, policy := range policies {
+		result = append(result, dns.Policy{Name: policy.Name, Upstreams: policy.Upstreams})
+	}
+	return result
+}
+
+// policyMap assigns clients to the DNS policy of their device, re-reading
+// the DHCP leases periodically so devices keep their policy across leases
+type policyMap struct {
+	policies []config.DNSPolicy
+	manager  *nat.Manager
+
+	mu        sync.Mutex
+	clients   map[string]string // IP -> policy
+	refreshed time.Time
+}
+
+// newPolicyMap returns the policy assignments for the configured policies
+func newPolicyMap(policies []config.DNSPolicy, manager *nat.Manager) *policyMap {
+	return &policyMap{policies: policies, manager: manager}
+}
+
+// PolicyFor returns the name of the client's DNS policy, "" for none
+func (p *policyMap) PolicyFor(ip string) string {
+	if len(p.policies) == 0 {
+		return ""
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.refreshed) > deviceRefreshInterval {
+		p.clients = make(map[string]string)
+		for _, policy := range p.policies {
+			for _, client := range resolveBypass(policy.Devices, p.manager) {
+				p.clients[client] = policy.Name
+			}
+		}
+		p.refreshed = time.Now()
+	}
+	return p.clients[ip]
+}
+
+func printDNSStats(stats dns.Stats) {
+	fmt.Fprintf(stdout, "📊 Queries: %d | Cache hits: %d | Misses: %d | Local: %d | Blocked: %d | Fallbacks: %d | Upstream errors: %d | Cached: %d | Avg upstream: %s\n",
+		stats.Queries, stats.CacheHits, stats.CacheMisses, stats.LocalAnswers, stats.Blocked,
+		stats.Fallbacks, stats.UpstreamErrors, stats.CacheEntries, stats.AvgUpstreamLatency().Round(time.Millisecond))
+
+	types := make([]string, 0, len(stats.QueryTypes))
+	for name := range stats.QueryTypes {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	for _, name := range types {
+		fmt.Fprintf(stdout, "   %-6s %d\n", name, stats.QueryTypes[name])
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(dnsCmd)
+	dnsCmd.AddCommand(dnsRecordsCmd)
+	dnsRecordsCmd.AddCommand(dnsRecordsAddCmd)
+	dnsRecordsCmd.AddCommand(dnsRecordsRemoveCmd)
+	dnsCmd.AddCommand(dnsServeCmd)
+
+	dnsServeCmd.Flags().BoolVar(&dnsServeSupervised, "supervised", false, "run under the DHCP supervisor of the instance")
+	_ = dnsServeCmd.Flags().MarkHidden("supervised")
+	dnsServeCmd.Flags().DurationVar(&dnsStatsInterval, "stats-interval", 0, "print forwarder metrics at this interval (0 disables)")
+}
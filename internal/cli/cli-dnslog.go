@@ -0,0 +1,386 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// deviceRefreshInterval is how often the query logger re-reads DHCP leases
+const deviceRefreshInterval = 30 * time.Second
+
+var (
+	dnsLogLines  int
+	dnsLogFollow bool
+	dnsLogClient string
+	dnsLogSince  time.Duration
+	dnsTopLimit  int
+	dnsTopClient string
+	dnsTopSince  time.Duration
+
+	queryLogRetention string
+	queryLogRemove    bool
+)
+
+// dnsLogCmd represents the dns log command
+var dnsLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show logged DNS queries by device",
+	Long: `Show DNS queries answered by the embedded forwarder and which device
+asked for them.
+
+Query logging is off by default. Enable it with 'dns log enable'; entries
+older than the retention (24h by default) are deleted and devices excluded
+with 'dns log exclude' are never logged.
+
+Example:
+  nat-manager dns log
+  nat-manager dns log --client laptop --since 1h
+  nat-manager dns log --follow
+  nat-manager dns log enable --retention 72h`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		path, err := queryLogPath()
+		if err != nil {
+			return err
+		}
+
+		entries, err := readQueryLog(path, queryFilter(dnsLogClient, dnsLogSince))
+		if err != nil {
+			return err
+		}
+		if len(entries) > dnsLogLines && dnsLogLines > 0 {
+			entries = entries[len(entries)-dnsLogLines:]
+		}
+
+		printQueryHeader()
+		for _, entry := range entries {
+			printQuery(entry)
+		}
+
+		if dnsLogFollow {
+			return followQueryLog(path, queryFilter(dnsLogClient, 0))
+		}
+		return nil
+	},
+}
+
+// dnsLogEnableCmd represents the dns log enable command
+var dnsLogEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Start logging DNS queries",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if queryLogRetention != "" {
+			if retention, err := time.ParseDuration(queryLogRetention); err != nil || retention <= 0 {
+				return fmt.Errorf("invalid retention %q, expected a duration such as 72h", queryLogRetention)
+			}
+		}
+		return updateConfig(func(cfg *config.Config) error {
+			cfg.DNSForwarder.QueryLog.Enabled = true
+			if queryLogRetention != "" {
+				cfg.DNSForwarder.QueryLog.Retention = queryLogRetention
+			}
+			return nil
+		}, "DNS query log enabled")
+	},
+}
+
+// dnsLogDisableCmd represents the dns log disable command
+var dnsLogDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Stop logging DNS queries",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return updateConfig(func(cfg *config.Config) error {
+			cfg.DNSForwarder.QueryLog.Enabled = false
+			return nil
+		}, "DNS query log disabled")
+	},
+}
+
+// dnsLogExcludeCmd represents the dns log exclude command
+var dnsLogExcludeCmd = &cobra.Command{
+	Use:   "exclude <ip-or-mac>...",
+	Short: "Never log the queries of these devices (use --remove to undo)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		for _, device := range args {
+			if err := nat.ValidateDevice(device); err != nil {
+				return err
+			}
+		}
+		return updateConfig(func(cfg *config.Config) error {
+			log := &cfg.DNSForwarder.QueryLog
+			if queryLogRemove {
+				log.Exclude = config.RemoveItems(log.Exclude, args)
+			} else {
+				log.Exclude = config.AddItems(log.Exclude, args)
+			}
+			return nil
+		}, "DNS query log exclusions updated")
+	},
+}
+
+// dnsTopCmd represents the dns top command
+var dnsTopCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Report the most queried domains",
+	Long: `Report the most queried domains from the DNS query log, optionally
+for a single device.
+
+Example:
+  nat-manager dns top
+  nat-manager dns top --client 192.168.100.50 --since 1h -n 20`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		path, err := queryLogPath()
+		if err != nil {
+			return err
+		}
+
+		entries, err := readQueryLog(path, queryFilter(dnsTopClient, dnsTopSince))
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Fprintf(stdout, "No queries logged\n")
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "%d queries since %s\n\n", len(entries), entries[0].Time.Local().Format("2006-01-02 15:04"))
+		fmt.Fprintf(stdout, "%-8s %-8s %-8s %s\n", "QUERIES", "BLOCKED", "CLIENTS", "DOMAIN")
+		fmt.Fprintf(stdout, "%-8s %-8s %-8s %s\n",
+			strings.Repeat("-", 8),
+			strings.Repeat("-", 8),
+			strings.Repeat("-", 8),
+			strings.Repeat("-", 30))
+		for _, domain := range dns.TopDomains(entries, dnsTopLimit) {
+			fmt.Fprintf(stdout, "%-8d %-8d %-8d %s\n", domain.Queries, domain.Blocked, domain.Clients, domain.Name)
+		}
+		return nil
+	},
+}
+
+// queryLogPath returns the query log path, explaining how to enable logging
+// when nothing has been logged yet
+func queryLogPath() (string, error) {
+	path, err := config.GetQueryLogPath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get query log path: %w", err)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", fmt.Errorf("no DNS query log found; enable dns_forwarder.query_log and run 'nat-manager dns serve'")
+	}
+	return path, nil
+}
+
+// readQueryLog reads the entries of the query log accepted by keep
+func readQueryLog(path string, keep func(dns.LoggedQuery) bool) ([]dns.LoggedQuery, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open query log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	return dns.ReadQueryLog(file, keep)
+}
+
+// queryFilter matches entries from client (IP or device name) logged within
+// since; empty and zero values match everything
+func queryFilter(client string, since time.Duration) func(dns.LoggedQuery) bool {
+	cutoff := time.Time{}
+	if since > 0 {
+		cutoff = time.Now().Add(-since)
+	}
+	return func(q dns.LoggedQuery) bool {
+		if q.Time.Before(cutoff) {
+			return false
+		}
+		return client == "" || q.Client == client || strings.EqualFold(q.Device, client)
+	}
+}
+
+// followQueryLog prints entries as they are appended, reopening the log when
+// pruning replaces it
+func followQueryLog(path string, keep func(dns.LoggedQuery) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open query log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("failed to seek query log: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	var partial []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == nil {
+			var entry dns.LoggedQuery
+			if json.Unmarshal(partial, &entry) == nil && keep(entry) {
+				printQuery(entry)
+			}
+			partial = partial[:0]
+			continue
+		}
+		if err != io.EOF {
+			return fmt.Errorf("failed to read query log: %w", err)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+		if replaced(file, path) {
+			_ = file.Close()
+			if file, err = os.Open(path); err != nil {
+				return fmt.Errorf("failed to reopen query log: %w", err)
+			}
+			reader.Reset(file)
+			partial = partial[:0]
+		}
+	}
+}
+
+// replaced reports whether path no longer refers to the open file
+func replaced(file *os.File, path string) bool {
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	open, err := file.Stat()
+	return err == nil && !os.SameFile(open, current)
+}
+
+func printQueryHeader() {
+	fmt.Fprintf(stdout, "%-19s %-15s %-20s %-6s %-8s %s\n", "TIME", "CLIENT", "DEVICE", "TYPE", "SOURCE", "NAME")
+}
+
+func printQuery(q dns.LoggedQuery) {
+	device := q.Device
+	if device == "" {
+		device = "-"
+	}
+	fmt.Fprintf(stdout, "%-19s %-15s %-20s %-6s %-8s %s\n",
+		q.Time.Local().Format("2006-01-02 15:04:05"), q.Client, device, q.Type, q.Source, q.Name)
+}
+
+// queryLogger writes forwarder queries to the query log, attributing each
+// to the device that asked
+type queryLogger struct {
+	writer  *dns.QueryLogWriter
+	manager *nat.Manager
+	labels  map[string]string
+	exclude []string
+
+	mu        sync.Mutex
+	devices   map[string]string // IP -> name
+	excluded  map[string]bool   // IPs
+	refreshed time.Time
+}
+
+// newQueryLogger opens the query log configured in cfg
+func newQueryLogger(cfg *config.Config, manager *nat.Manager) (*queryLogger, error) {
+	path, err := config.GetQueryLogPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get query log path: %w", err)
+	}
+	writer, err := dns.OpenQueryLog(path, cfg.DNSForwarder.QueryLog.GetRetention())
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(cfg.DeviceLabels))
+	for key, label := range cfg.DeviceLabels {
+		labels[strings.ToLower(key)] = label
+	}
+	return &queryLogger{
+		writer:  writer,
+		manager: manager,
+		labels:  labels,
+		exclude: cfg.DNSForwarder.QueryLog.Exclude,
+	}, nil
+}
+
+// Log records a forwarder query unless its client is excluded
+func (l *queryLogger) Log(entry dns.QueryLog) {
+	q := dns.NewLoggedQuery(entry, "")
+	device, excluded := l.lookup(q.Client)
+	if excluded {
+		return
+	}
+	q.Device = device
+	_ = l.writer.Write(q)
+}
+
+// Close closes the query log
+func (l *queryLogger) Close() error {
+	return l.writer.Close()
+}
+
+// lookup returns the device name for ip and whether it is excluded from
+// logging, re-reading the DHCP leases periodically
+func (l *queryLogger) lookup(ip string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Since(l.refreshed) > deviceRefreshInterval {
+		l.refresh()
+	}
+	return l.devices[ip], l.excluded[ip]
+}
+
+// refresh rebuilds the device names and excluded IPs from the leases. The
+// caller must hold l.mu.
+func (l *queryLogger) refresh() {
+	leases, _ := l.manager.GetLeases()
+
+	l.devices = make(map[string]string, len(leases)+len(l.labels))
+	for key, label := range l.labels {
+		if net.ParseIP(key) != nil {
+			l.devices[key] = label // static devices without a lease
+		}
+	}
+	for _, lease := range leases {
+		if label := l.labels[strings.ToLower(lease.MAC)]; label != "" {
+			l.devices[lease.IP] = label
+		} else if l.devices[lease.IP] == "" {
+			l.devices[lease.IP] = lease.Hostname
+		}
+	}
+
+	l.excluded = make(map[string]bool)
+	for _, ip := range resolveBypass(l.exclude, l.manager) {
+		l.excluded[ip] = true
+	}
+	l.refreshed = time.Now()
+}
+
+func init() {
+	dnsCmd.AddCommand(dnsLogCmd)
+	dnsLogCmd.AddCommand(dnsLogEnableCmd)
+	dnsLogCmd.AddCommand(dnsLogDisableCmd)
+	dnsLogCmd.AddCommand(dnsLogExcludeCmd)
+	dnsCmd.AddCommand(dnsTopCmd)
+
+	dnsLogCmd.Flags().IntVarP(&dnsLogLines, "lines", "n", 50, "number of recent queries to show (0 for all)")
+	dnsLogCmd.Flags().BoolVarP(&dnsLogFollow, "follow", "f", false, "keep printing new queries")
+	dnsLogCmd.Flags().StringVar(&dnsLogClient, "client", "", "only show queries from this device IP or name")
+	dnsLogCmd.Flags().DurationVar(&dnsLogSince, "since", 0, "only show queries newer than this")
+
+	dnsLogEnableCmd.Flags().StringVar(&queryLogRetention, "retention", "", "how long to keep logged queries (default 24h)")
+	dnsLogExcludeCmd.Flags().BoolVar(&queryLogRemove, "remove", false, "log the devices' queries again")
+
+	dnsTopCmd.Flags().IntVarP(&dnsTopLimit, "limit", "n", 10, "number of domains to show")
+	dnsTopCmd.Flags().StringVar(&dnsTopClient, "client", "", "only count queries from this device IP or name")
+	dnsTopCmd.Flags().DurationVar(&dnsTopSince, "since", 24*time.Hour, "only count queries newer than this")
+}
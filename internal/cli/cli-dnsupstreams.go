@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+)
+
+var (
+	upstreamsForwarder bool
+	upstreamsFallback  bool
+)
+
+// dnsUpstreamsCmd represents the dns upstreams command
+var dnsUpstreamsCmd = &cobra.Command{
+	Use:   "upstreams",
+	Short: "Manage the upstream DNS resolvers",
+	Long: `Show and change the resolvers DNS queries are forwarded to.
+
+dns_servers are used by dnsmasq and, unless it has upstreams of its own,
+by the embedded forwarder; they must be IP addresses. With --forwarder the
+commands change the forwarder's own upstreams instead, and with --fallback
+the resolvers it only uses when all upstreams fail. Both also accept
+https:// DNS-over-HTTPS URLs, tls://host DNS-over-TLS addresses and DoH
+provider names such as cloudflare.
+
+Example:
+  nat-manager dns upstreams
+  nat-manager dns upstreams add 1.1.1.1 1.0.0.1
+  nat-manager dns upstreams set --forwarder cloudflare
+  nat-manager dns upstreams add --fallback 9.9.9.9
+  nat-manager dns upstreams remove 8.8.8.8`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		printList("DNS Servers", cfg.DNSServers)
+		printList("Forwarder Upstreams", cfg.DNSForwarder.Upstreams)
+		printList("Forwarder Fallbacks", cfg.DNSForwarder.Fallbacks)
+		if len(cfg.DNSForwarder.Upstreams) == 0 {
+			fmt.Fprintf(stdout, "\nThe forwarder uses the DNS servers\n")
+		}
+		return nil
+	},
+}
+
+// dnsUpstreamsAddCmd represents the dns upstreams add command
+var dnsUpstreamsAddCmd = &cobra.Command{
+	Use:   "add <resolver>...",
+	Short: "Add upstream resolvers",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateUpstreams(args, func(list []string) []string { return config.AddItems(list, args) })
+	},
+}
+
+// dnsUpstreamsRemoveCmd represents the dns upstreams remove command
+var dnsUpstreamsRemoveCmd = &cobra.Command{
+	Use:   "remove <resolver>...",
+	Short: "Remove upstream resolvers",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateUpstreams(nil, func(list []string) []string { return config.RemoveItems(list, args) })
+	},
+}
+
+// dnsUpstreamsSetCmd represents the dns upstreams set command
+var dnsUpstreamsSetCmd = &cobra.Command{
+	Use:   "set <resolver>...",
+	Short: "Replace the upstream resolvers",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateUpstreams(args, func([]string) []string { return append([]string{}, args...) })
+	},
+}
+
+// updateUpstreams validates the added resolvers and updates the list
+// selected by the flags
+func updateUpstreams(added []string, update func(list []string) []string) error {
+	name, validate := "DNS servers", validateDNSServer
+	switch {
+	case upstreamsForwarder && upstreamsFallback:
+		return fmt.Errorf("--forwarder and --fallback cannot be combined")
+	case upstreamsForwarder:
+		name, validate = "forwarder upstreams", validateUpstream
+	case upstreamsFallback:
+		name, validate = "forwarder fallbacks", validateUpstream
+	}
+	for _, resolver := range added {
+		if err := validate(resolver); err != nil {
+			return err
+		}
+	}
+
+	return updateConfig(func(cfg *config.Config) error {
+		list := upstreamList(cfg)
+		*list = update(*list)
+		if len(*list) == 0 && !upstreamsForwarder && !upstreamsFallback {
+			return fmt.Errorf("at least one DNS server is required")
+		}
+		return nil
+	}, "Updated the "+name)
+}
+
+// upstreamList returns the resolver list selected by the flags
+func upstreamList(cfg *config.Config) *[]string {
+	switch {
+	case upstreamsForwarder:
+		return &cfg.DNSForwarder.Upstreams
+	case upstreamsFallback:
+		return &cfg.DNSForwarder.Fallbacks
+	}
+	return &cfg.DNSServers
+}
+
+// validateDNSServer checks a dns_servers entry, which dnsmasq needs as an IP
+func validateDNSServer(resolver string) error {
+	if net.ParseIP(resolver) == nil {
+		return fmt.Errorf("invalid DNS server %q: expected an IP address (use --forwarder for DoH and DoT)", resolver)
+	}
+	return nil
+}
+
+// validateUpstream checks a resolver of the embedded forwarder
+func validateUpstream(resolver string) error {
+	_, err := dns.ParseUpstream(resolver)
+	return err
+}
+
+func init() {
+	dnsCmd.AddCommand(dnsUpstreamsCmd)
+	dnsUpstreamsCmd.AddCommand(dnsUpstreamsAddCmd)
+	dnsUpstreamsCmd.AddCommand(dnsUpstreamsRemoveCmd)
+	dnsUpstreamsCmd.AddCommand(dnsUpstreamsSetCmd)
+
+	for _, cmd := range []*cobra.Command{dnsUpstreamsAddCmd, dnsUpstreamsRemoveCmd, dnsUpstreamsSetCmd} {
+		cmd.Flags().BoolVar(&upstreamsForwarder, "forwarder", false, "change the embedded forwarder's own upstreams")
+		cmd.Flags().BoolVar(&upstreamsFallback, "fallback", false, "change the forwarder's fallback resolvers")
+	}
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/wireguard"
+)
+
+// requiredTools lists the system binaries the NAT manager shells out to,
+// besides the configured DHCP and DNS servers
+var requiredTools = []string{"pfctl", "ifconfig", "sysctl"}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose host issues that affect NAT",
+	Long: `Check the host for problems that prevent NAT from working correctly.
+
+This checks:
+- Required system tools (pfctl, ifconfig, sysctl, the configured DHCP
+  and DNS servers: dnsmasq, kea-dhcp4 or coredns, and wireguard-go and wg
+  when the WireGuard endpoint is enabled)
+- iCloud Private Relay altering the host's DNS and egress
+- System VPN profiles owning the default route or scoping DNS
+- Networks of UTM, VMware Fusion and Parallels using the NAT subnet
+
+Each finding explains how it interacts with NAT and lists mitigations.
+
+Example:
+  nat-manager doctor`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			cfg = config.Default()
+		}
+
+		manager := nat.NewManager(cfg.ToNATConfig())
+
+		problems := 0
+
+		fmt.Fprintf(stdout, "🩺 System Tools:\n")
+		tools := append(requiredTools, manager.ServerBinaries()...)
+		if cfg.WireGuard.Enabled {
+			tools = append(tools, wireguard.Binaries...)
+		}
+		for _, tool := range tools {
+			if path, err := exec.LookPath(tool); err == nil {
+				fmt.Fprintf(stdout, "   ✅ %s (%s)\n", tool, path)
+			} else {
+				fmt.Fprintf(stdout, "   ❌ %s not found in PATH\n", tool)
+				problems++
+			}
+		}
+
+		conflicts := manager.DetectHostConflicts()
+		if len(conflicts) == 0 {
+			fmt.Fprintf(stdout, "\n✅ No Private Relay, VPN or VM network conflicts detected\n")
+		} else {
+			printHostConflicts(conflicts)
+			problems += len(conflicts)
+		}
+
+		if problems > 0 {
+			fmt.Fprintf(stdout, "\nFound %d issue(s)\n", problems)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Exit codes, a stable contract for scripts
+const (
+	ExitOK         = 0 // success
+	ExitError      = 1 // any other failure
+	ExitUsage      = 2 // invalid command line
+	ExitNotRunning = 3 // NAT is not running
+	ExitPermission = 4 // root privileges or file permissions missing
+	ExitConflict   = 5 // already running, or resources owned by another instance
+)
+
+// quiet suppresses decorative output
+var quiet bool
+
+// exitError is an error with a specific exit code. An error with an empty
+// message is not printed.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return ""
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// exitWith returns err with an exit code, or a silent error if err is nil
+func exitWith(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
+// ExitCode returns the process exit code for an error returned by Execute
+func ExitCode(err error) int {
+	var exit *exitError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &exit):
+		return exit.code
+	case errors.Is(err, nat.ErrNotRunning):
+		return ExitNotRunning
+	case errors.Is(err, nat.ErrConflict):
+		return ExitConflict
+	case errors.Is(err, fs.ErrPermission):
+		return ExitPermission
+	}
+	return ExitError
+}
+
+// stdout receives decorative output: messages, tables and status. Data a
+// command produces, such as archives, exports and configuration files,
+// goes to os.Stdout so that it is written with --quiet too.
+var stdout io.Writer = os.Stdout
+
+// silenceOutput discards decorative output when --quiet is set. Errors and
+// JSON or YAML output are still written.
+func silenceOutput() {
+	if quiet && outputFormat == outputTable {
+		stdout = io.Discard
+	}
+}
+
+// usageError marks flag parsing errors as usage errors
+func usageError(_ *cobra.Command, err error) error {
+	return exitWith(ExitUsage, err)
+}
+
+// usageArgs marks the argument errors of cmd and its subcommands as usage
+// errors, wrapping their Args validators
+func usageArgs(cmd *cobra.Command) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(cmd *cobra.Command, args []string) error {
+			if err := validate(cmd, args); err != nil {
+				return exitWith(ExitUsage, err)
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		usageArgs(sub)
+	}
+}
+
+// unknownCommand marks cobra's error for an unknown subcommand, which it
+// returns before any validator runs, as a usage error
+func unknownCommand(err error) error {
+	var exit *exitError
+	if err != nil && !errors.As(err, &exit) && strings.HasPrefix(err.Error(), "unknown command ") {
+		return exitWith(ExitUsage, err)
+	}
+	return err
+}
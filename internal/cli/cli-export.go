@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Formats of monitor --export
+const (
+	exportNDJSON = "ndjson"
+	exportCSV    = "csv"
+)
+
+// connectionRecord is a connection as seen in one monitor snapshot
+type connectionRecord struct {
+	Time time.Time `json:"time"`
+	nat.Connection
+}
+
+// connectionExporter writes connection records as NDJSON or CSV
+type connectionExporter struct {
+	json    *json.Encoder
+	csv     *csv.Writer
+	started bool
+}
+
+func newConnectionExporter(w io.Writer, format string) *connectionExporter {
+	if format == exportCSV {
+		return &connectionExporter{csv: csv.NewWriter(w)}
+	}
+	return &connectionExporter{json: json.NewEncoder(w)}
+}
+
+// Write writes a record per connection of a snapshot taken at
+func (e *connectionExporter) Write(at time.Time, connections []nat.Connection) error {
+	if e.csv == nil {
+		for _, conn := range connections {
+			if err := e.json.Encode(connectionRecord{Time: at, Connection: conn}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !e.started {
+		e.started = true
+		if err := e.csv.Write([]string{"time", "protocol", "source", "destination", "state", "bytes", "age_seconds"}); err != nil {
+			return err
+		}
+	}
+	for _, conn := range connections {
+		if err := e.csv.Write([]string{
+			at.Format(time.RFC3339),
+			conn.Protocol,
+			conn.Source,
+			conn.Destination,
+			conn.State,
+			strconv.FormatUint(conn.Bytes, 10),
+			strconv.FormatFloat(conn.Age.Seconds(), 'f', 0, 64),
+		}); err != nil {
+			return err
+		}
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+// runExport exports the connections of one snapshot, or of a snapshot every
+// --interval with --follow until interrupted
+func runExport(manager *nat.Manager) error {
+	out := io.Writer(os.Stdout)
+	if exportFile != "" && exportFile != "-" {
+		file, err := os.OpenFile(exportFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer func() { _ = file.Close() }()
+		out = file
+	}
+	exporter := newConnectionExporter(out, exportFormat)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		status, err := manager.GetStatus()
+		if err != nil {
+			return fmt.Errorf("failed to get status: %w", err)
+		}
+		useStateConnections(manager, status)
+		if err := exporter.Write(time.Now(), monitorConnections(status)); err != nil {
+			return fmt.Errorf("failed to export connections: %w", err)
+		}
+		if !followMode {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/flow"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// flowCmd represents the flow command
+var flowCmd = &cobra.Command{
+	Use:   "flow",
+	Short: "Export NAT sessions to a NetFlow v9 or IPFIX collector",
+	Long: `Export the NAT sessions of the instance, read from the pf state table, as
+flow records to a NetFlow v9 or IPFIX collector over UDP, so NAT'd traffic
+shows up in existing network observability tools. Once flow_export.enabled
+is set, 'start --foreground' and the daemon export on their own.
+
+Each record carries the internal address and port, the address and port
+after translation, the destination, the protocol, the bytes and packets of
+both directions and the start and end of the traffic reported. Sessions are
+reported when their state goes away and, while they last, every
+flow_export.active_timeout (1m). The state table is read every
+flow_export.interval (10s). Every packet carries the template.
+
+IPFIX is sent to port 4739 and NetFlow v9 to port 2055 unless the collector
+names a port.
+
+Example:
+  nat-manager config set flow_export.collector 10.0.0.5
+  nat-manager config set flow_export.protocol netflow9
+  nat-manager config set flow_export.enabled true
+  sudo nat-manager flow run`,
+}
+
+// flowRunCmd represents the flow run command
+var flowRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Keep exporting until interrupted",
+	Long: `Keep exporting the NAT sessions until interrupted, for NAT that is not run
+by 'start --foreground' or the daemon, which export on their own. The
+sessions still open are reported when it stops.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if cfg.FlowExport.Collector == "" {
+			return exitWith(ExitUsage, fmt.Errorf("no collector set (use 'nat-manager config set flow_export.collector HOST[:PORT]')"))
+		}
+		exporter, err := flow.Dial(cfg.FlowOptions())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = exporter.Close() }()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		manager := nat.NewManager(cfg.ToNATConfig())
+		fmt.Fprintf(stdout, "📤 Exporting flows to %s - press Ctrl+C to stop\n", cfg.FlowExport.Collector)
+		exporter.Run(ctx, manager.NATConnections, func(err error) {
+			logging.Component(logging.NAT).Warn("flow export failed", "error", err)
+		})
+		return nil
+	},
+}
+
+// startFlowExport exports the NAT sessions of manager's instance in the
+// background until ctx is done, when enabled
+func startFlowExport(ctx context.Context, cfg *config.Config, manager *nat.Manager) {
+	if !cfg.FlowExport.Enabled {
+		return
+	}
+	exporter, err := flow.Dial(cfg.FlowOptions())
+	if err != nil {
+		logging.Component(logging.NAT).Warn("flow export disabled", "error", err)
+		return
+	}
+	go func() {
+		defer func() { _ = exporter.Close() }()
+		exporter.Run(ctx, manager.NATConnections, func(err error) {
+			logging.Component(logging.NAT).Warn("flow export failed", "error", err)
+		})
+	}()
+	fmt.Fprintf(stdout, "📤 Exporting flows to %s\n", cfg.FlowExport.Collector)
+}
+
+func init() {
+	rootCmd.AddCommand(flowCmd)
+	flowCmd.AddCommand(flowRunCmd)
+}
@@ -0,0 +1,273 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var (
+	forwardProto       string
+	forwardPort        int
+	forwardTo          string
+	forwardDescription string
+	forwardFile        string
+	forwardMerge       bool
+	forwardDryRun      bool
+)
+
+// portForwardCmd represents the port-forward command
+var portForwardCmd = &cobra.Command{
+	Use:     "port-forward",
+	Aliases: []string{"forward"},
+	Short:   "Manage port forwards to internal devices",
+	Long: `Manage port forwards from the external interface to devices on the
+internal network.
+
+Example:
+  nat-manager port-forward list
+  nat-manager port-forward add --port 8080 --to 192.168.100.50:80
+  nat-manager port-forward remove 8080
+  nat-manager port-forward apply --file forwards.yaml`,
+}
+
+// portForwardListCmd represents the port-forward list command
+var portForwardListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List port forwards",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		if outputFormat != outputTable {
+			forwards := cfg.PortForwards
+			if forwards == nil {
+				forwards = []config.PortForward{}
+			}
+			return writeOutput(os.Stdout, outputFormat, forwards)
+		}
+
+		if len(cfg.PortForwards) == 0 {
+			fmt.Fprintf(stdout, "No port forwards configured\n")
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "%-8s %-8s %-22s %s\n", "PROTO", "PORT", "TARGET", "DESCRIPTION")
+		fmt.Fprintf(stdout, "%-8s %-8s %-22s %s\n",
+			strings.Repeat("-", 8),
+			strings.Repeat("-", 8),
+			strings.Repeat("-", 22),
+			strings.Repeat("-", 11))
+		for _, f := range cfg.PortForwards {
+			fmt.Fprintf(stdout, "%-8s %-8d %-22s %s\n", f.Protocol, f.ExternalPort,
+				net.JoinHostPort(f.InternalIP, strconv.Itoa(f.InternalPort)), f.Description)
+		}
+		return nil
+	},
+}
+
+// portForwardAddCmd represents the port-forward add command
+var portForwardAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a port forward",
+	Long: `Forward an external port to a device on the internal network.
+
+Example:
+  nat-manager port-forward add --port 8080 --to 192.168.100.50:80
+  nat-manager port-forward add --proto udp --port 51820 --to 192.168.100.60`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		forward, err := parseForwardFlags()
+		if err != nil {
+			return err
+		}
+
+		return updatePortForwards(func(cfg *config.Config) {
+			cfg.PortForwards = append(cfg.PortForwards, forward)
+		})
+	},
+}
+
+// portForwardRemoveCmd represents the port-forward remove command
+var portForwardRemoveCmd = &cobra.Command{
+	Use:   "remove <external-port>...",
+	Short: "Remove port forwards by external port",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		ports := make(map[int]bool)
+		for _, arg := range args {
+			port, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("invalid port %q", arg)
+			}
+			ports[port] = true
+		}
+
+		return updatePortForwards(func(cfg *config.Config) {
+			kept := make([]config.PortForward, 0, len(cfg.PortForwards))
+			for _, f := range cfg.PortForwards {
+				if !ports[f.ExternalPort] {
+					kept = append(kept, f)
+				}
+			}
+			cfg.PortForwards = kept
+		})
+	},
+}
+
+// portForwardApplyCmd represents the port-forward apply command
+var portForwardApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Apply a batch of port forwards from a YAML file",
+	Long: `Apply a batch of port forwards from a YAML file.
+
+The file is either a list of forwards or a document with a port_forwards key:
+
+  - protocol: tcp
+    external_port: 8080
+    internal_ip: 192.168.100.50
+    internal_port: 80
+    description: web
+
+By default the file replaces all configured forwards; --merge keeps existing
+forwards and replaces only those on the same protocol and external port.
+Every entry is validated before anything changes and the batch is applied
+with a single pf anchor reload.
+
+Example:
+  nat-manager port-forward apply --file forwards.yaml
+  nat-manager port-forward apply --file forwards.yaml --merge --dry-run`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if forwardFile == "" {
+			return fmt.Errorf("--file is required")
+		}
+		forwards, err := loadForwardsFile(forwardFile)
+		if err != nil {
+			return err
+		}
+
+		return updatePortForwards(func(cfg *config.Config) {
+			if forwardMerge {
+				cfg.PortForwards = mergeForwards(cfg.PortForwards, forwards)
+			} else {
+				cfg.PortForwards = forwards
+			}
+		})
+	},
+}
+
+// parseForwardFlags builds a port forward from the add flags
+func parseForwardFlags() (config.PortForward, error) {
+	host, portStr, err := net.SplitHostPort(forwardTo)
+	if err != nil {
+		host, portStr = forwardTo, strconv.Itoa(forwardPort)
+	}
+	internalPort, err := strconv.Atoi(portStr)
+	if err != nil {
+		return config.PortForward{}, fmt.Errorf("invalid target port in %q", forwardTo)
+	}
+
+	return config.PortForward{
+		Protocol:     forwardProto,
+		ExternalPort: forwardPort,
+		InternalIP:   host,
+		InternalPort: internalPort,
+		Description:  forwardDescription,
+	}, nil
+}
+
+// loadForwardsFile reads a list of forwards or a port_forwards document
+func loadForwardsFile(path string) ([]config.PortForward, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var doc struct {
+		PortForwards []config.PortForward `yaml:"port_forwards"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err == nil && len(doc.PortForwards) > 0 {
+		return doc.PortForwards, nil
+	}
+
+	var forwards []config.PortForward
+	if err := yaml.Unmarshal(data, &forwards); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return forwards, nil
+}
+
+// mergeForwards overlays forwards onto existing, replacing entries that use
+// the same protocol and external port
+func mergeForwards(existing, forwards []config.PortForward) []config.PortForward {
+	merged := make([]config.PortForward, 0, len(existing)+len(forwards))
+	for _, e := range existing {
+		replaced := false
+		for _, f := range forwards {
+			if e.Protocol == f.Protocol && e.ExternalPort == f.ExternalPort {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, e)
+		}
+	}
+	return append(merged, forwards...)
+}
+
+// updatePortForwards applies update to the configured forwards, validates the
+// result as a whole and saves and applies it
+func updatePortForwards(update func(*config.Config)) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	before := len(cfg.PortForwards)
+	update(cfg)
+
+	if forwardDryRun {
+		if err := nat.ValidatePortForwards(cfg.NATPortForwards(), cfg.InternalNetwork); err != nil {
+			return fmt.Errorf("validation failed:\n%w", err)
+		}
+		fmt.Fprintf(stdout, "✅ %d port forwards valid (dry run, nothing applied)\n", len(cfg.PortForwards))
+		return nil
+	}
+
+	if err := saveAndApplyRules(cfg); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "✅ Port forwards updated (%d → %d)\n", before, len(cfg.PortForwards))
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(portForwardCmd)
+	portForwardCmd.AddCommand(portForwardListCmd)
+	portForwardCmd.AddCommand(portForwardAddCmd)
+	portForwardCmd.AddCommand(portForwardRemoveCmd)
+	portForwardCmd.AddCommand(portForwardApplyCmd)
+
+	portForwardAddCmd.Flags().StringVar(&forwardProto, "proto", "tcp", "protocol: tcp, udp or tcp/udp")
+	portForwardAddCmd.Flags().IntVarP(&forwardPort, "port", "p", 0, "external port")
+	portForwardAddCmd.Flags().StringVar(&forwardTo, "to", "", "internal target IP[:port] (port defaults to --port)")
+	_ = portForwardAddCmd.RegisterFlagCompletionFunc("to", completeLeaseIPs)
+	portForwardAddCmd.Flags().StringVarP(&forwardDescription, "description", "d", "", "description")
+	_ = portForwardAddCmd.MarkFlagRequired("port")
+	_ = portForwardAddCmd.MarkFlagRequired("to")
+
+	portForwardApplyCmd.Flags().StringVarP(&forwardFile, "file", "f", "", "YAML file of port forwards")
+	portForwardApplyCmd.Flags().BoolVar(&forwardMerge, "merge", false, "merge with existing forwards instead of replacing them")
+	portForwardApplyCmd.Flags().BoolVar(&forwardDryRun, "dry-run", false, "validate the batch without applying it")
+}
@@ -0,0 +1,287 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/helper"
+	"github.com/scttfrdmn/macos-nat-manager/internal/launchd"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// helperAnnotation marks commands that run without root
+const helperAnnotation = "helper"
+
+// Values of helperAnnotation
+const (
+	helperRequired = "required" // without root, runs through the helper
+	helperNone     = "none"     // needs neither root nor the helper
+)
+
+var (
+	helperGroup string
+
+	// helperClient talks to the instance's helper when running without
+	// root and a helper is listening, nil otherwise
+	helperClient *helper.Client
+)
+
+// HelperStatus is the state of the instance's privileged helper
+type HelperStatus struct {
+	Instance  string `json:"instance"`
+	Installed bool   `json:"installed"`
+	Plist     string `json:"plist,omitempty"`
+	PID       int    `json:"pid,omitempty"`
+	Socket    string `json:"socket"`
+	Reachable bool   `json:"reachable"`
+	Log       string `json:"log"`
+}
+
+// helperCmd represents the helper command
+var helperCmd = &cobra.Command{
+	Use:   "helper",
+	Short: "Monitor and control NAT without sudo through a privileged helper",
+	Long: `Install a small helper LaunchDaemon that runs as root and owns pfctl,
+ifconfig, sysctl and dnsmasq, and serves the REST API on a Unix domain
+socket. Without sudo, status, devices, connections, connections kill, stop
+and the TUI then talk to the helper instead of failing.
+
+The socket is only readable and writable by root and the admin group
+(--group), and the helper checks the credentials of every connecting
+process: only root and members of the group are served. Every request is
+recorded in the audit log with the name of the user who made it.
+
+Example:
+  sudo nat-manager helper install
+  sudo nat-manager helper install --group staff
+  nat-manager helper status
+  nat-manager status          # no sudo needed once the helper runs
+  sudo nat-manager helper uninstall`,
+}
+
+// helperInstallCmd represents the helper install command
+var helperInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install and start the helper LaunchDaemon",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		job, err := helperJob()
+		if err != nil {
+			return err
+		}
+		path, err := launchd.Install(job)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Helper installed (%s)\n", path)
+		fmt.Fprintf(stdout, "   Socket: %s\n", helper.SocketPath(config.Instance()))
+		fmt.Fprintf(stdout, "   Log: %s\n", job.LogPath)
+		return nil
+	},
+}
+
+// helperUninstallCmd represents the helper uninstall command
+var helperUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop the helper and remove its LaunchDaemon",
+	Long: `Unload the helper's LaunchDaemon and remove its plist and socket. NAT
+keeps running; commands need sudo again.`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if !launchd.Installed(helperLabel()) {
+			fmt.Fprintf(stdout, "Helper is not installed\n")
+			return nil
+		}
+		if err := launchd.Uninstall(helperLabel()); err != nil {
+			return err
+		}
+		if err := os.Remove(helper.SocketPath(config.Instance())); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove helper socket: %w", err)
+		}
+		fmt.Fprintf(stdout, "✅ Helper removed\n")
+		return nil
+	},
+}
+
+// helperStatusCmd represents the helper status command
+var helperStatusCmd = &cobra.Command{
+	Use:         "status",
+	Short:       "Show whether the helper is installed and reachable",
+	Annotations: map[string]string{helperAnnotation: helperNone},
+	RunE: func(_ *cobra.Command, _ []string) error {
+		status, err := helperStatus()
+		if err != nil {
+			return err
+		}
+		if outputFormat != outputTable {
+			return writeOutput(os.Stdout, outputFormat, status)
+		}
+
+		if !status.Installed {
+			fmt.Fprintf(stdout, "Helper is not installed (run 'sudo nat-manager helper install')\n")
+			return nil
+		}
+		running := "not running"
+		if status.PID > 0 {
+			running = fmt.Sprintf("running (PID %d)", status.PID)
+		}
+		reachable := "not reachable by you"
+		if status.Reachable {
+			reachable = "reachable"
+		}
+		fmt.Fprintf(stdout, "Helper:   %s\n", running)
+		fmt.Fprintf(stdout, "Socket:   %s (%s)\n", status.Socket, reachable)
+		fmt.Fprintf(stdout, "Plist:    %s\n", status.Plist)
+		fmt.Fprintf(stdout, "Log:      %s\n", status.Log)
+		return nil
+	},
+}
+
+// helperRunCmd represents the helper run command, which launchd runs
+var helperRunCmd = &cobra.Command{
+	Use:    "run",
+	Short:  "Run the helper in the foreground (used by launchd)",
+	Hidden: true,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		auditLog := openAuditLog()
+		defer func() { _ = auditLog.Close() }()
+		socket := helper.SocketPath(config.Instance())
+		server, err := helper.New(&restController{}, helper.Config{
+			Socket: socket,
+			Group:  helperGroup,
+			Audit:  auditLog,
+		})
+		if err != nil {
+			return err
+		}
+		listener, err := server.Listen()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.Remove(socket) }()
+		fmt.Fprintf(stdout, "🔐 Helper listening on %s\n", socket)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return server.Serve(ctx, listener)
+	},
+}
+
+// connectHelper sets helperClient when running without root and the
+// instance's helper lets the current user connect, and reports whether it
+// did
+func connectHelper() bool {
+	socket := helper.SocketPath(config.Instance())
+	if os.Geteuid() == 0 || !helper.Available(socket) {
+		return false
+	}
+	helperClient = helper.NewClient(socket)
+	return true
+}
+
+// runsWithoutRoot reports whether the command line runs a command that
+// works without root, connecting to the helper if the command needs it
+func runsWithoutRoot() bool {
+	cmd, _, err := rootCmd.Find(os.Args[1:])
+	if err != nil {
+		return false
+	}
+	if cmd == monitorCmd && (replayFile != "" || simulate) {
+		return true // plays a session, NAT is not touched
+	}
+	switch cmd.Annotations[helperAnnotation] {
+	case helperNone:
+		return true
+	case helperRequired:
+		return connectHelper()
+	}
+	return false
+}
+
+// helperLabel returns the launchd label of the instance's helper
+func helperLabel() string {
+	return launchd.LabelPrefix + "helper." + config.Instance()
+}
+
+// helperLogPath returns the log file of the instance's helper
+func helperLogPath() (string, error) {
+	dir, err := config.BaseDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(dir, "helper.log"), nil
+}
+
+// helperJob returns the LaunchDaemon running the helper at boot and again
+// whenever it exits
+func helperJob() (launchd.Job, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return launchd.Job{}, fmt.Errorf("failed to locate nat-manager: %w", err)
+	}
+	logPath, err := helperLogPath()
+	if err != nil {
+		return launchd.Job{}, err
+	}
+
+	program := []string{exe}
+	if instance := config.Instance(); instance != nat.DefaultInstance {
+		program = append(program, "--instance", instance)
+	}
+	if profile := config.Profile(); profile != "" {
+		program = append(program, "--profile", profile)
+	}
+	program = append(program, "helper", "run")
+	if helperGroup != "" {
+		program = append(program, "--group", helperGroup)
+	}
+	return launchd.Job{
+		Label:       helperLabel(),
+		Program:     program,
+		RunAtLoad:   true,
+		KeepAlive:   true,
+		Environment: map[string]string{"HOME": os.Getenv("HOME")},
+		LogPath:     logPath,
+	}, nil
+}
+
+// helperStatus reports the instance's helper
+func helperStatus() (HelperStatus, error) {
+	logPath, err := helperLogPath()
+	if err != nil {
+		return HelperStatus{}, err
+	}
+	socket := helper.SocketPath(config.Instance())
+	status := HelperStatus{
+		Instance:  config.Instance(),
+		Socket:    socket,
+		Reachable: helper.Available(socket),
+		Log:       logPath,
+	}
+	if !launchd.Installed(helperLabel()) {
+		return status, nil
+	}
+	status.Installed = true
+	if status.Plist, err = launchd.PlistPath(helperLabel()); err != nil {
+		return HelperStatus{}, fmt.Errorf("failed to get launchd plist path: %w", err)
+	}
+	status.PID = launchd.PID(helperLabel())
+	return status, nil
+}
+
+func init() {
+	rootCmd.AddCommand(helperCmd)
+	helperCmd.AddCommand(helperInstallCmd)
+	helperCmd.AddCommand(helperUninstallCmd)
+	helperCmd.AddCommand(helperStatusCmd)
+	helperCmd.AddCommand(helperRunCmd)
+
+	for _, cmd := range []*cobra.Command{helperInstallCmd, helperRunCmd} {
+		cmd.Flags().StringVar(&helperGroup, "group", "", fmt.Sprintf("group allowed to use the helper besides root (default %q)", helper.DefaultGroup))
+	}
+}
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/influx"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// influxCmd represents the influx command
+var influxCmd = &cobra.Command{
+	Use:   "influx",
+	Short: "Push metrics in the InfluxDB line protocol",
+	Long: `Push the traffic, device and DNS metrics of the instance in the InfluxDB
+line protocol, to InfluxDB over HTTP or to a Telegraf socket listener.
+Once influx.enabled is set, 'start --foreground' and the daemon push the
+NAT and device metrics, and 'dns serve' the DNS metrics, every
+influx.interval (30s).
+
+influx.url selects the destination:
+
+  http://HOST:8086, https://...   InfluxDB 2 with influx.bucket, influx.org
+                                  and influx.token, or InfluxDB 1 with
+                                  influx.database
+  udp://HOST:PORT, tcp://...      a Telegraf socket_listener
+  unix:///PATH                    a Telegraf socket_listener on a Unix socket
+
+Measurements, tagged with the instance:
+
+  nat_manager              active, external_ip, devices, devices_online,
+                           connections, bytes_in/out, rate_in/out
+  nat_manager_device       online, bytes_in/out, packets_in/out, tagged
+                           with mac, ip and name
+  nat_manager_dns          queries, cache_hits, cache_misses, cache_entries,
+                           local, blocked, fallbacks, upstream_errors,
+                           upstream_latency_ms
+  nat_manager_dns_queries  queries, tagged with the query type
+
+Example:
+  nat-manager config set influx.url http://influx.local:8086
+  nat-manager config set influx.org home
+  nat-manager config set influx.bucket nat
+  nat-manager config set influx.token s3cret
+  nat-manager config set influx.enabled true
+  sudo nat-manager influx write`,
+}
+
+// influxWriteCmd represents the influx write command
+var influxWriteCmd = &cobra.Command{
+	Use:   "write",
+	Short: "Push the NAT and device metrics once",
+	Long: `Push the NAT and device metrics once, e.g. to check the influx settings.
+With --dry-run the lines are printed instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, writer, err := newInfluxWriter()
+		if err != nil {
+			return err
+		}
+		points, err := natPoints(nat.NewManager(cfg.ToNATConfig()))(time.Now())
+		if err != nil {
+			return err
+		}
+		if influxDryRun {
+			fmt.Fprint(os.Stdout, string(influx.Encode(points)))
+			return nil
+		}
+		if err := writer.Write(context.Background(), points); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Wrote %d points to %s\n", len(points), cfg.Influx.URL)
+		return nil
+	},
+}
+
+// influxRunCmd represents the influx run command
+var influxRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Keep pushing until interrupted",
+	Long: `Keep pushing the NAT and device metrics every influx.interval until
+interrupted, for NAT that is not run by 'start --foreground' or the
+daemon, which push on their own.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, writer, err := newInfluxWriter()
+		if err != nil {
+			return err
+		}
+		interval, err := cfg.Influx.GetInterval()
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Fprintf(stdout, "📈 Pushing metrics to %s - press Ctrl+C to stop\n", cfg.Influx.URL)
+		influx.Run(ctx, writer, interval, natPoints(nat.NewManager(cfg.ToNATConfig())), func(err error) {
+			logging.Component(logging.Events).Warn("InfluxDB write failed", "error", err)
+		})
+		return nil
+	},
+}
+
+var influxDryRun bool
+
+// newInfluxWriter returns the metrics writer of the instance
+func newInfluxWriter() (*config.Config, *influx.Writer, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Influx.URL == "" {
+		return nil, nil, exitWith(ExitUsage, fmt.Errorf("no url set (use 'nat-manager config set influx.url http://HOST:8086')"))
+	}
+	writer, err := influx.New(cfg.InfluxOptions())
+	if err != nil {
+		return nil, nil, exitWith(ExitUsage, err)
+	}
+	return cfg, writer, nil
+}
+
+// natPoints collects the NAT and device metrics of manager's instance
+func natPoints(manager *nat.Manager) func(time.Time) ([]influx.Point, error) {
+	source := managerSource{manager}
+	return func(now time.Time) ([]influx.Point, error) {
+		status, err := source.Status()
+		if err != nil {
+			return nil, err
+		}
+		devices, err := source.Devices()
+		if err != nil {
+			return nil, err
+		}
+		traffic, _ := source.Traffic()
+		return influx.NATPoints(config.Instance(), status, devices, traffic, now), nil
+	}
+}
+
+// startInflux pushes the metrics collected in the background until ctx is
+// done, when enabled
+func startInflux(ctx context.Context, cfg *config.Config, collect func(time.Time) ([]influx.Point, error)) {
+	if !cfg.Influx.Enabled {
+		return
+	}
+	interval, err := cfg.Influx.GetInterval()
+	if err != nil {
+		logging.Component(logging.Events).Warn("InfluxDB metrics disabled", "error", err)
+		return
+	}
+	writer, err := influx.New(cfg.InfluxOptions())
+	if err != nil {
+		logging.Component(logging.Events).Warn("InfluxDB metrics disabled", "error", err)
+		return
+	}
+	go influx.Run(ctx, writer, interval, collect, func(err error) {
+		logging.Component(logging.Events).Warn("InfluxDB write failed", "error", err)
+	})
+	fmt.Fprintf(stdout, "📈 Pushing metrics to %s\n", cfg.Influx.URL)
+}
+
+func init() {
+	rootCmd.AddCommand(influxCmd)
+	influxCmd.AddCommand(influxWriteCmd)
+	influxCmd.AddCommand(influxRunCmd)
+
+	influxWriteCmd.Flags().BoolVar(&influxDryRun, "dry-run", false, "print the lines instead of writing them")
+}
@@ -3,6 +3,9 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -11,8 +14,10 @@ import (
 )
 
 var (
-	showAll    bool
-	filterType string
+	showAll            bool
+	filterType         string
+	externalCandidates bool
+	internalCandidates bool
 )
 
 // interfacesCmd represents the interfaces command
@@ -22,13 +27,23 @@ var interfacesCmd = &cobra.Command{
 	Short:   "List available network interfaces",
 	Long: `List all available network interfaces on the system.
 
-This shows interfaces that can be used for NAT configuration,
-including their current status, IP addresses, and types.
+This shows interfaces that can be used for NAT configuration, including
+their status, IP and MAC addresses, MTU, link speed and type. FLAGS marks
+the interface holding the default route and those configured by DHCP,
+which are the usual external interface candidates.
 
 Example:
   nat-manager interfaces
   nat-manager interfaces --all          # Show all interfaces including loopback
-  nat-manager interfaces --type bridge  # Filter by interface type`,
+  nat-manager interfaces --type bridge  # Filter by interface type
+  nat-manager interfaces --external-candidates
+  nat-manager interfaces -o json
+
+Loopback, AirDrop (awdl, llw) and down interfaces are hidden unless --all
+is given. --external-candidates lists the Ethernet and Wi-Fi interfaces
+with an IPv4 address, the one holding the default route first;
+--internal-candidates lists bridges and Ethernet interfaces that are up
+without an address.`,
 	RunE: func(_ *cobra.Command, _ []string) error {
 		// Create a temporary manager to get interfaces
 		manager := nat.NewManager(nil)
@@ -37,38 +52,36 @@ Example:
 			return fmt.Errorf("failed to list interfaces: %w", err)
 		}
 
-		// Filter by type if specified
-		if filterType != "" {
-			filtered := make([]nat.NetworkInterface, 0)
-			for _, iface := range interfaces {
-				if strings.EqualFold(iface.Type, filterType) {
-					filtered = append(filtered, iface)
-				}
-			}
-			interfaces = filtered
+		interfaces = selectInterfaces(interfaces)
+
+		if outputFormat != outputTable {
+			return writeOutput(os.Stdout, outputFormat, interfaces)
 		}
 
 		if len(interfaces) == 0 {
-			fmt.Printf("No interfaces found\n")
+			fmt.Fprintf(stdout, "No interfaces found\n")
 			return nil
 		}
 
 		// Print header
-		fmt.Printf("%-12s %-10s %-15s %-8s %s\n", "INTERFACE", "TYPE", "IP ADDRESS", "STATUS", "DESCRIPTION")
-		fmt.Printf("%-12s %-10s %-15s %-8s %s\n",
+		format := "%-12s %-10s %-15s %-17s %-5s %-10s %-8s %-14s %s\n"
+		fmt.Fprintf(stdout, format, "INTERFACE", "TYPE", "IP ADDRESS", "MAC", "MTU", "SPEED", "STATUS", "FLAGS", "DESCRIPTION")
+		fmt.Fprintf(stdout, format,
 			strings.Repeat("-", 12),
 			strings.Repeat("-", 10),
 			strings.Repeat("-", 15),
+			strings.Repeat("-", 17),
+			strings.Repeat("-", 5),
+			strings.Repeat("-", 10),
 			strings.Repeat("-", 8),
+			strings.Repeat("-", 14),
 			strings.Repeat("-", 20))
 
 		// Print interfaces
 		for _, iface := range interfaces {
-			status := "Down"
-			statusIcon := "❌"
-			if iface.Status == "Up" {
-				status = "Up"
-				statusIcon = "✅"
+			status := "❌ Down"
+			if strings.EqualFold(iface.Status, "up") {
+				status = "✅ Up"
 			}
 
 			ip := iface.IP
@@ -76,26 +89,98 @@ Example:
 				ip = "N/A"
 			}
 
-			description := getInterfaceDescription(iface)
-
-			fmt.Printf("%-12s %-10s %-15s %s%-7s %s\n",
+			fmt.Fprintf(stdout, "%-12s %-10s %-15s %-17s %-5d %-10s %-9s %-14s %s\n",
 				iface.Name,
 				iface.Type,
 				ip,
-				statusIcon,
+				orDash(iface.MAC),
+				iface.MTU,
+				formatLinkSpeed(iface.LinkSpeed),
 				status,
-				description)
+				orDash(interfaceFlags(iface)),
+				getInterfaceDescription(iface))
 		}
 
-		fmt.Printf("\nSuitable for:\n")
-		fmt.Printf("  External: Interfaces with internet connectivity (en0, en1, etc.)\n")
-		fmt.Printf("  Internal: Bridge interfaces for NAT (bridge100, bridge101, etc.)\n")
-		fmt.Printf("\nNote: Bridge interfaces will be created automatically if they don't exist\n")
+		fmt.Fprintf(stdout, "\nSuitable for:\n")
+		fmt.Fprintf(stdout, "  External: Interfaces with internet connectivity, usually the one flagged default\n")
+		fmt.Fprintf(stdout, "  Internal: Bridge interfaces for NAT (bridge100, bridge101, etc.)\n")
+		fmt.Fprintf(stdout, "\nNote: Bridge interfaces will be created automatically if they don't exist\n")
 
 		return nil
 	},
 }
 
+// selectInterfaces applies --all, --type and the candidate filters
+func selectInterfaces(interfaces []nat.NetworkInterface) []nat.NetworkInterface {
+	selected := make([]nat.NetworkInterface, 0, len(interfaces))
+	for _, iface := range interfaces {
+		switch {
+		case externalCandidates && !isExternalCandidate(iface),
+			internalCandidates && !isInternalCandidate(iface),
+			!externalCandidates && !internalCandidates && !showAll && isHiddenInterface(iface),
+			filterType != "" && !strings.EqualFold(iface.Type, filterType):
+			continue
+		}
+		selected = append(selected, iface)
+	}
+	if externalCandidates {
+		sort.SliceStable(selected, func(i, j int) bool { return selected[i].DefaultRoute && !selected[j].DefaultRoute })
+	}
+	return selected
+}
+
+// isHiddenInterface reports whether an interface is listed only with
+// --all: loopback, AirDrop and down interfaces
+func isHiddenInterface(iface nat.NetworkInterface) bool {
+	for _, prefix := range []string{"lo", "awdl", "llw"} {
+		if strings.HasPrefix(iface.Name, prefix) {
+			return true
+		}
+	}
+	return !strings.EqualFold(iface.Status, "up")
+}
+
+// isExternalCandidate reports whether an interface can be the uplink: an
+// Ethernet or Wi-Fi interface that is up with an IPv4 address
+func isExternalCandidate(iface nat.NetworkInterface) bool {
+	return strings.HasPrefix(iface.Name, "en") && !isHiddenInterface(iface) && iface.IP != ""
+}
+
+// isInternalCandidate reports whether an interface can serve the internal
+// network: a bridge, or an Ethernet interface that is up without an address
+func isInternalCandidate(iface nat.NetworkInterface) bool {
+	if strings.HasPrefix(iface.Name, "bridge") {
+		return !iface.DefaultRoute
+	}
+	return strings.HasPrefix(iface.Name, "en") && !isHiddenInterface(iface) && iface.IP == "" && !iface.DefaultRoute
+}
+
+// interfaceFlags lists whether an interface holds the default route and
+// was configured by DHCP
+func interfaceFlags(iface nat.NetworkInterface) string {
+	var flags []string
+	if iface.DefaultRoute {
+		flags = append(flags, "default")
+	}
+	if iface.DHCP {
+		flags = append(flags, "dhcp")
+	}
+	return strings.Join(flags, ",")
+}
+
+// formatLinkSpeed renders a link speed in bits per second, "-" if unknown
+func formatLinkSpeed(bps uint64) string {
+	switch {
+	case bps == 0:
+		return "-"
+	case bps >= 1e9:
+		return strconv.FormatFloat(float64(bps)/1e9, 'f', -1, 64) + " Gbps"
+	case bps >= 1e6:
+		return strconv.FormatFloat(float64(bps)/1e6, 'f', -1, 64) + " Mbps"
+	}
+	return strconv.FormatFloat(float64(bps)/1e3, 'f', -1, 64) + " Kbps"
+}
+
 func getInterfaceDescription(iface nat.NetworkInterface) string {
 	switch {
 	case strings.HasPrefix(iface.Name, "en"):
@@ -125,4 +210,7 @@ func init() {
 
 	interfacesCmd.Flags().BoolVarP(&showAll, "all", "a", false, "show all interfaces including loopback and inactive")
 	interfacesCmd.Flags().StringVarP(&filterType, "type", "t", "", "filter by interface type (ethernet, bridge, vpn, etc.)")
+	interfacesCmd.Flags().BoolVar(&externalCandidates, "external-candidates", false, "list interfaces suitable as the external interface")
+	interfacesCmd.Flags().BoolVar(&internalCandidates, "internal-candidates", false, "list interfaces suitable as the internal interface")
+	interfacesCmd.MarkFlagsMutuallyExclusive("external-candidates", "internal-candidates")
 }
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var lockdownFile string
+
+// lockdownCmd represents the lockdown command
+var lockdownCmd = &cobra.Command{
+	Use:   "lockdown",
+	Short: "Restrict clients to an allowlist of destinations",
+	Long: `Restrict internal clients to an explicit list of destinations, e.g.
+on exam, kiosk or device certification networks. Everything else clients
+send is dropped; the gateway itself and DHCP stay reachable.
+
+Destinations are IPv4 addresses, CIDRs or domain names. A domain also
+allows its subdomains: its addresses are resolved when the rules load and
+added to the pf table whenever the embedded DNS forwarder ('dns serve')
+answers for it, so enable dns_forwarder to follow changing addresses.
+
+Without a subcommand, shows the lockdown configuration.
+
+Example:
+  nat-manager lockdown allow exam.school.edu 10.20.0.0/16
+  nat-manager lockdown allow --file allowed.txt
+  nat-manager lockdown enable
+  nat-manager lockdown remove 10.20.0.0/16
+  nat-manager lockdown disable`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		fmt.Fprintf(stdout, "Lockdown: %s\n", formatBool(cfg.Lockdown.Enabled))
+		printList("Allowed Destinations", cfg.Lockdown.Allow)
+		if cfg.Lockdown.Enabled && !cfg.DNSForwarder.Enabled && hasDomains(cfg.Lockdown.Allow) {
+			fmt.Fprintf(stdout, "\n⚠️  Domains are only resolved when rules load; enable dns_forwarder to follow address changes\n")
+		}
+		return nil
+	},
+}
+
+var lockdownEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Drop traffic to destinations not on the allowlist",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return updateLockdown(func(l *config.LockdownConfig) { l.Enabled = true })
+	},
+}
+
+var lockdownDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Let clients reach any destination again",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		return updateLockdown(func(l *config.LockdownConfig) { l.Enabled = false })
+	},
+}
+
+var lockdownAllowCmd = &cobra.Command{
+	Use:   "allow [ip|cidr|domain]...",
+	Short: "Add destinations to the allowlist",
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateAllowedDestinations(args, config.AddItems)
+	},
+}
+
+var lockdownRemoveCmd = &cobra.Command{
+	Use:   "remove [ip|cidr|domain]...",
+	Short: "Remove destinations from the allowlist",
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateAllowedDestinations(args, config.RemoveItems)
+	},
+}
+
+// updateAllowedDestinations validates the batch, updates the allowlist and
+// applies it
+func updateAllowedDestinations(args []string, update func(list, items []string) []string) error {
+	if len(args) == 0 && lockdownFile == "" {
+		return fmt.Errorf("no destinations given")
+	}
+	dests, err := collectBatch(args, lockdownFile)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, dest := range dests {
+		errs = append(errs, nat.ValidateDestination(dest))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("no changes made:\n%w", err)
+	}
+
+	return updateLockdown(func(l *config.LockdownConfig) { l.Allow = update(l.Allow, dests) })
+}
+
+// updateLockdown changes the lockdown configuration and reloads the rules
+func updateLockdown(update func(*config.LockdownConfig)) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	update(&cfg.Lockdown)
+	if err := saveAndApplyRules(cfg); err != nil {
+		return err
+	}
+
+	state := "disabled"
+	if cfg.Lockdown.Enabled {
+		state = "enabled"
+	}
+	fmt.Fprintf(stdout, "✅ Lockdown %s (%d allowed destinations)\n", state, len(cfg.Lockdown.Allow))
+	return nil
+}
+
+// hasDomains reports whether any destination is a domain name
+func hasDomains(dests []string) bool {
+	for _, dest := range dests {
+		if net.ParseIP(dest) == nil {
+			if _, _, err := net.ParseCIDR(dest); err != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// allowResolved returns the forwarder hook adding answers for allowed
+// domains to the lockdown table. Addresses already added are skipped so
+// that cached answers do not run pfctl on every query.
+func allowResolved(manager *nat.Manager) func(string, []net.IP) {
+	var mu sync.Mutex
+	added := make(map[string]bool)
+	return func(name string, ips []net.IP) {
+		if !manager.GetConfig().Lockdown.AllowsName(name) {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		var fresh []net.IP
+		for _, ip := range ips {
+			if !added[ip.String()] {
+				fresh = append(fresh, ip)
+			}
+		}
+		if len(fresh) == 0 {
+			return
+		}
+		if err := manager.AllowResolved(name, fresh); err != nil {
+			logging.Component(logging.NAT).Warn("failed to allow resolved addresses", "name", name, "error", err)
+			return
+		}
+		for _, ip := range fresh {
+			added[ip.String()] = true
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(lockdownCmd)
+	lockdownCmd.AddCommand(lockdownEnableCmd)
+	lockdownCmd.AddCommand(lockdownDisableCmd)
+	lockdownCmd.AddCommand(lockdownAllowCmd)
+	lockdownCmd.AddCommand(lockdownRemoveCmd)
+
+	lockdownAllowCmd.Flags().StringVarP(&lockdownFile, "file", "f", "", "read destinations from file, one per line (- for stdin)")
+	lockdownRemoveCmd.Flags().StringVarP(&lockdownFile, "file", "f", "", "read destinations from file, one per line (- for stdin)")
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+)
+
+var (
+	logLevel string
+	logLines int
+	logPath  bool
+
+	// logCloser closes the log file once the command is done
+	logCloser io.Closer
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "Show the log of the instance",
+	Long: `Show the end of the instance's log. Long-running commands (start
+--foreground, the daemon, serve, dns serve) and background warnings of every
+command are logged to ~/Library/Logs/nat-manager/<instance>.log, rotated at
+logging.max_size (10MB by default) with five old files kept, as well as to
+stderr. Every record carries the component it comes from: nat, dhcp, dns,
+api or events (webhooks, notifications and MQTT).
+
+The level is set with --log-level or logging.level (debug, info, warn or
+error; info by default, debug with --verbose). The file is written as text
+or, with logging.format json, as one JSON object per line. With
+logging.os_log the records also go to the unified log, shown in Console.app,
+and with logging.syslog to a remote syslog server (udp://host[:port] or
+tcp://host[:port]). logging.audit sends the audit trail to them as well:
+every pf rule change, device block, NAT start and stop and API
+call, with component=audit, at info level whatever the log level.
+
+Example:
+  nat-manager logs
+  nat-manager logs -n 200
+  nat-manager config set logging.format json
+  nat-manager config set logging.syslog udp://logs.example.com:514
+  nat-manager config set logging.audit true
+  sudo nat-manager start --foreground --log-level debug
+  tail -f "$(nat-manager logs --path)"`,
+	Annotations: map[string]string{helperAnnotation: helperNone},
+	Args:        cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		path, err := config.GetLogPath()
+		if err != nil {
+			return fmt.Errorf("failed to get log path: %w", err)
+		}
+		if logPath {
+			fmt.Fprintln(os.Stdout, path)
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			fmt.Fprintf(stdout, "Nothing logged yet\n")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open log: %w", err)
+		}
+		defer func() { _ = file.Close() }()
+
+		var lines []string
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+			if logLines > 0 && len(lines) > logLines {
+				lines = lines[1:]
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+		for _, line := range lines {
+			fmt.Fprintln(os.Stdout, line)
+		}
+		return nil
+	},
+}
+
+// validateLogLevel checks the --log-level flag
+func validateLogLevel() error {
+	if logLevel == "" {
+		return nil
+	}
+	_, err := logging.ParseLevel(logLevel)
+	return err
+}
+
+// setupLogging sends the default slog logger to stderr and the instance's
+// log file, at the level of --log-level, --verbose or the configuration
+func setupLogging() {
+	cfg, err := config.Load()
+	if err != nil {
+		cfg = config.Default()
+	}
+	level := logLevel
+	if level == "" && verbose {
+		level = "debug"
+	}
+	opts, err := cfg.LoggingOptions(level)
+	opts.Console = os.Stderr
+	if err != nil {
+		opts.Path = ""
+	}
+	logCloser, err = logging.Setup(opts)
+	if err != nil {
+		slog.Debug("log output disabled", "error", err)
+	}
+	if cfg.Logging.Audit {
+		audit.Forward(forwardAudit)
+	}
+}
+
+// forwardAudit sends an audit entry to the unified log and syslog server,
+// as a warning when it failed
+func forwardAudit(entry audit.Entry) {
+	level := slog.LevelInfo
+	if entry.Result == "failed" {
+		level = slog.LevelWarn
+	}
+	instance := entry.Instance
+	if instance == "" {
+		instance = config.Instance()
+	}
+	attrs := []any{"source", entry.Source, "instance", instance, "actor", entry.Actor}
+	if entry.Target != "" {
+		attrs = append(attrs, "target", entry.Target)
+	}
+	attrs = append(attrs, "result", entry.Result)
+	if entry.Detail != "" {
+		attrs = append(attrs, "detail", entry.Detail)
+	}
+	logging.AuditLog().Log(context.Background(), level, entry.Action, attrs...)
+}
+
+// closeLogging closes the log file
+func closeLogging() {
+	if logCloser != nil {
+		_ = logCloser.Close()
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+
+	logsCmd.Flags().IntVarP(&logLines, "lines", "n", 50, "number of lines to show (0 for all)")
+	logsCmd.Flags().BoolVar(&logPath, "path", false, "print the path of the log file")
+}
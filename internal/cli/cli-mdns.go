@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/mdns"
+)
+
+// mdnsCmd represents the mdns command
+var mdnsCmd = &cobra.Command{
+	Use:   "mdns",
+	Short: "Bonjour/mDNS service discovery across the NAT boundary",
+	Long: `Make Bonjour services such as AirPlay receivers, printers and
+Chromecasts visible across the NAT boundary.
+
+Example:
+  nat-manager mdns reflect`,
+}
+
+// mdnsReflectCmd represents the mdns reflect command
+var mdnsReflectCmd = &cobra.Command{
+	Use:   "reflect",
+	Short: "Reflect mDNS service discovery between host and NAT network",
+	Long: `Run an mDNS reflector in the foreground.
+
+Service discovery messages are relayed between the external and internal
+interface (mdns_reflector.interfaces) when they concern a service type in
+mdns_reflector.services, together with the address records of the hosts
+offering them. Without a configured list, AirPlay, printing, Chromecast and
+Spotify Connect are reflected.
+
+Example:
+  nat-manager mdns reflect`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		services := cfg.MDNS.Services
+		if len(services) == 0 {
+			services = mdns.DefaultServices
+		}
+		interfaces := cfg.GetMDNSInterfaces()
+
+		reflector, err := mdns.New(mdns.Config{Interfaces: interfaces, Services: services})
+		if err != nil {
+			return fmt.Errorf("failed to create mDNS reflector: %w", err)
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		fmt.Fprintf(stdout, "📡 Reflecting mDNS between %s\n", strings.Join(interfaces, " ⇄ "))
+		fmt.Fprintf(stdout, "   Services: %s\n", strings.Join(services, ", "))
+		if err := reflector.Run(ctx); err != nil {
+			return err
+		}
+
+		stats := reflector.Stats()
+		fmt.Fprintf(stdout, "📊 Received: %d | Reflected: %d | Filtered: %d\n", stats.Received, stats.Reflected, stats.Filtered)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mdnsCmd)
+	mdnsCmd.AddCommand(mdnsReflectCmd)
+}
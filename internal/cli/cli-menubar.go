@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var (
+	menubarDir     string
+	menubarRefresh string
+)
+
+// refreshRe matches the refresh intervals xbar and SwiftBar read from
+// plugin file names
+var refreshRe = regexp.MustCompile(`^\d+[smhd]$`)
+
+// menubarCmd represents the menubar command
+var menubarCmd = &cobra.Command{
+	Use:   "menubar",
+	Short: "Print the NAT state for an xbar or SwiftBar menu",
+	Long: `Print whether NAT runs, the number of devices online and a menu to stop,
+start and open nat-manager, in the plugin format of xbar and SwiftBar. Use
+'menubar plugin' to install a plugin running it.
+
+It runs without sudo through the privileged helper ('sudo nat-manager helper
+install'). With -o json it prints the same summary as the REST API's
+/api/v1/summary, for other menu bar apps. Apps can also follow
+/api/v1/events, a server-sent event stream of the summary and of NAT and
+devices starting and stopping.
+
+Example:
+  nat-manager menubar
+  nat-manager menubar -o json
+  nat-manager menubar plugin --dir ~/Library/Application\ Support/xbar/plugins`,
+	Annotations: map[string]string{helperAnnotation: helperNone},
+	Args:        cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find nat-manager: %w", err)
+		}
+		if os.Geteuid() != 0 && !connectHelper() {
+			if outputFormat != outputTable {
+				return exitWith(ExitPermission, fmt.Errorf("the helper is not running (install it with 'sudo nat-manager helper install')"))
+			}
+			renderMenubarNoHelper(os.Stdout, menubarAction(executable, "sudo", "helper", "install"))
+			return nil
+		}
+
+		manager := nat.NewManager(cfg.ToNATConfig())
+		status, err := natStatus(manager)
+		if err != nil {
+			return fmt.Errorf("failed to get NAT status: %w", err)
+		}
+		devices, err := listDevices(manager)
+		if err != nil {
+			return fmt.Errorf("failed to list devices: %w", err)
+		}
+		summary := api.Summarize(status, devices)
+		if outputFormat != outputTable {
+			return writeOutput(os.Stdout, outputFormat, summary)
+		}
+		renderMenubar(os.Stdout, summary, devices, executable)
+		return nil
+	},
+}
+
+// menubarPluginCmd represents the menubar plugin command
+var menubarPluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Write an xbar or SwiftBar plugin",
+	Long: `Write a plugin script running 'nat-manager menubar' to the plugin directory
+of xbar or SwiftBar, or print it without --dir. The refresh interval is part
+of the file name, as both apps expect.`,
+	Annotations: map[string]string{helperAnnotation: helperNone},
+	Args:        cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if !refreshRe.MatchString(menubarRefresh) {
+			return exitWith(ExitUsage, fmt.Errorf("invalid refresh interval %q (e.g. 10s or 1m)", menubarRefresh))
+		}
+		executable, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to find nat-manager: %w", err)
+		}
+		plugin := menubarPlugin(executable, config.Instance())
+		if menubarDir == "" {
+			fmt.Fprint(os.Stdout, plugin)
+			return nil
+		}
+
+		name := "nat-manager"
+		if config.Instance() != nat.DefaultInstance {
+			name += "-" + config.Instance()
+		}
+		path := filepath.Join(menubarDir, fmt.Sprintf("%s.%s.sh", name, menubarRefresh))
+		if err := os.MkdirAll(menubarDir, 0755); err != nil {
+			return fmt.Errorf("failed to create plugin directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(plugin), 0755); err != nil {
+			return fmt.Errorf("failed to write plugin: %w", err)
+		}
+		fmt.Fprintf(stdout, "✅ Plugin written to %s\n", path)
+		return nil
+	},
+}
+
+// menubarPlugin returns the plugin script running executable for instance
+func menubarPlugin(executable, instance string) string {
+	args := shellQuote(executable)
+	if instance != nat.DefaultInstance {
+		args += " --instance " + shellQuote(instance)
+	}
+	return fmt.Sprintf(`#!/bin/sh
+# <xbar.title>NAT Manager</xbar.title>
+# <xbar.desc>Shows whether NAT runs and how many devices are online</xbar.desc>
+# <xbar.dependencies>nat-manager</xbar.dependencies>
+# <swiftbar.hideRunInTerminal>true</swiftbar.hideRunInTerminal>
+exec %s menubar
+`, args)
+}
+
+// renderMenubar writes the menu of a summary and devices in the plugin
+// format
+func renderMenubar(w io.Writer, summary api.Summary, devices []nat.Device, executable string) {
+	if !summary.Active {
+		fmt.Fprintf(w, "⚪ NAT\n---\n")
+		fmt.Fprintf(w, "NAT is not running\n---\n")
+		fmt.Fprintf(w, "Start NAT… | %s terminal=true refresh=true\n", menubarAction(executable, "sudo", "start"))
+		fmt.Fprintf(w, "Open nat-manager… | %s terminal=true\n", menubarAction(executable, "sudo"))
+		fmt.Fprintf(w, "Refresh | refresh=true\n")
+		return
+	}
+
+	fmt.Fprintf(w, "🟢 NAT %d\n---\n", summary.Devices)
+	fmt.Fprintf(w, "NAT running")
+	if summary.Uptime != "" {
+		fmt.Fprintf(w, " for %s", summary.Uptime)
+	}
+	fmt.Fprintf(w, "\n")
+	if summary.ExternalIP != "" {
+		fmt.Fprintf(w, "External IP: %s\n", summary.ExternalIP)
+	}
+	fmt.Fprintf(w, "Connections: %d\n", summary.Connections)
+	fmt.Fprintf(w, "Traffic: ↓ %s ↑ %s\n", formatBytes(summary.BytesIn), formatBytes(summary.BytesOut))
+	fmt.Fprintf(w, "---\nDevices online: %d\n", summary.Devices)
+	for _, d := range devices {
+		if !d.Online {
+			continue
+		}
+		name := d.Hostname
+		if name == "" {
+			name = d.MAC
+		}
+		fmt.Fprintf(w, "--%s  %s\n", menubarText(name), d.IP)
+	}
+	fmt.Fprintf(w, "---\n")
+	fmt.Fprintf(w, "Stop NAT | %s terminal=false refresh=true\n", menubarAction(executable, "", "stop"))
+	fmt.Fprintf(w, "Open nat-manager… | %s terminal=true\n", menubarAction(executable, "sudo"))
+	fmt.Fprintf(w, "Refresh | refresh=true\n")
+}
+
+// renderMenubarNoHelper writes the menu shown when the helper is missing
+func renderMenubarNoHelper(w io.Writer, install string) {
+	fmt.Fprintf(w, "⚠️ NAT\n---\n")
+	fmt.Fprintf(w, "The nat-manager helper is not running\n")
+	fmt.Fprintf(w, "Install the helper… | %s terminal=true refresh=true\n", install)
+	fmt.Fprintf(w, "Refresh | refresh=true\n")
+}
+
+// menubarAction returns the parameters of a menu item running executable
+// with args, through sudo when sudo is set, for the selected instance
+func menubarAction(executable, sudo string, args ...string) string {
+	command := []string{executable}
+	if sudo != "" {
+		command = []string{"/usr/bin/sudo", executable}
+	}
+	if config.Instance() != nat.DefaultInstance {
+		command = append(command, "--instance", config.Instance())
+	}
+	command = append(command, args...)
+
+	parts := []string{"bash=" + menubarParam(command[0])}
+	for i, arg := range command[1:] {
+		parts = append(parts, fmt.Sprintf("param%d=%s", i+1, menubarParam(arg)))
+	}
+	return strings.Join(parts, " ")
+}
+
+// menubarParam quotes a parameter containing spaces
+func menubarParam(s string) string {
+	if strings.ContainsAny(s, " \t") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// menubarText keeps text from being read as item parameters
+func menubarText(s string) string {
+	return strings.ReplaceAll(s, "|", "/")
+}
+
+// shellQuote quotes s for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func init() {
+	rootCmd.AddCommand(menubarCmd)
+	menubarCmd.AddCommand(menubarPluginCmd)
+
+	menubarPluginCmd.Flags().StringVar(&menubarDir, "dir", "", "plugin directory to write to (prints the plugin if unset)")
+	menubarPluginCmd.Flags().StringVar(&menubarRefresh, "refresh", "10s", "refresh interval, e.g. 10s or 1m")
+}
@@ -12,7 +12,11 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/fake"
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
 	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/session"
+	"github.com/scttfrdmn/macos-nat-manager/internal/tui"
 )
 
 var (
@@ -20,6 +24,19 @@ var (
 	maxConnections  int
 	showDevices     bool
 	followMode      bool
+	recordFile      string
+	replayFile      string
+	replaySpeed     float64
+	replayTUI       bool
+	simulate        bool
+	simulateSeed    int64
+	monitorFilters  []string
+	monitorSort     string
+	exportFormat    string
+	exportFile      string
+
+	// connFilter is the parsed --filter
+	connFilter nat.ConnectionFilter
 )
 
 // monitorCmd represents the monitor command
@@ -38,8 +55,56 @@ Example:
   nat-manager monitor
   nat-manager monitor --interval 5s --max 50  # Custom refresh and limit
   nat-manager monitor --devices               # Show connected devices
-  nat-manager monitor --follow                # Continuous monitoring mode`,
+  nat-manager monitor --follow                # Continuous monitoring mode
+  nat-manager monitor --record session.json   # Record while following
+  nat-manager monitor --replay session.json --speed 60
+  nat-manager monitor --replay session.json --tui  # Step through it in the TUI
+  nat-manager monitor --simulate --tui        # Demo with generated traffic
+
+Connections are the pf states of the internal network, with their traffic
+and age, when pf lists any. --filter selects connections with key=value
+terms that must all match:
+
+  device=<ip|mac|hostname>   connections of one internal device
+  proto=<tcp|udp|icmp>       protocol
+  port=<port>                source or destination port
+  dst=<ip|cidr>              destination address or network
+
+  nat-manager monitor -f --filter "device=192.168.100.50 proto=tcp" --sort bytes
+  nat-manager monitor --filter dst=10.0.0.0/8 --filter port=443
+
+--export writes the connections as records instead of a display: one per
+connection and snapshot, stamped with the snapshot time, as NDJSON or CSV.
+With --follow a snapshot is exported every --interval until interrupted.
+
+  nat-manager monitor -f --export ndjson | jq .
+  nat-manager monitor -f --export csv --export-file connections.csv
+
+--simulate plays generated traffic of a busy network, a frame every
+--interval, instead of watching NAT: the same for the same --seed, for
+demos and screenshots. It takes the replay flags.`,
 	RunE: func(_ *cobra.Command, args []string) error {
+		var err error
+		if connFilter, err = nat.ParseConnectionFilter(monitorFilters); err != nil {
+			return err
+		}
+		if err := nat.SortConnections(nil, monitorSort); err != nil {
+			return err
+		}
+		if exportFormat != "" && exportFormat != exportNDJSON && exportFormat != exportCSV {
+			return fmt.Errorf("invalid export format %q, expected %s or %s", exportFormat, exportNDJSON, exportCSV)
+		}
+
+		if replayTUI && replayFile == "" && !simulate {
+			return exitWith(ExitUsage, fmt.Errorf("--tui needs a session to replay with --replay or --simulate"))
+		}
+		if replayFile != "" {
+			return runReplay(replayFile)
+		}
+		if simulate {
+			return playSession(fmt.Sprintf("simulated traffic (seed %d)", simulateSeed), simulatedSession(simulateSeed))
+		}
+
 		// Load config
 		cfg, err := config.Load()
 		if err != nil {
@@ -47,29 +112,21 @@ Example:
 		}
 
 		// Convert config to NAT config
-		natConfig := &nat.Config{
-			ExternalInterface: cfg.ExternalInterface,
-			InternalInterface: cfg.InternalInterface,
-			InternalNetwork:   cfg.InternalNetwork,
-			DHCPRange: nat.DHCPRange{
-				Start: cfg.DHCPRange.Start,
-				End:   cfg.DHCPRange.End,
-				Lease: cfg.DHCPRange.Lease,
-			},
-			DNSServers: cfg.DNSServers,
-			Active:     cfg.Active,
-		}
+		natConfig := cfg.ToNATConfig()
 
 		// Create NAT manager
 		manager := nat.NewManager(natConfig)
 
 		// Check if NAT is running
 		if !manager.IsActive() {
-			return fmt.Errorf("NAT is not running. Start it first with 'nat-manager start'")
+			return fmt.Errorf("%w. Start it first with 'nat-manager start'", nat.ErrNotRunning)
 		}
 
-		if followMode {
-			return runFollowMode(manager)
+		if exportFormat != "" {
+			return runExport(manager)
+		}
+		if followMode || recordFile != "" {
+			return runFollowMode(cfg, manager)
 		}
 
 		return runSnapshotMode(manager)
@@ -81,23 +138,24 @@ func runSnapshotMode(manager *nat.Manager) error {
 	if err != nil {
 		return fmt.Errorf("failed to get status: %w", err)
 	}
+	useStateConnections(manager, status)
 
 	config := manager.GetConfig()
 	if config == nil {
 		return fmt.Errorf("no NAT configuration found")
 	}
 
-	fmt.Printf("📊 NAT Monitor - %s\n", time.Now().Format("2006-01-02 15:04:05"))
-	fmt.Printf("External: %s (%s) → Internal: %s (%s.1/24)\n\n",
+	fmt.Fprintf(stdout, "📊 NAT Monitor - %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(stdout, "External: %s (%s) → Internal: %s (%s.1/24)\n\n",
 		config.ExternalInterface,
 		status.ExternalIP,
 		config.InternalInterface,
 		config.InternalNetwork)
 
 	if showDevices && len(status.ConnectedDevices) > 0 {
-		fmt.Printf("📱 Connected Devices (%d):\n", len(status.ConnectedDevices))
-		fmt.Printf("%-15s %-18s %-15s %s\n", "IP ADDRESS", "MAC ADDRESS", "HOSTNAME", "LEASE TIME")
-		fmt.Printf("%s %s %s %s\n",
+		fmt.Fprintf(stdout, "📱 Connected Devices (%d):\n", len(status.ConnectedDevices))
+		fmt.Fprintf(stdout, "%-15s %-18s %-15s %s\n", "IP ADDRESS", "MAC ADDRESS", "HOSTNAME", "LEASE TIME")
+		fmt.Fprintf(stdout, "%s %s %s %s\n",
 			fmt.Sprintf("%-15s", strings.Repeat("-", 15)),
 			fmt.Sprintf("%-18s", strings.Repeat("-", 18)),
 			fmt.Sprintf("%-15s", strings.Repeat("-", 15)),
@@ -108,37 +166,44 @@ func runSnapshotMode(manager *nat.Manager) error {
 			if hostname == "" {
 				hostname = "Unknown"
 			}
-			fmt.Printf("%-15s %-18s %-15s %s\n",
+			fmt.Fprintf(stdout, "%-15s %-18s %-15s %s\n",
 				device.IP, device.MAC, hostname, device.LeaseTime)
 		}
-		fmt.Println()
+		fmt.Fprintln(stdout)
 	}
 
-	if len(status.ActiveConnections) > 0 {
-		fmt.Printf("🌐 Active Connections (%d):\n", len(status.ActiveConnections))
-		fmt.Printf("%-8s %-25s %-25s %-12s\n", "PROTO", "SOURCE", "DESTINATION", "STATE")
-		fmt.Printf("%-8s %-25s %-25s %-12s\n",
+	connections := monitorConnections(status)
+	if len(connections) > 0 {
+		fmt.Fprintf(stdout, "🌐 Active Connections (%s):\n", connectionCount(connections, status))
+		fmt.Fprintf(stdout, "%-8s %-25s %-25s %-12s %-10s %s\n", "PROTO", "SOURCE", "DESTINATION", "STATE", "BYTES", "AGE")
+		fmt.Fprintf(stdout, "%-8s %-25s %-25s %-12s %-10s %s\n",
 			strings.Repeat("-", 8),
 			strings.Repeat("-", 25),
 			strings.Repeat("-", 25),
-			strings.Repeat("-", 12))
+			strings.Repeat("-", 12),
+			strings.Repeat("-", 10),
+			strings.Repeat("-", 8))
 
 		count := 0
-		for _, conn := range status.ActiveConnections {
+		for _, conn := range connections {
 			if count >= maxConnections {
-				fmt.Printf("... and %d more connections\n", len(status.ActiveConnections)-maxConnections)
+				fmt.Fprintf(stdout, "... and %d more connections\n", len(connections)-maxConnections)
 				break
 			}
-			fmt.Printf("%-8s %-25s %-25s %-12s\n",
-				conn.Protocol, conn.Source, conn.Destination, conn.State)
+			bytes, age := "-", "-"
+			if conn.Bytes > 0 || conn.Age > 0 {
+				bytes, age = formatBytes(conn.Bytes), conn.Age.String()
+			}
+			fmt.Fprintf(stdout, "%-8s %-25s %-25s %-12s %-10s %s\n",
+				conn.Protocol, conn.Source, conn.Destination, conn.State, bytes, age)
 			count++
 		}
 	} else {
-		fmt.Printf("🌐 No active connections\n")
+		fmt.Fprintf(stdout, "🌐 No active connections\n")
 	}
 
-	fmt.Printf("\n📈 Statistics:\n")
-	fmt.Printf("Uptime: %s | Traffic: %s in, %s out\n",
+	fmt.Fprintf(stdout, "\n📈 Statistics:\n")
+	fmt.Fprintf(stdout, "Uptime: %s | Traffic: %s in, %s out\n",
 		status.Uptime,
 		formatBytes(status.BytesIn),
 		formatBytes(status.BytesOut))
@@ -146,7 +211,7 @@ func runSnapshotMode(manager *nat.Manager) error {
 	return nil
 }
 
-func runFollowMode(manager *nat.Manager) error {
+func runFollowMode(cfg *config.Config, manager *nat.Manager) error {
 	// Set up signal handling for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -155,91 +220,267 @@ func runFollowMode(manager *nat.Manager) error {
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
-		fmt.Printf("\n\n👋 Monitoring stopped\n")
+		fmt.Fprintf(stdout, "\n\n👋 Monitoring stopped\n")
 		cancel()
 	}()
 
-	fmt.Printf("🔄 NAT Monitor (Follow Mode) - Press Ctrl+C to stop\n")
-	fmt.Printf("Refresh interval: %s | Max connections: %d\n\n", refreshInterval, maxConnections)
+	startAPIServer(ctx, cfg)
+	watchDHCP(ctx, manager)
 
-	ticker := time.NewTicker(refreshInterval)
-	defer ticker.Stop()
+	var recorder *session.Recorder
+	if recordFile != "" {
+		file, err := os.OpenFile(recordFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create session file: %w", err)
+		}
+		defer func() { _ = file.Close() }()
 
-	// Initial display
-	if err := displayMonitorData(manager); err != nil {
-		return err
+		recorder, err = session.NewRecorder(file, monitorHeader(manager.GetConfig()))
+		if err != nil {
+			return err
+		}
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		case <-ticker.C:
-			// Clear screen and redisplay
-			fmt.Print("\033[2J\033[H") // ANSI clear screen and move cursor to top
-			if err := displayMonitorData(manager); err != nil {
-				fmt.Printf("Error updating display: %v\n", err)
-			}
-		}
+	fmt.Fprintf(stdout, "🔄 NAT Monitor (Follow Mode) - Press Ctrl+C to stop\n")
+	fmt.Fprintf(stdout, "Refresh interval: %s | Max connections: %d\n", refreshInterval, maxConnections)
+	if recorder != nil {
+		fmt.Fprintf(stdout, "Recording to: %s\n", recordFile)
 	}
+	fmt.Fprintln(stdout)
+
+	return watch(ctx, refreshInterval, true, func() error {
+		return displayMonitorData(manager, recorder)
+	})
 }
 
-func displayMonitorData(manager *nat.Manager) error {
+func displayMonitorData(manager *nat.Manager, recorder *session.Recorder) error {
 	status, err := manager.GetStatus()
 	if err != nil {
 		return err
 	}
+	useStateConnections(manager, status)
 
 	config := manager.GetConfig()
 	if config == nil {
 		return fmt.Errorf("no NAT configuration found")
 	}
 
-	fmt.Printf("📊 NAT Monitor - %s (Uptime: %s)\n",
-		time.Now().Format("15:04:05"),
+	now := time.Now()
+	if recorder != nil {
+		if err := recorder.Record(now, status); err != nil {
+			return err
+		}
+	}
+
+	printMonitorFrame(monitorHeader(config), status, now)
+	return nil
+}
+
+// monitorHeader describes the monitored NAT setup
+func monitorHeader(config *nat.Config) session.Header {
+	return session.Header{
+		ExternalInterface: config.ExternalInterface,
+		InternalInterface: config.InternalInterface,
+		InternalNetwork:   config.InternalNetwork,
+	}
+}
+
+// printMonitorFrame renders one follow-mode snapshot
+func printMonitorFrame(header session.Header, status *nat.Status, at time.Time) {
+	fmt.Fprintf(stdout, "📊 NAT Monitor - %s (Uptime: %s)\n",
+		at.Format("15:04:05"),
 		status.Uptime)
-	fmt.Printf("External: %s (%s) → Internal: %s (%s.1/24)\n",
-		config.ExternalInterface,
+	fmt.Fprintf(stdout, "External: %s (%s) → Internal: %s (%s.1/24)\n",
+		header.ExternalInterface,
 		status.ExternalIP,
-		config.InternalInterface,
-		config.InternalNetwork)
-	fmt.Printf("Traffic: %s in, %s out | Devices: %d | Connections: %d\n\n",
+		header.InternalInterface,
+		header.InternalNetwork)
+	connections := monitorConnections(status)
+	fmt.Fprintf(stdout, "Traffic: %s in, %s out%s | Devices: %d | Connections: %s\n\n",
 		formatBytes(status.BytesIn),
 		formatBytes(status.BytesOut),
+		formatThroughput(status.Throughput),
 		len(status.ConnectedDevices),
-		len(status.ActiveConnections))
+		connectionCount(connections, status))
 
 	if showDevices && len(status.ConnectedDevices) > 0 {
-		fmt.Printf("📱 Connected Devices:\n")
+		fmt.Fprintf(stdout, "📱 Connected Devices:\n")
 		for _, device := range status.ConnectedDevices {
 			hostname := device.Hostname
 			if hostname == "" {
 				hostname = "Unknown"
 			}
-			fmt.Printf("  %s - %s (%s)\n", device.IP, hostname, device.MAC[:8]+"...")
+			fmt.Fprintf(stdout, "  %s - %s (%s)\n", device.IP, hostname, device.MAC[:8]+"...")
 		}
-		fmt.Println()
+		fmt.Fprintln(stdout)
 	}
 
-	if len(status.ActiveConnections) > 0 {
-		fmt.Printf("🌐 Recent Connections:\n")
-		count := 0
-		for _, conn := range status.ActiveConnections {
-			if count >= maxConnections {
+	if len(connections) > 0 {
+		fmt.Fprintf(stdout, "🌐 Recent Connections:\n")
+		for i, conn := range connections {
+			if i >= maxConnections {
+				fmt.Fprintf(stdout, "  ... and %d more\n", len(connections)-maxConnections)
 				break
 			}
-			fmt.Printf("  %s %s → %s (%s)\n",
-				conn.Protocol, conn.Source, conn.Destination, conn.State)
-			count++
+			fmt.Fprintf(stdout, "  %s %s → %s (%s)%s\n",
+				conn.Protocol, conn.Source, conn.Destination, conn.State, formatConnectionUsage(conn))
 		}
-		if len(status.ActiveConnections) > maxConnections {
-			fmt.Printf("  ... and %d more\n", len(status.ActiveConnections)-maxConnections)
+	}
+}
+
+// useStateConnections replaces the connections of a status with the pf
+// states of the internal network, which carry traffic and age, if pf lists
+// any
+func useStateConnections(manager *nat.Manager, status *nat.Status) {
+	if states := manager.NATConnections(); len(states) > 0 {
+		status.ActiveConnections = states
+	}
+}
+
+// monitorConnections returns the connections of a status matching
+// --filter, ordered by --sort
+func monitorConnections(status *nat.Status) []nat.Connection {
+	connections := connFilter.Apply(status.ActiveConnections, status.ConnectedDevices)
+	if monitorSort != "" {
+		connections = append([]nat.Connection{}, connections...)
+		_ = nat.SortConnections(connections, monitorSort)
+	}
+	return connections
+}
+
+// connectionCount renders the number of shown connections, and of all
+// connections when filtered
+func connectionCount(shown []nat.Connection, status *nat.Status) string {
+	if connFilter.Empty() {
+		return fmt.Sprint(len(shown))
+	}
+	return fmt.Sprintf("%d of %d", len(shown), len(status.ActiveConnections))
+}
+
+// formatConnectionUsage renders the traffic and age of a connection, if known
+func formatConnectionUsage(conn nat.Connection) string {
+	if conn.Bytes == 0 && conn.Age == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %s, %s", formatBytes(conn.Bytes), conn.Age)
+}
+
+// formatThroughput renders the current traffic rate, if known
+func formatThroughput(rate *ifstats.Throughput) string {
+	if rate == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (now %s/s in, %s/s out)", formatBytes(uint64(rate.In)), formatBytes(uint64(rate.Out)))
+}
+
+// runReplay plays back a recorded session, waiting the recorded time between
+// frames divided by --speed (0 prints every frame without waiting), or in
+// the connection monitor of the TUI with --tui
+func runReplay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open session file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	recording, err := session.Load(file)
+	if err != nil {
+		return err
+	}
+	if len(recording.Frames) == 0 {
+		return fmt.Errorf("session %s contains no frames", path)
+	}
+	return playSession(path, recording)
+}
+
+// playSession plays recording, named name, in the terminal or with --tui
+// in the TUI
+func playSession(name string, recording *session.Session) error {
+	if replayTUI {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		app := tui.NewApp(cfg)
+		app.SetReplay(recording, replaySpeed)
+		return app.Run()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Fprintf(stdout, "⏪ Replaying %s: %d frames over %s recorded %s\n\n",
+		name, len(recording.Frames), recording.Duration().Round(time.Second),
+		recording.Header.Started.Format("2006-01-02 15:04:05"))
+
+	for i, frame := range recording.Frames {
+		if i > 0 && replaySpeed > 0 {
+			gap := frame.Time.Sub(recording.Frames[i-1].Time)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Duration(float64(gap) / replaySpeed)):
+			}
+			fmt.Fprint(stdout, clearScreen)
+		}
+		fmt.Fprintf(stdout, "[frame %d/%d]\n", i+1, len(recording.Frames))
+		printMonitorFrame(recording.Header, frame.Status, frame.Time)
+		if replaySpeed <= 0 {
+			fmt.Fprintln(stdout)
 		}
 	}
 
 	return nil
 }
 
+// Size of the network --simulate generates
+const (
+	simulatedDevices     = 24
+	simulatedConnections = 200
+	simulatedFrames      = 150
+)
+
+// simulatedSession generates a session of a busy network from seed, with a
+// frame every --interval. Established TCP connections carry the traffic.
+func simulatedSession(seed int64) *session.Session {
+	header := session.Header{
+		Version:           session.Version,
+		Started:           fake.Epoch,
+		ExternalInterface: "en0",
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+	}
+	g := fake.New(seed, header.InternalNetwork)
+	devices := g.Devices(simulatedDevices)
+	connections := g.Connections(devices, simulatedConnections)
+	base := g.Status(devices, connections)
+
+	recording := &session.Session{Header: header}
+	bytesIn, bytesOut := base.BytesIn, base.BytesOut
+	for i := 0; i < simulatedFrames; i++ {
+		at := fake.Epoch.Add(time.Duration(i) * refreshInterval)
+		status := *base
+		status.ActiveConnections = connections
+		status.BytesIn, status.BytesOut = bytesIn, bytesOut
+		status.Interfaces = []ifstats.Counters{
+			{Interface: header.ExternalInterface, Time: at, BytesIn: bytesIn, BytesOut: bytesOut},
+			{Interface: header.InternalInterface, Time: at, BytesIn: bytesOut, BytesOut: bytesIn},
+		}
+		recording.Frames = append(recording.Frames, session.Frame{Time: at, Status: &status})
+
+		established := 0
+		for _, conn := range connections {
+			if conn.State == "ESTABLISHED" {
+				established++
+			}
+		}
+		bytesIn += uint64(float64(established) * refreshInterval.Seconds() * 48 * 1024)
+		bytesOut += uint64(float64(established) * refreshInterval.Seconds() * 6 * 1024)
+		connections = g.Step(devices, connections)
+	}
+	return recording
+}
+
 func init() {
 	rootCmd.AddCommand(monitorCmd)
 
@@ -247,4 +488,18 @@ func init() {
 	monitorCmd.Flags().IntVarP(&maxConnections, "max", "m", 20, "maximum connections to display")
 	monitorCmd.Flags().BoolVarP(&showDevices, "devices", "d", false, "show connected devices")
 	monitorCmd.Flags().BoolVarP(&followMode, "follow", "f", false, "continuous monitoring mode")
+	monitorCmd.Flags().StringVar(&recordFile, "record", "", "record follow-mode snapshots to a session file")
+	monitorCmd.Flags().StringVar(&replayFile, "replay", "", "replay a recorded session file")
+	monitorCmd.Flags().Float64Var(&replaySpeed, "speed", 1, "replay speed multiplier (0 prints all frames at once, or steps by hand with --tui)")
+	monitorCmd.Flags().BoolVar(&replayTUI, "tui", false, "replay in the connection monitor of the TUI")
+	monitorCmd.Flags().BoolVar(&simulate, "simulate", false, "play generated traffic instead of watching NAT")
+	monitorCmd.Flags().Int64Var(&simulateSeed, "seed", 1, "seed of the traffic --simulate generates")
+	monitorCmd.Flags().StringArrayVar(&monitorFilters, "filter", nil, "show connections matching key=value terms: device, proto, port, dst")
+	monitorCmd.Flags().StringVar(&monitorSort, "sort", "", "order connections by bytes (largest first), age (newest first) or destination")
+	monitorCmd.Flags().StringVar(&exportFormat, "export", "", "write connection records instead of a display: ndjson or csv")
+	monitorCmd.Flags().StringVar(&exportFile, "export-file", "", "file to export to (default stdout)")
+	monitorCmd.MarkFlagsMutuallyExclusive("record", "replay")
+	monitorCmd.MarkFlagsMutuallyExclusive("export", "record")
+	monitorCmd.MarkFlagsMutuallyExclusive("export", "replay")
+	monitorCmd.MarkFlagsMutuallyExclusive("simulate", "replay", "record", "export")
 }
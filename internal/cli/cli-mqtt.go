@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/mqtt"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// mqttCmd represents the mqtt command
+var mqttCmd = &cobra.Command{
+	Use:   "mqtt",
+	Short: "Publish NAT state to an MQTT broker",
+	Long: `Publish the state of the instance, the presence of its devices and their
+traffic to an MQTT broker, for home automation. Once mqtt.enabled is set,
+'start --foreground' and the daemon publish every mqtt.interval (30s) to
+retained topics under <topic_prefix>/<instance>/:
+
+  availability                online, or offline when the publisher is gone
+  state                       ON or OFF
+  status                      {"active":true,"external_ip":"...","devices":3,
+                               "connections":42,"bytes_in":...,"bytes_out":...,
+                               "rate_in":...,"rate_out":...}
+  devices/<id>/presence       home or not_home, <id> being the MAC address
+                              without colons
+  devices/<id>/attributes     the device, as 'devices --json'
+  devices/<id>/traffic        {"bytes_in":...,"bytes_out":...}
+  events                      the events sent to webhooks (not retained)
+
+With mqtt.home_assistant set, Home Assistant discovery configs are
+published under mqtt.discovery_prefix (homeassistant) as well: a NAT
+device with sensors for the state, external IP, devices, connections,
+traffic and rates, and a device tracker with traffic sensors for each
+client.
+
+Example:
+  nat-manager config set mqtt.broker tcp://homeassistant.local:1883
+  nat-manager config set mqtt.username nat
+  nat-manager config set mqtt.password s3cret
+  nat-manager config set mqtt.home_assistant true
+  nat-manager config set mqtt.enabled true
+  sudo nat-manager mqtt publish`,
+}
+
+// mqttPublishCmd represents the mqtt publish command
+var mqttPublishCmd = &cobra.Command{
+	Use:   "publish",
+	Short: "Publish the current state once",
+	Long: `Publish the current state once, including the discovery configs, e.g. to
+check the broker settings or to publish after a change without waiting for
+the next interval.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, publisher, err := connectMQTT()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = publisher.Close(context.Background()) }()
+
+		if err := publisher.Publish(managerSource{nat.NewManager(cfg.ToNATConfig())}); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Published to %s\n", cfg.MQTT.Broker)
+		return nil
+	},
+}
+
+// mqttRunCmd represents the mqtt run command
+var mqttRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Keep publishing until interrupted",
+	Long: `Keep publishing the state every mqtt.interval until interrupted, for NAT
+that is not run by 'start --foreground' or the daemon, which publish on
+their own.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, publisher, err := connectMQTT()
+		if err != nil {
+			return err
+		}
+		defer func() { _ = publisher.Close(context.Background()) }()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Fprintf(stdout, "📡 Publishing to %s - press Ctrl+C to stop\n", cfg.MQTT.Broker)
+		publisher.Run(ctx, managerSource{nat.NewManager(cfg.ToNATConfig())}, func(err error) {
+			logging.Component(logging.Events).Warn("MQTT publish failed", "error", err)
+		})
+		return nil
+	},
+}
+
+// connectMQTT connects to the broker of the instance
+func connectMQTT() (*config.Config, *mqtt.Publisher, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.MQTT.Broker == "" {
+		return nil, nil, exitWith(ExitUsage, fmt.Errorf("no broker set (use 'nat-manager config set mqtt.broker tcp://HOST:1883')"))
+	}
+	publisher, err := mqtt.Connect(cfg.MQTTOptions())
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, publisher, nil
+}
+
+// startMQTT publishes the state of manager's instance in the background
+// until ctx is done, when enabled. The publisher receives the command's
+// events and is closed with the other event sinks.
+func startMQTT(ctx context.Context, cfg *config.Config, manager *nat.Manager) {
+	if !cfg.MQTT.Enabled {
+		return
+	}
+	publisher, err := mqtt.Connect(cfg.MQTTOptions())
+	if err != nil {
+		logging.Component(logging.Events).Warn("MQTT disabled", "error", err)
+		return
+	}
+	event.Register(publisher)
+	go publisher.Run(ctx, managerSource{manager}, func(err error) {
+		logging.Component(logging.Events).Warn("MQTT publish failed", "error", err)
+	})
+	fmt.Fprintf(stdout, "📡 Publishing to %s\n", cfg.MQTT.Broker)
+}
+
+// managerSource reads the state published to MQTT from a manager, which
+// keeps the previous counters to report traffic rates
+type managerSource struct {
+	manager *nat.Manager
+}
+
+func (s managerSource) Status() (*nat.Status, error) {
+	return restStatus(s.manager)
+}
+
+func (s managerSource) Devices() ([]nat.Device, error) {
+	return s.manager.Devices()
+}
+
+func (s managerSource) Traffic() (map[string]nat.Traffic, error) {
+	return s.manager.DeviceTraffic(), nil
+}
+
+func init() {
+	rootCmd.AddCommand(mqttCmd)
+	mqttCmd.AddCommand(mqttPublishCmd)
+	mqttCmd.AddCommand(mqttRunCmd)
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/notify"
+)
+
+// notifyCmd represents the notify command
+var notifyCmd = &cobra.Command{
+	Use:   "notify",
+	Short: "Show alerts in Notification Center",
+	Long: `Show macOS notifications for the alerts turned on under notifications in
+the configuration:
+
+  unknown_device   a device without a label or reserved lease that never
+                   got a lease before joined
+  wan_down         the uplink lost its address
+  quota_exceeded   traffic reached traffic_quota
+  nat_stopped      NAT stopped without being asked to, as when its pf
+                   rules were removed
+
+The uplink, quota and NAT alerts are raised by 'start --foreground' and the
+daemon. Notifications raised as root appear in the session of the user
+logged in at the console.
+
+Example:
+  nat-manager config set notifications.unknown_device true
+  nat-manager config set notifications.wan_down true
+  nat-manager notify list
+  nat-manager notify test`,
+}
+
+// notifyListCmd represents the notify list command
+var notifyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the alerts and whether they are on",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if outputFormat != outputTable {
+			return writeOutput(os.Stdout, outputFormat, cfg.Notify)
+		}
+		on := cfg.Notify.Alerts()
+		fmt.Fprintf(stdout, "%-16s %s\n", "ALERT", "ON")
+		for _, alert := range notify.Alerts {
+			state := "no"
+			if slices.Contains(on, alert) {
+				state = "yes"
+			}
+			fmt.Fprintf(stdout, "%-16s %s\n", alert, state)
+		}
+		return nil
+	},
+}
+
+// notifyTestCmd represents the notify test command
+var notifyTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Show a test notification",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if err := notify.Show(notify.Notification{Title: "NAT Manager", Subtitle: "Test", Message: "Notifications work"}); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Notification sent\n")
+		return nil
+	},
+}
+
+// registerNotifications shows the instance's events raising alerts that
+// are turned on
+func registerNotifications() {
+	cfg, err := config.Load()
+	if err != nil {
+		return
+	}
+	alerts := cfg.Notify.Alerts()
+	if len(alerts) == 0 {
+		return
+	}
+	event.Register(notify.New(alerts, func(err error) {
+		logging.Component(logging.Events).Warn("notification failed", "error", err)
+	}))
+}
+
+func init() {
+	rootCmd.AddCommand(notifyCmd)
+	notifyCmd.AddCommand(notifyListCmd)
+	notifyCmd.AddCommand(notifyTestCmd)
+}
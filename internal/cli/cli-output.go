@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the --output flag
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// clearScreen clears the terminal and moves the cursor to the top
+const clearScreen = "\033[2J\033[H"
+
+// outputFormat is the format selected with --output
+var outputFormat = outputTable
+
+// validateOutputFormat checks the --output flag
+func validateOutputFormat(format string) error {
+	switch format {
+	case outputTable, outputJSON, outputYAML:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q (table, json or yaml)", format)
+}
+
+// selectedOutput returns the output format, json when a command's --json
+// flag is set
+func selectedOutput(jsonFlag bool) string {
+	if jsonFlag {
+		return outputJSON
+	}
+	return outputFormat
+}
+
+// writeOutput writes v as JSON or YAML. Both use the JSON field names so
+// scripts see the same schema in either format.
+func writeOutput(w io.Writer, format string, v any) error {
+	if format == outputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		return nil
+	}
+
+	// JSON is YAML in flow style; reparsing it keeps the field order
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	blockStyle(&node)
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	return encoder.Close()
+}
+
+// blockStyle drops the flow style and quoting of a node parsed from JSON
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// watch renders now and then every interval until ctx is done, clearing
+// the screen before each refresh when clear is set. A failing first render
+// is returned, later failures are shown and retried.
+func watch(ctx context.Context, interval time.Duration, clear bool, render func() error) error {
+	if err := render(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if clear {
+			fmt.Fprint(stdout, clearScreen)
+		}
+		if err := render(); err != nil {
+			fmt.Fprintf(stdout, "Error updating display: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/portal"
+)
+
+// portalExpireInterval is how often 'portal serve' revokes expired access
+const portalExpireInterval = time.Minute
+
+// portalCmd represents the portal command
+var portalCmd = &cobra.Command{
+	Use:   "portal",
+	Short: "Manage the captive portal",
+	Long: `Manage the captive portal for classroom and demo networks.
+
+With portal.enabled, devices that have not accepted the portal have their
+web (port 80) and DNS traffic redirected to the gateway and everything else
+they send dropped. 'portal serve' runs the acceptance page; once a device
+clicks through, or enters portal.passphrase, it is added to a pf table and
+reaches the internet until portal.duration runs out or it is revoked.
+
+Without a subcommand, shows the portal configuration and admitted devices.
+
+Example:
+  sudo nat-manager portal serve
+  nat-manager portal admit 192.168.100.50
+  nat-manager portal revoke 192.168.100.50`,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		fmt.Fprintf(stdout, "Captive Portal: %s\n", formatBool(cfg.Portal.Enabled))
+		fmt.Fprintf(stdout, "Page: http://%s:%d/\n", cfg.GetGatewayIP(), cfg.Portal.GetPort())
+		fmt.Fprintf(stdout, "Passphrase: %s\n", formatBool(cfg.Portal.Passphrase != ""))
+		if cfg.Portal.Duration != "" {
+			fmt.Fprintf(stdout, "Access Duration: %s\n", cfg.Portal.Duration)
+		}
+
+		admissions, err := portalStore().List()
+		if err != nil {
+			return err
+		}
+		if len(admissions) == 0 {
+			fmt.Fprintf(stdout, "\nNo devices admitted\n")
+			return nil
+		}
+		fmt.Fprintf(stdout, "\n%-15s %-17s %-16s %s\n", "IP", "MAC", "ADMITTED", "EXPIRES")
+		for _, a := range admissions {
+			expires := "revoked manually"
+			if !a.Expires.IsZero() {
+				expires = a.Expires.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(stdout, "%-15s %-17s %-16s %s\n", a.IP, a.MAC, a.Admitted.Local().Format("2006-01-02 15:04"), expires)
+		}
+		return nil
+	},
+}
+
+// portalServeCmd represents the portal serve command
+var portalServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the captive portal page",
+	Long: `Run the captive portal web server on the gateway in the foreground,
+admitting devices that accept it and revoking access as it expires. Every
+accept attempt is recorded in the audit log ('nat-manager audit --source
+portal').`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if !cfg.Portal.Enabled {
+			fmt.Fprintf(stdout, "⚠️  portal.enabled is off: devices are not redirected to the portal\n")
+		}
+		duration, err := cfg.Portal.GetDuration()
+		if err != nil {
+			return err
+		}
+
+		manager := nat.NewManager(cfg.ToNATConfig())
+		store := portalStore()
+		auditLog := openAuditLog()
+		defer func() { _ = auditLog.Close() }()
+
+		listen := net.JoinHostPort(cfg.GetGatewayIP(), strconv.Itoa(cfg.Portal.GetPort()))
+		server := portal.New(portal.Config{
+			Listen:     listen,
+			Title:      cfg.Portal.Title,
+			Message:    cfg.Portal.Message,
+			Passphrase: cfg.Portal.Passphrase,
+			Duration:   duration,
+			Audit:      auditLog,
+			Admit: func(a portal.Admission) error {
+				a.MAC = leaseMAC(manager, a.IP)
+				return admitClient(manager, store, a)
+			},
+		})
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		go expireAdmissions(ctx, manager, store)
+
+		fmt.Fprintf(stdout, "🚪 Captive portal on http://%s/ - Press Ctrl+C to stop\n", listen)
+		return server.ListenAndServe(ctx)
+	},
+}
+
+// portalAdmitCmd represents the portal admit command
+var portalAdmitCmd = &cobra.Command{
+	Use:   "admit <ip>...",
+	Short: "Grant devices internet access without the portal",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		duration, err := cfg.Portal.GetDuration()
+		if err != nil {
+			return err
+		}
+
+		manager := nat.NewManager(cfg.ToNATConfig())
+		store := portalStore()
+		now := time.Now()
+		for _, ip := range args {
+			a := portal.Admission{IP: ip, MAC: leaseMAC(manager, ip), Admitted: now}
+			if duration > 0 {
+				a.Expires = now.Add(duration)
+			}
+			if err := admitClient(manager, store, a); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "✅ %s admitted\n", ip)
+		}
+		return nil
+	},
+}
+
+// portalRevokeCmd represents the portal revoke command
+var portalRevokeCmd = &cobra.Command{
+	Use:   "revoke <ip>...",
+	Short: "Send devices back to the portal",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		manager := nat.NewManager(cfg.ToNATConfig())
+		store := portalStore()
+		for _, ip := range args {
+			removed, err := store.Remove(ip)
+			if err != nil {
+				return err
+			}
+			if !removed {
+				fmt.Fprintf(stdout, "⚠️  %s was not admitted\n", ip)
+				continue
+			}
+			if manager.RulesLoaded() {
+				if err := manager.RevokeClient(ip); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintf(stdout, "✅ %s revoked\n", ip)
+		}
+		return nil
+	},
+}
+
+// portalStore returns the store of admitted devices of this instance
+func portalStore() *portal.Store {
+	path, err := config.GetPortalPath()
+	if err != nil {
+		path = "portal.json"
+	}
+	return portal.NewStore(path)
+}
+
+// admitClient records the admission and adds the device to the loaded
+// rules
+func admitClient(manager *nat.Manager, store *portal.Store, a portal.Admission) error {
+	if net.ParseIP(a.IP).To4() == nil {
+		return fmt.Errorf("%q is not an IPv4 address", a.IP)
+	}
+	if manager.RulesLoaded() {
+		if err := manager.AdmitClient(a.IP); err != nil {
+			return err
+		}
+	}
+	return store.Add(a)
+}
+
+// expireAdmissions revokes admissions as they run out until ctx is done
+func expireAdmissions(ctx context.Context, manager *nat.Manager, store *portal.Store) {
+	ticker := time.NewTicker(portalExpireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := store.Expire(now)
+			if err != nil {
+				logging.Component(logging.NAT).Warn("failed to expire portal admissions", "error", err)
+			}
+			for _, a := range expired {
+				if err := manager.RevokeClient(a.IP); err != nil {
+					logging.Component(logging.NAT).Warn("failed to revoke portal admission", "ip", a.IP, "error", err)
+				}
+			}
+		}
+	}
+}
+
+// leaseMAC returns the MAC address leased ip, or ""
+func leaseMAC(manager *nat.Manager, ip string) string {
+	leases, _ := manager.GetLeases()
+	for _, lease := range leases {
+		if lease.IP == ip {
+			return strings.ToLower(lease.MAC)
+		}
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(portalCmd)
+	portalCmd.AddCommand(portalServeCmd)
+	portalCmd.AddCommand(portalAdmitCmd)
+	portalCmd.AddCommand(portalRevokeCmd)
+}
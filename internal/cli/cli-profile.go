@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+)
+
+var profileDefaults bool
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage named configuration profiles",
+	Long: `Manage named configuration profiles such as vm-lab, iot or travel.
+
+Profiles are complete configurations stored in
+~/.config/nat-manager/profiles/<name>.yaml. Select one with --profile on
+start, stop, status or any other command, e.g. to change its settings with
+'config set'. Without --profile the instance's own config.yaml is used.
+
+Example:
+  nat-manager profile create vm-lab
+  nat-manager profile copy vm-lab iot
+  nat-manager config set --profile iot internal_network 192.168.50
+  sudo nat-manager start --profile iot
+  nat-manager profile list
+  nat-manager profile delete travel`,
+}
+
+// profileListCmd represents the profile list command
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		names, err := config.ListProfiles()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Fprintf(stdout, "No profiles, create one with 'nat-manager profile create <name>'\n")
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "%-20s %-10s %-10s %s\n", "PROFILE", "EXTERNAL", "INTERNAL", "NETWORK")
+		for _, name := range names {
+			cfg, err := config.LoadProfile(name)
+			if err != nil {
+				fmt.Fprintf(stdout, "%-20s ❌ %v\n", name, err)
+				continue
+			}
+			fmt.Fprintf(stdout, "%-20s %-10s %-10s %s.0/24\n", name, orDash(cfg.ExternalInterface), cfg.InternalInterface, cfg.InternalNetwork)
+		}
+		return nil
+	},
+}
+
+// profileCreateCmd represents the profile create command
+var profileCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a profile from the current configuration",
+	Long: `Create a profile from the current configuration, or from the
+defaults with --defaults.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		cfg := config.Default()
+		if !profileDefaults {
+			var err error
+			if cfg, err = config.Load(); err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+		}
+		if err := config.CreateProfile(args[0], cfg); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Profile %s created\n", args[0])
+		return nil
+	},
+}
+
+// profileCopyCmd represents the profile copy command
+var profileCopyCmd = &cobra.Command{
+	Use:   "copy <from> <to>",
+	Short: "Copy a profile",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if err := config.CopyProfile(args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Profile %s copied to %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+// profileDeleteCmd represents the profile delete command
+var profileDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if err := config.DeleteProfile(args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Profile %s deleted\n", args[0])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileCreateCmd)
+	profileCmd.AddCommand(profileCopyCmd)
+	profileCmd.AddCommand(profileDeleteCmd)
+
+	profileCreateCmd.Flags().BoolVar(&profileDefaults, "defaults", false, "start from the default configuration")
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
 	"github.com/scttfrdmn/macos-nat-manager/internal/config"
 	"github.com/scttfrdmn/macos-nat-manager/internal/tui"
 )
@@ -22,9 +23,15 @@ var (
 )
 
 var (
-	cfgFile    string
-	verbose    bool
-	configPath string
+	cfgFile      string
+	verbose      bool
+	configPath   string
+	instanceName string
+	profileName  string
+
+	// hostChecked is set once the platform and privileges have been
+	// checked, so that the commands of a batch are checked once
+	hostChecked bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -44,6 +51,8 @@ Features:
 - Clean setup and teardown
 - Network isolation and privacy`,
 	Version: fmt.Sprintf("%s (%s) built on %s", Version, Commit, Date),
+	// Errors are printed by main, which also picks the exit code
+	SilenceErrors: true,
 	Run: func(cmd *cobra.Command, args []string) {
 		// If no subcommand is provided, launch TUI
 		if len(args) == 0 {
@@ -56,7 +65,11 @@ Features:
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() error {
-	return rootCmd.Execute()
+	usageArgs(rootCmd)
+	err := unknownCommand(rootCmd.Execute())
+	closeEventSinks()
+	closeLogging()
+	return err
 }
 
 func init() {
@@ -66,6 +79,14 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.nat-manager.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().StringVar(&configPath, "config-path", "", "path to store configuration")
+	rootCmd.PersistentFlags().StringVar(&instanceName, "instance", "", "NAT instance to manage (default \"default\")")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "use a named configuration profile (see 'profile list')")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "output format of listings and status (table, json or yaml)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "", "log level: debug, info, warn or error (default from logging.level, else info)")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "suppress decorative output; rely on the exit code")
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "answer yes to confirmation prompts")
+	rootCmd.PersistentFlags().BoolVar(&assumeYes, "non-interactive", false, "never prompt, for automation (same as --yes)")
+	rootCmd.SetFlagErrorFunc(usageError)
 
 	// Bind flags to viper
 	_ = viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
@@ -90,22 +111,54 @@ func initConfig() {
 
 	viper.AutomaticEnv() // read in environment variables that match
 
+	cobra.CheckErr(config.SetInstance(instanceName))
+	cobra.CheckErr(config.SetProfile(profileName))
+	cobra.CheckErr(validateOutputFormat(outputFormat))
+	cobra.CheckErr(validateLogLevel())
+
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil && verbose {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 
+	if completing() || generatingDocs() || hostChecked {
+		return
+	}
+	silenceOutput()
+
 	// Validate we're on macOS
 	if runtime.GOOS != "darwin" {
 		fmt.Fprintf(os.Stderr, "Error: This tool only works on macOS, detected: %s\n", runtime.GOOS)
 		os.Exit(1)
 	}
+	setupLogging()
 
-	// Check for root privileges
+	// Check for root privileges; without them the TUI runs read-only and
+	// some commands go through the privileged helper
 	if os.Geteuid() != 0 {
+		if launchingTUI() {
+			connectHelper()
+			hostChecked = true
+			return
+		}
+		if runsWithoutRoot() {
+			hostChecked = true
+			return
+		}
 		fmt.Fprintln(os.Stderr, "Error: This tool requires root privileges. Please run with sudo.")
-		os.Exit(1)
+		os.Exit(ExitPermission)
 	}
+	hostChecked = true
+	audit.SetSystem(openAuditLog())
+	registerWebhooks()
+	registerNotifications()
+}
+
+// launchingTUI reports whether the command line runs the TUI, that is the
+// root command without a subcommand
+func launchingTUI() bool {
+	cmd, _, err := rootCmd.Find(os.Args[1:])
+	return err == nil && cmd == rootCmd
 }
 
 func launchTUI() {
@@ -116,6 +169,13 @@ func launchTUI() {
 	}
 
 	app := tui.NewApp(cfg)
+	app.SetReadOnly(os.Geteuid() != 0)
+	if helperClient != nil {
+		app.SetHelper(helperClient)
+	}
+	app.SetScheduleSaver(func(cfg *config.Config) error {
+		return saveSchedule(cfg, func(string) {})
+	})
 	if err := app.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,291 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/launchd"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var (
+	scheduleAt   string
+	scheduleDays string
+	scheduleName string
+)
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Start and stop NAT at set times",
+	Long: `Start and stop NAT at set times of day, e.g. start the lab network at
+9am on weekdays and stop it at 7pm.
+
+Schedule entries are saved in the schedule section of the instance's
+configuration and run by launchd calendar jobs, one per entry, which are
+updated whenever entries are added or removed. When run with sudo the jobs
+are installed as LaunchDaemons. Scheduled starts use the interfaces in the
+configuration, so run 'start' once or set them with 'config set' first.
+
+Example:
+  nat-manager schedule add start --at 09:00 --days mon-fri
+  nat-manager schedule add stop --at 19:00 --days mon-fri
+  nat-manager schedule list
+  nat-manager schedule remove stop-1900`,
+}
+
+// scheduleListCmd represents the schedule list command
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List schedule entries",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		if outputFormat != outputTable {
+			entries := cfg.Schedule
+			if entries == nil {
+				entries = []config.ScheduleEntry{}
+			}
+			return writeOutput(os.Stdout, outputFormat, entries)
+		}
+
+		if len(cfg.Schedule) == 0 {
+			fmt.Fprintf(stdout, "No schedule entries\n")
+			return nil
+		}
+
+		fmt.Fprintf(stdout, "%-16s %-7s %-6s %-16s %s\n", "NAME", "ACTION", "AT", "DAYS", "JOB")
+		fmt.Fprintf(stdout, "%-16s %-7s %-6s %-16s %s\n",
+			strings.Repeat("-", 16),
+			strings.Repeat("-", 7),
+			strings.Repeat("-", 6),
+			strings.Repeat("-", 16),
+			strings.Repeat("-", 9))
+		for _, entry := range cfg.Schedule {
+			days := entry.Days
+			if days == "" {
+				days = "daily"
+			}
+			job := "missing"
+			if launchd.Installed(scheduleLabel(entry.Name)) {
+				job = "installed"
+			}
+			fmt.Fprintf(stdout, "%-16s %-7s %-6s %-16s %s\n", entry.Name, entry.Action, entry.At, days, job)
+		}
+		return nil
+	},
+}
+
+// scheduleAddCmd represents the schedule add command
+var scheduleAddCmd = &cobra.Command{
+	Use:   "add <start|stop>",
+	Short: "Start or stop NAT at a time of day",
+	Long: `Add a schedule entry starting or stopping NAT at a time of day, every
+day or on the given days, and install its launchd job.
+
+Days are a comma-separated list of days and ranges of days: mon-fri,
+sat,sun or mon,wed,fri. The entry is named after its action and time
+unless --name is given.
+
+Example:
+  nat-manager schedule add start --at 09:00 --days mon-fri
+  nat-manager schedule add stop --at 23:30 --name nightly`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{config.ScheduleStart, config.ScheduleStop},
+	RunE: func(_ *cobra.Command, args []string) error {
+		entry := config.ScheduleEntry{Name: scheduleName, Action: args[0], At: scheduleAt, Days: scheduleDays}
+		if entry.Name == "" {
+			entry.Name = entry.Action + "-" + strings.ReplaceAll(entry.At, ":", "")
+		}
+
+		return updateSchedule(func(cfg *config.Config) error {
+			cfg.Schedule = append(cfg.Schedule, entry)
+			return nil
+		})
+	},
+}
+
+// scheduleRemoveCmd represents the schedule remove command
+var scheduleRemoveCmd = &cobra.Command{
+	Use:   "remove <name>...",
+	Short: "Remove schedule entries",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		return updateSchedule(func(cfg *config.Config) error {
+			for _, name := range args {
+				i := slices.IndexFunc(cfg.Schedule, func(entry config.ScheduleEntry) bool { return entry.Name == name })
+				if i < 0 {
+					return fmt.Errorf("no schedule entry %q", name)
+				}
+				cfg.Schedule = slices.Delete(cfg.Schedule, i, i+1)
+			}
+			return nil
+		})
+	},
+}
+
+// scheduleSyncCmd represents the schedule sync command
+var scheduleSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Install the launchd jobs of the schedule",
+	Long: `Install the launchd jobs of the schedule entries in the configuration
+and remove jobs of entries that no longer exist, e.g. after editing the
+configuration or changing interfaces.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		return syncScheduleJobs(cfg, printJobChange)
+	},
+}
+
+// updateSchedule changes the schedule, saves it and updates its jobs
+func updateSchedule(update func(*config.Config) error) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := update(cfg); err != nil {
+		return err
+	}
+	return saveSchedule(cfg, printJobChange)
+}
+
+// saveSchedule validates and saves the schedule of cfg and updates its
+// jobs, reporting each job installed or removed
+func saveSchedule(cfg *config.Config, report func(string)) error {
+	if err := config.ValidateSchedule(cfg.Schedule); err != nil {
+		return err
+	}
+	if _, err := scheduleJobs(cfg, nil, ""); err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return syncScheduleJobs(cfg, report)
+}
+
+// printJobChange prints a job installed or removed
+func printJobChange(change string) {
+	fmt.Fprintf(stdout, "✅ %s\n", change)
+}
+
+// syncScheduleJobs installs a job per schedule entry and removes the jobs
+// of entries that no longer exist
+func syncScheduleJobs(cfg *config.Config, report func(string)) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate nat-manager: %w", err)
+	}
+	dir, err := config.BaseDir()
+	if err != nil {
+		return fmt.Errorf("failed to get config directory: %w", err)
+	}
+	program := []string{exe}
+	if instance := config.Instance(); instance != nat.DefaultInstance {
+		program = append(program, "--instance", instance)
+	}
+	if profile := config.Profile(); profile != "" {
+		program = append(program, "--profile", profile)
+	}
+	jobs, err := scheduleJobs(cfg, program, filepath.Join(dir, "schedule.log"))
+	if err != nil {
+		return err
+	}
+
+	installed, err := launchd.List()
+	if err != nil {
+		return err
+	}
+	for _, label := range installed {
+		if strings.HasPrefix(label, scheduleLabel("")) && !slices.ContainsFunc(jobs, func(job launchd.Job) bool { return job.Label == label }) {
+			if err := launchd.Uninstall(label); err != nil {
+				return err
+			}
+			report(fmt.Sprintf("Removed launchd job %s", label))
+		}
+	}
+	for _, job := range jobs {
+		path, err := launchd.Install(job)
+		if err != nil {
+			return err
+		}
+		report(fmt.Sprintf("Installed launchd job %s (%s)", job.Label, path))
+	}
+	return nil
+}
+
+// scheduleJobs returns the launchd job of every schedule entry, running
+// program with the entry's action
+func scheduleJobs(cfg *config.Config, program []string, logPath string) ([]launchd.Job, error) {
+	jobs := make([]launchd.Job, 0, len(cfg.Schedule))
+	for _, entry := range cfg.Schedule {
+		hour, minute, err := entry.Time()
+		if err != nil {
+			return nil, err
+		}
+		days, err := entry.Weekdays()
+		if err != nil {
+			return nil, err
+		}
+		calendar := []launchd.CalendarInterval{{Hour: hour, Minute: minute}}
+		if len(days) > 0 {
+			calendar = calendar[:0]
+			for _, day := range days {
+				calendar = append(calendar, launchd.CalendarInterval{Hour: hour, Minute: minute, Weekday: day})
+			}
+		}
+
+		args := append([]string{}, program...)
+		switch entry.Action {
+		case config.ScheduleStart:
+			if cfg.ExternalInterface == "" || cfg.InternalInterface == "" {
+				return nil, fmt.Errorf("schedule entry %q starts NAT but no interfaces are configured: run 'start' once or set external_interface", entry.Name)
+			}
+			args = append(args, "start", "--external", cfg.ExternalInterface, "--internal", cfg.InternalInterface)
+		default:
+			args = append(args, "stop")
+		}
+
+		jobs = append(jobs, launchd.Job{
+			Label:       scheduleLabel(entry.Name),
+			Program:     args,
+			Calendar:    calendar,
+			Environment: map[string]string{"HOME": os.Getenv("HOME")},
+			LogPath:     logPath,
+		})
+	}
+	return jobs, nil
+}
+
+// scheduleLabel returns the launchd label of a schedule entry of the
+// selected instance
+func scheduleLabel(name string) string {
+	return launchd.LabelPrefix + "schedule." + config.Instance() + "." + name
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.AddCommand(scheduleListCmd)
+	scheduleCmd.AddCommand(scheduleAddCmd)
+	scheduleCmd.AddCommand(scheduleRemoveCmd)
+	scheduleCmd.AddCommand(scheduleSyncCmd)
+
+	scheduleAddCmd.Flags().StringVar(&scheduleAt, "at", "", "time of day, HH:MM")
+	scheduleAddCmd.Flags().StringVar(&scheduleDays, "days", "", "days to run on, e.g. mon-fri or sat,sun (default every day)")
+	scheduleAddCmd.Flags().StringVar(&scheduleName, "name", "", "entry name (default <action>-<HHMM>)")
+	_ = scheduleAddCmd.MarkFlagRequired("at")
+}
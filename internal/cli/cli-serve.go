@@ -0,0 +1,305 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/metrics"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/rpc"
+)
+
+var (
+	serveListen string
+	serveGRPC   string
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve a JSON REST API to control NAT",
+	Long: `Serve a JSON REST API on a loopback address so scripts, dashboards and
+GUIs can read and control the instance:
+
+  GET    /api/v1/status         status, as 'status -o json'
+  GET    /api/v1/summary        NAT state, devices online and traffic, for
+                                menu bar apps
+  GET    /api/v1/events         server-sent events: the summary every
+                                ?interval (2s), nat.started, nat.stopped,
+                                device.joined and device.left
+  GET    /api/v1/devices        devices, as 'devices --json'
+  GET    /api/v1/connections    active connections
+  GET    /api/v1/forwards       port forwards
+  POST   /api/v1/forwards       add a port forward, e.g.
+                                {"protocol":"tcp","external_port":8080,
+                                 "internal_ip":"192.168.100.50","internal_port":80}
+  DELETE /api/v1/forwards/PORT  remove the port forwards of an external port
+  POST   /api/v1/start          start NAT with the saved configuration
+  POST   /api/v1/stop           stop NAT
+
+With --grpc, the gRPC service defined in proto/natmanager/v1 is served
+too, on its own loopback address. Besides the calls above it streams
+connections as they open and close, devices as they join and leave, and
+per-device traffic with rates.
+
+Requests must send the token stored in the configuration directory's
+api-token file, created on first use, as 'Authorization: Bearer <token>'.
+Errors are answered as {"error": "..."}. /healthz and /metrics need no
+token. Every request is recorded in the audit log.
+
+Example:
+  sudo nat-manager serve --listen 127.0.0.1:8732
+  sudo nat-manager serve --grpc 127.0.0.1:8733
+  curl -H "Authorization: Bearer $(sudo cat ~/.config/nat-manager/api-token)" \
+    http://127.0.0.1:8732/api/v1/status`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		listen := serveListen
+		if listen == "" {
+			listen = cfg.API.Listen
+		}
+		tokenPath, err := config.GetAPITokenPath()
+		if err != nil {
+			return fmt.Errorf("failed to get API token path: %w", err)
+		}
+		token, err := api.LoadToken(tokenPath)
+		if err != nil {
+			return err
+		}
+
+		auditLog := openAuditLog()
+		defer func() { _ = auditLog.Close() }()
+		server, err := api.New(api.Config{
+			Listen:      listen,
+			Diagnostics: cfg.API.Diagnostics,
+			Token:       token,
+			Audit:       auditLog,
+			Metrics:     metrics.Default,
+		})
+		if err != nil {
+			return err
+		}
+		ctrl := &restController{}
+		server.RegisterREST(ctrl, token)
+
+		listener, err := server.Listen()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "🌐 REST API listening on http://%s%s\n", server.Addr(), api.RESTPrefix)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if serveGRPC != "" {
+			grpcListener, err := rpc.Listen(serveGRPC)
+			if err != nil {
+				return err
+			}
+			grpcServer := rpc.New(ctrl, rpc.Config{Token: token, Audit: auditLog})
+			go func() {
+				<-ctx.Done()
+				grpcServer.Stop()
+			}()
+			go func() {
+				if err := grpcServer.Serve(grpcListener); err != nil {
+					logging.Component(logging.API).Error("gRPC server failed", "error", err)
+				}
+			}()
+			fmt.Fprintf(stdout, "🌐 gRPC API listening on %s\n", grpcListener.Addr())
+		}
+		fmt.Fprintf(stdout, "   Token: %s\n", tokenPath)
+		return server.Serve(ctx, listener)
+	},
+}
+
+// restController serves the REST and gRPC APIs from the saved
+// configuration, which is loaded again for every request so changes made
+// by other commands show
+type restController struct {
+	mu sync.Mutex // serializes changes
+}
+
+// manager returns the configuration and a manager for it
+func (c *restController) manager() (*config.Config, *nat.Manager, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfg, nat.NewManager(cfg.ToNATConfig()), nil
+}
+
+// Status returns the status, active when the instance's rules are loaded
+// whichever process started it
+func (c *restController) Status() (*nat.Status, error) {
+	_, manager, err := c.manager()
+	if err != nil {
+		return nil, err
+	}
+	return restStatus(manager)
+}
+
+// restStatus returns the status of manager's instance
+func restStatus(manager *nat.Manager) (*nat.Status, error) {
+	status, err := manager.GetStatus()
+	if err != nil {
+		return nil, err
+	}
+	status.Active = manager.RulesLoaded()
+	status.Running = status.Active
+	return status, nil
+}
+
+func (c *restController) Devices() ([]nat.Device, error) {
+	_, manager, err := c.manager()
+	if err != nil {
+		return nil, err
+	}
+	devices, err := manager.Devices()
+	if devices == nil && err == nil {
+		devices = []nat.Device{}
+	}
+	return devices, err
+}
+
+func (c *restController) Connections() ([]nat.Connection, error) {
+	_, manager, err := c.manager()
+	if err != nil {
+		return nil, err
+	}
+	connections, err := manager.GetActiveConnections()
+	if connections == nil && err == nil {
+		connections = []nat.Connection{}
+	}
+	return connections, err
+}
+
+func (c *restController) KillConnections(ip string) (int, error) {
+	if net.ParseIP(ip).To4() == nil {
+		return 0, fmt.Errorf("%w: %q is not an IPv4 address", api.ErrInvalid, ip)
+	}
+	_, manager, err := c.manager()
+	if err != nil {
+		return 0, err
+	}
+	return manager.KillStates(ip)
+}
+
+func (c *restController) Traffic() (map[string]nat.Traffic, error) {
+	_, manager, err := c.manager()
+	if err != nil {
+		return nil, err
+	}
+	return manager.DeviceTraffic(), nil
+}
+
+func (c *restController) Forwards() ([]config.PortForward, error) {
+	cfg, _, err := c.manager()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PortForwards == nil {
+		return []config.PortForward{}, nil
+	}
+	return cfg.PortForwards, nil
+}
+
+func (c *restController) AddForward(forward config.PortForward) error {
+	return c.updateForwards(func(forwards []config.PortForward) ([]config.PortForward, error) {
+		return append(forwards, forward), nil
+	})
+}
+
+func (c *restController) RemoveForward(externalPort int) error {
+	return c.updateForwards(func(forwards []config.PortForward) ([]config.PortForward, error) {
+		kept := slices.DeleteFunc(slices.Clone(forwards), func(f config.PortForward) bool {
+			return f.ExternalPort == externalPort
+		})
+		if len(kept) == len(forwards) {
+			return nil, fmt.Errorf("%w: no port forward for port %d", api.ErrNotFound, externalPort)
+		}
+		return kept, nil
+	})
+}
+
+// updateForwards validates, applies and saves the forwards update returns
+func (c *restController) updateForwards(update func([]config.PortForward) ([]config.PortForward, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cfg, _, err := c.manager()
+	if err != nil {
+		return err
+	}
+	if cfg.PortForwards, err = update(cfg.PortForwards); err != nil {
+		return err
+	}
+	if err := nat.ValidatePortForwards(cfg.NATPortForwards(), cfg.InternalNetwork); err != nil {
+		return fmt.Errorf("%w: %w", api.ErrInvalid, err)
+	}
+	if err := nat.NewManager(cfg.ToNATConfig()).ApplyRules(); err != nil {
+		return fmt.Errorf("no changes made: %w", err)
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+func (c *restController) Start() (*nat.Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cfg, manager, err := c.manager()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ExternalInterface == "" || cfg.InternalInterface == "" {
+		return nil, fmt.Errorf("%w: no saved configuration, run 'start' once", api.ErrInvalid)
+	}
+	if manager.RulesLoaded() {
+		return nil, nat.ErrAlreadyRunning
+	}
+	if err := manager.StartNAT(); err != nil {
+		return nil, fmt.Errorf("failed to start NAT: %w", err)
+	}
+	return restStatus(manager)
+}
+
+func (c *restController) Stop() (*nat.Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, manager, err := c.manager()
+	if err != nil {
+		return nil, err
+	}
+	if !manager.RulesLoaded() {
+		return nil, nat.ErrNotRunning
+	}
+	if err := manager.StopNAT(); err != nil {
+		return nil, fmt.Errorf("failed to stop NAT: %w", err)
+	}
+	return restStatus(manager)
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	serveCmd.Flags().StringVar(&serveListen, "listen", "", fmt.Sprintf("loopback address to listen on (default api.listen or %s)", api.DefaultListen))
+	serveCmd.Flags().StringVar(&serveGRPC, "grpc", "", "also serve the gRPC API on this loopback address, e.g. 127.0.0.1:8733")
+}
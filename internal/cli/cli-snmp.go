@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/snmp"
+)
+
+// snmpCmd represents the snmp command
+var snmpCmd = &cobra.Command{
+	Use:   "snmp",
+	Short: "Serve interface and NAT statistics over SNMP",
+	Long: `Serve the interface counters, lease counts and NAT state of the instance
+through a minimal read-only SNMPv1/v2c agent, so classic network management
+tools can monitor the gateway. Once snmp.enabled is set, 'start
+--foreground' and the daemon run the agent on their own.
+
+The agent listens on snmp.listen (<gateway>:161, the internal network only)
+and answers requests with snmp.community (public). Sets are refused. It
+serves:
+
+  system          SNMPv2-MIB sysDescr, sysUpTime, sysName, sysContact
+                  (snmp.contact), sysLocation (snmp.location)
+  ifTable         IF-MIB counters of the internal and external interface
+  ifXTable        ifName and the 64-bit octet and packet counters
+  NAT-MANAGER-MIB natActive, natExternalAddress, natConnections,
+                  natDevices, natDevicesOnline, natLeases, natDhcpRunning,
+                  natBytesIn, natBytesOut (1.3.6.1.4.1.8072.9999.9999.1)
+
+The state is read again at most every 5 seconds. 'nat-manager snmp mib'
+prints NAT-MANAGER-MIB for the management tool.
+
+Example:
+  nat-manager config set snmp.community s3cret
+  nat-manager config set snmp.location "Lab bench 3"
+  nat-manager config set snmp.enabled true
+  sudo nat-manager snmp serve
+  snmpwalk -v2c -c s3cret 192.168.100.1 1.3.6.1.4.1.8072.9999.9999.1`,
+}
+
+// snmpServeCmd represents the snmp serve command
+var snmpServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the SNMP agent in the foreground",
+	Long: `Run the SNMP agent until interrupted, for NAT that is not run by
+'start --foreground' or the daemon, which run it on their own.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		manager := nat.NewManager(cfg.ToNATConfig())
+		agent, err := snmp.Listen(cfg.SNMPOptions(), snmpCollect(cfg, manager, time.Now()))
+		if err != nil {
+			return err
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Fprintf(stdout, "📟 SNMP agent listening on %s - press Ctrl+C to stop\n", agent.Addr())
+		return agent.Serve(ctx, logSNMPError)
+	},
+}
+
+// snmpMIBCmd represents the snmp mib command
+var snmpMIBCmd = &cobra.Command{
+	Use:   "mib",
+	Short: "Print NAT-MANAGER-MIB",
+	Long: `Print NAT-MANAGER-MIB, which describes the NAT objects of the agent, to
+load into a management tool.
+
+Example:
+  nat-manager snmp mib > NAT-MANAGER-MIB.txt`,
+	Args:        cobra.NoArgs,
+	Annotations: map[string]string{helperAnnotation: helperNone},
+	Run: func(_ *cobra.Command, _ []string) {
+		fmt.Fprint(os.Stdout, snmp.MIBText)
+	},
+}
+
+// snmpCollect returns the objects of manager's instance for an agent
+// started at started
+func snmpCollect(cfg *config.Config, manager *nat.Manager, started time.Time) func() (*snmp.MIB, error) {
+	hostname, _ := os.Hostname()
+	return func() (*snmp.MIB, error) {
+		status, err := restStatus(manager)
+		if err != nil {
+			return nil, err
+		}
+		devices, err := manager.Devices()
+		if err != nil {
+			return nil, err
+		}
+		leases, _ := manager.GetLeases()
+		current := 0
+		for _, lease := range leases {
+			if lease.Expiry.IsZero() || lease.Expiry.After(time.Now()) {
+				current++
+			}
+		}
+		return snmp.Build(snmp.Snapshot{
+			Description: fmt.Sprintf("macOS NAT Manager %s, instance %s", Version, config.Instance()),
+			Name:        hostname,
+			Contact:     cfg.SNMP.Contact,
+			Location:    cfg.SNMP.Location,
+			Uptime:      time.Since(started),
+			Instance:    config.Instance(),
+			Status:      status,
+			Interfaces:  snmp.Interfaces(status.Interfaces),
+			Devices:     devices,
+			Leases:      current,
+		}), nil
+	}
+}
+
+// logSNMPError logs the errors of SNMP requests, rejected ones at debug
+// level
+func logSNMPError(err error) {
+	if errors.Is(err, snmp.ErrRejected) {
+		logging.Component(logging.NAT).Debug("SNMP request rejected", "error", err)
+		return
+	}
+	logging.Component(logging.NAT).Warn("SNMP request failed", "error", err)
+}
+
+// startSNMP runs the SNMP agent of manager's instance in the background
+// until ctx is done, when enabled
+func startSNMP(ctx context.Context, cfg *config.Config, manager *nat.Manager) {
+	if !cfg.SNMP.Enabled {
+		return
+	}
+	agent, err := snmp.Listen(cfg.SNMPOptions(), snmpCollect(cfg, manager, time.Now()))
+	if err != nil {
+		logging.Component(logging.NAT).Warn("SNMP agent disabled", "error", err)
+		return
+	}
+	go func() {
+		if err := agent.Serve(ctx, logSNMPError); err != nil {
+			logging.Component(logging.NAT).Warn("SNMP agent stopped", "error", err)
+		}
+	}()
+	fmt.Fprintf(stdout, "📟 SNMP agent listening on %s\n", agent.Addr())
+}
+
+func init() {
+	rootCmd.AddCommand(snmpCmd)
+	snmpCmd.AddCommand(snmpServeCmd)
+	snmpCmd.AddCommand(snmpMIBCmd)
+}
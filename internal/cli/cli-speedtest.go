@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var speedOptions nat.SpeedTestOptions
+
+// speedtestCmd represents the speedtest command
+var speedtestCmd = &cobra.Command{
+	Use:   "speedtest",
+	Short: "Measure throughput through the NAT path",
+	Long: `Measure download and upload throughput from the host out the external
+interface, and with --device the throughput of an internal client.
+
+For a device test nat-manager runs a one-off iperf3 server on the host's
+external address and waits for the device to connect with
+'iperf3 -c <address>' to measure its upload, or 'iperf3 -c <address> -R'
+for its download. That traffic crosses the shaping rules of the internal
+interface, so the result is checked against the device's cap.
+
+When bandwidth guarantees are configured, the host's results are checked
+against the link capacities they are computed from. The command fails if
+a measurement fails or shaping does not behave as configured.
+
+Example:
+  nat-manager speedtest
+  nat-manager speedtest --duration 5s -o json
+  nat-manager speedtest --device 192.168.100.50`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if speedOptions.Device != "" && net.ParseIP(speedOptions.Device).To4() == nil {
+			return fmt.Errorf("invalid device %q: expected an IPv4 address", speedOptions.Device)
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		manager := nat.NewManager(cfg.ToNATConfig())
+		if !manager.IsActive() {
+			return nat.ErrNotRunning
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		fmt.Fprintf(os.Stderr, "⏱️  Measuring for %s in each direction...\n", speedOptions.Duration)
+		if speedOptions.Device != "" {
+			address := "<" + cfg.ExternalInterface + " address>"
+			if status, err := manager.GetStatus(); err == nil && net.ParseIP(status.ExternalIP) != nil {
+				address = status.ExternalIP
+			}
+			fmt.Fprintf(os.Stderr, "📱 Then run on %s: iperf3 -c %s -p %d, with -R to measure its download\n",
+				speedOptions.Device, address, speedOptions.Port)
+		}
+		results := manager.SpeedTest(ctx, speedOptions)
+
+		if outputFormat != outputTable {
+			if err := writeOutput(os.Stdout, outputFormat, results); err != nil {
+				return err
+			}
+		} else {
+			printSpeedResults(results)
+		}
+		failed := 0
+		for _, result := range results {
+			if !result.Passed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d measurements failed", failed, len(results))
+		}
+		return nil
+	},
+}
+
+func printSpeedResults(results []nat.SpeedResult) {
+	fmt.Fprintf(stdout, "🚀 Throughput:\n")
+	for _, result := range results {
+		mark := "✅"
+		if !result.Passed {
+			mark = "❌"
+		}
+		fmt.Fprintf(stdout, "   %s %-30s %s (%s)\n", mark, result.Name, result.Detail, result.Duration.Round(time.Millisecond))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(speedtestCmd)
+
+	speedtestCmd.Flags().StringVar(&speedOptions.Device, "device", "", "IPv4 address of an internal client running iperf3")
+	speedtestCmd.Flags().DurationVar(&speedOptions.Duration, "duration", 10*time.Second, "length of each measurement")
+	speedtestCmd.Flags().StringVar(&speedOptions.DownloadURL, "download-url", nat.DefaultDownloadURL, "URL downloaded to measure the downlink")
+	speedtestCmd.Flags().StringVar(&speedOptions.UploadURL, "upload-url", nat.DefaultUploadURL, "URL posted to to measure the uplink")
+	speedtestCmd.Flags().IntVar(&speedOptions.Port, "port", nat.DefaultIperfPort, "port of the iperf3 server for --device")
+	speedtestCmd.Flags().DurationVar(&speedOptions.Wait, "wait", 2*time.Minute, "how long to wait for the device's iperf3 test")
+}
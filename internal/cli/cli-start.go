@@ -1,12 +1,18 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
 	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
 	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
 )
 
@@ -17,6 +23,7 @@ var (
 	dhcpStart         string
 	dhcpEnd           string
 	dnsServers        []string
+	startForeground   bool
 )
 
 // startCmd represents the start command
@@ -34,7 +41,16 @@ This will:
 
 Example:
   nat-manager start --external en0 --internal bridge100 --network 192.168.100
-  nat-manager start -e en1 -i bridge101 -n 10.0.1 --dhcp-start 10.0.1.100 --dhcp-end 10.0.1.200`,
+  nat-manager start -e en1 -i bridge101 -n 10.0.1 --dhcp-start 10.0.1.100 --dhcp-end 10.0.1.200
+  nat-manager start -e en0 -i bridge100 --attach-vm-network vmnet8
+
+With --foreground, start stays attached and logs what happens as
+structured lines on stderr: DHCP leases granted and released, watchdog
+restarts of the DHCP server, uplink changes and rule reloads (pf state
+counts too with --verbose). Rules are re-applied when the uplink's address
+or the default route changes. Ctrl+C stops NAT and tears everything down.
+
+  nat-manager start -e en0 -i bridge100 --foreground`,
 	RunE: func(_ *cobra.Command, _ []string) error {
 		// Load existing config
 		cfg, err := config.Load()
@@ -61,6 +77,9 @@ Example:
 		if len(dnsServers) > 0 {
 			cfg.DNSServers = dnsServers
 		}
+		if len(attachVMNetworks) > 0 {
+			cfg.VMNetworks = attachVMNetworks
+		}
 
 		// Validate required fields
 		if cfg.ExternalInterface == "" {
@@ -69,27 +88,22 @@ Example:
 		if cfg.InternalInterface == "" {
 			return fmt.Errorf("internal interface is required (use --internal or -i)")
 		}
+		if len(cfg.VMNetworks) > 0 && !strings.HasPrefix(cfg.InternalInterface, "bridge") {
+			return exitWith(ExitUsage, fmt.Errorf("VM networks can only join a bridge, not %s", cfg.InternalInterface))
+		}
+		if err := config.ValidateVMNetworks(cfg.VMNetworks); err != nil {
+			return exitWith(ExitUsage, err)
+		}
 
 		// Convert config to NAT config
-		natConfig := &nat.Config{
-			ExternalInterface: cfg.ExternalInterface,
-			InternalInterface: cfg.InternalInterface,
-			InternalNetwork:   cfg.InternalNetwork,
-			DHCPRange: nat.DHCPRange{
-				Start: cfg.DHCPRange.Start,
-				End:   cfg.DHCPRange.End,
-				Lease: cfg.DHCPRange.Lease,
-			},
-			DNSServers: cfg.DNSServers,
-			Active:     cfg.Active,
-		}
+		natConfig := cfg.ToNATConfig()
 
 		// Create NAT manager
 		manager := nat.NewManager(natConfig)
 
 		// Check if already running
 		if manager.IsActive() {
-			return fmt.Errorf("NAT is already running")
+			return nat.ErrAlreadyRunning
 		}
 
 		// Start NAT
@@ -99,31 +113,81 @@ Example:
 
 		// Save config for future use
 		if err := cfg.Save(); err != nil {
-			fmt.Printf("Warning: failed to save config: %v\n", err)
+			fmt.Fprintf(stdout, "Warning: failed to save config: %v\n", err)
+		}
+
+		fmt.Fprintf(stdout, "✅ NAT started successfully\n")
+		if profileName != "" {
+			fmt.Fprintf(stdout, "   Profile: %s\n", profileName)
+		}
+		fmt.Fprintf(stdout, "   External: %s\n", cfg.ExternalInterface)
+		fmt.Fprintf(stdout, "   Internal: %s (%s.1/24)\n", cfg.InternalInterface, cfg.InternalNetwork)
+		fmt.Fprintf(stdout, "   DHCP Range: %s - %s\n", cfg.DHCPRange.Start, cfg.DHCPRange.End)
+		fmt.Fprintf(stdout, "   DNS Servers: %s\n", strings.Join(cfg.DNSServers, ", "))
+		if cfg.LocalDomain != "" {
+			fmt.Fprintf(stdout, "   Local Domain: *.%s\n", cfg.LocalDomain)
+		}
+		if cfg.DNSForwarder.Enabled {
+			fmt.Fprintf(stdout, "   DNS Forwarder: %s (run 'nat-manager dns serve' to answer queries)\n", cfg.GetDNSListenAddr())
 		}
 
-		fmt.Printf("✅ NAT started successfully\n")
-		fmt.Printf("   External: %s\n", cfg.ExternalInterface)
-		fmt.Printf("   Internal: %s (%s.1/24)\n", cfg.InternalInterface, cfg.InternalNetwork)
-		fmt.Printf("   DHCP Range: %s - %s\n", cfg.DHCPRange.Start, cfg.DHCPRange.End)
-		fmt.Printf("   DNS Servers: %s\n", strings.Join(cfg.DNSServers, ", "))
+		if len(cfg.VMNetworks) > 0 {
+			fmt.Fprintf(stdout, "   VM Networks: %s\n", strings.Join(cfg.VMNetworks, ", "))
+			if !startForeground {
+				reportVMNetworks(cfg)
+			}
+		}
 
+		if startForeground {
+			return runForeground(cfg, manager)
+		}
 		return nil
 	},
 }
 
+// runForeground logs the running instance until interrupted, then stops it
+func runForeground(cfg *config.Config, manager *nat.Manager) error {
+	logger := logging.Component(logging.NAT)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	startAPIServer(ctx, cfg)
+	startMQTT(ctx, cfg, manager)
+	startFlowExport(ctx, cfg, manager)
+	startInflux(ctx, cfg, natPoints(manager))
+	startSNMP(ctx, cfg, manager)
+	startDDNS(ctx, cfg, manager)
+	startContainerVMs(ctx, cfg)
+	startVMNetworks(ctx, cfg)
+	defer startWireGuard(cfg)()
+
+	fmt.Fprintf(stdout, "\n🔄 Running in the foreground - press Ctrl+C to stop NAT\n\n")
+	manager.RunForeground(ctx, slog.Default())
+
+	logger.Info("stopping NAT")
+	if err := manager.StopNAT(); err != nil {
+		return fmt.Errorf("failed to stop NAT: %w", err)
+	}
+	logger.Info("NAT stopped")
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(startCmd)
 
 	// Interface flags
 	startCmd.Flags().StringVarP(&externalInterface, "external", "e", "", "external network interface (e.g., en0, en1)")
 	startCmd.Flags().StringVarP(&internalInterface, "internal", "i", "", "internal network interface (e.g., bridge100)")
+	_ = startCmd.RegisterFlagCompletionFunc("external", completeInterfaces)
+	_ = startCmd.RegisterFlagCompletionFunc("internal", completeInterfaces)
 
 	// Network configuration flags
 	startCmd.Flags().StringVarP(&internalNetwork, "network", "n", "", "internal network (e.g., 192.168.100)")
 	startCmd.Flags().StringVar(&dhcpStart, "dhcp-start", "", "DHCP range start (e.g., 192.168.100.100)")
 	startCmd.Flags().StringVar(&dhcpEnd, "dhcp-end", "", "DHCP range end (e.g., 192.168.100.200)")
 	startCmd.Flags().StringSliceVar(&dnsServers, "dns", []string{}, "DNS servers (comma-separated)")
+	startCmd.Flags().StringSliceVar(&attachVMNetworks, "attach-vm-network", []string{}, "put the VMs of a hypervisor network into the internal bridge (see 'nat-manager vm-networks')")
+	startCmd.Flags().BoolVar(&startForeground, "foreground", false, "stay attached, log events and stop NAT on Ctrl+C")
 
 	// Mark required flags with helpful messages
 	_ = startCmd.MarkFlagRequired("external")
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// stateCmd represents the state command
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Inspect runtime state of NAT instances",
+	Long: `Inspect the runtime state shared by all NAT instances.
+
+Several instances can run side by side (see --instance). Each loads its pf
+rules into its own anchor (nat-manager/<instance>), runs its own dnsmasq
+with a separate pidfile and lease file and uses its own range of dummynet
+pipes. An instance refuses to start while another running instance owns
+the same interface, network, anchor or files.
+
+Example:
+  nat-manager state show`,
+}
+
+// stateShowCmd represents the state show command
+var stateShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show running instances and the resources they own",
+	RunE: func(_ *cobra.Command, _ []string) error {
+		path, err := config.GetStateFilePath()
+		if err != nil {
+			return fmt.Errorf("failed to get state file path: %w", err)
+		}
+		registry, err := nat.LoadRegistry(path)
+		if err != nil {
+			return err
+		}
+
+		instances := registry.List()
+		if len(instances) == 0 {
+			fmt.Fprintf(stdout, "No NAT instances running\n")
+			return nil
+		}
+
+		for i, res := range instances {
+			if i > 0 {
+				fmt.Fprintln(stdout)
+			}
+			printInstance(res, nat.InstanceLive(res))
+		}
+		return nil
+	},
+}
+
+// printInstance prints an instance and the host resources it owns
+func printInstance(res nat.Resources, live bool) {
+	status := "🟢 running"
+	if !live {
+		status = "⚪ stale (cleaned up on next start)"
+	}
+	first, last := res.DummynetPipes()
+
+	name := res.Instance
+	if name == config.Instance() {
+		name += " (selected)"
+	}
+
+	fmt.Fprintf(stdout, "%s  %s\n", name, status)
+	fmt.Fprintf(stdout, "  %-16s %s\n", "Started:", res.Started.Local().Format(time.RFC1123))
+	fmt.Fprintf(stdout, "  %-16s %s\n", "pf anchor:", res.Anchor)
+	fmt.Fprintf(stdout, "  %-16s %s (%s.0/24)\n", "Interface:", res.InternalInterface, res.InternalNetwork)
+	fmt.Fprintf(stdout, "  %-16s %d-%d\n", "Dummynet:", first, last)
+	for _, file := range []struct{ label, path string }{
+		{"dnsmasq pidfile:", res.PIDFile},
+		{"Lease file:", res.LeaseFile},
+	} {
+		if file.path != "" {
+			fmt.Fprintf(stdout, "  %-16s %s\n", file.label, file.path)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateShowCmd)
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var (
+	statsSince time.Duration
+	statsCSV   bool
+)
+
+// statsCmd represents the stats command
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show traffic per device and uplink",
+	Long: `Show the bytes and packets each device received and sent, and the
+traffic over the uplink, since NAT started or over a recent window.
+
+Device traffic is counted by pf and kept in a ledger that survives rule
+reloads. The ledger holds a sample per minute for the last day.
+
+Example:
+  nat-manager stats
+  nat-manager stats --since 1h
+  nat-manager stats --since 24h --csv > usage.csv
+  nat-manager stats -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		manager := nat.NewManager(cfg.ToNATConfig())
+		if !manager.IsActive() {
+			return nat.ErrNotRunning
+		}
+		usage, err := manager.Usage(statsSince)
+		if err != nil {
+			return fmt.Errorf("failed to read traffic counters: %w", err)
+		}
+
+		switch {
+		case statsCSV:
+			return writeUsageCSV(os.Stdout, usage)
+		case outputFormat != outputTable:
+			return writeOutput(os.Stdout, outputFormat, usage)
+		}
+		printUsage(usage)
+		return nil
+	},
+}
+
+func printUsage(usage *nat.Usage) {
+	fmt.Fprintf(stdout, "📊 Traffic since %s (%s)\n\n", usage.Since.Local().Format("2006-01-02 15:04"),
+		usage.Until.Sub(usage.Since).Round(time.Minute))
+	if len(usage.Devices) == 0 {
+		fmt.Fprintf(stdout, "No device traffic counted\n")
+	} else {
+		fmt.Fprintf(stdout, "%-15s %-20s %10s %10s %10s %10s\n", "DEVICE", "HOSTNAME", "RECEIVED", "SENT", "PKTS IN", "PKTS OUT")
+		for _, device := range usage.Devices {
+			fmt.Fprintf(stdout, "%-15s %-20s %10s %10s %10d %10d\n", device.IP, truncate(orDash(device.Hostname), 20),
+				formatBytes(device.BytesIn), formatBytes(device.BytesOut), device.PacketsIn, device.PacketsOut)
+		}
+	}
+	for i, uplink := range usage.Uplinks {
+		if i == 0 {
+			fmt.Fprintf(stdout, "\n%-36s %10s %10s %10s %10s\n", "UPLINK", "RECEIVED", "SENT", "PKTS IN", "PKTS OUT")
+		}
+		fmt.Fprintf(stdout, "%-36s %10s %10s %10d %10d\n", uplink.Interface,
+			formatBytes(uplink.BytesIn), formatBytes(uplink.BytesOut), uplink.PacketsIn, uplink.PacketsOut)
+	}
+}
+
+// writeUsageCSV writes a row per device and uplink
+func writeUsageCSV(w io.Writer, usage *nat.Usage) error {
+	out := csv.NewWriter(w)
+	_ = out.Write([]string{"kind", "name", "mac", "hostname", "bytes_in", "bytes_out", "packets_in", "packets_out", "since", "until"})
+	row := func(kind, name, mac, hostname string, t nat.Traffic) {
+		_ = out.Write([]string{kind, name, mac, hostname,
+			strconv.FormatUint(t.BytesIn, 10), strconv.FormatUint(t.BytesOut, 10),
+			strconv.FormatUint(t.PacketsIn, 10), strconv.FormatUint(t.PacketsOut, 10),
+			usage.Since.Format(time.RFC3339), usage.Until.Format(time.RFC3339)})
+	}
+	for _, device := range usage.Devices {
+		row("device", device.IP, device.MAC, device.Hostname, device.Traffic)
+	}
+	for _, uplink := range usage.Uplinks {
+		row("uplink", uplink.Interface, "", "", uplink.Traffic)
+	}
+	out.Flush()
+	return out.Error()
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+
+	statsCmd.Flags().DurationVar(&statsSince, "since", 0, "only count traffic of this recent window, e.g. 1h (default since NAT started)")
+	statsCmd.Flags().BoolVar(&statsCSV, "csv", false, "output the counters as CSV")
+}
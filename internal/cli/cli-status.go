@@ -1,8 +1,14 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -10,7 +16,11 @@ import (
 	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
 )
 
-var jsonOutput bool
+var (
+	jsonOutput     bool
+	statusWatch    bool
+	statusInterval time.Duration
+)
 
 // statusCmd represents the status command
 var statusCmd = &cobra.Command{
@@ -22,55 +32,89 @@ var statusCmd = &cobra.Command{
 - Network settings
 - Active connections
 - System resource usage
+- Host features (iCloud Private Relay, VPNs) that interfere with NAT
 
 Example:
   nat-manager status
-  nat-manager status --json  # JSON output for scripting`,
+  nat-manager status --json  # JSON output for scripting
+  nat-manager status -o yaml
+  nat-manager status --quiet  # exit code 3 when not running
+  nat-manager status --watch --interval 5s`,
+	Annotations: map[string]string{helperAnnotation: helperRequired},
 	RunE: func(_ *cobra.Command, args []string) error {
 		// Load config
 		cfg, err := config.Load()
+		if err != nil && config.Profile() != "" {
+			return err
+		}
 		if err != nil {
-			fmt.Printf("⚠️  No configuration found\n")
+			fmt.Fprintf(stdout, "⚠️  No configuration found\n")
 			cfg = config.Default()
 		}
 
 		// Convert config to NAT config
-		natConfig := &nat.Config{
-			ExternalInterface: cfg.ExternalInterface,
-			InternalInterface: cfg.InternalInterface,
-			InternalNetwork:   cfg.InternalNetwork,
-			DHCPRange: nat.DHCPRange{
-				Start: cfg.DHCPRange.Start,
-				End:   cfg.DHCPRange.End,
-				Lease: cfg.DHCPRange.Lease,
-			},
-			DNSServers: cfg.DNSServers,
-			Active:     cfg.Active,
-		}
+		natConfig := cfg.ToNATConfig()
 
 		// Create NAT manager
 		manager := nat.NewManager(natConfig)
 
-		// Get status
-		status, err := manager.GetStatus()
-		if err != nil {
-			return fmt.Errorf("failed to get NAT status: %w", err)
-		}
-
-		if jsonOutput {
-			return printStatusJSON(manager, status)
+		format := selectedOutput(jsonOutput)
+		if !statusWatch {
+			status, err := showStatus(manager, format)
+			if err != nil {
+				return err
+			}
+			if quiet && !status.Active {
+				return exitWith(ExitNotRunning, nil)
+			}
+			return nil
 		}
 
-		return printStatusHuman(manager, status)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return watch(ctx, statusInterval, false, func() error {
+			if format == outputTable {
+				fmt.Fprint(stdout, clearScreen)
+				fmt.Fprintf(stdout, "🔄 NAT Status - %s (Ctrl+C to stop)\n\n", time.Now().Format("2006-01-02 15:04:05"))
+			}
+			_, err := showStatus(manager, format)
+			return err
+		})
 	},
 }
 
-func printStatusHuman(manager *nat.Manager, status *nat.Status) error {
+// showStatus prints the status in the selected format and returns it
+func showStatus(manager *nat.Manager, format string) (*nat.Status, error) {
+	status, err := natStatus(manager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get NAT status: %w", err)
+	}
+
+	conflicts := manager.DetectHostConflicts()
+
+	if format != outputTable {
+		return status, printStatusReport(manager, format, status, conflicts)
+	}
+
+	return status, printStatusHuman(manager, status, conflicts)
+}
+
+// natStatus returns the status from the helper when running through it,
+// or from manager
+func natStatus(manager *nat.Manager) (*nat.Status, error) {
+	if helperClient != nil {
+		return helperClient.Status()
+	}
+	return manager.GetStatus()
+}
+
+func printStatusHuman(manager *nat.Manager, status *nat.Status, conflicts []nat.HostConflict) error {
 	// Overall status
 	if status.Running {
-		fmt.Printf("🟢 NAT Status: %s\n", "ACTIVE")
+		fmt.Fprintf(stdout, "🟢 NAT Status: %s\n", "ACTIVE")
 	} else {
-		fmt.Printf("🔴 NAT Status: %s\n", "INACTIVE")
+		fmt.Fprintf(stdout, "🔴 NAT Status: %s\n", "INACTIVE")
+		printHostConflicts(conflicts)
 		return nil
 	}
 
@@ -79,80 +123,110 @@ func printStatusHuman(manager *nat.Manager, status *nat.Status) error {
 		return fmt.Errorf("no NAT configuration found")
 	}
 
-	fmt.Printf("\n📡 Configuration:\n")
-	fmt.Printf("   External Interface: %s (%s)\n", config.ExternalInterface, status.ExternalIP)
-	fmt.Printf("   Internal Interface: %s (%s.1/24)\n", config.InternalInterface, config.InternalNetwork)
-	fmt.Printf("   DHCP Range: %s - %s\n", config.DHCPRange.Start, config.DHCPRange.End)
-	fmt.Printf("   DNS Servers: %s\n", strings.Join(config.DNSServers, ", "))
+	fmt.Fprintf(stdout, "\n📡 Configuration:\n")
+	if profileName != "" {
+		fmt.Fprintf(stdout, "   Profile: %s\n", profileName)
+	}
+	fmt.Fprintf(stdout, "   External Interface: %s (%s)\n", config.ExternalInterface, status.ExternalIP)
+	fmt.Fprintf(stdout, "   Internal Interface: %s (%s.1/24)\n", config.InternalInterface, config.InternalNetwork)
+	fmt.Fprintf(stdout, "   DHCP Range: %s - %s\n", config.DHCPRange.Start, config.DHCPRange.End)
+	fmt.Fprintf(stdout, "   DNS Servers: %s\n", strings.Join(config.DNSServers, ", "))
+	if config.LocalDomain != "" {
+		fmt.Fprintf(stdout, "   Local Domain: %s\n", config.LocalDomain)
+	}
 
-	fmt.Printf("\n🔧 System Status:\n")
-	fmt.Printf("   IP Forwarding: %s\n", formatBool(status.IPForwarding))
-	fmt.Printf("   pfctl NAT Rules: %s\n", formatBool(status.PFCTLEnabled))
-	fmt.Printf("   DHCP Server: %s\n", formatBool(status.DHCPRunning))
+	fmt.Fprintf(stdout, "\n🔧 System Status:\n")
+	fmt.Fprintf(stdout, "   IP Forwarding: %s\n", formatBool(status.IPForwarding))
+	fmt.Fprintf(stdout, "   pfctl NAT Rules: %s\n", formatBool(status.PFCTLEnabled))
+	fmt.Fprintf(stdout, "   DHCP Server: %s\n", formatBool(status.DHCPRunning))
+	if health := status.DHCPHealth; health != nil {
+		printServerHealth("DHCP", health)
+	}
+	if health := status.DNSHealth; health != nil {
+		fmt.Fprintf(stdout, "   DNS Server: %s (%s)\n", formatBool(health.PID > 0), health.Server)
+		printServerHealth("DNS", health)
+	}
 
 	if len(status.ConnectedDevices) > 0 {
-		fmt.Printf("\n📱 Connected Devices (%d):\n", len(status.ConnectedDevices))
+		fmt.Fprintf(stdout, "\n📱 Connected Devices (%d):\n", len(status.ConnectedDevices))
 		for _, device := range status.ConnectedDevices {
-			fmt.Printf("   %s - %s (%s)\n", device.IP, device.MAC, device.Hostname)
+			fmt.Fprintf(stdout, "   %s - %s (%s)", device.IP, device.MAC, device.Hostname)
+			if device.Type != "" {
+				fmt.Fprintf(stdout, " [%s]", device.Type)
+			}
+			fmt.Fprintln(stdout)
 		}
 	}
 
 	if len(status.ActiveConnections) > 0 {
-		fmt.Printf("\n🌐 Active Connections (%d):\n", len(status.ActiveConnections))
+		fmt.Fprintf(stdout, "\n🌐 Active Connections (%d):\n", len(status.ActiveConnections))
 		for i, conn := range status.ActiveConnections {
 			if i >= 10 { // Limit display to prevent spam
-				fmt.Printf("   ... and %d more\n", len(status.ActiveConnections)-10)
+				fmt.Fprintf(stdout, "   ... and %d more\n", len(status.ActiveConnections)-10)
 				break
 			}
-			fmt.Printf("   %s → %s (%s)\n", conn.Source, conn.Destination, conn.Protocol)
+			fmt.Fprintf(stdout, "   %s → %s (%s)\n", conn.Source, conn.Destination, conn.Protocol)
 		}
 	}
 
-	fmt.Printf("\n📊 Statistics:\n")
-	fmt.Printf("   Uptime: %s\n", status.Uptime)
-	fmt.Printf("   Bytes In/Out: %s / %s\n", formatBytes(status.BytesIn), formatBytes(status.BytesOut))
+	fmt.Fprintf(stdout, "\n📊 Statistics:\n")
+	fmt.Fprintf(stdout, "   Uptime: %s\n", status.Uptime)
+	fmt.Fprintf(stdout, "   Bytes In/Out: %s / %s\n", formatBytes(status.BytesIn), formatBytes(status.BytesOut))
+
+	printHostConflicts(conflicts)
 
 	return nil
 }
 
-func printStatusJSON(manager *nat.Manager, status *nat.Status) error {
+// printHostConflicts explains host features that interact with NAT routing or DNS
+func printHostConflicts(conflicts []nat.HostConflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+
+	fmt.Fprintf(stdout, "\n⚠️  Host Conflicts (%d):\n", len(conflicts))
+	for _, conflict := range conflicts {
+		fmt.Fprintf(stdout, "   %s: %s\n", conflict.Feature, conflict.Detail)
+		fmt.Fprintf(stdout, "      Impact: %s\n", conflict.Impact)
+		for _, mitigation := range conflict.Mitigations {
+			fmt.Fprintf(stdout, "      → %s\n", mitigation)
+		}
+	}
+}
+
+// statusReport is the machine-readable form of the status, for scripts and
+// the API
+type statusReport struct {
+	*nat.Status
+	Profile           string             `json:"profile,omitempty"`
+	ExternalInterface string             `json:"external_interface"`
+	InternalInterface string             `json:"internal_interface"`
+	InternalNetwork   string             `json:"internal_network"`
+	HostConflicts     []nat.HostConflict `json:"host_conflicts"`
+}
+
+func printStatusReport(manager *nat.Manager, format string, status *nat.Status, conflicts []nat.HostConflict) error {
 	config := manager.GetConfig()
 	if config == nil {
 		return fmt.Errorf("no NAT configuration found")
 	}
+	return writeStatus(stdout, format, config, status, conflicts)
+}
 
-	// For JSON output, you'd typically use encoding/json
-	// This is a simplified version
-	fmt.Printf(`{
-  "running": %t,
-  "external_interface": "%s",
-  "internal_interface": "%s",
-  "external_ip": "%s",
-  "internal_network": "%s",
-  "ip_forwarding": %t,
-  "pfctl_enabled": %t,
-  "dhcp_running": %t,
-  "connected_devices": %d,
-  "active_connections": %d,
-  "uptime": "%s",
-  "bytes_in": %d,
-  "bytes_out": %d
-}`,
-		status.Running,
-		config.ExternalInterface,
-		config.InternalInterface,
-		status.ExternalIP,
-		config.InternalNetwork,
-		status.IPForwarding,
-		status.PFCTLEnabled,
-		status.DHCPRunning,
-		len(status.ConnectedDevices),
-		len(status.ActiveConnections),
-		status.Uptime,
-		status.BytesIn,
-		status.BytesOut,
-	)
-	return nil
+// writeStatus writes the full status, including devices, connections and
+// interface counters, as JSON or YAML
+func writeStatus(w io.Writer, format string, config *nat.Config, status *nat.Status, conflicts []nat.HostConflict) error {
+	if conflicts == nil {
+		conflicts = []nat.HostConflict{}
+	}
+	return writeOutput(w, format, statusReport{
+		Status:            status,
+		Profile:           profileName,
+		ExternalInterface: config.ExternalInterface,
+		InternalInterface: config.InternalInterface,
+		InternalNetwork:   config.InternalNetwork,
+		HostConflicts:     conflicts,
+	})
 }
 
 func formatBool(b bool) string {
@@ -179,4 +253,23 @@ func init() {
 	rootCmd.AddCommand(statusCmd)
 
 	statusCmd.Flags().BoolVar(&jsonOutput, "json", false, "output status in JSON format")
+	statusCmd.Flags().BoolVarP(&statusWatch, "watch", "w", false, "refresh the status until interrupted")
+	statusCmd.Flags().DurationVarP(&statusInterval, "interval", "i", 2*time.Second, "refresh interval for --watch")
+}
+
+// printServerHealth shows the supervisor's record of the DHCP or DNS server
+func printServerHealth(role string, health *nat.ServerHealth) {
+	if health.Restarts > 0 {
+		fmt.Fprintf(stdout, "   %s Restarts: %d\n", role, health.Restarts)
+	}
+	if health.LastError != "" {
+		fmt.Fprintf(stdout, "   %s Last Error: %s (%s)\n", role, health.LastError, health.LastExit.Local().Format("2006-01-02 15:04:05"))
+	}
+	if n := len(health.Events); n > 1 {
+		fmt.Fprintf(stdout, "   Recent %s Exits:\n", role)
+		for _, event := range health.Events[max(0, n-3) : n-1] {
+			fmt.Fprintf(stdout, "      %s  %s\n", event.Time.Local().Format("2006-01-02 15:04:05"), event.Error)
+		}
+	}
+	fmt.Fprintf(stdout, "   %s Log: %s\n", role, health.Log)
 }
@@ -2,6 +2,7 @@ package cli
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 
@@ -9,7 +10,10 @@ import (
 	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
 )
 
-var force bool
+var (
+	force    bool
+	stopKeep nat.StopOptions
+)
 
 // stopCmd represents the stop command
 var stopCmd = &cobra.Command{
@@ -24,10 +28,37 @@ This will:
 - Disable IP forwarding
 - Clean up temporary files
 
+The --keep-* flags leave parts in place: --keep-interface keeps the bridge
+and its address so VMs can still reach the host and each other without
+internet access, --keep-dhcp also keeps the DHCP server handing out
+addresses, and --keep-forwarding leaves IP forwarding enabled. Run
+'stop --force' later to tear down what was kept. From a terminal,
+--force asks for confirmation unless --yes is given.
+
 Example:
   nat-manager stop
+  nat-manager stop --keep-interface  # cut internet access, keep the bridge
+  nat-manager stop --keep-dhcp       # keep the bridge and DHCP
   nat-manager stop --force  # Force stop even if some cleanup fails`,
+	Annotations: map[string]string{helperAnnotation: helperRequired},
 	RunE: func(_ *cobra.Command, _ []string) error {
+		if helperClient != nil {
+			if force || stopKeep != (nat.StopOptions{}) {
+				return fmt.Errorf("stop options need root privileges, run with sudo")
+			}
+			if _, err := helperClient.Stop(); err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "✅ NAT stopped successfully\n")
+			return nil
+		}
+
+		if force {
+			if err := confirmDestructive("Force stop NAT, ignoring failed cleanup steps?"); err != nil {
+				return err
+			}
+		}
+
 		// Load config
 		cfg, err := config.Load()
 		if err != nil {
@@ -39,36 +70,29 @@ Example:
 		}
 
 		// Convert config to NAT config
-		natConfig := &nat.Config{
-			ExternalInterface: cfg.ExternalInterface,
-			InternalInterface: cfg.InternalInterface,
-			InternalNetwork:   cfg.InternalNetwork,
-			DHCPRange: nat.DHCPRange{
-				Start: cfg.DHCPRange.Start,
-				End:   cfg.DHCPRange.End,
-				Lease: cfg.DHCPRange.Lease,
-			},
-			DNSServers: cfg.DNSServers,
-			Active:     cfg.Active,
-		}
+		natConfig := cfg.ToNATConfig()
 
 		// Create NAT manager
 		manager := nat.NewManager(natConfig)
 
 		// Check if running
 		if !manager.IsActive() && !force {
-			return fmt.Errorf("NAT is not running")
+			return nat.ErrNotRunning
 		}
 
 		// Stop NAT
-		if err := manager.StopNAT(); err != nil {
+		if err := manager.Stop(stopKeep); err != nil {
 			if !force {
 				return fmt.Errorf("failed to stop NAT: %w", err)
 			}
-			fmt.Printf("Warning: some cleanup failed: %v\n", err)
+			fmt.Fprintf(stdout, "Warning: some cleanup failed: %v\n", err)
 		}
 
-		fmt.Printf("✅ NAT stopped successfully\n")
+		if kept := keptParts(stopKeep); kept != "" {
+			fmt.Fprintf(stdout, "✅ NAT stopped, kept %s\n", kept)
+			return nil
+		}
+		fmt.Fprintf(stdout, "✅ NAT stopped successfully\n")
 
 		return nil
 	},
@@ -78,4 +102,28 @@ func init() {
 	rootCmd.AddCommand(stopCmd)
 
 	stopCmd.Flags().BoolVarP(&force, "force", "f", false, "force stop even if some operations fail")
+	stopCmd.Flags().BoolVar(&stopKeep.KeepInterface, "keep-interface", false, "keep the internal interface and its address")
+	stopCmd.Flags().BoolVar(&stopKeep.KeepDHCP, "keep-dhcp", false, "keep the DHCP server running (implies --keep-interface)")
+	stopCmd.Flags().BoolVar(&stopKeep.KeepForwarding, "keep-forwarding", false, "leave IP forwarding enabled")
+}
+
+// keptParts describes the parts a stop leaves in place, or "" for none
+func keptParts(opts nat.StopOptions) string {
+	var kept []string
+	if opts.KeepInterface || opts.KeepDHCP {
+		kept = append(kept, "the interface")
+	}
+	if opts.KeepDHCP {
+		kept = append(kept, "DHCP")
+	}
+	if opts.KeepForwarding {
+		kept = append(kept, "IP forwarding")
+	}
+	switch len(kept) {
+	case 0:
+		return ""
+	case 1:
+		return kept[0]
+	}
+	return strings.Join(kept[:len(kept)-1], ", ") + " and " + kept[len(kept)-1]
 }
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var (
+	testHostname string
+	testUpstream string
+)
+
+// testCmd represents the test command
+var testCmd = &cobra.Command{
+	Use:   "test",
+	Short: "Test NAT connectivity end to end",
+	Long: `Verify that NAT works end to end. Each check passes or fails on its own:
+
+- gateway:     the gateway address on the internal interface answers ping
+- upstream:    an upstream address is reachable from the host
+- dns:         a hostname resolves through the internal DNS
+- translation: a ping from the gateway address leaves through the uplink
+               and shows up as a translated state in the pf state table
+
+The command fails if any check fails.
+
+Example:
+  nat-manager test
+  nat-manager test --host example.com --upstream 9.9.9.9
+  nat-manager test -o json`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		manager := nat.NewManager(cfg.ToNATConfig())
+		if !manager.IsActive() {
+			return nat.ErrNotRunning
+		}
+
+		results := manager.TestConnectivity(context.Background(), nat.ConnectivityOptions{
+			Upstream: testUpstream,
+			Hostname: testHostname,
+			DNSAddr:  cfg.GetDNSListenAddr(),
+		})
+		if outputFormat != outputTable {
+			if err := writeOutput(os.Stdout, outputFormat, results); err != nil {
+				return err
+			}
+		} else {
+			printCheckResults(results)
+		}
+
+		failed := 0
+		for _, result := range results {
+			if !result.Passed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(results))
+		}
+		return nil
+	},
+}
+
+func printCheckResults(results []nat.CheckResult) {
+	fmt.Fprintf(stdout, "🔌 Connectivity:\n")
+	for _, result := range results {
+		mark := "✅"
+		if !result.Passed {
+			mark = "❌"
+		}
+		fmt.Fprintf(stdout, "   %s %-12s %s (%s)\n", mark, result.Name, result.Detail, result.Duration.Round(time.Millisecond))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+
+	testCmd.Flags().StringVar(&testHostname, "host", "apple.com", "hostname to resolve through the internal DNS")
+	testCmd.Flags().StringVar(&testUpstream, "upstream", "", "address to reach through the uplink (default the first DNS server)")
+}
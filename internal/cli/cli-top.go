@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/top"
+)
+
+var topOptions top.Options
+
+// topCmd represents the top command
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Live dashboard of device bandwidth and connections",
+	Long: `Show a top-style live view of the running instance: the current and
+total traffic of each device, the destinations with the most traffic, and
+the number of pf states and NAT connections by protocol.
+
+Single keystrokes sort the device table: r by current rate, i by incoming
+and o by outgoing rate, t by total traffic, c by connections and n by name.
+q quits.
+
+Example:
+  nat-manager top
+  nat-manager top --interval 1s --rows 20 --sort total`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if err := top.ValidateSort(topOptions.Sort); err != nil {
+			return err
+		}
+		if topOptions.Interval <= 0 || topOptions.Rows <= 0 {
+			return fmt.Errorf("--interval and --rows must be positive")
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		manager := nat.NewManager(cfg.ToNATConfig())
+		if !manager.IsActive() {
+			return nat.ErrNotRunning
+		}
+
+		opts := topOptions
+		opts.Network = cfg.InternalNetwork
+		return top.Run(manager, opts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+
+	topCmd.Flags().DurationVar(&topOptions.Interval, "interval", 2*time.Second, "time between samples")
+	topCmd.Flags().IntVar(&topOptions.Rows, "rows", 10, "lines of the device and destination tables")
+	topCmd.Flags().StringVar(&topOptions.Sort, "sort", top.SortRate, "initial order: rate, in, out, total, connections or name")
+}
@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/launchd"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+var uninstallKeepConfig bool
+
+// uninstallCmd represents the uninstall command
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove everything nat-manager changed on this Mac",
+	Long: `Reverse everything nat-manager has done on this Mac:
+
+- remove the launchd jobs it installed, such as scheduled backups and
+  the daemon, so nothing restarts NAT behind its back
+- stop every running instance
+- remove leftovers of crashed runs (see 'cleanup')
+- reload /etc/pf.conf, disable pf and turn IP forwarding off
+- delete the configuration, profiles, state and logs of all instances,
+  after confirmation
+
+When run from a terminal it asks before starting; --yes skips both
+questions and deletes the configuration.
+
+The nat-manager binary and backups stored outside the configuration
+directory are kept.
+
+Example:
+  nat-manager uninstall
+  nat-manager uninstall --keep-config
+  nat-manager uninstall --yes`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if err := confirmDestructive("Stop all instances and undo every change nat-manager made?"); err != nil {
+			return err
+		}
+		instances, err := instanceConfigs()
+		if err != nil {
+			return err
+		}
+		stateFile, err := config.GetStateFilePath()
+		if err != nil {
+			return fmt.Errorf("failed to get state file path: %w", err)
+		}
+
+		errs := []error{
+			removeLaunchdJobs(),
+			stopInstances(stateFile, instances),
+			removeOrphans(stateFile, instances),
+		}
+		if err := nat.RestoreHostDefaults(); err != nil {
+			errs = append(errs, err)
+		} else {
+			fmt.Fprintf(stdout, "✅ Restored pf and IP forwarding defaults\n")
+		}
+		if !uninstallKeepConfig {
+			errs = append(errs, removeConfiguration(os.Stdin))
+		}
+
+		if err := errors.Join(errs...); err != nil {
+			return fmt.Errorf("uninstall incomplete: %w", err)
+		}
+		fmt.Fprintf(stdout, "✅ nat-manager uninstalled\n")
+		return nil
+	},
+}
+
+// stopInstances stops every registered instance
+func stopInstances(stateFile string, instances []*nat.Config) error {
+	registry, err := nat.LoadRegistry(stateFile)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, cfg := range instances {
+		name := cfg.Instance
+		if _, ok := registry.Instances[name]; !ok {
+			continue
+		}
+		if err := nat.NewManager(cfg).StopNAT(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to stop instance %s: %w", name, err))
+			continue
+		}
+		fmt.Fprintf(stdout, "✅ Stopped instance %s\n", name)
+	}
+	return errors.Join(errs...)
+}
+
+// removeOrphans removes the leftovers of crashed runs
+func removeOrphans(stateFile string, instances []*nat.Config) error {
+	orphans, err := nat.FindOrphans(stateFile, instances)
+	if err != nil {
+		return fmt.Errorf("failed to look for leftovers: %w", err)
+	}
+	var errs []error
+	for _, orphan := range orphans {
+		if err := orphan.Remove(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		printOrphan("✅", orphan)
+	}
+	return errors.Join(errs...)
+}
+
+// removeLaunchdJobs unloads and removes every nat-manager launchd job
+func removeLaunchdJobs() error {
+	labels, err := launchd.List()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, label := range labels {
+		if err := launchd.Uninstall(label); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "✅ Removed launchd job %s\n", label)
+	}
+	return errors.Join(errs...)
+}
+
+// removeConfiguration deletes the configuration directory and the global
+// config file after confirmation read from in
+func removeConfiguration(in io.Reader) error {
+	dir, err := config.BaseDir()
+	if err != nil {
+		return fmt.Errorf("failed to get config directory: %w", err)
+	}
+	paths := []string{dir}
+	if file := viper.ConfigFileUsed(); file != "" {
+		paths = append(paths, file)
+	}
+
+	if !assumeYes && !confirm(in, fmt.Sprintf("Delete configuration, state and logs in %s? [y/N] ", strings.Join(paths, " and "))) {
+		fmt.Fprintf(stdout, "Configuration kept in %s\n", dir)
+		return nil
+	}
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		fmt.Fprintf(stdout, "✅ Removed %s\n", path)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(uninstallCmd)
+
+	uninstallCmd.Flags().BoolVar(&uninstallKeepConfig, "keep-config", false, "keep the configuration, profiles, state and logs")
+}
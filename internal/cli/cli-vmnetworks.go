@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/vmnet"
+)
+
+// vmNetworkInterval is how often the VMs of attached hypervisor networks
+// are moved into the internal bridge, as VMs that start or restart join
+// their hypervisor's bridge
+const vmNetworkInterval = 30 * time.Second
+
+// attachVMNetworks are the hypervisor networks start puts into the
+// internal bridge
+var attachVMNetworks []string
+
+// vmNetwork is a hypervisor network with how it relates to the internal
+// network
+type vmNetwork struct {
+	vmnet.HypervisorNetwork
+	Attached bool `json:"attached"` // its VMs are kept in the internal bridge
+	Conflict bool `json:"conflict"` // its subnet overlaps the internal network
+}
+
+// vmNetworksCmd represents the vm-networks command
+var vmNetworksCmd = &cobra.Command{
+	Use:     "vm-networks",
+	Aliases: []string{"hypervisors"},
+	Short:   "List the networks of UTM, VMware Fusion and Parallels",
+	Long: `List the networks hypervisors share with their VMs through vmnet bridges,
+with the hypervisor they belong to: VMware Fusion (named after its vmnet
+networks), Parallels (Shared and Host-Only), UTM and Lima, or plain vmnet
+for other apps of Apple's Virtualization framework.
+
+'start --attach-vm-network NETWORK' moves the VMs of a network into the
+internal bridge, so they get their address from the managed DHCP server
+and reach the outside through the managed NAT. NETWORK is the bridge, the
+network name (vmnet8, Shared), its subnet (10.211.55) or the hypervisor
+(fusion, parallels, utm), and can be given more than once. 'start
+--foreground' and the daemon move VMs that start later as well. The VMs
+keep their old address until they renew their lease or reconnect their
+network adapter.
+
+A network whose subnet overlaps the internal network is flagged; 'nat-manager
+doctor' explains how to resolve it.
+
+Example:
+  nat-manager vm-networks
+  sudo nat-manager start --attach-vm-network vmnet8 --foreground
+  sudo nat-manager start --attach-vm-network parallels --attach-vm-network utm
+  nat-manager vm-networks detach vmnet8`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		found, err := vmnet.HypervisorNetworks()
+		if err != nil {
+			return err
+		}
+		networks := make([]vmNetwork, 0, len(found))
+		for _, network := range found {
+			if network.Bridge == cfg.InternalInterface {
+				continue
+			}
+			networks = append(networks, vmNetwork{
+				HypervisorNetwork: network,
+				Attached:          vmNetworkAttached(cfg, network),
+				Conflict:          network.Overlaps(cfg.InternalNetwork),
+			})
+		}
+		if outputFormat != outputTable {
+			return writeOutput(os.Stdout, outputFormat, networks)
+		}
+
+		if len(networks) == 0 {
+			fmt.Fprintf(stdout, "No hypervisor networks found\n")
+			return nil
+		}
+		fmt.Fprintf(stdout, "%-10s %-14s %-10s %-18s %-4s %s\n", "BRIDGE", "HYPERVISOR", "NAME", "SUBNET", "VMS", "STATUS")
+		for _, network := range networks {
+			subnet := "-"
+			if network.Subnet.IsValid() {
+				subnet = network.Subnet.String()
+			}
+			var status []string
+			if network.Attached {
+				status = append(status, "attached")
+			}
+			if network.Conflict {
+				status = append(status, "⚠️  overlaps "+cfg.InternalNetwork+".0/24")
+			}
+			fmt.Fprintf(stdout, "%-10s %-14s %-10s %-18s %-4d %s\n", network.Bridge, network.Hypervisor, orDash(network.Name),
+				subnet, len(network.Members), orDash(strings.Join(status, ", ")))
+		}
+		return nil
+	},
+}
+
+// vmNetworksDetachCmd represents the vm-networks detach command
+var vmNetworksDetachCmd = &cobra.Command{
+	Use:   "detach <network>",
+	Short: "Stop keeping the VMs of a network in the internal bridge",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		kept := slices.DeleteFunc(slices.Clone(cfg.VMNetworks), func(n string) bool { return strings.EqualFold(n, args[0]) })
+		if len(kept) == len(cfg.VMNetworks) {
+			return exitWith(ExitUsage, fmt.Errorf("%s is not attached", args[0]))
+		}
+		cfg.VMNetworks = kept
+		if err := cfg.Save(); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		fmt.Fprintf(stdout, "✅ %s detached\n", args[0])
+		fmt.Fprintf(stdout, "💡 Restart its VMs or reconnect their network adapters to put them back on the hypervisor's network\n")
+		return nil
+	},
+}
+
+// vmNetworkAttached reports whether the VMs of network are kept in the
+// internal bridge of cfg
+func vmNetworkAttached(cfg *config.Config, network vmnet.HypervisorNetwork) bool {
+	return slices.ContainsFunc(cfg.VMNetworks, network.Matches)
+}
+
+// attachVMNetworkMembers moves the VMs of the attached hypervisor networks
+// of cfg into the internal bridge and returns the interfaces it moved
+func attachVMNetworkMembers(cfg *config.Config) ([]string, error) {
+	networks, err := vmnet.HypervisorNetworks()
+	if err != nil {
+		return nil, err
+	}
+	var moved []string
+	for _, network := range networks {
+		if network.Bridge == cfg.InternalInterface || !vmNetworkAttached(cfg, network) {
+			continue
+		}
+		members, err := vmnet.AttachNetwork(network, cfg.InternalInterface)
+		moved = append(moved, members...)
+		if err != nil {
+			return moved, fmt.Errorf("failed to attach %s: %w", network.Bridge, err)
+		}
+	}
+	return moved, nil
+}
+
+// reportVMNetworks attaches the VMs of the hypervisor networks of cfg once
+// and reports what moved
+func reportVMNetworks(cfg *config.Config) {
+	moved, err := attachVMNetworkMembers(cfg)
+	if err != nil {
+		fmt.Fprintf(stdout, "⚠️  %v\n", err)
+	}
+	if len(moved) == 0 {
+		fmt.Fprintf(stdout, "💡 No VMs running on %s yet; 'start --foreground' and the daemon attach them once they start\n", strings.Join(cfg.VMNetworks, ", "))
+		return
+	}
+	fmt.Fprintf(stdout, "✅ Moved %s into %s\n", strings.Join(moved, ", "), cfg.InternalInterface)
+	fmt.Fprintf(stdout, "💡 Renew the lease in the VMs or reconnect their network adapters to get an address on %s.0/24\n", cfg.InternalNetwork)
+}
+
+// startVMNetworks keeps the VMs of the attached hypervisor networks of cfg
+// in the internal bridge in the background until ctx is done
+func startVMNetworks(ctx context.Context, cfg *config.Config) {
+	if len(cfg.VMNetworks) == 0 || !strings.HasPrefix(cfg.InternalInterface, "bridge") {
+		return
+	}
+	attach := func() {
+		moved, err := attachVMNetworkMembers(cfg)
+		if len(moved) > 0 {
+			logging.Component(logging.NAT).Info("attached VM interfaces", "interfaces", strings.Join(moved, ","), "bridge", cfg.InternalInterface)
+		}
+		if err != nil {
+			logging.Component(logging.NAT).Warn("failed to attach VM network", "error", err)
+		}
+	}
+	attach()
+	go func() {
+		ticker := time.NewTicker(vmNetworkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				attach()
+			}
+		}
+	}()
+	fmt.Fprintf(stdout, "🖥️  Keeping the VMs of %s in %s\n", strings.Join(cfg.VMNetworks, ", "), cfg.InternalInterface)
+}
+
+func init() {
+	rootCmd.AddCommand(vmNetworksCmd)
+	vmNetworksCmd.AddCommand(vmNetworksDetachCmd)
+}
@@ -0,0 +1,228 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/webhook"
+)
+
+// eventWait is how long a command waits at exit for its events to be
+// delivered
+const eventWait = 15 * time.Second
+
+var (
+	webhookSecret string
+	webhookEvents []string
+)
+
+// webhookCmd represents the webhook command
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Send events to webhook URLs",
+	Long: `Manage URLs that receive a JSON POST for each event of the instance:
+
+  nat.started, nat.stopped   NAT started or stopped, with unexpected=true
+                             when its pf rules were removed
+  device.joined, device.left a device got or released a DHCP lease, with
+                             known=false for devices never seen before
+  wan.ip_changed             the uplink's address changed
+  wan.down, wan.up           the uplink lost or got back its address
+  quota.exceeded             traffic reached traffic_quota (e.g. 50GB)
+  dhcp.failed                the DHCP server failed or had to be restarted
+
+The uplink, quota and DHCP events are detected by 'start --foreground' and
+the daemon. Payloads look like
+  {"event":"device.joined","time":"...","instance":"default",
+   "data":{"ip":"192.168.100.50","mac":"...","hostname":"..."}}
+and carry the event type in the X-NAT-Manager-Event header. With a
+secret, the X-NAT-Manager-Signature header holds "sha256=" and the hex
+HMAC-SHA256 of the body. Failed deliveries are retried three times, with
+growing delays, unless the server rejected the request with a 4xx status.
+
+Example:
+  nat-manager webhook add https://hooks.example.com/nat --secret s3cret
+  nat-manager webhook add https://ntfy.example.com/lab --event device.joined --event device.left
+  nat-manager webhook list
+  nat-manager webhook test https://hooks.example.com/nat
+  nat-manager webhook remove https://hooks.example.com/nat`,
+}
+
+// webhookListCmd represents the webhook list command
+var webhookListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List webhooks",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if outputFormat != outputTable {
+			webhooks := cfg.Webhooks
+			if webhooks == nil {
+				webhooks = []config.WebhookConfig{}
+			}
+			return writeOutput(os.Stdout, outputFormat, webhooks)
+		}
+
+		if len(cfg.Webhooks) == 0 {
+			fmt.Fprintf(stdout, "No webhooks configured\n")
+			return nil
+		}
+		fmt.Fprintf(stdout, "%-50s %-7s %s\n", "URL", "SIGNED", "EVENTS")
+		for _, w := range cfg.Webhooks {
+			signed, events := "no", "all"
+			if w.Secret != "" {
+				signed = "yes"
+			}
+			if len(w.Events) > 0 {
+				events = strings.Join(w.Events, ", ")
+			}
+			fmt.Fprintf(stdout, "%-50s %-7s %s\n", truncate(w.URL, 50), signed, events)
+		}
+		return nil
+	},
+}
+
+// webhookAddCmd represents the webhook add command
+var webhookAddCmd = &cobra.Command{
+	Use:   "add <url>",
+	Short: "Send events to a URL",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		err := updateWebhooks(func(webhooks []config.WebhookConfig) ([]config.WebhookConfig, error) {
+			webhooks = slices.DeleteFunc(webhooks, func(w config.WebhookConfig) bool { return w.URL == args[0] })
+			return append(webhooks, config.WebhookConfig{URL: args[0], Secret: webhookSecret, Events: webhookEvents}), nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Webhook %s added\n", args[0])
+		return nil
+	},
+}
+
+// webhookRemoveCmd represents the webhook remove command
+var webhookRemoveCmd = &cobra.Command{
+	Use:     "remove <url>",
+	Aliases: []string{"rm"},
+	Short:   "Stop sending events to a URL",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		err := updateWebhooks(func(webhooks []config.WebhookConfig) ([]config.WebhookConfig, error) {
+			kept := slices.DeleteFunc(slices.Clone(webhooks), func(w config.WebhookConfig) bool { return w.URL == args[0] })
+			if len(kept) == len(webhooks) {
+				return nil, fmt.Errorf("no webhook for %s", args[0])
+			}
+			return kept, nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ Webhook %s removed\n", args[0])
+		return nil
+	},
+}
+
+// webhookTestCmd represents the webhook test command
+var webhookTestCmd = &cobra.Command{
+	Use:   "test [url]",
+	Short: "Send a test event to the webhooks",
+	Long: `Send a nat.started event marked as a test to every webhook, or to the one
+with the given URL, and report whether it was delivered.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		hooks := cfg.Hooks()
+		if len(args) > 0 {
+			hooks = slices.DeleteFunc(hooks, func(h webhook.Hook) bool { return h.URL != args[0] })
+		}
+		if len(hooks) == 0 {
+			return fmt.Errorf("no webhook to test")
+		}
+
+		e := event.Event{
+			Type:     event.NATStarted,
+			Time:     time.Now().UTC(),
+			Instance: config.Instance(),
+			Data:     map[string]string{"external": cfg.ExternalInterface, "internal": cfg.InternalInterface, "test": "true"},
+		}
+		notifier := webhook.New(nil, nil)
+		failed := 0
+		for _, hook := range hooks {
+			if err := notifier.Deliver(context.Background(), hook, e); err != nil {
+				fmt.Fprintf(stdout, "❌ %v\n", err)
+				failed++
+				continue
+			}
+			fmt.Fprintf(stdout, "✅ Delivered to %s\n", hook.URL)
+		}
+		if failed > 0 {
+			return exitWith(ExitError, nil)
+		}
+		return nil
+	},
+}
+
+// updateWebhooks validates and saves the webhooks update returns
+func updateWebhooks(update func([]config.WebhookConfig) ([]config.WebhookConfig, error)) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Webhooks, err = update(cfg.Webhooks); err != nil {
+		return err
+	}
+	if err := config.ValidateWebhooks(cfg.Webhooks); err != nil {
+		return exitWith(ExitUsage, err)
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// registerWebhooks sends the instance's events to its webhooks
+func registerWebhooks() {
+	cfg, err := config.Load()
+	if err != nil || len(cfg.Webhooks) == 0 {
+		return
+	}
+	event.Register(webhook.New(cfg.Hooks(), func(url string, err error) {
+		logging.Component(logging.Events).Warn("webhook failed", "url", url, "error", err)
+	}))
+}
+
+// closeEventSinks waits a while for the events of the command to be
+// delivered
+func closeEventSinks() {
+	ctx, cancel := context.WithTimeout(context.Background(), eventWait)
+	defer cancel()
+	if err := event.Close(ctx); err != nil {
+		logging.Component(logging.Events).Warn("events not delivered", "error", err)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(webhookCmd)
+	webhookCmd.AddCommand(webhookListCmd)
+	webhookCmd.AddCommand(webhookAddCmd)
+	webhookCmd.AddCommand(webhookRemoveCmd)
+	webhookCmd.AddCommand(webhookTestCmd)
+
+	webhookAddCmd.Flags().StringVar(&webhookSecret, "secret", "", "sign payloads with this HMAC-SHA256 key")
+	webhookAddCmd.Flags().StringSliceVar(&webhookEvents, "event", nil, fmt.Sprintf("send only these events (%s)", strings.Join(event.Types, ", ")))
+}
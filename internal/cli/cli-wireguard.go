@@ -0,0 +1,483 @@
+package cli
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/ddns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/wireguard"
+)
+
+var (
+	wgPeerKey        string
+	wgPeerAddress    string
+	wgPeerDNS        []string
+	wgPeerAllTraffic bool
+	wgPeerFile       string
+)
+
+// wireguardCmd represents the wireguard command
+var wireguardCmd = &cobra.Command{
+	Use:     "wireguard",
+	Aliases: []string{"wg"},
+	Short:   "Reach the internal network remotely over WireGuard",
+	Long: `Run a WireGuard endpoint so remote devices, such as a laptop on the road,
+can reach the devices of the internal network. Once wireguard.enabled is
+set, 'start --foreground' and the daemon bring the endpoint up and down
+with NAT, and the pf rules let the peers' UDP in on wireguard.port (51820)
+and translate what they send to the internet.
+
+The endpoint runs on a utun interface through wireguard-go and wg:
+
+  brew install wireguard-go wireguard-tools
+
+Peers get an address of wireguard.network (10.8.0.0/24, the endpoint being
+10.8.0.1). 'peer add' prints the configuration to import into the WireGuard
+app of the peer, which connects to wireguard.endpoint: set it to a name
+kept up to date by 'nat-manager ddns', which is used by default, or to the
+external address, and forward the port on any router in front of the Mac.
+
+Example:
+  nat-manager config set wireguard.endpoint lab.example.com
+  nat-manager config set wireguard.enabled true
+  nat-manager wireguard peer add laptop -f laptop.conf
+  sudo nat-manager wireguard up
+  nat-manager wireguard status`,
+}
+
+// wireguardUpCmd represents the wireguard up command
+var wireguardUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Bring the endpoint up",
+	Long: `Bring the WireGuard endpoint up until 'wireguard down', for NAT that is not
+run by 'start --foreground' or the daemon, which bring it up on their own.
+A running endpoint gets the configured peers again.`,
+	Args: cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		iface, err := wireGuardUp(cfg)
+		if err != nil {
+			return err
+		}
+		if !cfg.WireGuard.Enabled {
+			fmt.Fprintf(stdout, "⚠️  wireguard.enabled is off: pf does not translate the peers' traffic to the internet\n")
+		} else if err := nat.NewManager(cfg.ToNATConfig()).ApplyRules(); err != nil {
+			return fmt.Errorf("failed to apply rules: %w", err)
+		}
+		fmt.Fprintf(stdout, "✅ WireGuard endpoint up on %s (%s.1, UDP port %d)\n", iface, cfg.WireGuard.GetNetwork(), cfg.WireGuard.GetPort())
+		return nil
+	},
+}
+
+// wireguardDownCmd represents the wireguard down command
+var wireguardDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Bring the endpoint down",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if err := wireGuardDevice().Down(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ WireGuard endpoint down\n")
+		return nil
+	},
+}
+
+// wireGuardStatus is the state of the endpoint
+type wireGuardStatus struct {
+	Running   bool                  `json:"running"`
+	Interface string                `json:"interface,omitempty"`
+	Address   string                `json:"address"`
+	Port      int                   `json:"port"`
+	PublicKey string                `json:"public_key,omitempty"`
+	Endpoint  string                `json:"endpoint,omitempty"`
+	Peers     []wireGuardPeerStatus `json:"peers"`
+}
+
+// wireGuardPeerStatus is the state of a peer, known while the endpoint runs
+type wireGuardPeerStatus struct {
+	Name          string     `json:"name"`
+	Address       string     `json:"address"`
+	PublicKey     string     `json:"public_key"`
+	Endpoint      string     `json:"endpoint,omitempty"`
+	LastHandshake *time.Time `json:"last_handshake,omitempty"`
+	Received      uint64     `json:"received_bytes"`
+	Sent          uint64     `json:"sent_bytes"`
+}
+
+// wireguardStatusCmd represents the wireguard status command
+var wireguardStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the endpoint and its peers",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		status := wireGuardStatus{
+			Address:  cfg.WireGuard.GetNetwork() + ".1",
+			Port:     cfg.WireGuard.GetPort(),
+			Endpoint: cfg.WireGuard.Endpoint,
+			Peers:    []wireGuardPeerStatus{},
+		}
+		if key, err := wireguard.ParseKey(cfg.WireGuard.PrivateKey); err == nil {
+			status.PublicKey = key.PublicKey().String()
+		}
+		live := map[string]wireguard.PeerStatus{}
+		status.Interface, status.Running = wireGuardDevice().Interface()
+		if status.Running {
+			peers, err := wireguard.Show(status.Interface)
+			if err != nil {
+				return err
+			}
+			for _, p := range peers {
+				live[p.PublicKey.String()] = p
+			}
+		}
+		for _, p := range cfg.WireGuard.Peers {
+			peer := wireGuardPeerStatus{Name: p.Name, Address: p.Address, PublicKey: p.PublicKey}
+			if state, ok := live[p.PublicKey]; ok {
+				peer.Endpoint, peer.Received, peer.Sent = state.Endpoint, state.Received, state.Sent
+				if !state.LastHandshake.IsZero() {
+					peer.LastHandshake = &state.LastHandshake
+				}
+			}
+			status.Peers = append(status.Peers, peer)
+		}
+		if outputFormat != outputTable {
+			return writeOutput(os.Stdout, outputFormat, status)
+		}
+
+		if status.Running {
+			fmt.Fprintf(stdout, "🔐 WireGuard: ✅ up on %s\n", status.Interface)
+		} else {
+			fmt.Fprintf(stdout, "🔐 WireGuard: ❌ down\n")
+		}
+		fmt.Fprintf(stdout, "   Address: %s/24, UDP port %d\n", status.Address, status.Port)
+		if status.PublicKey != "" {
+			fmt.Fprintf(stdout, "   Public key: %s\n", status.PublicKey)
+		}
+		if status.Endpoint != "" {
+			fmt.Fprintf(stdout, "   Endpoint: %s\n", status.Endpoint)
+		}
+		if len(status.Peers) == 0 {
+			fmt.Fprintf(stdout, "\nNo peers configured (use 'nat-manager wireguard peer add NAME')\n")
+			return nil
+		}
+		fmt.Fprintf(stdout, "\n%-20s %-15s %-21s %-12s %10s %10s\n", "PEER", "ADDRESS", "CONNECTED FROM", "HANDSHAKE", "RECEIVED", "SENT")
+		for _, p := range status.Peers {
+			handshake := "never"
+			if p.LastHandshake != nil {
+				handshake = time.Since(*p.LastHandshake).Round(time.Second).String() + " ago"
+			}
+			fmt.Fprintf(stdout, "%-20s %-15s %-21s %-12s %10s %10s\n", truncate(p.Name, 20), p.Address, p.Endpoint, handshake,
+				formatBytes(p.Received), formatBytes(p.Sent))
+		}
+		return nil
+	},
+}
+
+// wireguardPeerCmd represents the wireguard peer command
+var wireguardPeerCmd = &cobra.Command{
+	Use:   "peer",
+	Short: "Manage the devices allowed to connect",
+}
+
+// wireguardPeerListCmd represents the wireguard peer list command
+var wireguardPeerListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the peers",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if outputFormat != outputTable {
+			peers := cfg.WireGuard.Peers
+			if peers == nil {
+				peers = []config.WireGuardPeer{}
+			}
+			return writeOutput(os.Stdout, outputFormat, peers)
+		}
+
+		if len(cfg.WireGuard.Peers) == 0 {
+			fmt.Fprintf(stdout, "No WireGuard peers configured\n")
+			return nil
+		}
+		fmt.Fprintf(stdout, "%-20s %-15s %s\n", "NAME", "ADDRESS", "PUBLIC KEY")
+		for _, p := range cfg.WireGuard.Peers {
+			fmt.Fprintf(stdout, "%-20s %-15s %s\n", truncate(p.Name, 20), p.Address, p.PublicKey)
+		}
+		return nil
+	},
+}
+
+// wireguardPeerAddCmd represents the wireguard peer add command
+var wireguardPeerAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Allow a device to connect and print its configuration",
+	Long: `Allow a device to connect and print the configuration to import into its
+WireGuard app, or with --file write it to a file only the user can read.
+The device gets a key pair unless it brings its own public key, whose
+private key then goes into the configuration by hand, and the next free
+address.
+
+The peer routes the peers' network and the internal network through the
+tunnel, or with --all-traffic all its traffic, which then reaches the
+internet through the external interface. A running endpoint accepts the
+peer right away.
+
+Example:
+  nat-manager wireguard peer add laptop -f laptop.conf
+  nat-manager wireguard peer add phone | qrencode -t ansiutf8
+  nat-manager wireguard peer add tablet --public-key 'xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg='`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		serverKey, err := wireGuardKey(cfg)
+		if err != nil {
+			return err
+		}
+		endpoint, err := wireGuardEndpoint(cfg)
+		if err != nil {
+			return exitWith(ExitUsage, err)
+		}
+
+		var private wireguard.Key
+		publicKey := wgPeerKey
+		if publicKey == "" {
+			if private, err = wireguard.GenerateKey(); err != nil {
+				return err
+			}
+			publicKey = private.PublicKey().String()
+		}
+		preshared, err := wireguard.GeneratePresharedKey()
+		if err != nil {
+			return err
+		}
+		peer := config.WireGuardPeer{Name: args[0], PublicKey: publicKey, PresharedKey: preshared.String(), Address: wgPeerAddress}
+		cfg, err = updateWireGuardPeers(func(peers []config.WireGuardPeer) ([]config.WireGuardPeer, error) {
+			if slices.ContainsFunc(peers, func(p config.WireGuardPeer) bool { return p.Name == peer.Name }) {
+				return nil, fmt.Errorf("a peer named %s already exists", peer.Name)
+			}
+			if peer.Address == "" {
+				addr, err := nextWireGuardAddress(cfg, peers)
+				if err != nil {
+					return nil, err
+				}
+				peer.Address = addr.String()
+			}
+			return append(peers, peer), nil
+		})
+		if err != nil {
+			return err
+		}
+
+		network, _ := wireguard.Prefix(cfg.WireGuard.GetNetwork())
+		internal, _ := wireguard.Prefix(cfg.InternalNetwork)
+		client := wireguard.Client{
+			PrivateKey:   private,
+			Address:      netip.MustParseAddr(peer.Address),
+			DNS:          wgPeerDNS,
+			ServerKey:    serverKey.PublicKey(),
+			PresharedKey: preshared,
+			Endpoint:     endpoint,
+			Port:         cfg.WireGuard.GetPort(),
+			AllowedIPs:   []netip.Prefix{network, internal},
+		}
+		if wgPeerAllTraffic {
+			client.AllowedIPs = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0")}
+		}
+		if wgPeerFile != "" {
+			if err := os.WriteFile(wgPeerFile, []byte(client.Config()), 0600); err != nil {
+				return fmt.Errorf("failed to write %s: %w", wgPeerFile, err)
+			}
+			fmt.Fprintf(stdout, "✅ %s added (%s), configuration written to %s\n", peer.Name, peer.Address, wgPeerFile)
+		} else {
+			fmt.Fprintf(os.Stderr, "✅ %s added (%s)\n", peer.Name, peer.Address)
+			fmt.Fprint(os.Stdout, client.Config())
+		}
+		if private.IsZero() {
+			fmt.Fprintf(os.Stderr, "   Add the PrivateKey of %s to the configuration\n", peer.PublicKey)
+		}
+		return nil
+	},
+}
+
+// wireguardPeerRemoveCmd represents the wireguard peer remove command
+var wireguardPeerRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Stop a device from connecting",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		_, err := updateWireGuardPeers(func(peers []config.WireGuardPeer) ([]config.WireGuardPeer, error) {
+			kept := slices.DeleteFunc(slices.Clone(peers), func(p config.WireGuardPeer) bool { return p.Name == args[0] })
+			if len(kept) == len(peers) {
+				return nil, fmt.Errorf("no WireGuard peer named %s", args[0])
+			}
+			return kept, nil
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "✅ %s removed\n", args[0])
+		return nil
+	},
+}
+
+// wireGuardDevice returns the endpoint of the instance
+func wireGuardDevice() wireguard.Device {
+	return wireguard.Device{Name: "nat-manager-" + config.Instance()}
+}
+
+// wireGuardKey returns the private key of the endpoint, generating and
+// saving it the first time
+func wireGuardKey(cfg *config.Config) (wireguard.Key, error) {
+	if cfg.WireGuard.PrivateKey != "" {
+		return wireguard.ParseKey(cfg.WireGuard.PrivateKey)
+	}
+	key, err := wireguard.GenerateKey()
+	if err != nil {
+		return key, err
+	}
+	cfg.WireGuard.PrivateKey = key.String()
+	if err := cfg.Save(); err != nil {
+		return key, fmt.Errorf("failed to save config: %w", err)
+	}
+	return key, nil
+}
+
+// wireGuardEndpoint returns the host peers connect to: wireguard.endpoint,
+// else the first dynamic DNS name, else the external address
+func wireGuardEndpoint(cfg *config.Config) (string, error) {
+	if cfg.WireGuard.Endpoint != "" {
+		return cfg.WireGuard.Endpoint, nil
+	}
+	if cfg.DDNS.Enabled && len(cfg.DDNS.Records) > 0 {
+		record := cfg.DDNS.Records[0]
+		if record.Provider == ddns.DuckDNS && !strings.HasSuffix(record.Name, ".duckdns.org") {
+			return record.Name + ".duckdns.org", nil
+		}
+		return record.Name, nil
+	}
+	ip := nat.NewManager(cfg.ToNATConfig()).NetworkState().ExternalIP
+	if ip == "" {
+		return "", fmt.Errorf("no endpoint for peers (set wireguard.endpoint)")
+	}
+	fmt.Fprintf(os.Stderr, "⚠️  Peers connect to %s, the address of %s (set wireguard.endpoint if it changes or is behind another router)\n",
+		ip, cfg.ExternalInterface)
+	return ip, nil
+}
+
+// nextWireGuardAddress returns the first free peer address
+func nextWireGuardAddress(cfg *config.Config, peers []config.WireGuardPeer) (netip.Addr, error) {
+	network, err := wireguard.Prefix(cfg.WireGuard.GetNetwork())
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	used := make([]wireguard.Peer, 0, len(peers))
+	for _, p := range peers {
+		addr, _ := netip.ParseAddr(p.Address)
+		used = append(used, wireguard.Peer{Address: addr})
+	}
+	return wireguard.NextAddress(network, used)
+}
+
+// updateWireGuardPeers validates and saves the peers update returns, and
+// hands them to the running endpoint
+func updateWireGuardPeers(update func([]config.WireGuardPeer) ([]config.WireGuardPeer, error)) (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.WireGuard.Peers, err = update(cfg.WireGuard.Peers); err != nil {
+		return nil, err
+	}
+	if err := config.ValidateWireGuardPeers(cfg.WireGuard.Peers, cfg.WireGuard.GetNetwork()); err != nil {
+		return nil, exitWith(ExitUsage, err)
+	}
+	if err := cfg.Save(); err != nil {
+		return nil, fmt.Errorf("failed to save config: %w", err)
+	}
+	if iface, ok := wireGuardDevice().Interface(); ok {
+		server, err := cfg.WireGuardServer()
+		if err != nil {
+			return nil, err
+		}
+		if err := wireguard.Sync(iface, server); err != nil {
+			return nil, fmt.Errorf("failed to update the running endpoint: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// wireGuardUp brings the endpoint of cfg up, generating its key the first
+// time, and returns its interface
+func wireGuardUp(cfg *config.Config) (string, error) {
+	if _, err := wireGuardKey(cfg); err != nil {
+		return "", err
+	}
+	server, err := cfg.WireGuardServer()
+	if err != nil {
+		return "", err
+	}
+	network, err := wireguard.Prefix(cfg.WireGuard.GetNetwork())
+	if err != nil {
+		return "", err
+	}
+	return wireGuardDevice().Up(server, netip.PrefixFrom(wireguard.Gateway(network), network.Bits()))
+}
+
+// startWireGuard brings the endpoint up when enabled, and returns what
+// brings it down again
+func startWireGuard(cfg *config.Config) func() {
+	if !cfg.WireGuard.Enabled {
+		return func() {}
+	}
+	iface, err := wireGuardUp(cfg)
+	if err != nil {
+		logging.Component(logging.NAT).Warn("WireGuard endpoint disabled", "error", err)
+		return func() {}
+	}
+	fmt.Fprintf(stdout, "🔐 WireGuard endpoint up on %s (UDP port %d, %d peers)\n", iface, cfg.WireGuard.GetPort(), len(cfg.WireGuard.Peers))
+	return func() {
+		if err := wireGuardDevice().Down(); err != nil {
+			logging.Component(logging.NAT).Warn("failed to stop the WireGuard endpoint", "error", err)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(wireguardCmd)
+	wireguardCmd.AddCommand(wireguardUpCmd)
+	wireguardCmd.AddCommand(wireguardDownCmd)
+	wireguardCmd.AddCommand(wireguardStatusCmd)
+	wireguardCmd.AddCommand(wireguardPeerCmd)
+	wireguardPeerCmd.AddCommand(wireguardPeerListCmd)
+	wireguardPeerCmd.AddCommand(wireguardPeerAddCmd)
+	wireguardPeerCmd.AddCommand(wireguardPeerRemoveCmd)
+
+	wireguardPeerAddCmd.Flags().StringVar(&wgPeerKey, "public-key", "", "public key of a device with its own key pair")
+	wireguardPeerAddCmd.Flags().StringVar(&wgPeerAddress, "address", "", "address of the peer (default the next free one)")
+	wireguardPeerAddCmd.Flags().StringSliceVar(&wgPeerDNS, "dns", nil, "DNS servers of the peer while connected")
+	wireguardPeerAddCmd.Flags().BoolVar(&wgPeerAllTraffic, "all-traffic", false, "route all the peer's traffic through the tunnel")
+	wireguardPeerAddCmd.Flags().StringVarP(&wgPeerFile, "file", "f", "", "write the configuration to a file")
+}
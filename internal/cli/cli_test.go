@@ -2,12 +2,29 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/fake"
+	"github.com/scttfrdmn/macos-nat-manager/internal/launchd"
 	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/session"
 )
 
 func TestGetInterfaceDescription(t *testing.T) {
@@ -244,3 +261,947 @@ func TestVersionVariables(t *testing.T) {
 		t.Error("Date should be set")
 	}
 }
+
+func TestLoadForwardsFile(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "list.yaml")
+	doc := filepath.Join(dir, "doc.yaml")
+
+	_ = os.WriteFile(list, []byte("- protocol: tcp\n  external_port: 8080\n  internal_ip: 192.168.100.50\n  internal_port: 80\n"), 0600)
+	_ = os.WriteFile(doc, []byte("port_forwards:\n  - protocol: udp\n    external_port: 51820\n    internal_ip: 192.168.100.60\n    internal_port: 51820\n"), 0600)
+
+	forwards, err := loadForwardsFile(list)
+	if err != nil || len(forwards) != 1 || forwards[0].ExternalPort != 8080 {
+		t.Errorf("Unexpected list result: %+v, %v", forwards, err)
+	}
+
+	forwards, err = loadForwardsFile(doc)
+	if err != nil || len(forwards) != 1 || forwards[0].Protocol != "udp" {
+		t.Errorf("Unexpected document result: %+v, %v", forwards, err)
+	}
+}
+
+func TestMergeForwards(t *testing.T) {
+	existing := []config.PortForward{
+		{Protocol: "tcp", ExternalPort: 80, InternalIP: "192.168.100.10", InternalPort: 80},
+		{Protocol: "tcp", ExternalPort: 443, InternalIP: "192.168.100.10", InternalPort: 443},
+	}
+	incoming := []config.PortForward{
+		{Protocol: "tcp", ExternalPort: 443, InternalIP: "192.168.100.20", InternalPort: 8443},
+	}
+
+	merged := mergeForwards(existing, incoming)
+	if len(merged) != 2 {
+		t.Fatalf("Expected 2 forwards, got %d", len(merged))
+	}
+	if merged[1].InternalIP != "192.168.100.20" {
+		t.Errorf("Incoming forward should replace existing one on the same port: %+v", merged)
+	}
+}
+
+func TestReadListFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "macs.txt")
+	_ = os.WriteFile(path, []byte("# lab devices\naa:bb:cc:dd:ee:01\n\n  aa:bb:cc:dd:ee:02  # printer\n"), 0600)
+
+	items, err := readListFile(path)
+	if err != nil {
+		t.Fatalf("readListFile failed: %v", err)
+	}
+	if strings.Join(items, ",") != "aa:bb:cc:dd:ee:01,aa:bb:cc:dd:ee:02" {
+		t.Errorf("Unexpected items: %v", items)
+	}
+}
+
+func TestQueryFilter(t *testing.T) {
+	recent := dns.LoggedQuery{Time: time.Now(), Client: "192.168.100.50", Device: "Laptop"}
+	old := dns.LoggedQuery{Time: time.Now().Add(-2 * time.Hour), Client: "192.168.100.51"}
+
+	testCases := []struct {
+		client   string
+		since    time.Duration
+		entry    dns.LoggedQuery
+		expected bool
+	}{
+		{"", 0, old, true},
+		{"", time.Hour, old, false},
+		{"192.168.100.50", 0, recent, true},
+		{"laptop", time.Hour, recent, true},
+		{"192.168.100.50", 0, old, false},
+	}
+
+	for _, tc := range testCases {
+		if got := queryFilter(tc.client, tc.since)(tc.entry); got != tc.expected {
+			t.Errorf("queryFilter(%q, %s)(%+v) = %v, expected %v", tc.client, tc.since, tc.entry, got, tc.expected)
+		}
+	}
+}
+
+func TestDNSLogFlags(t *testing.T) {
+	// dns log and dns top keep their own --since defaults
+	if dnsLogSince != 0 || dnsTopSince != 24*time.Hour {
+		t.Errorf("--since defaults: dns log %s, dns top %s", dnsLogSince, dnsTopSince)
+	}
+	if err := dnsTopCmd.Flags().Set("client", "192.168.100.50"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = dnsTopCmd.Flags().Set("client", "") }()
+	if dnsLogClient != "" {
+		t.Errorf("dns top --client changed dns log's client to %q", dnsLogClient)
+	}
+}
+
+func TestPolicyMap(t *testing.T) {
+	policies := []config.DNSPolicy{
+		{Name: "kids", Upstreams: []string{"1.1.1.3"}, Devices: []string{"192.168.100.50", "192.168.100.51"}},
+		{Name: "work", Upstreams: []string{"10.0.0.53"}, Devices: []string{"192.168.100.60"}},
+	}
+	policyFor := newPolicyMap(policies, nat.NewManager(&nat.Config{})).PolicyFor
+
+	for ip, expected := range map[string]string{"192.168.100.51": "kids", "192.168.100.60": "work", "192.168.100.70": ""} {
+		if got := policyFor(ip); got != expected {
+			t.Errorf("PolicyFor(%s) = %q, expected %q", ip, got, expected)
+		}
+	}
+}
+
+func TestEditUntilValid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("external_interface: en0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	editor := filepath.Join(dir, "editor")
+	script := "#!/bin/sh\nprintf 'external_interface: en0\\ninternal_interface: bridge101\\n' > \"$1\"\n"
+	if err := os.WriteFile(editor, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", editor)
+
+	data, err := editUntilValid(path)
+	if err != nil || !strings.Contains(string(data), "bridge101") {
+		t.Errorf("editUntilValid = %q, %v", data, err)
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	status := &nat.Status{
+		Active:  true,
+		Running: true,
+		Uptime:  "1h0m0s",
+		ConnectedDevices: []nat.ConnectedDevice{
+			{IP: "192.168.100.101", MAC: "aa:bb:cc:dd:ee:01", Hostname: `laptop "work"`},
+		},
+		ActiveConnections: []nat.Connection{{Source: "192.168.100.101:51234", Destination: "1.1.1.1:443", Protocol: "tcp"}},
+	}
+	cfg := &nat.Config{ExternalInterface: "en0", InternalInterface: "bridge100", InternalNetwork: "192.168.100"}
+
+	var buf bytes.Buffer
+	if err := writeStatus(&buf, outputJSON, cfg, status, nil); err != nil {
+		t.Fatalf("writeStatus failed: %v", err)
+	}
+	var decoded struct {
+		Running           bool                  `json:"running"`
+		ExternalInterface string                `json:"external_interface"`
+		ConnectedDevices  []nat.ConnectedDevice `json:"connected_devices"`
+		ActiveConnections []nat.Connection      `json:"active_connections"`
+		HostConflicts     []nat.HostConflict    `json:"host_conflicts"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Status is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if !decoded.Running || decoded.ExternalInterface != "en0" || decoded.HostConflicts == nil {
+		t.Errorf("Unexpected status %+v", decoded)
+	}
+	if len(decoded.ConnectedDevices) != 1 || decoded.ConnectedDevices[0].Hostname != `laptop "work"` || len(decoded.ActiveConnections) != 1 {
+		t.Errorf("Devices and connections missing: %+v", decoded)
+	}
+}
+
+func TestWriteOutput(t *testing.T) {
+	devices := []nat.Device{{IP: "192.168.100.10", MAC: "aa:bb:cc:dd:ee:ff", Hostname: "2024-01-01", Source: nat.SourceDHCP, Online: true}}
+
+	var buf bytes.Buffer
+	if err := writeOutput(&buf, outputYAML, devices); err != nil {
+		t.Fatalf("writeOutput failed: %v", err)
+	}
+	var fields []map[string]any
+	if err := yaml.Unmarshal(buf.Bytes(), &fields); err != nil || len(fields) != 1 || fields[0]["name_source"] != nil {
+		t.Fatalf("Output is not the expected YAML: %v\n%s", err, buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "- ip: 192.168.100.10\n  mac: aa:bb:cc:dd:ee:ff\n") {
+		t.Errorf("YAML does not use the JSON field names in order:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `hostname: "2024-01-01"`) {
+		t.Errorf("String that looks like a date is not quoted:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := writeOutput(&buf, outputJSON, devices); err != nil {
+		t.Fatalf("writeOutput failed: %v", err)
+	}
+	var decoded []nat.Device
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 1 || decoded[0].MAC != devices[0].MAC {
+		t.Errorf("Unexpected JSON output %s (%v)", buf.String(), err)
+	}
+
+	for format, valid := range map[string]bool{outputTable: true, outputJSON: true, outputYAML: true, "xml": false} {
+		if err := validateOutputFormat(format); (err == nil) != valid {
+			t.Errorf("validateOutputFormat(%q) = %v", format, err)
+		}
+	}
+}
+
+func TestWriteUsageCSV(t *testing.T) {
+	since := time.Date(2026, 10, 16, 11, 0, 0, 0, time.UTC)
+	usage := &nat.Usage{
+		Since:   since,
+		Until:   since.Add(time.Hour),
+		Devices: []nat.DeviceUsage{{IP: "192.168.100.10", MAC: "aa:bb:cc:dd:ee:ff", Hostname: "laptop, work", Traffic: nat.Traffic{BytesIn: 2048, BytesOut: 512, PacketsIn: 4, PacketsOut: 3}}},
+		Uplinks: []nat.UplinkUsage{{Interface: "en0", Traffic: nat.Traffic{BytesIn: 4096}}},
+	}
+
+	var buf bytes.Buffer
+	if err := writeUsageCSV(&buf, usage); err != nil {
+		t.Fatalf("writeUsageCSV failed: %v", err)
+	}
+	expected := `kind,name,mac,hostname,bytes_in,bytes_out,packets_in,packets_out,since,until
+device,192.168.100.10,aa:bb:cc:dd:ee:ff,"laptop, work",2048,512,4,3,2026-10-16T11:00:00Z,2026-10-16T12:00:00Z
+uplink,en0,,,4096,0,0,0,2026-10-16T11:00:00Z,2026-10-16T12:00:00Z
+`
+	if buf.String() != expected {
+		t.Errorf("writeUsageCSV =\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
+
+func TestRemoveConfiguration(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir, err := config.BaseDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "instances", "lab"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := removeConfiguration(strings.NewReader("n\n")); err != nil {
+		t.Fatalf("removeConfiguration failed: %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Configuration removed without confirmation: %v", err)
+	}
+	if err := removeConfiguration(strings.NewReader("")); err != nil {
+		t.Fatalf("removeConfiguration failed: %v", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Configuration removed without an answer: %v", err)
+	}
+
+	if err := removeConfiguration(strings.NewReader("yes\n")); err != nil {
+		t.Fatalf("removeConfiguration failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Configuration not removed: %v", err)
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected []string
+		wantErr  bool
+	}{
+		{line: "start --external en0", expected: []string{"start", "--external", "en0"}},
+		{line: "  status\t-o  json ", expected: []string{"status", "-o", "json"}},
+		{line: `port-forward add -d "web server" --port 80`, expected: []string{"port-forward", "add", "-d", "web server", "--port", "80"}},
+		{line: `config set domain 'lab "home"'`, expected: []string{"config", "set", "domain", `lab "home"`}},
+		{line: `block a\ b ""`, expected: []string{"block", "a b", ""}},
+		{line: `'it'"'"'s'`, expected: []string{"it's"}},
+		{line: `start "en0`, wantErr: true},
+		{line: `start \`, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		words, err := splitCommandLine(tc.line)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("splitCommandLine(%q) should fail", tc.line)
+			}
+			continue
+		}
+		if err != nil || strings.Join(words, "|") != strings.Join(tc.expected, "|") || len(words) != len(tc.expected) {
+			t.Errorf("splitCommandLine(%q) = %q, %v, expected %q", tc.line, words, err, tc.expected)
+		}
+	}
+}
+
+func TestParseBatch(t *testing.T) {
+	input := "# provisioning\n\nnat-manager status\n  port-forward list -o json\n"
+	lines, err := parseBatch(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseBatch failed: %v", err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 commands, got %+v", lines)
+	}
+	if lines[0].number != 3 || strings.Join(lines[0].args, " ") != "status" {
+		t.Errorf("First command = %+v", lines[0])
+	}
+	if lines[1].number != 4 || strings.Join(lines[1].args, " ") != "port-forward list -o json" {
+		t.Errorf("Second command = %+v", lines[1])
+	}
+
+	if _, err := parseBatch(strings.NewReader("status\nstart 'en0\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+}
+
+func TestResetFlags(t *testing.T) {
+	var (
+		name  string
+		count int
+		dns   []string
+	)
+	root := &cobra.Command{Use: "root"}
+	child := &cobra.Command{Use: "child"}
+	root.AddCommand(child)
+	root.PersistentFlags().StringVar(&name, "name", "default", "")
+	child.Flags().IntVar(&count, "count", 1, "")
+	child.Flags().StringSliceVar(&dns, "dns", []string{"1.1.1.1", "8.8.8.8"}, "")
+
+	if err := child.ParseFlags([]string{"--name", "lab", "--count", "5", "--dns", "9.9.9.9"}); err != nil {
+		t.Fatal(err)
+	}
+	if name != "lab" || count != 5 || len(dns) != 1 {
+		t.Fatalf("Flags not parsed: %s %d %v", name, count, dns)
+	}
+
+	resetFlags(root)
+	if name != "default" || count != 1 || strings.Join(dns, ",") != "1.1.1.1,8.8.8.8" {
+		t.Errorf("Flags not reset: %s %d %v", name, count, dns)
+	}
+	if child.Flags().Changed("count") || root.PersistentFlags().Changed("name") {
+		t.Error("Reset flags should not be marked as changed")
+	}
+	if args := changedFlags(root.PersistentFlags()); len(args) != 0 {
+		t.Errorf("changedFlags after reset = %v", args)
+	}
+}
+
+func TestScheduleJobs(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExternalInterface = "en0"
+	cfg.Schedule = []config.ScheduleEntry{
+		{Name: "start-0900", Action: config.ScheduleStart, At: "09:00", Days: "mon-fri"},
+		{Name: "stop-1930", Action: config.ScheduleStop, At: "19:30"},
+	}
+	program := []string{"/usr/local/bin/nat-manager", "--instance", "lab"}
+
+	jobs, err := scheduleJobs(cfg, program, "/tmp/schedule.log")
+	if err != nil {
+		t.Fatalf("scheduleJobs failed: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 jobs, got %d", len(jobs))
+	}
+	start, stop := jobs[0], jobs[1]
+	if start.Label != launchd.LabelPrefix+"schedule.default.start-0900" {
+		t.Errorf("Start label = %s", start.Label)
+	}
+	if got := strings.Join(start.Program, " "); got != "/usr/local/bin/nat-manager --instance lab start --external en0 --internal bridge100" {
+		t.Errorf("Start program = %s", got)
+	}
+	if len(start.Calendar) != 5 || start.Calendar[0] != (launchd.CalendarInterval{Hour: 9, Weekday: 1}) {
+		t.Errorf("Start calendar = %+v", start.Calendar)
+	}
+	if got := strings.Join(stop.Program, " "); got != "/usr/local/bin/nat-manager --instance lab stop" {
+		t.Errorf("Stop program = %s", got)
+	}
+	if len(stop.Calendar) != 1 || stop.Calendar[0] != (launchd.CalendarInterval{Hour: 19, Minute: 30}) {
+		t.Errorf("Stop calendar = %+v", stop.Calendar)
+	}
+
+	cfg.ExternalInterface = ""
+	if _, err := scheduleJobs(cfg, program, ""); err == nil {
+		t.Error("Scheduled starts without interfaces should be rejected")
+	}
+}
+
+func TestConnectionExporter(t *testing.T) {
+	at := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	connections := []nat.Connection{
+		{Source: "192.168.100.10:52345", Destination: "93.184.216.34:443", Protocol: "TCP", State: "ESTABLISHED:ESTABLISHED", Bytes: 4600, Age: 83 * time.Second},
+		{Source: "192.168.100.9:5353", Destination: "1.1.1.1:53", Protocol: "UDP", State: "MULTIPLE:SINGLE"},
+	}
+
+	var ndjson bytes.Buffer
+	exporter := newConnectionExporter(&ndjson, exportNDJSON)
+	if err := exporter.Write(at, connections); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(ndjson.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a record per connection, got %q", ndjson.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Invalid NDJSON record %q: %v", lines[0], err)
+	}
+	if record["time"] != "2026-10-16T12:00:00Z" || record["source"] != "192.168.100.10:52345" || record["bytes"] != float64(4600) {
+		t.Errorf("Unexpected record %v", record)
+	}
+
+	var csv bytes.Buffer
+	exporter = newConnectionExporter(&csv, exportCSV)
+	for range 2 {
+		if err := exporter.Write(at, connections[:1]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	expected := "time,protocol,source,destination,state,bytes,age_seconds\n" +
+		"2026-10-16T12:00:00Z,TCP,192.168.100.10:52345,93.184.216.34:443,ESTABLISHED:ESTABLISHED,4600,83\n" +
+		"2026-10-16T12:00:00Z,TCP,192.168.100.10:52345,93.184.216.34:443,ESTABLISHED:ESTABLISHED,4600,83\n"
+	if csv.String() != expected {
+		t.Errorf("CSV export = %q, expected %q", csv.String(), expected)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	renders := 0
+	err := watch(ctx, time.Millisecond, false, func() error {
+		renders++
+		if renders == 2 {
+			return errors.New("transient")
+		}
+		if renders == 3 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil || renders != 3 {
+		t.Errorf("watch = %v after %d renders, expected nil after 3", err, renders)
+	}
+
+	failing := errors.New("no status")
+	if err := watch(context.Background(), time.Millisecond, false, func() error { return failing }); !errors.Is(err, failing) {
+		t.Errorf("watch should return the first render's error, got %v", err)
+	}
+}
+
+func TestInterfaceColumns(t *testing.T) {
+	speeds := map[uint64]string{0: "-", 10000: "10 Kbps", 866700000: "866.7 Mbps", 1000000000: "1 Gbps", 2500000000: "2.5 Gbps"}
+	for bps, expected := range speeds {
+		if got := formatLinkSpeed(bps); got != expected {
+			t.Errorf("formatLinkSpeed(%d) = %q, expected %q", bps, got, expected)
+		}
+	}
+
+	if got := interfaceFlags(nat.NetworkInterface{DefaultRoute: true, DHCP: true}); got != "default,dhcp" {
+		t.Errorf("interfaceFlags = %q", got)
+	}
+	if got := interfaceFlags(nat.NetworkInterface{}); got != "" {
+		t.Errorf("interfaceFlags without flags = %q", got)
+	}
+}
+
+func TestSelectInterfaces(t *testing.T) {
+	defer func() { showAll, filterType, externalCandidates, internalCandidates = false, "", false, false }()
+	interfaces := []nat.NetworkInterface{
+		{Name: "lo0", Type: "Loopback", Status: "up", IP: "127.0.0.1"},
+		{Name: "en1", Type: "Ethernet", Status: "up", IP: "10.0.0.5", DHCP: true},
+		{Name: "en0", Type: "Ethernet", Status: "up", IP: "192.168.1.5", DefaultRoute: true, DHCP: true},
+		{Name: "en5", Type: "Ethernet", Status: "up"},
+		{Name: "en6", Type: "Ethernet", Status: "down"},
+		{Name: "awdl0", Type: "Other", Status: "up"},
+		{Name: "bridge100", Type: "Bridge", Status: "down"},
+		{Name: "utun0", Type: "Other", Status: "up"},
+	}
+	names := func() string {
+		var selected []string
+		for _, iface := range selectInterfaces(interfaces) {
+			selected = append(selected, iface.Name)
+		}
+		return strings.Join(selected, ",")
+	}
+
+	testCases := []struct {
+		all, external, internal bool
+		typ                     string
+		expected                string
+	}{
+		{expected: "en1,en0,en5,utun0"},
+		{all: true, expected: "lo0,en1,en0,en5,en6,awdl0,bridge100,utun0"},
+		{all: true, typ: "bridge", expected: "bridge100"},
+		{external: true, expected: "en0,en1"},
+		{internal: true, expected: "en5,bridge100"},
+	}
+	for _, tc := range testCases {
+		showAll, filterType, externalCandidates, internalCandidates = tc.all, tc.typ, tc.external, tc.internal
+		if got := names(); got != tc.expected {
+			t.Errorf("selectInterfaces(all=%v type=%q external=%v internal=%v) = %s, expected %s",
+				tc.all, tc.typ, tc.external, tc.internal, got, tc.expected)
+		}
+	}
+}
+
+func TestKeptParts(t *testing.T) {
+	testCases := []struct {
+		opts     nat.StopOptions
+		expected string
+	}{
+		{expected: ""},
+		{opts: nat.StopOptions{KeepInterface: true}, expected: "the interface"},
+		{opts: nat.StopOptions{KeepDHCP: true}, expected: "the interface and DHCP"},
+		{opts: nat.StopOptions{KeepDHCP: true, KeepForwarding: true}, expected: "the interface, DHCP and IP forwarding"},
+		{opts: nat.StopOptions{KeepForwarding: true}, expected: "IP forwarding"},
+	}
+	for _, tc := range testCases {
+		if got := keptParts(tc.opts); got != tc.expected {
+			t.Errorf("keptParts(%+v) = %q, expected %q", tc.opts, got, tc.expected)
+		}
+	}
+}
+
+// runCommand runs a command's RunE with args
+func runCommand(cmd *cobra.Command, args ...string) error {
+	return cmd.RunE(cmd, args)
+}
+
+func TestDNSRecordsCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := runCommand(dnsRecordsAddCmd, "nas.lab", "a", "192.168.100.10"); err != nil {
+		t.Fatalf("records add failed: %v", err)
+	}
+	if err := runCommand(dnsRecordsAddCmd, "nas.lab", "AAAA", "fd00::10"); err != nil {
+		t.Fatalf("records add AAAA failed: %v", err)
+	}
+	for _, args := range [][]string{
+		{"nas.lab", "A", "192.168.100.10"}, // duplicate
+		{"NAS.lab.", "CNAME", "files.lab"}, // CNAME next to other records
+		{"x.lab", "MX", "mail.lab"},
+	} {
+		if err := runCommand(dnsRecordsAddCmd, args...); err == nil {
+			t.Errorf("records add %v should fail", args)
+		}
+	}
+	if err := runCommand(dnsRecordsRemoveCmd, "nas.lab", "aaaa"); err != nil {
+		t.Fatalf("records remove failed: %v", err)
+	}
+	if err := runCommand(dnsRecordsRemoveCmd, "missing.lab"); err == nil {
+		t.Error("records remove of a missing name should fail")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.DNSRecords) != 1 || cfg.DNSRecords[0].Type != "A" {
+		t.Errorf("DNS records = %+v, expected the A record", cfg.DNSRecords)
+	}
+}
+
+func TestDNSUpstreamsCommands(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if err := runCommand(dnsUpstreamsSetCmd, "9.9.9.9"); err != nil {
+		t.Fatalf("upstreams set failed: %v", err)
+	}
+	if err := runCommand(dnsUpstreamsAddCmd, "cloudflare"); err == nil {
+		t.Error("DoH providers should be rejected as DNS servers")
+	}
+	if err := runCommand(dnsUpstreamsRemoveCmd, "9.9.9.9"); err == nil {
+		t.Error("removing the last DNS server should fail")
+	}
+	upstreamsForwarder = true
+	err := runCommand(dnsUpstreamsAddCmd, "cloudflare", "tls://1.1.1.1")
+	upstreamsForwarder = false
+	if err != nil {
+		t.Fatalf("upstreams add --forwarder failed: %v", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.DNSServers, ",") != "9.9.9.9" || strings.Join(cfg.DNSForwarder.Upstreams, ",") != "cloudflare,tls://1.1.1.1" {
+		t.Errorf("DNS servers = %v, forwarder upstreams = %v", cfg.DNSServers, cfg.DNSForwarder.Upstreams)
+	}
+}
+
+func TestGenerateDocs(t *testing.T) {
+	for _, tc := range []struct{ format, page string }{
+		{docsMan, "nat-manager-dns-upstreams-add.8"},
+		{docsMarkdown, "nat-manager_dns_upstreams_add.md"},
+	} {
+		dir := t.TempDir()
+		count, err := generateDocs(rootCmd, tc.format, dir)
+		if err != nil {
+			t.Fatalf("generateDocs(%s) failed: %v", tc.format, err)
+		}
+		files, _ := os.ReadDir(dir)
+		if count != len(files) {
+			t.Errorf("generateDocs(%s) = %d pages, wrote %d files", tc.format, count, len(files))
+		}
+		data, err := os.ReadFile(filepath.Join(dir, tc.page))
+		if err != nil || !strings.Contains(string(data), "--forwarder") {
+			t.Errorf("%s page %s missing or without flags: %v", tc.format, tc.page, err)
+		}
+	}
+
+	if _, err := generateDocs(rootCmd, "html", t.TempDir()); err == nil {
+		t.Error("unknown formats should be rejected")
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	testCases := []struct {
+		err      error
+		expected int
+	}{
+		{nil, ExitOK},
+		{errors.New("boom"), ExitError},
+		{nat.ErrNotRunning, ExitNotRunning},
+		{fmt.Errorf("%w. Start it first", nat.ErrNotRunning), ExitNotRunning},
+		{nat.ErrAlreadyRunning, ExitConflict},
+		{fmt.Errorf("line 2: %w", nat.ErrAlreadyRunning), ExitConflict},
+		{fmt.Errorf("failed to write: %w", os.ErrPermission), ExitPermission},
+		{exitWith(ExitUsage, errors.New("unknown flag: --x")), ExitUsage},
+		{exitWith(ExitNotRunning, nil), ExitNotRunning},
+	}
+	for _, tc := range testCases {
+		if code := ExitCode(tc.err); code != tc.expected {
+			t.Errorf("ExitCode(%v) = %d, expected %d", tc.err, code, tc.expected)
+		}
+	}
+	if msg := exitWith(ExitNotRunning, nil).Error(); msg != "" {
+		t.Errorf("Silent exit error has message %q", msg)
+	}
+}
+
+func TestSilenceOutput(t *testing.T) {
+	defer func(q bool, format string, w io.Writer) { quiet, outputFormat, stdout = q, format, w }(quiet, outputFormat, stdout)
+	realStdout := os.Stdout
+
+	quiet, outputFormat, stdout = true, outputTable, os.Stdout
+	silenceOutput()
+	if stdout != io.Discard || os.Stdout != realStdout {
+		t.Error("--quiet should only discard decorative output, not data written to os.Stdout")
+	}
+
+	quiet, outputFormat, stdout = true, "json", os.Stdout
+	silenceOutput()
+	if stdout != io.Writer(os.Stdout) {
+		t.Error("--quiet should keep JSON output")
+	}
+}
+
+func TestUsageExitCodes(t *testing.T) {
+	// cobra's initializers, which check the host, run for any command
+	defer func(checked bool) { hostChecked = checked }(hostChecked)
+	hostChecked = true
+
+	root := &cobra.Command{Use: "nat-manager", Run: func(*cobra.Command, []string) {}}
+	root.AddCommand(&cobra.Command{Use: "add <name>", Args: cobra.ExactArgs(1), Run: func(*cobra.Command, []string) {}})
+	root.SetOut(&bytes.Buffer{})
+	root.SetErr(&bytes.Buffer{})
+	usageArgs(root)
+
+	for _, args := range [][]string{{"bogus"}, {"add"}, {"add", "a", "b"}} {
+		root.SetArgs(args)
+		if code := ExitCode(unknownCommand(root.Execute())); code != ExitUsage {
+			t.Errorf("%v exits with %d, expected %d", args, code, ExitUsage)
+		}
+	}
+	root.SetArgs([]string{"add", "a"})
+	if err := unknownCommand(root.Execute()); err != nil {
+		t.Errorf("Valid arguments failed: %v", err)
+	}
+}
+
+func TestConfirmOn(t *testing.T) {
+	testCases := []struct {
+		answer   string
+		terminal bool
+		yes      bool
+		expected error
+	}{
+		{"", false, false, nil},
+		{"y\n", true, false, nil},
+		{"YES\n", true, false, nil},
+		{"n\n", true, false, errAborted},
+		{"", true, false, errAborted},
+		{"", true, true, nil},
+	}
+	defer func() { assumeYes = false }()
+	for _, tc := range testCases {
+		assumeYes = tc.yes
+		if err := confirmOn(strings.NewReader(tc.answer), tc.terminal, "Stop?"); err != tc.expected {
+			t.Errorf("confirmOn(%q, terminal %v, yes %v) = %v, expected %v", tc.answer, tc.terminal, tc.yes, err, tc.expected)
+		}
+	}
+}
+
+func TestDaemonJob(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if err := config.SetProfile("lab"); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = config.SetProfile("") }()
+
+	job, err := daemonJob()
+	if err != nil {
+		t.Fatalf("daemonJob failed: %v", err)
+	}
+	if job.Label != launchd.LabelPrefix+"daemon.default" {
+		t.Errorf("Label = %s", job.Label)
+	}
+	if got := strings.Join(job.Program[1:], " "); got != "--profile lab daemon run" {
+		t.Errorf("Program = %s", got)
+	}
+	if !job.RunAtLoad || !job.KeepAlive {
+		t.Error("The daemon should start at boot and be restarted when it exits")
+	}
+	if filepath.Base(job.LogPath) != "daemon.log" {
+		t.Errorf("LogPath = %s", job.LogPath)
+	}
+}
+
+func TestHelperJob(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	helperGroup = "staff"
+	defer func() { helperGroup = "" }()
+
+	job, err := helperJob()
+	if err != nil {
+		t.Fatalf("helperJob failed: %v", err)
+	}
+	if job.Label != launchd.LabelPrefix+"helper.default" {
+		t.Errorf("Label = %s", job.Label)
+	}
+	if got := strings.Join(job.Program[1:], " "); got != "helper run --group staff" {
+		t.Errorf("Program = %s", got)
+	}
+	if !job.RunAtLoad || !job.KeepAlive {
+		t.Error("The helper should start at boot and be restarted when it exits")
+	}
+}
+
+func TestHelperAnnotations(t *testing.T) {
+	for _, cmd := range []*cobra.Command{statusCmd, devicesCmd, connectionsCmd, connectionsKillCmd, stopCmd} {
+		if cmd.Annotations[helperAnnotation] != helperRequired {
+			t.Errorf("%s should run through the helper without root", cmd.Name())
+		}
+	}
+	if startCmd.Annotations[helperAnnotation] != "" {
+		t.Error("start should need root")
+	}
+}
+
+// eventRecorder is an event sink remembering the events sent
+type eventRecorder struct {
+	events []event.Event
+}
+
+func (r *eventRecorder) Send(e event.Event) {
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) Close(context.Context) error {
+	return nil
+}
+
+func TestEmitLeaseEvent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	sink := &eventRecorder{}
+	event.Register(sink)
+	defer func() { _ = event.Close(context.Background()) }()
+
+	emitLeaseEvent([]string{"add", "aa:bb:cc:dd:ee:ff", "192.168.100.50", "laptop"})
+	emitLeaseEvent([]string{"old", "aa:bb:cc:dd:ee:ff", "192.168.100.50"})
+	emitLeaseEvent([]string{"del", "aa:bb:cc:dd:ee:ff", "192.168.100.50"})
+
+	if len(sink.events) != 2 {
+		t.Fatalf("Expected a joined and a left event, got %+v", sink.events)
+	}
+	joined, left := sink.events[0], sink.events[1]
+	if joined.Type != event.DeviceJoined || joined.Data["hostname"] != "laptop" || joined.Data["ip"] != "192.168.100.50" ||
+		joined.Data["known"] != "false" {
+		t.Errorf("Unexpected joined event %+v", joined)
+	}
+	if left.Type != event.DeviceLeft || left.Data["mac"] != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("Unexpected left event %+v", left)
+	}
+}
+
+func TestRenderMenubar(t *testing.T) {
+	var b strings.Builder
+	devices := []nat.Device{
+		{IP: "192.168.100.50", MAC: "aa:bb:cc:dd:ee:01", Hostname: "laptop|work", Online: true},
+		{IP: "192.168.100.51", MAC: "aa:bb:cc:dd:ee:02"},
+	}
+	renderMenubar(&b, api.Summary{Active: true, Devices: 1, ExternalIP: "203.0.113.7"}, devices, "/opt/nat manager/nat-manager")
+	menu := b.String()
+	for _, expected := range []string{
+		"🟢 NAT 1\n---\n",
+		"External IP: 203.0.113.7\n",
+		"--laptop/work  192.168.100.50\n",
+		`Stop NAT | bash="/opt/nat manager/nat-manager" param1=stop terminal=false refresh=true`,
+	} {
+		if !strings.Contains(menu, expected) {
+			t.Errorf("Missing %q in menu:\n%s", expected, menu)
+		}
+	}
+	if strings.Contains(menu, "192.168.100.51") {
+		t.Errorf("Offline devices should not be listed:\n%s", menu)
+	}
+
+	b.Reset()
+	renderMenubar(&b, api.Summary{}, nil, "/usr/local/bin/nat-manager")
+	if !strings.HasPrefix(b.String(), "⚪ NAT\n") ||
+		!strings.Contains(b.String(), "bash=/usr/bin/sudo param1=/usr/local/bin/nat-manager param2=start terminal=true") {
+		t.Errorf("Unexpected menu of stopped NAT:\n%s", b.String())
+	}
+}
+
+func TestMenubarPlugin(t *testing.T) {
+	plugin := menubarPlugin("/Users/o'neil/bin/nat-manager", "lab")
+	if !strings.HasPrefix(plugin, "#!/bin/sh\n") || !strings.Contains(plugin, `exec '/Users/o'\''neil/bin/nat-manager' --instance 'lab' menubar`) {
+		t.Errorf("Unexpected plugin:\n%s", plugin)
+	}
+	if !strings.Contains(menubarPlugin("/usr/local/bin/nat-manager", nat.DefaultInstance), "exec '/usr/local/bin/nat-manager' menubar\n") {
+		t.Error("The default instance should not be passed")
+	}
+}
+
+// switchController is an api.Controller that only starts and stops
+type switchController struct {
+	api.Controller
+	active  bool
+	changes int
+}
+
+func (c *switchController) Status() (*nat.Status, error) {
+	return &nat.Status{Active: c.active}, nil
+}
+
+func (c *switchController) Start() (*nat.Status, error) {
+	if c.active {
+		return nil, nat.ErrAlreadyRunning
+	}
+	c.active = true
+	c.changes++
+	return c.Status()
+}
+
+func (c *switchController) Stop() (*nat.Status, error) {
+	if !c.active {
+		return nil, nat.ErrNotRunning
+	}
+	c.active = false
+	c.changes++
+	return c.Status()
+}
+
+func TestAutomationSet(t *testing.T) {
+	ctrl := &switchController{}
+	steps := []struct {
+		active, changed bool
+	}{
+		{true, true},
+		{true, false},
+		{false, true},
+		{false, false},
+	}
+	for _, step := range steps {
+		var result automationResult
+		if err := automationSet(ctrl, &result, step.active); err != nil {
+			t.Errorf("automationSet(%t): %v", step.active, err)
+		}
+		if result.Changed != step.changed || ctrl.active != step.active {
+			t.Errorf("automationSet(%t): changed = %t, active = %t", step.active, result.Changed, ctrl.active)
+		}
+	}
+	if ctrl.changes != 2 {
+		t.Errorf("Expected 2 changes, got %d", ctrl.changes)
+	}
+}
+
+func TestPrintAutomation(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	err = printAutomation(automationResult{Version: automationVersion, Action: "stop", Instance: "default"}, nat.ErrNotRunning)
+	os.Stdout = stdout
+	_ = w.Close()
+
+	if ExitCode(err) != ExitNotRunning || err.Error() != "" {
+		t.Errorf("Expected a silent not-running exit, got %d %q", ExitCode(err), err)
+	}
+	var result map[string]any
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		t.Fatalf("Output is not JSON: %v", err)
+	}
+	if result["ok"] != false || result["error"] != nat.ErrNotRunning.Error() || result["version"] != float64(1) || result["action"] != "stop" {
+		t.Errorf("Unexpected result %v", result)
+	}
+}
+
+func TestValidateLogLevel(t *testing.T) {
+	defer func() { logLevel = "" }()
+	for level, valid := range map[string]bool{"": true, "debug": true, "WARN": true, "loud": false} {
+		logLevel = level
+		if err := validateLogLevel(); (err == nil) != valid {
+			t.Errorf("validateLogLevel(%q) = %v, want valid %t", level, err, valid)
+		}
+	}
+}
+
+func TestSimulatedSession(t *testing.T) {
+	recording := simulatedSession(7)
+	if len(recording.Frames) != simulatedFrames {
+		t.Fatalf("Expected %d frames, got %d", simulatedFrames, len(recording.Frames))
+	}
+	first, last := recording.Frames[0].Status, recording.Frames[len(recording.Frames)-1].Status
+	if len(first.ConnectedDevices) != simulatedDevices || len(first.ActiveConnections) != simulatedConnections {
+		t.Errorf("Unexpected first frame: %d devices, %d connections", len(first.ConnectedDevices), len(first.ActiveConnections))
+	}
+	if last.BytesIn <= first.BytesIn || last.Interfaces[0].BytesIn != last.BytesIn {
+		t.Errorf("Expected traffic to grow on the external interface, got %d then %+v", first.BytesIn, last.Interfaces)
+	}
+	again := simulatedSession(7)
+	if !reflect.DeepEqual(again.Frames[len(again.Frames)-1], recording.Frames[len(recording.Frames)-1]) {
+		t.Error("The same seed should generate the same session")
+	}
+}
+
+// BenchmarkMonitorPipeline pushes generated connection tables through the
+// filter, sort and rendering of a monitor frame
+func BenchmarkMonitorPipeline(b *testing.B) {
+	defer func(w io.Writer, filter nat.ConnectionFilter, sort string) {
+		stdout, connFilter, monitorSort = w, filter, sort
+	}(stdout, connFilter, monitorSort)
+	stdout, monitorSort = io.Discard, "destination"
+	var err error
+	if connFilter, err = nat.ParseConnectionFilter([]string{"proto=tcp"}); err != nil {
+		b.Fatal(err)
+	}
+
+	header := session.Header{ExternalInterface: "en0", InternalInterface: "bridge100", InternalNetwork: "192.168.100"}
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			g := fake.New(1, header.InternalNetwork)
+			devices := g.Devices(50)
+			status := g.Status(devices, g.Connections(devices, n))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				printMonitorFrame(header, status, fake.Epoch)
+			}
+		})
+	}
+}
@@ -3,19 +3,81 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/ddns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/fingerprint"
+	"github.com/scttfrdmn/macos-nat-manager/internal/flow"
+	"github.com/scttfrdmn/macos-nat-manager/internal/influx"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logging"
+	"github.com/scttfrdmn/macos-nat-manager/internal/mqtt"
+	"github.com/scttfrdmn/macos-nat-manager/internal/names"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/notify"
+	"github.com/scttfrdmn/macos-nat-manager/internal/portal"
+	"github.com/scttfrdmn/macos-nat-manager/internal/snmp"
+	"github.com/scttfrdmn/macos-nat-manager/internal/vmnet"
+	"github.com/scttfrdmn/macos-nat-manager/internal/webhook"
+	"github.com/scttfrdmn/macos-nat-manager/internal/wireguard"
 )
 
 // Config represents the NAT manager configuration
 type Config struct {
-	ExternalInterface string    `yaml:"external_interface" json:"external_interface"`
-	InternalInterface string    `yaml:"internal_interface" json:"internal_interface"`
-	InternalNetwork   string    `yaml:"internal_network" json:"internal_network"`
-	DHCPRange         DHCPRange `yaml:"dhcp_range" json:"dhcp_range"`
-	DNSServers        []string  `yaml:"dns_servers" json:"dns_servers"`
+	ExternalInterface string        `yaml:"external_interface" json:"external_interface"`
+	InternalInterface string        `yaml:"internal_interface" json:"internal_interface"`
+	InternalNetwork   string        `yaml:"internal_network" json:"internal_network"`
+	DHCPRange         DHCPRange     `yaml:"dhcp_range" json:"dhcp_range"`
+	DHCPLeases        []DeviceLease `yaml:"dhcp_leases,omitempty" json:"dhcp_leases,omitempty"`
+	SearchDomains     []string      `yaml:"search_domains,omitempty" json:"search_domains,omitempty"` // advertised as DHCP option 119
+	NTPServers        []string      `yaml:"ntp_servers,omitempty" json:"ntp_servers,omitempty"`       // advertised as DHCP option 42
+	DNSServers        []string      `yaml:"dns_servers" json:"dns_servers"`
+	LocalDomain       string        `yaml:"local_domain" json:"local_domain"`
+	DNSRecords        []DNSRecord   `yaml:"dns_records,omitempty" json:"dns_records,omitempty"`
+	Backends          BackendConfig `yaml:"backends,omitempty" json:"backends,omitempty"`
+
+	PortForwards    []PortForward       `yaml:"port_forwards,omitempty" json:"port_forwards,omitempty"`
+	BlockedDevices  []string            `yaml:"blocked_devices,omitempty" json:"blocked_devices,omitempty"`   // MACs or IPs
+	IsolatedDevices []string            `yaml:"isolated_devices,omitempty" json:"isolated_devices,omitempty"` // MACs or IPs kept off the internet
+	DeviceClasses   []DeviceClassPolicy `yaml:"device_classes,omitempty" json:"device_classes,omitempty"`
+	Lockdown        LockdownConfig      `yaml:"lockdown,omitempty" json:"lockdown,omitempty"`
+	Portal          PortalConfig        `yaml:"portal,omitempty" json:"portal,omitempty"`
+
+	Bandwidth      BandwidthConfig      `yaml:"bandwidth,omitempty" json:"bandwidth,omitempty"`
+	DeviceLabels   map[string]string    `yaml:"device_labels,omitempty" json:"device_labels,omitempty"` // MAC or IP -> name
+	NameResolution NameResolutionConfig `yaml:"name_resolution" json:"name_resolution"`
+
+	DNSForwarder DNSForwarderConfig  `yaml:"dns_forwarder" json:"dns_forwarder"`
+	DNSBlocklist DNSBlocklistConfig  `yaml:"dns_blocklist" json:"dns_blocklist"`
+	MDNS         MDNSReflectorConfig `yaml:"mdns_reflector,omitempty" json:"mdns_reflector,omitempty"`
+	API          APIConfig           `yaml:"api" json:"api"`
+	Webhooks     []WebhookConfig     `yaml:"webhooks,omitempty" json:"webhooks,omitempty"`
+	TrafficQuota string              `yaml:"traffic_quota,omitempty" json:"traffic_quota,omitempty"` // e.g. 50GB, sends quota.exceeded
+	MQTT         MQTTConfig          `yaml:"mqtt,omitempty" json:"mqtt,omitempty"`
+	Notify       NotifyConfig        `yaml:"notifications,omitempty" json:"notifications,omitempty"`
+	Logging      LoggingConfig       `yaml:"logging,omitempty" json:"logging,omitempty"`
+	FlowExport   FlowExportConfig    `yaml:"flow_export,omitempty" json:"flow_export,omitempty"`
+	Influx       InfluxConfig        `yaml:"influx,omitempty" json:"influx,omitempty"`
+	SNMP         SNMPConfig          `yaml:"snmp,omitempty" json:"snmp,omitempty"`
+	DDNS         DDNSConfig          `yaml:"ddns,omitempty" json:"ddns,omitempty"`
+	WireGuard    WireGuardConfig     `yaml:"wireguard,omitempty" json:"wireguard,omitempty"`
+	ContainerVMs []ContainerVMConfig `yaml:"container_vms,omitempty" json:"container_vms,omitempty"`
+	VMNetworks   []string            `yaml:"vm_networks,omitempty" json:"vm_networks,omitempty"` // hypervisor networks kept in the internal bridge
+	Backup       BackupConfig        `yaml:"backup,omitempty" json:"backup,omitempty"`
+	Schedule     []ScheduleEntry     `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+	TUI          TUIConfig           `yaml:"tui,omitempty" json:"tui,omitempty"`
 
 	// Runtime fields (not saved to config)
 	Active bool `yaml:"-" json:"active"`
@@ -23,9 +85,1028 @@ type Config struct {
 
 // DHCPRange represents the DHCP IP range configuration
 type DHCPRange struct {
-	Start string `yaml:"start" json:"start"`
-	End   string `yaml:"end" json:"end"`
-	Lease string `yaml:"lease" json:"lease"`
+	Start   string   `yaml:"start" json:"start"`
+	End     string   `yaml:"end" json:"end"`
+	Lease   string   `yaml:"lease" json:"lease"`
+	Exclude []string `yaml:"exclude,omitempty" json:"exclude,omitempty"` // addresses or first-last ranges
+}
+
+// BackendConfig selects the servers answering DHCP and DNS on the internal
+// network. dnsmasq serves both by default.
+type BackendConfig struct {
+	DHCP string `yaml:"dhcp,omitempty" json:"dhcp,omitempty"` // dnsmasq or kea
+	DNS  string `yaml:"dns,omitempty" json:"dns,omitempty"`   // dnsmasq or coredns
+}
+
+// DeviceLease sets the lease time for a single device by MAC, or reserves
+// it an address
+type DeviceLease struct {
+	MAC   string `yaml:"mac" json:"mac"`
+	Lease string `yaml:"lease,omitempty" json:"lease,omitempty"`
+	IP    string `yaml:"ip,omitempty" json:"ip,omitempty"` // reserved address
+}
+
+// DNSRecord is a static A, AAAA or CNAME record answered by the internal DNS
+type DNSRecord struct {
+	Name  string `yaml:"name" json:"name"`
+	Type  string `yaml:"type" json:"type"`
+	Value string `yaml:"value" json:"value"`
+}
+
+// PortForward redirects an external port to a device on the internal network
+type PortForward struct {
+	Protocol     string `yaml:"protocol" json:"protocol"` // tcp, udp or tcp/udp
+	ExternalPort int    `yaml:"external_port" json:"external_port"`
+	InternalIP   string `yaml:"internal_ip" json:"internal_ip"`
+	InternalPort int    `yaml:"internal_port" json:"internal_port"`
+	Description  string `yaml:"description,omitempty" json:"description,omitempty"`
+}
+
+// DeviceClassPolicy applies defaults to every device of a detected class,
+// e.g. isolating all printers or capping all cameras
+type DeviceClassPolicy struct {
+	Class   string `yaml:"class" json:"class"` // e.g. Printer, Camera or Raspberry Pi
+	Block   bool   `yaml:"block,omitempty" json:"block,omitempty"`
+	Isolate bool   `yaml:"isolate,omitempty" json:"isolate,omitempty"` // internal network only
+	Group   string `yaml:"group,omitempty" json:"group,omitempty"`     // bandwidth group to join
+	Cap     string `yaml:"cap,omitempty" json:"cap,omitempty"`         // shared limit, e.g. 2Mbit/s
+}
+
+// TUIConfig holds preferences of the interactive interface
+type TUIConfig struct {
+	SkipConfirm bool              `yaml:"skip_confirm,omitempty" json:"skip_confirm,omitempty"` // start, stop, block and delete without asking
+	Theme       string            `yaml:"theme,omitempty" json:"theme,omitempty"`               // default, light, mono or ascii
+	Colors      map[string]string `yaml:"colors,omitempty" json:"colors,omitempty"`             // overrides of the theme's colors by role
+	Refresh     RefreshConfig     `yaml:"refresh,omitempty" json:"refresh,omitempty"`
+}
+
+// RefreshConfig sets how often the interactive interface reloads what its
+// views show
+type RefreshConfig struct {
+	Interval string            `yaml:"interval,omitempty" json:"interval,omitempty"` // default 2s
+	Idle     string            `yaml:"idle,omitempty" json:"idle,omitempty"`         // at least this while NAT is inactive, default 10s
+	Views    map[string]string `yaml:"views,omitempty" json:"views,omitempty"`       // intervals by view, e.g. monitor: 1s
+}
+
+// Defaults and lower bound of the refresh intervals
+const (
+	DefaultRefresh     = 2 * time.Second
+	DefaultIdleRefresh = 10 * time.Second
+	MinRefresh         = 500 * time.Millisecond
+)
+
+// GetInterval returns how often view is refreshed, backing off to the idle
+// interval while NAT is inactive
+func (r RefreshConfig) GetInterval(view string, active bool) time.Duration {
+	interval := refreshDuration(r.Interval, DefaultRefresh)
+	if d, ok := r.Views[view]; ok {
+		interval = refreshDuration(d, interval)
+	}
+	if !active {
+		interval = max(interval, refreshDuration(r.Idle, DefaultIdleRefresh))
+	}
+	return interval
+}
+
+// refreshDuration parses a refresh interval, or returns fallback if it is
+// empty or invalid
+func refreshDuration(value string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d < MinRefresh {
+		return fallback
+	}
+	return d
+}
+
+// Themes of the interactive interface
+const (
+	ThemeDefault = "default"
+	ThemeLight   = "light" // for light terminal backgrounds
+	ThemeMono    = "mono"  // no colors
+	ThemeASCII   = "ascii" // no colors, symbols or box drawing, for limited terminals and screen readers
+)
+
+// ColorRoles are the parts of the interface whose color can be set in tui.colors
+var ColorRoles = []string{"title", "help", "error", "success", "warning", "accent"}
+
+// validateTUI checks the theme and the color overrides, which are ANSI
+// numbers (0-255) or hex colors such as #ff8800
+func validateTUI(tui TUIConfig) error {
+	switch tui.Theme {
+	case "", ThemeDefault, ThemeLight, ThemeMono, ThemeASCII:
+	default:
+		return fmt.Errorf("unknown theme %q, use %s, %s, %s or %s", tui.Theme, ThemeDefault, ThemeLight, ThemeMono, ThemeASCII)
+	}
+	for name, value := range map[string]string{"refresh interval": tui.Refresh.Interval, "idle refresh": tui.Refresh.Idle} {
+		if err := validRefresh(name, value); err != nil {
+			return err
+		}
+	}
+	for view, value := range tui.Refresh.Views {
+		if err := validRefresh(view+" refresh", value); err != nil {
+			return err
+		}
+	}
+	for role, color := range tui.Colors {
+		if !slices.Contains(ColorRoles, role) {
+			return fmt.Errorf("unknown color role %q, use one of %s", role, strings.Join(ColorRoles, ", "))
+		}
+		if !validColor(color) {
+			return fmt.Errorf("color %s: %q is neither an ANSI number nor a hex color", role, color)
+		}
+	}
+	return nil
+}
+
+// validRefresh checks a refresh interval, which may be empty
+func validRefresh(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q (e.g. 1s or 500ms)", name, value)
+	}
+	if d < MinRefresh {
+		return fmt.Errorf("%s %s is below the minimum of %s", name, value, MinRefresh)
+	}
+	return nil
+}
+
+// validColor reports whether color is an ANSI number or a #rgb or #rrggbb hex color
+func validColor(color string) bool {
+	if n, err := strconv.Atoi(color); err == nil {
+		return n >= 0 && n <= 255
+	}
+	hex, ok := strings.CutPrefix(color, "#")
+	if !ok || len(hex) != 3 && len(hex) != 6 {
+		return false
+	}
+	_, err := strconv.ParseUint(hex, 16, 32)
+	return err == nil
+}
+
+// LockdownConfig limits internal clients to an explicit list of
+// destinations, e.g. on exam, kiosk or device certification networks
+type LockdownConfig struct {
+	Enabled bool     `yaml:"enabled" json:"enabled"`
+	Allow   []string `yaml:"allow,omitempty" json:"allow,omitempty"` // IPs, CIDRs or domains (with subdomains)
+}
+
+// PortalConfig configures the captive portal new devices must accept before
+// they get internet access
+type PortalConfig struct {
+	Enabled    bool   `yaml:"enabled" json:"enabled"`
+	Port       int    `yaml:"port,omitempty" json:"port,omitempty"`         // gateway port, 8880 by default
+	Title      string `yaml:"title,omitempty" json:"title,omitempty"`       // page heading
+	Message    string `yaml:"message,omitempty" json:"message,omitempty"`   // terms shown on the page
+	Passphrase string `yaml:"passphrase,omitempty" json:"-"`                // required to accept when set
+	Duration   string `yaml:"duration,omitempty" json:"duration,omitempty"` // e.g. 8h, until revoked if empty
+}
+
+// GetPort returns the gateway port the portal listens on
+func (p PortalConfig) GetPort() int {
+	if p.Port <= 0 {
+		return portal.DefaultPort
+	}
+	return p.Port
+}
+
+// GetDuration returns how long admitted devices keep access, 0 until revoked
+func (p PortalConfig) GetDuration() (time.Duration, error) {
+	if p.Duration == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(p.Duration)
+	if err != nil || duration < time.Minute {
+		return 0, fmt.Errorf("invalid portal duration %q (e.g. 45m or 8h)", p.Duration)
+	}
+	return duration, nil
+}
+
+// BandwidthConfig configures minimum bandwidth guarantees for device groups
+// and caps for sets of devices.
+// Uplink and downlink should be set slightly below the real link speed so
+// that queues form on this host rather than at the modem.
+type BandwidthConfig struct {
+	Uplink   string              `yaml:"uplink,omitempty" json:"uplink,omitempty"` // e.g. 100Mbit/s
+	Downlink string              `yaml:"downlink,omitempty" json:"downlink,omitempty"`
+	Groups   []DeviceGroupConfig `yaml:"groups,omitempty" json:"groups,omitempty"`
+	Caps     []DeviceCapConfig   `yaml:"caps,omitempty" json:"caps,omitempty"`
+}
+
+// DeviceGroupConfig is a named set of devices with a guaranteed minimum
+// share of the link in each direction
+type DeviceGroupConfig struct {
+	Name      string   `yaml:"name" json:"name"`
+	Devices   []string `yaml:"devices" json:"devices"`     // MACs or IPs
+	Guarantee string   `yaml:"guarantee" json:"guarantee"` // e.g. 20Mbit/s
+}
+
+// DeviceCapConfig is a named set of devices sharing a bandwidth limit in
+// each direction
+type DeviceCapConfig struct {
+	Name    string   `yaml:"name" json:"name"`
+	Devices []string `yaml:"devices" json:"devices"` // MACs or IPs
+	Rate    string   `yaml:"rate" json:"rate"`       // e.g. 2Mbit/s
+}
+
+// DNSForwarderConfig configures the embedded caching DNS forwarder, which
+// replaces dnsmasq's DNS service when enabled
+type DNSForwarderConfig struct {
+	Enabled   bool     `yaml:"enabled" json:"enabled"`
+	Listen    string   `yaml:"listen,omitempty" json:"listen,omitempty"`       // defaults to <gateway>:53
+	Upstreams []string `yaml:"upstreams,omitempty" json:"upstreams,omitempty"` // defaults to dns_servers
+	Fallbacks []string `yaml:"fallbacks,omitempty" json:"fallbacks,omitempty"` // used only when all upstreams fail
+	CacheSize int      `yaml:"cache_size" json:"cache_size"`
+
+	Conditional []ConditionalForward `yaml:"conditional,omitempty" json:"conditional,omitempty"` // split DNS
+	Policies    []DNSPolicy          `yaml:"policies,omitempty" json:"policies,omitempty"`       // per-device resolvers
+	QueryLog    QueryLogConfig       `yaml:"query_log" json:"query_log"`
+}
+
+// DNSPolicy sends the queries of a group of devices to their own resolvers,
+// e.g. children's devices to a family-safe resolver
+type DNSPolicy struct {
+	Name      string   `yaml:"name" json:"name"`
+	Upstreams []string `yaml:"upstreams" json:"upstreams"` // replace upstreams and fallbacks
+	Devices   []string `yaml:"devices" json:"devices"`     // MACs or IPs
+}
+
+// validateDNSPolicies checks that policies are named, have resolvers and
+// that no device belongs to two of them
+func validateDNSPolicies(policies []DNSPolicy) error {
+	names := make(map[string]bool)
+	members := make(map[string]string)
+	for _, policy := range policies {
+		if policy.Name == "" || len(policy.Upstreams) == 0 {
+			return fmt.Errorf("DNS policy %q needs a name and upstreams", policy.Name)
+		}
+		if names[policy.Name] {
+			return fmt.Errorf("duplicate DNS policy %q", policy.Name)
+		}
+		names[policy.Name] = true
+
+		for _, device := range policy.Devices {
+			if err := nat.ValidateDevice(device); err != nil {
+				return fmt.Errorf("DNS policy %q: %w", policy.Name, err)
+			}
+			key := strings.ToLower(device)
+			if other, ok := members[key]; ok {
+				return fmt.Errorf("device %s is in DNS policies %q and %q", device, other, policy.Name)
+			}
+			members[key] = policy.Name
+		}
+	}
+	return nil
+}
+
+// QueryLogConfig configures per-device DNS query logging. Logging is off by
+// default and entries are deleted once older than the retention period.
+type QueryLogConfig struct {
+	Enabled   bool     `yaml:"enabled" json:"enabled"`
+	Retention string   `yaml:"retention,omitempty" json:"retention,omitempty"` // defaults to 24h
+	Exclude   []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`     // device IPs or MACs never logged
+}
+
+// GetRetention returns how long logged queries are kept
+func (q QueryLogConfig) GetRetention() time.Duration {
+	retention, err := time.ParseDuration(q.Retention)
+	if err != nil || retention <= 0 {
+		return 24 * time.Hour
+	}
+	return retention
+}
+
+// ConditionalForward sends queries for a domain and its subdomains to
+// specific resolvers, e.g. corp.example to a VPN's DNS server
+type ConditionalForward struct {
+	Domain    string   `yaml:"domain" json:"domain"`
+	Upstreams []string `yaml:"upstreams" json:"upstreams"`
+}
+
+// DNSBlocklistConfig configures Pi-hole-style DNS blocking in the embedded
+// DNS forwarder
+type DNSBlocklistConfig struct {
+	Enabled         bool     `yaml:"enabled" json:"enabled"`
+	URLs            []string `yaml:"urls,omitempty" json:"urls,omitempty"`           // hosts-format lists
+	Allowlist       []string `yaml:"allowlist,omitempty" json:"allowlist,omitempty"` // never blocked
+	Domains         []string `yaml:"domains,omitempty" json:"domains,omitempty"`     // blocked by hand, even when allowlisted
+	Bypass          []string `yaml:"bypass,omitempty" json:"bypass,omitempty"`       // device IPs or MACs
+	RefreshInterval string   `yaml:"refresh_interval" json:"refresh_interval"`
+}
+
+// NameResolutionConfig sets where device names come from, in priority order
+type NameResolutionConfig struct {
+	Sources []string `yaml:"sources,omitempty" json:"sources,omitempty"` // label, dhcp, mdns, netbios, reverse_dns
+	Timeout string   `yaml:"timeout,omitempty" json:"timeout,omitempty"` // per lookup
+}
+
+// GetSources returns the configured resolution order or the default one
+func (n NameResolutionConfig) GetSources() []string {
+	if len(n.Sources) > 0 {
+		return n.Sources
+	}
+	return names.DefaultSources
+}
+
+// GetTimeout returns the per-lookup timeout
+func (n NameResolutionConfig) GetTimeout() time.Duration {
+	timeout, err := time.ParseDuration(n.Timeout)
+	if err != nil || timeout <= 0 {
+		return names.DefaultTimeout
+	}
+	return timeout
+}
+
+// MDNSReflectorConfig configures which Bonjour services are reflected
+// between the host network and the NAT network
+type MDNSReflectorConfig struct {
+	Services   []string `yaml:"services,omitempty" json:"services,omitempty"`     // e.g. _airplay._tcp; common services if empty
+	Interfaces []string `yaml:"interfaces,omitempty" json:"interfaces,omitempty"` // defaults to the external and internal interface
+}
+
+// GetMDNSInterfaces returns the interfaces mDNS is reflected between
+func (c *Config) GetMDNSInterfaces() []string {
+	if len(c.MDNS.Interfaces) > 0 {
+		return c.MDNS.Interfaces
+	}
+	return []string{c.ExternalInterface, c.InternalInterface}
+}
+
+// BackupConfig configures scheduled backups of configuration and state
+type BackupConfig struct {
+	Target   string `yaml:"target,omitempty" json:"target,omitempty"`     // directory, scp://[user@]host[:port]/path or s3://bucket/prefix
+	Interval string `yaml:"interval,omitempty" json:"interval,omitempty"` // between scheduled backups, default 24h
+	Keep     int    `yaml:"keep,omitempty" json:"keep,omitempty"`         // archives kept on the target, default 7
+}
+
+// GetInterval returns the time between scheduled backups
+func (b BackupConfig) GetInterval() time.Duration {
+	interval, err := time.ParseDuration(b.Interval)
+	if err != nil || interval < time.Minute {
+		return 24 * time.Hour
+	}
+	return interval
+}
+
+// GetKeep returns how many archives are kept on the target
+func (b BackupConfig) GetKeep() int {
+	if b.Keep <= 0 {
+		return 7
+	}
+	return b.Keep
+}
+
+// GetTarget returns the backup destination, the backups directory below the
+// configuration directory if none is configured
+func (b BackupConfig) GetTarget() (string, error) {
+	if b.Target != "" {
+		return b.Target, nil
+	}
+	dir, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "backups"), nil
+}
+
+// WebhookConfig is a URL that receives events as JSON
+type WebhookConfig struct {
+	URL    string   `yaml:"url" json:"url"`
+	Secret string   `yaml:"secret,omitempty" json:"-"`                // signs payloads with HMAC-SHA256
+	Events []string `yaml:"events,omitempty" json:"events,omitempty"` // all events if empty
+}
+
+// Hooks returns the webhooks to deliver events to
+func (c *Config) Hooks() []webhook.Hook {
+	hooks := make([]webhook.Hook, 0, len(c.Webhooks))
+	for _, w := range c.Webhooks {
+		hooks = append(hooks, webhook.Hook{URL: w.URL, Secret: w.Secret, Events: w.Events})
+	}
+	return hooks
+}
+
+// ValidateWebhooks checks that webhooks have HTTP URLs, set once, and
+// known events
+func ValidateWebhooks(webhooks []WebhookConfig) error {
+	seen := make(map[string]bool)
+	for _, w := range webhooks {
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL %q (use http:// or https://)", w.URL)
+		}
+		if seen[w.URL] {
+			return fmt.Errorf("%s is set more than once", w.URL)
+		}
+		seen[w.URL] = true
+		for _, typ := range w.Events {
+			if !event.Valid(typ) {
+				return fmt.Errorf("unknown event %q for %s (use %s)", typ, w.URL, strings.Join(event.Types, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// trafficQuota returns the traffic quota in bytes, 0 when unset or invalid
+func (c *Config) trafficQuota() uint64 {
+	if c.TrafficQuota == "" {
+		return 0
+	}
+	quota, _ := nat.ParseSize(c.TrafficQuota)
+	return quota
+}
+
+// MQTTConfig configures publishing the instance's state to an MQTT broker
+type MQTTConfig struct {
+	Enabled         bool   `yaml:"enabled" json:"enabled"`
+	Broker          string `yaml:"broker,omitempty" json:"broker,omitempty"` // e.g. tcp://homeassistant.local:1883
+	Username        string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password        string `yaml:"password,omitempty" json:"-"`
+	TopicPrefix     string `yaml:"topic_prefix,omitempty" json:"topic_prefix,omitempty"` // nat-manager by default
+	HomeAssistant   bool   `yaml:"home_assistant" json:"home_assistant"`                 // publish discovery configs
+	DiscoveryPrefix string `yaml:"discovery_prefix,omitempty" json:"discovery_prefix,omitempty"`
+	Interval        string `yaml:"interval,omitempty" json:"interval,omitempty"` // 30s by default
+}
+
+// GetInterval returns how often the state is published
+func (m MQTTConfig) GetInterval() (time.Duration, error) {
+	if m.Interval == "" {
+		return mqtt.DefaultInterval, nil
+	}
+	interval, err := time.ParseDuration(m.Interval)
+	if err != nil || interval < time.Second {
+		return 0, fmt.Errorf("invalid mqtt interval %q (e.g. 10s or 1m)", m.Interval)
+	}
+	return interval, nil
+}
+
+// validate checks the broker URL and interval of enabled publishing
+func (m MQTTConfig) validate() error {
+	if !m.Enabled {
+		return nil
+	}
+	u, err := url.Parse(m.Broker)
+	if err != nil || !slices.Contains(mqtt.Schemes, u.Scheme) || u.Host == "" {
+		return fmt.Errorf("invalid broker %q (e.g. tcp://homeassistant.local:1883)", m.Broker)
+	}
+	_, err = m.GetInterval()
+	return err
+}
+
+// MQTTOptions returns the options of the instance's MQTT publisher
+func (c *Config) MQTTOptions() mqtt.Options {
+	interval, _ := c.MQTT.GetInterval()
+	return mqtt.Options{
+		Broker:          c.MQTT.Broker,
+		Username:        c.MQTT.Username,
+		Password:        c.MQTT.Password,
+		Instance:        instance,
+		TopicPrefix:     c.MQTT.TopicPrefix,
+		HomeAssistant:   c.MQTT.HomeAssistant,
+		DiscoveryPrefix: c.MQTT.DiscoveryPrefix,
+		Interval:        interval,
+	}
+}
+
+// NotifyConfig turns Notification Center alerts on
+type NotifyConfig struct {
+	UnknownDevice bool `yaml:"unknown_device" json:"unknown_device"` // a device never seen before joined
+	WANDown       bool `yaml:"wan_down" json:"wan_down"`             // the uplink lost its address
+	QuotaExceeded bool `yaml:"quota_exceeded" json:"quota_exceeded"` // traffic reached traffic_quota
+	NATStopped    bool `yaml:"nat_stopped" json:"nat_stopped"`       // NAT stopped without being asked to
+}
+
+// Alerts returns the alerts turned on
+func (n NotifyConfig) Alerts() []string {
+	var alerts []string
+	for alert, on := range map[string]bool{
+		notify.UnknownDevice: n.UnknownDevice,
+		notify.WANDown:       n.WANDown,
+		notify.QuotaExceeded: n.QuotaExceeded,
+		notify.NATStopped:    n.NATStopped,
+	} {
+		if on {
+			alerts = append(alerts, alert)
+		}
+	}
+	slices.Sort(alerts)
+	return alerts
+}
+
+// KnownDevice reports whether the device with mac has a label or a
+// reserved lease, or got a lease before
+func (c *Config) KnownDevice(mac string) bool {
+	for key := range c.DeviceLabels {
+		if strings.EqualFold(key, mac) {
+			return true
+		}
+	}
+	for _, lease := range c.DHCPLeases {
+		if strings.EqualFold(lease.MAC, mac) {
+			return true
+		}
+	}
+	path, err := GetFingerprintPath()
+	if err != nil {
+		return false
+	}
+	observations, err := fingerprint.Load(path)
+	if err != nil {
+		return false
+	}
+	_, seen := observations[strings.ToLower(mac)]
+	return seen
+}
+
+// FlowExportConfig configures exporting NAT sessions to a NetFlow v9 or
+// IPFIX collector
+type FlowExportConfig struct {
+	Enabled       bool   `yaml:"enabled" json:"enabled"`
+	Collector     string `yaml:"collector,omitempty" json:"collector,omitempty"`           // host[:port], e.g. 10.0.0.5:4739
+	Protocol      string `yaml:"protocol,omitempty" json:"protocol,omitempty"`             // ipfix (default) or netflow9
+	Interval      string `yaml:"interval,omitempty" json:"interval,omitempty"`             // how often states are read, 10s by default
+	ActiveTimeout string `yaml:"active_timeout,omitempty" json:"active_timeout,omitempty"` // how often long flows are reported, 1m by default
+	Domain        uint32 `yaml:"domain,omitempty" json:"domain,omitempty"`                 // observation domain or source ID
+}
+
+// durations returns the interval and active timeout of the export
+func (f FlowExportConfig) durations() (time.Duration, time.Duration, error) {
+	interval, activeTimeout := flow.DefaultInterval, flow.DefaultActiveTimeout
+	var err error
+	if f.Interval != "" {
+		if interval, err = time.ParseDuration(f.Interval); err != nil || interval < time.Second {
+			return 0, 0, fmt.Errorf("invalid interval %q (e.g. 10s)", f.Interval)
+		}
+	}
+	if f.ActiveTimeout != "" {
+		if activeTimeout, err = time.ParseDuration(f.ActiveTimeout); err != nil || activeTimeout < interval {
+			return 0, 0, fmt.Errorf("invalid active_timeout %q (e.g. 1m, at least the interval)", f.ActiveTimeout)
+		}
+	}
+	return interval, activeTimeout, nil
+}
+
+// validate checks the collector, protocol and durations of the export
+func (f FlowExportConfig) validate() error {
+	if f.Protocol != "" && !slices.Contains(flow.Protocols, f.Protocol) {
+		return fmt.Errorf("invalid protocol %q (ipfix or netflow9)", f.Protocol)
+	}
+	if f.Enabled || f.Collector != "" {
+		if _, err := flow.CollectorAddr(f.Collector, f.Protocol); err != nil {
+			return err
+		}
+	}
+	_, _, err := f.durations()
+	return err
+}
+
+// FlowOptions returns the options of the instance's flow exporter
+func (c *Config) FlowOptions() flow.Options {
+	interval, activeTimeout, _ := c.FlowExport.durations()
+	return flow.Options{
+		Collector:     c.FlowExport.Collector,
+		Protocol:      c.FlowExport.Protocol,
+		Interval:      interval,
+		ActiveTimeout: activeTimeout,
+		Domain:        c.FlowExport.Domain,
+	}
+}
+
+// InfluxConfig configures pushing metrics in the InfluxDB line protocol
+type InfluxConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled"`
+	URL      string `yaml:"url,omitempty" json:"url,omitempty"` // e.g. http://influx.local:8086 or udp://telegraf.local:8094
+	Token    string `yaml:"token,omitempty" json:"-"`
+	Org      string `yaml:"org,omitempty" json:"org,omitempty"`
+	Bucket   string `yaml:"bucket,omitempty" json:"bucket,omitempty"`
+	Database string `yaml:"database,omitempty" json:"database,omitempty"` // InfluxDB 1, instead of bucket
+	Interval string `yaml:"interval,omitempty" json:"interval,omitempty"` // 30s by default
+}
+
+// GetInterval returns how often metrics are pushed
+func (i InfluxConfig) GetInterval() (time.Duration, error) {
+	if i.Interval == "" {
+		return influx.DefaultInterval, nil
+	}
+	interval, err := time.ParseDuration(i.Interval)
+	if err != nil || interval < time.Second {
+		return 0, fmt.Errorf("invalid influx interval %q (e.g. 10s or 1m)", i.Interval)
+	}
+	return interval, nil
+}
+
+// validate checks the URL and interval of enabled pushing
+func (i InfluxConfig) validate() error {
+	if !i.Enabled {
+		return nil
+	}
+	if err := i.options().Validate(); err != nil {
+		return err
+	}
+	_, err := i.GetInterval()
+	return err
+}
+
+func (i InfluxConfig) options() influx.Options {
+	return influx.Options{URL: i.URL, Token: i.Token, Org: i.Org, Bucket: i.Bucket, Database: i.Database}
+}
+
+// InfluxOptions returns the options of the instance's metrics writer
+func (c *Config) InfluxOptions() influx.Options {
+	return c.Influx.options()
+}
+
+// SNMPConfig configures the read-only SNMP agent
+type SNMPConfig struct {
+	Enabled   bool   `yaml:"enabled" json:"enabled"`
+	Listen    string `yaml:"listen,omitempty" json:"listen,omitempty"` // defaults to <gateway>:161
+	Community string `yaml:"community,omitempty" json:"-"`             // public by default
+	Contact   string `yaml:"contact,omitempty" json:"contact,omitempty"`
+	Location  string `yaml:"location,omitempty" json:"location,omitempty"`
+}
+
+// validate checks the listen address of the agent
+func (s SNMPConfig) validate() error {
+	if s.Listen == "" {
+		return nil
+	}
+	if _, port, err := net.SplitHostPort(s.Listen); err != nil || port == "" {
+		return fmt.Errorf("invalid listen %q (e.g. 192.168.100.1:161)", s.Listen)
+	}
+	return nil
+}
+
+// GetSNMPListenAddr returns the address the SNMP agent binds to
+func (c *Config) GetSNMPListenAddr() string {
+	if c.SNMP.Listen != "" {
+		return c.SNMP.Listen
+	}
+	return fmt.Sprintf("%s:%d", c.GetGatewayIP(), snmp.DefaultPort)
+}
+
+// SNMPOptions returns the options of the instance's SNMP agent
+func (c *Config) SNMPOptions() snmp.Options {
+	return snmp.Options{Listen: c.GetSNMPListenAddr(), Community: c.SNMP.Community}
+}
+
+// DDNSConfig configures keeping dynamic DNS records at the external
+// address
+type DDNSConfig struct {
+	Enabled  bool         `yaml:"enabled" json:"enabled"`
+	IPSource string       `yaml:"ip_source,omitempty" json:"ip_source,omitempty"` // web (default) or interface
+	IPURL    string       `yaml:"ip_url,omitempty" json:"ip_url,omitempty"`       // answers the address, https://api.ipify.org by default
+	Interval string       `yaml:"interval,omitempty" json:"interval,omitempty"`   // 5m by default
+	Records  []DDNSRecord `yaml:"records,omitempty" json:"records,omitempty"`
+}
+
+// DDNSRecord is a name kept at the external address by a provider
+type DDNSRecord struct {
+	Provider  string `yaml:"provider" json:"provider"` // cloudflare, duckdns, route53 or command
+	Name      string `yaml:"name" json:"name"`
+	Token     string `yaml:"token,omitempty" json:"-"`
+	Zone      string `yaml:"zone,omitempty" json:"zone,omitempty"` // Cloudflare zone, Route53 hosted zone ID
+	AccessKey string `yaml:"access_key,omitempty" json:"access_key,omitempty"`
+	SecretKey string `yaml:"secret_key,omitempty" json:"-"`
+	Command   string `yaml:"command,omitempty" json:"command,omitempty"` // for the command provider
+	TTL       int    `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+}
+
+// GetInterval returns how often the external address is checked
+func (d DDNSConfig) GetInterval() (time.Duration, error) {
+	if d.Interval == "" {
+		return ddns.DefaultInterval, nil
+	}
+	interval, err := time.ParseDuration(d.Interval)
+	if err != nil || interval < 30*time.Second {
+		return 0, fmt.Errorf("invalid ddns interval %q (e.g. 5m, at least 30s)", d.Interval)
+	}
+	return interval, nil
+}
+
+// GetIPURL returns the web service answering the external address
+func (d DDNSConfig) GetIPURL() string {
+	if d.IPURL != "" {
+		return d.IPURL
+	}
+	return ddns.DefaultIPURL
+}
+
+// validate checks the address source, interval and records
+func (d DDNSConfig) validate() error {
+	if d.IPSource != "" && !slices.Contains(ddns.Sources, d.IPSource) {
+		return fmt.Errorf("invalid ip_source %q (use %s)", d.IPSource, strings.Join(ddns.Sources, " or "))
+	}
+	if d.IPURL != "" {
+		u, err := url.Parse(d.IPURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid ip_url %q (use http:// or https://)", d.IPURL)
+		}
+	}
+	if _, err := d.GetInterval(); err != nil {
+		return err
+	}
+	if d.Enabled && len(d.Records) == 0 {
+		return fmt.Errorf("no records to update (use 'nat-manager ddns add')")
+	}
+	return ValidateDDNSRecords(d.Records)
+}
+
+// ValidateDDNSRecords checks that records have a known provider with its
+// settings, and that each name is set once per provider
+func ValidateDDNSRecords(records []DDNSRecord) error {
+	seen := make(map[DDNSRecord]bool)
+	for _, r := range records {
+		if _, err := ddns.NewProvider(r.record()); err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+		key := DDNSRecord{Provider: r.Provider, Name: r.Name}
+		if seen[key] {
+			return fmt.Errorf("%s is set more than once for %s", r.Name, r.Provider)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func (r DDNSRecord) record() ddns.Record {
+	return ddns.Record{Provider: r.Provider, Name: r.Name, Token: r.Token, Zone: r.Zone,
+		AccessKey: r.AccessKey, SecretKey: r.SecretKey, Command: r.Command, TTL: r.TTL}
+}
+
+// DDNSRecords returns the records to keep at the external address
+func (c *Config) DDNSRecords() []ddns.Record {
+	records := make([]ddns.Record, 0, len(c.DDNS.Records))
+	for _, r := range c.DDNS.Records {
+		records = append(records, r.record())
+	}
+	return records
+}
+
+// WireGuardConfig configures the WireGuard endpoint remote peers reach the
+// internal network through
+type WireGuardConfig struct {
+	Enabled    bool            `yaml:"enabled" json:"enabled"`
+	Port       int             `yaml:"port,omitempty" json:"port,omitempty"`         // UDP, 51820 by default
+	Network    string          `yaml:"network,omitempty" json:"network,omitempty"`   // /24 of the peers, 10.8.0 by default
+	Endpoint   string          `yaml:"endpoint,omitempty" json:"endpoint,omitempty"` // host peers connect to, e.g. a dynamic DNS name
+	PrivateKey string          `yaml:"private_key,omitempty" json:"-"`               // generated when first needed
+	Peers      []WireGuardPeer `yaml:"peers,omitempty" json:"peers,omitempty"`
+}
+
+// WireGuardPeer is a remote device allowed to connect to the endpoint
+type WireGuardPeer struct {
+	Name         string `yaml:"name" json:"name"`
+	PublicKey    string `yaml:"public_key" json:"public_key"`
+	PresharedKey string `yaml:"preshared_key,omitempty" json:"-"`
+	Address      string `yaml:"address" json:"address"`
+}
+
+// GetPort returns the UDP port of the endpoint
+func (w WireGuardConfig) GetPort() int {
+	if w.Port != 0 {
+		return w.Port
+	}
+	return wireguard.DefaultPort
+}
+
+// GetNetwork returns the /24 prefix of the peers
+func (w WireGuardConfig) GetNetwork() string {
+	if w.Network != "" {
+		return w.Network
+	}
+	return wireguard.DefaultNetwork
+}
+
+// validate checks the port, network, keys and peers
+func (w WireGuardConfig) validate(internalNetwork string) error {
+	if !w.Enabled {
+		internalNetwork = "" // the networks only clash while the endpoint runs
+	}
+	if err := nat.ValidateWireGuard(w.natWireGuard(), internalNetwork); err != nil {
+		return err
+	}
+	if strings.ContainsAny(w.Endpoint, " /") {
+		return fmt.Errorf("invalid endpoint %q (use a host name or address)", w.Endpoint)
+	}
+	if w.PrivateKey != "" {
+		if _, err := wireguard.ParseKey(w.PrivateKey); err != nil {
+			return fmt.Errorf("invalid private_key: %w", err)
+		}
+	}
+	return ValidateWireGuardPeers(w.Peers, w.GetNetwork())
+}
+
+// ValidateWireGuardPeers checks that peers have a name, a key and an
+// address of the peers' network, none of which is used twice
+func ValidateWireGuardPeers(peers []WireGuardPeer, network string) error {
+	prefix, err := wireguard.Prefix(network)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, p := range peers {
+		peer, err := p.peer()
+		if err != nil {
+			return err
+		}
+		if !prefix.Contains(peer.Address) || peer.Address == wireguard.Gateway(prefix) || peer.Address.As4()[3] == 255 {
+			return fmt.Errorf("%s: address %s is not a peer address of %s", p.Name, p.Address, prefix)
+		}
+		for _, key := range []string{"name " + p.Name, "key " + peer.PublicKey.String(), "address " + p.Address} {
+			if seen[key] {
+				return fmt.Errorf("%s: %s is used by another peer", p.Name, strings.SplitN(key, " ", 2)[0])
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+// peer parses the keys and address of p
+func (p WireGuardPeer) peer() (wireguard.Peer, error) {
+	if p.Name == "" {
+		return wireguard.Peer{}, fmt.Errorf("peer without a name")
+	}
+	peer := wireguard.Peer{Name: p.Name}
+	var err error
+	if peer.PublicKey, err = wireguard.ParseKey(p.PublicKey); err != nil {
+		return peer, fmt.Errorf("%s: %w", p.Name, err)
+	}
+	if p.PresharedKey != "" {
+		if peer.PresharedKey, err = wireguard.ParseKey(p.PresharedKey); err != nil {
+			return peer, fmt.Errorf("%s: %w", p.Name, err)
+		}
+	}
+	if peer.Address, err = netip.ParseAddr(p.Address); err != nil || !peer.Address.Is4() {
+		return peer, fmt.Errorf("%s: invalid address %q", p.Name, p.Address)
+	}
+	return peer, nil
+}
+
+func (w WireGuardConfig) natWireGuard() nat.WireGuard {
+	return nat.WireGuard{Enabled: w.Enabled, Network: w.GetNetwork(), Port: w.GetPort()}
+}
+
+// WireGuardServer returns the configuration of the endpoint, which needs
+// its private key
+func (c *Config) WireGuardServer() (wireguard.Server, error) {
+	key, err := wireguard.ParseKey(c.WireGuard.PrivateKey)
+	if err != nil {
+		return wireguard.Server{}, fmt.Errorf("no WireGuard private key: %w", err)
+	}
+	server := wireguard.Server{PrivateKey: key, Port: c.WireGuard.GetPort()}
+	for _, p := range c.WireGuard.Peers {
+		peer, err := p.peer()
+		if err != nil {
+			return wireguard.Server{}, err
+		}
+		server.Peers = append(server.Peers, peer)
+	}
+	return server, nil
+}
+
+// ContainerVMConfig is a Lima or Colima VM whose vmnet interface is kept in
+// the internal bridge
+type ContainerVMConfig struct {
+	Name      string `yaml:"name" json:"name"`
+	Runtime   string `yaml:"runtime" json:"runtime"` // lima or colima
+	MAC       string `yaml:"mac" json:"mac"`
+	Interface string `yaml:"interface,omitempty" json:"interface,omitempty"` // in the guest, renewing its lease
+}
+
+// ValidateContainerVMs checks that VMs have a name, a known runtime and a
+// MAC address, none of which is used twice
+func ValidateContainerVMs(vms []ContainerVMConfig) error {
+	seen := make(map[string]bool)
+	for _, vm := range vms {
+		if vm.Name == "" {
+			return fmt.Errorf("container VM without a name")
+		}
+		if !slices.Contains(vmnet.Runtimes, vm.Runtime) {
+			return fmt.Errorf("%s: invalid runtime %q (use %s)", vm.Name, vm.Runtime, strings.Join(vmnet.Runtimes, " or "))
+		}
+		mac, ok := vmnet.NormalizeMAC(vm.MAC)
+		if !ok {
+			return fmt.Errorf("%s: invalid MAC address %q", vm.Name, vm.MAC)
+		}
+		for _, key := range []string{vm.Runtime + "/" + vm.Name, mac} {
+			if seen[key] {
+				return fmt.Errorf("%s is attached twice", vm.Name)
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+// ValidateVMNetworks checks that the hypervisor networks are named once
+// each, by bridge, network name, subnet or hypervisor
+func ValidateVMNetworks(networks []string) error {
+	seen := make(map[string]bool)
+	for _, network := range networks {
+		if strings.TrimSpace(network) == "" {
+			return fmt.Errorf("empty VM network")
+		}
+		if seen[strings.ToLower(network)] {
+			return fmt.Errorf("%s is attached twice", network)
+		}
+		seen[strings.ToLower(network)] = true
+	}
+	return nil
+}
+
+// natVMs lists the attached VMs among the devices, as a Lima or Colima VM
+func (c *Config) natVMs() []nat.VM {
+	vms := make([]nat.VM, 0, len(c.ContainerVMs))
+	for _, vm := range c.ContainerVMs {
+		kind := "Lima VM"
+		if vm.Runtime == vmnet.RuntimeColima {
+			kind = "Colima VM"
+		}
+		mac, _ := vmnet.NormalizeMAC(vm.MAC)
+		vms = append(vms, nat.VM{Name: vm.Name, Kind: kind, MAC: mac})
+	}
+	return vms
+}
+
+// LoggingConfig configures the log of long-running commands and warnings
+type LoggingConfig struct {
+	Level   string `yaml:"level,omitempty" json:"level,omitempty"`       // debug, info (default), warn or error
+	Format  string `yaml:"format,omitempty" json:"format,omitempty"`     // of the file, text (default) or json
+	MaxSize string `yaml:"max_size,omitempty" json:"max_size,omitempty"` // rotate at, e.g. 10MB
+	OSLog   bool   `yaml:"os_log" json:"os_log"`                         // also log to the unified log
+	Syslog  string `yaml:"syslog,omitempty" json:"syslog,omitempty"`     // also log to a syslog server, e.g. udp://logs.example.com:514
+	Audit   bool   `yaml:"audit" json:"audit"`                           // send the audit trail to the unified log and syslog server
+}
+
+// validate checks the level, format, size and syslog server of the log
+func (l LoggingConfig) validate() error {
+	if l.Level != "" {
+		if _, err := logging.ParseLevel(l.Level); err != nil {
+			return err
+		}
+	}
+	if err := logging.ValidateFormat(l.Format); err != nil {
+		return err
+	}
+	if l.MaxSize != "" {
+		if size, err := nat.ParseSize(l.MaxSize); err != nil || size == 0 {
+			return fmt.Errorf("invalid max_size %q (e.g. 10MB)", l.MaxSize)
+		}
+	}
+	if l.Syslog != "" {
+		if _, _, err := logging.ParseSyslog(l.Syslog); err != nil {
+			return err
+		}
+	}
+	if l.Audit && !l.OSLog && l.Syslog == "" {
+		return fmt.Errorf("audit needs os_log or a syslog server")
+	}
+	return nil
+}
+
+// LoggingOptions returns the options of the instance's log at level, or at
+// the configured level if empty
+func (c *Config) LoggingOptions(level string) (logging.Options, error) {
+	if level == "" {
+		level = c.Logging.Level
+	}
+	opts := logging.Options{Level: slog.LevelInfo, Format: c.Logging.Format, OSLog: c.Logging.OSLog, Syslog: c.Logging.Syslog}
+	if level != "" {
+		parsed, err := logging.ParseLevel(level)
+		if err != nil {
+			return opts, err
+		}
+		opts.Level = parsed
+	}
+	if c.Logging.MaxSize != "" {
+		size, _ := nat.ParseSize(c.Logging.MaxSize)
+		opts.MaxSize = int64(size)
+	}
+	path, err := GetLogPath()
+	if err != nil {
+		return opts, err
+	}
+	opts.Path = path
+	return opts, nil
+}
+
+// APIConfig configures the localhost API listener of long-running commands
+type APIConfig struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled"`
+	Listen      string `yaml:"listen,omitempty" json:"listen,omitempty"` // loopback only
+	Diagnostics bool   `yaml:"diagnostics" json:"diagnostics"`           // pprof and runtime stats
+}
+
+// GetRefreshInterval returns how often blocklists are downloaded again
+func (b DNSBlocklistConfig) GetRefreshInterval() time.Duration {
+	interval, err := time.ParseDuration(b.RefreshInterval)
+	if err != nil || interval <= 0 {
+		return 24 * time.Hour
+	}
+	return interval
 }
 
 // Default returns a default configuration
@@ -39,13 +1120,24 @@ func Default() *Config {
 			End:   "192.168.100.200",
 			Lease: "12h",
 		},
-		DNSServers: []string{"8.8.8.8", "8.8.4.4"},
+		DNSServers:  []string{"8.8.8.8", "8.8.4.4"},
+		LocalDomain: "nat.lan",
+		DNSForwarder: DNSForwarderConfig{
+			CacheSize: 1000,
+		},
+		DNSBlocklist: DNSBlocklistConfig{
+			RefreshInterval: "24h",
+		},
 	}
 }
 
-// Load reads configuration from the default location
+// Load reads configuration from the default location, or from the
+// selected profile
 func Load() (*Config, error) {
-	configPath, err := getConfigPath()
+	if profile != "" {
+		return LoadProfile(profile)
+	}
+	configPath, err := GetConfigPath()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get config path: %w", err)
 	}
@@ -56,11 +1148,12 @@ func Load() (*Config, error) {
 // LoadFrom reads configuration from the specified path
 func LoadFrom(path string) (*Config, error) {
 	// If file doesn't exist, return default config
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
 		return Default(), nil
 	}
 
-	data, err := os.ReadFile(path)
+	data, err := readConfigFile(path, info)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -70,29 +1163,88 @@ func LoadFrom(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	// Validate and set defaults for missing fields
-	if config.InternalNetwork == "" {
-		config.InternalNetwork = "192.168.100"
+	config.setDefaults(data)
+	return &config, nil
+}
+
+// cachedFile is a configuration file as read while caching is on
+type cachedFile struct {
+	data    []byte
+	modTime time.Time
+	size    int64
+}
+
+// configCache holds the configuration files read while caching is on; see
+// CacheConfigFiles
+var configCache map[string]cachedFile
+
+// CacheConfigFiles keeps configuration files in memory once read, so that
+// a batch of commands reads each file once. A file changed on disk since it
+// was read is read again.
+func CacheConfigFiles(on bool) {
+	configCache = nil
+	if on {
+		configCache = make(map[string]cachedFile)
 	}
-	if config.DHCPRange.Start == "" {
-		config.DHCPRange.Start = fmt.Sprintf("%s.100", config.InternalNetwork)
+}
+
+// readConfigFile reads a configuration file, from the cache if it is on
+// and the file is unchanged
+func readConfigFile(path string, info os.FileInfo) ([]byte, error) {
+	if configCache == nil || info == nil {
+		return os.ReadFile(path)
 	}
-	if config.DHCPRange.End == "" {
-		config.DHCPRange.End = fmt.Sprintf("%s.200", config.InternalNetwork)
+	if file, ok := configCache[path]; ok && file.modTime.Equal(info.ModTime()) && file.size == info.Size() {
+		return file.data, nil
 	}
-	if config.DHCPRange.Lease == "" {
-		config.DHCPRange.Lease = "12h"
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
 	}
-	if len(config.DNSServers) == 0 {
-		config.DNSServers = []string{"8.8.8.8", "8.8.4.4"}
+	configCache[path] = cachedFile{data: data, modTime: info.ModTime(), size: info.Size()}
+	return data, nil
+}
+
+// forgetConfigFile drops a file written by this process from the cache
+func forgetConfigFile(path string) {
+	delete(configCache, path)
+}
+
+// setDefaults fills in missing fields of the configuration decoded from
+// data
+func (c *Config) setDefaults(data []byte) {
+	if c.InternalNetwork == "" {
+		c.InternalNetwork = "192.168.100"
+	}
+	if c.DHCPRange.Start == "" {
+		c.DHCPRange.Start = fmt.Sprintf("%s.100", c.InternalNetwork)
+	}
+	if c.DHCPRange.End == "" {
+		c.DHCPRange.End = fmt.Sprintf("%s.200", c.InternalNetwork)
+	}
+	if c.DHCPRange.Lease == "" {
+		c.DHCPRange.Lease = "12h"
+	}
+	if len(c.DNSServers) == 0 {
+		c.DNSServers = []string{"8.8.8.8", "8.8.4.4"}
+	}
+	if !localDomainSet(data) {
+		c.LocalDomain = "nat.lan"
 	}
+}
 
-	return &config, nil
+// localDomainSet reports whether data sets local_domain; an empty value
+// turns the local zone off rather than selecting the default
+func localDomainSet(data []byte) bool {
+	var keys struct {
+		LocalDomain *string `yaml:"local_domain"`
+	}
+	return yaml.Unmarshal(data, &keys) == nil && keys.LocalDomain != nil
 }
 
 // Save writes the configuration to the default location
 func (c *Config) Save() error {
-	configPath, err := getConfigPath()
+	configPath, err := GetConfigPath()
 	if err != nil {
 		return fmt.Errorf("failed to get config path: %w", err)
 	}
@@ -116,6 +1268,7 @@ func (c *Config) SaveTo(path string) error {
 	if err := os.WriteFile(path, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
+	forgetConfigFile(path)
 
 	return nil
 }
@@ -142,9 +1295,279 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("DHCP end address is required")
 	}
 
+	if err := nat.ValidateDHCP(c.natDHCPRange(), c.deviceLeases(), c.InternalNetwork); err != nil {
+		return fmt.Errorf("invalid DHCP configuration: %w", err)
+	}
+
+	if err := nat.ValidateDHCPOptions(c.SearchDomains, c.NTPServers); err != nil {
+		return fmt.Errorf("invalid DHCP options: %w", err)
+	}
+
+	if err := names.ValidateSources(c.NameResolution.Sources); err != nil {
+		return fmt.Errorf("invalid name_resolution: %w", err)
+	}
+
+	if _, err := c.Portal.GetDuration(); err != nil {
+		return err
+	}
+
+	if err := validateDNSPolicies(c.DNSForwarder.Policies); err != nil {
+		return fmt.Errorf("invalid dns_forwarder.policies: %w", err)
+	}
+
+	if err := c.validateDNSRecords(); err != nil {
+		return fmt.Errorf("invalid dns_records: %w", err)
+	}
+
+	if err := nat.ValidateBackends(c.Backends.DHCP, c.Backends.DNS, c.DNSForwarder.Enabled); err != nil {
+		return fmt.Errorf("invalid backends: %w", err)
+	}
+
+	if err := ValidateSchedule(c.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+
+	if err := validateTUI(c.TUI); err != nil {
+		return fmt.Errorf("invalid tui: %w", err)
+	}
+
+	if err := ValidateWebhooks(c.Webhooks); err != nil {
+		return fmt.Errorf("invalid webhooks: %w", err)
+	}
+
+	if c.TrafficQuota != "" {
+		if _, err := nat.ParseSize(c.TrafficQuota); err != nil {
+			return fmt.Errorf("invalid traffic_quota: %w", err)
+		}
+	}
+
+	if err := c.MQTT.validate(); err != nil {
+		return fmt.Errorf("invalid mqtt: %w", err)
+	}
+
+	if err := c.Logging.validate(); err != nil {
+		return fmt.Errorf("invalid logging: %w", err)
+	}
+
+	if err := c.FlowExport.validate(); err != nil {
+		return fmt.Errorf("invalid flow_export: %w", err)
+	}
+
+	if err := c.Influx.validate(); err != nil {
+		return fmt.Errorf("invalid influx: %w", err)
+	}
+
+	if err := c.SNMP.validate(); err != nil {
+		return fmt.Errorf("invalid snmp: %w", err)
+	}
+
+	if err := c.DDNS.validate(); err != nil {
+		return fmt.Errorf("invalid ddns: %w", err)
+	}
+
+	if err := c.WireGuard.validate(c.InternalNetwork); err != nil {
+		return fmt.Errorf("invalid wireguard: %w", err)
+	}
+
+	if err := ValidateContainerVMs(c.ContainerVMs); err != nil {
+		return fmt.Errorf("invalid container_vms: %w", err)
+	}
+
+	if err := ValidateVMNetworks(c.VMNetworks); err != nil {
+		return fmt.Errorf("invalid vm_networks: %w", err)
+	}
+
 	return nil
 }
 
+// ToNATConfig converts the configuration into the NAT manager's runtime config
+func (c *Config) ToNATConfig() *nat.Config {
+	leaseFile, _ := GetLeaseFilePath()
+	pidFile, _ := GetPIDFilePath()
+	stateFile, _ := GetStateFilePath()
+	fingerprintFile, _ := GetFingerprintPath()
+	inventoryFile, _ := GetInventoryPath()
+	executable, _ := os.Executable()
+	if c.Backends.DHCP == nat.BackendKea {
+		leaseFile = filepath.Join(filepath.Dir(leaseFile), "kea-leases4.csv")
+	}
+
+	return &nat.Config{
+		Instance:          instance,
+		PIDFile:           pidFile,
+		StateFile:         stateFile,
+		Executable:        executable,
+		FingerprintFile:   fingerprintFile,
+		InventoryFile:     inventoryFile,
+		ExternalInterface: c.ExternalInterface,
+		InternalInterface: c.InternalInterface,
+		InternalNetwork:   c.InternalNetwork,
+		DHCPRange:         c.natDHCPRange(),
+		DeviceLeases:      c.deviceLeases(),
+		SearchDomains:     c.SearchDomains,
+		NTPServers:        c.NTPServers,
+		DNSServers:        c.DNSServers,
+		LocalDomain:       c.LocalDomain,
+		LeaseFile:         leaseFile,
+		EmbeddedDNS:       c.DNSForwarder.Enabled,
+		DHCPBackend:       c.Backends.DHCP,
+		DNSBackend:        c.Backends.DNS,
+		DomainServers:     c.domainServers(),
+		StaticRecords:     c.staticRecords(),
+		PortForwards:      c.NATPortForwards(),
+		BlockedDevices:    c.BlockedDevices,
+		IsolatedDevices:   c.IsolatedDevices,
+		ClassPolicies:     c.classPolicies(),
+		Lockdown:          nat.Lockdown{Enabled: c.Lockdown.Enabled, Allow: c.Lockdown.Allow},
+		Portal:            c.natPortal(),
+		Shaping:           c.shaping(),
+		WireGuard:         c.WireGuard.natWireGuard(),
+		VMs:               c.natVMs(),
+		DeviceLabels:      c.DeviceLabels,
+		NameSources:       c.NameResolution.GetSources(),
+		NameTimeout:       c.NameResolution.GetTimeout(),
+		TrafficQuota:      c.trafficQuota(),
+		Active:            c.Active,
+	}
+}
+
+// natDHCPRange converts the configured DHCP pool
+func (c *Config) natDHCPRange() nat.DHCPRange {
+	return nat.DHCPRange{
+		Start:   c.DHCPRange.Start,
+		End:     c.DHCPRange.End,
+		Lease:   c.DHCPRange.Lease,
+		Exclude: c.DHCPRange.Exclude,
+	}
+}
+
+// deviceLeases converts the configured per-device lease times
+func (c *Config) deviceLeases() []nat.DeviceLease {
+	leases := make([]nat.DeviceLease, 0, len(c.DHCPLeases))
+	for _, lease := range c.DHCPLeases {
+		leases = append(leases, nat.DeviceLease{MAC: lease.MAC, Lease: lease.Lease, IP: lease.IP})
+	}
+	return leases
+}
+
+// classPolicies converts the configured device class policies
+func (c *Config) classPolicies() []nat.ClassPolicy {
+	policies := make([]nat.ClassPolicy, 0, len(c.DeviceClasses))
+	for _, p := range c.DeviceClasses {
+		policies = append(policies, nat.ClassPolicy{
+			Class:   p.Class,
+			Block:   p.Block,
+			Isolate: p.Isolate,
+			Group:   p.Group,
+			Cap:     p.Cap,
+		})
+	}
+	return policies
+}
+
+// natPortal converts the portal configuration, admitting the devices that
+// accepted it and have not expired
+func (c *Config) natPortal() nat.Portal {
+	p := nat.Portal{Enabled: c.Portal.Enabled, Port: c.Portal.GetPort()}
+	if !p.Enabled {
+		return p
+	}
+	path, err := GetPortalPath()
+	if err != nil {
+		return p
+	}
+	admissions, _ := portal.NewStore(path).List()
+	now := time.Now()
+	for _, a := range admissions {
+		if !a.Expired(now) {
+			p.Admitted = append(p.Admitted, a.IP)
+		}
+	}
+	return p
+}
+
+// shaping converts the configured bandwidth guarantees and caps
+func (c *Config) shaping() nat.Shaping {
+	shaping := nat.Shaping{Uplink: c.Bandwidth.Uplink, Downlink: c.Bandwidth.Downlink}
+	for _, group := range c.Bandwidth.Groups {
+		shaping.Groups = append(shaping.Groups, nat.DeviceGroup{
+			Name:      group.Name,
+			Devices:   group.Devices,
+			Guarantee: group.Guarantee,
+		})
+	}
+	for _, limit := range c.Bandwidth.Caps {
+		shaping.Caps = append(shaping.Caps, nat.DeviceCap{Name: limit.Name, Devices: limit.Devices, Rate: limit.Rate})
+	}
+	return shaping
+}
+
+// staticRecords converts the configured static DNS records
+func (c *Config) staticRecords() []nat.DNSRecord {
+	records := make([]nat.DNSRecord, 0, len(c.DNSRecords))
+	for _, record := range c.DNSRecords {
+		records = append(records, nat.DNSRecord{
+			Name:  record.Name,
+			Type:  strings.ToUpper(record.Type),
+			Value: record.Value,
+		})
+	}
+	return records
+}
+
+// validateDNSRecords checks every static DNS record
+func (c *Config) validateDNSRecords() error {
+	records := make([]dns.Record, 0, len(c.DNSRecords))
+	for _, record := range c.DNSRecords {
+		records = append(records, dns.Record{Name: record.Name, Type: record.Type, Value: record.Value})
+	}
+	return dns.ValidateRecords(records)
+}
+
+// domainServers maps conditional forward domains to their resolvers
+func (c *Config) domainServers() map[string][]string {
+	if len(c.DNSForwarder.Conditional) == 0 {
+		return nil
+	}
+	servers := make(map[string][]string, len(c.DNSForwarder.Conditional))
+	for _, forward := range c.DNSForwarder.Conditional {
+		domain := strings.TrimPrefix(forward.Domain, "*.")
+		servers[domain] = append(servers[domain], forward.Upstreams...)
+	}
+	return servers
+}
+
+// NATPortForwards converts the configured port forwards for the NAT manager
+func (c *Config) NATPortForwards() []nat.PortForward {
+	forwards := make([]nat.PortForward, 0, len(c.PortForwards))
+	for _, f := range c.PortForwards {
+		forwards = append(forwards, nat.PortForward{
+			Protocol:     f.Protocol,
+			ExternalPort: f.ExternalPort,
+			InternalIP:   f.InternalIP,
+			InternalPort: f.InternalPort,
+			Description:  f.Description,
+		})
+	}
+	return forwards
+}
+
+// GetDNSListenAddr returns the address the embedded DNS forwarder binds to
+func (c *Config) GetDNSListenAddr() string {
+	if c.DNSForwarder.Listen != "" {
+		return c.DNSForwarder.Listen
+	}
+	return c.GetGatewayIP() + ":53"
+}
+
+// GetDNSUpstreams returns the resolvers the embedded DNS forwarder queries
+func (c *Config) GetDNSUpstreams() []string {
+	if len(c.DNSForwarder.Upstreams) > 0 {
+		return c.DNSForwarder.Upstreams
+	}
+	return c.DNSServers
+}
+
 // GetGatewayIP returns the gateway IP for the internal network
 func (c *Config) GetGatewayIP() string {
 	return fmt.Sprintf("%s.1", c.InternalNetwork)
@@ -155,22 +1578,200 @@ func (c *Config) GetInternalCIDR() string {
 	return fmt.Sprintf("%s.0/24", c.InternalNetwork)
 }
 
-// getConfigPath returns the default configuration file path
-func getConfigPath() (string, error) {
+// instance is the NAT instance whose configuration and runtime files are
+// used; see SetInstance
+var instance = nat.DefaultInstance
+
+// SetInstance selects the NAT instance. Every instance other than the
+// default one keeps its configuration, leases and logs in its own directory.
+func SetInstance(name string) error {
+	if name == "" {
+		name = nat.DefaultInstance
+	}
+	if err := nat.ValidateInstanceName(name); err != nil {
+		return err
+	}
+	instance = name
+	return nil
+}
+
+// Instance returns the selected NAT instance
+func Instance() string {
+	return instance
+}
+
+// Instances returns the default instance and every instance with a
+// directory of its own
+func Instances() ([]string, error) {
+	dir, err := BaseDir()
+	if err != nil {
+		return nil, err
+	}
+	instances := []string{nat.DefaultInstance}
+	entries, err := os.ReadDir(filepath.Join(dir, "instances"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != nat.DefaultInstance && nat.ValidateInstanceName(entry.Name()) == nil {
+			instances = append(instances, entry.Name())
+		}
+	}
+	return instances, nil
+}
+
+// BaseDir returns the configuration directory shared by all instances
+func BaseDir() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(home, ".config", "nat-manager", "config.yaml"), nil
+	return filepath.Join(home, ".config", "nat-manager"), nil
+}
+
+// instanceDir returns the directory of the selected instance
+func instanceDir() (string, error) {
+	dir, err := BaseDir()
+	if err != nil || instance == nat.DefaultInstance {
+		return dir, err
+	}
+	return filepath.Join(dir, "instances", instance), nil
+}
+
+// GetConfigPath returns the configuration file path of the selected
+// profile, or else of the selected instance
+func GetConfigPath() (string, error) {
+	if profile != "" {
+		return profilePath(profile)
+	}
+	return InstanceConfigPath()
+}
+
+// InstanceConfigPath returns the path of the instance's own configuration,
+// whichever profile is selected
+func InstanceConfigPath() (string, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "config.yaml"), nil
 }
 
-// GetStateFilePath returns the path for runtime state file
+// GetStateFilePath returns the path of the registry of running instances,
+// which is shared by all instances
 func GetStateFilePath() (string, error) {
+	dir, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "state.yaml"), nil
+}
+
+// GetLeaseFilePath returns the path of the DHCP lease database
+func GetLeaseFilePath() (string, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "dnsmasq.leases"), nil
+}
+
+// GetPIDFilePath returns the path of the dnsmasq pidfile
+func GetPIDFilePath() (string, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "dnsmasq.pid"), nil
+}
+
+// GetQueryLogPath returns the path of the DNS query log
+func GetQueryLogPath() (string, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "dns-queries.log"), nil
+}
+
+// GetInventoryPath returns the path of the instance's device inventory
+func GetInventoryPath() (string, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "devices.json"), nil
+}
+
+// GetFingerprintPath returns the path of the recorded DHCP fingerprints,
+// which are shared by all instances
+func GetFingerprintPath() (string, error) {
+	dir, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "dhcp-fingerprints.json"), nil
+}
+
+// GetPortalPath returns the path of the devices admitted through the
+// captive portal
+func GetPortalPath() (string, error) {
+	dir, err := instanceDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "portal.json"), nil
+}
+
+// GetAuditLogPath returns the path of the audit log, which is shared by all
+// instances
+func GetAuditLogPath() (string, error) {
+	dir, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "audit.log"), nil
+}
+
+// GetAPITokenPath returns the path of the REST API token, which is shared
+// by all instances
+func GetAPITokenPath() (string, error) {
+	dir, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "api-token"), nil
+}
+
+// GetBlocklistPath returns the path of the downloaded DNS blocklist, which
+// is shared by all instances
+func GetBlocklistPath() (string, error) {
+	dir, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "blocklist.txt"), nil
+}
+
+// GetLogPath returns the path of the instance's log, under
+// ~/Library/Logs/nat-manager
+func GetLogPath() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(home, ".config", "nat-manager", "state.yaml"), nil
+	return filepath.Join(home, "Library", "Logs", "nat-manager", instance+".log"), nil
 }
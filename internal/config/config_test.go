@@ -1,10 +1,17 @@
 package config
 
 import (
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/fingerprint"
+	"github.com/scttfrdmn/macos-nat-manager/internal/wireguard"
 )
 
 func TestDefault(t *testing.T) {
@@ -113,6 +120,21 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "DHCP exclusion outside range",
+			config: &Config{
+				ExternalInterface: "en0",
+				InternalInterface: "bridge100",
+				InternalNetwork:   "192.168.100",
+				DHCPRange: DHCPRange{
+					Start:   "192.168.100.100",
+					End:     "192.168.100.200",
+					Lease:   "12h",
+					Exclude: []string{"192.168.100.20"},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "missing DHCP end",
 			config: &Config{
@@ -261,12 +283,12 @@ func TestSave(t *testing.T) {
 }
 
 func TestGetConfigPath(t *testing.T) {
-	path, err := getConfigPath()
+	path, err := GetConfigPath()
 	if err != nil {
-		t.Errorf("getConfigPath failed: %v", err)
+		t.Errorf("GetConfigPath failed: %v", err)
 	}
 	if path == "" {
-		t.Error("getConfigPath should return a non-empty path")
+		t.Error("GetConfigPath should return a non-empty path")
 	}
 
 	// Should contain the config filename
@@ -340,3 +362,940 @@ func TestConfigFieldAccess(t *testing.T) {
 		t.Error("Config Active not set correctly")
 	}
 }
+
+func TestToNATConfig(t *testing.T) {
+	cfg := Default()
+	cfg.ExternalInterface = "en0"
+
+	natConfig := cfg.ToNATConfig()
+
+	if natConfig.ExternalInterface != "en0" || natConfig.InternalInterface != "bridge100" {
+		t.Errorf("Interfaces not converted: %+v", natConfig)
+	}
+	if natConfig.DHCPRange.Start != cfg.DHCPRange.Start || natConfig.DHCPRange.Lease != cfg.DHCPRange.Lease {
+		t.Errorf("DHCP range not converted: %+v", natConfig.DHCPRange)
+	}
+	if natConfig.LocalDomain != "nat.lan" {
+		t.Errorf("Expected local domain 'nat.lan', got '%s'", natConfig.LocalDomain)
+	}
+	if !strings.HasSuffix(natConfig.LeaseFile, "dnsmasq.leases") {
+		t.Errorf("Expected lease file path, got '%s'", natConfig.LeaseFile)
+	}
+
+	cfg.DNSForwarder.Conditional = []ConditionalForward{
+		{Domain: "*.corp.example", Upstreams: []string{"10.8.0.1"}},
+	}
+	natConfig = cfg.ToNATConfig()
+	if servers := natConfig.DomainServers["corp.example"]; len(servers) != 1 || servers[0] != "10.8.0.1" {
+		t.Errorf("Conditional forwards not converted: %v", natConfig.DomainServers)
+	}
+	if len(natConfig.NameSources) != 5 || natConfig.NameSources[0] != "label" {
+		t.Errorf("Expected default name sources, got %v", natConfig.NameSources)
+	}
+
+	cfg.NameResolution = NameResolutionConfig{Sources: []string{"dhcp"}, Timeout: "1s"}
+	natConfig = cfg.ToNATConfig()
+	if len(natConfig.NameSources) != 1 || natConfig.NameTimeout != time.Second {
+		t.Errorf("Name resolution not converted: %v %v", natConfig.NameSources, natConfig.NameTimeout)
+	}
+
+	cfg.NameResolution.Sources = []string{"wins"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate should reject unknown name sources")
+	}
+}
+
+func TestLoadFromDefaultsLocalDomain(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("external_interface: en0\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := LoadFrom(configPath)
+	if err != nil {
+		t.Fatalf("LoadFrom() failed: %v", err)
+	}
+	if cfg.LocalDomain != "nat.lan" {
+		t.Errorf("Expected default local domain 'nat.lan', got '%s'", cfg.LocalDomain)
+	}
+
+	// an empty local domain turns the zone off and survives saving
+	cfg.LocalDomain = ""
+	if err := cfg.SaveTo(configPath); err != nil {
+		t.Fatalf("SaveTo() failed: %v", err)
+	}
+	if cfg, err = LoadFrom(configPath); err != nil || cfg.LocalDomain != "" {
+		t.Errorf("Expected the empty local domain to be kept, got %q, %v", cfg.LocalDomain, err)
+	}
+	cfg = Default()
+	cfg.LocalDomain = ""
+	if err := cfg.Set("dns_servers", "[1.1.1.1]"); err != nil || cfg.LocalDomain != "" {
+		t.Errorf("Set should keep the empty local domain, got %q, %v", cfg.LocalDomain, err)
+	}
+}
+
+func TestGetRefreshInterval(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 24 * time.Hour},
+		{"6h", 6 * time.Hour},
+		{"bogus", 24 * time.Hour},
+		{"-1h", 24 * time.Hour},
+	}
+
+	for _, tc := range testCases {
+		b := DNSBlocklistConfig{RefreshInterval: tc.value}
+		if got := b.GetRefreshInterval(); got != tc.expected {
+			t.Errorf("GetRefreshInterval(%q) = %s, expected %s", tc.value, got, tc.expected)
+		}
+	}
+}
+
+func TestSetInstance(t *testing.T) {
+	defer func() { _ = SetInstance("") }()
+
+	defaultPath, _ := GetLeaseFilePath()
+	if err := SetInstance("lab"); err != nil {
+		t.Fatalf("SetInstance failed: %v", err)
+	}
+
+	leasePath, _ := GetLeaseFilePath()
+	if leasePath == defaultPath || !strings.Contains(leasePath, filepath.Join("instances", "lab")) {
+		t.Errorf("Expected a per-instance lease file, got %s", leasePath)
+	}
+	statePath, _ := GetStateFilePath()
+	if strings.Contains(statePath, "instances") {
+		t.Errorf("The instance registry must be shared, got %s", statePath)
+	}
+	if natConfig := Default().ToNATConfig(); natConfig.Instance != "lab" || natConfig.PIDFile == "" {
+		t.Errorf("Instance not converted: %+v", natConfig)
+	}
+
+	if err := SetInstance("../etc"); err == nil {
+		t.Error("SetInstance should reject invalid names")
+	}
+	if Instance() != "lab" {
+		t.Errorf("Invalid name must not change the instance, got %s", Instance())
+	}
+}
+
+func TestDHCPLeasesConversion(t *testing.T) {
+	cfg := Default()
+	cfg.ExternalInterface = "en0"
+	cfg.DHCPRange.Exclude = []string{"192.168.100.150-192.168.100.159"}
+	cfg.DHCPLeases = []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff", Lease: "7d"}}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	natConfig := cfg.ToNATConfig()
+	if len(natConfig.DHCPRange.Exclude) != 1 || len(natConfig.DeviceLeases) != 1 || natConfig.DeviceLeases[0].Lease != "7d" {
+		t.Errorf("DHCP exclusions and leases not converted: %+v %+v", natConfig.DHCPRange, natConfig.DeviceLeases)
+	}
+
+	cfg.DHCPLeases[0].Lease = "forever"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate should reject invalid lease times")
+	}
+}
+
+func TestBackupConfig(t *testing.T) {
+	var empty BackupConfig
+	if empty.GetInterval() != 24*time.Hour || empty.GetKeep() != 7 {
+		t.Errorf("Unexpected backup defaults: %v, %d", empty.GetInterval(), empty.GetKeep())
+	}
+	if target, err := empty.GetTarget(); err != nil || !strings.HasSuffix(target, filepath.Join("nat-manager", "backups")) {
+		t.Errorf("Expected default local backup directory, got %q, %v", target, err)
+	}
+
+	custom := BackupConfig{Target: "s3://lab-backups/nat", Interval: "6h", Keep: 30}
+	if target, _ := custom.GetTarget(); target != "s3://lab-backups/nat" || custom.GetInterval() != 6*time.Hour || custom.GetKeep() != 30 {
+		t.Errorf("Custom backup settings not used: %+v", custom)
+	}
+}
+
+func TestPortalConfig(t *testing.T) {
+	var portal PortalConfig
+	if portal.GetPort() != 8880 {
+		t.Errorf("Expected default portal port 8880, got %d", portal.GetPort())
+	}
+	if duration, err := portal.GetDuration(); duration != 0 || err != nil {
+		t.Errorf("Empty duration should last until revoked, got %v, %v", duration, err)
+	}
+
+	portal.Duration = "8h"
+	if duration, err := portal.GetDuration(); duration != 8*time.Hour || err != nil {
+		t.Errorf("GetDuration = %v, %v", duration, err)
+	}
+
+	cfg := Default()
+	cfg.ExternalInterface = "en0"
+	cfg.Portal = PortalConfig{Enabled: true, Duration: "soon"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate should reject invalid portal durations")
+	}
+}
+
+func TestDNSPolicies(t *testing.T) {
+	testCases := []struct {
+		name     string
+		policies []DNSPolicy
+		valid    bool
+	}{
+		{"valid", []DNSPolicy{
+			{Name: "kids", Upstreams: []string{"1.1.1.3"}, Devices: []string{"AA:BB:CC:DD:EE:01"}},
+			{Name: "work", Upstreams: []string{"10.0.0.53"}, Devices: []string{"192.168.100.20"}},
+		}, true},
+		{"no upstreams", []DNSPolicy{{Name: "kids"}}, false},
+		{"duplicate name", []DNSPolicy{{Name: "kids", Upstreams: []string{"1.1.1.3"}}, {Name: "kids", Upstreams: []string{"1.1.1.3"}}}, false},
+		{"invalid device", []DNSPolicy{{Name: "kids", Upstreams: []string{"1.1.1.3"}, Devices: []string{"tablet"}}}, false},
+		{"device in two policies", []DNSPolicy{
+			{Name: "kids", Upstreams: []string{"1.1.1.3"}, Devices: []string{"aa:bb:cc:dd:ee:01"}},
+			{Name: "work", Upstreams: []string{"10.0.0.53"}, Devices: []string{"AA:BB:CC:DD:EE:01"}},
+		}, false},
+	}
+
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.ExternalInterface = "en0"
+		cfg.DNSForwarder.Policies = tc.policies
+		if err := cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: Validate() = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestTUIConfig(t *testing.T) {
+	testCases := []struct {
+		name  string
+		tui   TUIConfig
+		valid bool
+	}{
+		{"default", TUIConfig{}, true},
+		{"ascii", TUIConfig{Theme: ThemeASCII}, true},
+		{"colors", TUIConfig{Theme: ThemeLight, Colors: map[string]string{"title": "#f80", "error": "160"}}, true},
+		{"unknown theme", TUIConfig{Theme: "solarized"}, false},
+		{"unknown role", TUIConfig{Colors: map[string]string{"border": "62"}}, false},
+		{"ANSI out of range", TUIConfig{Colors: map[string]string{"title": "256"}}, false},
+		{"bad hex", TUIConfig{Colors: map[string]string{"title": "#ff88"}}, false},
+		{"color name", TUIConfig{Colors: map[string]string{"title": "red"}}, false},
+		{"refresh", TUIConfig{Refresh: RefreshConfig{Interval: "1s", Idle: "30s", Views: map[string]string{"monitor": "500ms"}}}, true},
+		{"bad refresh", TUIConfig{Refresh: RefreshConfig{Interval: "often"}}, false},
+		{"refresh too fast", TUIConfig{Refresh: RefreshConfig{Views: map[string]string{"logs": "100ms"}}}, false},
+	}
+
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.ExternalInterface = "en0"
+		cfg.TUI = tc.tui
+		if err := cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: Validate() = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestRefreshInterval(t *testing.T) {
+	var defaults RefreshConfig
+	if got := defaults.GetInterval("monitor", true); got != DefaultRefresh {
+		t.Errorf("Expected the default refresh of %s, got %s", DefaultRefresh, got)
+	}
+	if got := defaults.GetInterval("monitor", false); got != DefaultIdleRefresh {
+		t.Errorf("Expected the idle refresh of %s while inactive, got %s", DefaultIdleRefresh, got)
+	}
+
+	refresh := RefreshConfig{Interval: "5s", Idle: "3s", Views: map[string]string{"monitor": "1s"}}
+	for _, tc := range []struct {
+		view   string
+		active bool
+		want   time.Duration
+	}{
+		{"monitor", true, time.Second},
+		{"monitor", false, 3 * time.Second},
+		{"logs", true, 5 * time.Second},
+		{"logs", false, 5 * time.Second},
+	} {
+		if got := refresh.GetInterval(tc.view, tc.active); got != tc.want {
+			t.Errorf("GetInterval(%q, %t) = %s, expected %s", tc.view, tc.active, got, tc.want)
+		}
+	}
+}
+
+func TestBackends(t *testing.T) {
+	testCases := []struct {
+		name     string
+		backends BackendConfig
+		embedded bool
+		valid    bool
+	}{
+		{"default", BackendConfig{}, false, true},
+		{"kea and coredns", BackendConfig{DHCP: "kea", DNS: "coredns"}, false, true},
+		{"kea with embedded forwarder", BackendConfig{DHCP: "kea"}, true, true},
+		{"coredns with embedded forwarder", BackendConfig{DNS: "coredns"}, true, false},
+		{"unknown DHCP backend", BackendConfig{DHCP: "isc-dhcpd"}, false, false},
+		{"unknown DNS backend", BackendConfig{DNS: "unbound"}, false, false},
+	}
+
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.ExternalInterface = "en0"
+		cfg.Backends = tc.backends
+		cfg.DNSForwarder.Enabled = tc.embedded
+		if err := cfg.Validate(); (err == nil) != tc.valid {
+			t.Errorf("%s: Validate() = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+
+	cfg := Default()
+	cfg.Backends = BackendConfig{DHCP: "kea", DNS: "coredns"}
+	natConfig := cfg.ToNATConfig()
+	if natConfig.DHCPBackend != "kea" || natConfig.DNSBackend != "coredns" || filepath.Base(natConfig.LeaseFile) != "kea-leases4.csv" {
+		t.Errorf("Unexpected backends in NAT config: %s, %s, %s", natConfig.DHCPBackend, natConfig.DNSBackend, natConfig.LeaseFile)
+	}
+}
+
+func TestDHCPOptionsValidation(t *testing.T) {
+	cfg := Default()
+	cfg.ExternalInterface = "en0"
+	cfg.SearchDomains = []string{"lab.example.com"}
+	cfg.NTPServers = []string{"192.168.100.1"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if natConfig := cfg.ToNATConfig(); len(natConfig.SearchDomains) != 1 || len(natConfig.NTPServers) != 1 {
+		t.Errorf("DHCP options not converted: %+v", natConfig)
+	}
+
+	cfg.NTPServers = []string{"pool.ntp.org"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("NTP servers must be addresses")
+	}
+}
+
+func TestDNSRecordsValidation(t *testing.T) {
+	cfg := Default()
+	cfg.ExternalInterface = "en0"
+	cfg.DNSRecords = []DNSRecord{{Name: "nas.lab", Type: "a", Value: "192.168.100.10"}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+
+	invalid := [][]DNSRecord{
+		{{Name: "nas.lab", Type: "A", Value: "nas"}},
+		{{Name: strings.Repeat("a", 64) + ".lab", Type: "A", Value: "192.168.100.10"}},
+		{{Name: "files.lab", Type: "CNAME", Value: "nas.lab"}, {Name: "files.lab", Type: "A", Value: "192.168.100.10"}},
+	}
+	for _, records := range invalid {
+		cfg.DNSRecords = records
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate should reject %+v", records)
+		}
+	}
+}
+
+func TestConfigKeys(t *testing.T) {
+	cfg := Default()
+	if value, err := cfg.Get("dhcp_range.start"); err != nil || value != "192.168.100.100" {
+		t.Errorf("Get(dhcp_range.start) = %q, %v", value, err)
+	}
+	if value, _ := cfg.Get("dns_servers"); value != "[8.8.8.8, 8.8.4.4]" {
+		t.Errorf("Get(dns_servers) = %q", value)
+	}
+
+	if err := cfg.Set("dhcp_range.start", "192.168.100.50"); err != nil || cfg.DHCPRange.Start != "192.168.100.50" {
+		t.Errorf("Set(dhcp_range.start) = %v, start %s", err, cfg.DHCPRange.Start)
+	}
+	if err := cfg.Set("dns_servers", "[1.1.1.1, 9.9.9.9]"); err != nil || len(cfg.DNSServers) != 2 || cfg.DNSServers[1] != "9.9.9.9" {
+		t.Errorf("Set(dns_servers) = %v, %v", err, cfg.DNSServers)
+	}
+	if err := cfg.Set("backends.dhcp", "kea"); err != nil || cfg.Backends.DHCP != "kea" {
+		t.Errorf("Set creating a section = %v, %+v", err, cfg.Backends)
+	}
+	if err := cfg.Set("dns_servers.1", "8.8.8.8"); err != nil || cfg.DNSServers[1] != "8.8.8.8" {
+		t.Errorf("Set(dns_servers.1) = %v, %v", err, cfg.DNSServers)
+	}
+}
+
+func TestConfigRejectedChanges(t *testing.T) {
+	cfg := Default()
+
+	for key, value := range map[string]string{
+		"dhcp_range.start":         "10.0.0.5",  // outside the network
+		"dhcp_range":               "192.168.1", // not a section
+		"no_such_key":              "1",         // unknown
+		"dns_forwarder.cache_size": "plenty",    // wrong type
+	} {
+		before := *cfg
+		if err := cfg.Set(key, value); err == nil {
+			t.Errorf("Set(%s, %s) should fail", key, value)
+		}
+		if cfg.DHCPRange.Start != before.DHCPRange.Start || cfg.DNSForwarder.CacheSize != before.DNSForwarder.CacheSize {
+			t.Errorf("A rejected Set(%s) changed the config", key)
+		}
+	}
+}
+
+func TestConfigUnset(t *testing.T) {
+	cfg := Default()
+	cfg.Backends.DHCP = "kea"
+	if err := cfg.Unset("backends.dhcp"); err != nil || cfg.Backends.DHCP != "" {
+		t.Errorf("Unset(backends.dhcp) = %v, %+v", err, cfg.Backends)
+	}
+	if err := cfg.Unset("dns_servers.0"); err != nil || len(cfg.DNSServers) != 1 {
+		t.Errorf("Unset(dns_servers.0) = %v, %v", err, cfg.DNSServers)
+	}
+	if err := cfg.Unset("portal.nothing"); err == nil {
+		t.Error("Unsetting a missing key should fail")
+	}
+}
+
+func TestConfigList(t *testing.T) {
+	cfg := Default()
+	cfg.ExternalInterface = "en0"
+	settings, err := cfg.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	values := make(map[string]string)
+	for _, setting := range settings {
+		values[setting.Key] = setting.Value
+	}
+	if settings[0].Key != "external_interface" || values["dhcp_range.lease"] != "12h" || values["dns_forwarder.cache_size"] != "1000" {
+		t.Errorf("Unexpected settings %v", settings)
+	}
+
+	if _, err := Parse([]byte("external_interface: en0\nextrnal_network: 10.0.0\n")); err == nil {
+		t.Error("Parse should reject unknown keys")
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer func() { _ = SetProfile("") }()
+
+	if names, err := ListProfiles(); err != nil || len(names) != 0 {
+		t.Errorf("ListProfiles = %v, %v, expected none", names, err)
+	}
+
+	lab := Default()
+	lab.InternalNetwork = "10.10.0"
+	if err := CreateProfile("vm-lab", lab); err != nil {
+		t.Fatalf("CreateProfile failed: %v", err)
+	}
+	if err := CreateProfile("vm-lab", lab); err == nil {
+		t.Error("Creating an existing profile should fail")
+	}
+	if err := CopyProfile("vm-lab", "iot"); err != nil {
+		t.Fatalf("CopyProfile failed: %v", err)
+	}
+	if err := CreateProfile("../etc", lab); err == nil {
+		t.Error("Invalid profile names should be rejected")
+	}
+	if names, _ := ListProfiles(); strings.Join(names, ",") != "iot,vm-lab" {
+		t.Errorf("ListProfiles = %v", names)
+	}
+}
+
+func TestSelectedProfile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	defer func() { _ = SetProfile("") }()
+
+	lab := Default()
+	lab.InternalNetwork = "10.10.0"
+	if err := CreateProfile("iot", lab); err != nil {
+		t.Fatalf("CreateProfile failed: %v", err)
+	}
+
+	// The selected profile replaces the instance's configuration
+	if err := SetProfile("iot"); err != nil {
+		t.Fatalf("SetProfile failed: %v", err)
+	}
+	cfg, err := Load()
+	if err != nil || cfg.InternalNetwork != "10.10.0" {
+		t.Fatalf("Load with profile = %+v, %v", cfg, err)
+	}
+	cfg.InternalNetwork = "10.20.0"
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if saved, _ := LoadProfile("iot"); saved.InternalNetwork != "10.20.0" {
+		t.Errorf("Save should write the profile, got %s", saved.InternalNetwork)
+	}
+
+	if err := DeleteProfile("iot"); err != nil {
+		t.Fatalf("DeleteProfile failed: %v", err)
+	}
+	if _, err := Load(); err == nil {
+		t.Error("Loading a deleted profile should fail")
+	}
+	if err := DeleteProfile("iot"); err == nil {
+		t.Error("Deleting a missing profile should fail")
+	}
+}
+
+func TestCacheConfigFiles(t *testing.T) {
+	CacheConfigFiles(true)
+	defer CacheConfigFiles(false)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	cfg := Default()
+	cfg.InternalNetwork = "10.10.0"
+	if err := cfg.SaveTo(path); err != nil {
+		t.Fatalf("SaveTo failed: %v", err)
+	}
+	if loaded, err := LoadFrom(path); err != nil || loaded.InternalNetwork != "10.10.0" {
+		t.Fatalf("LoadFrom = %+v, %v", loaded, err)
+	}
+
+	// Saving replaces the cached file
+	cfg.InternalNetwork = "10.20.0"
+	if err := cfg.SaveTo(path); err != nil {
+		t.Fatalf("SaveTo failed: %v", err)
+	}
+	if loaded, _ := LoadFrom(path); loaded.InternalNetwork != "10.20.0" {
+		t.Errorf("LoadFrom after SaveTo = %s, expected 10.20.0", loaded.InternalNetwork)
+	}
+
+	// A file changed by another process is read again
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), "10.20.0", "10.30.00", 1))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := LoadFrom(path); loaded.InternalNetwork != "10.30.00" {
+		t.Errorf("LoadFrom after an external change = %s, expected 10.30.00", loaded.InternalNetwork)
+	}
+}
+
+func TestScheduleEntry(t *testing.T) {
+	testCases := []struct {
+		days     string
+		expected []int
+		wantErr  bool
+	}{
+		{days: "", expected: nil},
+		{days: "daily", expected: nil},
+		{days: "mon-fri", expected: []int{1, 2, 3, 4, 5}},
+		{days: "sat,sun", expected: []int{6, 7}},
+		{days: "fri-mon", expected: []int{1, 5, 6, 7}},
+		{days: "Mon, wed,fri", expected: []int{1, 3, 5}},
+		{days: "mon-sun", expected: nil},
+		{days: "weekdays", wantErr: true},
+		{days: "mon-", wantErr: true},
+	}
+	for _, tc := range testCases {
+		days, err := ScheduleEntry{Days: tc.days}.Weekdays()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("Weekdays(%q) error = %v, wantErr %v", tc.days, err, tc.wantErr)
+			continue
+		}
+		if fmt.Sprint(days) != fmt.Sprint(tc.expected) {
+			t.Errorf("Weekdays(%q) = %v, expected %v", tc.days, days, tc.expected)
+		}
+	}
+
+	start := ScheduleEntry{Name: "start-0900", Action: ScheduleStart, At: "09:00", Days: "mon-fri"}
+	if hour, minute, err := start.Time(); err != nil || hour != 9 || minute != 0 {
+		t.Errorf("Time() = %d, %d, %v", hour, minute, err)
+	}
+	if err := ValidateSchedule([]ScheduleEntry{start, {Name: "stop", Action: ScheduleStop, At: "19:30"}}); err != nil {
+		t.Errorf("Valid schedule rejected: %v", err)
+	}
+	for _, invalid := range [][]ScheduleEntry{
+		{start, start},
+		{{Name: "reboot", Action: "restart", At: "09:00"}},
+		{{Name: "late", Action: ScheduleStop, At: "25:00"}},
+		{{Name: "a/b", Action: ScheduleStop, At: "10:00"}},
+	} {
+		if err := ValidateSchedule(invalid); err == nil {
+			t.Errorf("ValidateSchedule(%+v) should fail", invalid)
+		}
+	}
+}
+
+func TestUpdateBlocks(t *testing.T) {
+	cfg := Default()
+	cfg.DNSBlocklist.Allowlist = []string{"tiktok.com"}
+
+	cfg.UpdateBlocks([]string{"aa:bb:cc:dd:ee:01"}, []string{"tiktok.com"}, true)
+	if !cfg.DNSBlocklist.Enabled || len(cfg.DNSBlocklist.Allowlist) != 0 ||
+		strings.Join(cfg.DNSBlocklist.Domains, ",") != "tiktok.com" || strings.Join(cfg.BlockedDevices, ",") != "aa:bb:cc:dd:ee:01" {
+		t.Errorf("unexpected config after block: %+v, %v", cfg.DNSBlocklist, cfg.BlockedDevices)
+	}
+
+	cfg.UpdateBlocks([]string{"AA:BB:CC:DD:EE:01"}, []string{"tiktok.com"}, false)
+	if len(cfg.BlockedDevices) != 0 || len(cfg.DNSBlocklist.Domains) != 0 ||
+		strings.Join(cfg.DNSBlocklist.Allowlist, ",") != "tiktok.com" {
+		t.Errorf("unexpected config after allow: %+v, %v", cfg.DNSBlocklist, cfg.BlockedDevices)
+	}
+}
+
+func TestValidateWebhooks(t *testing.T) {
+	testCases := []struct {
+		name     string
+		webhooks []WebhookConfig
+		valid    bool
+	}{
+		{"none", nil, true},
+		{"all events", []WebhookConfig{{URL: "https://example.com/hook", Secret: "s"}}, true},
+		{"some events", []WebhookConfig{{URL: "http://10.0.0.5:9000/", Events: []string{"nat.started", "device.joined"}}}, true},
+		{"unknown event", []WebhookConfig{{URL: "https://example.com/hook", Events: []string{"nat.exploded"}}}, false},
+		{"not http", []WebhookConfig{{URL: "ftp://example.com/hook"}}, false},
+		{"no host", []WebhookConfig{{URL: "https:///hook"}}, false},
+		{"duplicate", []WebhookConfig{{URL: "https://example.com/hook"}, {URL: "https://example.com/hook"}}, false},
+	}
+	for _, tc := range testCases {
+		if err := ValidateWebhooks(tc.webhooks); (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateWebhooks error = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+
+	cfg := Default()
+	cfg.Webhooks = []WebhookConfig{{URL: "https://example.com/hook", Secret: "s", Events: []string{"nat.started"}}}
+	cfg.TrafficQuota = "50GB"
+	if hooks := cfg.Hooks(); len(hooks) != 1 || hooks[0].Secret != "s" || !hooks[0].Wants("nat.started") {
+		t.Errorf("Hooks = %+v", hooks)
+	}
+	if quota := cfg.ToNATConfig().TrafficQuota; quota != 50<<30 {
+		t.Errorf("TrafficQuota = %d", quota)
+	}
+	cfg.TrafficQuota = "a lot"
+	if err := cfg.ValidateSettings(); err == nil {
+		t.Error("An invalid traffic quota should be rejected")
+	}
+}
+
+func TestMQTTConfig(t *testing.T) {
+	testCases := []struct {
+		name  string
+		mqtt  MQTTConfig
+		valid bool
+	}{
+		{"disabled", MQTTConfig{Broker: "nonsense"}, true},
+		{"tcp", MQTTConfig{Enabled: true, Broker: "tcp://homeassistant.local:1883"}, true},
+		{"tls with interval", MQTTConfig{Enabled: true, Broker: "ssl://broker.example.com:8883", Interval: "1m"}, true},
+		{"no broker", MQTTConfig{Enabled: true}, false},
+		{"http", MQTTConfig{Enabled: true, Broker: "http://broker.example.com"}, false},
+		{"short interval", MQTTConfig{Enabled: true, Broker: "tcp://10.0.0.2:1883", Interval: "10ms"}, false},
+	}
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.MQTT = tc.mqtt
+		if err := cfg.ValidateSettings(); (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateSettings error = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+
+	cfg := Default()
+	cfg.MQTT = MQTTConfig{Enabled: true, Broker: "tcp://10.0.0.2:1883", Password: "p", HomeAssistant: true}
+	opts := cfg.MQTTOptions()
+	if opts.Password != "p" || !opts.HomeAssistant || opts.Interval != 30*time.Second {
+		t.Errorf("MQTTOptions = %+v", opts)
+	}
+}
+
+func TestNotifyConfig(t *testing.T) {
+	if alerts := (NotifyConfig{}).Alerts(); len(alerts) != 0 {
+		t.Errorf("Expected no alerts, got %v", alerts)
+	}
+	alerts := NotifyConfig{WANDown: true, UnknownDevice: true}.Alerts()
+	if !slices.Equal(alerts, []string{"unknown_device", "wan_down"}) {
+		t.Errorf("Alerts = %v", alerts)
+	}
+
+	t.Setenv("HOME", t.TempDir())
+	cfg := Default()
+	cfg.DeviceLabels = map[string]string{"AA:BB:CC:DD:EE:01": "printer"}
+	cfg.DHCPLeases = []DeviceLease{{MAC: "aa:bb:cc:dd:ee:02", IP: "192.168.100.20"}}
+	path, err := GetFingerprintPath()
+	if err != nil {
+		t.Fatalf("GetFingerprintPath: %v", err)
+	}
+	if err := fingerprint.Record(path, fingerprint.Observation{MAC: "AA:BB:CC:DD:EE:03"}); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	for mac, known := range map[string]bool{
+		"aa:bb:cc:dd:ee:01": true,
+		"aa:bb:cc:dd:ee:02": true,
+		"aa:bb:cc:dd:ee:03": true,
+		"aa:bb:cc:dd:ee:04": false,
+	} {
+		if cfg.KnownDevice(mac) != known {
+			t.Errorf("KnownDevice(%s) = %t, want %t", mac, !known, known)
+		}
+	}
+}
+
+func TestLoggingConfig(t *testing.T) {
+	testCases := []struct {
+		name    string
+		logging LoggingConfig
+		valid   bool
+	}{
+		{"default", LoggingConfig{}, true},
+		{"json debug", LoggingConfig{Level: "debug", Format: "json", MaxSize: "5MB", OSLog: true}, true},
+		{"bad level", LoggingConfig{Level: "loud"}, false},
+		{"bad format", LoggingConfig{Format: "xml"}, false},
+		{"bad size", LoggingConfig{MaxSize: "big"}, false},
+		{"remote audit", LoggingConfig{Syslog: "tcp://logs.example.com", Audit: true}, true},
+		{"bad syslog", LoggingConfig{Syslog: "logs.example.com:514"}, false},
+		{"audit nowhere", LoggingConfig{Audit: true}, false},
+	}
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.Logging = tc.logging
+		if err := cfg.ValidateSettings(); (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateSettings error = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfg := Default()
+	cfg.Logging = LoggingConfig{Level: "warn", Format: "json", MaxSize: "1MB", Syslog: "udp://10.0.0.5"}
+	opts, err := cfg.LoggingOptions("")
+	if err != nil {
+		t.Fatalf("LoggingOptions: %v", err)
+	}
+	if opts.Level != slog.LevelWarn || opts.Format != "json" || opts.MaxSize != 1<<20 || opts.Syslog != "udp://10.0.0.5" ||
+		opts.Path != filepath.Join(home, "Library", "Logs", "nat-manager", "default.log") {
+		t.Errorf("LoggingOptions = %+v", opts)
+	}
+	if opts, err := cfg.LoggingOptions("debug"); err != nil || opts.Level != slog.LevelDebug {
+		t.Errorf("LoggingOptions(debug) = %+v, %v", opts, err)
+	}
+	if _, err := cfg.LoggingOptions("loud"); err == nil {
+		t.Error("LoggingOptions accepted an invalid level")
+	}
+}
+
+func TestFlowExportConfig(t *testing.T) {
+	testCases := []struct {
+		name  string
+		flow  FlowExportConfig
+		valid bool
+	}{
+		{"disabled", FlowExportConfig{}, true},
+		{"ipfix", FlowExportConfig{Enabled: true, Collector: "10.0.0.5"}, true},
+		{"netflow9 with timeouts", FlowExportConfig{Enabled: true, Collector: "collector.lan:2055", Protocol: "netflow9", Interval: "5s", ActiveTimeout: "30s"}, true},
+		{"no collector", FlowExportConfig{Enabled: true}, false},
+		{"bad collector", FlowExportConfig{Collector: "udp://10.0.0.5"}, false},
+		{"bad protocol", FlowExportConfig{Enabled: true, Collector: "10.0.0.5", Protocol: "sflow"}, false},
+		{"short interval", FlowExportConfig{Enabled: true, Collector: "10.0.0.5", Interval: "100ms"}, false},
+		{"timeout below interval", FlowExportConfig{Enabled: true, Collector: "10.0.0.5", Interval: "1m", ActiveTimeout: "10s"}, false},
+	}
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.FlowExport = tc.flow
+		if err := cfg.ValidateSettings(); (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateSettings error = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+
+	cfg := Default()
+	cfg.FlowExport = FlowExportConfig{Enabled: true, Collector: "10.0.0.5", Protocol: "netflow9", ActiveTimeout: "2m", Domain: 4}
+	opts := cfg.FlowOptions()
+	if opts.Collector != "10.0.0.5" || opts.Protocol != "netflow9" || opts.Interval != 10*time.Second || opts.ActiveTimeout != 2*time.Minute || opts.Domain != 4 {
+		t.Errorf("FlowOptions = %+v", opts)
+	}
+}
+
+func TestInfluxConfig(t *testing.T) {
+	testCases := []struct {
+		name   string
+		influx InfluxConfig
+		valid  bool
+	}{
+		{"disabled", InfluxConfig{URL: "nonsense"}, true},
+		{"influxdb 2", InfluxConfig{Enabled: true, URL: "http://influx.local:8086", Token: "t", Org: "home", Bucket: "nat"}, true},
+		{"influxdb 1", InfluxConfig{Enabled: true, URL: "https://influx.local", Database: "telegraf", Interval: "10s"}, true},
+		{"telegraf udp", InfluxConfig{Enabled: true, URL: "udp://127.0.0.1:8094"}, true},
+		{"telegraf socket", InfluxConfig{Enabled: true, URL: "unix:///var/run/telegraf.sock"}, true},
+		{"no bucket", InfluxConfig{Enabled: true, URL: "http://influx.local:8086"}, false},
+		{"no port", InfluxConfig{Enabled: true, URL: "tcp://telegraf.local"}, false},
+		{"short interval", InfluxConfig{Enabled: true, URL: "udp://127.0.0.1:8094", Interval: "100ms"}, false},
+	}
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.Influx = tc.influx
+		if err := cfg.ValidateSettings(); (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateSettings error = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+
+	cfg := Default()
+	cfg.Influx = InfluxConfig{Enabled: true, URL: "http://influx.local:8086", Token: "t", Org: "home", Bucket: "nat"}
+	if opts := cfg.InfluxOptions(); opts.URL != cfg.Influx.URL || opts.Token != "t" || opts.Org != "home" || opts.Bucket != "nat" {
+		t.Errorf("InfluxOptions = %+v", opts)
+	}
+	if interval, err := cfg.Influx.GetInterval(); err != nil || interval != 30*time.Second {
+		t.Errorf("GetInterval = %v, %v", interval, err)
+	}
+}
+
+func TestSNMPConfig(t *testing.T) {
+	cfg := Default()
+	if err := cfg.ValidateSettings(); err != nil {
+		t.Fatalf("default settings: %v", err)
+	}
+	if opts := cfg.SNMPOptions(); opts.Listen != cfg.GetGatewayIP()+":161" || opts.Community != "" {
+		t.Errorf("SNMPOptions = %+v", opts)
+	}
+
+	cfg.SNMP = SNMPConfig{Enabled: true, Listen: "0.0.0.0:1161", Community: "s3cret"}
+	if err := cfg.ValidateSettings(); err != nil {
+		t.Errorf("ValidateSettings: %v", err)
+	}
+	if opts := cfg.SNMPOptions(); opts.Listen != "0.0.0.0:1161" || opts.Community != "s3cret" {
+		t.Errorf("SNMPOptions = %+v", opts)
+	}
+
+	cfg.SNMP.Listen = "192.168.100.1"
+	if err := cfg.ValidateSettings(); err == nil {
+		t.Error("ValidateSettings accepted a listen address without a port")
+	}
+}
+
+func TestDDNSConfig(t *testing.T) {
+	cloudflare := DDNSRecord{Provider: "cloudflare", Name: "lab.example.com", Token: "t"}
+	testCases := []struct {
+		name  string
+		ddns  DDNSConfig
+		valid bool
+	}{
+		{"disabled", DDNSConfig{}, true},
+		{"cloudflare", DDNSConfig{Enabled: true, Records: []DDNSRecord{cloudflare}}, true},
+		{"interface source", DDNSConfig{Enabled: true, IPSource: "interface", Interval: "1m", Records: []DDNSRecord{cloudflare,
+			{Provider: "duckdns", Name: "mylab", Token: "t"}}}, true},
+		{"no records", DDNSConfig{Enabled: true}, false},
+		{"bad source", DDNSConfig{IPSource: "stun"}, false},
+		{"bad url", DDNSConfig{IPURL: "ftp://ip.example.com"}, false},
+		{"short interval", DDNSConfig{Interval: "5s"}, false},
+		{"unknown provider", DDNSConfig{Records: []DDNSRecord{{Provider: "noip", Name: "lab.example.com"}}}, false},
+		{"missing token", DDNSConfig{Records: []DDNSRecord{{Provider: "duckdns", Name: "mylab"}}}, false},
+		{"duplicate", DDNSConfig{Records: []DDNSRecord{cloudflare, cloudflare}}, false},
+	}
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.DDNS = tc.ddns
+		if err := cfg.ValidateSettings(); (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateSettings error = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+
+	cfg := Default()
+	cfg.DDNS = DDNSConfig{Records: []DDNSRecord{{Provider: "route53", Name: "lab.example.com", Zone: "Z1", AccessKey: "a", SecretKey: "s", TTL: 60}}}
+	if records := cfg.DDNSRecords(); len(records) != 1 || records[0].SecretKey != "s" || records[0].TTL != 60 {
+		t.Errorf("DDNSRecords = %+v", records)
+	}
+	if interval, _ := cfg.DDNS.GetInterval(); interval != 5*time.Minute || cfg.DDNS.GetIPURL() != "https://api.ipify.org" {
+		t.Errorf("defaults = %s, %s", interval, cfg.DDNS.GetIPURL())
+	}
+}
+
+func TestWireGuardConfig(t *testing.T) {
+	key, _ := wireguard.GenerateKey()
+	laptop := WireGuardPeer{Name: "laptop", PublicKey: key.PublicKey().String(), Address: "10.8.0.2"}
+	other, _ := wireguard.GenerateKey()
+	phone := WireGuardPeer{Name: "phone", PublicKey: other.PublicKey().String(), PresharedKey: key.String(), Address: "10.8.0.3"}
+	testCases := []struct {
+		name      string
+		wireguard WireGuardConfig
+		valid     bool
+	}{
+		{"disabled", WireGuardConfig{}, true},
+		{"peers", WireGuardConfig{Enabled: true, PrivateKey: key.String(), Endpoint: "lab.example.com", Peers: []WireGuardPeer{laptop, phone}}, true},
+		{"custom network", WireGuardConfig{Enabled: true, Network: "10.44.1", Port: 443}, true},
+		{"internal network", WireGuardConfig{Enabled: true, Network: "192.168.100"}, false},
+		{"bad network", WireGuardConfig{Network: "10.8"}, false},
+		{"bad port", WireGuardConfig{Port: 70000}, false},
+		{"bad endpoint", WireGuardConfig{Endpoint: "https://lab.example.com"}, false},
+		{"bad private key", WireGuardConfig{PrivateKey: "s3cret"}, false},
+		{"bad peer key", WireGuardConfig{Peers: []WireGuardPeer{{Name: "laptop", PublicKey: "x", Address: "10.8.0.2"}}}, false},
+		{"gateway address", WireGuardConfig{Peers: []WireGuardPeer{{Name: "laptop", PublicKey: laptop.PublicKey, Address: "10.8.0.1"}}}, false},
+		{"outside address", WireGuardConfig{Peers: []WireGuardPeer{{Name: "laptop", PublicKey: laptop.PublicKey, Address: "10.9.0.2"}}}, false},
+		{"duplicate address", WireGuardConfig{Peers: []WireGuardPeer{laptop, {Name: "phone", PublicKey: phone.PublicKey, Address: "10.8.0.2"}}}, false},
+		{"duplicate name", WireGuardConfig{Peers: []WireGuardPeer{laptop, {Name: "laptop", PublicKey: phone.PublicKey, Address: "10.8.0.3"}}}, false},
+	}
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.WireGuard = tc.wireguard
+		if err := cfg.ValidateSettings(); (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateSettings error = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+
+	cfg := Default()
+	cfg.InternalNetwork = "10.8.0"
+	if err := cfg.WireGuard.validate(cfg.InternalNetwork); err != nil {
+		t.Errorf("A disabled endpoint should not clash with the internal network: %v", err)
+	}
+
+	cfg = Default()
+	cfg.WireGuard = WireGuardConfig{Enabled: true, Peers: []WireGuardPeer{laptop, phone}}
+	if _, err := cfg.WireGuardServer(); err == nil {
+		t.Error("WireGuardServer should need a private key")
+	}
+	cfg.WireGuard.PrivateKey = key.String()
+	server, err := cfg.WireGuardServer()
+	if err != nil || server.Port != 51820 || len(server.Peers) != 2 || server.Peers[1].PresharedKey != key {
+		t.Errorf("WireGuardServer = %+v, %v", server, err)
+	}
+	if w := cfg.ToNATConfig().WireGuard; !w.Enabled || w.Network != "10.8.0" || w.Port != 51820 {
+		t.Errorf("NAT WireGuard = %+v", w)
+	}
+}
+
+func TestContainerVMs(t *testing.T) {
+	colima := ContainerVMConfig{Name: "colima", Runtime: "colima", MAC: "52:55:55:0a:0b:0c", Interface: "col0"}
+	testCases := []struct {
+		name  string
+		vms   []ContainerVMConfig
+		valid bool
+	}{
+		{"none", nil, true},
+		{"colima and lima", []ContainerVMConfig{colima, {Name: "default", Runtime: "lima", MAC: "52:55:55:01:02:03"}}, true},
+		{"no name", []ContainerVMConfig{{Runtime: "lima", MAC: "52:55:55:01:02:03"}}, false},
+		{"unknown runtime", []ContainerVMConfig{{Name: "docker", Runtime: "docker-desktop", MAC: "52:55:55:01:02:03"}}, false},
+		{"bad MAC", []ContainerVMConfig{{Name: "default", Runtime: "lima", MAC: "52:55:55"}}, false},
+		{"same MAC", []ContainerVMConfig{colima, {Name: "default", Runtime: "lima", MAC: "52:55:55:a:b:c"}}, false},
+		{"same VM", []ContainerVMConfig{colima, colima}, false},
+	}
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.ContainerVMs = tc.vms
+		if err := cfg.ValidateSettings(); (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateSettings error = %v, expected valid = %t", tc.name, err, tc.valid)
+		}
+	}
+
+	cfg := Default()
+	cfg.ContainerVMs = []ContainerVMConfig{colima, {Name: "default", Runtime: "lima", MAC: "52:55:55:1:2:3"}}
+	vms := cfg.ToNATConfig().VMs
+	if len(vms) != 2 || vms[0].Kind != "Colima VM" || vms[1].Kind != "Lima VM" || vms[1].MAC != "52:55:55:01:02:03" {
+		t.Errorf("VMs = %+v", vms)
+	}
+}
+
+func TestVMNetworks(t *testing.T) {
+	testCases := []struct {
+		networks []string
+		valid    bool
+	}{
+		{nil, true},
+		{[]string{"bridge101", "vmnet8", "10.211.55"}, true},
+		{[]string{""}, false},
+		{[]string{"vmnet8", "VMnet8"}, false},
+	}
+	for _, tc := range testCases {
+		cfg := Default()
+		cfg.VMNetworks = tc.networks
+		if err := cfg.ValidateSettings(); (err == nil) != tc.valid {
+			t.Errorf("%v: ValidateSettings error = %v, expected valid = %t", tc.networks, err, tc.valid)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Setting is a configuration value addressed by its dotted key
+type Setting struct {
+	Key   string
+	Value string
+}
+
+// document returns the configuration as a YAML mapping node
+func (c *Config) document() (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := doc.Encode(c); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return &doc, nil
+}
+
+// lookup finds the node addressed by key, e.g. dhcp_range.start or
+// dns_records.0.name. With create, missing mapping keys are added.
+func lookup(node *yaml.Node, key string, create bool) (*yaml.Node, error) {
+	for _, part := range strings.Split(key, ".") {
+		switch node.Kind {
+		case yaml.MappingNode:
+			child := mappingValue(node, part)
+			if child == nil && !create {
+				return nil, fmt.Errorf("%s is not set", key)
+			}
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: part}, child)
+			}
+			node = child
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return nil, fmt.Errorf("%s: no element %q", key, part)
+			}
+			node = node.Content[i]
+		default:
+			return nil, fmt.Errorf("%s: %q is not a section", key, part)
+		}
+	}
+	return node, nil
+}
+
+// mappingValue returns the value of key in a mapping node
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// render formats a node as a plain scalar or as YAML
+func render(node *yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+	if node.Kind == yaml.SequenceNode || node.Kind == yaml.MappingNode {
+		flow := *node
+		flow.Style = yaml.FlowStyle
+		if data, err := yaml.Marshal(&flow); err == nil {
+			return strings.TrimSpace(string(data))
+		}
+	}
+	return ""
+}
+
+// Get returns the value of a dotted key, e.g. dhcp_range.start
+func (c *Config) Get(key string) (string, error) {
+	doc, err := c.document()
+	if err != nil {
+		return "", err
+	}
+	node, err := lookup(doc, key, false)
+	if err != nil {
+		return "", err
+	}
+	return render(node), nil
+}
+
+// Set parses value as YAML, so lists may be given as [a, b], and stores
+// it at a dotted key. Unknown keys, values of the wrong type and values
+// that make the configuration invalid are rejected and leave c unchanged.
+func (c *Config) Set(key, value string) error {
+	var parsed yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	replacement := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+	if len(parsed.Content) > 0 {
+		replacement = parsed.Content[0]
+	}
+
+	return c.update(func(doc *yaml.Node) error {
+		node, err := lookup(doc, key, true)
+		if err != nil {
+			return err
+		}
+		*node = *replacement
+		return nil
+	})
+}
+
+// Unset removes a dotted key, restoring its default, or removes an element
+// of a list
+func (c *Config) Unset(key string) error {
+	parent, last := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		parent, last = key[:i], key[i+1:]
+	}
+
+	return c.update(func(doc *yaml.Node) error {
+		node := doc
+		if parent != "" {
+			var err error
+			if node, err = lookup(doc, parent, false); err != nil {
+				return err
+			}
+		}
+		return removeChild(node, key, last)
+	})
+}
+
+// removeChild removes a key from a mapping or an element from a sequence
+func removeChild(node *yaml.Node, key, child string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == child {
+				node.Content = append(node.Content[:i], node.Content[i+2:]...)
+				return nil
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(child); err == nil && i >= 0 && i < len(node.Content) {
+			node.Content = append(node.Content[:i], node.Content[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not set", key)
+}
+
+// update applies change to the YAML form of c, decodes it strictly and
+// validates the result before replacing c
+func (c *Config) update(change func(doc *yaml.Node) error) error {
+	doc, err := c.document()
+	if err != nil {
+		return err
+	}
+	if err := change(doc); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	updated, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	if err := updated.ValidateSettings(); err != nil {
+		return err
+	}
+	*c = *updated
+	return nil
+}
+
+// Parse decodes a configuration strictly, rejecting unknown keys, and
+// fills in missing fields like LoadFrom
+func Parse(data []byte) (*Config, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var updated Config
+	if err := decoder.Decode(&updated); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	updated.setDefaults(data)
+	return &updated, nil
+}
+
+// ValidateSettings validates the configuration apart from the external
+// interface, which 'start' may also be given on the command line
+func (c *Config) ValidateSettings() error {
+	check := *c
+	if check.ExternalInterface == "" {
+		check.ExternalInterface = "unset"
+	}
+	return check.Validate()
+}
+
+// List returns every set value in file order
+func (c *Config) List() ([]Setting, error) {
+	doc, err := c.document()
+	if err != nil {
+		return nil, err
+	}
+	var settings []Setting
+	flatten(doc, "", &settings)
+	return settings, nil
+}
+
+// flatten collects the scalar and list values below node
+func flatten(node *yaml.Node, prefix string, settings *[]Setting) {
+	if node.Kind != yaml.MappingNode {
+		*settings = append(*settings, Setting{Key: prefix, Value: render(node)})
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i].Value
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flatten(node.Content[i+1], key, settings)
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import "strings"
+
+// AddItems appends items not already present, ignoring case
+func AddItems(list, items []string) []string {
+	for _, item := range items {
+		found := false
+		for _, existing := range list {
+			if strings.EqualFold(existing, item) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// RemoveItems drops every occurrence of items, ignoring case
+func RemoveItems(list, items []string) []string {
+	result := make([]string, 0, len(list))
+	for _, existing := range list {
+		keep := true
+		for _, item := range items {
+			if strings.EqualFold(existing, item) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, existing)
+		}
+	}
+	return result
+}
+
+// UpdateBlocks adds devices and domains to the block lists, or removes them
+// and allowlists the domains
+func (c *Config) UpdateBlocks(devices, domains []string, block bool) {
+	bl := &c.DNSBlocklist
+	if block {
+		c.BlockedDevices = AddItems(c.BlockedDevices, devices)
+		bl.Domains = AddItems(bl.Domains, domains)
+		bl.Allowlist = RemoveItems(bl.Allowlist, domains)
+		if len(domains) > 0 {
+			bl.Enabled = true
+		}
+		return
+	}
+	c.BlockedDevices = RemoveItems(c.BlockedDevices, devices)
+	bl.Domains = RemoveItems(bl.Domains, domains)
+	bl.Allowlist = AddItems(bl.Allowlist, domains)
+}
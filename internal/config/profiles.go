@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// profileSuffix is the extension of profile files
+const profileSuffix = ".yaml"
+
+// profile is the named configuration profile used instead of the
+// instance's config.yaml; see SetProfile
+var profile string
+
+// SetProfile selects a named configuration profile, or the instance's own
+// configuration when name is empty
+func SetProfile(name string) error {
+	if name != "" {
+		if err := ValidateProfileName(name); err != nil {
+			return err
+		}
+	}
+	profile = name
+	return nil
+}
+
+// Profile returns the selected profile, "" when none is
+func Profile() string {
+	return profile
+}
+
+// ValidateProfileName checks that a profile name is usable as a file name
+func ValidateProfileName(name string) error {
+	if err := nat.ValidateInstanceName(name); err != nil {
+		return fmt.Errorf("invalid profile name %q: use lowercase letters, digits and hyphens", name)
+	}
+	return nil
+}
+
+// ProfilesDir returns the directory holding the profiles
+func ProfilesDir() (string, error) {
+	dir, err := BaseDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "profiles"), nil
+}
+
+// profilePath returns the file of a profile
+func profilePath(name string) (string, error) {
+	if err := ValidateProfileName(name); err != nil {
+		return "", err
+	}
+	dir, err := ProfilesDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+profileSuffix), nil
+}
+
+// ProfileExists reports whether a profile has been created
+func ProfileExists(name string) bool {
+	path, err := profilePath(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// ListProfiles returns the names of the profiles in order
+func ListProfiles() ([]string, error) {
+	dir, err := ProfilesDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), profileSuffix)
+		if ok && !entry.IsDir() && ValidateProfileName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// LoadProfile reads a profile
+func LoadProfile(name string) (*Config, error) {
+	path, err := profilePath(name)
+	if err != nil {
+		return nil, err
+	}
+	if !ProfileExists(name) {
+		return nil, fmt.Errorf("profile %q does not exist", name)
+	}
+	return LoadFrom(path)
+}
+
+// CreateProfile saves cfg as a new profile
+func CreateProfile(name string, cfg *Config) error {
+	path, err := profilePath(name)
+	if err != nil {
+		return err
+	}
+	if ProfileExists(name) {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+	return cfg.SaveTo(path)
+}
+
+// CopyProfile creates a profile from an existing one
+func CopyProfile(from, to string) error {
+	cfg, err := LoadProfile(from)
+	if err != nil {
+		return err
+	}
+	return CreateProfile(to, cfg)
+}
+
+// DeleteProfile removes a profile
+func DeleteProfile(name string) error {
+	path, err := profilePath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); os.IsNotExist(err) {
+		return fmt.Errorf("profile %q does not exist", name)
+	} else if err != nil {
+		return fmt.Errorf("failed to delete profile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schedule actions
+const (
+	ScheduleStart = "start"
+	ScheduleStop  = "stop"
+)
+
+// weekdays maps day names to launchd weekdays, 1 (Monday) to 7 (Sunday)
+var weekdays = map[string]int{"mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6, "sun": 7}
+
+// ScheduleEntry starts or stops NAT at a time of day
+type ScheduleEntry struct {
+	Name   string `yaml:"name" json:"name"`
+	Action string `yaml:"action" json:"action"`                 // start or stop
+	At     string `yaml:"at" json:"at"`                         // HH:MM, local time
+	Days   string `yaml:"days,omitempty" json:"days,omitempty"` // e.g. mon-fri or sat,sun; every day if empty
+}
+
+// Time returns the hour and minute the entry runs at
+func (s ScheduleEntry) Time() (int, int, error) {
+	at, err := time.Parse("15:04", s.At)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid time %q, expected HH:MM", s.At)
+	}
+	return at.Hour(), at.Minute(), nil
+}
+
+// Weekdays returns the days the entry runs on, 1 (Monday) to 7 (Sunday),
+// or nil for every day
+func (s ScheduleEntry) Weekdays() ([]int, error) {
+	if s.Days == "" || s.Days == "daily" {
+		return nil, nil
+	}
+	set := make(map[int]bool)
+	for _, part := range strings.Split(strings.ToLower(s.Days), ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			last = first
+		}
+		from, ok := weekdays[first]
+		to, ok2 := weekdays[last]
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid days %q, expected e.g. mon-fri or sat,sun", s.Days)
+		}
+		for day := from; ; day = day%7 + 1 {
+			set[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	days := make([]int, 0, len(set))
+	for day := range set {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	if len(days) == 7 {
+		return nil, nil
+	}
+	return days, nil
+}
+
+// Validate checks the action, time and days of the entry
+func (s ScheduleEntry) Validate() error {
+	if s.Name == "" || strings.ContainsAny(s.Name, "/. ") {
+		return fmt.Errorf("schedule entry name %q must be non-empty without spaces, dots or slashes", s.Name)
+	}
+	if s.Action != ScheduleStart && s.Action != ScheduleStop {
+		return fmt.Errorf("schedule entry %q: action must be %s or %s", s.Name, ScheduleStart, ScheduleStop)
+	}
+	if _, _, err := s.Time(); err != nil {
+		return fmt.Errorf("schedule entry %q: %w", s.Name, err)
+	}
+	if _, err := s.Weekdays(); err != nil {
+		return fmt.Errorf("schedule entry %q: %w", s.Name, err)
+	}
+	return nil
+}
+
+// ValidateSchedule checks every entry and that names are unique
+func ValidateSchedule(entries []ScheduleEntry) error {
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		if err := entry.Validate(); err != nil {
+			return err
+		}
+		if names[entry.Name] {
+			return fmt.Errorf("duplicate schedule entry %q", entry.Name)
+		}
+		names[entry.Name] = true
+	}
+	return nil
+}
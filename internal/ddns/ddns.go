@@ -0,0 +1,256 @@
+// Package ddns keeps dynamic DNS records pointing at the external address
+// of an instance, through provider plugins such as Cloudflare, DuckDNS and
+// Route53
+package ddns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+)
+
+// Defaults of the updater
+const (
+	DefaultInterval = 5 * time.Minute
+	DefaultIPURL    = "https://api.ipify.org"
+	DefaultTTL      = 300
+	requestTimeout  = 15 * time.Second
+)
+
+// Sources of the external address
+const (
+	SourceWeb       = "web"       // as seen by a web service, behind other NAT too
+	SourceInterface = "interface" // the address of the external interface
+)
+
+// Sources lists the sources of the external address
+var Sources = []string{SourceWeb, SourceInterface}
+
+// Record is a name kept up to date by a provider, with the provider's
+// settings
+type Record struct {
+	Provider  string
+	Name      string // e.g. lab.example.com, or the subdomain for DuckDNS
+	Token     string // API token of Cloudflare and DuckDNS
+	Zone      string // Cloudflare zone name or ID, Route53 hosted zone ID
+	AccessKey string // AWS access key ID for Route53
+	SecretKey string // AWS secret access key for Route53
+	Command   string // run by the command provider
+	TTL       int    // DefaultTTL when 0
+}
+
+// Provider updates the address of records
+type Provider interface {
+	// Update points the record at addr, an A record for IPv4 and AAAA for
+	// IPv6
+	Update(ctx context.Context, addr netip.Addr) error
+}
+
+// Factory returns the provider of a record, checking its settings
+type Factory func(r Record) (Provider, error)
+
+var (
+	mu        sync.Mutex
+	factories = map[string]Factory{}
+)
+
+// Register makes a provider available by name
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = factory
+}
+
+// Providers returns the names of the providers registered
+func Providers() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewProvider returns the provider of r
+func NewProvider(r Record) (Provider, error) {
+	mu.Lock()
+	factory, ok := factories[r.Provider]
+	mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q (use %s)", r.Provider, strings.Join(Providers(), ", "))
+	}
+	if r.Name == "" {
+		return nil, fmt.Errorf("no name for the %s record", r.Provider)
+	}
+	return factory(r)
+}
+
+// recordType returns A or AAAA for addr
+func recordType(addr netip.Addr) string {
+	if addr.Is4() {
+		return "A"
+	}
+	return "AAAA"
+}
+
+// ttl returns the TTL of r
+func (r Record) ttl() int {
+	if r.TTL > 0 {
+		return r.TTL
+	}
+	return DefaultTTL
+}
+
+// Lookup returns the external address to publish
+type Lookup func(ctx context.Context) (netip.Addr, error)
+
+// WebLookup returns the address a service such as ipify sees requests
+// coming from, as the body of a GET to url
+func WebLookup(url string) Lookup {
+	client := &http.Client{Timeout: requestTimeout}
+	return func(ctx context.Context) (netip.Addr, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return netip.Addr{}, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("failed to look up the external address: %w", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		if resp.StatusCode/100 != 2 {
+			return netip.Addr{}, fmt.Errorf("failed to look up the external address: %s", resp.Status)
+		}
+		addr, err := netip.ParseAddr(strings.TrimSpace(string(body)))
+		if err != nil {
+			return netip.Addr{}, fmt.Errorf("%s did not answer an address: %q", url, strings.TrimSpace(string(body)))
+		}
+		return addr.Unmap(), nil
+	}
+}
+
+// Result is the outcome of syncing a record
+type Result struct {
+	Record   Record
+	Addr     netip.Addr
+	Previous netip.Addr // the address last published, if any
+	Updated  bool       // false when the record was already up to date
+	DryRun   bool
+	Err      error
+}
+
+// Updater publishes the external address to records when it changes. It
+// is an event.Sink: a changed uplink address makes it sync right away.
+type Updater struct {
+	records   []Record
+	providers []Provider
+	lookup    Lookup
+	dryRun    bool
+	trigger   chan struct{}
+
+	mu        sync.Mutex
+	published map[int]netip.Addr // by record
+}
+
+var _ event.Sink = (*Updater)(nil)
+
+// New returns an updater of records publishing the address lookup
+// returns. With dryRun, records are reported but not updated.
+func New(records []Record, lookup Lookup, dryRun bool) (*Updater, error) {
+	u := &Updater{records: records, lookup: lookup, dryRun: dryRun,
+		trigger: make(chan struct{}, 1), published: map[int]netip.Addr{}}
+	for _, r := range records {
+		provider, err := NewProvider(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.Name, err)
+		}
+		u.providers = append(u.providers, provider)
+	}
+	return u, nil
+}
+
+// Sync looks up the external address and updates the records that do not
+// have it yet
+func (u *Updater) Sync(ctx context.Context) ([]Result, error) {
+	addr, err := u.lookup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !addr.IsValid() || addr.IsUnspecified() {
+		return nil, errors.New("no external address")
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var results []Result
+	for i, r := range u.records {
+		result := Result{Record: r, Addr: addr, Previous: u.published[i], DryRun: u.dryRun}
+		if result.Previous != addr {
+			result.Updated = true
+			if !u.dryRun {
+				result.Err = u.providers[i].Update(ctx, addr)
+			}
+			if result.Err == nil {
+				u.published[i] = addr
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// Run syncs every interval, and when the uplink's address changes, until
+// ctx is done. onResult is told about the records updated or failing,
+// onError about failed lookups.
+func (u *Updater) Run(ctx context.Context, interval time.Duration, onResult func(Result), onError func(error)) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		results, err := u.Sync(ctx)
+		if err != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		for _, result := range results {
+			if result.Updated || result.Err != nil {
+				onResult(result)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-u.trigger:
+		}
+	}
+}
+
+// Send makes a running updater sync when the uplink got a new address
+func (u *Updater) Send(e event.Event) {
+	if e.Type != event.WANIPChanged || e.Data["external_ip"] == "" {
+		return
+	}
+	select {
+	case u.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Close has nothing to wait for
+func (u *Updater) Close(context.Context) error {
+	return nil
+}
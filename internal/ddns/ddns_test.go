@@ -0,0 +1,309 @@
+package ddns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+)
+
+var addr = netip.MustParseAddr("203.0.113.7")
+
+func TestNewProvider(t *testing.T) {
+	testCases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Provider: Cloudflare, Name: "lab.example.com", Token: "t"}, true},
+		{Record{Provider: Cloudflare, Name: "lab.example.com"}, false},
+		{Record{Provider: DuckDNS, Name: "mylab", Token: "t"}, true},
+		{Record{Provider: Route53, Name: "lab.example.com", Zone: "Z1", AccessKey: "a", SecretKey: "s"}, true},
+		{Record{Provider: Route53, Name: "lab.example.com", Zone: "Z1"}, false},
+		{Record{Provider: Command, Name: "lab.example.com", Command: "true"}, true},
+		{Record{Provider: Command, Name: "lab.example.com"}, false},
+		{Record{Provider: Cloudflare, Token: "t"}, false},
+		{Record{Provider: "noip", Name: "lab.example.com"}, false},
+	}
+	for _, tc := range testCases {
+		if _, err := NewProvider(tc.record); (err == nil) != tc.valid {
+			t.Errorf("NewProvider(%+v) = %v, expected valid = %t", tc.record, err, tc.valid)
+		}
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	// get-vanilla of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	signV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+	if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+		t.Errorf("X-Amz-Date = %s", got)
+	}
+}
+
+// serve points endpoint at a test server for the duration of the test
+func serve(t *testing.T, endpoint *string, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	previous := *endpoint
+	*endpoint = server.URL
+	t.Cleanup(func() {
+		*endpoint = previous
+		server.Close()
+	})
+}
+
+func TestCloudflare(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+	content := ""
+	serve(t, &cloudflareAPI, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+string(body)))
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			_, _ = fmt.Fprint(w, `{"success":false,"errors":[{"code":10000,"message":"Authentication error"}]}`)
+			return
+		}
+		switch {
+		case r.URL.Path == "/zones":
+			_, _ = fmt.Fprint(w, `{"success":true,"result":[{"id":"0123456789abcdef0123456789abcdef"}]}`)
+		case r.Method == http.MethodGet && content == "":
+			_, _ = fmt.Fprint(w, `{"success":true,"result":[]}`)
+		case r.Method == http.MethodGet:
+			_, _ = fmt.Fprintf(w, `{"success":true,"result":[{"id":"rec1","content":%q}]}`, content)
+		default:
+			var change struct {
+				Content string `json:"content"`
+			}
+			_ = json.Unmarshal(body, &change)
+			content = change.Content
+			_, _ = fmt.Fprint(w, `{"success":true,"result":{}}`)
+		}
+	})
+
+	provider, _ := NewProvider(Record{Provider: Cloudflare, Name: "lab.example.com", Token: "t0ken"})
+	for _, a := range []netip.Addr{addr, addr, netip.MustParseAddr("203.0.113.8")} {
+		if err := provider.Update(context.Background(), a); err != nil {
+			t.Fatalf("Update(%s): %v", a, err)
+		}
+	}
+	want := []string{
+		"GET /zones?name=example.com",
+		"GET /zones/0123456789abcdef0123456789abcdef/dns_records?name=lab.example.com&type=A",
+		`POST /zones/0123456789abcdef0123456789abcdef/dns_records {"content":"203.0.113.7","name":"lab.example.com","proxied":false,"ttl":300,"type":"A"}`,
+		"GET /zones?name=example.com",
+		"GET /zones/0123456789abcdef0123456789abcdef/dns_records?name=lab.example.com&type=A",
+		"GET /zones?name=example.com",
+		"GET /zones/0123456789abcdef0123456789abcdef/dns_records?name=lab.example.com&type=A",
+		`PATCH /zones/0123456789abcdef0123456789abcdef/dns_records/rec1 {"content":"203.0.113.8"}`,
+	}
+	if strings.Join(requests, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests =\n%s\nwant\n%s", strings.Join(requests, "\n"), strings.Join(want, "\n"))
+	}
+
+	provider, _ = NewProvider(Record{Provider: Cloudflare, Name: "lab.example.com", Token: "wrong", Zone: "0123456789abcdef0123456789abcdef"})
+	if err := provider.Update(context.Background(), addr); err == nil || !strings.Contains(err.Error(), "Authentication error") {
+		t.Errorf("expected the Cloudflare error, got %v", err)
+	}
+}
+
+func TestDuckDNS(t *testing.T) {
+	var query string
+	serve(t, &duckDNSAPI, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		if r.URL.Query().Get("token") != "t0ken" {
+			_, _ = fmt.Fprint(w, "KO")
+			return
+		}
+		_, _ = fmt.Fprint(w, "OK")
+	})
+
+	provider, _ := NewProvider(Record{Provider: DuckDNS, Name: "mylab.duckdns.org", Token: "t0ken"})
+	if err := provider.Update(context.Background(), addr); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if query != "domains=mylab&ip=203.0.113.7&token=t0ken" {
+		t.Errorf("query = %s", query)
+	}
+	if err := provider.Update(context.Background(), netip.MustParseAddr("2001:db8::7")); err != nil || !strings.Contains(query, "ipv6=2001%3Adb8%3A%3A7") {
+		t.Errorf("IPv6 update: %v, %s", err, query)
+	}
+	provider, _ = NewProvider(Record{Provider: DuckDNS, Name: "mylab", Token: "wrong"})
+	if err := provider.Update(context.Background(), addr); err == nil {
+		t.Error("expected the refused update to fail")
+	}
+}
+
+func TestRoute53(t *testing.T) {
+	var path, auth, body string
+	serve(t, &route53API, func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		path, auth, body = r.URL.Path, r.Header.Get("Authorization"), string(data)
+		if strings.Contains(body, "AAAA") {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprint(w, `<ErrorResponse><Error><Code>InvalidChangeBatch</Code><Message>RRSet of type AAAA is not permitted</Message></Error></ErrorResponse>`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `<ChangeResourceRecordSetsResponse/>`)
+	})
+
+	provider, _ := NewProvider(Record{Provider: Route53, Name: "lab.example.com", Zone: "/hostedzone/Z123", AccessKey: "AKID", SecretKey: "secret", TTL: 60})
+	if err := provider.Update(context.Background(), addr); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if path != "/2013-04-01/hostedzone/Z123/rrset/" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+		!strings.Contains(auth, "/us-east-1/route53/aws4_request") {
+		t.Errorf("request to %s with %q", path, auth)
+	}
+	want := `<ChangeBatch><Comment>nat-manager dynamic DNS</Comment><Changes><Change><Action>UPSERT</Action>` +
+		`<ResourceRecordSet><Name>lab.example.com</Name><Type>A</Type><TTL>60</TTL><ResourceRecords><ResourceRecord>` +
+		`<Value>203.0.113.7</Value></ResourceRecord></ResourceRecords></ResourceRecordSet></Change></Changes></ChangeBatch>`
+	if !strings.Contains(body, want) {
+		t.Errorf("body = %s", body)
+	}
+	if err := provider.Update(context.Background(), netip.MustParseAddr("2001:db8::7")); err == nil || !strings.Contains(err.Error(), "not permitted") {
+		t.Errorf("expected the Route53 error, got %v", err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	provider, _ := NewProvider(Record{Provider: Command, Name: "lab.example.com",
+		Command: `echo "$NAT_MANAGER_DDNS_NAME $NAT_MANAGER_DDNS_TYPE $NAT_MANAGER_DDNS_IP $NAT_MANAGER_DDNS_TTL" > ` + out})
+	if err := provider.Update(context.Background(), addr); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if data, _ := os.ReadFile(out); string(data) != "lab.example.com A 203.0.113.7 300\n" {
+		t.Errorf("command saw %q", data)
+	}
+
+	provider, _ = NewProvider(Record{Provider: Command, Name: "lab.example.com", Command: "echo denied >&2; exit 3"})
+	if err := provider.Update(context.Background(), addr); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("expected the command's output, got %v", err)
+	}
+}
+
+// fakeProvider records updates, failing when told to
+type fakeProvider struct {
+	mu      sync.Mutex
+	updates []netip.Addr
+	fail    bool
+}
+
+func (f *fakeProvider) Update(_ context.Context, addr netip.Addr) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return errors.New("provider down")
+	}
+	f.updates = append(f.updates, addr)
+	return nil
+}
+
+func TestUpdater(t *testing.T) {
+	fakes := map[string]*fakeProvider{"a.example.com": {}, "b.example.com": {fail: true}}
+	Register("fake", func(r Record) (Provider, error) { return fakes[r.Name], nil })
+	records := []Record{{Provider: "fake", Name: "a.example.com"}, {Provider: "fake", Name: "b.example.com"}}
+	current := addr
+	lookup := func(context.Context) (netip.Addr, error) { return current, nil }
+
+	dry, err := New(records, lookup, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := dry.Sync(context.Background())
+	if err != nil || len(results) != 2 || !results[0].Updated || !results[0].DryRun || len(fakes["a.example.com"].updates) != 0 {
+		t.Fatalf("dry run = %+v, %v", results, err)
+	}
+
+	updater, _ := New(records, lookup, false)
+	results, _ = updater.Sync(context.Background())
+	if !results[0].Updated || results[0].Err != nil || results[1].Err == nil {
+		t.Errorf("first sync = %+v", results)
+	}
+	fakes["b.example.com"].fail = false
+	results, _ = updater.Sync(context.Background())
+	if results[0].Updated || !results[1].Updated || results[1].Err != nil {
+		t.Errorf("second sync = %+v", results)
+	}
+	current = netip.MustParseAddr("203.0.113.8")
+	results, _ = updater.Sync(context.Background())
+	if !results[0].Updated || results[0].Previous != addr || len(fakes["a.example.com"].updates) != 2 {
+		t.Errorf("sync after a change = %+v", results)
+	}
+
+	failing, _ := New(records, func(context.Context) (netip.Addr, error) { return netip.IPv4Unspecified(), nil }, false)
+	if _, err := failing.Sync(context.Background()); err == nil {
+		t.Error("an unspecified address was published")
+	}
+}
+
+func TestUpdaterRun(t *testing.T) {
+	fake := &fakeProvider{}
+	Register("fake-run", func(Record) (Provider, error) { return fake, nil })
+	var mu sync.Mutex
+	current := addr
+	updater, _ := New([]Record{{Provider: "fake-run", Name: "lab.example.com"}}, func(context.Context) (netip.Addr, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return current, nil
+	}, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan Result, 4)
+	go updater.Run(ctx, time.Hour, func(r Result) { results <- r }, func(err error) { t.Error(err) })
+	if r := <-results; r.Addr != addr {
+		t.Fatalf("first result = %+v", r)
+	}
+
+	mu.Lock()
+	current = netip.MustParseAddr("203.0.113.9")
+	mu.Unlock()
+	updater.Send(event.Event{Type: event.WANDown, Data: map[string]string{"external_ip": ""}})
+	updater.Send(event.Event{Type: event.WANIPChanged, Data: map[string]string{"external_ip": "10.0.0.9"}})
+	select {
+	case r := <-results:
+		if r.Addr != current || r.Previous != addr {
+			t.Errorf("result after the change = %+v", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the address change did not trigger a sync")
+	}
+}
+
+func TestWebLookup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			_, _ = fmt.Fprint(w, "<html>")
+			return
+		}
+		_, _ = fmt.Fprint(w, "203.0.113.7\n")
+	}))
+	defer server.Close()
+
+	if got, err := WebLookup(server.URL)(context.Background()); err != nil || got != addr {
+		t.Errorf("WebLookup = %s, %v", got, err)
+	}
+	if _, err := WebLookup(server.URL + "/broken")(context.Background()); err == nil {
+		t.Error("WebLookup accepted a page that is not an address")
+	}
+}
@@ -0,0 +1,323 @@
+package ddns
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Built-in providers
+const (
+	Cloudflare = "cloudflare"
+	DuckDNS    = "duckdns"
+	Route53    = "route53"
+	Command    = "command" // runs a script, for any other provider
+)
+
+// Endpoints of the providers, replaced in tests
+var (
+	cloudflareAPI = "https://api.cloudflare.com/client/v4"
+	duckDNSAPI    = "https://www.duckdns.org/update"
+	route53API    = "https://route53.amazonaws.com"
+)
+
+func init() {
+	Register(Cloudflare, newCloudflare)
+	Register(DuckDNS, newDuckDNS)
+	Register(Route53, newRoute53)
+	Register(Command, newCommand)
+}
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+// cloudflare updates a record through the Cloudflare API with a token
+// allowed to edit the zone's DNS
+type cloudflare struct {
+	record Record
+}
+
+// zoneIDRe matches Cloudflare zone IDs, which are used as is
+var zoneIDRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func newCloudflare(r Record) (Provider, error) {
+	if r.Token == "" {
+		return nil, fmt.Errorf("cloudflare needs an API token")
+	}
+	return &cloudflare{r}, nil
+}
+
+// cloudflareResponse is the envelope of Cloudflare API responses
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result json.RawMessage `json:"result"`
+}
+
+// call sends a request to the API and decodes its result into result
+func (c *cloudflare) call(ctx context.Context, method, path string, body, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cloudflareAPI+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.record.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Cloudflare: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var envelope cloudflareResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&envelope); err != nil {
+		return fmt.Errorf("cloudflare: %s", resp.Status)
+	}
+	if !envelope.Success {
+		var messages []string
+		for _, e := range envelope.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("cloudflare: %s", strings.Join(messages, "; "))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Result, result)
+}
+
+// zoneID returns the ID of the record's zone, by default the last two
+// labels of its name
+func (c *cloudflare) zoneID(ctx context.Context) (string, error) {
+	zone := c.record.Zone
+	if zoneIDRe.MatchString(zone) {
+		return zone, nil
+	}
+	if zone == "" {
+		labels := strings.Split(strings.TrimSuffix(c.record.Name, "."), ".")
+		zone = strings.Join(labels[max(len(labels)-2, 0):], ".")
+	}
+	var zones []struct {
+		ID string `json:"id"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(zone), nil, &zones); err != nil {
+		return "", err
+	}
+	if len(zones) == 0 {
+		return "", fmt.Errorf("cloudflare: no zone %s", zone)
+	}
+	return zones[0].ID, nil
+}
+
+func (c *cloudflare) Update(ctx context.Context, addr netip.Addr) error {
+	zone, err := c.zoneID(ctx)
+	if err != nil {
+		return err
+	}
+	typ := recordType(addr)
+	var records []struct {
+		ID      string `json:"id"`
+		Content string `json:"content"`
+	}
+	query := url.Values{"type": {typ}, "name": {c.record.Name}}
+	if err := c.call(ctx, http.MethodGet, "/zones/"+zone+"/dns_records?"+query.Encode(), nil, &records); err != nil {
+		return err
+	}
+	if len(records) > 0 {
+		if records[0].Content == addr.String() {
+			return nil
+		}
+		return c.call(ctx, http.MethodPatch, "/zones/"+zone+"/dns_records/"+records[0].ID, map[string]any{"content": addr.String()}, nil)
+	}
+	return c.call(ctx, http.MethodPost, "/zones/"+zone+"/dns_records", map[string]any{
+		"type": typ, "name": c.record.Name, "content": addr.String(), "ttl": c.record.ttl(), "proxied": false,
+	}, nil)
+}
+
+// duckDNS updates a duckdns.org subdomain
+type duckDNS struct {
+	record Record
+}
+
+func newDuckDNS(r Record) (Provider, error) {
+	if r.Token == "" {
+		return nil, fmt.Errorf("duckdns needs a token")
+	}
+	return &duckDNS{r}, nil
+}
+
+func (d *duckDNS) Update(ctx context.Context, addr netip.Addr) error {
+	query := url.Values{
+		"domains": {strings.TrimSuffix(strings.TrimSuffix(d.record.Name, "."), ".duckdns.org")},
+		"token":   {d.record.Token},
+	}
+	if addr.Is4() {
+		query.Set("ip", addr.String())
+	} else {
+		query.Set("ipv6", addr.String())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, duckDNSAPI+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach DuckDNS: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if resp.StatusCode/100 != 2 || !strings.HasPrefix(string(body), "OK") {
+		return fmt.Errorf("duckdns refused the update of %s (check the subdomain and token)", d.record.Name)
+	}
+	return nil
+}
+
+// route53 upserts a record of a Route53 hosted zone, signing requests with
+// AWS Signature Version 4
+type route53 struct {
+	record Record
+	now    func() time.Time
+}
+
+func newRoute53(r Record) (Provider, error) {
+	if r.Zone == "" || r.AccessKey == "" || r.SecretKey == "" {
+		return nil, fmt.Errorf("route53 needs a hosted zone ID, an access key and a secret key")
+	}
+	return &route53{record: r, now: time.Now}, nil
+}
+
+// route53Change is a ChangeResourceRecordSets request
+type route53Change struct {
+	XMLName xml.Name `xml:"https://route53.amazonaws.com/doc/2013-04-01/ ChangeResourceRecordSetsRequest"`
+	Comment string   `xml:"ChangeBatch>Comment"`
+	Action  string   `xml:"ChangeBatch>Changes>Change>Action"`
+	Name    string   `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>Name"`
+	Type    string   `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>Type"`
+	TTL     int      `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>TTL"`
+	Value   string   `xml:"ChangeBatch>Changes>Change>ResourceRecordSet>ResourceRecords>ResourceRecord>Value"`
+}
+
+func (r *route53) Update(ctx context.Context, addr netip.Addr) error {
+	body, err := xml.Marshal(route53Change{
+		Comment: "nat-manager dynamic DNS",
+		Action:  "UPSERT",
+		Name:    r.record.Name,
+		Type:    recordType(addr),
+		TTL:     r.record.ttl(),
+		Value:   addr.String(),
+	})
+	if err != nil {
+		return err
+	}
+	body = append([]byte(xml.Header), body...)
+	zone := strings.TrimPrefix(r.record.Zone, "/hostedzone/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, route53API+"/2013-04-01/hostedzone/"+zone+"/rrset/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	signV4(req, body, r.record.AccessKey, r.record.SecretKey, "us-east-1", "route53", r.now())
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Route53: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		var failure struct {
+			Message string `xml:"Error>Message"`
+		}
+		_ = xml.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&failure)
+		return fmt.Errorf("route53: %s: %s", resp.Status, failure.Message)
+	}
+	return nil
+}
+
+// signV4 signs req and its body for an AWS service, with the host and
+// date headers
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	sum := sha256.Sum256(body)
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		"host:" + req.URL.Host + "\nx-amz-date:" + amzDate + "\n",
+		"host;x-amz-date",
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	canonicalSum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalSum[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=host;x-amz-date, Signature=%s",
+		accessKey, scope, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// command runs a shell command to update any other provider, with the
+// record in the environment: NAT_MANAGER_DDNS_NAME, NAT_MANAGER_DDNS_TYPE,
+// NAT_MANAGER_DDNS_IP and NAT_MANAGER_DDNS_TTL
+type command struct {
+	record Record
+}
+
+func newCommand(r Record) (Provider, error) {
+	if r.Command == "" {
+		return nil, fmt.Errorf("the command provider needs a command")
+	}
+	return &command{r}, nil
+}
+
+func (c *command) Update(ctx context.Context, addr netip.Addr) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", c.record.Command)
+	cmd.Env = append(os.Environ(),
+		"NAT_MANAGER_DDNS_NAME="+c.record.Name,
+		"NAT_MANAGER_DDNS_TYPE="+recordType(addr),
+		"NAT_MANAGER_DDNS_IP="+addr.String(),
+		fmt.Sprintf("NAT_MANAGER_DDNS_TTL=%d", c.record.ttl()),
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %w: %s", c.record.Command, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
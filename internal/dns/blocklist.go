@@ -0,0 +1,254 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBlocklistSize bounds how much of a single blocklist is read
+const maxBlocklistSize = 64 << 20
+
+// Blocklist holds the blocked domains, the allowlist overriding them, the
+// domains blocked by hand and the clients that bypass filtering
+type Blocklist struct {
+	mu      sync.RWMutex
+	blocked map[string]struct{}
+	allowed map[string]struct{}
+	custom  map[string]struct{}
+	bypass  map[string]struct{}
+}
+
+// NewBlocklist creates a blocklist from blocked domains, allowlisted domains
+// and bypassing client IPs
+func NewBlocklist(blocked, allowed, bypass []string) *Blocklist {
+	b := &Blocklist{}
+	b.Replace(blocked)
+	b.SetAllowlist(allowed)
+	b.SetBypass(bypass)
+	return b
+}
+
+// Replace swaps in a new set of blocked domains
+func (b *Blocklist) Replace(domains []string) {
+	blocked := toDomainSet(domains)
+	b.mu.Lock()
+	b.blocked = blocked
+	b.mu.Unlock()
+}
+
+// SetAllowlist replaces the domains that are never blocked
+func (b *Blocklist) SetAllowlist(domains []string) {
+	allowed := toDomainSet(domains)
+	b.mu.Lock()
+	b.allowed = allowed
+	b.mu.Unlock()
+}
+
+// SetCustom replaces the domains blocked by hand, which are blocked even
+// when allowlisted
+func (b *Blocklist) SetCustom(domains []string) {
+	custom := toDomainSet(domains)
+	b.mu.Lock()
+	b.custom = custom
+	b.mu.Unlock()
+}
+
+// SetBypass replaces the client IPs whose queries are never filtered
+func (b *Blocklist) SetBypass(ips []string) {
+	bypass := make(map[string]struct{}, len(ips))
+	for _, ip := range ips {
+		bypass[ip] = struct{}{}
+	}
+	b.mu.Lock()
+	b.bypass = bypass
+	b.mu.Unlock()
+}
+
+// Len returns the number of blocked domains
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.blocked)
+}
+
+// Blocked reports whether name (or a parent domain) is blocked for the
+// client. Allowlisted domains and their subdomains are only blocked when
+// blocked by hand.
+func (b *Blocklist) Blocked(client, name string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if _, ok := b.bypass[clientIP(client)]; ok {
+		return false
+	}
+
+	name = normalizeDomain(name)
+	if matchDomain(b.custom, name) {
+		return true
+	}
+	if matchDomain(b.allowed, name) {
+		return false
+	}
+	return matchDomain(b.blocked, name)
+}
+
+// matchDomain reports whether name or any of its parent domains is in set
+func matchDomain(set map[string]struct{}, name string) bool {
+	for name != "" {
+		if _, ok := set[name]; ok {
+			return true
+		}
+		dot := strings.IndexByte(name, '.')
+		if dot < 0 {
+			return false
+		}
+		name = name[dot+1:]
+	}
+	return false
+}
+
+// ParseHosts extracts domains from a hosts-format ("0.0.0.0 ads.example.com")
+// or plain domain-per-line blocklist
+func ParseHosts(r io.Reader) ([]string, error) {
+	var domains []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if net.ParseIP(fields[0]) != nil {
+			fields = fields[1:]
+		}
+		for _, field := range fields {
+			domain := normalizeDomain(field)
+			if strings.Contains(domain, ".") && net.ParseIP(domain) == nil {
+				domains = append(domains, domain)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read blocklist: %w", err)
+	}
+	return domains, nil
+}
+
+// FetchBlocklists downloads and merges hosts-format blocklists. Sources may
+// be http(s) URLs or local file paths. Sources that fail are reported in the
+// returned error while the rest are still merged.
+func FetchBlocklists(ctx context.Context, sources []string) ([]string, error) {
+	client := &http.Client{Timeout: 60 * time.Second}
+	merged := make(map[string]struct{})
+
+	var failures []string
+	for _, source := range sources {
+		domains, err := fetchBlocklist(ctx, client, source)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", source, err))
+			continue
+		}
+		for _, domain := range domains {
+			merged[domain] = struct{}{}
+		}
+	}
+
+	domains := make([]string, 0, len(merged))
+	for domain := range merged {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	if len(failures) > 0 {
+		return domains, fmt.Errorf("failed to fetch %s", strings.Join(failures, "; "))
+	}
+	return domains, nil
+}
+
+func fetchBlocklist(ctx context.Context, client *http.Client, source string) ([]string, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		file, err := os.Open(strings.TrimPrefix(source, "file://"))
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = file.Close() }()
+		return ParseHosts(io.LimitReader(file, maxBlocklistSize))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return ParseHosts(io.LimitReader(resp.Body, maxBlocklistSize))
+}
+
+// LoadDomains reads a domain-per-line file such as a saved blocklist
+func LoadDomains(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+	return ParseHosts(file)
+}
+
+// SaveDomains writes domains one per line
+func SaveDomains(path string, domains []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create blocklist directory: %w", err)
+	}
+
+	data := strings.Join(domains, "\n")
+	if len(domains) > 0 {
+		data += "\n"
+	}
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		return fmt.Errorf("failed to write blocklist: %w", err)
+	}
+	return nil
+}
+
+func toDomainSet(domains []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		if domain = normalizeDomain(domain); domain != "" {
+			set[domain] = struct{}{}
+		}
+	}
+	return set
+}
+
+func normalizeDomain(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// clientIP strips the port from a client address
+func clientIP(client string) string {
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		return host
+	}
+	return client
+}
@@ -0,0 +1,117 @@
+package dns
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached upstream response
+type cacheEntry struct {
+	msg     []byte
+	offsets []int
+	stored  time.Time
+	expires time.Time
+}
+
+// cache stores upstream responses until their smallest TTL expires
+type cache struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	max     int
+	now     func() time.Time
+}
+
+func newCache(max int) *cache {
+	return &cache{
+		entries: make(map[string]*cacheEntry),
+		max:     max,
+		now:     time.Now,
+	}
+}
+
+// get returns a copy of the cached response for key with its ID set to the
+// query's and its TTLs reduced by the time spent in the cache
+func (c *cache) get(key string, query []byte) ([]byte, bool) {
+	if c.max <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	now := c.now()
+	if !now.Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	msg := make([]byte, len(entry.msg))
+	copy(msg, entry.msg)
+	copy(msg[0:2], query[0:2])
+
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	for _, off := range entry.offsets {
+		ttl := binary.BigEndian.Uint32(msg[off : off+4])
+		if ttl > elapsed {
+			ttl -= elapsed
+		} else {
+			ttl = 0
+		}
+		binary.BigEndian.PutUint32(msg[off:off+4], ttl)
+	}
+	return msg, true
+}
+
+// put stores a response for ttl, evicting the soonest-expiring entry when full
+func (c *cache) put(key string, msg []byte, offsets []int, ttl time.Duration) {
+	if c.max <= 0 || ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.max {
+		c.evict(now)
+	}
+
+	stored := make([]byte, len(msg))
+	copy(stored, msg)
+	c.entries[key] = &cacheEntry{
+		msg:     stored,
+		offsets: offsets,
+		stored:  now,
+		expires: now.Add(ttl),
+	}
+}
+
+// evict drops expired entries, or the soonest-expiring one if none expired
+func (c *cache) evict(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldestKey == "" || entry.expires.Before(oldest) {
+			oldestKey, oldest = key, entry.expires
+		}
+	}
+	if len(c.entries) >= c.max && oldestKey != "" {
+		delete(c.entries, oldestKey)
+	}
+}
+
+// len returns the number of cached responses
+func (c *cache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
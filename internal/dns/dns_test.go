@@ -0,0 +1,887 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// buildQuery builds a recursive query for name and qtype
+func buildQuery(id uint16, name string, qtype uint16) []byte {
+	msg := make([]byte, headerLen)
+	binary.BigEndian.PutUint16(msg[0:2], id)
+	binary.BigEndian.PutUint16(msg[2:4], flagRD)
+	binary.BigEndian.PutUint16(msg[4:6], 1)
+	for _, label := range strings.Split(name, ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint16(msg[len(msg)-4:], qtype)
+	binary.BigEndian.PutUint16(msg[len(msg)-2:], classIN)
+	return msg
+}
+
+// fakeUpstream answers every A query with 203.0.113.7 and the given TTL
+func fakeUpstream(t *testing.T, ttl uint32, queries *int32) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start fake upstream: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(queries, 1)
+			query := buf[:n]
+			q, err := parseQuestion(query)
+			if err != nil {
+				continue
+			}
+			resp := appendA(newResponse(query, q, rcodeOK, false), net.ParseIP("203.0.113.7"), ttl)
+			_, _ = conn.WriteTo(resp, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestParseQuestion(t *testing.T) {
+	q, err := parseQuestion(buildQuery(1, "example.com", typeA))
+	if err != nil {
+		t.Fatalf("parseQuestion failed: %v", err)
+	}
+	if q.name != "example.com" || q.qtype != typeA || q.qclass != classIN {
+		t.Errorf("Unexpected question: %+v", q)
+	}
+
+	if _, err := parseQuestion([]byte{1, 2, 3}); err == nil {
+		t.Error("parseQuestion should reject short messages")
+	}
+
+	// A compression loop must not hang
+	loop := buildQuery(1, "a", typeA)
+	loop[headerLen] = 0xC0
+	loop[headerLen+1] = headerLen
+	if _, err := parseQuestion(loop); err == nil {
+		t.Error("parseQuestion should reject compression loops")
+	}
+}
+
+func TestTypeName(t *testing.T) {
+	if TypeName(1) != "A" || TypeName(28) != "AAAA" || TypeName(999) != "TYPE999" {
+		t.Error("TypeName returned unexpected names")
+	}
+}
+
+func TestCacheDecrementsTTL(t *testing.T) {
+	query := buildQuery(7, "example.com", typeA)
+	q, _ := parseQuestion(query)
+	resp := appendA(newResponse(query, q, rcodeOK, false), net.ParseIP("203.0.113.7"), 300)
+	offsets, err := ttlOffsets(resp, q)
+	if err != nil || len(offsets) != 1 {
+		t.Fatalf("ttlOffsets = %v, %v", offsets, err)
+	}
+
+	now := time.Now()
+	c := newCache(10)
+	c.now = func() time.Time { return now }
+	c.put(q.cacheKey(), resp, offsets, 300*time.Second)
+
+	c.now = func() time.Time { return now.Add(100 * time.Second) }
+	cached, ok := c.get(q.cacheKey(), buildQuery(9, "example.com", typeA))
+	if !ok {
+		t.Fatal("Expected cache hit")
+	}
+	if binary.BigEndian.Uint16(cached[0:2]) != 9 {
+		t.Error("Cached response should carry the new query ID")
+	}
+	if ttl, _ := minTTL(cached, offsets); ttl != 200 {
+		t.Errorf("Expected TTL 200 after 100s, got %d", ttl)
+	}
+
+	c.now = func() time.Time { return now.Add(301 * time.Second) }
+	if _, ok := c.get(q.cacheKey(), query); ok {
+		t.Error("Expired entry should not be returned")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newCache(2)
+	c.put("a", []byte("aaaaaaaaaaaa"), nil, time.Minute)
+	c.put("b", []byte("bbbbbbbbbbbb"), nil, time.Hour)
+	c.put("c", []byte("cccccccccccc"), nil, time.Hour)
+
+	if c.len() != 2 {
+		t.Fatalf("Expected 2 entries, got %d", c.len())
+	}
+	if _, ok := c.entries["a"]; ok {
+		t.Error("Soonest-expiring entry should be evicted first")
+	}
+}
+
+func TestForwarderCachesUpstreamAnswers(t *testing.T) {
+	var queries int32
+	upstream := fakeUpstream(t, 300, &queries)
+
+	var logged []QueryLog
+	forwarder, err := NewForwarder(Config{
+		Listen:    "127.0.0.1:0",
+		Upstreams: []string{upstream},
+		OnQuery:   func(entry QueryLog) { logged = append(logged, entry) },
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		resp := forwarder.handle(ctx, buildQuery(uint16(i), "example.com", typeA), "192.168.100.101:5353", false)
+		if resp == nil || rcode(resp) != rcodeOK {
+			t.Fatalf("Query %d failed", i)
+		}
+	}
+
+	if atomic.LoadInt32(&queries) != 1 {
+		t.Errorf("Expected 1 upstream query, got %d", queries)
+	}
+
+	stats := forwarder.Stats()
+	if stats.Queries != 3 || stats.CacheHits != 2 || stats.CacheMisses != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.QueryTypes["A"] != 3 {
+		t.Errorf("Expected 3 A queries, got %d", stats.QueryTypes["A"])
+	}
+	if len(logged) != 3 || logged[0].Source != "upstream" || logged[1].Source != "cache" {
+		t.Errorf("Unexpected query log: %+v", logged)
+	}
+}
+
+func TestForwarderReportsAnswers(t *testing.T) {
+	var queries int32
+	upstream := fakeUpstream(t, 300, &queries)
+
+	answers := make(map[string][]net.IP)
+	forwarder, err := NewForwarder(Config{
+		Listen:    "127.0.0.1:0",
+		Upstreams: []string{upstream},
+		Records:   []Record{{Name: "printer.lan", Type: "A", Value: "192.168.100.9"}},
+		OnAnswer:  func(name string, ips []net.IP) { answers[name] = ips },
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	ctx := context.Background()
+	forwarder.handle(ctx, buildQuery(1, "Exam.Example.com", typeA), "192.168.100.101:5353", false)
+	forwarder.handle(ctx, buildQuery(2, "printer.lan", typeA), "192.168.100.101:5353", false)
+
+	if ips := answers["exam.example.com"]; len(ips) != 1 || !ips[0].Equal(net.ParseIP("203.0.113.7")) {
+		t.Errorf("Expected the upstream answer to be reported, got %v", answers)
+	}
+	if _, ok := answers["printer.lan"]; ok {
+		t.Error("Local answers should not be reported")
+	}
+}
+
+func TestForwarderPolicies(t *testing.T) {
+	var defaultQueries, kidsQueries int32
+	defaultUpstream := fakeUpstream(t, 300, &defaultQueries)
+	kidsUpstream := fakeUpstream(t, 300, &kidsQueries)
+
+	var logged []QueryLog
+	forwarder, err := NewForwarder(Config{
+		Listen:    "127.0.0.1:0",
+		Upstreams: []string{defaultUpstream},
+		Policies:  []Policy{{Name: "kids", Upstreams: []string{kidsUpstream}}},
+		PolicyFor: func(client string) string {
+			if client == "192.168.100.50" {
+				return "kids"
+			}
+			return ""
+		},
+		OnQuery: func(entry QueryLog) { logged = append(logged, entry) },
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	ctx := context.Background()
+	forwarder.handle(ctx, buildQuery(1, "example.com", typeA), "192.168.100.50:5353", false)
+	forwarder.handle(ctx, buildQuery(2, "example.com", typeA), "192.168.100.60:5353", false)
+	forwarder.handle(ctx, buildQuery(3, "example.com", typeA), "192.168.100.50:5353", false)
+
+	if kidsQueries != 1 || defaultQueries != 1 {
+		t.Errorf("Expected one query per policy, got kids=%d default=%d", kidsQueries, defaultQueries)
+	}
+	if len(logged) != 3 || logged[0].Policy != "kids" || logged[1].Policy != "" || logged[2].Source != "cache" {
+		t.Errorf("Unexpected query log: %+v", logged)
+	}
+
+	if _, err := NewForwarder(Config{Listen: "127.0.0.1:0", Upstreams: []string{defaultUpstream}, Policies: []Policy{{Name: "work"}}}); err == nil {
+		t.Error("Expected a policy without upstreams to be rejected")
+	}
+}
+
+func TestForwarderLocalZone(t *testing.T) {
+	forwarder, err := NewForwarder(Config{
+		Listen:      "127.0.0.1:0",
+		Upstreams:   []string{"127.0.0.1:1"},
+		LocalDomain: "nat.lan",
+		LocalLookup: func(name string) net.IP {
+			if name == "laptop.nat.lan" {
+				return net.ParseIP("192.168.100.101")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	resp := forwarder.handle(context.Background(), buildQuery(1, "laptop.nat.lan", typeA), "client", false)
+	if rcode(resp) != rcodeOK || binary.BigEndian.Uint16(resp[6:8]) != 1 {
+		t.Fatal("Expected one local answer")
+	}
+	if ip := net.IP(resp[len(resp)-4:]); !ip.Equal(net.ParseIP("192.168.100.101")) {
+		t.Errorf("Expected 192.168.100.101, got %s", ip)
+	}
+
+	resp = forwarder.handle(context.Background(), buildQuery(2, "missing.nat.lan", typeA), "client", false)
+	if rcode(resp) != rcodeNX {
+		t.Errorf("Expected NXDOMAIN for unknown local name, got rcode %d", rcode(resp))
+	}
+
+	if forwarder.Stats().LocalAnswers != 2 {
+		t.Errorf("Expected 2 local answers, got %d", forwarder.Stats().LocalAnswers)
+	}
+}
+
+func TestForwarderUpstreamFailure(t *testing.T) {
+	forwarder, err := NewForwarder(Config{
+		Listen:    "127.0.0.1:0",
+		Upstreams: []string{"127.0.0.1:1"},
+		Timeout:   200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	resp := forwarder.handle(context.Background(), buildQuery(1, "example.com", typeA), "client", false)
+	if rcode(resp) != rcodeFail {
+		t.Errorf("Expected SERVFAIL, got rcode %d", rcode(resp))
+	}
+	if forwarder.Stats().UpstreamErrors != 1 {
+		t.Error("Upstream failure should be counted")
+	}
+}
+
+func TestForwarderListenAndServe(t *testing.T) {
+	var queries int32
+	upstream := fakeUpstream(t, 60, &queries)
+
+	forwarder, err := NewForwarder(Config{Listen: "127.0.0.1:0", Upstreams: []string{upstream}})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- forwarder.ListenAndServe(ctx) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for forwarder.Addr() == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if forwarder.Addr() == nil {
+		t.Fatal("Forwarder did not start listening")
+	}
+
+	for _, tcp := range []bool{false, true} {
+		resp, err := plainUpstream{addr: forwarder.Addr().String()}.Exchange(ctx, buildQuery(42, "example.com", typeA), tcp)
+		if err != nil {
+			t.Fatalf("Exchange (tcp=%t) failed: %v", tcp, err)
+		}
+		if rcode(resp) != rcodeOK {
+			t.Errorf("Expected NOERROR (tcp=%t), got %d", tcp, rcode(resp))
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("ListenAndServe returned error: %v", err)
+	}
+}
+
+func TestNewForwarderValidation(t *testing.T) {
+	if _, err := NewForwarder(Config{Upstreams: []string{"8.8.8.8"}}); err == nil {
+		t.Error("Expected error without listen address")
+	}
+	if _, err := NewForwarder(Config{Listen: ":53"}); err == nil {
+		t.Error("Expected error without upstreams")
+	}
+	if _, err := NewForwarder(Config{Listen: ":53", Upstreams: []string{"not-an-ip"}}); err == nil {
+		t.Error("Expected error for invalid upstream")
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	input := "# StevenBlack hosts\n" +
+		"127.0.0.1 localhost\n" +
+		"0.0.0.0 ads.example.com tracker.example.net # inline comment\n" +
+		"Metrics.Example.org.\n" +
+		"\n" +
+		"0.0.0.0 0.0.0.0\n"
+
+	domains, err := ParseHosts(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseHosts failed: %v", err)
+	}
+
+	expected := []string{"ads.example.com", "tracker.example.net", "metrics.example.org"}
+	if len(domains) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, domains)
+	}
+	for i, domain := range expected {
+		if domains[i] != domain {
+			t.Errorf("Expected %s at %d, got %s", domain, i, domains[i])
+		}
+	}
+}
+
+func TestBlocklistBlocked(t *testing.T) {
+	blocklist := NewBlocklist(
+		[]string{"ads.example.com", "tracker.net"},
+		[]string{"good.tracker.net"},
+		[]string{"192.168.100.50"},
+	)
+	blocklist.SetCustom([]string{"a.good.tracker.net", "Casino.example."})
+
+	testCases := []struct {
+		client  string
+		name    string
+		blocked bool
+	}{
+		{"192.168.100.101:5353", "ads.example.com", true},
+		{"192.168.100.101:5353", "ADS.example.com.", true},
+		{"192.168.100.101:5353", "x.ads.example.com", true},
+		{"192.168.100.101:5353", "example.com", false},
+		{"192.168.100.101:5353", "cdn.tracker.net", true},
+		{"192.168.100.101:5353", "good.tracker.net", false},
+		{"192.168.100.101:5353", "b.good.tracker.net", false},
+		{"192.168.100.101:5353", "a.good.tracker.net", true},
+		{"192.168.100.101:5353", "www.casino.example", true},
+		{"192.168.100.50:5353", "ads.example.com", false},
+		{"192.168.100.50:5353", "casino.example", false},
+	}
+
+	for _, tc := range testCases {
+		if got := blocklist.Blocked(tc.client, tc.name); got != tc.blocked {
+			t.Errorf("Blocked(%s, %s) = %t, expected %t", tc.client, tc.name, got, tc.blocked)
+		}
+	}
+}
+
+func TestFetchBlocklists(t *testing.T) {
+	dir := t.TempDir()
+	first := dir + "/first.txt"
+	second := dir + "/second.txt"
+	if err := SaveDomains(first, []string{"b.example.com", "a.example.com"}); err != nil {
+		t.Fatalf("SaveDomains failed: %v", err)
+	}
+	if err := SaveDomains(second, []string{"a.example.com", "c.example.com"}); err != nil {
+		t.Fatalf("SaveDomains failed: %v", err)
+	}
+
+	domains, err := FetchBlocklists(context.Background(), []string{first, "file://" + second})
+	if err != nil {
+		t.Fatalf("FetchBlocklists failed: %v", err)
+	}
+	if strings.Join(domains, ",") != "a.example.com,b.example.com,c.example.com" {
+		t.Errorf("Unexpected merged domains: %v", domains)
+	}
+
+	domains, err = FetchBlocklists(context.Background(), []string{first, dir + "/missing.txt"})
+	if err == nil {
+		t.Error("Expected error for missing source")
+	}
+	if len(domains) != 2 {
+		t.Errorf("Working sources should still be merged, got %v", domains)
+	}
+}
+
+func TestForwarderBlocksDomains(t *testing.T) {
+	var queries int32
+	upstream := fakeUpstream(t, 60, &queries)
+
+	forwarder, err := NewForwarder(Config{
+		Listen:    "127.0.0.1:0",
+		Upstreams: []string{upstream},
+		Blocklist: NewBlocklist([]string{"ads.example.com"}, nil, nil),
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	resp := forwarder.handle(context.Background(), buildQuery(1, "ads.example.com", typeA), "192.168.100.101:5353", false)
+	if ip := net.IP(resp[len(resp)-4:]); !ip.Equal(net.IPv4zero) {
+		t.Errorf("Blocked name should resolve to 0.0.0.0, got %s", ip)
+	}
+	if atomic.LoadInt32(&queries) != 0 {
+		t.Error("Blocked queries must not reach the upstream")
+	}
+	if forwarder.Stats().Blocked != 1 {
+		t.Errorf("Expected 1 blocked query, got %d", forwarder.Stats().Blocked)
+	}
+}
+
+func TestParseUpstream(t *testing.T) {
+	testCases := []struct {
+		addr     string
+		expected string
+		valid    bool
+	}{
+		{"8.8.8.8", "8.8.8.8:53", true},
+		{"1.1.1.1:5353", "1.1.1.1:5353", true},
+		{"cloudflare", "https://cloudflare-dns.com/dns-query", true},
+		{"https://doh.example.net/dns-query", "https://doh.example.net/dns-query", true},
+		{"http://doh.example.net/dns-query", "", false},
+		{"dns.google", "", false},
+	}
+
+	for _, tc := range testCases {
+		upstream, err := ParseUpstream(tc.addr)
+		if (err == nil) != tc.valid {
+			t.Errorf("ParseUpstream(%s) error = %v, expected valid = %t", tc.addr, err, tc.valid)
+			continue
+		}
+		if tc.valid && upstream.String() != tc.expected {
+			t.Errorf("ParseUpstream(%s) = %s, expected %s", tc.addr, upstream, tc.expected)
+		}
+	}
+}
+
+func TestDoHUpstream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dns-query" {
+			http.NotFound(w, r)
+			return
+		}
+		query, err := io.ReadAll(r.Body)
+		if err != nil || r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if query[0] != 0 || query[1] != 0 {
+			http.Error(w, "query ID should be zero", http.StatusBadRequest)
+			return
+		}
+		q, err := parseQuestion(query)
+		if err != nil {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(appendA(newResponse(query, q, rcodeOK, false), net.ParseIP("203.0.113.9"), 120))
+	}))
+	defer server.Close()
+
+	upstream := dohUpstream{url: server.URL + "/dns-query", client: server.Client()}
+	resp, err := upstream.Exchange(context.Background(), buildQuery(0xBEEF, "example.com", typeA), false)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if binary.BigEndian.Uint16(resp[0:2]) != 0xBEEF {
+		t.Error("Response should carry the original query ID")
+	}
+	if ip := net.IP(resp[len(resp)-4:]); !ip.Equal(net.ParseIP("203.0.113.9")) {
+		t.Errorf("Expected 203.0.113.9, got %s", ip)
+	}
+
+	failing := dohUpstream{url: server.URL + "/missing", client: server.Client()}
+	if _, err := failing.Exchange(context.Background(), buildQuery(1, "example.com", typeA), false); err == nil {
+		t.Error("Expected error for non-200 DoH response")
+	}
+}
+
+// fakeDoTServer answers A queries over TLS with a certificate for 127.0.0.1
+// and example.com, returning its address and a pool trusting the certificate
+func fakeDoTServer(t *testing.T) (string, *x509.CertPool) {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.StartTLS()
+	cert := srv.TLS.Certificates
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	srv.Close()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: cert, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatalf("Failed to start fake DoT server: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer func() { _ = conn.Close() }()
+				query, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				q, err := parseQuestion(query)
+				if err != nil {
+					return
+				}
+				_ = writeTCPMessage(conn, appendA(newResponse(query, q, rcodeOK, false), net.ParseIP("203.0.113.53"), 60))
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String(), pool
+}
+
+func TestDoTUpstream(t *testing.T) {
+	addr, pool := fakeDoTServer(t)
+
+	upstream, err := ParseUpstream("tls://" + addr + "#example.com")
+	if err != nil {
+		t.Fatalf("ParseUpstream failed: %v", err)
+	}
+	dot := upstream.(dotUpstream)
+	if dot.String() != "tls://"+addr || dot.tlsConfig.ServerName != "example.com" {
+		t.Errorf("Unexpected DoT upstream: %s (%s)", dot, dot.tlsConfig.ServerName)
+	}
+
+	// The system roots don't trust the test certificate
+	if _, err := dot.Exchange(context.Background(), buildQuery(1, "example.com", typeA), false); err == nil {
+		t.Error("Expected certificate validation failure")
+	}
+
+	dot.tlsConfig.RootCAs = pool
+	resp, err := dot.Exchange(context.Background(), buildQuery(2, "example.com", typeA), false)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if ip := net.IP(resp[len(resp)-4:]); !ip.Equal(net.ParseIP("203.0.113.53")) {
+		t.Errorf("Expected 203.0.113.53, got %s", ip)
+	}
+
+	// A certificate for a different name must be rejected
+	dot.tlsConfig.ServerName = "dns.example.org"
+	if _, err := dot.Exchange(context.Background(), buildQuery(3, "example.com", typeA), false); err == nil {
+		t.Error("Expected server name mismatch failure")
+	}
+
+	if upstream, err := ParseUpstream("tls://dns.quad9.net"); err != nil || upstream.String() != "tls://dns.quad9.net:853" {
+		t.Errorf("ParseUpstream(tls://dns.quad9.net) = %v, %v", upstream, err)
+	}
+}
+
+func TestForwarderFallback(t *testing.T) {
+	var queries int32
+	fallback := fakeUpstream(t, 60, &queries)
+
+	forwarder, err := NewForwarder(Config{
+		Listen:    "127.0.0.1:0",
+		Upstreams: []string{"127.0.0.1:1"},
+		Fallbacks: []string{fallback},
+		Timeout:   200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	var logged QueryLog
+	forwarder.config.OnQuery = func(entry QueryLog) { logged = entry }
+
+	resp := forwarder.handle(context.Background(), buildQuery(1, "example.com", typeA), "client", false)
+	if rcode(resp) != rcodeOK {
+		t.Fatalf("Expected fallback answer, got rcode %d", rcode(resp))
+	}
+	if logged.Source != "fallback" || logged.Upstream != fallback {
+		t.Errorf("Unexpected query log: %+v", logged)
+	}
+	if forwarder.Stats().Fallbacks != 1 {
+		t.Errorf("Expected 1 fallback, got %d", forwarder.Stats().Fallbacks)
+	}
+}
+
+func TestForwarderConditionalForwarding(t *testing.T) {
+	var defaultQueries, corpQueries, labQueries int32
+	defaultUpstream := fakeUpstream(t, 60, &defaultQueries)
+	corpUpstream := fakeUpstream(t, 60, &corpQueries)
+	labUpstream := fakeUpstream(t, 60, &labQueries)
+
+	forwarder, err := NewForwarder(Config{
+		Listen:    "127.0.0.1:0",
+		Upstreams: []string{defaultUpstream},
+		Fallbacks: []string{defaultUpstream},
+		CacheSize: -1,
+		Conditional: []ConditionalForward{
+			{Domain: "*.corp.example", Upstreams: []string{corpUpstream}},
+			{Domain: "lab.corp.example", Upstreams: []string{labUpstream}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	ctx := context.Background()
+	for i, name := range []string{"corp.example", "wiki.corp.example", "db.lab.corp.example", "example.com", "notcorp.example"} {
+		forwarder.handle(ctx, buildQuery(uint16(i), name, typeA), "client", false)
+	}
+
+	corp, lab, def := atomic.LoadInt32(&corpQueries), atomic.LoadInt32(&labQueries), atomic.LoadInt32(&defaultQueries)
+	if corp != 2 || lab != 1 || def != 2 {
+		t.Errorf("Unexpected routing: corp=%d lab=%d default=%d", corp, lab, def)
+	}
+
+	// Routed names must not fall back to the public resolvers
+	broken, err := NewForwarder(Config{
+		Listen:      "127.0.0.1:0",
+		Upstreams:   []string{defaultUpstream},
+		Fallbacks:   []string{defaultUpstream},
+		Timeout:     200 * time.Millisecond,
+		Conditional: []ConditionalForward{{Domain: "corp.example", Upstreams: []string{"127.0.0.1:1"}}},
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+	before := atomic.LoadInt32(&defaultQueries)
+	resp := broken.handle(ctx, buildQuery(9, "wiki.corp.example", typeA), "client", false)
+	if rcode(resp) != rcodeFail || atomic.LoadInt32(&defaultQueries) != before {
+		t.Error("Conditional names should fail rather than leak to the default upstreams")
+	}
+
+	if _, err := NewForwarder(Config{
+		Listen:      "127.0.0.1:0",
+		Upstreams:   []string{defaultUpstream},
+		Conditional: []ConditionalForward{{Domain: "corp.example"}},
+	}); err == nil {
+		t.Error("Conditional forward without upstreams should be rejected")
+	}
+}
+
+// answers returns the type and rdata of each answer record in resp
+func answers(t *testing.T, resp []byte) []string {
+	t.Helper()
+	q, err := parseQuestion(resp)
+	if err != nil {
+		t.Fatalf("parseQuestion failed: %v", err)
+	}
+
+	var result []string
+	off := q.end
+	for i := 0; i < int(binary.BigEndian.Uint16(resp[6:8])); i++ {
+		owner, next, err := readName(resp, off)
+		if err != nil {
+			t.Fatalf("readName failed: %v", err)
+		}
+		rrType := binary.BigEndian.Uint16(resp[next : next+2])
+		rdLen := int(binary.BigEndian.Uint16(resp[next+8 : next+10]))
+		rdata := resp[next+10 : next+10+rdLen]
+
+		value := net.IP(rdata).String()
+		if rrType == typeCNAME {
+			value, _, _ = readName(resp, next+10)
+		}
+		result = append(result, owner+" "+TypeName(rrType)+" "+value)
+		off = next + 10 + rdLen
+	}
+	return result
+}
+
+func TestForwarderStaticRecords(t *testing.T) {
+	forwarder, err := NewForwarder(Config{
+		Listen:      "127.0.0.1:0",
+		Upstreams:   []string{"127.0.0.1:1"},
+		LocalDomain: "nat.lan",
+		LocalLookup: func(name string) net.IP {
+			if name == "builder.nat.lan" {
+				return net.ParseIP("192.168.100.120")
+			}
+			return nil
+		},
+		Blocklist: NewBlocklist([]string{"lab"}, nil, nil),
+		Records: []Record{
+			{Name: "registry.lab", Type: "A", Value: "192.168.100.10"},
+			{Name: "Registry.lab.", Type: "aaaa", Value: "fd00::10"},
+			{Name: "docker.lab", Type: "CNAME", Value: "registry.lab"},
+			{Name: "ci.lab", Type: "CNAME", Value: "builder.nat.lan"},
+			{Name: "git.lab", Type: "CNAME", Value: "github.com"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewForwarder failed: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		qtype    uint16
+		expected string
+	}{
+		{"registry.lab", typeA, "registry.lab A 192.168.100.10"},
+		{"REGISTRY.LAB", typeAAAA, "REGISTRY.LAB AAAA fd00::10"},
+		{"docker.lab", typeA, "docker.lab CNAME registry.lab,registry.lab A 192.168.100.10"},
+		{"ci.lab", typeA, "ci.lab CNAME builder.nat.lan,builder.nat.lan A 192.168.100.120"},
+		{"git.lab", typeA, "git.lab CNAME github.com"},
+		{"registry.lab", 16, ""},
+	}
+
+	for _, tc := range testCases {
+		resp := forwarder.handle(context.Background(), buildQuery(1, tc.name, tc.qtype), "client", false)
+		if rcode(resp) != rcodeOK {
+			t.Errorf("%s: expected NOERROR, got rcode %d", tc.name, rcode(resp))
+			continue
+		}
+		if binary.BigEndian.Uint16(resp[2:4])&flagAA == 0 {
+			t.Errorf("%s: static answers should be authoritative", tc.name)
+		}
+		if got := strings.Join(answers(t, resp), ","); got != tc.expected {
+			t.Errorf("%s: got %q, expected %q", tc.name, got, tc.expected)
+		}
+	}
+
+	if forwarder.Stats().Blocked != 0 {
+		t.Error("Static records should take precedence over the blocklist")
+	}
+}
+
+func TestValidateRecord(t *testing.T) {
+	invalid := []Record{
+		{Name: "a.lab", Type: "A", Value: "fd00::1"},
+		{Name: "a.lab", Type: "AAAA", Value: "10.0.0.1"},
+		{Name: "a.lab", Type: "CNAME", Value: "10.0.0.1"},
+		{Name: "a.lab", Type: "CNAME", Value: "a.lab"},
+		{Name: "a.lab", Type: "MX", Value: "mail.lab"},
+		{Name: "", Type: "A", Value: "10.0.0.1"},
+		{Name: "a..lab", Type: "A", Value: "10.0.0.1"},
+		{Name: strings.Repeat("a", 64) + ".lab", Type: "A", Value: "10.0.0.1"},
+		{Name: strings.Repeat("a.", 127) + "lab", Type: "A", Value: "10.0.0.1"},
+		{Name: "a.lab", Type: "CNAME", Value: strings.Repeat("b", 64) + ".lab"},
+	}
+	for _, record := range invalid {
+		if err := ValidateRecord(record); err == nil {
+			t.Errorf("ValidateRecord(%+v) should fail", record)
+		}
+	}
+
+	if err := ValidateRecords([]Record{
+		{Name: "a.lab", Type: "CNAME", Value: "b.lab"},
+		{Name: "A.lab.", Type: "A", Value: "10.0.0.1"},
+	}); err == nil {
+		t.Error("CNAME combined with other records should be rejected")
+	}
+	if err := ValidateRecords([]Record{
+		{Name: "a.lab", Type: "A", Value: "10.0.0.1"},
+		{Name: "a.lab", Type: "AAAA", Value: "fd00::1"},
+	}); err != nil {
+		t.Errorf("A and AAAA records of one name should be accepted: %v", err)
+	}
+	if err := ValidateRecord(Record{Name: strings.Repeat("a", 63) + ".lab", Type: "A", Value: "10.0.0.1"}); err != nil {
+		t.Errorf("A 63-byte label should be accepted: %v", err)
+	}
+	if _, err := encodeName(strings.Repeat("a", 64) + ".lab"); err == nil {
+		t.Error("encodeName should reject labels longer than 63 bytes")
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	testCases := map[string]string{
+		"192.168.100.10": "10.100.168.192.in-addr.arpa",
+		"fd00::1":        "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa",
+	}
+	for ip, expected := range testCases {
+		if got := ReverseName(net.ParseIP(ip)); got != expected {
+			t.Errorf("ReverseName(%s) = %s, expected %s", ip, got, expected)
+		}
+	}
+}
+
+func TestQueryLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	now := time.Now()
+
+	w, err := OpenQueryLog(path, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenQueryLog failed: %v", err)
+	}
+	queries := []QueryLog{
+		{Time: now.Add(-2 * time.Hour), Client: "192.168.100.50:5353", Name: "old.example", Type: "A", Source: "upstream"},
+		{Time: now, Client: "192.168.100.50:40000", Name: "example.com", Type: "A", Source: "upstream", Duration: 1500 * time.Microsecond},
+		{Time: now, Client: "192.168.100.51:40001", Name: "Example.com", Type: "AAAA", Source: "cache"},
+		{Time: now, Client: "192.168.100.51:40002", Name: "ads.example", Type: "A", Source: "blocked"},
+	}
+	for _, q := range queries {
+		if err := w.Write(NewLoggedQuery(q, "laptop")); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Reopening prunes entries past retention
+	w, err = OpenQueryLog(path, time.Hour)
+	if err != nil {
+		t.Fatalf("OpenQueryLog failed: %v", err)
+	}
+	_ = w.Close()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+	entries, err := ReadQueryLog(file, nil)
+	if err != nil {
+		t.Fatalf("ReadQueryLog failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries after pruning, got %d", len(entries))
+	}
+	if entries[0].Client != "192.168.100.50" || entries[0].Device != "laptop" || entries[0].Duration != 1.5 {
+		t.Errorf("Unexpected entry: %+v", entries[0])
+	}
+}
+
+func TestTopDomains(t *testing.T) {
+	entries := []LoggedQuery{
+		{Client: "192.168.100.50", Name: "example.com", Source: "upstream"},
+		{Client: "192.168.100.51", Name: "Example.com", Source: "cache"},
+		{Client: "192.168.100.51", Name: "ads.example", Source: "blocked"},
+	}
+
+	top := TopDomains(entries, 1)
+	if len(top) != 1 || top[0] != (DomainCount{Name: "example.com", Queries: 2, Clients: 2}) {
+		t.Errorf("TopDomains = %+v", top)
+	}
+	if all := TopDomains(entries, 0); len(all) != 2 || all[1].Blocked != 1 {
+		t.Errorf("TopDomains(0) = %+v", all)
+	}
+}
@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// dotUpstream forwards queries over DNS-over-TLS (RFC 7858)
+type dotUpstream struct {
+	addr      string
+	tlsConfig *tls.Config
+}
+
+// newDoTUpstream creates a DoT upstream from tls://host[:port][#servername].
+// The server certificate is validated against the system roots for the
+// servername, which defaults to host.
+func newDoTUpstream(rawURL string) (Upstream, error) {
+	target := strings.TrimPrefix(rawURL, "tls://")
+	serverName := ""
+	if i := strings.IndexByte(target, '#'); i >= 0 {
+		target, serverName = target[:i], target[i+1:]
+	}
+
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host, port = strings.Trim(target, "[]"), "853"
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid DNS-over-TLS address %q", rawURL)
+	}
+	if serverName == "" {
+		serverName = host
+	}
+
+	return dotUpstream{
+		addr: net.JoinHostPort(host, port),
+		tlsConfig: &tls.Config{
+			ServerName: serverName,
+			MinVersion: tls.VersionTLS12,
+		},
+	}, nil
+}
+
+func (u dotUpstream) String() string {
+	return "tls://" + u.addr
+}
+
+// Exchange sends the query over a TLS connection, always using TCP framing
+func (u dotUpstream) Exchange(ctx context.Context, query []byte, _ bool) ([]byte, error) {
+	dialer := tls.Dialer{Config: u.tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", u.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if err := writeTCPMessage(conn, query); err != nil {
+		return nil, err
+	}
+	return readTCPMessage(conn)
+}
@@ -0,0 +1,614 @@
+// Package dns provides an embedded caching DNS forwarder for the internal network
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout   = 2 * time.Second
+	defaultCacheSize = 1000
+	negativeTTL      = 30 * time.Second
+	maxCacheTTL      = 24 * time.Hour
+	localTTL         = 60
+)
+
+// Config configures the DNS forwarder
+type Config struct {
+	Listen      string        // address to bind, e.g. 192.168.100.1:53
+	Upstreams   []string      // resolvers, e.g. 8.8.8.8, 1.1.1.1:53, a DoH URL or tls://host
+	Fallbacks   []string      // tried only when every upstream fails; empty is strict
+	CacheSize   int           // maximum cached responses, negative disables caching
+	Timeout     time.Duration // per-upstream query timeout
+	LocalDomain string        // zone answered locally, e.g. nat.lan
+
+	// Conditional routes queries for specific domains to their own resolvers
+	Conditional []ConditionalForward
+
+	// Policies replace the upstreams and fallbacks for groups of clients;
+	// PolicyFor returns the policy name of a client IP, "" for the defaults
+	Policies  []Policy
+	PolicyFor func(client string) string
+
+	// Records are static A, AAAA and CNAME records answered authoritatively
+	Records []Record
+
+	// LocalLookup resolves names in LocalDomain; nil results are NXDOMAIN
+	LocalLookup func(name string) net.IP
+
+	// Blocklist filters queries; blocked names resolve to 0.0.0.0
+	Blocklist *Blocklist
+
+	// OnQuery is called after every answered query
+	OnQuery func(QueryLog)
+
+	// OnAnswer is called with the addresses of every forwarded or cached
+	// answer before it is returned to the client
+	OnAnswer func(name string, ips []net.IP)
+}
+
+// ConditionalForward sends queries for Domain and its subdomains to
+// Upstreams instead of the default upstreams
+type ConditionalForward struct {
+	Domain    string
+	Upstreams []string
+}
+
+// conditionalRoute is a parsed ConditionalForward
+type conditionalRoute struct {
+	domain    string
+	upstreams []Upstream
+}
+
+// QueryLog describes a single answered query
+type QueryLog struct {
+	Time     time.Time
+	Client   string
+	Name     string
+	Type     string
+	Source   string // "cache", "upstream", "fallback", "local", "blocked" or "error"
+	Policy   string // DNS policy of the client, if any
+	Upstream string
+	Rcode    int
+	Duration time.Duration
+}
+
+// Stats holds cumulative forwarder metrics
+type Stats struct {
+	Queries        uint64
+	CacheHits      uint64
+	CacheMisses    uint64
+	LocalAnswers   uint64
+	Blocked        uint64
+	UpstreamErrors uint64
+	Fallbacks      uint64
+	CacheEntries   int
+	QueryTypes     map[string]uint64
+	UpstreamTime   time.Duration
+}
+
+// AvgUpstreamLatency returns the mean time spent waiting on upstreams
+func (s Stats) AvgUpstreamLatency() time.Duration {
+	if s.CacheMisses == 0 {
+		return 0
+	}
+	return s.UpstreamTime / time.Duration(s.CacheMisses)
+}
+
+// Upstream is a resolver queries are forwarded to
+type Upstream interface {
+	Exchange(ctx context.Context, query []byte, tcp bool) ([]byte, error)
+	String() string
+}
+
+// Forwarder is a caching DNS forwarder
+type Forwarder struct {
+	config    Config
+	upstreams []Upstream
+	fallbacks []Upstream
+	routes    []conditionalRoute
+	policies  map[string][]Upstream
+	static    staticZone
+	cache     *cache
+
+	mu    sync.Mutex
+	stats Stats
+
+	addrMu sync.Mutex
+	addr   net.Addr
+}
+
+// NewForwarder creates a forwarder from the given configuration
+func NewForwarder(cfg Config) (*Forwarder, error) {
+	if cfg.Listen == "" {
+		return nil, fmt.Errorf("listen address is required")
+	}
+	if len(cfg.Upstreams) == 0 {
+		return nil, fmt.Errorf("at least one upstream resolver is required")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.CacheSize == 0 {
+		cfg.CacheSize = defaultCacheSize
+	}
+
+	upstreams, err := parseUpstreams(cfg.Upstreams)
+	if err != nil {
+		return nil, err
+	}
+	fallbacks, err := parseUpstreams(cfg.Fallbacks)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := parseConditional(cfg.Conditional)
+	if err != nil {
+		return nil, err
+	}
+	policies, err := parsePolicies(cfg.Policies)
+	if err != nil {
+		return nil, err
+	}
+	static, err := newStaticZone(cfg.Records)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Forwarder{
+		config:    cfg,
+		upstreams: upstreams,
+		fallbacks: fallbacks,
+		routes:    routes,
+		policies:  policies,
+		static:    static,
+		cache:     newCache(cfg.CacheSize),
+		stats:     Stats{QueryTypes: make(map[string]uint64)},
+	}, nil
+}
+
+// parseUpstreams converts a list of upstream addresses
+func parseUpstreams(addrs []string) ([]Upstream, error) {
+	upstreams := make([]Upstream, 0, len(addrs))
+	for _, addr := range addrs {
+		upstream, err := ParseUpstream(addr)
+		if err != nil {
+			return nil, err
+		}
+		upstreams = append(upstreams, upstream)
+	}
+	return upstreams, nil
+}
+
+// parseConditional parses conditional forwards, most specific domain first
+func parseConditional(forwards []ConditionalForward) ([]conditionalRoute, error) {
+	routes := make([]conditionalRoute, 0, len(forwards))
+	for _, forward := range forwards {
+		domain := normalizeDomain(strings.TrimPrefix(forward.Domain, "*."))
+		if domain == "" || len(forward.Upstreams) == 0 {
+			return nil, fmt.Errorf("conditional forward for %q needs a domain and upstreams", forward.Domain)
+		}
+		upstreams, err := parseUpstreams(forward.Upstreams)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, conditionalRoute{domain: domain, upstreams: upstreams})
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		return strings.Count(routes[i].domain, ".") > strings.Count(routes[j].domain, ".")
+	})
+	return routes, nil
+}
+
+// route returns the conditional upstreams for name, or nil for the defaults
+func (f *Forwarder) route(name string) []Upstream {
+	name = normalizeDomain(name)
+	for _, r := range f.routes {
+		if name == r.domain || strings.HasSuffix(name, "."+r.domain) {
+			return r.upstreams
+		}
+	}
+	return nil
+}
+
+// ParseUpstream converts an upstream address into an Upstream. Addresses
+// may be an IP with optional port, an https:// DNS-over-HTTPS URL, the name
+// of a DoH provider in DoHProviders or a tls://host[:port][#servername]
+// DNS-over-TLS address.
+func ParseUpstream(addr string) (Upstream, error) {
+	if provider, ok := DoHProviders[strings.ToLower(addr)]; ok {
+		return newDoHUpstream(provider)
+	}
+	if strings.HasPrefix(addr, "tls://") {
+		return newDoTUpstream(addr)
+	}
+	if strings.Contains(addr, "://") {
+		return newDoHUpstream(addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, "53"
+	}
+	if net.ParseIP(host) == nil {
+		return nil, fmt.Errorf("invalid upstream resolver %q", addr)
+	}
+	return plainUpstream{addr: net.JoinHostPort(host, port)}, nil
+}
+
+// Addr returns the bound UDP address once the forwarder is serving
+func (f *Forwarder) Addr() net.Addr {
+	f.addrMu.Lock()
+	defer f.addrMu.Unlock()
+	return f.addr
+}
+
+// Stats returns a snapshot of the forwarder metrics
+func (f *Forwarder) Stats() Stats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := f.stats
+	stats.QueryTypes = make(map[string]uint64, len(f.stats.QueryTypes))
+	for name, count := range f.stats.QueryTypes {
+		stats.QueryTypes[name] = count
+	}
+	stats.CacheEntries = f.cache.len()
+	return stats
+}
+
+// ListenAndServe answers queries over UDP and TCP until ctx is cancelled
+func (f *Forwarder) ListenAndServe(ctx context.Context) error {
+	udp, err := net.ListenPacket("udp", f.config.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %w", f.config.Listen, err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		_ = udp.Close()
+		return fmt.Errorf("failed to listen on tcp %s: %w", f.config.Listen, err)
+	}
+
+	f.addrMu.Lock()
+	f.addr = udp.LocalAddr()
+	f.addrMu.Unlock()
+
+	errCh := make(chan error, 2)
+	go func() { errCh <- f.serveUDP(ctx, udp) }()
+	go func() { errCh <- f.serveTCP(ctx, tcp) }()
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-errCh:
+	}
+	_ = udp.Close()
+	_ = tcp.Close()
+	return err
+}
+
+func (f *Forwarder) serveUDP(ctx context.Context, conn net.PacketConn) error {
+	buf := make([]byte, 65535)
+	for {
+		n, client, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("udp read failed: %w", err)
+		}
+
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		go func() {
+			if resp := f.handle(ctx, query, client.String(), false); resp != nil {
+				_, _ = conn.WriteTo(resp, client)
+			}
+		}()
+	}
+}
+
+func (f *Forwarder) serveTCP(ctx context.Context, listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("tcp accept failed: %w", err)
+		}
+		go f.serveTCPConn(ctx, conn)
+	}
+}
+
+func (f *Forwarder) serveTCPConn(ctx context.Context, conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	for {
+		_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+		query, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+		resp := f.handle(ctx, query, conn.RemoteAddr().String(), true)
+		if resp == nil || writeTCPMessage(conn, resp) != nil {
+			return
+		}
+	}
+}
+
+// handle answers a single query from the local zone, the cache or an upstream
+func (f *Forwarder) handle(ctx context.Context, query []byte, client string, tcp bool) []byte {
+	start := time.Now()
+	q, err := parseQuestion(query)
+	if err != nil {
+		return nil
+	}
+
+	policy, upstreams := f.policy(client)
+	key := policyCacheKey(policy, q)
+	entry := QueryLog{
+		Time:   start,
+		Client: client,
+		Name:   q.name,
+		Type:   TypeName(q.qtype),
+		Policy: policy,
+	}
+
+	resp, ok := f.answerStatic(query, q)
+	if ok {
+		entry.Source = "local"
+	} else if resp, ok = f.answerBlocked(query, q, client); ok {
+		entry.Source = "blocked"
+	} else if resp, ok = f.answerLocal(query, q); ok {
+		entry.Source = "local"
+	} else if resp, ok = f.cache.get(key, query); ok {
+		entry.Source = "cache"
+	} else {
+		resp = f.forward(ctx, query, q, tcp, upstreams, &entry)
+		f.store(key, resp, q)
+	}
+
+	if entry.Source != "local" && entry.Source != "blocked" {
+		f.reportAnswer(q.name, resp)
+	}
+
+	entry.Rcode = rcode(resp)
+	entry.Duration = time.Since(start)
+	f.record(entry)
+	return resp
+}
+
+// reportAnswer passes the A and AAAA records of resp to OnAnswer
+func (f *Forwarder) reportAnswer(name string, resp []byte) {
+	if f.config.OnAnswer == nil || rcode(resp) != rcodeOK {
+		return
+	}
+	msg, err := ParseMessage(resp)
+	if err != nil {
+		return
+	}
+
+	var ips []net.IP
+	for _, record := range msg.Records {
+		if record.Type == "A" || record.Type == "AAAA" {
+			ips = append(ips, net.ParseIP(record.Value))
+		}
+	}
+	if len(ips) > 0 {
+		f.config.OnAnswer(normalizeDomain(name), ips)
+	}
+}
+
+// answerBlocked answers queries for blocked names with 0.0.0.0
+func (f *Forwarder) answerBlocked(query []byte, q question, client string) ([]byte, bool) {
+	if f.config.Blocklist == nil || !f.config.Blocklist.Blocked(client, q.name) {
+		return nil, false
+	}
+
+	resp := newResponse(query, q, rcodeOK, false)
+	if q.qtype == typeA {
+		resp = appendA(resp, net.IPv4zero, localTTL)
+	}
+	return resp, true
+}
+
+// inLocalZone reports whether name is answered from DHCP leases
+func (f *Forwarder) inLocalZone(name string) bool {
+	domain := normalizeDomain(f.config.LocalDomain)
+	return domain != "" && f.config.LocalLookup != nil && strings.HasSuffix(name, "."+domain)
+}
+
+// answerLocal answers queries for names in the local zone
+func (f *Forwarder) answerLocal(query []byte, q question) ([]byte, bool) {
+	name := normalizeDomain(q.name)
+	if !f.inLocalZone(name) {
+		return nil, false
+	}
+
+	ip := f.config.LocalLookup(name)
+	if ip == nil || ip.To4() == nil {
+		return newResponse(query, q, rcodeNX, true), true
+	}
+
+	resp := newResponse(query, q, rcodeOK, true)
+	if q.qtype == typeA {
+		resp = appendA(resp, ip, localTTL)
+	}
+	return resp, true
+}
+
+// forward sends the query to each upstream in turn, then to the fallbacks.
+// Names matching a conditional forward only go to that route's resolvers so
+// internal names never leak to public upstreams, and clients with a policy
+// only use the policy's upstreams, without fallbacks.
+func (f *Forwarder) forward(ctx context.Context, query []byte, q question, tcp bool, policy []Upstream, entry *QueryLog) []byte {
+	groups := []struct {
+		source    string
+		upstreams []Upstream
+	}{
+		{"upstream", f.upstreams},
+		{"fallback", f.fallbacks},
+	}
+	if routed := f.route(q.name); routed != nil {
+		groups = groups[:1]
+		groups[0].upstreams = routed
+	} else if policy != nil {
+		groups = groups[:1]
+		groups[0].upstreams = policy
+	}
+
+	for _, group := range groups {
+		for _, upstream := range group.upstreams {
+			qctx, cancel := context.WithTimeout(ctx, f.config.Timeout)
+			resp, err := upstream.Exchange(qctx, query, tcp)
+			cancel()
+			if err != nil || len(resp) < headerLen {
+				continue
+			}
+
+			entry.Source = group.source
+			entry.Upstream = upstream.String()
+			return resp
+		}
+	}
+
+	entry.Source = "error"
+	return newResponse(query, q, rcodeFail, false)
+}
+
+// store caches a successful or NXDOMAIN response under key for its
+// smallest TTL
+func (f *Forwarder) store(key string, resp []byte, q question) {
+	if truncated(resp) || (rcode(resp) != rcodeOK && rcode(resp) != rcodeNX) {
+		return
+	}
+
+	offsets, err := ttlOffsets(resp, q)
+	if err != nil {
+		return
+	}
+
+	ttl := negativeTTL
+	if lowest, ok := minTTL(resp, offsets); ok {
+		ttl = time.Duration(lowest) * time.Second
+	}
+	if ttl > maxCacheTTL {
+		ttl = maxCacheTTL
+	}
+	f.cache.put(key, resp, offsets, ttl)
+}
+
+// record updates the metrics and reports the query
+func (f *Forwarder) record(entry QueryLog) {
+	f.mu.Lock()
+	f.stats.Queries++
+	f.stats.QueryTypes[entry.Type]++
+	switch entry.Source {
+	case "cache":
+		f.stats.CacheHits++
+	case "local":
+		f.stats.LocalAnswers++
+	case "blocked":
+		f.stats.Blocked++
+	case "upstream", "fallback":
+		f.stats.CacheMisses++
+		f.stats.UpstreamTime += entry.Duration
+		if entry.Source == "fallback" {
+			f.stats.Fallbacks++
+		}
+	case "error":
+		f.stats.CacheMisses++
+		f.stats.UpstreamErrors++
+	}
+	f.mu.Unlock()
+
+	if f.config.OnQuery != nil {
+		f.config.OnQuery(entry)
+	}
+}
+
+// plainUpstream forwards queries over plain UDP or TCP port 53
+type plainUpstream struct {
+	addr string
+}
+
+func (u plainUpstream) String() string {
+	return u.addr
+}
+
+// Exchange sends the query and waits for the matching response
+func (u plainUpstream) Exchange(ctx context.Context, query []byte, tcp bool) ([]byte, error) {
+	network := "udp"
+	if tcp {
+		network = "tcp"
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, network, u.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if tcp {
+		if err := writeTCPMessage(conn, query); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray responses that don't match the query ID
+		if n >= headerLen && buf[0] == query[0] && buf[1] == query[1] {
+			resp := make([]byte, n)
+			copy(resp, buf[:n])
+			return resp, nil
+		}
+	}
+}
+
+// readTCPMessage reads a length-prefixed DNS message
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	if len(msg) < headerLen {
+		return nil, errors.New("short DNS message")
+	}
+	return msg, nil
+}
+
+// writeTCPMessage writes a length-prefixed DNS message
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf[0:2], uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
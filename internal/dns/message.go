@@ -0,0 +1,253 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// DNS constants used by the forwarder
+const (
+	headerLen = 12
+
+	typeA     uint16 = 1
+	typeCNAME uint16 = 5
+	typeAAAA  uint16 = 28
+	typeOPT   uint16 = 41
+	classIN   uint16 = 1
+	rcodeOK          = 0
+	rcodeFail        = 2
+	rcodeNX          = 3
+
+	maxLabelLen = 63  // bytes of a label, the rest of its length byte flags compression
+	maxNameLen  = 253 // bytes of a name in text form, 255 on the wire
+
+	flagQR uint16 = 1 << 15
+	flagAA uint16 = 1 << 10
+	flagTC uint16 = 1 << 9
+	flagRD uint16 = 1 << 8
+	flagRA uint16 = 1 << 7
+)
+
+var errMalformed = errors.New("malformed DNS message")
+
+var typeNames = map[uint16]string{
+	1: "A", 2: "NS", 5: "CNAME", 6: "SOA", 12: "PTR", 15: "MX", 16: "TXT",
+	28: "AAAA", 33: "SRV", 41: "OPT", 64: "SVCB", 65: "HTTPS", 255: "ANY",
+}
+
+// TypeName returns the mnemonic for a DNS record type
+func TypeName(qtype uint16) string {
+	if name, ok := typeNames[qtype]; ok {
+		return name
+	}
+	return fmt.Sprintf("TYPE%d", qtype)
+}
+
+// question is the first question of a DNS message
+type question struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+	end    int // offset just past the question section
+}
+
+// cacheKey identifies the question for caching
+func (q question) cacheKey() string {
+	return fmt.Sprintf("%s/%d/%d", strings.ToLower(q.name), q.qtype, q.qclass)
+}
+
+// parseQuestion reads the first question of a DNS message
+func parseQuestion(msg []byte) (question, error) {
+	if len(msg) < headerLen || binary.BigEndian.Uint16(msg[4:6]) == 0 {
+		return question{}, errMalformed
+	}
+
+	name, off, err := readName(msg, headerLen)
+	if err != nil {
+		return question{}, err
+	}
+	if off+4 > len(msg) {
+		return question{}, errMalformed
+	}
+
+	return question{
+		name:   name,
+		qtype:  binary.BigEndian.Uint16(msg[off : off+2]),
+		qclass: binary.BigEndian.Uint16(msg[off+2 : off+4]),
+		end:    off + 4,
+	}, nil
+}
+
+// readName decodes a possibly compressed domain name starting at off and
+// returns the name and the offset just past it
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errMalformed
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case length&0xC0 == 0xC0:
+			if off+1 >= len(msg) || jumps > 10 {
+				return "", 0, errMalformed
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:off+2]) & 0x3FFF)
+			jumps++
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
+
+// skipName returns the offset just past the name starting at off
+func skipName(msg []byte, off int) (int, error) {
+	_, next, err := readName(msg, off)
+	return next, err
+}
+
+// ttlOffsets returns the offsets of the TTL fields of every resource record
+// (except EDNS OPT pseudo-records) in a DNS response
+func ttlOffsets(msg []byte, q question) ([]int, error) {
+	count := int(binary.BigEndian.Uint16(msg[6:8])) +
+		int(binary.BigEndian.Uint16(msg[8:10])) +
+		int(binary.BigEndian.Uint16(msg[10:12]))
+
+	var offsets []int
+	off := q.end
+	for i := 0; i < count; i++ {
+		next, err := skipName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(msg) {
+			return nil, errMalformed
+		}
+		rrType := binary.BigEndian.Uint16(msg[next : next+2])
+		rdLen := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+		if rrType != typeOPT {
+			offsets = append(offsets, next+4)
+		}
+		off = next + 10 + rdLen
+		if off > len(msg) {
+			return nil, errMalformed
+		}
+	}
+	return offsets, nil
+}
+
+// minTTL returns the smallest TTL among the given record offsets
+func minTTL(msg []byte, offsets []int) (uint32, bool) {
+	if len(offsets) == 0 {
+		return 0, false
+	}
+	lowest := binary.BigEndian.Uint32(msg[offsets[0] : offsets[0]+4])
+	for _, off := range offsets[1:] {
+		if ttl := binary.BigEndian.Uint32(msg[off : off+4]); ttl < lowest {
+			lowest = ttl
+		}
+	}
+	return lowest, true
+}
+
+// rcode returns the response code of a DNS message
+func rcode(msg []byte) int {
+	return int(binary.BigEndian.Uint16(msg[2:4]) & 0x000F)
+}
+
+// truncated reports whether the TC bit is set
+func truncated(msg []byte) bool {
+	return binary.BigEndian.Uint16(msg[2:4])&flagTC != 0
+}
+
+// newResponse builds a response header and question echoing the query
+func newResponse(query []byte, q question, code int, authoritative bool) []byte {
+	resp := make([]byte, q.end, q.end+16)
+	copy(resp, query[:q.end])
+
+	flags := binary.BigEndian.Uint16(query[2:4])
+	flags = flagQR | (flags & 0x7800) | (flags & flagRD) | flagRA | uint16(code)
+	if authoritative {
+		flags |= flagAA
+	}
+	binary.BigEndian.PutUint16(resp[2:4], flags)
+	binary.BigEndian.PutUint16(resp[4:6], 1)
+	binary.BigEndian.PutUint16(resp[6:8], 0)
+	binary.BigEndian.PutUint16(resp[8:10], 0)
+	binary.BigEndian.PutUint16(resp[10:12], 0)
+	return resp
+}
+
+// questionName is a compression pointer to the question name at offset 12
+var questionName = []byte{0xC0, headerLen}
+
+// appendA appends an A record answering the question at offset 12
+func appendA(resp []byte, ip net.IP, ttl uint32) []byte {
+	return appendRR(resp, questionName, typeA, ttl, ip.To4())
+}
+
+// appendRR appends an answer record for the encoded owner name
+func appendRR(resp, owner []byte, rrType uint16, ttl uint32, rdata []byte) []byte {
+	rr := make([]byte, 10, 10+len(rdata))
+	binary.BigEndian.PutUint16(rr[0:2], rrType)
+	binary.BigEndian.PutUint16(rr[2:4], classIN)
+	binary.BigEndian.PutUint32(rr[4:8], ttl)
+	binary.BigEndian.PutUint16(rr[8:10], uint16(len(rdata)))
+
+	resp = append(resp, owner...)
+	resp = append(resp, rr...)
+	resp = append(resp, rdata...)
+	binary.BigEndian.PutUint16(resp[6:8], binary.BigEndian.Uint16(resp[6:8])+1)
+	return resp
+}
+
+// validateName checks that name, without its trailing dot, has no empty
+// labels and fits the length limits of the wire format
+func validateName(name string) error {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return fmt.Errorf("empty name")
+	}
+	if len(name) > maxNameLen {
+		return fmt.Errorf("name %.20q... is longer than %d bytes", name, maxNameLen)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" {
+			return fmt.Errorf("name %q has an empty label", name)
+		}
+		if len(label) > maxLabelLen {
+			return fmt.Errorf("label %.20q... of %q is longer than %d bytes", label, name, maxLabelLen)
+		}
+	}
+	return nil
+}
+
+// encodeName encodes a domain name in uncompressed wire format
+func encodeName(name string) ([]byte, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	var buf []byte
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0), nil
+}
@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// typeSRV is the service locator record type
+const typeSRV uint16 = 33
+
+// mdnsUnicastBit is the top bit of an mDNS question class, requesting a
+// unicast response (RFC 6762 section 5.4)
+const mdnsUnicastBit uint16 = 1 << 15
+
+// Question is a parsed DNS question
+type Question struct {
+	Name string
+	Type string
+}
+
+// Message lists the names in a DNS message. Records hold answer, authority
+// and additional records; Value is the address of A/AAAA records, the
+// target of PTR, CNAME and SRV records and empty otherwise.
+type Message struct {
+	Response  bool
+	Questions []Question
+	Records   []Record
+}
+
+// ParseMessage parses the questions and resource records of a DNS message
+func ParseMessage(msg []byte) (*Message, error) {
+	if len(msg) < headerLen {
+		return nil, errMalformed
+	}
+
+	m := &Message{Response: binary.BigEndian.Uint16(msg[2:4])&flagQR != 0}
+	off := headerLen
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:6])); i++ {
+		name, next, err := readName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return nil, errMalformed
+		}
+		m.Questions = append(m.Questions, Question{Name: name, Type: TypeName(binary.BigEndian.Uint16(msg[next : next+2]))})
+		off = next + 4
+	}
+
+	count := int(binary.BigEndian.Uint16(msg[6:8])) +
+		int(binary.BigEndian.Uint16(msg[8:10])) +
+		int(binary.BigEndian.Uint16(msg[10:12]))
+	for i := 0; i < count; i++ {
+		record, next, err := parseRecord(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		m.Records = append(m.Records, record)
+		off = next
+	}
+	return m, nil
+}
+
+// parseRecord parses the resource record at off and returns the offset
+// just past it
+func parseRecord(msg []byte, off int) (Record, int, error) {
+	name, next, err := readName(msg, off)
+	if err != nil || next+10 > len(msg) {
+		return Record{}, 0, errMalformed
+	}
+	rrType := binary.BigEndian.Uint16(msg[next : next+2])
+	rdLen := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+	rdata := next + 10
+	if rdata+rdLen > len(msg) {
+		return Record{}, 0, errMalformed
+	}
+
+	record := Record{Name: name, Type: TypeName(rrType)}
+	switch rrType {
+	case typeA, typeAAAA:
+		record.Value = net.IP(msg[rdata : rdata+rdLen]).String()
+	case typePTR, typeCNAME:
+		record.Value, _, err = readName(msg, rdata)
+	case typeSRV:
+		if rdLen > 6 {
+			record.Value, _, err = readName(msg, rdata+6)
+		}
+	}
+	if err != nil {
+		return Record{}, 0, err
+	}
+	return record, rdata + rdLen, nil
+}
+
+// ClearUnicastResponse clears the mDNS unicast-response bit of every
+// question so that answers are multicast
+func ClearUnicastResponse(msg []byte) error {
+	if len(msg) < headerLen {
+		return errMalformed
+	}
+	off := headerLen
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:6])); i++ {
+		next, err := skipName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return errMalformed
+		}
+		class := binary.BigEndian.Uint16(msg[next+2 : next+4])
+		binary.BigEndian.PutUint16(msg[next+2:next+4], class&^mdnsUnicastBit)
+		off = next + 4
+	}
+	return nil
+}
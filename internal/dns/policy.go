@@ -0,0 +1,54 @@
+package dns
+
+import (
+	"fmt"
+)
+
+// Policy sends the queries of a group of clients to their own resolvers,
+// e.g. a family-safe resolver for children's devices or the corporate DNS
+// for a work VM
+type Policy struct {
+	Name      string
+	Upstreams []string
+}
+
+// parsePolicies parses the policies' upstreams, keyed by policy name
+func parsePolicies(policies []Policy) (map[string][]Upstream, error) {
+	parsed := make(map[string][]Upstream, len(policies))
+	for _, policy := range policies {
+		if policy.Name == "" || len(policy.Upstreams) == 0 {
+			return nil, fmt.Errorf("DNS policy %q needs a name and upstreams", policy.Name)
+		}
+		if _, ok := parsed[policy.Name]; ok {
+			return nil, fmt.Errorf("duplicate DNS policy %q", policy.Name)
+		}
+		upstreams, err := parseUpstreams(policy.Upstreams)
+		if err != nil {
+			return nil, fmt.Errorf("DNS policy %q: %w", policy.Name, err)
+		}
+		parsed[policy.Name] = upstreams
+	}
+	return parsed, nil
+}
+
+// policy returns the name and upstreams of the client's policy, or "" and
+// nil for clients using the default upstreams
+func (f *Forwarder) policy(client string) (string, []Upstream) {
+	if f.config.PolicyFor == nil || len(f.policies) == 0 {
+		return "", nil
+	}
+	name := f.config.PolicyFor(clientIP(client))
+	if upstreams, ok := f.policies[name]; ok {
+		return name, upstreams
+	}
+	return "", nil
+}
+
+// policyCacheKey keeps the answers of each policy's resolvers apart in the
+// cache, since a filtering resolver answers differently
+func policyCacheKey(policy string, q question) string {
+	if policy == "" {
+		return q.cacheKey()
+	}
+	return policy + "|" + q.cacheKey()
+}
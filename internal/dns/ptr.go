@@ -0,0 +1,109 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+)
+
+// typePTR is the pointer record type used for reverse lookups
+const typePTR uint16 = 12
+
+// ReverseName returns the in-addr.arpa or ip6.arpa name of an IP address
+func ReverseName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0])
+	}
+
+	const hexDigits = "0123456789abcdef"
+	var b strings.Builder
+	v6 := ip.To16()
+	for i := len(v6) - 1; i >= 0; i-- {
+		b.WriteByte(hexDigits[v6[i]&0x0F])
+		b.WriteByte('.')
+		b.WriteByte(hexDigits[v6[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
+
+// LookupPTR sends a single reverse query for ip to server over UDP and
+// returns the first PTR target without its trailing dot. It is used for
+// unicast mDNS queries (server ip:5353), which the system resolver does not
+// make.
+func LookupPTR(ctx context.Context, server string, ip net.IP) (string, error) {
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address")
+	}
+
+	name, err := encodeName(ReverseName(ip))
+	if err != nil {
+		return "", err
+	}
+	query := make([]byte, headerLen, headerLen+64)
+	id := uint16(rand.Uint32()) // #nosec G404 -- query ID, not a secret
+	binary.BigEndian.PutUint16(query[0:2], id)
+	binary.BigEndian.PutUint16(query[4:6], 1)
+	query = append(query, name...)
+	query = binary.BigEndian.AppendUint16(query, typePTR)
+	query = binary.BigEndian.AppendUint16(query, classIN)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return "", err
+	}
+	resp := make([]byte, 65535)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return "", err
+		}
+		// Ignore stray responses that don't match the query ID
+		if n >= headerLen && binary.BigEndian.Uint16(resp[0:2]) == id {
+			return firstPTR(resp[:n])
+		}
+	}
+}
+
+// firstPTR returns the target of the first PTR answer in a response
+func firstPTR(msg []byte) (string, error) {
+	q, err := parseQuestion(msg)
+	if err != nil {
+		return "", err
+	}
+	if rcode(msg) != rcodeOK {
+		return "", fmt.Errorf("lookup failed with rcode %d", rcode(msg))
+	}
+
+	off := q.end
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[6:8])); i++ {
+		next, err := skipName(msg, off)
+		if err != nil {
+			return "", err
+		}
+		if next+10 > len(msg) {
+			return "", errMalformed
+		}
+		rrType := binary.BigEndian.Uint16(msg[next : next+2])
+		rdLen := int(binary.BigEndian.Uint16(msg[next+8 : next+10]))
+		if rrType == typePTR {
+			name, _, err := readName(msg, next+10)
+			return name, err
+		}
+		off = next + 10 + rdLen
+	}
+	return "", fmt.Errorf("no PTR record")
+}
@@ -0,0 +1,237 @@
+package dns
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often the query log drops entries past retention
+const pruneInterval = time.Hour
+
+// LoggedQuery is a query log entry as stored on disk
+type LoggedQuery struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"`           // client IP
+	Device   string    `json:"device,omitempty"` // device name when known
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Source   string    `json:"source"`
+	Policy   string    `json:"policy,omitempty"` // DNS policy of the client
+	Rcode    int       `json:"rcode"`
+	Duration float64   `json:"duration_ms"`
+}
+
+// NewLoggedQuery converts a forwarder query log entry, stripping the client
+// port
+func NewLoggedQuery(entry QueryLog, device string) LoggedQuery {
+	client := entry.Client
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	return LoggedQuery{
+		Time:     entry.Time,
+		Client:   client,
+		Device:   device,
+		Name:     entry.Name,
+		Type:     entry.Type,
+		Source:   entry.Source,
+		Policy:   entry.Policy,
+		Rcode:    entry.Rcode,
+		Duration: float64(entry.Duration.Microseconds()) / 1000,
+	}
+}
+
+// QueryLogWriter appends queries to a JSON Lines file and drops entries
+// older than the retention period
+type QueryLogWriter struct {
+	mu        sync.Mutex
+	path      string
+	retention time.Duration
+	file      *os.File
+	lastPrune time.Time
+}
+
+// OpenQueryLog opens the query log for appending, pruning expired entries
+func OpenQueryLog(path string, retention time.Duration) (*QueryLogWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create query log directory: %w", err)
+	}
+
+	w := &QueryLogWriter{path: path, retention: retention}
+	if err := w.prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends an entry
+func (w *QueryLogWriter) Write(entry LoggedQuery) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return fmt.Errorf("query log is closed")
+	}
+	if entry.Time.Sub(w.lastPrune) > pruneInterval {
+		if err := w.prune(entry.Time); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = w.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the log file
+func (w *QueryLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// prune rewrites the log without entries older than the retention period
+// and reopens it for appending. The caller must hold w.mu.
+func (w *QueryLogWriter) prune(now time.Time) error {
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+
+	if err := PruneQueryLog(w.path, now.Add(-w.retention)); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(w.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open query log: %w", err)
+	}
+	w.file = file
+	w.lastPrune = now
+	return nil
+}
+
+// PruneQueryLog removes entries logged before cutoff
+func PruneQueryLog(path string, cutoff time.Time) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open query log: %w", err)
+	}
+	entries, err := ReadQueryLog(file, func(q LoggedQuery) bool { return !q.Time.Before(cutoff) })
+	_ = file.Close()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".querylog-*")
+	if err != nil {
+		return fmt.Errorf("failed to prune query log: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	buf := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(buf)
+	for _, entry := range entries {
+		if err := enc.Encode(entry); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to prune query log: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to prune query log: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to prune query log: %w", err)
+	}
+	return nil
+}
+
+// ReadQueryLog reads query log entries accepted by keep (all if nil).
+// Malformed lines, such as a partially written last line, are skipped.
+func ReadQueryLog(r io.Reader, keep func(LoggedQuery) bool) ([]LoggedQuery, error) {
+	var entries []LoggedQuery
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var entry LoggedQuery
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if keep == nil || keep(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read query log: %w", err)
+	}
+	return entries, nil
+}
+
+// DomainCount is a domain's share of logged queries
+type DomainCount struct {
+	Name    string
+	Queries int
+	Blocked int
+	Clients int
+}
+
+// TopDomains returns the n most queried domains, most queried first
+func TopDomains(entries []LoggedQuery, n int) []DomainCount {
+	counts := make(map[string]*DomainCount)
+	clients := make(map[string]map[string]bool)
+	for _, entry := range entries {
+		name := strings.ToLower(entry.Name)
+		count, ok := counts[name]
+		if !ok {
+			count = &DomainCount{Name: name}
+			counts[name] = count
+			clients[name] = make(map[string]bool)
+		}
+		count.Queries++
+		if entry.Source == "blocked" {
+			count.Blocked++
+		}
+		clients[name][entry.Client] = true
+	}
+
+	result := make([]DomainCount, 0, len(counts))
+	for name, count := range counts {
+		count.Clients = len(clients[name])
+		result = append(result, *count)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Queries != result[j].Queries {
+			return result[i].Queries > result[j].Queries
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	if n > 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
@@ -0,0 +1,130 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Record is a static record answered authoritatively by the forwarder
+type Record struct {
+	Name  string
+	Type  string // A, AAAA or CNAME
+	Value string
+}
+
+// staticZone indexes static records by lower-cased name
+type staticZone map[string][]Record
+
+// newStaticZone validates records and indexes them by name
+func newStaticZone(records []Record) (staticZone, error) {
+	zone := make(staticZone, len(records))
+	for _, record := range records {
+		record.Name = normalizeDomain(record.Name)
+		record.Type = strings.ToUpper(record.Type)
+		if err := ValidateRecord(record); err != nil {
+			return nil, err
+		}
+		if record.Type == "CNAME" {
+			record.Value = normalizeDomain(record.Value)
+		}
+		zone[record.Name] = append(zone[record.Name], record)
+	}
+
+	for name, records := range zone {
+		for _, record := range records {
+			if record.Type == "CNAME" && len(records) > 1 {
+				return nil, fmt.Errorf("%s: a CNAME cannot be combined with other records", name)
+			}
+		}
+	}
+	return zone, nil
+}
+
+// ValidateRecords checks every static record and that no CNAME shares its
+// name with another record
+func ValidateRecords(records []Record) error {
+	_, err := newStaticZone(records)
+	return err
+}
+
+// ValidateRecord checks a static record's name, type and value
+func ValidateRecord(record Record) error {
+	name := normalizeDomain(record.Name)
+	if err := validateName(name); err != nil || strings.ContainsAny(name, " /\\") {
+		return fmt.Errorf("invalid record name %q", record.Name)
+	}
+
+	switch strings.ToUpper(record.Type) {
+	case "A":
+		if ip := net.ParseIP(record.Value); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("%s: A record needs an IPv4 address, got %q", name, record.Value)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(record.Value); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("%s: AAAA record needs an IPv6 address, got %q", name, record.Value)
+		}
+	case "CNAME":
+		target := normalizeDomain(record.Value)
+		if validateName(target) != nil || net.ParseIP(target) != nil || target == name {
+			return fmt.Errorf("%s: CNAME record needs a target name, got %q", name, record.Value)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported record type %q (A, AAAA or CNAME)", name, record.Type)
+	}
+	return nil
+}
+
+// appendRecords appends the records of qtype for name, returning whether
+// the name exists in the zone
+func (z staticZone) appendRecords(resp, owner []byte, name string, qtype uint16) ([]byte, bool) {
+	records, ok := z[name]
+	if !ok {
+		return resp, false
+	}
+	for _, record := range records {
+		switch {
+		case record.Type == "A" && qtype == typeA:
+			resp = appendRR(resp, owner, typeA, localTTL, net.ParseIP(record.Value).To4())
+		case record.Type == "AAAA" && qtype == typeAAAA:
+			resp = appendRR(resp, owner, typeAAAA, localTTL, net.ParseIP(record.Value).To16())
+		}
+	}
+	return resp, true
+}
+
+// answerStatic answers queries for names with static records. CNAMEs are
+// followed through the static and local zones; other targets are returned
+// for the client to resolve.
+func (f *Forwarder) answerStatic(query []byte, q question) ([]byte, bool) {
+	name := normalizeDomain(q.name)
+	records, ok := f.static[name]
+	if !ok {
+		return nil, false
+	}
+
+	resp := newResponse(query, q, rcodeOK, true)
+	if records[0].Type != "CNAME" {
+		resp, _ = f.static.appendRecords(resp, questionName, name, q.qtype)
+		return resp, true
+	}
+
+	// targets were validated with the zone, so they always encode
+	target := records[0].Value
+	owner, _ := encodeName(target)
+	resp = appendRR(resp, questionName, typeCNAME, localTTL, owner)
+	if q.qtype == typeCNAME {
+		return resp, true
+	}
+
+	// Follow one level of CNAME within locally known names
+	if chased, found := f.static.appendRecords(resp, owner, target, q.qtype); found {
+		return chased, true
+	}
+	if f.inLocalZone(target) && q.qtype == typeA {
+		if ip := f.config.LocalLookup(target); ip != nil && ip.To4() != nil {
+			resp = appendRR(resp, owner, typeA, localTTL, ip.To4())
+		}
+	}
+	return resp, true
+}
@@ -0,0 +1,87 @@
+// Package event passes notable events of an instance, such as NAT starting
+// or a device joining, to the sinks that announce them, such as webhooks
+package event
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	NATStarted    = "nat.started"
+	NATStopped    = "nat.stopped"
+	DeviceJoined  = "device.joined"
+	DeviceLeft    = "device.left"
+	WANIPChanged  = "wan.ip_changed"
+	WANDown       = "wan.down"
+	WANUp         = "wan.up"
+	QuotaExceeded = "quota.exceeded"
+	DHCPFailed    = "dhcp.failed"
+)
+
+// Types lists every event type
+var Types = []string{NATStarted, NATStopped, DeviceJoined, DeviceLeft, WANIPChanged, WANDown, WANUp, QuotaExceeded, DHCPFailed}
+
+// Event is a notable event of an instance
+type Event struct {
+	Type     string            `json:"event"`
+	Time     time.Time         `json:"time"`
+	Instance string            `json:"instance"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// Sink announces events
+type Sink interface {
+	// Send announces e without blocking the caller
+	Send(e Event)
+	// Close waits until the events sent are announced or ctx is done
+	Close(ctx context.Context) error
+}
+
+var (
+	mu    sync.Mutex
+	sinks []Sink
+)
+
+// Valid reports whether typ is a known event type
+func Valid(typ string) bool {
+	return slices.Contains(Types, typ)
+}
+
+// Register adds a sink receiving every event emitted from now on
+func Register(sink Sink) {
+	mu.Lock()
+	defer mu.Unlock()
+	sinks = append(sinks, sink)
+}
+
+// Emit passes e to every sink, stamping its time when unset
+func Emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, sink := range sinks {
+		sink.Send(e)
+	}
+}
+
+// Close closes and removes every sink, waiting until ctx is done for the
+// events sent to be announced
+func Close(ctx context.Context) error {
+	mu.Lock()
+	closing := sinks
+	sinks = nil
+	mu.Unlock()
+
+	var errs []error
+	for _, sink := range closing {
+		errs = append(errs, sink.Close(ctx))
+	}
+	return errors.Join(errs...)
+}
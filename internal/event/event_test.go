@@ -0,0 +1,46 @@
+package event
+
+import (
+	"context"
+	"testing"
+)
+
+// recorder is a sink remembering the events sent
+type recorder struct {
+	events []Event
+	closed bool
+}
+
+func (r *recorder) Send(e Event) {
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) Close(context.Context) error {
+	r.closed = true
+	return nil
+}
+
+func TestEmit(t *testing.T) {
+	Emit(Event{Type: NATStarted}) // no sinks yet
+
+	sink := &recorder{}
+	Register(sink)
+	Emit(Event{Type: NATStarted, Instance: "default"})
+	if len(sink.events) != 1 || sink.events[0].Time.IsZero() {
+		t.Fatalf("Expected a stamped event, got %+v", sink.events)
+	}
+
+	if err := Close(context.Background()); err != nil || !sink.closed {
+		t.Fatalf("Close = %v, closed %t", err, sink.closed)
+	}
+	Emit(Event{Type: NATStopped})
+	if len(sink.events) != 1 {
+		t.Error("Closed sinks should not receive events")
+	}
+}
+
+func TestValid(t *testing.T) {
+	if !Valid(DeviceJoined) || Valid("device.exploded") {
+		t.Error("Valid should accept known event types only")
+	}
+}
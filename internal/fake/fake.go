@@ -0,0 +1,245 @@
+// Package fake generates deterministic, realistic-looking devices, leases
+// and connections for demos, screenshots and load tests
+package fake
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Epoch is the fixed reference time used for generated data so that output
+// only depends on the seed
+var Epoch = time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// vendors pairs OUI prefixes with hostnames typical for that vendor
+var vendors = []struct {
+	oui   string
+	names []string
+}{
+	{"a4:83:e7", []string{"iphone", "macbook-pro", "ipad", "apple-tv", "macbook-air"}},
+	{"8c:77:12", []string{"galaxy-s23", "samsung-tv", "galaxy-tab"}},
+	{"b8:27:eb", []string{"raspberrypi", "pihole", "octopi"}},
+	{"f4:f5:d8", []string{"chromecast", "nest-hub", "pixel-8"}},
+	{"44:65:0d", []string{"echo-dot", "fire-tv", "kindle"}},
+	{"3c:a9:f4", []string{"thinkpad", "desktop", "nuc"}},
+	{"00:1b:63", []string{"printer", "nas", "camera"}},
+}
+
+// owners are prepended to some hostnames
+var owners = []string{"alice", "bob", "carol", "dave", "erin", "frank", "lab", "office"}
+
+// services are common destinations with their ports
+var services = []struct {
+	host  string
+	port  int
+	proto string
+}{
+	{"142.250.80.46", 443, "tcp"},
+	{"151.101.1.140", 443, "tcp"},
+	{"17.253.144.10", 443, "tcp"},
+	{"104.16.132.229", 443, "tcp"},
+	{"52.94.236.248", 443, "tcp"},
+	{"140.82.112.3", 22, "tcp"},
+	{"8.8.8.8", 53, "udp"},
+	{"1.1.1.1", 53, "udp"},
+	{"17.253.4.125", 123, "udp"},
+	{"93.184.216.34", 80, "tcp"},
+}
+
+// tcpStates is the lifecycle a generated TCP connection moves through
+var tcpStates = []string{"SYN_SENT", "ESTABLISHED", "FIN_WAIT_2", "TIME_WAIT"}
+
+// Generator produces fake data from a seeded random source. The same seed
+// and sequence of calls always yields the same data.
+type Generator struct {
+	rng     *rand.Rand
+	network string
+}
+
+// New creates a generator for the internal network prefix, e.g. 192.168.100
+func New(seed int64, network string) *Generator {
+	if network == "" {
+		network = "192.168.100"
+	}
+	return &Generator{
+		rng:     rand.New(rand.NewSource(seed)), // #nosec G404 -- deterministic fake data
+		network: network,
+	}
+}
+
+// Leases returns n DHCP leases with unique MACs and hostnames. IPs are
+// allocated from .100 and are unique for up to 155 leases.
+func (g *Generator) Leases(n int) []nat.Lease {
+	leases := make([]nat.Lease, 0, n)
+	usedNames := make(map[string]int)
+	usedMACs := make(map[string]bool)
+
+	for i := 0; i < n; i++ {
+		vendor := vendors[g.rng.Intn(len(vendors))]
+
+		mac := g.mac(vendor.oui)
+		for usedMACs[mac] {
+			mac = g.mac(vendor.oui)
+		}
+		usedMACs[mac] = true
+
+		hostname := vendor.names[g.rng.Intn(len(vendor.names))]
+		if g.rng.Intn(2) == 0 {
+			hostname = owners[g.rng.Intn(len(owners))] + "-" + hostname
+		}
+		if count := usedNames[hostname]; count > 0 {
+			usedNames[hostname]++
+			hostname = fmt.Sprintf("%s-%d", hostname, count+1)
+		} else {
+			usedNames[hostname] = 1
+		}
+		// Some devices never send a hostname
+		if g.rng.Intn(8) == 0 {
+			hostname = ""
+		}
+
+		leases = append(leases, nat.Lease{
+			Expiry:   Epoch.Add(time.Duration(g.rng.Intn(12*60)) * time.Minute),
+			MAC:      mac,
+			IP:       fmt.Sprintf("%s.%d", g.network, 100+i%155),
+			Hostname: hostname,
+			ClientID: "01:" + mac,
+		})
+	}
+	return leases
+}
+
+// Devices returns n connected devices built from generated leases
+func (g *Generator) Devices(n int) []nat.ConnectedDevice {
+	devices := make([]nat.ConnectedDevice, 0, n)
+	for _, lease := range g.Leases(n) {
+		devices = append(devices, nat.ConnectedDevice{
+			IP:        lease.IP,
+			MAC:       lease.MAC,
+			Hostname:  lease.Hostname,
+			LeaseTime: lease.Expiry.Sub(Epoch).String(),
+		})
+	}
+	return devices
+}
+
+// Connections returns n connections originating from the given devices
+func (g *Generator) Connections(devices []nat.ConnectedDevice, n int) []nat.Connection {
+	conns := make([]nat.Connection, 0, n)
+	for i := 0; i < n; i++ {
+		conns = append(conns, g.connection(devices))
+	}
+	return conns
+}
+
+// Step advances a connection table by one tick: connections progress
+// through their states, some close and new ones open, keeping roughly the
+// same table size
+func (g *Generator) Step(devices []nat.ConnectedDevice, conns []nat.Connection) []nat.Connection {
+	next := make([]nat.Connection, 0, len(conns))
+	for _, conn := range conns {
+		if g.rng.Intn(10) == 0 {
+			continue
+		}
+		// Established connections usually stay open for a while
+		if conn.Protocol == "tcp" && (conn.State != "ESTABLISHED" || g.rng.Intn(4) == 0) {
+			conn.State = nextTCPState(conn.State)
+			if conn.State == "" {
+				continue
+			}
+		}
+		next = append(next, conn)
+	}
+
+	for len(next) < len(conns) {
+		next = append(next, g.connection(devices))
+	}
+	return next
+}
+
+// Status returns a plausible active NAT status for the devices and connections
+func (g *Generator) Status(devices []nat.ConnectedDevice, conns []nat.Connection) *nat.Status {
+	uptime := time.Duration(g.rng.Intn(72*60)) * time.Minute
+	return &nat.Status{
+		Active:            true,
+		Running:           true,
+		ExternalIP:        fmt.Sprintf("10.0.%d.%d", g.rng.Intn(255), 2+g.rng.Intn(250)),
+		Uptime:            uptime.String(),
+		ConnectedDevices:  devices,
+		ActiveConnections: conns,
+		BytesIn:           uint64(g.rng.Int63n(50 << 30)),
+		BytesOut:          uint64(g.rng.Int63n(5 << 30)),
+		IPForwarding:      true,
+		PFCTLEnabled:      true,
+		DHCPRunning:       true,
+	}
+}
+
+// WriteLeaseFile writes leases in dnsmasq lease file format
+func WriteLeaseFile(w io.Writer, leases []nat.Lease) error {
+	sorted := make([]nat.Lease, len(leases))
+	copy(sorted, leases)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Expiry.Before(sorted[j].Expiry) })
+
+	for _, lease := range sorted {
+		hostname, clientID := lease.Hostname, lease.ClientID
+		if hostname == "" {
+			hostname = "*"
+		}
+		if clientID == "" {
+			clientID = "*"
+		}
+		expiry := int64(0)
+		if !lease.Expiry.IsZero() {
+			expiry = lease.Expiry.Unix()
+		}
+		if _, err := fmt.Fprintf(w, "%d %s %s %s %s\n", expiry, lease.MAC, lease.IP, hostname, clientID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connection returns a single new connection from a random device
+func (g *Generator) connection(devices []nat.ConnectedDevice) nat.Connection {
+	source := fmt.Sprintf("%s.%d", g.network, 100+g.rng.Intn(100))
+	if len(devices) > 0 {
+		source = devices[g.rng.Intn(len(devices))].IP
+	}
+	service := services[g.rng.Intn(len(services))]
+
+	state := ""
+	if service.proto == "tcp" {
+		state = tcpStates[g.rng.Intn(2)]
+	}
+
+	return nat.Connection{
+		Source:      fmt.Sprintf("%s:%d", source, 49152+g.rng.Intn(16384)),
+		Destination: fmt.Sprintf("%s:%d", service.host, service.port),
+		Protocol:    service.proto,
+		State:       state,
+	}
+}
+
+// mac returns a random MAC address with the given OUI
+func (g *Generator) mac(oui string) string {
+	return fmt.Sprintf("%s:%02x:%02x:%02x", oui, g.rng.Intn(256), g.rng.Intn(256), g.rng.Intn(256))
+}
+
+// nextTCPState returns the state after current, or "" once the connection is gone
+func nextTCPState(current string) string {
+	for i, state := range tcpStates {
+		if state == current {
+			if i+1 < len(tcpStates) {
+				return tcpStates[i+1]
+			}
+			return ""
+		}
+	}
+	return "ESTABLISHED"
+}
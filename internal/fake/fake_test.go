@@ -0,0 +1,117 @@
+package fake
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+func TestGeneratorIsDeterministic(t *testing.T) {
+	first := New(42, "192.168.100")
+	second := New(42, "192.168.100")
+
+	devicesA, devicesB := first.Devices(20), second.Devices(20)
+	if !reflect.DeepEqual(devicesA, devicesB) {
+		t.Error("Same seed should produce the same devices")
+	}
+
+	connsA, connsB := first.Connections(devicesA, 50), second.Connections(devicesB, 50)
+	if !reflect.DeepEqual(connsA, connsB) {
+		t.Error("Same seed should produce the same connections")
+	}
+
+	if !reflect.DeepEqual(first.Step(devicesA, connsA), second.Step(devicesB, connsB)) {
+		t.Error("Same seed should produce the same connection stream")
+	}
+
+	if reflect.DeepEqual(New(7, "192.168.100").Devices(20), devicesA) {
+		t.Error("Different seeds should produce different devices")
+	}
+}
+
+func TestLeasesAreUnique(t *testing.T) {
+	leases := New(1, "10.10.0").Leases(100)
+	if len(leases) != 100 {
+		t.Fatalf("Expected 100 leases, got %d", len(leases))
+	}
+
+	ips := make(map[string]bool)
+	macs := make(map[string]bool)
+	names := make(map[string]bool)
+	for _, lease := range leases {
+		if !strings.HasPrefix(lease.IP, "10.10.0.") {
+			t.Errorf("Lease IP %s outside network", lease.IP)
+		}
+		if ips[lease.IP] || macs[lease.MAC] {
+			t.Errorf("Duplicate lease %s/%s", lease.IP, lease.MAC)
+		}
+		if lease.Hostname != "" && names[lease.Hostname] {
+			t.Errorf("Duplicate hostname %s", lease.Hostname)
+		}
+		ips[lease.IP], macs[lease.MAC], names[lease.Hostname] = true, true, true
+	}
+}
+
+func TestWriteLeaseFileRoundTrip(t *testing.T) {
+	leases := New(3, "").Leases(10)
+
+	var buf bytes.Buffer
+	if err := WriteLeaseFile(&buf, leases); err != nil {
+		t.Fatalf("WriteLeaseFile failed: %v", err)
+	}
+
+	parsed, err := nat.ParseLeases(&buf)
+	if err != nil {
+		t.Fatalf("ParseLeases failed: %v", err)
+	}
+	if len(parsed) != len(leases) {
+		t.Fatalf("Expected %d leases, got %d", len(leases), len(parsed))
+	}
+
+	byMAC := make(map[string]nat.Lease)
+	for _, lease := range parsed {
+		byMAC[lease.MAC] = lease
+	}
+	for _, lease := range leases {
+		got := byMAC[lease.MAC]
+		if got.IP != lease.IP || got.Hostname != lease.Hostname || !got.Expiry.Equal(lease.Expiry) {
+			t.Errorf("Lease %s did not round-trip: %+v", lease.MAC, got)
+		}
+	}
+}
+
+func TestStepKeepsTableSize(t *testing.T) {
+	g := New(9, "")
+	devices := g.Devices(5)
+	conns := g.Connections(devices, 40)
+
+	for i := 0; i < 20; i++ {
+		conns = g.Step(devices, conns)
+		if len(conns) != 40 {
+			t.Fatalf("Step %d changed table size to %d", i, len(conns))
+		}
+		for _, conn := range conns {
+			if conn.Protocol == "udp" && conn.State != "" {
+				t.Errorf("UDP connection should have no state, got %s", conn.State)
+			}
+		}
+	}
+}
+
+func TestNextTCPState(t *testing.T) {
+	testCases := map[string]string{
+		"SYN_SENT":    "ESTABLISHED",
+		"ESTABLISHED": "FIN_WAIT_2",
+		"FIN_WAIT_2":  "TIME_WAIT",
+		"TIME_WAIT":   "",
+		"":            "ESTABLISHED",
+	}
+	for current, expected := range testCases {
+		if got := nextTCPState(current); got != expected {
+			t.Errorf("nextTCPState(%q) = %q, expected %q", current, got, expected)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package fingerprint guesses what kind of device is behind a DHCP lease
+// from the options it requested, its vendor class and the OUI of its MAC
+package fingerprint
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Observation is what a device revealed about itself in its DHCP requests
+type Observation struct {
+	MAC         string    `json:"mac"`
+	Hostname    string    `json:"hostname,omitempty"`
+	VendorClass string    `json:"vendor_class,omitempty"` // option 60
+	Options     string    `json:"options,omitempty"`      // option 55, comma separated
+	Seen        time.Time `json:"seen"`
+}
+
+// Operating systems recognized from DHCP requests
+const (
+	osIOS      = "iOS"
+	osMacOS    = "macOS"
+	osWindows  = "Windows"
+	osAndroid  = "Android"
+	osLinux    = "Linux"
+	osEmbedded = "lwIP"
+)
+
+// knownOptions maps parameter request lists to the operating systems known
+// to send them
+var knownOptions = map[string]string{
+	"1,121,3,6,15,119,252":                         osIOS,
+	"1,121,3,6,15,108,114,119,252":                 osIOS,
+	"1,121,3,6,15,119,252,95,44,46":                osMacOS,
+	"1,121,3,6,15,108,114,119,252,95,44,46":        osMacOS,
+	"1,3,6,15,31,33,43,44,46,47,119,121,249,252":   osWindows,
+	"1,3,6,15,26,28,51,58,59,43":                   osAndroid,
+	"1,3,6,15,26,28,51,58,59,43,114,108":           osAndroid,
+	"1,121,33,3,6,12,15,28,42,51,54,58,59,119":     osLinux,
+	"1,28,2,3,15,6,119,12,44,47,26,121,42":         osLinux,
+	"1,3,28,6":                                     osEmbedded,
+	"1,3,28,6,15,44,46,47,31,33,121,43":            osEmbedded,
+	"1,28,2,3,15,6,12,40,41,42,26,119,121,252,249": osLinux,
+}
+
+// vendorPrefixes maps vendor class prefixes to operating systems
+var vendorPrefixes = []struct {
+	prefix string
+	os     string
+}{
+	{"msft", osWindows},
+	{"android-dhcp", osAndroid},
+	{"dhcpcd", osLinux},
+	{"udhcp", osLinux},
+	{"linux", osLinux},
+}
+
+// ouis maps MAC prefixes to hardware vendors of interest
+var ouis = map[string]string{
+	"b8:27:eb": "Raspberry Pi", "dc:a6:32": "Raspberry Pi", "e4:5f:01": "Raspberry Pi",
+	"d8:3a:dd": "Raspberry Pi", "28:cd:c1": "Raspberry Pi", "2c:cf:67": "Raspberry Pi",
+	"24:0a:c4": "Espressif", "24:6f:28": "Espressif", "30:ae:a4": "Espressif",
+	"3c:71:bf": "Espressif", "7c:9e:bd": "Espressif", "84:0d:8e": "Espressif",
+	"8c:aa:b5": "Espressif", "a4:cf:12": "Espressif", "bc:dd:c2": "Espressif",
+	"c4:4f:33": "Espressif", "cc:50:e3": "Espressif", "ec:fa:bc": "Espressif",
+	"5c:cf:7f": "Espressif", "60:01:94": "Espressif", "18:fe:34": "Espressif",
+	"00:50:56": "VMware", "00:0c:29": "VMware", "00:05:69": "VMware",
+	"00:1c:42": "Parallels", "52:54:00": "QEMU", "08:00:27": "VirtualBox",
+	"00:15:5d": "Hyper-V", "00:16:3e": "Xen",
+	"00:80:77": "Brother", "00:1b:a9": "Brother", "00:26:ab": "Epson", "64:eb:8c": "Epson",
+	"00:1e:8f": "Canon", "00:40:8c": "Axis", "ac:cc:8e": "Axis", "b8:a4:4f": "Axis",
+	"44:19:b6": "Hikvision", "c0:56:e3": "Hikvision", "bc:ad:28": "Hikvision",
+	"3c:ef:8c": "Dahua", "90:02:a9": "Dahua",
+}
+
+// Device classes recognized from the vendor or hostname
+const (
+	classPrinter = "Printer"
+	classCamera  = "Camera"
+)
+
+// classVendors are the OUI vendors making only one class of device
+var classVendors = map[string]string{
+	"Brother": classPrinter, "Epson": classPrinter, "Canon": classPrinter,
+	"Axis": classCamera, "Hikvision": classCamera, "Dahua": classCamera,
+}
+
+// hostnamePrefixes maps the hostnames devices pick by default to their class
+var hostnamePrefixes = []struct {
+	prefix string
+	class  string
+}{
+	{"brw", classPrinter},
+	{"brn", classPrinter},
+	{"epson", classPrinter},
+	{"npi", classPrinter},
+	{"ipc", classCamera},
+	{"axis-", classCamera},
+}
+
+// hypervisors are the OUI vendors of virtual network adapters
+var hypervisors = map[string]bool{
+	"VMware": true, "Parallels": true, "QEMU": true, "VirtualBox": true, "Hyper-V": true, "Xen": true,
+}
+
+// Vendor returns the hardware vendor of a MAC address, "private" for
+// randomized (locally administered) addresses and "" when unknown
+func Vendor(mac string) string {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) < 3 {
+		return ""
+	}
+	if vendor, ok := ouis[strings.ToLower(hw[:3].String())]; ok {
+		return vendor
+	}
+	if hw[0]&0x02 != 0 {
+		return "private"
+	}
+	return ""
+}
+
+// detectOS guesses the operating system from the DHCP request
+func detectOS(obs Observation) string {
+	vendorClass := strings.ToLower(obs.VendorClass)
+	for _, v := range vendorPrefixes {
+		if strings.HasPrefix(vendorClass, v.prefix) {
+			return v.os
+		}
+	}
+	return knownOptions[strings.ReplaceAll(obs.Options, " ", "")]
+}
+
+// detectClass recognizes printers and cameras from their vendor, default
+// hostname or vendor class
+func detectClass(vendor string, obs Observation) string {
+	if class, ok := classVendors[vendor]; ok {
+		return class
+	}
+	hostname := strings.ToLower(obs.Hostname)
+	for _, h := range hostnamePrefixes {
+		if strings.HasPrefix(hostname, h.prefix) {
+			return h.class
+		}
+	}
+	if strings.Contains(strings.ToLower(obs.VendorClass), "jetdirect") {
+		return classPrinter
+	}
+	return ""
+}
+
+// Classify returns a short description of the device, such as "iPhone/iPad",
+// "Raspberry Pi", "Printer" or "Windows VM", or "" when nothing is recognized
+func Classify(obs Observation) string {
+	vendor := Vendor(obs.MAC)
+	if class := detectClass(vendor, obs); class != "" {
+		return class
+	}
+	system := detectOS(obs)
+
+	switch {
+	case vendor == "Raspberry Pi":
+		return vendor
+	case vendor == "Espressif":
+		return "ESP32/ESP8266"
+	case hypervisors[vendor] && system != "" && system != osEmbedded:
+		return system + " VM"
+	case hypervisors[vendor]:
+		return "VM (" + vendor + ")"
+	}
+
+	switch system {
+	case osIOS:
+		return "iPhone/iPad"
+	case osMacOS:
+		return "Mac"
+	case osWindows:
+		return "Windows PC"
+	case osEmbedded:
+		return "Embedded device"
+	}
+	return system
+}
+
+// Load reads the observations recorded in path, keyed by lowercase MAC. A
+// missing file yields no observations.
+func Load(path string) (map[string]Observation, error) {
+	observations := make(map[string]Observation)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return observations, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fingerprints: %w", err)
+	}
+	if err := json.Unmarshal(data, &observations); err != nil {
+		return nil, fmt.Errorf("failed to parse fingerprints: %w", err)
+	}
+	return observations, nil
+}
+
+// Record merges an observation into path. Fields the device did not send
+// this time keep their previous values, since renewals and lease replays
+// often carry less detail than the initial request.
+func Record(path string, obs Observation) error {
+	observations, err := Load(path)
+	if err != nil {
+		return err
+	}
+
+	key := strings.ToLower(obs.MAC)
+	previous := observations[key]
+	if obs.Hostname == "" {
+		obs.Hostname = previous.Hostname
+	}
+	if obs.VendorClass == "" {
+		obs.VendorClass = previous.VendorClass
+	}
+	if obs.Options == "" {
+		obs.Options = previous.Options
+	}
+	if obs.Seen.IsZero() {
+		obs.Seen = time.Now()
+	}
+	obs.MAC = key
+	observations[key] = obs
+
+	data, err := json.MarshalIndent(observations, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create fingerprint directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write fingerprints: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write fingerprints: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package fingerprint
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	testCases := []struct {
+		name     string
+		obs      Observation
+		expected string
+	}{
+		{"iPhone", Observation{MAC: "3a:12:9f:00:00:01", Options: "1,121,3,6,15,108,114,119,252"}, "iPhone/iPad"},
+		{"Mac", Observation{MAC: "f0:18:98:00:00:01", Options: "1,121,3,6,15,119,252,95,44,46"}, "Mac"},
+		{"Windows by vendor class", Observation{MAC: "f0:de:f1:00:00:01", VendorClass: "MSFT 5.0"}, "Windows PC"},
+		{"Windows VM", Observation{MAC: "00:0c:29:12:34:56", VendorClass: "MSFT 5.0"}, "Windows VM"},
+		{"Linux VM", Observation{MAC: "52:54:00:12:34:56", VendorClass: "dhcpcd-10.0.6:Linux-6.8.0"}, "Linux VM"},
+		{"unknown VM", Observation{MAC: "08:00:27:12:34:56"}, "VM (VirtualBox)"},
+		{"Raspberry Pi", Observation{MAC: "DC:A6:32:01:02:03", VendorClass: "dhcpcd-9.4.1:Linux-6.1.21-v8+:aarch64:BCM2835"}, "Raspberry Pi"},
+		{"ESP32", Observation{MAC: "24:0a:c4:01:02:03", Options: "1,3,28,6"}, "ESP32/ESP8266"},
+		{"lwIP board", Observation{MAC: "00:11:22:33:44:55", Options: "1, 3, 28, 6"}, "Embedded device"},
+		{"Android", Observation{MAC: "ba:11:22:33:44:55", VendorClass: "android-dhcp-14"}, "Android"},
+		{"Brother printer", Observation{MAC: "00:80:77:12:34:56", Options: "1,3,28,6"}, "Printer"},
+		{"printer by hostname", Observation{MAC: "00:11:22:33:44:55", Hostname: "BRW0080771234"}, "Printer"},
+		{"JetDirect printer", Observation{MAC: "00:11:22:33:44:55", VendorClass: "Hewlett-Packard JetDirect"}, "Printer"},
+		{"Hikvision camera", Observation{MAC: "44:19:B6:01:02:03"}, "Camera"},
+		{"camera by hostname", Observation{MAC: "00:11:22:33:44:55", Hostname: "IPC-front-door"}, "Camera"},
+		{"unknown", Observation{MAC: "00:11:22:33:44:55", Options: "1,2,3"}, ""},
+	}
+
+	for _, tc := range testCases {
+		if got := Classify(tc.obs); got != tc.expected {
+			t.Errorf("%s: Classify() = %q, expected %q", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestVendor(t *testing.T) {
+	testCases := map[string]string{
+		"b8:27:eb:00:00:01": "Raspberry Pi",
+		"00:50:56:00:00:01": "VMware",
+		"3a:12:9f:00:00:01": "private",
+		"00:11:22:33:44:55": "",
+		"not-a-mac":         "",
+	}
+	for mac, expected := range testCases {
+		if got := Vendor(mac); got != expected {
+			t.Errorf("Vendor(%q) = %q, expected %q", mac, got, expected)
+		}
+	}
+}
+
+func TestRecordMerges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fingerprints.json")
+
+	initial := Observation{MAC: "AA:BB:CC:DD:EE:FF", Hostname: "laptop", VendorClass: "MSFT 5.0", Options: "1,3,6"}
+	if err := Record(path, initial); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	// A lease replay without request details keeps what was learned before
+	if err := Record(path, Observation{MAC: "aa:bb:cc:dd:ee:ff"}); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	observations, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	got, ok := observations["aa:bb:cc:dd:ee:ff"]
+	if !ok || got.VendorClass != "MSFT 5.0" || got.Options != "1,3,6" || got.Hostname != "laptop" {
+		t.Errorf("Expected merged observation, got %+v", observations)
+	}
+	if got.Seen.IsZero() {
+		t.Error("Record should stamp when the device was seen")
+	}
+
+	if missing, err := Load(filepath.Join(t.TempDir(), "missing.json")); err != nil || len(missing) != 0 {
+		t.Errorf("Missing file should load as empty, got %v, %v", missing, err)
+	}
+}
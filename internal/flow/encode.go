@@ -0,0 +1,166 @@
+package flow
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// templateID is the ID of the template of the records, the first one free
+// for data sets
+const templateID = 256
+
+// recordsPerPacket keeps packets below a common MTU
+const recordsPerPacket = 24
+
+// Information elements of the records, with the IDs IANA assigned for
+// IPFIX, which NetFlow v9 shares
+const (
+	octetDeltaCount             = 1
+	packetDeltaCount            = 2
+	protocolIdentifier          = 4
+	sourceTransportPort         = 7
+	sourceIPv4Address           = 8
+	destinationTransportPort    = 11
+	destinationIPv4Address      = 12
+	lastSwitched                = 21 // NetFlow v9, milliseconds of system uptime
+	firstSwitched               = 22
+	flowStartMilliseconds       = 152 // IPFIX
+	flowEndMilliseconds         = 153
+	postNATSourceIPv4Address    = 225
+	postNAPTSourceTransportPort = 227
+)
+
+// field is an information element of the template and its length
+type field struct {
+	id     uint16
+	length uint16
+}
+
+// Encoder writes flow records as NetFlow v9 or IPFIX packets. Every packet
+// carries the template, so collectors decode the records whenever they
+// start listening.
+type Encoder struct {
+	ipfix    bool
+	domain   uint32
+	boot     time.Time // system uptime 0 of NetFlow v9
+	sequence uint32    // packets sent for NetFlow v9, records for IPFIX
+	fields   []field
+}
+
+// NewEncoder returns an encoder for protocol, IPFIX or NetFlow9, with
+// observation domain or source ID domain, started at boot
+func NewEncoder(protocol string, domain uint32, boot time.Time) *Encoder {
+	e := &Encoder{ipfix: protocol != NetFlow9, domain: domain, boot: boot}
+	e.fields = []field{
+		{sourceIPv4Address, 4},
+		{sourceTransportPort, 2},
+		{postNATSourceIPv4Address, 4},
+		{postNAPTSourceTransportPort, 2},
+		{destinationIPv4Address, 4},
+		{destinationTransportPort, 2},
+		{protocolIdentifier, 1},
+		{octetDeltaCount, 8},
+		{packetDeltaCount, 8},
+	}
+	if e.ipfix {
+		e.fields = append(e.fields, field{flowStartMilliseconds, 8}, field{flowEndMilliseconds, 8})
+	} else {
+		e.fields = append(e.fields, field{firstSwitched, 4}, field{lastSwitched, 4})
+	}
+	return e
+}
+
+// Encode returns the packets carrying records, none without records
+func (e *Encoder) Encode(now time.Time, records []Record) [][]byte {
+	var packets [][]byte
+	for len(records) > 0 {
+		n := min(len(records), recordsPerPacket)
+		packets = append(packets, e.packet(now, records[:n]))
+		records = records[n:]
+	}
+	return packets
+}
+
+// packet returns a packet of the template and records
+func (e *Encoder) packet(now time.Time, records []Record) []byte {
+	headerLength := 20
+	if e.ipfix {
+		headerLength = 16
+	}
+	packet := make([]byte, headerLength, 1500)
+	packet = e.appendTemplate(packet)
+	packet = e.appendData(packet, records)
+
+	if e.ipfix {
+		binary.BigEndian.PutUint16(packet[0:], 10)
+		binary.BigEndian.PutUint16(packet[2:], uint16(len(packet)))
+		binary.BigEndian.PutUint32(packet[4:], uint32(now.Unix()))
+		binary.BigEndian.PutUint32(packet[8:], e.sequence)
+		binary.BigEndian.PutUint32(packet[12:], e.domain)
+		e.sequence += uint32(len(records))
+	} else {
+		binary.BigEndian.PutUint16(packet[0:], 9)
+		binary.BigEndian.PutUint16(packet[2:], uint16(1+len(records))) // the template and the records
+		binary.BigEndian.PutUint32(packet[4:], e.uptime(now))
+		binary.BigEndian.PutUint32(packet[8:], uint32(now.Unix()))
+		binary.BigEndian.PutUint32(packet[12:], e.sequence)
+		binary.BigEndian.PutUint32(packet[16:], e.domain)
+		e.sequence++
+	}
+	return packet
+}
+
+// appendTemplate appends the template set
+func (e *Encoder) appendTemplate(packet []byte) []byte {
+	setID := uint16(0)
+	if e.ipfix {
+		setID = 2
+	}
+	packet = binary.BigEndian.AppendUint16(packet, setID)
+	packet = binary.BigEndian.AppendUint16(packet, uint16(8+4*len(e.fields)))
+	packet = binary.BigEndian.AppendUint16(packet, templateID)
+	packet = binary.BigEndian.AppendUint16(packet, uint16(len(e.fields)))
+	for _, f := range e.fields {
+		packet = binary.BigEndian.AppendUint16(packet, f.id)
+		packet = binary.BigEndian.AppendUint16(packet, f.length)
+	}
+	return packet
+}
+
+// appendData appends the data set of records, padded to four bytes
+func (e *Encoder) appendData(packet []byte, records []Record) []byte {
+	start := len(packet)
+	packet = binary.BigEndian.AppendUint16(packet, templateID)
+	packet = binary.BigEndian.AppendUint16(packet, 0) // length, set below
+	for _, r := range records {
+		packet = append(packet, r.Source.Addr().AsSlice()...)
+		packet = binary.BigEndian.AppendUint16(packet, r.Source.Port())
+		packet = append(packet, r.Translated.Addr().AsSlice()...)
+		packet = binary.BigEndian.AppendUint16(packet, r.Translated.Port())
+		packet = append(packet, r.Destination.Addr().AsSlice()...)
+		packet = binary.BigEndian.AppendUint16(packet, r.Destination.Port())
+		packet = append(packet, r.Protocol)
+		packet = binary.BigEndian.AppendUint64(packet, r.Bytes)
+		packet = binary.BigEndian.AppendUint64(packet, r.Packets)
+		if e.ipfix {
+			packet = binary.BigEndian.AppendUint64(packet, uint64(r.Start.UnixMilli()))
+			packet = binary.BigEndian.AppendUint64(packet, uint64(r.End.UnixMilli()))
+		} else {
+			packet = binary.BigEndian.AppendUint32(packet, e.uptime(r.Start))
+			packet = binary.BigEndian.AppendUint32(packet, e.uptime(r.End))
+		}
+	}
+	for (len(packet)-start)%4 != 0 {
+		packet = append(packet, 0)
+	}
+	binary.BigEndian.PutUint16(packet[start+2:], uint16(len(packet)-start))
+	return packet
+}
+
+// uptime returns the milliseconds from boot to t, 0 for times before boot
+func (e *Encoder) uptime(t time.Time) uint32 {
+	if t.Before(e.boot) {
+		return 0
+	}
+	return uint32(t.Sub(e.boot).Milliseconds())
+}
@@ -0,0 +1,270 @@
+// Package flow exports the NAT sessions of an instance, read from the pf
+// state table, as NetFlow v9 or IPFIX flow records to a collector
+package flow
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Protocols of the export
+const (
+	IPFIX    = "ipfix"
+	NetFlow9 = "netflow9"
+)
+
+// Protocols lists the export protocols
+var Protocols = []string{IPFIX, NetFlow9}
+
+// Defaults of Options
+const (
+	DefaultInterval      = 10 * time.Second
+	DefaultActiveTimeout = time.Minute
+	DefaultIPFIXPort     = "4739"
+	DefaultNetFlowPort   = "2055"
+)
+
+// ipProtocols maps the protocols pf names to their IP protocol numbers
+var ipProtocols = map[string]uint8{"ICMP": 1, "IGMP": 2, "TCP": 6, "UDP": 17, "GRE": 47, "ESP": 50, "AH": 51, "SCTP": 132}
+
+// Options configures an exporter
+type Options struct {
+	Collector     string        // host[:port], the protocol's port by default
+	Protocol      string        // IPFIX if empty
+	Interval      time.Duration // how often the states are read, DefaultInterval if 0
+	ActiveTimeout time.Duration // how often long flows are reported, DefaultActiveTimeout if 0
+	Domain        uint32        // observation domain or source ID
+}
+
+// withDefaults returns o with its unset fields defaulted
+func (o Options) withDefaults() Options {
+	if o.Protocol == "" {
+		o.Protocol = IPFIX
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	if o.ActiveTimeout <= 0 {
+		o.ActiveTimeout = DefaultActiveTimeout
+	}
+	return o
+}
+
+// CollectorAddr returns the host:port of a collector given as host or
+// host:port, with the default port of protocol
+func CollectorAddr(collector, protocol string) (string, error) {
+	port := DefaultIPFIXPort
+	if protocol == NetFlow9 {
+		port = DefaultNetFlowPort
+	}
+	host := collector
+	if h, p, err := net.SplitHostPort(collector); err == nil {
+		host, port = h, p
+	}
+	n, err := strconv.Atoi(port)
+	invalidHost := host == "" || strings.ContainsAny(host, "/ ") || strings.Contains(host, ":") && net.ParseIP(host) == nil
+	if invalidHost || err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid collector %q (e.g. 10.0.0.5:%s)", collector, port)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Record is a flow reported to the collector: the traffic of a pf state
+// between Start and End
+type Record struct {
+	Protocol    uint8
+	Source      netip.AddrPort // internal address
+	Translated  netip.AddrPort // source after NAT, Source when not translated
+	Destination netip.AddrPort
+	Bytes       uint64 // both directions
+	Packets     uint64
+	Start       time.Time
+	End         time.Time
+}
+
+// Duration returns how long the record covers
+func (r Record) Duration() time.Duration {
+	return r.End.Sub(r.Start)
+}
+
+// recordOf returns the flow of an IPv4 connection from the pf state table
+func recordOf(c nat.Connection) (Record, bool) {
+	protocol, ok := ipProtocols[c.Protocol]
+	if !ok {
+		return Record{}, false
+	}
+	source, err1 := netip.ParseAddrPort(c.Source)
+	destination, err2 := netip.ParseAddrPort(c.Destination)
+	if err1 != nil || err2 != nil || !source.Addr().Is4() || !destination.Addr().Is4() {
+		return Record{}, false
+	}
+	translated := source
+	if c.Translated != "" {
+		if t, err := netip.ParseAddrPort(c.Translated); err == nil && t.Addr().Is4() {
+			translated = t
+		}
+	}
+	return Record{Protocol: protocol, Source: source, Translated: translated, Destination: destination,
+		Bytes: c.Bytes, Packets: c.Packets}, true
+}
+
+// key identifies the flow of a record
+func (r Record) key() string {
+	return fmt.Sprintf("%d %s %s %s", r.Protocol, r.Source, r.Translated, r.Destination)
+}
+
+// tracked is a flow between reads of the state table
+type tracked struct {
+	record   Record    // counters and times so far
+	reported Record    // counters when last reported
+	since    time.Time // start of the traffic not reported yet
+}
+
+// Tracker turns successive reads of the state table into flow records: a
+// record when a state goes away and, for states living longer than the
+// active timeout, a record of their traffic every active timeout
+type Tracker struct {
+	activeTimeout time.Duration
+	flows         map[string]*tracked
+}
+
+// NewTracker returns a tracker reporting long flows every activeTimeout
+func NewTracker(activeTimeout time.Duration) *Tracker {
+	return &Tracker{activeTimeout: activeTimeout, flows: make(map[string]*tracked)}
+}
+
+// Update reads the connections at now and returns the records due
+func (t *Tracker) Update(now time.Time, connections []nat.Connection) []Record {
+	var records []Record
+	seen := make(map[string]bool)
+	for _, c := range connections {
+		record, ok := recordOf(c)
+		if !ok {
+			continue
+		}
+		key := record.key()
+		seen[key] = true
+		flow := t.flows[key]
+		if flow != nil && (record.Bytes < flow.record.Bytes || record.Packets < flow.record.Packets) {
+			// A new state replaced the one reported
+			records = appendDelta(records, flow)
+			flow = nil
+		}
+		if flow == nil {
+			start := now.Add(-c.Age)
+			flow = &tracked{since: start}
+			flow.record.Start = start
+			t.flows[key] = flow
+		}
+		record.Start, record.End = flow.record.Start, now
+		flow.record = record
+		if now.Sub(flow.since) >= t.activeTimeout {
+			records = appendDelta(records, flow)
+		}
+	}
+	for key, flow := range t.flows {
+		if !seen[key] {
+			records = appendDelta(records, flow)
+			delete(t.flows, key)
+		}
+	}
+	return records
+}
+
+// Flush returns the records of every flow, as if all had ended
+func (t *Tracker) Flush() []Record {
+	var records []Record
+	for key, flow := range t.flows {
+		records = appendDelta(records, flow)
+		delete(t.flows, key)
+	}
+	return records
+}
+
+// appendDelta appends the traffic of flow since it was last reported, if
+// any, and marks it reported
+func appendDelta(records []Record, flow *tracked) []Record {
+	record := flow.record
+	record.Bytes -= flow.reported.Bytes
+	record.Packets -= flow.reported.Packets
+	record.Start = flow.since
+	flow.reported, flow.since = flow.record, flow.record.End
+	if record.Bytes == 0 && record.Packets == 0 {
+		return records
+	}
+	return append(records, record)
+}
+
+// Exporter sends the flows of the states read to a collector over UDP
+type Exporter struct {
+	opts    Options
+	conn    net.Conn
+	tracker *Tracker
+	encoder *Encoder
+}
+
+// Dial returns an exporter sending to the collector of opts
+func Dial(opts Options) (*Exporter, error) {
+	opts = opts.withDefaults()
+	addr, err := CollectorAddr(opts.Collector, opts.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to collector: %w", err)
+	}
+	return &Exporter{
+		opts:    opts,
+		conn:    conn,
+		tracker: NewTracker(opts.ActiveTimeout),
+		encoder: NewEncoder(opts.Protocol, opts.Domain, time.Now()),
+	}, nil
+}
+
+// Export reads connections at now and sends the records due
+func (e *Exporter) Export(now time.Time, connections []nat.Connection) error {
+	return e.send(now, e.tracker.Update(now, connections))
+}
+
+// send writes records to the collector
+func (e *Exporter) send(now time.Time, records []Record) error {
+	for _, packet := range e.encoder.Encode(now, records) {
+		if _, err := e.conn.Write(packet); err != nil {
+			return fmt.Errorf("failed to send flows: %w", err)
+		}
+	}
+	return nil
+}
+
+// Run exports the connections of read every interval until ctx is done,
+// then reports the flows still open, passing errors to onError
+func (e *Exporter) Run(ctx context.Context, read func() []nat.Connection, onError func(error)) {
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := e.Export(time.Now(), read()); err != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			if err := e.send(time.Now(), e.tracker.Flush()); err != nil {
+				onError(err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close closes the connection to the collector
+func (e *Exporter) Close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,213 @@
+package flow
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+func TestCollectorAddr(t *testing.T) {
+	testCases := []struct {
+		collector, protocol, want string
+	}{
+		{"10.0.0.5", IPFIX, "10.0.0.5:4739"},
+		{"10.0.0.5", NetFlow9, "10.0.0.5:2055"},
+		{"collector.example.com:9995", IPFIX, "collector.example.com:9995"},
+		{"fd00::5", IPFIX, "[fd00::5]:4739"},
+		{"[fd00::5]:2055", NetFlow9, "[fd00::5]:2055"},
+		{"", IPFIX, ""},
+		{"udp://10.0.0.5", IPFIX, ""},
+		{"10.0.0.5:99999", IPFIX, ""},
+	}
+	for _, tc := range testCases {
+		got, err := CollectorAddr(tc.collector, tc.protocol)
+		if err != nil {
+			got = ""
+		}
+		if got != tc.want {
+			t.Errorf("CollectorAddr(%q, %s) = %q, %v, want %q", tc.collector, tc.protocol, got, err, tc.want)
+		}
+	}
+}
+
+// connection returns the translated TCP state of 192.168.100.10:52345 to
+// 93.184.216.34:443 with its counters
+func connection(bytes, packets uint64, age time.Duration) nat.Connection {
+	return nat.Connection{Protocol: "TCP", Source: "192.168.100.10:52345", Translated: "192.168.1.5:61000",
+		Destination: "93.184.216.34:443", Bytes: bytes, Packets: packets, Age: age}
+}
+
+func TestTracker(t *testing.T) {
+	tracker := NewTracker(time.Minute)
+	start := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	local := nat.Connection{Protocol: "UDP", Source: "192.168.100.9:5353", Destination: "192.168.100.1:53", Bytes: 180, Packets: 2}
+	ignored := []nat.Connection{
+		{Protocol: "TCP", Source: "fd00::10[443]", Destination: "fd00::1[80]"},
+		{Protocol: "PFSYNC", Source: "192.168.100.9:0", Destination: "192.168.100.1:0"},
+	}
+
+	if records := tracker.Update(start, append([]nat.Connection{connection(1000, 10, 0), local}, ignored...)); len(records) != 0 {
+		t.Fatalf("new flows reported before they end: %+v", records)
+	}
+	if records := tracker.Update(start.Add(10*time.Second), []nat.Connection{connection(3000, 30, 10*time.Second)}); len(records) != 1 {
+		t.Fatalf("expected the ended local flow, got %+v", records)
+	} else if r := records[0]; r.Protocol != 17 || r.Bytes != 180 || r.Translated != r.Source || r.Start != start || r.End != start {
+		t.Errorf("unexpected local record %+v", r)
+	}
+
+	records := tracker.Update(start.Add(time.Minute), []nat.Connection{connection(5000, 50, time.Minute)})
+	if len(records) != 1 {
+		t.Fatalf("expected the active timeout record, got %+v", records)
+	}
+	r := records[0]
+	want := Record{
+		Protocol:    6,
+		Source:      netip.MustParseAddrPort("192.168.100.10:52345"),
+		Translated:  netip.MustParseAddrPort("192.168.1.5:61000"),
+		Destination: netip.MustParseAddrPort("93.184.216.34:443"),
+		Bytes:       5000,
+		Packets:     50,
+		Start:       start,
+		End:         start.Add(time.Minute),
+	}
+	if r != want {
+		t.Errorf("record = %+v, want %+v", r, want)
+	}
+
+	tracker.Update(start.Add(70*time.Second), []nat.Connection{connection(6000, 60, 70*time.Second)})
+	records = tracker.Update(start.Add(80*time.Second), nil)
+	if len(records) != 1 || records[0].Bytes != 1000 || records[0].Packets != 10 ||
+		records[0].Start != start.Add(time.Minute) || records[0].Duration() != 10*time.Second {
+		t.Errorf("expected the rest of the ended flow, got %+v", records)
+	}
+
+	tracker.Update(start, []nat.Connection{connection(1000, 10, 0)})
+	tracker.Update(start.Add(10*time.Second), []nat.Connection{connection(200, 2, time.Second)})
+	records = tracker.Flush()
+	if len(records) != 1 || records[0].Bytes != 200 {
+		t.Errorf("expected the replacing state on flush, got %+v", records)
+	}
+}
+
+func TestEncodeIPFIX(t *testing.T) {
+	start := time.UnixMilli(1_792_240_000_000)
+	record := Record{
+		Protocol:    6,
+		Source:      netip.MustParseAddrPort("192.168.100.10:52345"),
+		Translated:  netip.MustParseAddrPort("192.168.1.5:61000"),
+		Destination: netip.MustParseAddrPort("93.184.216.34:443"),
+		Bytes:       5000,
+		Packets:     50,
+		Start:       start,
+		End:         start.Add(time.Minute),
+	}
+	encoder := NewEncoder(IPFIX, 7, start)
+	records := slices.Repeat([]Record{record}, recordsPerPacket+1)
+	packets := encoder.Encode(start.Add(time.Minute), records)
+	if len(packets) != 2 {
+		t.Fatalf("expected 2 packets, got %d", len(packets))
+	}
+
+	p := packets[0]
+	if binary.BigEndian.Uint16(p[0:]) != 10 || int(binary.BigEndian.Uint16(p[2:])) != len(p) ||
+		binary.BigEndian.Uint32(p[8:]) != 0 || binary.BigEndian.Uint32(p[12:]) != 7 {
+		t.Errorf("unexpected header % x", p[:16])
+	}
+	if len(p) > 1400 {
+		t.Errorf("packet of %d bytes is too large", len(p))
+	}
+	template := p[16:]
+	if binary.BigEndian.Uint16(template[0:]) != 2 || binary.BigEndian.Uint16(template[4:]) != templateID ||
+		binary.BigEndian.Uint16(template[6:]) != 11 || binary.BigEndian.Uint16(template[8:]) != sourceIPv4Address {
+		t.Errorf("unexpected template % x", template[:12])
+	}
+	data := template[binary.BigEndian.Uint16(template[2:]):]
+	if binary.BigEndian.Uint16(data[0:]) != templateID || int(binary.BigEndian.Uint16(data[2:])) != len(data) {
+		t.Errorf("unexpected data set header % x", data[:4])
+	}
+	first := data[4 : 4+51]
+	if !slices.Equal(first[0:4], []byte{192, 168, 100, 10}) || binary.BigEndian.Uint16(first[4:]) != 52345 ||
+		!slices.Equal(first[6:10], []byte{192, 168, 1, 5}) || binary.BigEndian.Uint16(first[10:]) != 61000 ||
+		!slices.Equal(first[12:16], []byte{93, 184, 216, 34}) || binary.BigEndian.Uint16(first[16:]) != 443 ||
+		first[18] != 6 || binary.BigEndian.Uint64(first[19:]) != 5000 || binary.BigEndian.Uint64(first[27:]) != 50 ||
+		binary.BigEndian.Uint64(first[35:]) != uint64(start.UnixMilli()) || binary.BigEndian.Uint64(first[43:]) != uint64(start.Add(time.Minute).UnixMilli()) {
+		t.Errorf("unexpected record % x", first)
+	}
+	if seq := binary.BigEndian.Uint32(packets[1][8:]); seq != recordsPerPacket {
+		t.Errorf("second packet sequence = %d, want %d", seq, recordsPerPacket)
+	}
+}
+
+func TestEncodeNetFlow9(t *testing.T) {
+	boot := time.UnixMilli(1_792_240_000_000)
+	record := Record{
+		Protocol:    17,
+		Source:      netip.MustParseAddrPort("192.168.100.9:5353"),
+		Translated:  netip.MustParseAddrPort("192.168.1.5:5353"),
+		Destination: netip.MustParseAddrPort("1.1.1.1:53"),
+		Bytes:       180,
+		Packets:     2,
+		Start:       boot.Add(-time.Second),
+		End:         boot.Add(1500 * time.Millisecond),
+	}
+	encoder := NewEncoder(NetFlow9, 3, boot)
+	packets := encoder.Encode(boot.Add(2*time.Second), []Record{record})
+	packets = append(packets, encoder.Encode(boot.Add(3*time.Second), []Record{record})...)
+	if len(packets) != 2 {
+		t.Fatalf("expected 2 packets, got %d", len(packets))
+	}
+
+	p := packets[0]
+	if binary.BigEndian.Uint16(p[0:]) != 9 || binary.BigEndian.Uint16(p[2:]) != 2 || binary.BigEndian.Uint32(p[4:]) != 2000 ||
+		binary.BigEndian.Uint32(p[12:]) != 0 || binary.BigEndian.Uint32(p[16:]) != 3 {
+		t.Errorf("unexpected header % x", p[:20])
+	}
+	if seq := binary.BigEndian.Uint32(packets[1][12:]); seq != 1 {
+		t.Errorf("second packet sequence = %d, want 1", seq)
+	}
+	template := p[20:]
+	if binary.BigEndian.Uint16(template[0:]) != 0 || binary.BigEndian.Uint16(template[6:]) != 11 {
+		t.Errorf("unexpected template % x", template[:8])
+	}
+	data := template[binary.BigEndian.Uint16(template[2:]):]
+	if len(data)%4 != 0 || int(binary.BigEndian.Uint16(data[2:])) != len(data) {
+		t.Errorf("data set of %d bytes is not padded", len(data))
+	}
+	first := data[4:]
+	if binary.BigEndian.Uint32(first[35:]) != 0 || binary.BigEndian.Uint32(first[39:]) != 1500 {
+		t.Errorf("switched times = %d, %d, want 0, 1500", binary.BigEndian.Uint32(first[35:]), binary.BigEndian.Uint32(first[39:]))
+	}
+}
+
+func TestExporter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	exporter, err := Dial(Options{Collector: conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = exporter.Close() }()
+	now := time.Now()
+	if err := exporter.Export(now, []nat.Connection{connection(1000, 10, 2*time.Minute)}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	buf := make([]byte, 1500)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if binary.BigEndian.Uint16(buf[0:]) != 10 || int(binary.BigEndian.Uint16(buf[2:])) != n {
+		t.Errorf("unexpected packet % x", buf[:n])
+	}
+}
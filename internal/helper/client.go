@@ -0,0 +1,168 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Client talks to a helper over its socket. It implements api.Controller.
+type Client struct {
+	http *http.Client
+}
+
+var _ api.Controller = (*Client)(nil)
+
+// NewClient returns a client of the helper listening on socket
+func NewClient(socket string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport, Timeout: time.Minute}}
+}
+
+// Available reports whether a helper listens on socket and lets the
+// current user connect
+func Available(socket string) bool {
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// remoteError is an error answered by the helper. It matches the error
+// kinds the REST API maps to status codes.
+type remoteError struct {
+	status  int
+	message string
+}
+
+func (e *remoteError) Error() string {
+	return e.message
+}
+
+// Is reports whether the helper answered with the status of target
+func (e *remoteError) Is(target error) bool {
+	switch target {
+	case api.ErrInvalid:
+		return e.status == http.StatusBadRequest
+	case api.ErrNotFound:
+		return e.status == http.StatusNotFound
+	case nat.ErrNotRunning:
+		return e.status == http.StatusConflict && e.message == nat.ErrNotRunning.Error()
+	case nat.ErrConflict:
+		return e.status == http.StatusConflict && e.message != nat.ErrNotRunning.Error()
+	}
+	return false
+}
+
+// do sends a request to the REST endpoint path and decodes the answer into
+// out when set
+func (c *Client) do(method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://helper"+api.RESTPrefix+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the helper: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil || answer.Error == "" {
+			answer.Error = resp.Status
+		}
+		return &remoteError{status: resp.StatusCode, message: answer.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode helper response: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) Status() (*nat.Status, error) {
+	var status nat.Status
+	if err := c.do(http.MethodGet, "status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *Client) Devices() ([]nat.Device, error) {
+	var devices []nat.Device
+	return devices, c.do(http.MethodGet, "devices", nil, &devices)
+}
+
+func (c *Client) Connections() ([]nat.Connection, error) {
+	var connections []nat.Connection
+	return connections, c.do(http.MethodGet, "connections", nil, &connections)
+}
+
+func (c *Client) KillConnections(ip string) (int, error) {
+	var result api.KillResult
+	return result.Killed, c.do(http.MethodDelete, "connections/"+url.PathEscape(ip), nil, &result)
+}
+
+func (c *Client) Forwards() ([]config.PortForward, error) {
+	var forwards []config.PortForward
+	return forwards, c.do(http.MethodGet, "forwards", nil, &forwards)
+}
+
+func (c *Client) AddForward(forward config.PortForward) error {
+	return c.do(http.MethodPost, "forwards", forward, nil)
+}
+
+func (c *Client) RemoveForward(externalPort int) error {
+	return c.do(http.MethodDelete, "forwards/"+strconv.Itoa(externalPort), nil, nil)
+}
+
+func (c *Client) Start() (*nat.Status, error) {
+	var status nat.Status
+	if err := c.do(http.MethodPost, "start", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+func (c *Client) Stop() (*nat.Status, error) {
+	var status nat.Status
+	if err := c.do(http.MethodPost, "stop", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
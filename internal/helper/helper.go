@@ -0,0 +1,210 @@
+// Package helper serves the REST API on a Unix domain socket from a
+// privileged helper, so that the CLI and TUI can monitor and control NAT
+// without root. Only root and members of one group may connect.
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// DefaultGroup is the group whose members may use the helper besides root
+const DefaultGroup = "admin"
+
+// ErrUnsupported is returned where peer credentials cannot be read
+var ErrUnsupported = errors.New("peer credentials are not supported on this platform")
+
+// SocketPath returns the socket of an instance's helper
+func SocketPath(instance string) string {
+	if instance == "" || instance == nat.DefaultInstance {
+		return "/var/run/nat-manager.sock"
+	}
+	return "/var/run/nat-manager-" + instance + ".sock"
+}
+
+// Config configures the helper server
+type Config struct {
+	Socket string     // path of the socket
+	Group  string     // group allowed besides root, defaults to DefaultGroup
+	Audit  *audit.Log // records every request when set
+}
+
+// credentials identify the process at the other end of a connection
+type credentials struct {
+	UID    int
+	Groups []int
+}
+
+// permitted reports whether the peer is root or a member of gid
+func (c credentials) permitted(gid int) bool {
+	return c.UID == 0 || slices.Contains(c.Groups, gid)
+}
+
+// Server serves a Controller on a Unix domain socket
+type Server struct {
+	socket  string
+	gid     int
+	handler http.Handler
+	audit   *audit.Log
+
+	// credentials reads the peer credentials of a connection
+	credentials func(net.Conn) (credentials, error)
+}
+
+// New returns a helper server serving ctrl
+func New(ctrl api.Controller, cfg Config) (*Server, error) {
+	name := cfg.Group
+	if name == "" {
+		name = DefaultGroup
+	}
+	group, err := user.LookupGroup(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up group %s: %w", name, err)
+	}
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid %q of group %s", group.Gid, name)
+	}
+	return &Server{
+		socket:      cfg.Socket,
+		gid:         gid,
+		handler:     api.RESTHandler(ctrl),
+		audit:       cfg.Audit,
+		credentials: peerCredentials,
+	}, nil
+}
+
+// Listen creates the socket, readable and writable by root and the group
+// only, replacing a stale socket left by a helper that died
+func (s *Server) Listen() (net.Listener, error) {
+	if conn, err := net.DialTimeout("unix", s.socket, time.Second); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("a helper is already listening on %s", s.socket)
+	}
+	if err := os.Remove(s.socket); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+	listener, err := net.Listen("unix", s.socket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.socket, err)
+	}
+	if err := os.Chown(s.socket, -1, s.gid); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set group of %s: %w", s.socket, err)
+	}
+	if err := os.Chmod(s.socket, 0660); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to set permissions of %s: %w", s.socket, err)
+	}
+	return &peerListener{Listener: listener, server: s}, nil
+}
+
+// Serve serves requests on listener until ctx is cancelled
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{
+		Handler:           s.audited(s.handler),
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			if peer, ok := conn.(*peerConn); ok {
+				return context.WithValue(ctx, credentialsKey{}, peer.cred)
+			}
+			return ctx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// credentialsKey is the context key of the peer credentials of a request
+type credentialsKey struct{}
+
+// peerListener only accepts connections from permitted peers
+type peerListener struct {
+	net.Listener
+	server *Server
+}
+
+// peerConn is an accepted connection and the credentials of its peer
+type peerConn struct {
+	net.Conn
+	cred credentials
+}
+
+// Accept returns the next connection from a permitted peer, closing the
+// others
+func (l *peerListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		cred, err := l.server.credentials(conn)
+		if err == nil && cred.permitted(l.server.gid) {
+			return &peerConn{Conn: conn, cred: cred}, nil
+		}
+		_ = conn.Close()
+
+		who, detail := "unknown", ""
+		if err != nil {
+			detail = err.Error()
+		} else {
+			who = actor(cred.UID)
+		}
+		l.server.record(who, "connect", "denied", detail)
+	}
+}
+
+// audited records which user called which endpoint and how it was answered
+func (s *Server) audited(next http.Handler) http.Handler {
+	if s.audit == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := api.NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		cred, _ := r.Context().Value(credentialsKey{}).(credentials)
+		s.record(actor(cred.UID), r.Method+" "+r.URL.Path, fmt.Sprint(rec.Status), "")
+	})
+}
+
+// record adds a helper request to the audit log
+func (s *Server) record(who, action, result, detail string) {
+	_ = s.audit.Record(audit.Entry{
+		Source: audit.SourceAPI,
+		Actor:  who,
+		Action: "helper " + action,
+		Result: result,
+		Detail: detail,
+	})
+}
+
+// actor names the user of uid for the audit log
+func actor(uid int) string {
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+	return "uid " + strconv.Itoa(uid)
+}
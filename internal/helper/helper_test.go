@@ -0,0 +1,218 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+func TestSocketPath(t *testing.T) {
+	if got := SocketPath(nat.DefaultInstance); got != "/var/run/nat-manager.sock" {
+		t.Errorf("SocketPath(default) = %s", got)
+	}
+	if got := SocketPath("lab"); got != "/var/run/nat-manager-lab.sock" {
+		t.Errorf("SocketPath(lab) = %s", got)
+	}
+}
+
+func TestPermitted(t *testing.T) {
+	testCases := []struct {
+		cred     credentials
+		expected bool
+	}{
+		{credentials{UID: 0}, true},
+		{credentials{UID: 501, Groups: []int{20, 80}}, true},
+		{credentials{UID: 501, Groups: []int{20}}, false},
+		{credentials{UID: 502}, false},
+	}
+	for _, tc := range testCases {
+		if got := tc.cred.permitted(80); got != tc.expected {
+			t.Errorf("%+v permitted = %t, expected %t", tc.cred, got, tc.expected)
+		}
+	}
+}
+
+// stubController serves fixed data and records changes
+type stubController struct {
+	forwards []config.PortForward
+	running  bool
+}
+
+func (c *stubController) Status() (*nat.Status, error) {
+	return &nat.Status{Active: c.running, ExternalIP: "192.0.2.10"}, nil
+}
+
+func (c *stubController) Devices() ([]nat.Device, error) {
+	return []nat.Device{{IP: "192.168.100.10", MAC: "aa:bb:cc:dd:ee:ff"}}, nil
+}
+
+func (c *stubController) Connections() ([]nat.Connection, error) {
+	return []nat.Connection{}, nil
+}
+
+func (c *stubController) KillConnections(ip string) (int, error) {
+	if ip != "192.168.100.10" {
+		return 0, fmt.Errorf("%w: %q is not a device", api.ErrInvalid, ip)
+	}
+	return 3, nil
+}
+
+func (c *stubController) Forwards() ([]config.PortForward, error) {
+	return c.forwards, nil
+}
+
+func (c *stubController) AddForward(forward config.PortForward) error {
+	c.forwards = append(c.forwards, forward)
+	return nil
+}
+
+func (c *stubController) RemoveForward(port int) error {
+	for i, f := range c.forwards {
+		if f.ExternalPort == port {
+			c.forwards = append(c.forwards[:i], c.forwards[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: no port forward for port %d", api.ErrNotFound, port)
+}
+
+func (c *stubController) Start() (*nat.Status, error) {
+	if c.running {
+		return nil, nat.ErrAlreadyRunning
+	}
+	c.running = true
+	return c.Status()
+}
+
+func (c *stubController) Stop() (*nat.Status, error) {
+	if !c.running {
+		return nil, nat.ErrNotRunning
+	}
+	c.running = false
+	return c.Status()
+}
+
+// startServer serves ctrl on a socket in a temporary directory, with peer
+// credentials given by cred
+func startServer(t *testing.T, ctrl api.Controller, log *audit.Log, cred credentials) string {
+	t.Helper()
+	current, err := user.Current()
+	if err != nil {
+		t.Fatalf("Failed to get current user: %v", err)
+	}
+	group, err := user.LookupGroupId(current.Gid)
+	if err != nil {
+		t.Skipf("Primary group unknown: %v", err)
+	}
+	// Socket paths are limited to about 100 bytes, too short for t.TempDir
+	dir, err := os.MkdirTemp("", "nmh")
+	if err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "helper.sock")
+
+	server, err := New(ctrl, Config{Socket: socket, Group: group.Name, Audit: log})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	server.credentials = func(net.Conn) (credentials, error) { return cred, nil }
+	listener, err := server.Listen()
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = server.Serve(ctx, listener) }()
+
+	info, err := os.Stat(socket)
+	if err != nil || info.Mode().Perm() != 0660 {
+		t.Fatalf("Socket mode = %v, %v", info, err)
+	}
+	return socket
+}
+
+func TestClient(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	log, err := audit.Open(logPath, "default")
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer func() { _ = log.Close() }()
+
+	ctrl := &stubController{}
+	socket := startServer(t, ctrl, log, credentials{UID: os.Getuid(), Groups: []int{os.Getgid()}})
+	if !Available(socket) {
+		t.Fatal("Helper should be available")
+	}
+	client := NewClient(socket)
+
+	status, err := client.Start()
+	if err != nil || !status.Active || status.ExternalIP != "192.0.2.10" {
+		t.Fatalf("Start = %+v, %v", status, err)
+	}
+	if _, err := client.Start(); !errors.Is(err, nat.ErrConflict) || errors.Is(err, nat.ErrNotRunning) {
+		t.Errorf("Second start should conflict, got %v", err)
+	}
+	devices, err := client.Devices()
+	if err != nil || len(devices) != 1 || devices[0].MAC != "aa:bb:cc:dd:ee:ff" {
+		t.Errorf("Devices = %v, %v", devices, err)
+	}
+	if killed, err := client.KillConnections("192.168.100.10"); err != nil || killed != 3 {
+		t.Errorf("KillConnections = %d, %v", killed, err)
+	}
+	if _, err := client.KillConnections("all"); !errors.Is(err, api.ErrInvalid) {
+		t.Errorf("Killing the connections of a non-address should be invalid, got %v", err)
+	}
+
+	forward := config.PortForward{Protocol: "tcp", ExternalPort: 8080, InternalIP: "192.168.100.50", InternalPort: 80}
+	if err := client.AddForward(forward); err != nil {
+		t.Fatalf("AddForward failed: %v", err)
+	}
+	if forwards, err := client.Forwards(); err != nil || len(forwards) != 1 || forwards[0] != forward {
+		t.Errorf("Forwards = %v, %v", forwards, err)
+	}
+	if err := client.RemoveForward(9090); !errors.Is(err, api.ErrNotFound) {
+		t.Errorf("Removing an unknown forward should not be found, got %v", err)
+	}
+	if err := client.RemoveForward(8080); err != nil {
+		t.Errorf("RemoveForward failed: %v", err)
+	}
+
+	if _, err := client.Stop(); err != nil {
+		t.Errorf("Stop failed: %v", err)
+	}
+	if _, err := client.Stop(); !errors.Is(err, nat.ErrNotRunning) || errors.Is(err, nat.ErrConflict) {
+		t.Errorf("Second stop should report not running, got %v", err)
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer func() { _ = file.Close() }()
+	entries, err := audit.Read(file, audit.Query{})
+	if err != nil || len(entries) == 0 {
+		t.Fatalf("Expected audit entries, got %v, %v", entries, err)
+	}
+	if entries[0].Action != "helper POST /api/v1/start" || entries[0].Result != "200" {
+		t.Errorf("Unexpected audit entry %+v", entries[0])
+	}
+}
+
+func TestClientDenied(t *testing.T) {
+	socket := startServer(t, &stubController{}, nil, credentials{UID: 4242, Groups: []int{4242}})
+	if _, err := NewClient(socket).Status(); err == nil {
+		t.Error("A peer outside the group should be refused")
+	}
+}
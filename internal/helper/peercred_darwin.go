@@ -0,0 +1,38 @@
+package helper
+
+import (
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials returns the user and groups of the process at the other
+// end of conn, as the kernel recorded them when it connected
+func peerCredentials(conn net.Conn) (credentials, error) {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return credentials{}, fmt.Errorf("not a Unix domain socket connection")
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return credentials{}, fmt.Errorf("failed to read peer credentials: %w", err)
+	}
+
+	var xucred *unix.Xucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		xucred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	}); err != nil {
+		return credentials{}, fmt.Errorf("failed to read peer credentials: %w", err)
+	}
+	if credErr != nil {
+		return credentials{}, fmt.Errorf("failed to read peer credentials: %w", credErr)
+	}
+
+	cred := credentials{UID: int(xucred.Uid)}
+	for _, gid := range xucred.Groups[:xucred.Ngroups] {
+		cred.Groups = append(cred.Groups, int(gid))
+	}
+	return cred, nil
+}
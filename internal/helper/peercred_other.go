@@ -0,0 +1,10 @@
+//go:build !darwin
+
+package helper
+
+import "net"
+
+// peerCredentials is unsupported off macOS, so every connection is refused
+func peerCredentials(net.Conn) (credentials, error) {
+	return credentials{}, ErrUnsupported
+}
@@ -0,0 +1,143 @@
+// Package ifstats samples interface traffic counters straight from the
+// kernel's ifmib sysctl tree, cheaply enough to poll several times a second
+package ifstats
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrUnsupported is returned where the kernel has no ifmib sysctl tree
+var ErrUnsupported = errors.New("interface counters are only available on macOS")
+
+// Counters are an interface's cumulative traffic counters
+type Counters struct {
+	Interface  string    `json:"interface"`
+	Time       time.Time `json:"time"`
+	BytesIn    uint64    `json:"bytes_in"`
+	BytesOut   uint64    `json:"bytes_out"`
+	PacketsIn  uint64    `json:"packets_in"`
+	PacketsOut uint64    `json:"packets_out"`
+	ErrorsIn   uint64    `json:"errors_in"`
+	ErrorsOut  uint64    `json:"errors_out"`
+	DropsIn    uint64    `json:"drops_in"`
+}
+
+// Throughput is the traffic rate between two samples in bytes per second
+type Throughput struct {
+	In  float64 `json:"in"`
+	Out float64 `json:"out"`
+}
+
+// ifData64Size is the size of struct if_data64, which ends struct ifmibdata
+const ifData64Size = 128
+
+// Offsets of the counters within struct if_data64
+const (
+	offIPackets = 24
+	offIErrors  = 32
+	offOPackets = 40
+	offOErrors  = 48
+	offIBytes   = 64
+	offOBytes   = 72
+	offIQDrops  = 96
+)
+
+// Read returns the counters of the named interface
+func Read(name string) (Counters, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return Counters{}, fmt.Errorf("failed to find interface %s: %w", name, err)
+	}
+	buf, err := readIfmib(iface.Index)
+	if err != nil {
+		return Counters{}, fmt.Errorf("failed to read counters of %s: %w", name, err)
+	}
+	counters, err := parseIfmibData(buf)
+	if err != nil {
+		return Counters{}, fmt.Errorf("failed to read counters of %s: %w", name, err)
+	}
+	counters.Interface = name
+	counters.Time = time.Now()
+	return counters, nil
+}
+
+// parseIfmibData decodes the counters of a struct ifmibdata. The
+// if_data64 it ends with is located from the end of the buffer, which
+// keeps decoding independent of the padding before it.
+func parseIfmibData(buf []byte) (Counters, error) {
+	if len(buf) < ifData64Size {
+		return Counters{}, fmt.Errorf("short ifmib record of %d bytes", len(buf))
+	}
+	data := buf[len(buf)-ifData64Size:]
+	counter := func(offset int) uint64 {
+		return binary.LittleEndian.Uint64(data[offset : offset+8])
+	}
+	return Counters{
+		BytesIn:    counter(offIBytes),
+		BytesOut:   counter(offOBytes),
+		PacketsIn:  counter(offIPackets),
+		PacketsOut: counter(offOPackets),
+		ErrorsIn:   counter(offIErrors),
+		ErrorsOut:  counter(offOErrors),
+		DropsIn:    counter(offIQDrops),
+	}, nil
+}
+
+// Rate returns the throughput between two samples of the same interface.
+// Counters that went backwards, e.g. because the interface was recreated,
+// count as no traffic.
+func Rate(prev, cur Counters) Throughput {
+	seconds := cur.Time.Sub(prev.Time).Seconds()
+	if seconds <= 0 {
+		return Throughput{}
+	}
+	delta := func(a, b uint64) float64 {
+		if b < a {
+			return 0
+		}
+		return float64(b - a)
+	}
+	return Throughput{
+		In:  delta(prev.BytesIn, cur.BytesIn) / seconds,
+		Out: delta(prev.BytesOut, cur.BytesOut) / seconds,
+	}
+}
+
+// Sampler tracks an interface's throughput across successive samples. It is
+// safe for concurrent use.
+type Sampler struct {
+	Interface string
+
+	mu   sync.Mutex
+	prev Counters
+	read func(string) (Counters, error)
+}
+
+// NewSampler returns a sampler of the named interface
+func NewSampler(name string) *Sampler {
+	return &Sampler{Interface: name, read: Read}
+}
+
+// Sample reads the counters and returns them with the throughput since the
+// previous sample, which is nil for the first one
+func (s *Sampler) Sample() (Counters, *Throughput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cur, err := s.read(s.Interface)
+	if err != nil {
+		return Counters{}, nil, err
+	}
+	var rate *Throughput
+	if !s.prev.Time.IsZero() {
+		r := Rate(s.prev, cur)
+		rate = &r
+	}
+	s.prev = cur
+	return cur, rate, nil
+}
@@ -0,0 +1,14 @@
+package ifstats
+
+import "golang.org/x/sys/unix"
+
+// ifmib selectors below net.link.generic, from <net/if_mib.h>
+const (
+	ifmibIfdata   = 2
+	ifdataGeneral = 1
+)
+
+// readIfmib reads the struct ifmibdata of the interface with index
+func readIfmib(index int) ([]byte, error) {
+	return unix.SysctlRaw("net.link.generic", ifmibIfdata, index, ifdataGeneral)
+}
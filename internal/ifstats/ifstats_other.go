@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package ifstats
+
+// readIfmib is unsupported off macOS
+func readIfmib(int) ([]byte, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,61 @@
+package ifstats
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestParseIfmibData(t *testing.T) {
+	// struct ifmibdata: 52 bytes of name and send queue data, then if_data64
+	buf := make([]byte, 52+ifData64Size)
+	data := buf[52:]
+	put := func(offset int, value uint64) {
+		binary.LittleEndian.PutUint64(data[offset:], value)
+	}
+	put(offIPackets, 10)
+	put(offIErrors, 1)
+	put(offOPackets, 20)
+	put(offOErrors, 2)
+	put(offIBytes, 1500)
+	put(offOBytes, 3000)
+	put(offIQDrops, 3)
+
+	got, err := parseIfmibData(buf)
+	if err != nil {
+		t.Fatalf("parseIfmibData() error = %v", err)
+	}
+	expected := Counters{BytesIn: 1500, BytesOut: 3000, PacketsIn: 10, PacketsOut: 20, ErrorsIn: 1, ErrorsOut: 2, DropsIn: 3}
+	if got != expected {
+		t.Errorf("parseIfmibData() = %+v, expected %+v", got, expected)
+	}
+
+	if _, err := parseIfmibData(buf[:64]); err == nil {
+		t.Error("Expected a short record to be rejected")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	samples := []Counters{
+		{Time: start, BytesIn: 1000, BytesOut: 500},
+		{Time: start.Add(2 * time.Second), BytesIn: 5000, BytesOut: 1500},
+		{Time: start.Add(3 * time.Second), BytesIn: 100, BytesOut: 1600}, // interface recreated
+	}
+	expected := []*Throughput{nil, {In: 2000, Out: 500}, {In: 0, Out: 100}}
+
+	sampler := &Sampler{Interface: "bridge100", read: func(string) (Counters, error) {
+		next := samples[0]
+		samples = samples[1:]
+		return next, nil
+	}}
+	for i, want := range expected {
+		_, rate, err := sampler.Sample()
+		if err != nil {
+			t.Fatalf("Sample() error = %v", err)
+		}
+		if (rate == nil) != (want == nil) || rate != nil && *rate != *want {
+			t.Errorf("sample %d: rate = %+v, expected %+v", i, rate, want)
+		}
+	}
+}
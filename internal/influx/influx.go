@@ -0,0 +1,283 @@
+// Package influx pushes traffic, device and DNS metrics of an instance in
+// the InfluxDB line protocol, to InfluxDB over HTTP or to a Telegraf socket
+// listener
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of Options
+const (
+	DefaultInterval = 30 * time.Second
+	writeTimeout    = 10 * time.Second
+)
+
+// Schemes lists the URL schemes understood: InfluxDB over HTTP, or a
+// Telegraf socket listener
+var Schemes = []string{"http", "https", "udp", "tcp", "unix"}
+
+// Options configures a writer
+type Options struct {
+	URL      string // e.g. http://influx.local:8086, udp://telegraf.local:8094 or unix:///var/run/telegraf.sock
+	Token    string // InfluxDB API token
+	Org      string // InfluxDB 2 organization
+	Bucket   string // InfluxDB 2 bucket
+	Database string // InfluxDB 1 database, instead of Bucket
+}
+
+// Validate checks the URL of opts and that InfluxDB gets a bucket or
+// database
+func (o Options) Validate() error {
+	u, err := url.Parse(o.URL)
+	if err != nil || !slices.Contains(Schemes, u.Scheme) {
+		return fmt.Errorf("invalid url %q (e.g. http://influx.local:8086 or udp://telegraf.local:8094)", o.URL)
+	}
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return fmt.Errorf("invalid url %q (e.g. unix:///var/run/telegraf.sock)", o.URL)
+		}
+	case "http", "https":
+		if u.Host == "" {
+			return fmt.Errorf("invalid url %q (e.g. http://influx.local:8086)", o.URL)
+		}
+		if o.Bucket == "" && o.Database == "" {
+			return fmt.Errorf("a bucket or database is needed to write to InfluxDB")
+		}
+	default:
+		if u.Hostname() == "" || u.Port() == "" {
+			return fmt.Errorf("invalid url %q (e.g. udp://telegraf.local:8094)", o.URL)
+		}
+	}
+	return nil
+}
+
+// Point is a line of the line protocol
+type Point struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]any // bool, string, float64 or integers
+	Time        time.Time
+}
+
+// measurementEscaper, tagEscaper and stringEscaper escape the parts of a
+// line as the line protocol asks
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// Line returns the point in the line protocol, without a newline. Tags
+// and fields are sorted, and empty tags left out.
+func (p Point) Line() string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(p.Measurement))
+	for _, key := range sortedKeys(p.Tags) {
+		if p.Tags[key] == "" {
+			continue
+		}
+		fmt.Fprintf(&b, ",%s=%s", tagEscaper.Replace(key), tagEscaper.Replace(p.Tags[key]))
+	}
+	for i, key := range sortedKeys(p.Fields) {
+		sep := ","
+		if i == 0 {
+			sep = " "
+		}
+		fmt.Fprintf(&b, "%s%s=%s", sep, tagEscaper.Replace(key), fieldValue(p.Fields[key]))
+	}
+	if !p.Time.IsZero() {
+		fmt.Fprintf(&b, " %d", p.Time.UnixNano())
+	}
+	return b.String()
+}
+
+// fieldValue formats a field value: integers with an i suffix, strings
+// quoted
+func fieldValue(v any) string {
+	switch v := v.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v) + "i"
+	case int64:
+		return strconv.FormatInt(v, 10) + "i"
+	case uint64:
+		return strconv.FormatUint(min(v, 1<<63-1), 10) + "i"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case string:
+		return `"` + stringEscaper.Replace(v) + `"`
+	}
+	return `"` + stringEscaper.Replace(fmt.Sprint(v)) + `"`
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Encode returns points in the line protocol, one per line
+func Encode(points []Point) []byte {
+	var buf bytes.Buffer
+	for _, p := range points {
+		if len(p.Fields) == 0 {
+			continue
+		}
+		buf.WriteString(p.Line())
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// Writer writes points to the URL of its options
+type Writer struct {
+	opts   Options
+	url    *url.URL
+	client *http.Client
+}
+
+// New returns a writer for opts
+func New(opts Options) (*Writer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(opts.URL)
+	return &Writer{opts: opts, url: u, client: &http.Client{Timeout: writeTimeout}}, nil
+}
+
+// Write sends points
+func (w *Writer) Write(ctx context.Context, points []Point) error {
+	body := Encode(points)
+	if len(body) == 0 {
+		return nil
+	}
+	switch w.url.Scheme {
+	case "http", "https":
+		return w.post(ctx, body)
+	case "unix":
+		return w.send(ctx, "unix", w.url.Path, body)
+	}
+	return w.send(ctx, w.url.Scheme, w.url.Host, body)
+}
+
+// post writes body to the InfluxDB 2 or 1 write endpoint
+func (w *Writer) post(ctx context.Context, body []byte) error {
+	u := *w.url
+	query := url.Values{}
+	if w.opts.Bucket != "" {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v2/write"
+		query.Set("bucket", w.opts.Bucket)
+		if w.opts.Org != "" {
+			query.Set("org", w.opts.Org)
+		}
+	} else {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/write"
+		query.Set("db", w.opts.Database)
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.opts.Token != "" {
+		req.Header.Set("Authorization", "Token "+w.opts.Token)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to InfluxDB: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to write to InfluxDB: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// send writes body to a Telegraf socket listener. Datagrams carry whole
+// lines, a few kilobytes at most.
+func (w *Writer) send(ctx context.Context, network, addr string, body []byte) error {
+	dialer := net.Dialer{Timeout: writeTimeout}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	chunks := [][]byte{body}
+	if network == "udp" {
+		chunks = datagrams(body, 1400)
+	}
+	for _, chunk := range chunks {
+		if _, err := conn.Write(chunk); err != nil {
+			return fmt.Errorf("failed to write to %s: %w", addr, err)
+		}
+	}
+	return nil
+}
+
+// datagrams splits lines into chunks of at most size bytes, or one line
+// when a line is longer
+func datagrams(body []byte, size int) [][]byte {
+	var chunks [][]byte
+	var chunk []byte
+	for _, line := range bytes.SplitAfter(body, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if len(chunk) > 0 && len(chunk)+len(line) > size {
+			chunks = append(chunks, chunk)
+			chunk = nil
+		}
+		chunk = append(chunk, line...)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// Run writes the points collected every interval until ctx is done,
+// passing errors to onError
+func Run(ctx context.Context, w *Writer, interval time.Duration, collect func(time.Time) ([]Point, error), onError func(error)) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		points, err := collect(time.Now())
+		if err == nil {
+			err = w.Write(ctx, points)
+		}
+		if err != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
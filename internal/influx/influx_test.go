@@ -0,0 +1,160 @@
+package influx
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		opts  Options
+		valid bool
+	}{
+		{Options{URL: "http://influx.local:8086", Bucket: "nat"}, true},
+		{Options{URL: "https://influx.example.com", Database: "telegraf"}, true},
+		{Options{URL: "udp://telegraf.local:8094"}, true},
+		{Options{URL: "unix:///var/run/telegraf.sock"}, true},
+		{Options{URL: "http://influx.local:8086"}, false},
+		{Options{URL: "udp://telegraf.local"}, false},
+		{Options{URL: "unix://"}, false},
+		{Options{URL: "mqtt://broker.local"}, false},
+		{Options{URL: ""}, false},
+	}
+	for _, tc := range testCases {
+		if err := tc.opts.Validate(); (err == nil) != tc.valid {
+			t.Errorf("Validate(%+v) = %v, expected valid = %t", tc.opts, err, tc.valid)
+		}
+	}
+}
+
+func TestLine(t *testing.T) {
+	now := time.Unix(1_792_240_000, 5)
+	p := Point{
+		Measurement: "nat manager",
+		Tags:        map[string]string{"instance": "lab", "name": "Jo's iPad, 2", "empty": ""},
+		Fields: map[string]any{
+			"active":  true,
+			"bytes":   uint64(1234),
+			"devices": 3,
+			"rate":    12.5,
+			"ip":      `10.0.0.1 "wan"`,
+		},
+		Time: now,
+	}
+	want := `nat\ manager,instance=lab,name=Jo's\ iPad\,\ 2 active=true,bytes=1234i,devices=3i,ip="10.0.0.1 \"wan\"",rate=12.5 1792240000000000005`
+	if got := p.Line(); got != want {
+		t.Errorf("Line =\n%s\nwant\n%s", got, want)
+	}
+	if got := string(Encode([]Point{p, {Measurement: "empty"}})); got != want+"\n" {
+		t.Errorf("Encode = %q", got)
+	}
+}
+
+func TestPoints(t *testing.T) {
+	now := time.Unix(1_792_240_000, 0)
+	status := &nat.Status{Active: true, ExternalIP: "203.0.113.7", BytesIn: 5000, BytesOut: 1000,
+		ActiveConnections: make([]nat.Connection, 4), Throughput: &ifstats.Throughput{In: 100, Out: 50}}
+	devices := []nat.Device{
+		{IP: "192.168.100.10", MAC: "aa:bb:cc:dd:ee:01", Hostname: "laptop", Online: true},
+		{IP: "192.168.100.11", MAC: "aa:bb:cc:dd:ee:02"},
+	}
+	traffic := map[string]nat.Traffic{"192.168.100.10": {BytesIn: 4000, BytesOut: 900, PacketsIn: 40, PacketsOut: 9}}
+	body := string(Encode(NATPoints("default", status, devices, traffic, now)))
+	want := `nat_manager,instance=default active=true,bytes_in=5000i,bytes_out=1000i,connections=4i,devices=2i,devices_online=1i,external_ip="203.0.113.7",rate_in=100,rate_out=50 1792240000000000000
+nat_manager_device,instance=default,ip=192.168.100.10,mac=aa:bb:cc:dd:ee:01,name=laptop bytes_in=4000i,bytes_out=900i,online=true,packets_in=40i,packets_out=9i 1792240000000000000
+nat_manager_device,instance=default,ip=192.168.100.11,mac=aa:bb:cc:dd:ee:02 bytes_in=0i,bytes_out=0i,online=false,packets_in=0i,packets_out=0i 1792240000000000000
+`
+	if body != want {
+		t.Errorf("NATPoints =\n%s\nwant\n%s", body, want)
+	}
+
+	stats := dns.Stats{Queries: 10, CacheHits: 6, CacheMisses: 4, UpstreamTime: 80 * time.Millisecond, QueryTypes: map[string]uint64{"A": 7, "AAAA": 3}}
+	body = string(Encode(DNSPoints("default", stats, now)))
+	if !strings.Contains(body, "cache_misses=4i") || !strings.Contains(body, "upstream_latency_ms=20 ") ||
+		!strings.Contains(body, "nat_manager_dns_queries,instance=default,type=AAAA queries=3i") {
+		t.Errorf("DNSPoints =\n%s", body)
+	}
+}
+
+func TestWriteHTTP(t *testing.T) {
+	var path, query, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		path, query, auth, body = r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization"), string(data)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	points := []Point{{Measurement: "nat_manager", Fields: map[string]any{"active": true}}}
+
+	writer, err := New(Options{URL: server.URL, Token: "s3cret", Org: "home", Bucket: "nat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(context.Background(), points); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if path != "/api/v2/write" || query != "bucket=nat&org=home" || auth != "Token s3cret" || body != "nat_manager active=true\n" {
+		t.Errorf("InfluxDB 2 write: %s?%s %q %q", path, query, auth, body)
+	}
+
+	writer, _ = New(Options{URL: server.URL, Database: "telegraf"})
+	if err := writer.Write(context.Background(), points); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if path != "/write" || query != "db=telegraf" || auth != "" {
+		t.Errorf("InfluxDB 1 write: %s?%s %q", path, query, auth)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"message":"unauthorized access"}`, http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+	writer, _ = New(Options{URL: failing.URL, Bucket: "nat"})
+	if err := writer.Write(context.Background(), points); err == nil || !strings.Contains(err.Error(), "unauthorized access") {
+		t.Errorf("expected the InfluxDB error, got %v", err)
+	}
+}
+
+func TestWriteUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	writer, err := New(Options{URL: "udp://" + conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var points []Point
+	for range 100 {
+		points = append(points, Point{Measurement: "nat_manager_device", Tags: map[string]string{"ip": "192.168.100.10"}, Fields: map[string]any{"bytes_in": 1}})
+	}
+	if err := writer.Write(context.Background(), points); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	lines := 0
+	buf := make([]byte, 2048)
+	for lines < 100 {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read after %d lines: %v", lines, err)
+		}
+		if n > 1400 || buf[n-1] != '\n' {
+			t.Errorf("datagram of %d bytes does not end a line", n)
+		}
+		lines += strings.Count(string(buf[:n]), "\n")
+	}
+}
@@ -0,0 +1,94 @@
+package influx
+
+import (
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Measurements written
+const (
+	MeasurementNAT      = "nat_manager"
+	MeasurementDevice   = "nat_manager_device"
+	MeasurementDNS      = "nat_manager_dns"
+	MeasurementDNSQuery = "nat_manager_dns_queries" // by query type
+)
+
+// NATPoints returns the points of an instance's status and of its devices
+// with their traffic, by device address
+func NATPoints(instance string, status *nat.Status, devices []nat.Device, traffic map[string]nat.Traffic, now time.Time) []Point {
+	online := 0
+	for _, d := range devices {
+		if d.Online {
+			online++
+		}
+	}
+	fields := map[string]any{
+		"active":         status.Active,
+		"bytes_in":       status.BytesIn,
+		"bytes_out":      status.BytesOut,
+		"connections":    len(status.ActiveConnections),
+		"devices":        len(devices),
+		"devices_online": online,
+	}
+	if status.ExternalIP != "" {
+		fields["external_ip"] = status.ExternalIP
+	}
+	if status.Throughput != nil {
+		fields["rate_in"] = status.Throughput.In
+		fields["rate_out"] = status.Throughput.Out
+	}
+	points := []Point{{
+		Measurement: MeasurementNAT,
+		Tags:        map[string]string{"instance": instance},
+		Fields:      fields,
+		Time:        now,
+	}}
+
+	for _, d := range devices {
+		t := traffic[d.IP]
+		points = append(points, Point{
+			Measurement: MeasurementDevice,
+			Tags:        map[string]string{"instance": instance, "mac": d.MAC, "ip": d.IP, "name": d.Hostname},
+			Fields: map[string]any{
+				"online":      d.Online,
+				"bytes_in":    t.BytesIn,
+				"bytes_out":   t.BytesOut,
+				"packets_in":  t.PacketsIn,
+				"packets_out": t.PacketsOut,
+			},
+			Time: now,
+		})
+	}
+	return points
+}
+
+// DNSPoints returns the points of the DNS forwarder's counters
+func DNSPoints(instance string, stats dns.Stats, now time.Time) []Point {
+	points := []Point{{
+		Measurement: MeasurementDNS,
+		Tags:        map[string]string{"instance": instance},
+		Fields: map[string]any{
+			"queries":             stats.Queries,
+			"cache_hits":          stats.CacheHits,
+			"cache_misses":        stats.CacheMisses,
+			"cache_entries":       stats.CacheEntries,
+			"local":               stats.LocalAnswers,
+			"blocked":             stats.Blocked,
+			"fallbacks":           stats.Fallbacks,
+			"upstream_errors":     stats.UpstreamErrors,
+			"upstream_latency_ms": float64(stats.AvgUpstreamLatency()) / float64(time.Millisecond),
+		},
+		Time: now,
+	}}
+	for _, typ := range sortedKeys(stats.QueryTypes) {
+		points = append(points, Point{
+			Measurement: MeasurementDNSQuery,
+			Tags:        map[string]string{"instance": instance, "type": typ},
+			Fields:      map[string]any{"queries": stats.QueryTypes[typ]},
+			Time:        now,
+		})
+	}
+	return points
+}
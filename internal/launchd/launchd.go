@@ -0,0 +1,247 @@
+// Package launchd renders and installs launchd jobs that run nat-manager
+// commands on a schedule
+package launchd
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+)
+
+// LabelPrefix prefixes the labels of all nat-manager jobs
+const LabelPrefix = "com.scttfrdmn.nat-manager."
+
+// pidRe matches the process ID in "launchctl list <label>" output
+var pidRe = regexp.MustCompile(`"PID" = (\d+);`)
+
+// Job is a launchd job definition
+type Job struct {
+	Label         string
+	Program       []string // executable and arguments
+	StartInterval int      // seconds between runs, 0 to disable
+	Calendar      []CalendarInterval
+	RunAtLoad     bool
+	KeepAlive     bool // restart the job whenever it exits
+	Environment   map[string]string
+	LogPath       string // stdout and stderr, discarded if empty
+}
+
+// CalendarInterval is a time of day launchd runs a job at
+type CalendarInterval struct {
+	Hour    int
+	Minute  int
+	Weekday int // 1 (Monday) to 7 (Sunday), 0 for every day
+}
+
+// Plist renders the job as a launchd property list
+func (j Job) Plist() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n")
+
+	writeKey(&b, "Label")
+	writeString(&b, j.Label)
+
+	writeKey(&b, "ProgramArguments")
+	b.WriteString("\t<array>\n")
+	for _, arg := range j.Program {
+		b.WriteString("\t")
+		writeString(&b, arg)
+	}
+	b.WriteString("\t</array>\n")
+
+	if j.StartInterval > 0 {
+		writeKey(&b, "StartInterval")
+		fmt.Fprintf(&b, "\t<integer>%d</integer>\n", j.StartInterval)
+	}
+	if len(j.Calendar) > 0 {
+		writeKey(&b, "StartCalendarInterval")
+		b.WriteString("\t<array>\n")
+		for _, interval := range j.Calendar {
+			writeInterval(&b, interval)
+		}
+		b.WriteString("\t</array>\n")
+	}
+	if j.RunAtLoad {
+		writeKey(&b, "RunAtLoad")
+		b.WriteString("\t<true/>\n")
+	}
+	if j.KeepAlive {
+		writeKey(&b, "KeepAlive")
+		b.WriteString("\t<true/>\n")
+	}
+
+	if len(j.Environment) > 0 {
+		keys := make([]string, 0, len(j.Environment))
+		for key := range j.Environment {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeKey(&b, "EnvironmentVariables")
+		b.WriteString("\t<dict>\n")
+		for _, key := range keys {
+			b.WriteString("\t")
+			writeKey(&b, key)
+			b.WriteString("\t")
+			writeString(&b, j.Environment[key])
+		}
+		b.WriteString("\t</dict>\n")
+	}
+
+	if j.LogPath != "" {
+		writeKey(&b, "StandardOutPath")
+		writeString(&b, j.LogPath)
+		writeKey(&b, "StandardErrorPath")
+		writeString(&b, j.LogPath)
+	}
+
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+func writeKey(b *strings.Builder, key string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n", html.EscapeString(key))
+}
+
+func writeString(b *strings.Builder, value string) {
+	fmt.Fprintf(b, "\t<string>%s</string>\n", html.EscapeString(value))
+}
+
+func writeInterval(b *strings.Builder, interval CalendarInterval) {
+	b.WriteString("\t\t<dict>\n")
+	if interval.Weekday > 0 {
+		fmt.Fprintf(b, "\t\t\t<key>Weekday</key>\n\t\t\t<integer>%d</integer>\n", interval.Weekday)
+	}
+	fmt.Fprintf(b, "\t\t\t<key>Hour</key>\n\t\t\t<integer>%d</integer>\n", interval.Hour)
+	fmt.Fprintf(b, "\t\t\t<key>Minute</key>\n\t\t\t<integer>%d</integer>\n", interval.Minute)
+	b.WriteString("\t\t</dict>\n")
+}
+
+// PlistPath returns where the job is installed: /Library/LaunchDaemons when
+// running as root, the user's LaunchAgents otherwise
+func PlistPath(label string) (string, error) {
+	if os.Geteuid() == 0 {
+		return filepath.Join("/Library/LaunchDaemons", label+".plist"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", label+".plist"), nil
+}
+
+// Install writes the job's plist and (re)loads it
+func Install(job Job) (string, error) {
+	path, err := PlistPath(job.Label)
+	if err != nil {
+		return "", fmt.Errorf("failed to get launchd plist path: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	// Unload a previous version so launchd picks up the new definition
+	_, _ = launchctl("unload", path)
+	if err := os.WriteFile(path, []byte(job.Plist()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if output, err := launchctl("load", "-w", path); err != nil {
+		return "", fmt.Errorf("launchctl load failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return path, nil
+}
+
+// Uninstall unloads the job and removes its plist. A job that is not
+// installed is not an error.
+func Uninstall(label string) error {
+	path, err := PlistPath(label)
+	if err != nil {
+		return fmt.Errorf("failed to get launchd plist path: %w", err)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	_, _ = launchctl("unload", "-w", path)
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+// launchctl runs launchctl, auditing the change, and returns its output
+// and error output
+func launchctl(args ...string) ([]byte, error) {
+	cmd := exec.Command("launchctl", args...)
+	output, err := cmd.CombinedOutput()
+	audit.Command(cmd.Args, err)
+	return output, err
+}
+
+// Installed reports whether the job's plist is present
+func Installed(label string) bool {
+	path, err := PlistPath(label)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// PID returns the process ID of the job's running process, or 0 when the
+// job is not loaded or not running
+func PID(label string) int {
+	output, err := exec.Command("launchctl", "list", label).Output()
+	if err != nil {
+		return 0
+	}
+	return parsePID(string(output))
+}
+
+// parsePID returns the "PID" of "launchctl list <label>" output, 0 if absent
+func parsePID(output string) int {
+	match := pidRe.FindStringSubmatch(output)
+	if match == nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(match[1])
+	return pid
+}
+
+// List returns the labels of the installed nat-manager jobs
+func List() ([]string, error) {
+	path, err := PlistPath(LabelPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get launchd plist path: %w", err)
+	}
+	return listIn(filepath.Dir(path))
+}
+
+// listIn returns the labels of the nat-manager plists in dir
+func listIn(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+	var labels []string
+	for _, entry := range entries {
+		label, ok := strings.CutSuffix(entry.Name(), ".plist")
+		if ok && strings.HasPrefix(label, LabelPrefix) && !entry.IsDir() {
+			labels = append(labels, label)
+		}
+	}
+	return labels, nil
+}
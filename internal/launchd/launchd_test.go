@@ -0,0 +1,107 @@
+package launchd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlist(t *testing.T) {
+	job := Job{
+		Label:         LabelPrefix + "backup",
+		Program:       []string{"/usr/local/bin/nat-manager", "backup", "run"},
+		StartInterval: 86400,
+		Environment:   map[string]string{"HOME": "/Users/lab & co"},
+		LogPath:       "/tmp/backup.log",
+	}
+	plist := job.Plist()
+
+	for _, expected := range []string{
+		"<string>com.scttfrdmn.nat-manager.backup</string>",
+		"<array>\n\t\t<string>/usr/local/bin/nat-manager</string>\n\t\t<string>backup</string>\n\t\t<string>run</string>\n\t</array>",
+		"<key>StartInterval</key>\n\t<integer>86400</integer>",
+		"<string>/Users/lab &amp; co</string>",
+		"<key>StandardErrorPath</key>\n\t<string>/tmp/backup.log</string>",
+	} {
+		if !strings.Contains(plist, expected) {
+			t.Errorf("Plist missing %q:\n%s", expected, plist)
+		}
+	}
+	if strings.Contains(plist, "RunAtLoad") {
+		t.Error("RunAtLoad should be omitted unless set")
+	}
+}
+
+func TestListIn(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{LabelPrefix + "backup.plist", LabelPrefix + "watchdog.plist", "com.example.other.plist", LabelPrefix + "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	labels, err := listIn(dir)
+	if err != nil {
+		t.Fatalf("listIn failed: %v", err)
+	}
+	expected := []string{LabelPrefix + "backup", LabelPrefix + "watchdog"}
+	if strings.Join(labels, ",") != strings.Join(expected, ",") {
+		t.Errorf("listIn = %v, expected %v", labels, expected)
+	}
+	if labels, err := listIn(filepath.Join(dir, "missing")); err != nil || labels != nil {
+		t.Errorf("Missing directory should list nothing: %v, %v", labels, err)
+	}
+}
+
+func TestPlistCalendar(t *testing.T) {
+	job := Job{
+		Label:   LabelPrefix + "schedule.default.start",
+		Program: []string{"/usr/local/bin/nat-manager", "start"},
+		Calendar: []CalendarInterval{
+			{Hour: 9, Minute: 0, Weekday: 1},
+			{Hour: 19, Minute: 30},
+		},
+	}
+	plist := job.Plist()
+
+	for _, expected := range []string{
+		"<key>StartCalendarInterval</key>\n\t<array>\n\t\t<dict>\n",
+		"<key>Weekday</key>\n\t\t\t<integer>1</integer>\n\t\t\t<key>Hour</key>\n\t\t\t<integer>9</integer>\n\t\t\t<key>Minute</key>\n\t\t\t<integer>0</integer>",
+		"<dict>\n\t\t\t<key>Hour</key>\n\t\t\t<integer>19</integer>\n\t\t\t<key>Minute</key>\n\t\t\t<integer>30</integer>\n\t\t</dict>\n\t</array>",
+	} {
+		if !strings.Contains(plist, expected) {
+			t.Errorf("Plist missing %q:\n%s", expected, plist)
+		}
+	}
+	if strings.Contains(plist, "StartInterval</key>") {
+		t.Error("StartInterval should be omitted unless set")
+	}
+}
+
+func TestPlistKeepAlive(t *testing.T) {
+	job := Job{
+		Label:     LabelPrefix + "daemon.default",
+		Program:   []string{"/usr/local/bin/nat-manager", "daemon", "run"},
+		RunAtLoad: true,
+		KeepAlive: true,
+	}
+	plist := job.Plist()
+	for _, expected := range []string{
+		"<key>RunAtLoad</key>\n\t<true/>",
+		"<key>KeepAlive</key>\n\t<true/>",
+	} {
+		if !strings.Contains(plist, expected) {
+			t.Errorf("Plist missing %q:\n%s", expected, plist)
+		}
+	}
+}
+
+func TestParsePID(t *testing.T) {
+	output := "{\n\t\"LimitLoadToSessionType\" = \"System\";\n\t\"Label\" = \"com.scttfrdmn.nat-manager.daemon.default\";\n\t\"LastExitStatus\" = 0;\n\t\"PID\" = 412;\n};\n"
+	if pid := parsePID(output); pid != 412 {
+		t.Errorf("parsePID = %d, expected 412", pid)
+	}
+	if pid := parsePID("{\n\t\"LastExitStatus\" = 256;\n};\n"); pid != 0 {
+		t.Errorf("parsePID of a stopped job = %d, expected 0", pid)
+	}
+}
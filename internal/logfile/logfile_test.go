@@ -0,0 +1,51 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnsmasq.log")
+	log, err := Open(path, 10, 2)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := log.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	expected := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for file, content := range expected {
+		data, err := os.ReadFile(file)
+		if err != nil || string(data) != content {
+			t.Errorf("%s = %q, %v; expected %q", filepath.Base(file), data, err, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("Only two old files should be kept")
+	}
+
+	// Reopening appends to the existing file
+	log, _ = Open(path, 100, 2)
+	_, _ = log.Write([]byte("fifth\n"))
+	_ = log.Close()
+	if data, _ := os.ReadFile(path); !strings.HasSuffix(string(data), "fourth\nfifth\n") {
+		t.Errorf("Reopened log should append, got %q", data)
+	}
+	if _, err := log.Write([]byte("late\n")); err == nil {
+		t.Error("Write after Close should fail")
+	}
+}
@@ -0,0 +1,227 @@
+// Package logging sets up the structured log of nat-manager: records go to
+// stderr and to a rotating file, as text or JSON, and optionally to the
+// system log and a remote syslog server
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/logfile"
+)
+
+// Components of the log, recorded as the component attribute
+const (
+	NAT    = "nat"
+	DHCP   = "dhcp"
+	DNS    = "dns"
+	API    = "api"
+	Events = "events" // webhooks, notifications and MQTT
+	Audit  = "audit"  // the audit trail, sent to the system log and syslog
+)
+
+// Formats of the log file
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Formats lists the formats of the log file
+var Formats = []string{FormatText, FormatJSON}
+
+// Size and number of old files kept of the log file by default
+const (
+	DefaultMaxSize = 10 << 20
+	DefaultKeep    = 5
+)
+
+// Options configures the log
+type Options struct {
+	Level   slog.Level
+	Format  string    // of the file, text by default
+	Path    string    // of the file, none if empty
+	MaxSize int64     // DefaultMaxSize if 0
+	Keep    int       // DefaultKeep if 0
+	Console io.Writer // written as text, e.g. os.Stderr
+	OSLog   bool      // also send records to the system log
+	Syslog  string    // also send records to this syslog server, e.g. udp://logs.example.com:514
+}
+
+// audit is the logger of the audit trail, set up with the default logger
+var audit atomic.Pointer[slog.Logger]
+
+// ParseLevel returns the level named debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	switch strings.ToLower(s) {
+	case "debug", "info", "warn", "error":
+		err := level.UnmarshalText([]byte(s))
+		return level, err
+	case "warning":
+		return slog.LevelWarn, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q (debug, info, warn or error)", s)
+}
+
+// ValidateFormat checks the format of the log file
+func ValidateFormat(format string) error {
+	switch format {
+	case "", FormatText, FormatJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid log format %q (text or json)", format)
+}
+
+// ParseSyslog returns the network and address of a syslog server given as
+// udp://host[:port] or tcp://host[:port], port 514 by default
+func ParseSyslog(address string) (network, addr string, err error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Hostname() == "" || u.Path != "" {
+		return "", "", fmt.Errorf("invalid syslog server %q (e.g. udp://logs.example.com:514)", address)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "514"
+	}
+	return u.Scheme, net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// Setup makes the log of opts the default slog logger. The returned closer
+// closes the file and the system logs; when they cannot be opened the log
+// still goes to the console and the error is returned with the closer.
+func Setup(opts Options) (io.Closer, error) {
+	handler, auditHandler, closer, err := newHandler(opts)
+	slog.SetDefault(slog.New(handler))
+	audit.Store(slog.New(auditHandler).With("component", Audit))
+	return closer, err
+}
+
+// Component returns the default logger recording records of component
+func Component(name string) *slog.Logger {
+	return slog.Default().With("component", name)
+}
+
+// AuditLog returns the logger sending the audit trail at info level to the
+// system log and syslog server of the log, whatever its level. It discards
+// records when neither is set up.
+func AuditLog() *slog.Logger {
+	if logger := audit.Load(); logger != nil {
+		return logger
+	}
+	return slog.New(slog.DiscardHandler)
+}
+
+// newHandler returns the handler writing to the outputs of opts and the
+// handler of the audit trail, writing to its system logs
+func newHandler(opts Options) (slog.Handler, slog.Handler, io.Closer, error) {
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level}
+	var handlers, auditHandlers multiHandler
+	var closers closers
+	var errs []error
+	if opts.Console != nil {
+		handlers = append(handlers, slog.NewTextHandler(opts.Console, handlerOpts))
+	}
+	if opts.Path != "" {
+		maxSize, keep := opts.MaxSize, opts.Keep
+		if maxSize <= 0 {
+			maxSize = DefaultMaxSize
+		}
+		if keep <= 0 {
+			keep = DefaultKeep
+		}
+		file, err := logfile.Open(opts.Path, maxSize, keep)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			closers = append(closers, file)
+			if opts.Format == FormatJSON {
+				handlers = append(handlers, slog.NewJSONHandler(file, handlerOpts))
+			} else {
+				handlers = append(handlers, slog.NewTextHandler(file, handlerOpts))
+			}
+		}
+	}
+	var systemLogs []systemLog
+	if opts.OSLog {
+		writer, err := openSyslog("", "")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to open the system log: %w", err))
+		} else {
+			systemLogs = append(systemLogs, writer)
+		}
+	}
+	if opts.Syslog != "" {
+		network, addr, err := ParseSyslog(opts.Syslog)
+		if err == nil {
+			var writer systemLog
+			if writer, err = openSyslog(network, addr); err == nil {
+				systemLogs = append(systemLogs, writer)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to connect to syslog server: %w", err))
+		}
+	}
+	for _, writer := range systemLogs {
+		closers = append(closers, writer)
+		handlers = append(handlers, newSyslogHandler(writer, opts.Level))
+		auditHandlers = append(auditHandlers, newSyslogHandler(writer, slog.LevelInfo))
+	}
+	return handlers, auditHandlers, closers, errors.Join(errs...)
+}
+
+// multiHandler passes records on to every handler enabled for them
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// closers closes all of its closers
+type closers []io.Closer
+
+func (c closers) Close() error {
+	var errs []error
+	for _, closer := range c {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
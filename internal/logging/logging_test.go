@@ -0,0 +1,183 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLevel(t *testing.T) {
+	for input, want := range map[string]slog.Level{
+		"debug":   slog.LevelDebug,
+		"INFO":    slog.LevelInfo,
+		"warn":    slog.LevelWarn,
+		"warning": slog.LevelWarn,
+		"error":   slog.LevelError,
+	} {
+		level, err := ParseLevel(input)
+		if err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", input, level, err, want)
+		}
+	}
+	for _, input := range []string{"", "verbose", "info+2"} {
+		if _, err := ParseLevel(input); err == nil {
+			t.Errorf("ParseLevel(%q) succeeded", input)
+		}
+	}
+	if ValidateFormat("json") != nil || ValidateFormat("") != nil || ValidateFormat("xml") == nil {
+		t.Error("ValidateFormat accepted the wrong formats")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	path := filepath.Join(t.TempDir(), "logs", "default.log")
+	var console bytes.Buffer
+	closer, err := Setup(Options{Level: slog.LevelInfo, Format: FormatJSON, Path: path, Console: &console})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	Component(DHCP).Info("lease granted", "ip", "192.168.100.10")
+	Component(API).Debug("request")
+	if err := closer.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("log file has %d records, want 1:\n%s", len(lines), data)
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("record is not JSON: %v", err)
+	}
+	if record["component"] != DHCP || record["msg"] != "lease granted" || record["ip"] != "192.168.100.10" || record["level"] != "INFO" {
+		t.Errorf("record = %v", record)
+	}
+	if !strings.Contains(console.String(), "level=INFO msg=\"lease granted\" component=dhcp") || strings.Contains(console.String(), "request") {
+		t.Errorf("console = %q", console.String())
+	}
+}
+
+func TestSetupUnwritable(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	dir := t.TempDir()
+	blocker := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var console bytes.Buffer
+	closer, err := Setup(Options{Path: filepath.Join(blocker, "default.log"), Console: &console})
+	if err == nil {
+		t.Fatal("Setup succeeded with a file for a directory")
+	}
+	slog.Warn("still logged")
+	_ = closer.Close()
+	if !strings.Contains(console.String(), "still logged") {
+		t.Errorf("console = %q", console.String())
+	}
+}
+
+// fakeSystemLog records messages by priority
+type fakeSystemLog struct {
+	messages []string
+}
+
+func (f *fakeSystemLog) record(priority, msg string) error {
+	f.messages = append(f.messages, priority+": "+msg)
+	return nil
+}
+
+func (f *fakeSystemLog) Debug(msg string) error   { return f.record("debug", msg) }
+func (f *fakeSystemLog) Info(msg string) error    { return f.record("info", msg) }
+func (f *fakeSystemLog) Warning(msg string) error { return f.record("warning", msg) }
+func (f *fakeSystemLog) Err(msg string) error     { return f.record("err", msg) }
+func (f *fakeSystemLog) Close() error             { return nil }
+
+func TestSyslogHandler(t *testing.T) {
+	sys := &fakeSystemLog{}
+	logger := slog.New(newSyslogHandler(sys, slog.LevelInfo)).With("component", NAT)
+	logger.Debug("skipped")
+	logger.Info("NAT started", "external", "en0")
+	logger.Warn("rules missing")
+	logger.Error("failed to reload rules", "error", "pfctl failed")
+
+	want := []string{
+		"info: msg=\"NAT started\" component=nat external=en0",
+		"warning: msg=\"rules missing\" component=nat",
+		"err: msg=\"failed to reload rules\" component=nat error=\"pfctl failed\"",
+	}
+	if strings.Join(sys.messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("messages =\n%s\nwant\n%s", strings.Join(sys.messages, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseSyslog(t *testing.T) {
+	for address, want := range map[string]string{
+		"udp://logs.example.com":      "udp logs.example.com:514",
+		"tcp://10.0.0.5:6514":         "tcp 10.0.0.5:6514",
+		"udp://[fd00::5]":             "udp [fd00::5]:514",
+		"logs.example.com:514":        "",
+		"https://logs.example.com":    "",
+		"udp://logs.example.com/path": "",
+	} {
+		network, addr, err := ParseSyslog(address)
+		got := network + " " + addr
+		if err != nil {
+			got = ""
+		}
+		if got != want {
+			t.Errorf("ParseSyslog(%q) = %q, %v, want %q", address, got, err, want)
+		}
+	}
+}
+
+func TestSetupSyslog(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	defer audit.Store(nil)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	closer, err := Setup(Options{Level: slog.LevelWarn, Syslog: "udp://" + conn.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	defer func() { _ = closer.Close() }()
+
+	Component(NAT).Info("skipped below the level")
+	Component(NAT).Warn("rules missing")
+	AuditLog().Info("pfctl", "actor", "alice", "target", "-a nat-manager -f -")
+
+	var messages []string
+	buf := make([]byte, 2048)
+	for range 2 {
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read: %v (got %q)", err, messages)
+		}
+		messages = append(messages, string(buf[:n]))
+	}
+	if !strings.HasPrefix(messages[0], "<28>") || !strings.Contains(messages[0], `nat-manager[`) ||
+		!strings.HasSuffix(strings.TrimSpace(messages[0]), `msg="rules missing" component=nat`) {
+		t.Errorf("warning = %q", messages[0])
+	}
+	if !strings.HasPrefix(messages[1], "<30>") || !strings.Contains(messages[1], `msg=pfctl component=audit actor=alice target="-a nat-manager -f -"`) {
+		t.Errorf("audit entry = %q", messages[1])
+	}
+}
@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+)
+
+// systemLog is the part of a syslog.Writer the system log handler uses
+type systemLog interface {
+	io.Closer
+	Debug(msg string) error
+	Info(msg string) error
+	Warning(msg string) error
+	Err(msg string) error
+}
+
+// openSyslog connects to the syslog server at addr over network, or with
+// no network to the local syslog daemon, which on macOS passes messages on
+// to the unified log
+func openSyslog(network, addr string) (systemLog, error) {
+	return syslog.Dial(network, addr, syslog.LOG_DAEMON|syslog.LOG_INFO, "nat-manager")
+}
+
+// syslogHandler sends records as text, without the time and level the
+// system log adds itself, with the priority of their level
+type syslogHandler struct {
+	log  systemLog
+	mu   *sync.Mutex
+	buf  *bytes.Buffer
+	text slog.Handler // writes to buf
+}
+
+func newSyslogHandler(log systemLog, level slog.Leveler) *syslogHandler {
+	buf := new(bytes.Buffer)
+	return &syslogHandler{
+		log: log,
+		mu:  new(sync.Mutex),
+		buf: buf,
+		text: slog.NewTextHandler(buf, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}),
+	}
+}
+
+func (h *syslogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.text.Enabled(ctx, level)
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.mu.Lock()
+	h.buf.Reset()
+	err := h.text.Handle(ctx, r)
+	msg := strings.TrimSuffix(h.buf.String(), "\n")
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.log.Err(msg)
+	case r.Level >= slog.LevelWarn:
+		return h.log.Warning(msg)
+	case r.Level >= slog.LevelInfo:
+		return h.log.Info(msg)
+	}
+	return h.log.Debug(msg)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{log: h.log, mu: h.mu, buf: h.buf, text: h.text.WithAttrs(attrs)}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{log: h.log, mu: h.mu, buf: h.buf, text: h.text.WithGroup(name)}
+}
@@ -0,0 +1,98 @@
+// Package mdns reflects multicast DNS service discovery between the host
+// network and the NAT network
+package mdns
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+)
+
+// DefaultServices are the service types reflected when none are configured:
+// AirPlay, printers, Chromecast and Spotify Connect
+var DefaultServices = []string{
+	"_airplay._tcp", "_raop._tcp",
+	"_ipp._tcp", "_ipps._tcp", "_printer._tcp", "_pdl-datastream._tcp",
+	"_googlecast._tcp", "_spotify-connect._tcp",
+}
+
+// hostTTL is how long a host advertised by an allowed service stays
+// allowed, so that its address records are reflected too
+const hostTTL = time.Hour
+
+// Filter decides which mDNS messages concern an allowed service type
+type Filter struct {
+	services []string
+
+	mu    sync.Mutex
+	hosts map[string]time.Time
+}
+
+// NewFilter creates a filter for service types such as _airplay._tcp
+func NewFilter(services []string) *Filter {
+	normalized := make([]string, 0, len(services))
+	for _, service := range services {
+		service = strings.ToLower(strings.TrimSuffix(strings.TrimSuffix(service, "."), ".local"))
+		if service != "" {
+			normalized = append(normalized, service+".local")
+		}
+	}
+	return &Filter{services: normalized, hosts: make(map[string]time.Time)}
+}
+
+// Allow reports whether a message asks about or advertises an allowed
+// service, or the address of a host offering one
+func (f *Filter) Allow(m *dns.Message, now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Learn the hosts behind allowed service instances first, as their
+	// address records usually travel in the same message
+	for _, record := range m.Records {
+		if record.Type == "SRV" && f.service(record.Name) {
+			f.hosts[normalize(record.Value)] = now.Add(hostTTL)
+		}
+	}
+
+	for _, q := range m.Questions {
+		if f.service(q.Name) || f.host(q.Name, now) {
+			return true
+		}
+	}
+	for _, record := range m.Records {
+		if f.service(record.Name) || f.service(record.Value) || f.host(record.Name, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// service reports whether name is an allowed service type, subtype or
+// instance
+func (f *Filter) service(name string) bool {
+	name = normalize(name)
+	for _, service := range f.services {
+		if name == service || strings.HasSuffix(name, "."+service) {
+			return true
+		}
+	}
+	return false
+}
+
+// host reports whether name is a host advertised by an allowed service.
+// The caller must hold f.mu.
+func (f *Filter) host(name string, now time.Time) bool {
+	name = normalize(name)
+	expires, ok := f.hosts[name]
+	if ok && now.After(expires) {
+		delete(f.hosts, name)
+		return false
+	}
+	return ok
+}
+
+func normalize(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,146 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+)
+
+// encodeName encodes a name in uncompressed wire format
+func encodeName(name string) []byte {
+	var buf []byte
+	for _, label := range strings.Split(name, ".") {
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
+
+// rr is a resource record for buildMessage; target is the PTR or SRV
+// target, ip the A record address
+type rr struct {
+	name, target string
+	rrType       uint16
+	ip           net.IP
+}
+
+// buildMessage builds an mDNS query with the QU bit set, or a response
+func buildMessage(response bool, questions []string, records []rr) []byte {
+	msg := make([]byte, 12)
+	if response {
+		binary.BigEndian.PutUint16(msg[2:4], 0x8400)
+	}
+	binary.BigEndian.PutUint16(msg[4:6], uint16(len(questions)))
+	binary.BigEndian.PutUint16(msg[6:8], uint16(len(records)))
+
+	for _, q := range questions {
+		msg = append(msg, encodeName(q)...)
+		msg = append(msg, 0, 12, 0x80, 1) // PTR, IN with unicast-response bit
+	}
+	for _, r := range records {
+		var rdata []byte
+		switch r.rrType {
+		case 1:
+			rdata = r.ip.To4()
+		case 12:
+			rdata = encodeName(r.target)
+		case 33:
+			rdata = append([]byte{0, 0, 0, 0, 0x1B, 0x58}, encodeName(r.target)...)
+		}
+		msg = append(msg, encodeName(r.name)...)
+		msg = binary.BigEndian.AppendUint16(msg, r.rrType)
+		msg = append(msg, 0, 1, 0, 0, 0, 120)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(rdata)))
+		msg = append(msg, rdata...)
+	}
+	return msg
+}
+
+func parse(t *testing.T, msg []byte) *dns.Message {
+	t.Helper()
+	m, err := dns.ParseMessage(msg)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	return m
+}
+
+func TestFilter(t *testing.T) {
+	filter := NewFilter([]string{"_airplay._tcp", "_ipp._tcp.local."})
+	now := time.Now()
+
+	testCases := []struct {
+		name     string
+		msg      []byte
+		expected bool
+	}{
+		{"browse allowed service", buildMessage(false, []string{"_airplay._tcp.local"}, nil), true},
+		{"browse subtype", buildMessage(false, []string{"_universal._sub._ipp._tcp.local"}, nil), true},
+		{"browse other service", buildMessage(false, []string{"_ssh._tcp.local"}, nil), false},
+		{"host before advertisement", buildMessage(false, []string{"Living-Room.local"}, nil), false},
+		{"advertisement", buildMessage(true, nil, []rr{
+			{name: "_airplay._tcp.local", rrType: 12, target: "Living Room._airplay._tcp.local"},
+			{name: "Living Room._airplay._tcp.local", rrType: 33, target: "Living-Room.local"},
+			{name: "Living-Room.local", rrType: 1, ip: net.IPv4(192, 168, 1, 40)},
+		}), true},
+		{"advertised host", buildMessage(false, []string{"living-room.local"}, nil), true},
+		{"other host", buildMessage(true, nil, []rr{{name: "nas.local", rrType: 1, ip: net.IPv4(192, 168, 1, 5)}}), false},
+	}
+
+	for _, tc := range testCases {
+		if got := filter.Allow(parse(t, tc.msg), now); got != tc.expected {
+			t.Errorf("%s: Allow = %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+
+	if filter.Allow(parse(t, buildMessage(false, []string{"Living-Room.local"}, nil)), now.Add(2*hostTTL)) {
+		t.Error("Advertised hosts should expire")
+	}
+}
+
+func TestProcess(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	l := &link{name: "en0", addrs: []net.IP{net.IPv4(192, 168, 1, 10)}, nets: []*net.IPNet{lan}}
+	r := &Reflector{filter: NewFilter(DefaultServices), links: []*link{l}}
+	query := buildMessage(false, []string{"_googlecast._tcp.local"}, nil)
+	now := time.Now()
+
+	from := func(ip string, port int) *net.UDPAddr { return &net.UDPAddr{IP: net.ParseIP(ip), Port: port} }
+	if r.process(l, query, from("192.168.1.10", 5353), now) != nil {
+		t.Error("Own messages must not be reflected")
+	}
+	if r.process(l, query, from("192.168.100.20", 5353), now) != nil {
+		t.Error("Messages from other networks must not be reflected")
+	}
+	if r.process(l, query, from("192.168.1.20", 49152), now) != nil {
+		t.Error("Legacy unicast queries must not be reflected")
+	}
+
+	msg := r.process(l, query, from("192.168.1.20", 5353), now)
+	if msg == nil {
+		t.Fatal("Allowed query was not reflected")
+	}
+	if class := binary.BigEndian.Uint16(msg[len(msg)-2:]); class != 1 {
+		t.Errorf("Unicast-response bit should be cleared, class = %#x", class)
+	}
+	if binary.BigEndian.Uint16(query[len(query)-2:]) == 1 {
+		t.Error("The received packet must not be modified")
+	}
+
+	if r.process(l, buildMessage(false, []string{"_ssh._tcp.local"}, nil), from("192.168.1.20", 5353), now) != nil {
+		t.Error("Services outside the allowlist must not be reflected")
+	}
+	if stats := r.Stats(); stats != (Stats{Received: 2, Reflected: 1, Filtered: 1}) {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestNewRequiresTwoInterfaces(t *testing.T) {
+	if _, err := New(Config{Interfaces: []string{"lo0"}}); err == nil {
+		t.Error("New should require two interfaces")
+	}
+}
@@ -0,0 +1,235 @@
+package mdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+)
+
+// mdnsGroup is the IPv4 mDNS multicast group
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// Config configures a reflector
+type Config struct {
+	Interfaces []string // at least two, e.g. en0 and bridge100
+	Services   []string // allowed service types, DefaultServices if empty
+}
+
+// Stats holds cumulative reflector counters
+type Stats struct {
+	Received  uint64
+	Reflected uint64
+	Filtered  uint64
+}
+
+// Reflector relays mDNS messages about allowed services between interfaces
+type Reflector struct {
+	filter *Filter
+	links  []*link
+
+	received  atomic.Uint64
+	reflected atomic.Uint64
+	filtered  atomic.Uint64
+}
+
+// link is one interface the reflector listens and sends on
+type link struct {
+	name  string
+	iface *net.Interface
+	addrs []net.IP     // own addresses, never reflected
+	nets  []*net.IPNet // networks whose senders are local to the link
+	conn  *net.UDPConn
+}
+
+// New creates a reflector for the configured interfaces
+func New(cfg Config) (*Reflector, error) {
+	if len(cfg.Interfaces) < 2 {
+		return nil, fmt.Errorf("mDNS reflection needs at least two interfaces")
+	}
+	services := cfg.Services
+	if len(services) == 0 {
+		services = DefaultServices
+	}
+
+	r := &Reflector{filter: NewFilter(services)}
+	for _, name := range cfg.Interfaces {
+		l, err := newLink(name)
+		if err != nil {
+			return nil, err
+		}
+		r.links = append(r.links, l)
+	}
+	return r, nil
+}
+
+// newLink looks up an interface and its IPv4 networks
+func newLink(name string) (*link, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", name, err)
+	}
+
+	l := &link{name: name, iface: iface}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			l.addrs = append(l.addrs, ipNet.IP.To4())
+			l.nets = append(l.nets, ipNet)
+		}
+	}
+	if len(l.addrs) == 0 {
+		return nil, fmt.Errorf("interface %s has no IPv4 address", name)
+	}
+	return l, nil
+}
+
+// owns reports whether a packet from src arrived from this link's network
+// and was not sent by this host
+func (l *link) owns(src net.IP) bool {
+	for _, addr := range l.addrs {
+		if addr.Equal(src) {
+			return false
+		}
+	}
+	for _, ipNet := range l.nets {
+		if ipNet.Contains(src) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats returns the reflector counters
+func (r *Reflector) Stats() Stats {
+	return Stats{
+		Received:  r.received.Load(),
+		Reflected: r.reflected.Load(),
+		Filtered:  r.filtered.Load(),
+	}
+}
+
+// Run reflects messages until ctx is cancelled
+func (r *Reflector) Run(ctx context.Context) error {
+	for _, l := range r.links {
+		conn, err := net.ListenMulticastUDP("udp4", l.iface, mdnsGroup)
+		if err != nil {
+			r.close()
+			return fmt.Errorf("failed to join mDNS group on %s: %w", l.name, err)
+		}
+		l.conn = conn
+		if err := setMulticastInterface(conn, l.addrs[0]); err != nil {
+			r.close()
+			return fmt.Errorf("failed to configure multicast on %s: %w", l.name, err)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		r.close()
+	}()
+
+	var wg sync.WaitGroup
+	for _, l := range r.links {
+		wg.Add(1)
+		go func(l *link) {
+			defer wg.Done()
+			r.serve(ctx, l)
+		}(l)
+	}
+	wg.Wait()
+	return nil
+}
+
+// serve reads messages arriving on l and sends allowed ones to the other
+// links
+func (r *Reflector) serve(ctx context.Context, l *link) {
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		msg := r.process(l, buf[:n], src, time.Now())
+		if msg == nil {
+			continue
+		}
+		for _, other := range r.links {
+			if other != l {
+				_, _ = other.conn.WriteToUDP(msg, mdnsGroup)
+			}
+		}
+	}
+}
+
+// process returns the message to reflect for a packet received on l, or
+// nil if it must not be reflected
+func (r *Reflector) process(l *link, packet []byte, src *net.UDPAddr, now time.Time) []byte {
+	// Legacy unicast queries from other ports expect a direct reply, which
+	// cannot cross the NAT boundary
+	if !l.owns(src.IP) || src.Port != mdnsGroup.Port {
+		return nil
+	}
+	r.received.Add(1)
+
+	m, err := dns.ParseMessage(packet)
+	if err != nil || !r.filter.Allow(m, now) {
+		r.filtered.Add(1)
+		return nil
+	}
+
+	msg := append([]byte(nil), packet...)
+	if !m.Response {
+		// Responders on the other side cannot unicast back to the querier
+		if err := dns.ClearUnicastResponse(msg); err != nil {
+			return nil
+		}
+	}
+	r.reflected.Add(1)
+	return msg
+}
+
+// close closes all sockets
+func (r *Reflector) close() {
+	for _, l := range r.links {
+		if l.conn != nil {
+			_ = l.conn.Close()
+		}
+	}
+}
+
+// setMulticastInterface sends the connection's multicast traffic out of the
+// interface with address ip and disables local loopback
+func setMulticastInterface(conn *net.UDPConn, ip net.IP) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var addr [4]byte
+	copy(addr[:], ip.To4())
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInet4Addr(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_IF, addr)
+		if sockErr == nil {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MULTICAST_LOOP, 0)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
@@ -0,0 +1,150 @@
+// Package metrics keeps latency histograms of the manager's own operations
+// and serves them in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram upper bounds in seconds, from a fast
+// sysctl to a pfctl call stuck on a busy system
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry the manager records into
+var Default = NewRegistry()
+
+// Registry holds histogram families
+type Registry struct {
+	mu       sync.Mutex
+	families []*HistogramVec
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// HistogramVec is a family of duration histograms told apart by one label
+type HistogramVec struct {
+	name    string
+	help    string
+	label   string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+// histogram is a single series of a family
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a duration histogram family on r
+func (r *Registry) NewHistogram(name, help, label string) *HistogramVec {
+	vec := &HistogramVec{
+		name:    name,
+		help:    help,
+		label:   label,
+		buckets: DefaultBuckets,
+		series:  make(map[string]*histogram),
+	}
+	r.mu.Lock()
+	r.families = append(r.families, vec)
+	r.mu.Unlock()
+	return vec
+}
+
+// Observe records a duration for the series labelled value
+func (v *HistogramVec) Observe(value string, d time.Duration) {
+	seconds := d.Seconds()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.series[value]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(v.buckets))}
+		v.series[value] = h
+	}
+	if i := sort.SearchFloat64s(v.buckets, seconds); i < len(v.buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// Since records the time elapsed since start, e.g.
+// defer vec.Since("start", time.Now())
+func (v *HistogramVec) Since(value string, start time.Time) {
+	v.Observe(value, time.Since(start))
+}
+
+// Count returns the number of observations of the series labelled value
+func (v *HistogramVec) Count(value string) uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok := v.series[value]; ok {
+		return h.count
+	}
+	return 0
+}
+
+// write renders the family in the Prometheus text format
+func (v *HistogramVec) write(w io.Writer) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	values := make([]string, 0, len(v.series))
+	for value := range v.series {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name)
+	for _, value := range values {
+		h := v.series[value]
+		label := fmt.Sprintf("%s=%q", v.label, value)
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "%s_bucket{%s,le=%q} %d\n", v.name, label, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&b, "%s_bucket{%s,le=\"+Inf\"} %d\n", v.name, label, h.count)
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", v.name, label, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", v.name, label, h.count)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Write renders every family in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]*HistogramVec{}, r.families...)
+	r.mu.Unlock()
+
+	for _, family := range families {
+		if err := family.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry for Prometheus to scrape
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = r.Write(w)
+	})
+}
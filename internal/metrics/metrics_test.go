@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	registry := NewRegistry()
+	vec := registry.NewHistogram("test_duration_seconds", "Test durations.", "op")
+	vec.Observe("start", 3*time.Millisecond)
+	vec.Observe("start", 200*time.Millisecond)
+	vec.Observe("start", time.Minute)
+	vec.Observe("stop", time.Millisecond)
+
+	if got := vec.Count("start"); got != 3 {
+		t.Errorf("Count(start) = %d, expected 3", got)
+	}
+
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	expected := []string{
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{op="start",le="0.0025"} 0`,
+		`test_duration_seconds_bucket{op="start",le="0.005"} 1`,
+		`test_duration_seconds_bucket{op="start",le="0.25"} 2`,
+		`test_duration_seconds_bucket{op="start",le="10"} 2`,
+		`test_duration_seconds_bucket{op="start",le="+Inf"} 3`,
+		`test_duration_seconds_sum{op="start"} 60.203`,
+		`test_duration_seconds_count{op="start"} 3`,
+		`test_duration_seconds_bucket{op="stop",le="0.001"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected %q in:\n%s", line, body)
+		}
+	}
+	if strings.Index(body, `op="start"`) > strings.Index(body, `op="stop"`) {
+		t.Errorf("Series must be sorted:\n%s", body)
+	}
+}
@@ -0,0 +1,124 @@
+package mqtt
+
+import (
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// message is a retained message to publish
+type message struct {
+	topic   string
+	payload map[string]any
+}
+
+// nodeID returns the Home Assistant node ID of the instance
+func (p *Publisher) nodeID() string {
+	return "nat_manager_" + unsafeRe.ReplaceAllString(p.opts.Instance, "_")
+}
+
+// discoveryTopic returns the topic of a discovery config
+func (p *Publisher) discoveryTopic(component, objectID string) string {
+	return p.opts.DiscoveryPrefix + "/" + component + "/" + p.nodeID() + "/" + objectID + "/config"
+}
+
+// entity returns the discovery config of an entity of device with the
+// given fields
+func (p *Publisher) entity(component, objectID, name string, device map[string]any, fields map[string]any) message {
+	payload := map[string]any{
+		"name":               name,
+		"unique_id":          p.nodeID() + "_" + objectID,
+		"availability_topic": p.topic("availability"),
+		"device":             device,
+	}
+	for key, value := range fields {
+		payload[key] = value
+	}
+	return message{topic: p.discoveryTopic(component, objectID), payload: payload}
+}
+
+// natDevice returns the Home Assistant device of the instance
+func (p *Publisher) natDevice() map[string]any {
+	name := "NAT Manager"
+	if p.opts.Instance != nat.DefaultInstance {
+		name += " " + p.opts.Instance
+	}
+	return map[string]any{
+		"identifiers":  []string{p.nodeID()},
+		"name":         name,
+		"manufacturer": "macos-nat-manager",
+		"model":        "macOS NAT",
+	}
+}
+
+// natDiscovery returns the discovery configs of the instance's entities
+func (p *Publisher) natDiscovery() []message {
+	device := p.natDevice()
+	status := p.topic("status")
+	data := func(template, deviceClass, unit, stateClass string) map[string]any {
+		fields := map[string]any{"state_topic": status, "value_template": template}
+		if deviceClass != "" {
+			fields["device_class"] = deviceClass
+		}
+		if unit != "" {
+			fields["unit_of_measurement"] = unit
+		}
+		if stateClass != "" {
+			fields["state_class"] = stateClass
+		}
+		return fields
+	}
+	return []message{
+		p.entity("binary_sensor", "nat", "NAT", device, map[string]any{
+			"state_topic":  p.topic("state"),
+			"payload_on":   stateOn,
+			"payload_off":  stateOff,
+			"device_class": "running",
+		}),
+		p.entity("sensor", "external_ip", "External IP", device, data("{{ value_json.external_ip }}", "", "", "")),
+		p.entity("sensor", "devices", "Devices online", device, data("{{ value_json.devices }}", "", "", "measurement")),
+		p.entity("sensor", "connections", "Connections", device, data("{{ value_json.connections }}", "", "", "measurement")),
+		p.entity("sensor", "bytes_in", "Downloaded", device, data("{{ value_json.bytes_in }}", "data_size", "B", "total_increasing")),
+		p.entity("sensor", "bytes_out", "Uploaded", device, data("{{ value_json.bytes_out }}", "data_size", "B", "total_increasing")),
+		p.entity("sensor", "rate_in", "Download rate", device, data("{{ value_json.rate_in | round(0) }}", "data_rate", "B/s", "measurement")),
+		p.entity("sensor", "rate_out", "Upload rate", device, data("{{ value_json.rate_out | round(0) }}", "data_rate", "B/s", "measurement")),
+	}
+}
+
+// deviceDiscovery returns the discovery configs of a device's presence
+// and traffic
+func (p *Publisher) deviceDiscovery(d nat.Device) []message {
+	id := deviceID(d)
+	device := map[string]any{
+		"identifiers": []string{p.nodeID() + "_" + id},
+		"name":        deviceName(d),
+		"via_device":  p.nodeID(),
+	}
+	if d.MAC != "" {
+		device["connections"] = [][]string{{"mac", d.MAC}}
+	}
+	if d.Vendor != "" {
+		device["manufacturer"] = d.Vendor
+	}
+	traffic := p.deviceTopic(id, "traffic")
+	counter := func(template string) map[string]any {
+		return map[string]any{
+			"state_topic":         traffic,
+			"value_template":      template,
+			"device_class":        "data_size",
+			"unit_of_measurement": "B",
+			"state_class":         "total_increasing",
+		}
+	}
+	return []message{
+		// A null name names the tracker after its device
+		p.entity("device_tracker", id, "", device, map[string]any{
+			"name":                  nil,
+			"state_topic":           p.deviceTopic(id, "presence"),
+			"payload_home":          home,
+			"payload_not_home":      notHome,
+			"source_type":           "router",
+			"json_attributes_topic": p.deviceTopic(id, "attributes"),
+		}),
+		p.entity("sensor", id+"_bytes_in", "Downloaded", device, counter("{{ value_json.bytes_in }}")),
+		p.entity("sensor", id+"_bytes_out", "Uploaded", device, counter("{{ value_json.bytes_out }}")),
+	}
+}
@@ -0,0 +1,334 @@
+// Package mqtt publishes the state of an instance, the presence of its
+// devices and their traffic to an MQTT broker, with Home Assistant
+// discovery configs so they show up as entities
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Defaults of Options
+const (
+	DefaultTopicPrefix     = "nat-manager"
+	DefaultDiscoveryPrefix = "homeassistant"
+	DefaultInterval        = 30 * time.Second
+)
+
+// Payloads of the state topics
+const (
+	online   = "online"
+	offline  = "offline"
+	stateOn  = "ON"
+	stateOff = "OFF"
+	home     = "home"
+	notHome  = "not_home"
+)
+
+// Broker limits
+const (
+	connectTimeout = 10 * time.Second
+	quiesce        = 1000 // milliseconds to finish publishing when closing
+)
+
+// Schemes lists the broker URL schemes understood
+var Schemes = []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}
+
+// unsafeRe matches what Home Assistant does not accept in discovery IDs
+var unsafeRe = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// Options configures a publisher
+type Options struct {
+	Broker          string // e.g. tcp://homeassistant.local:1883
+	Username        string
+	Password        string
+	Instance        string
+	TopicPrefix     string        // DefaultTopicPrefix if empty
+	HomeAssistant   bool          // publish discovery configs
+	DiscoveryPrefix string        // DefaultDiscoveryPrefix if empty
+	Interval        time.Duration // DefaultInterval if 0
+}
+
+// withDefaults returns o with its unset fields defaulted
+func (o Options) withDefaults() Options {
+	if o.Instance == "" {
+		o.Instance = nat.DefaultInstance
+	}
+	if o.TopicPrefix == "" {
+		o.TopicPrefix = DefaultTopicPrefix
+	}
+	if o.DiscoveryPrefix == "" {
+		o.DiscoveryPrefix = DefaultDiscoveryPrefix
+	}
+	if o.Interval <= 0 {
+		o.Interval = DefaultInterval
+	}
+	return o
+}
+
+// Source provides the state published
+type Source interface {
+	Status() (*nat.Status, error)
+	Devices() ([]nat.Device, error)
+	Traffic() (map[string]nat.Traffic, error) // by device address
+}
+
+// Publisher publishes to a broker. It is an event.Sink, passing events
+// on to the events topic.
+type Publisher struct {
+	opts    Options
+	client  paho.Client // nil when publishing elsewhere, as in tests
+	publish func(topic string, retained bool, payload []byte)
+	refresh chan struct{}
+	once    sync.Once
+
+	mu         sync.Mutex
+	announced  bool            // NAT discovery configs published
+	discovered map[string]bool // devices with discovery configs published
+	present    map[string]bool // devices published as home
+}
+
+var _ event.Sink = (*Publisher)(nil)
+
+// newPublisher returns a publisher passing its messages to publish
+func newPublisher(opts Options, publish func(topic string, retained bool, payload []byte)) *Publisher {
+	return &Publisher{
+		opts:       opts.withDefaults(),
+		publish:    publish,
+		refresh:    make(chan struct{}, 1),
+		discovered: make(map[string]bool),
+		present:    make(map[string]bool),
+	}
+}
+
+// Connect connects to the broker of opts. The broker marks the instance
+// offline if the connection is lost, and discovery configs are published
+// again on every reconnection.
+func Connect(opts Options) (*Publisher, error) {
+	p := newPublisher(opts, nil)
+	clientOpts := paho.NewClientOptions().
+		AddBroker(p.opts.Broker).
+		SetClientID(fmt.Sprintf("nat-manager-%s-%d", p.opts.Instance, os.Getpid())).
+		SetUsername(p.opts.Username).
+		SetPassword(p.opts.Password).
+		SetConnectTimeout(connectTimeout).
+		SetAutoReconnect(true).
+		SetWill(p.topic("availability"), offline, 1, true).
+		SetOnConnectHandler(func(paho.Client) {
+			p.mu.Lock()
+			p.announced = false
+			clear(p.discovered)
+			p.mu.Unlock()
+			p.publish(p.topic("availability"), true, []byte(online))
+		})
+	p.client = paho.NewClient(clientOpts)
+	p.publish = func(topic string, retained bool, payload []byte) {
+		p.client.Publish(topic, 1, retained, payload)
+	}
+
+	token := p.client.Connect()
+	if !token.WaitTimeout(connectTimeout) {
+		return nil, fmt.Errorf("timed out connecting to %s", p.opts.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", p.opts.Broker, err)
+	}
+	return p, nil
+}
+
+// Run publishes the state of src every interval, and right after events,
+// until ctx is done. onError, when set, is told about failed readings.
+func (p *Publisher) Run(ctx context.Context, src Source, onError func(error)) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Publish(src); err != nil && onError != nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.refresh:
+		}
+	}
+}
+
+// Publish publishes the state of the instance and its devices once
+func (p *Publisher) Publish(src Source) error {
+	status, err := src.Status()
+	if err != nil {
+		return fmt.Errorf("failed to read status: %w", err)
+	}
+	devices, err := src.Devices()
+	if err != nil {
+		return fmt.Errorf("failed to read devices: %w", err)
+	}
+	traffic, _ := src.Traffic()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.opts.HomeAssistant && !p.announced {
+		p.publishAll(p.natDiscovery())
+		p.announced = true
+	}
+	p.publishState(status.Active)
+	p.publishJSON(p.topic("status"), true, newStatusPayload(status, devices))
+
+	seen := make(map[string]bool)
+	for _, d := range devices {
+		id := deviceID(d)
+		seen[id] = true
+		if p.opts.HomeAssistant && !p.discovered[id] {
+			p.publishAll(p.deviceDiscovery(d))
+			p.discovered[id] = true
+		}
+		presence := notHome
+		if d.Online {
+			presence = home
+			p.present[id] = true
+		} else {
+			delete(p.present, id)
+		}
+		p.publish(p.deviceTopic(id, "presence"), true, []byte(presence))
+		p.publishJSON(p.deviceTopic(id, "attributes"), true, d)
+		p.publishJSON(p.deviceTopic(id, "traffic"), true, traffic[d.IP])
+	}
+	for id := range p.present {
+		if !seen[id] {
+			p.publish(p.deviceTopic(id, "presence"), true, []byte(notHome))
+			delete(p.present, id)
+		}
+	}
+	return nil
+}
+
+// Send publishes e to the events topic, updates the NAT state for
+// nat.started and nat.stopped, and has Run publish the rest again
+func (p *Publisher) Send(e event.Event) {
+	p.publishJSON(p.topic("events"), false, e)
+	switch e.Type {
+	case event.NATStarted:
+		p.publishState(true)
+	case event.NATStopped:
+		p.publishState(false)
+	}
+	select {
+	case p.refresh <- struct{}{}:
+	default:
+	}
+}
+
+// Close marks the instance offline and disconnects from the broker once
+// the messages published are sent
+func (p *Publisher) Close(context.Context) error {
+	p.once.Do(func() {
+		p.publish(p.topic("availability"), true, []byte(offline))
+		if p.client != nil {
+			p.client.Disconnect(quiesce)
+		}
+	})
+	return nil
+}
+
+// publishState publishes whether NAT is active
+func (p *Publisher) publishState(active bool) {
+	state := stateOff
+	if active {
+		state = stateOn
+	}
+	p.publish(p.topic("state"), true, []byte(state))
+}
+
+// publishJSON publishes v encoded as JSON
+func (p *Publisher) publishJSON(topic string, retained bool, v any) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	p.publish(topic, retained, payload)
+}
+
+// publishAll publishes retained messages
+func (p *Publisher) publishAll(messages []message) {
+	for _, m := range messages {
+		p.publishJSON(m.topic, true, m.payload)
+	}
+}
+
+// topic returns the topic name under the instance's topics
+func (p *Publisher) topic(name string) string {
+	return p.opts.TopicPrefix + "/" + p.opts.Instance + "/" + name
+}
+
+// deviceTopic returns the topic name under a device's topics
+func (p *Publisher) deviceTopic(id, name string) string {
+	return p.topic("devices/" + id + "/" + name)
+}
+
+// statusPayload is published to the status topic
+type statusPayload struct {
+	Active      bool    `json:"active"`
+	ExternalIP  string  `json:"external_ip"`
+	Uptime      string  `json:"uptime"`
+	Devices     int     `json:"devices"` // online
+	Connections int     `json:"connections"`
+	BytesIn     uint64  `json:"bytes_in"`
+	BytesOut    uint64  `json:"bytes_out"`
+	RateIn      float64 `json:"rate_in"` // bytes per second
+	RateOut     float64 `json:"rate_out"`
+}
+
+// newStatusPayload summarizes status and devices
+func newStatusPayload(status *nat.Status, devices []nat.Device) statusPayload {
+	payload := statusPayload{
+		Active:      status.Active,
+		ExternalIP:  status.ExternalIP,
+		Uptime:      status.Uptime,
+		Connections: len(status.ActiveConnections),
+		BytesIn:     status.BytesIn,
+		BytesOut:    status.BytesOut,
+	}
+	for _, d := range devices {
+		if d.Online {
+			payload.Devices++
+		}
+	}
+	if status.Throughput != nil {
+		payload.RateIn = status.Throughput.In
+		payload.RateOut = status.Throughput.Out
+	}
+	return payload
+}
+
+// deviceID returns the topic and discovery ID of a device: its MAC
+// address without colons, or its IP address without dots
+func deviceID(d nat.Device) string {
+	if d.MAC != "" {
+		return strings.ReplaceAll(strings.ToLower(d.MAC), ":", "")
+	}
+	return strings.ReplaceAll(d.IP, ".", "_")
+}
+
+// deviceName returns the name shown for a device
+func deviceName(d nat.Device) string {
+	switch {
+	case d.Hostname != "":
+		return d.Hostname
+	case d.MAC != "":
+		return d.MAC
+	default:
+		return d.IP
+	}
+}
@@ -0,0 +1,146 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// recorder keeps the last payload published to each topic
+type recorder struct {
+	messages map[string]string
+	retained map[string]bool
+}
+
+func newRecorder() *recorder {
+	return &recorder{messages: make(map[string]string), retained: make(map[string]bool)}
+}
+
+func (r *recorder) publish(topic string, retained bool, payload []byte) {
+	r.messages[topic] = string(payload)
+	r.retained[topic] = retained
+}
+
+type fakeSource struct {
+	status  nat.Status
+	devices []nat.Device
+	traffic map[string]nat.Traffic
+}
+
+func (s *fakeSource) Status() (*nat.Status, error)             { return &s.status, nil }
+func (s *fakeSource) Devices() ([]nat.Device, error)           { return s.devices, nil }
+func (s *fakeSource) Traffic() (map[string]nat.Traffic, error) { return s.traffic, nil }
+
+func TestPublish(t *testing.T) {
+	r := newRecorder()
+	p := newPublisher(Options{Instance: "lab", HomeAssistant: true}, r.publish)
+	src := &fakeSource{
+		status: nat.Status{Active: true, ExternalIP: "203.0.113.7", BytesIn: 2048, BytesOut: 1024,
+			Throughput: &ifstats.Throughput{In: 100, Out: 50}},
+		devices: []nat.Device{
+			{IP: "192.168.100.50", MAC: "AA:BB:CC:DD:EE:01", Hostname: "laptop", Vendor: "Apple", Online: true},
+			{IP: "192.168.100.51", Online: false},
+		},
+		traffic: map[string]nat.Traffic{"192.168.100.50": {BytesIn: 700, BytesOut: 300}},
+	}
+	if err := p.Publish(src); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	expected := map[string]string{
+		"nat-manager/lab/state":                                  "ON",
+		"nat-manager/lab/devices/aabbccddee01/presence":          "home",
+		"nat-manager/lab/devices/192_168_100_51/presence":        "not_home",
+		"nat-manager/lab/devices/aabbccddee01/traffic":           `{"bytes_in":700,"bytes_out":300,"packets_in":0,"packets_out":0}`,
+		"nat-manager/lab/devices/192_168_100_51/traffic":         `{"bytes_in":0,"bytes_out":0,"packets_in":0,"packets_out":0}`,
+		"nat-manager/lab/status":                                 `{"active":true,"external_ip":"203.0.113.7","uptime":"","devices":1,"connections":0,"bytes_in":2048,"bytes_out":1024,"rate_in":100,"rate_out":50}`,
+		"homeassistant/binary_sensor/nat_manager_lab/nat/config": "",
+	}
+	for topic, payload := range expected {
+		got, ok := r.messages[topic]
+		if !ok {
+			t.Errorf("nothing published to %s", topic)
+			continue
+		}
+		if payload != "" && got != payload {
+			t.Errorf("%s = %s, want %s", topic, got, payload)
+		}
+		if !r.retained[topic] {
+			t.Errorf("%s is not retained", topic)
+		}
+	}
+
+	var tracker map[string]any
+	if err := json.Unmarshal([]byte(r.messages["homeassistant/device_tracker/nat_manager_lab/aabbccddee01/config"]), &tracker); err != nil {
+		t.Fatalf("device tracker config: %v", err)
+	}
+	if tracker["name"] != nil || tracker["unique_id"] != "nat_manager_lab_aabbccddee01" ||
+		tracker["state_topic"] != "nat-manager/lab/devices/aabbccddee01/presence" {
+		t.Errorf("unexpected device tracker config %v", tracker)
+	}
+	device := tracker["device"].(map[string]any)
+	if device["name"] != "laptop" || device["manufacturer"] != "Apple" || device["via_device"] != "nat_manager_lab" {
+		t.Errorf("unexpected device %v", device)
+	}
+
+	// A device that disappeared is published as away once
+	src.devices = src.devices[1:]
+	r.messages = make(map[string]string)
+	if err := p.Publish(src); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := r.messages["nat-manager/lab/devices/aabbccddee01/presence"]; got != "not_home" {
+		t.Errorf("presence of departed device = %q, want not_home", got)
+	}
+	for topic := range r.messages {
+		if strings.HasPrefix(topic, "homeassistant/") {
+			t.Errorf("discovery config %s published again", topic)
+		}
+	}
+}
+
+func TestPublishWithoutDiscovery(t *testing.T) {
+	r := newRecorder()
+	p := newPublisher(Options{Instance: nat.DefaultInstance, TopicPrefix: "lab/nat"}, r.publish)
+	if err := p.Publish(&fakeSource{}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	for topic := range r.messages {
+		if !strings.HasPrefix(topic, "lab/nat/default/") {
+			t.Errorf("unexpected topic %s", topic)
+		}
+	}
+	if r.messages["lab/nat/default/state"] != "OFF" {
+		t.Errorf("state = %q, want OFF", r.messages["lab/nat/default/state"])
+	}
+}
+
+func TestSendAndClose(t *testing.T) {
+	r := newRecorder()
+	p := newPublisher(Options{Instance: "lab"}, r.publish)
+
+	p.Send(event.Event{Type: event.NATStopped, Instance: "lab"})
+	if r.messages["nat-manager/lab/state"] != "OFF" {
+		t.Errorf("state = %q, want OFF", r.messages["nat-manager/lab/state"])
+	}
+	if !strings.Contains(r.messages["nat-manager/lab/events"], `"event":"nat.stopped"`) || r.retained["nat-manager/lab/events"] {
+		t.Errorf("unexpected event message %q", r.messages["nat-manager/lab/events"])
+	}
+	select {
+	case <-p.refresh:
+	default:
+		t.Error("Send did not request a refresh")
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if r.messages["nat-manager/lab/availability"] != "offline" {
+		t.Errorf("availability = %q, want offline", r.messages["nat-manager/lab/availability"])
+	}
+}
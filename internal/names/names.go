@@ -0,0 +1,233 @@
+// Package names resolves friendly names for devices on the internal network
+// from several sources tried in priority order
+package names
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+)
+
+// Source names accepted by ParseSources
+const (
+	SourceLabel      = "label"
+	SourceDHCP       = "dhcp"
+	SourceMDNS       = "mdns"
+	SourceNetBIOS    = "netbios"
+	SourceReverseDNS = "reverse_dns"
+)
+
+// DefaultSources is the resolution order used when none is configured
+var DefaultSources = []string{SourceLabel, SourceDHCP, SourceMDNS, SourceNetBIOS, SourceReverseDNS}
+
+// DefaultTimeout bounds each network lookup
+const DefaultTimeout = 300 * time.Millisecond
+
+// cacheTTL is how long resolved names are reused; failed lookups are retried
+// sooner
+const (
+	cacheTTL         = 10 * time.Minute
+	negativeCacheTTL = time.Minute
+)
+
+// Device identifies a device to name
+type Device struct {
+	IP       string
+	MAC      string
+	Hostname string // as reported by DHCP
+}
+
+// Result is a resolved name and the source that provided it
+type Result struct {
+	Name   string
+	Source string
+}
+
+// Source looks up a device name, returning "" when it has none
+type Source interface {
+	Name() string
+	Lookup(ctx context.Context, device Device) string
+}
+
+// ValidateSources checks a configured resolution order
+func ValidateSources(sources []string) error {
+	_, err := ParseSources(sources, nil)
+	return err
+}
+
+// ParseSources builds the sources for a resolution order. Labels map MAC or
+// IP addresses to user-assigned names.
+func ParseSources(sources []string, labels map[string]string) ([]Source, error) {
+	result := make([]Source, 0, len(sources))
+	for _, name := range sources {
+		switch strings.ToLower(name) {
+		case SourceLabel:
+			result = append(result, NewLabels(labels))
+		case SourceDHCP:
+			result = append(result, dhcpSource{})
+		case SourceMDNS:
+			result = append(result, mdnsSource{port: "5353"})
+		case SourceNetBIOS:
+			result = append(result, netbiosSource{port: "137"})
+		case SourceReverseDNS:
+			result = append(result, reverseDNSSource{resolver: net.DefaultResolver})
+		default:
+			return nil, fmt.Errorf("unknown name source %q (valid: %s)", name, strings.Join(DefaultSources, ", "))
+		}
+	}
+	return result, nil
+}
+
+// Chain tries its sources in order and caches the results
+type Chain struct {
+	sources []Source
+	timeout time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+// cached is a cached resolution
+type cached struct {
+	result  Result
+	expires time.Time
+}
+
+// NewChain creates a resolver chain. Each source lookup is bounded by
+// timeout.
+func NewChain(sources []Source, timeout time.Duration) *Chain {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Chain{
+		sources: sources,
+		timeout: timeout,
+		cache:   make(map[string]cached),
+	}
+}
+
+// Resolve returns the first name any source knows for the device
+func (c *Chain) Resolve(ctx context.Context, device Device) Result {
+	key := strings.ToLower(device.IP + "|" + device.MAC + "|" + device.Hostname)
+
+	c.mu.Lock()
+	entry, ok := c.cache[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.result
+	}
+
+	result := c.lookup(ctx, device)
+	ttl := cacheTTL
+	if result.Name == "" {
+		ttl = negativeCacheTTL
+	}
+
+	c.mu.Lock()
+	c.cache[key] = cached{result: result, expires: time.Now().Add(ttl)}
+	c.mu.Unlock()
+	return result
+}
+
+// ResolveAll resolves devices concurrently, returning results in order
+func (c *Chain) ResolveAll(ctx context.Context, devices []Device) []Result {
+	results := make([]Result, len(devices))
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		go func(i int, device Device) {
+			defer wg.Done()
+			results[i] = c.Resolve(ctx, device)
+		}(i, device)
+	}
+	wg.Wait()
+	return results
+}
+
+// lookup queries the sources in order
+func (c *Chain) lookup(ctx context.Context, device Device) Result {
+	for _, source := range c.sources {
+		lookupCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		name := cleanName(source.Lookup(lookupCtx, device))
+		cancel()
+		if name != "" {
+			return Result{Name: name, Source: source.Name()}
+		}
+	}
+	return Result{}
+}
+
+// cleanName strips the trailing dot and the mDNS .local suffix
+func cleanName(name string) string {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	return strings.TrimSuffix(name, ".local")
+}
+
+// labelSource returns user-assigned names
+type labelSource map[string]string
+
+// NewLabels creates a source of user-assigned names keyed by MAC or IP
+func NewLabels(labels map[string]string) Source {
+	normalized := make(labelSource, len(labels))
+	for key, label := range labels {
+		normalized[strings.ToLower(key)] = label
+	}
+	return normalized
+}
+
+func (labelSource) Name() string { return SourceLabel }
+
+func (s labelSource) Lookup(_ context.Context, device Device) string {
+	if label, ok := s[strings.ToLower(device.MAC)]; ok && device.MAC != "" {
+		return label
+	}
+	return s[device.IP]
+}
+
+// dhcpSource returns the hostname the device sent with its DHCP request
+type dhcpSource struct{}
+
+func (dhcpSource) Name() string { return SourceDHCP }
+
+func (dhcpSource) Lookup(_ context.Context, device Device) string {
+	return device.Hostname
+}
+
+// mdnsSource asks the device itself over unicast mDNS for its name
+type mdnsSource struct {
+	port string
+}
+
+func (mdnsSource) Name() string { return SourceMDNS }
+
+func (s mdnsSource) Lookup(ctx context.Context, device Device) string {
+	ip := net.ParseIP(device.IP)
+	if ip == nil {
+		return ""
+	}
+	name, err := dns.LookupPTR(ctx, net.JoinHostPort(device.IP, s.port), ip)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// reverseDNSSource looks up the PTR record through the system resolver
+type reverseDNSSource struct {
+	resolver *net.Resolver
+}
+
+func (reverseDNSSource) Name() string { return SourceReverseDNS }
+
+func (s reverseDNSSource) Lookup(ctx context.Context, device Device) string {
+	names, err := s.resolver.LookupAddr(ctx, device.IP)
+	if err != nil || len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
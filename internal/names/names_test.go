@@ -0,0 +1,148 @@
+package names
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSource returns a fixed name and counts lookups
+type countingSource struct {
+	name  string
+	value string
+	calls *int32
+}
+
+func (s countingSource) Name() string { return s.name }
+
+func (s countingSource) Lookup(_ context.Context, _ Device) string {
+	atomic.AddInt32(s.calls, 1)
+	return s.value
+}
+
+func TestChainOrder(t *testing.T) {
+	labels := NewLabels(map[string]string{
+		"AA:BB:CC:DD:EE:01": "build-server",
+		"192.168.100.102":   "printer",
+	})
+	var calls int32
+	fallback := countingSource{name: "test", value: "fallback.local.", calls: &calls}
+	chain := NewChain([]Source{labels, dhcpSource{}, fallback}, time.Second)
+
+	testCases := []struct {
+		device   Device
+		expected Result
+	}{
+		{Device{IP: "192.168.100.101", MAC: "aa:bb:cc:dd:ee:01", Hostname: "ubuntu"}, Result{"build-server", SourceLabel}},
+		{Device{IP: "192.168.100.102", MAC: "aa:bb:cc:dd:ee:02"}, Result{"printer", SourceLabel}},
+		{Device{IP: "192.168.100.103", MAC: "aa:bb:cc:dd:ee:03", Hostname: "ipad"}, Result{"ipad", SourceDHCP}},
+		{Device{IP: "192.168.100.104", MAC: "aa:bb:cc:dd:ee:04"}, Result{"fallback", "test"}},
+	}
+
+	for _, tc := range testCases {
+		if got := chain.Resolve(context.Background(), tc.device); got != tc.expected {
+			t.Errorf("Resolve(%+v) = %+v, expected %+v", tc.device, got, tc.expected)
+		}
+	}
+
+	// Results are cached
+	chain.Resolve(context.Background(), testCases[3].device)
+	if calls != 1 {
+		t.Errorf("Expected 1 lookup of the last source, got %d", calls)
+	}
+}
+
+func TestResolveAll(t *testing.T) {
+	chain := NewChain([]Source{dhcpSource{}}, time.Second)
+	results := chain.ResolveAll(context.Background(), []Device{
+		{IP: "192.168.100.101", Hostname: "a"},
+		{IP: "192.168.100.102"},
+		{IP: "192.168.100.103", Hostname: "c"},
+	})
+
+	expected := []Result{{"a", SourceDHCP}, {}, {"c", SourceDHCP}}
+	for i := range expected {
+		if results[i] != expected[i] {
+			t.Errorf("results[%d] = %+v, expected %+v", i, results[i], expected[i])
+		}
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	sources, err := ParseSources(DefaultSources, nil)
+	if err != nil {
+		t.Fatalf("ParseSources failed: %v", err)
+	}
+	for i, source := range sources {
+		if source.Name() != DefaultSources[i] {
+			t.Errorf("Source %d is %s, expected %s", i, source.Name(), DefaultSources[i])
+		}
+	}
+
+	if err := ValidateSources([]string{"dhcp", "wins"}); err == nil {
+		t.Error("Unknown source should be rejected")
+	}
+}
+
+func TestMDNSSource(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		// Echo the question and answer it with lab-rpi-4.local
+		resp := append([]byte{}, buf[:n]...)
+		binary.BigEndian.PutUint16(resp[2:4], 0x8400)
+		binary.BigEndian.PutUint16(resp[6:8], 1)
+		target := []byte{9, 'l', 'a', 'b', '-', 'r', 'p', 'i', '-', '4', 5, 'l', 'o', 'c', 'a', 'l', 0}
+		resp = append(resp, 0xC0, 12, 0, 12, 0, 1, 0, 0, 0, 120, 0, byte(len(target)))
+		resp = append(resp, target...)
+		_, _ = conn.WriteTo(resp, addr)
+	}()
+
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	chain := NewChain([]Source{mdnsSource{port: port}}, time.Second)
+	got := chain.Resolve(context.Background(), Device{IP: "127.0.0.1"})
+	if got != (Result{"lab-rpi-4", SourceMDNS}) {
+		t.Errorf("Resolve = %+v, expected lab-rpi-4 from mdns", got)
+	}
+}
+
+func TestParseNodeStatus(t *testing.T) {
+	resp := make([]byte, 12)
+	binary.BigEndian.PutUint16(resp[6:8], 1)
+	resp = append(resp, nodeStatusQuery(0)[12:46]...)
+	resp = append(resp, 0, 0x21, 0, 1, 0, 0, 0, 0, 0, 0)
+
+	entry := func(name string, suffix byte, flags uint16) []byte {
+		e := []byte(name + "               ")[:15]
+		e = append(e, suffix)
+		return binary.BigEndian.AppendUint16(e, flags)
+	}
+	resp = append(resp, 3)
+	resp = append(resp, entry("WORKGROUP", 0x00, 0x8400)...)
+	resp = append(resp, entry("DESKTOP-7QK2", 0x20, 0x0400)...)
+	resp = append(resp, entry("DESKTOP-7QK2", 0x00, 0x0400)...)
+
+	name, err := parseNodeStatus(resp)
+	if err != nil {
+		t.Fatalf("parseNodeStatus failed: %v", err)
+	}
+	if name != "DESKTOP-7QK2" {
+		t.Errorf("Expected DESKTOP-7QK2, got %q", name)
+	}
+
+	if _, err := parseNodeStatus(resp[:60]); err == nil {
+		t.Error("Truncated response should fail")
+	}
+}
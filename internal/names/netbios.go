@@ -0,0 +1,105 @@
+package names
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"strings"
+)
+
+// nbstatType is the NetBIOS node status query type
+const nbstatType uint16 = 0x21
+
+var errMalformed = errors.New("malformed NetBIOS response")
+
+// netbiosSource asks the device for its NetBIOS workstation name, which
+// Windows machines and Samba servers answer
+type netbiosSource struct {
+	port string
+}
+
+func (netbiosSource) Name() string { return SourceNetBIOS }
+
+func (s netbiosSource) Lookup(ctx context.Context, device Device) string {
+	if net.ParseIP(device.IP).To4() == nil {
+		return ""
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(device.IP, s.port))
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = conn.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	id := uint16(rand.Uint32()) // #nosec G404 -- transaction ID, not a secret
+	if _, err := conn.Write(nodeStatusQuery(id)); err != nil {
+		return ""
+	}
+
+	resp := make([]byte, 1500)
+	n, err := conn.Read(resp)
+	if err != nil || n < 2 || binary.BigEndian.Uint16(resp[0:2]) != id {
+		return ""
+	}
+	name, _ := parseNodeStatus(resp[:n])
+	return name
+}
+
+// nodeStatusQuery builds a node status request for the wildcard name "*"
+func nodeStatusQuery(id uint16) []byte {
+	query := make([]byte, 12, 50)
+	binary.BigEndian.PutUint16(query[0:2], id)
+	binary.BigEndian.PutUint16(query[4:6], 1)
+
+	// First-level encoding of "*" padded with NULs to 16 bytes
+	query = append(query, 32)
+	for i := 0; i < 16; i++ {
+		b := byte(0)
+		if i == 0 {
+			b = '*'
+		}
+		query = append(query, 'A'+b>>4, 'A'+b&0x0F)
+	}
+	query = append(query, 0)
+	query = binary.BigEndian.AppendUint16(query, nbstatType)
+	return binary.BigEndian.AppendUint16(query, 1)
+}
+
+// parseNodeStatus returns the unique workstation name (suffix 0x00) from a
+// node status response
+func parseNodeStatus(msg []byte) (string, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg[6:8]) == 0 {
+		return "", errMalformed
+	}
+
+	off := 12
+	for off < len(msg) && msg[off] != 0 {
+		off += 1 + int(msg[off])
+	}
+	// Skip the terminating zero, type, class, TTL and rdata length
+	off += 1 + 10
+	if off >= len(msg) {
+		return "", errMalformed
+	}
+
+	count := int(msg[off])
+	off++
+	for i := 0; i < count; i++ {
+		if off+18 > len(msg) {
+			return "", errMalformed
+		}
+		entry := msg[off : off+18]
+		group := binary.BigEndian.Uint16(entry[16:18])&0x8000 != 0
+		if entry[15] == 0x00 && !group {
+			return strings.TrimRight(string(entry[:15]), " \x00"), nil
+		}
+		off += 18
+	}
+	return "", errors.New("no workstation name")
+}
@@ -0,0 +1,331 @@
+package nat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
+)
+
+// accountingTable is the pf table counting the traffic of each device
+const accountingTable = "nat_manager_accounting"
+
+// accountingFile holds the traffic ledger of the running instance
+const accountingFile = "accounting.json"
+
+// The ledger keeps a sample of the totals per minute for a day
+const (
+	accountingResolution = time.Minute
+	accountingRetention  = 25 * time.Hour
+)
+
+// Traffic counts bytes and packets. In is traffic received by a device or
+// over an uplink, out is traffic sent.
+type Traffic struct {
+	BytesIn    uint64 `json:"bytes_in"`
+	BytesOut   uint64 `json:"bytes_out"`
+	PacketsIn  uint64 `json:"packets_in"`
+	PacketsOut uint64 `json:"packets_out"`
+}
+
+// add returns the sum of two counts
+func (t Traffic) add(o Traffic) Traffic {
+	return Traffic{t.BytesIn + o.BytesIn, t.BytesOut + o.BytesOut, t.PacketsIn + o.PacketsIn, t.PacketsOut + o.PacketsOut}
+}
+
+// Since returns the traffic counted after the counters stood at previous,
+// or all of t when the counters were reset in between
+func (t Traffic) Since(previous Traffic) Traffic {
+	if t.BytesIn < previous.BytesIn || t.BytesOut < previous.BytesOut ||
+		t.PacketsIn < previous.PacketsIn || t.PacketsOut < previous.PacketsOut {
+		return t
+	}
+	return Traffic{t.BytesIn - previous.BytesIn, t.BytesOut - previous.BytesOut,
+		t.PacketsIn - previous.PacketsIn, t.PacketsOut - previous.PacketsOut}
+}
+
+// DeviceUsage is the traffic of a device over a window
+type DeviceUsage struct {
+	IP       string `json:"ip"`
+	MAC      string `json:"mac,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	Traffic
+}
+
+// UplinkUsage is the traffic over an uplink interface over a window
+type UplinkUsage struct {
+	Interface string `json:"interface"`
+	Traffic
+}
+
+// Usage is the traffic of the devices and uplinks between two times
+type Usage struct {
+	Since   time.Time     `json:"since"`
+	Until   time.Time     `json:"until"`
+	Devices []DeviceUsage `json:"devices"`
+	Uplinks []UplinkUsage `json:"uplinks"`
+}
+
+// ledgerSample holds traffic by device address and uplink interface
+type ledgerSample struct {
+	Time    time.Time          `json:"time"`
+	Devices map[string]Traffic `json:"devices"`
+	Uplinks map[string]Traffic `json:"uplinks"`
+}
+
+// ledger accumulates the counters of pf and the kernel, which are reset
+// when the anchor is reloaded or the Mac restarts, into totals since NAT
+// started, keeping a history of the totals to report usage over a window
+type ledger struct {
+	Started  time.Time      `json:"started"`
+	Counters ledgerSample   `json:"counters"` // raw counters at the last sample
+	Totals   ledgerSample   `json:"totals"`
+	History  []ledgerSample `json:"history"`
+}
+
+// newLedger starts a ledger at the given counters
+func newLedger(now time.Time, devices, uplinks map[string]Traffic) *ledger {
+	zero := ledgerSample{Time: now, Devices: map[string]Traffic{}, Uplinks: map[string]Traffic{}}
+	return &ledger{
+		Started:  now,
+		Counters: ledgerSample{Time: now, Devices: devices, Uplinks: uplinks},
+		Totals:   zero,
+		History:  []ledgerSample{zero},
+	}
+}
+
+// accumulate adds the growth of the counters since previous to totals
+func accumulate(totals, previous, current map[string]Traffic) map[string]Traffic {
+	next := make(map[string]Traffic, len(totals))
+	maps.Copy(next, totals)
+	for key, counters := range current {
+		next[key] = next[key].add(counters.Since(previous[key]))
+	}
+	return next
+}
+
+// record adds a sample of the counters
+func (l *ledger) record(now time.Time, devices, uplinks map[string]Traffic) {
+	l.Totals = ledgerSample{
+		Time:    now,
+		Devices: accumulate(l.Totals.Devices, l.Counters.Devices, devices),
+		Uplinks: accumulate(l.Totals.Uplinks, l.Counters.Uplinks, uplinks),
+	}
+	l.Counters = ledgerSample{Time: now, Devices: devices, Uplinks: uplinks}
+
+	if n := len(l.History); n == 0 || now.Sub(l.History[n-1].Time) >= accountingResolution {
+		l.History = append(l.History, l.Totals)
+	}
+	for len(l.History) > 1 && now.Sub(l.History[0].Time) > accountingRetention {
+		l.History = l.History[1:]
+	}
+}
+
+// usage returns the traffic since the last sample at or before since, or
+// since the oldest sample kept
+func (l *ledger) usage(since time.Time) Usage {
+	base := ledgerSample{Time: l.Started}
+	for i, sample := range l.History {
+		if i > 0 && sample.Time.After(since) {
+			break
+		}
+		base = sample
+	}
+
+	usage := Usage{Since: base.Time, Until: l.Totals.Time, Devices: []DeviceUsage{}, Uplinks: []UplinkUsage{}}
+	for ip, total := range l.Totals.Devices {
+		usage.Devices = append(usage.Devices, DeviceUsage{IP: ip, Traffic: total.Since(base.Devices[ip])})
+	}
+	for name, total := range l.Totals.Uplinks {
+		usage.Uplinks = append(usage.Uplinks, UplinkUsage{Interface: name, Traffic: total.Since(base.Uplinks[name])})
+	}
+	sort.Slice(usage.Devices, func(i, j int) bool { return ipLess(usage.Devices[i].IP, usage.Devices[j].IP) })
+	sort.Slice(usage.Uplinks, func(i, j int) bool { return usage.Uplinks[i].Interface < usage.Uplinks[j].Interface })
+	return usage
+}
+
+// accountingTableRule declares the accounting table with the leased
+// addresses
+func accountingTableRule(leases []Lease) string {
+	ips := make([]string, 0, len(leases))
+	for _, lease := range leases {
+		ips = append(ips, lease.IP)
+	}
+	sort.Strings(ips)
+	if len(ips) == 0 {
+		return fmt.Sprintf("table <%s> counters persist\n", accountingTable)
+	}
+	return fmt.Sprintf("table <%s> counters persist { %s }\n", accountingTable, strings.Join(ips, " "))
+}
+
+// accountingFilter counts the traffic of the devices in the accounting
+// table. The rules are not quick, so traffic passed by an earlier quick
+// rule, such as lockdown's allowed destinations, is not counted.
+func accountingFilter(cfg *Config) string {
+	return fmt.Sprintf("pass in on %s from <%s> to any\n", cfg.InternalInterface, accountingTable) +
+		fmt.Sprintf("pass out on %s from any to <%s>\n", cfg.InternalInterface, accountingTable)
+}
+
+// parseTableCounters parses the output of "pfctl -T show -v" into the
+// traffic of each address. Traffic passed in on the internal interface was
+// sent by the device.
+func parseTableCounters(r io.Reader) map[string]Traffic {
+	counters := make(map[string]Traffic)
+	var address string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// In/Pass:     [ Packets: 120                Bytes: 9800               ]
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 1 && net.ParseIP(fields[0]) != nil:
+			address = fields[0]
+			counters[address] = Traffic{}
+		case len(fields) >= 6 && address != "" && fields[2] == "Packets:" && fields[4] == "Bytes:":
+			packets, _ := strconv.ParseUint(fields[3], 10, 64)
+			bytes, _ := strconv.ParseUint(fields[5], 10, 64)
+			traffic := counters[address]
+			switch fields[0] {
+			case "In/Pass:":
+				traffic.PacketsOut, traffic.BytesOut = packets, bytes
+			case "Out/Pass:":
+				traffic.PacketsIn, traffic.BytesIn = packets, bytes
+			}
+			counters[address] = traffic
+		}
+	}
+	return counters
+}
+
+// readCounters returns the current counters of the devices and the uplink,
+// adding devices that got an address since the rules were loaded
+func (m *Manager) readCounters() (devices, uplinks map[string]Traffic) {
+	var ips []string
+	if leases, err := m.GetLeases(); err == nil {
+		for _, lease := range leases {
+			ips = append(ips, lease.IP)
+		}
+	}
+	for _, entry := range m.arpTable() {
+		if entry.IP != m.config.InternalNetwork+".1" {
+			ips = append(ips, entry.IP)
+		}
+	}
+	_ = m.updateTable(accountingTable, "add", ips)
+
+	output := commandOutput("pfctl", "-a", m.anchorName(), "-t", accountingTable, "-T", "show", "-v")
+	devices = parseTableCounters(strings.NewReader(output))
+	uplinks = make(map[string]Traffic)
+	if c, err := ifstats.Read(m.config.ExternalInterface); err == nil {
+		uplinks[c.Interface] = Traffic{c.BytesIn, c.BytesOut, c.PacketsIn, c.PacketsOut}
+	}
+	return devices, uplinks
+}
+
+// DeviceTraffic returns the current counters of each device by address.
+// They run since the rules were loaded; compare two readings with Since.
+func (m *Manager) DeviceTraffic() map[string]Traffic {
+	if m.config == nil {
+		return map[string]Traffic{}
+	}
+	devices, _ := m.readCounters()
+	return devices
+}
+
+// resetAccounting starts a new ledger at the current counters
+func (m *Manager) resetAccounting() error {
+	devices, uplinks := m.readCounters()
+	return saveLedger(m.runtimePath(accountingFile), newLedger(time.Now(), devices, uplinks))
+}
+
+// SampleAccounting adds the current counters to the ledger
+func (m *Manager) SampleAccounting() error {
+	path := m.runtimePath(accountingFile)
+	devices, uplinks := m.readCounters()
+	l, err := loadLedger(path)
+	if err != nil {
+		return saveLedger(path, newLedger(time.Now(), devices, uplinks))
+	}
+	l.record(time.Now(), devices, uplinks)
+	return saveLedger(path, l)
+}
+
+// Usage returns the traffic of each device and uplink over the last window,
+// or since NAT started if window is zero
+func (m *Manager) Usage(window time.Duration) (*Usage, error) {
+	if m.config == nil {
+		return nil, fmt.Errorf("NAT config is nil")
+	}
+	if err := m.SampleAccounting(); err != nil {
+		return nil, err
+	}
+	l, err := loadLedger(m.runtimePath(accountingFile))
+	if err != nil {
+		return nil, err
+	}
+
+	since := l.Started
+	if window > 0 {
+		since = time.Now().Add(-window)
+	}
+	usage := l.usage(since)
+	leases, _ := m.GetLeases()
+	byIP := make(map[string]Lease, len(leases))
+	for _, lease := range leases {
+		byIP[lease.IP] = lease
+	}
+	for i, device := range usage.Devices {
+		usage.Devices[i].MAC = strings.ToLower(byIP[device.IP].MAC)
+		usage.Devices[i].Hostname = byIP[device.IP].Hostname
+	}
+	return &usage, nil
+}
+
+// maintainAccounting samples the counters into the ledger until ctx is done
+func (m *Manager) maintainAccounting(ctx context.Context) {
+	ticker := time.NewTicker(accountingResolution)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = m.SampleAccounting()
+		}
+	}
+}
+
+// loadLedger reads the traffic ledger
+func loadLedger(path string) (*ledger, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read traffic ledger: %w", err)
+	}
+	var l ledger
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse traffic ledger: %w", err)
+	}
+	return &l, nil
+}
+
+// saveLedger replaces the traffic ledger
+func saveLedger(path string, l *ledger) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write traffic ledger: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,403 @@
+package nat
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DHCP and DNS server backends
+const (
+	BackendDnsmasq = "dnsmasq"
+	BackendKea     = "kea"
+	BackendCoreDNS = "coredns"
+)
+
+// Server binaries, overridden in tests
+var (
+	dnsmasqBinary = "dnsmasq"
+	keaBinary     = "kea-dhcp4"
+	corednsBinary = "coredns"
+)
+
+// embeddedDNS names the embedded DNS forwarder among the supervised servers
+const embeddedDNS = "forwarder"
+
+// corednsHostsFile holds the local zone served by CoreDNS
+const corednsHostsFile = "coredns-hosts"
+
+// Server is a DHCP or DNS server run under the supervisor
+type Server interface {
+	// Name names the server and its runtime files
+	Name() string
+	// Render returns the server's configuration file
+	Render(m *Manager, script string) (string, error)
+	// Command returns the command running the server in the foreground
+	Command(ctx context.Context, m *Manager) *exec.Cmd
+}
+
+// ValidateBackends checks the DHCP and DNS backend names
+func ValidateBackends(dhcp, dns string, embedded bool) error {
+	var errs []error
+	switch dhcp {
+	case "", BackendDnsmasq, BackendKea:
+	default:
+		errs = append(errs, fmt.Errorf("unknown DHCP backend %q (dnsmasq or kea)", dhcp))
+	}
+	switch dns {
+	case "", BackendDnsmasq:
+	case BackendCoreDNS:
+		if embedded {
+			errs = append(errs, fmt.Errorf("the coredns DNS backend cannot be used with the embedded DNS forwarder"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown DNS backend %q (dnsmasq or coredns)", dns))
+	}
+	return errors.Join(errs...)
+}
+
+// dhcpBackend returns the configured DHCP backend
+func (m *Manager) dhcpBackend() string {
+	if m.config.DHCPBackend == "" {
+		return BackendDnsmasq
+	}
+	return m.config.DHCPBackend
+}
+
+// dnsBackend returns the configured DNS backend
+func (m *Manager) dnsBackend() string {
+	if m.config.DNSBackend == "" {
+		return BackendDnsmasq
+	}
+	return m.config.DNSBackend
+}
+
+// servesDNS reports whether dnsmasq answers DNS on the gateway
+func (m *Manager) servesDNS() bool {
+	return !m.config.EmbeddedDNS && m.dnsBackend() == BackendDnsmasq
+}
+
+// servers returns the servers this instance runs, the DHCP server first.
+// dnsmasq serves both unless another backend takes over one of them.
+func (m *Manager) servers() []Server {
+	var servers []Server
+	if m.dhcpBackend() == BackendKea {
+		servers = append(servers, keaServer{})
+		if m.servesDNS() {
+			servers = append(servers, dnsmasqServer{})
+		}
+	} else {
+		servers = append(servers, dnsmasqServer{})
+	}
+	if m.dnsBackend() == BackendCoreDNS && !m.config.EmbeddedDNS {
+		servers = append(servers, corednsServer{})
+	}
+	if m.config.EmbeddedDNS {
+		servers = append(servers, forwarderServer{})
+	}
+	return servers
+}
+
+// ServerBinaries returns the binaries of the DHCP and DNS servers this
+// instance runs
+func (m *Manager) ServerBinaries() []string {
+	binaries := map[string]string{
+		BackendDnsmasq: dnsmasqBinary,
+		BackendKea:     keaBinary,
+		BackendCoreDNS: corednsBinary,
+	}
+	var tools []string
+	for _, server := range m.servers() {
+		if binary, ok := binaries[server.Name()]; ok {
+			tools = append(tools, binary)
+		}
+	}
+	return tools
+}
+
+// dnsmasqServer runs dnsmasq for DHCP, DNS or both
+type dnsmasqServer struct{}
+
+func (dnsmasqServer) Name() string { return BackendDnsmasq }
+
+func (dnsmasqServer) Render(m *Manager, script string) (string, error) {
+	options, err := m.dnsmasqOptions(script)
+	if err != nil {
+		return "", err
+	}
+	return renderDnsmasqConf(options, m.runtimePath(BackendDnsmasq+pidSuffix)), nil
+}
+
+func (dnsmasqServer) Command(ctx context.Context, m *Manager) *exec.Cmd {
+	return exec.CommandContext(ctx, dnsmasqBinary, "--conf-file="+m.runtimePath(BackendDnsmasq+confSuffix))
+}
+
+// keaServer runs the ISC Kea DHCPv4 server
+type keaServer struct{}
+
+func (keaServer) Name() string { return BackendKea }
+
+func (keaServer) Render(m *Manager, _ string) (string, error) {
+	return renderKeaConf(m.config)
+}
+
+func (keaServer) Command(ctx context.Context, m *Manager) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, keaBinary, "-c", m.runtimePath(BackendKea+confSuffix))
+	cmd.Env = append(os.Environ(),
+		"KEA_PIDFILE_DIR="+m.runtimePath(""),
+		"KEA_LOCKFILE_DIR=none")
+	return cmd
+}
+
+// leaseSeconds converts a dnsmasq lease duration into seconds
+func leaseSeconds(lease string) (int64, error) {
+	switch lease {
+	case "":
+		return 3600, nil
+	case "infinite":
+		return 4294967295, nil
+	}
+	if err := ValidateLeaseTime(lease); err != nil {
+		return 0, err
+	}
+
+	unit := int64(1)
+	units := map[byte]int64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	if u, ok := units[lease[len(lease)-1]]; ok {
+		unit, lease = u, lease[:len(lease)-1]
+	}
+	n, err := strconv.ParseInt(lease, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * unit, nil
+}
+
+// renderKeaConf renders a kea-dhcp4 configuration serving the pool with
+// the gateway as router and DNS server
+func renderKeaConf(cfg *Config) (string, error) {
+	if len(cfg.DeviceLeases) > 0 {
+		return "", fmt.Errorf("per-device lease times and reservations are not supported with the kea backend")
+	}
+	segments, err := poolSegments(cfg.InternalNetwork, cfg.DHCPRange)
+	if err != nil {
+		return "", err
+	}
+	lifetime, err := leaseSeconds(cfg.DHCPRange.Lease)
+	if err != nil {
+		return "", err
+	}
+
+	type object = map[string]any
+	pools := make([]object, 0, len(segments))
+	for _, segment := range segments {
+		pools = append(pools, object{"pool": ipString(segment[0]) + " - " + ipString(segment[1])})
+	}
+	gateway := cfg.InternalNetwork + ".1"
+	options := []object{
+		{"name": "routers", "data": gateway},
+		{"name": "domain-name-servers", "data": gateway},
+	}
+	if cfg.LocalDomain != "" {
+		options = append(options, object{"name": "domain-name", "data": cfg.LocalDomain})
+	}
+	if len(cfg.SearchDomains) > 0 {
+		options = append(options, object{"name": "domain-search", "data": strings.Join(cfg.SearchDomains, ", ")})
+	}
+	if len(cfg.NTPServers) > 0 {
+		options = append(options, object{"name": "ntp-servers", "data": strings.Join(cfg.NTPServers, ", ")})
+	}
+
+	conf := object{"Dhcp4": object{
+		"interfaces-config": object{"interfaces": []string{cfg.InternalInterface}},
+		"lease-database": object{
+			"type":         "memfile",
+			"name":         cfg.LeaseFile,
+			"lfc-interval": 3600,
+		},
+		"valid-lifetime": lifetime,
+		"subnet4": []object{{
+			"id":          1,
+			"subnet":      cfg.InternalNetwork + ".0/24",
+			"pools":       pools,
+			"option-data": options,
+		}},
+		"loggers": []object{{
+			"name":           "kea-dhcp4",
+			"severity":       "INFO",
+			"output-options": []object{{"output": "stdout"}},
+		}},
+	}}
+	data, err := json.MarshalIndent(conf, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to render kea config: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// ParseKeaLeases parses a Kea memfile lease database. Kea appends a line on
+// every lease change, so later lines replace earlier ones for an address,
+// and released or expired leases are dropped.
+func ParseKeaLeases(r io.Reader) ([]Lease, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return []Lease{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read leases: %w", err)
+	}
+	column := make(map[string]int, len(header))
+	for i, name := range header {
+		column[name] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := column[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	byIP := make(map[string]Lease)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read leases: %w", err)
+		}
+
+		ip := field(record, "address")
+		if state := field(record, "state"); (state != "" && state != "0") || field(record, "valid_lifetime") == "0" {
+			delete(byIP, ip)
+			continue
+		}
+		lease := Lease{MAC: field(record, "hwaddr"), IP: ip, Hostname: strings.TrimSuffix(field(record, "hostname"), ".")}
+		if expiry, err := strconv.ParseInt(field(record, "expire"), 10, 64); err == nil && expiry > 0 {
+			lease.Expiry = time.Unix(expiry, 0)
+		}
+		byIP[ip] = lease
+	}
+
+	leases := make([]Lease, 0, len(byIP))
+	for _, lease := range byIP {
+		leases = append(leases, lease)
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].IP < leases[j].IP })
+	return leases, nil
+}
+
+// corednsServer runs CoreDNS answering DNS on the gateway
+type corednsServer struct{}
+
+func (corednsServer) Name() string { return BackendCoreDNS }
+
+func (corednsServer) Render(m *Manager, _ string) (string, error) {
+	return renderCorefile(m.config, m.runtimePath(corednsHostsFile)), nil
+}
+
+func (corednsServer) Command(ctx context.Context, m *Manager) *exec.Cmd {
+	return exec.CommandContext(ctx, corednsBinary, "-conf", m.runtimePath(BackendCoreDNS+confSuffix))
+}
+
+// forwarderServer runs the embedded DNS forwarder, 'nat-manager dns serve',
+// which reads the instance's configuration itself
+type forwarderServer struct{}
+
+func (forwarderServer) Name() string { return embeddedDNS }
+
+func (forwarderServer) Render(_ *Manager, _ string) (string, error) {
+	return "# DNS is answered by nat-manager dns serve from the instance configuration\n", nil
+}
+
+func (forwarderServer) Command(ctx context.Context, m *Manager) *exec.Cmd {
+	return exec.CommandContext(ctx, m.config.Executable, "--instance", m.instanceName(), "dns", "serve", "--supervised")
+}
+
+// renderCorefile renders a Corefile answering on the gateway from the hosts
+// file of local records and forwarding everything else
+func renderCorefile(cfg *Config, hostsFile string) string {
+	gateway := cfg.InternalNetwork + ".1"
+	upstreams := strings.Join(cfg.DNSServers, " ")
+	if upstreams == "" {
+		upstreams = "/etc/resolv.conf"
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by nat-manager, changes are overwritten on start\n")
+	block := func(zone string, body ...string) {
+		fmt.Fprintf(&b, "%s:53 {\n    bind %s\n", zone, gateway)
+		for _, line := range body {
+			b.WriteString("    " + line + "\n")
+		}
+		b.WriteString("    errors\n    log\n}\n")
+	}
+
+	block(".",
+		"hosts "+hostsFile+" {\n        reload 10s\n        fallthrough\n    }",
+		"forward . "+upstreams,
+		"cache")
+	if cfg.LocalDomain != "" {
+		block(cfg.LocalDomain, "hosts "+hostsFile+" {\n        reload 10s\n    }")
+	}
+
+	domains := make([]string, 0, len(cfg.DomainServers))
+	for domain := range cfg.DomainServers {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		block(domain, "forward . "+strings.Join(cfg.DomainServers[domain], " "), "cache")
+	}
+	return b.String()
+}
+
+// renderHostsFile renders A and AAAA records in hosts file format. CoreDNS
+// has no CNAME support in hosts files so those records are skipped.
+func renderHostsFile(records []DNSRecord) string {
+	var b strings.Builder
+	for _, record := range records {
+		if record.Type == "A" || record.Type == "AAAA" {
+			b.WriteString(record.Value + " " + record.Name + "\n")
+		}
+	}
+	return b.String()
+}
+
+// writeCoreDNSHosts writes the local records CoreDNS serves
+func (m *Manager) writeCoreDNSHosts() error {
+	records, err := m.GetDNSRecords()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.runtimePath(corednsHostsFile), []byte(renderHostsFile(records)), 0644); err != nil {
+		return fmt.Errorf("failed to write coredns hosts file: %w", err)
+	}
+	return nil
+}
+
+// maintainCoreDNSHosts keeps the CoreDNS hosts file in step with the DHCP
+// leases until ctx is done
+func (m *Manager) maintainCoreDNSHosts(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		_ = m.writeCoreDNSHosts()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package nat
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+// Kinds of leftovers of crashed runs
+const (
+	OrphanProcess = "process"  // a DHCP or DNS server of an instance that is not running
+	OrphanPIDFile = "pidfile"  // a pidfile of a process that is gone
+	OrphanTemp    = "tempfile" // a file left by an interrupted write
+	OrphanAnchor  = "anchor"   // a pf anchor holding rules of an unregistered instance
+	OrphanBridge  = "bridge"   // a bridge configured by an instance that is not running
+	OrphanState   = "state"    // a registry entry of an instance that is not running
+)
+
+// bridgeRe matches the bridges nat-manager creates
+var bridgeRe = regexp.MustCompile(`^bridge[0-9]+$`)
+
+// Orphan is a leftover of a crashed run
+type Orphan struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"` // process ID, path, anchor, interface or instance
+	Instance string `json:"instance,omitempty"`
+	Reason   string `json:"reason"`
+
+	remove func() error
+}
+
+// Remove removes the leftover
+func (o Orphan) Remove() error {
+	if err := o.remove(); err != nil {
+		return fmt.Errorf("failed to remove %s %s: %w", o.Kind, o.Name, err)
+	}
+	return nil
+}
+
+// cleanupScan collects the leftovers of the instances that are not running
+type cleanupScan struct {
+	stateFile string
+	registry  *Registry
+	running   map[string]bool
+	orphans   []Orphan
+}
+
+// FindOrphans returns the leftovers of crashed runs of the given instances,
+// in the order they should be removed. Running instances, those holding NAT
+// rules or with a live DHCP supervisor, are left alone.
+func FindOrphans(stateFile string, instances []*Config) ([]Orphan, error) {
+	registry, err := LoadRegistry(stateFile)
+	if err != nil {
+		return nil, err
+	}
+	s := &cleanupScan{stateFile: stateFile, registry: registry, running: make(map[string]bool)}
+	for name, res := range registry.Instances {
+		s.running[name] = InstanceLive(res)
+	}
+	for _, cfg := range instances {
+		if pid := readPIDFile(cfg.PIDFile); pid > 0 && processAlive(pid) {
+			s.running[NewManager(cfg).instanceName()] = true
+		}
+	}
+
+	for _, cfg := range instances {
+		if !s.running[NewManager(cfg).instanceName()] {
+			s.runtimeFiles(cfg)
+		}
+	}
+	s.anchors()
+	s.bridges(instances)
+	s.staleEntries()
+	return s.orphans, nil
+}
+
+func (s *cleanupScan) add(o Orphan) {
+	s.orphans = append(s.orphans, o)
+}
+
+// runtimeFiles finds the pidfiles, orphaned servers and temporary files in
+// the runtime directory of an instance that is not running
+func (s *cleanupScan) runtimeFiles(cfg *Config) {
+	if cfg.PIDFile == "" {
+		return
+	}
+	instance := NewManager(cfg).instanceName()
+	dir := filepath.Dir(cfg.PIDFile)
+
+	pidfiles, _ := filepath.Glob(filepath.Join(dir, "*.pid"))
+	for _, path := range pidfiles {
+		pid := readPIDFile(path)
+		owner := pidOwner(pid, path, cfg.PIDFile)
+		switch {
+		case owner != "":
+			s.add(Orphan{Kind: OrphanProcess, Name: fmt.Sprint(pid), Instance: instance,
+				Reason: fmt.Sprintf("%s still runs from %s", owner, filepath.Base(path)),
+				remove: func() error { return stopProcess(pid, path) }})
+		case pid > 0 && processAlive(pid):
+			s.add(Orphan{Kind: OrphanPIDFile, Name: path, Instance: instance,
+				Reason: fmt.Sprintf("PID %d belongs to another process", pid),
+				remove: func() error { return os.Remove(path) }})
+		default:
+			s.add(Orphan{Kind: OrphanPIDFile, Name: path, Instance: instance,
+				Reason: "process is gone",
+				remove: func() error { return os.Remove(path) }})
+		}
+	}
+
+	temps, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	for _, path := range temps {
+		s.add(Orphan{Kind: OrphanTemp, Name: path, Instance: instance,
+			Reason: "left by an interrupted write",
+			remove: func() error { return os.Remove(path) }})
+	}
+}
+
+// pidOwner returns the name of the process a pidfile names if it still
+// runs: the DHCP supervisor or an unsupervised dnsmasq for the instance
+// pidfile, the server of a <server>-server.pid
+func pidOwner(pid int, path, instancePIDFile string) string {
+	if pid <= 0 {
+		return ""
+	}
+	names := []string{strings.TrimSuffix(filepath.Base(path), pidSuffix)}
+	if path == instancePIDFile {
+		names = []string{"nat-manager", BackendDnsmasq}
+	}
+	for _, name := range names {
+		if isProcess(pid, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// stopProcess terminates an orphaned server and removes its pidfile
+func stopProcess(pid int, pidfile string) error {
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		return err
+	}
+	return os.Remove(pidfile)
+}
+
+// anchors finds instance anchors holding rules of instances that are
+// neither registered nor running
+func (s *cleanupScan) anchors() {
+	output := commandOutput("pfctl", "-a", DefaultAnchor, "-s", "Anchors")
+	for _, anchor := range parseAnchors(output) {
+		instance := strings.TrimPrefix(anchor, DefaultAnchor+"/")
+		if _, ok := s.registry.Instances[instance]; ok || s.running[instance] {
+			continue
+		}
+		rules := commandOutput("pfctl", "-a", anchor, "-s", "nat") + commandOutput("pfctl", "-a", anchor, "-s", "rules")
+		if strings.TrimSpace(rules) == "" {
+			continue
+		}
+		s.add(Orphan{Kind: OrphanAnchor, Name: anchor, Instance: instance,
+			Reason: "holds rules of an instance that is not registered",
+			remove: func() error { return runCmd(exec.Command("pfctl", "-a", anchor, "-F", "all")) }})
+	}
+}
+
+// parseAnchors returns the instance anchors listed by "pfctl -s Anchors"
+func parseAnchors(output string) []string {
+	var anchors []string
+	for _, line := range strings.Split(output, "\n") {
+		anchor := strings.TrimSpace(line)
+		name, ok := strings.CutPrefix(anchor, DefaultAnchor+"/")
+		if ok && ValidateInstanceName(name) == nil {
+			anchors = append(anchors, anchor)
+		}
+	}
+	sort.Strings(anchors)
+	return anchors
+}
+
+// bridges finds the bridges configured by instances that are not running
+// which still carry the instance's gateway address and have no members, so
+// that bridges of Internet Sharing or virtual machines are left alone
+func (s *cleanupScan) bridges(instances []*Config) {
+	inUse := make(map[string]bool)
+	candidates := make(map[string]string) // interface -> network
+	consider := func(instance, iface, network string) {
+		if s.running[instance] {
+			inUse[iface] = true
+		} else if bridgeRe.MatchString(iface) {
+			candidates[iface] = network
+		}
+	}
+	for name, res := range s.registry.Instances {
+		consider(name, res.InternalInterface, res.InternalNetwork)
+	}
+	for _, cfg := range instances {
+		consider(NewManager(cfg).instanceName(), cfg.InternalInterface, cfg.InternalNetwork)
+	}
+
+	names := make([]string, 0, len(candidates))
+	for iface := range candidates {
+		if !inUse[iface] {
+			names = append(names, iface)
+		}
+	}
+	sort.Strings(names)
+	for _, iface := range names {
+		if !createdBridge(commandOutput("ifconfig", iface), candidates[iface]) {
+			continue
+		}
+		s.add(Orphan{Kind: OrphanBridge, Name: iface,
+			Reason: fmt.Sprintf("still has gateway %s.1 but no instance uses it", candidates[iface]),
+			remove: func() error { return runCmd(exec.Command("ifconfig", iface, "destroy")) }})
+	}
+}
+
+// createdBridge reports whether ifconfig shows a bridge as nat-manager
+// leaves it: carrying the gateway address of network and without members
+func createdBridge(ifconfig, network string) bool {
+	return strings.Contains(ifconfig, "inet "+network+".1 ") && !strings.Contains(ifconfig, "member:")
+}
+
+// staleEntries finds registry entries of instances that are not running
+func (s *cleanupScan) staleEntries() {
+	for _, res := range s.registry.List() {
+		if s.running[res.Instance] {
+			continue
+		}
+		s.add(Orphan{Kind: OrphanState, Name: res.Instance, Instance: res.Instance,
+			Reason: "registered as running but holds no rules and runs no DHCP server",
+			remove: func() error {
+				registry, err := LoadRegistry(s.stateFile)
+				if err != nil {
+					return err
+				}
+				registry.Release(res.Instance)
+				return registry.Save(s.stateFile)
+			}})
+	}
+}
+
+// RestoreHostDefaults reloads the system pf ruleset in place of the anchor
+// hooks loaded on start, disables pf and turns IP forwarding off
+func RestoreHostDefaults() error {
+	var errs []error
+	if err := runCmd(exec.Command("pfctl", "-f", "/etc/pf.conf")); err != nil {
+		errs = append(errs, fmt.Errorf("failed to reload /etc/pf.conf: %w", err))
+	}
+	_ = runCmd(exec.Command("pfctl", "-d")) // fails when pf is already disabled
+	if err := runCmd(exec.Command("sysctl", "-w", "net.inet.ip.forwarding=0")); err != nil {
+		errs = append(errs, fmt.Errorf("failed to disable IP forwarding: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,141 @@
+package nat
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// connectivityTimeout bounds each connectivity check
+const connectivityTimeout = 3 * time.Second
+
+// ConnectivityOptions select the targets of the connectivity checks
+type ConnectivityOptions struct {
+	Upstream string // address pinged through the uplink, the first DNS server if empty
+	Hostname string // name resolved through the internal DNS
+	DNSAddr  string // host:port of the internal DNS, the gateway if empty
+}
+
+// CheckResult is the outcome of one connectivity check
+type CheckResult struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Detail   string        `json:"detail"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// TestConnectivity verifies NAT end to end: the gateway answers, the
+// upstream is reachable, the internal DNS resolves and traffic from the
+// internal network is translated. Every check runs even if an earlier one
+// fails.
+func (m *Manager) TestConnectivity(ctx context.Context, opts ConnectivityOptions) []CheckResult {
+	gateway := m.config.InternalNetwork + ".1"
+	if opts.Upstream == "" {
+		opts.Upstream = "1.1.1.1"
+		if len(m.config.DNSServers) > 0 {
+			opts.Upstream = m.config.DNSServers[0]
+		}
+	}
+	if opts.Hostname == "" {
+		opts.Hostname = "apple.com"
+	}
+	if opts.DNSAddr == "" {
+		opts.DNSAddr = net.JoinHostPort(gateway, "53")
+	}
+
+	checks := []struct {
+		name string
+		run  func(ctx context.Context) (string, error)
+	}{
+		{"gateway", func(ctx context.Context) (string, error) { return ping(ctx, gateway, "") }},
+		{"upstream", func(ctx context.Context) (string, error) { return ping(ctx, opts.Upstream, "") }},
+		{"dns", func(ctx context.Context) (string, error) { return resolveVia(ctx, opts.DNSAddr, opts.Hostname) }},
+		{"translation", func(ctx context.Context) (string, error) { return m.checkTranslation(ctx, gateway, opts.Upstream) }},
+	}
+	results := make([]CheckResult, 0, len(checks))
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, connectivityTimeout)
+		started := time.Now()
+		detail, err := check.run(checkCtx)
+		cancel()
+		result := CheckResult{Name: check.name, Passed: err == nil, Detail: detail, Duration: time.Since(started)}
+		if err != nil {
+			result.Detail = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ping sends one echo request to addr, from source if given
+func ping(ctx context.Context, addr, source string) (string, error) {
+	args := []string{"-c", "1", "-t", "2"}
+	if source != "" {
+		args = append(args, "-S", source)
+	}
+	output, err := cmdCombinedOutput(exec.CommandContext(ctx, "ping", append(args, addr)...))
+	if err != nil {
+		return "", fmt.Errorf("no reply from %s", addr)
+	}
+	return pingSummary(string(output), addr), nil
+}
+
+// pingSummary returns the round trip time reported by ping
+func pingSummary(output, addr string) string {
+	for _, field := range strings.Fields(output) {
+		if rtt, ok := strings.CutPrefix(field, "time="); ok {
+			return fmt.Sprintf("%s replied in %s ms", addr, rtt)
+		}
+	}
+	return addr + " replied"
+}
+
+// pingTime returns the round trip time reported by ping
+func pingTime(output string) (time.Duration, bool) {
+	for _, field := range strings.Fields(output) {
+		if rtt, ok := strings.CutPrefix(field, "time="); ok {
+			d, err := time.ParseDuration(rtt + "ms")
+			return d, err == nil
+		}
+	}
+	return 0, false
+}
+
+// resolveVia resolves hostname through the DNS server at addr only
+func resolveVia(ctx context.Context, addr, hostname string) (string, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	addrs, err := resolver.LookupHost(ctx, hostname)
+	if err != nil {
+		return "", fmt.Errorf("%s did not resolve %s: %w", addr, hostname, err)
+	}
+	return fmt.Sprintf("%s resolved %s to %s", addr, hostname, strings.Join(addrs, ", ")), nil
+}
+
+// checkTranslation sends a ping from the gateway address, which leaves
+// through the uplink like traffic of the internal network, and looks for
+// the translated state it creates
+func (m *Manager) checkTranslation(ctx context.Context, gateway, upstream string) (string, error) {
+	if _, err := ping(ctx, upstream, gateway); err != nil {
+		return "", fmt.Errorf("no reply from %s to a ping from %s", upstream, gateway)
+	}
+	states := commandOutput("pfctl", "-s", "state")
+	if !hasTranslation(states, m.config.InternalNetwork) {
+		return "", fmt.Errorf("no translated state for %s.0/24 in the pf state table", m.config.InternalNetwork)
+	}
+	return fmt.Sprintf("traffic from %s.0/24 is translated", m.config.InternalNetwork), nil
+}
+
+// hasTranslation reports whether "pfctl -s state" lists a state translated
+// from an internal address, shown in parentheses after the translated one
+func hasTranslation(states, network string) bool {
+	return strings.Contains(states, "("+network+".")
+}
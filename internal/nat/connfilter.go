@@ -0,0 +1,182 @@
+package nat
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Connection sort orders
+const (
+	SortBytes       = "bytes"       // most traffic first
+	SortAge         = "age"         // newest first
+	SortDestination = "destination" // by destination address and port
+)
+
+// ConnectionFilter selects connections by internal device, protocol, port
+// and destination. Empty fields match every connection.
+type ConnectionFilter struct {
+	Device   string     // IP, MAC or hostname of the internal device
+	Protocol string     // tcp, udp or icmp
+	Port     int        // source or destination port
+	Dest     *net.IPNet // destination network
+}
+
+// ParseConnectionFilter parses filter expressions made of key=value terms
+// separated by spaces, e.g. "device=192.168.100.50 proto=tcp port=443
+// dst=10.0.0.0/8". All terms must match.
+func ParseConnectionFilter(exprs []string) (ConnectionFilter, error) {
+	var f ConnectionFilter
+	seen := make(map[string]bool)
+	for _, expr := range exprs {
+		for _, term := range strings.Fields(expr) {
+			key, value, ok := strings.Cut(term, "=")
+			if !ok || value == "" {
+				return f, fmt.Errorf("invalid filter term %q, expected key=value", term)
+			}
+			key = filterKey(key)
+			if seen[key] {
+				return f, fmt.Errorf("filter term %q given twice", key)
+			}
+			seen[key] = true
+			if err := f.set(key, value); err != nil {
+				return f, err
+			}
+		}
+	}
+	return f, nil
+}
+
+// filterKey returns the canonical name of a filter key
+func filterKey(key string) string {
+	switch strings.ToLower(key) {
+	case "dev", "device":
+		return "device"
+	case "proto", "protocol":
+		return "proto"
+	case "dst", "dest", "destination":
+		return "dst"
+	}
+	return strings.ToLower(key)
+}
+
+func (f *ConnectionFilter) set(key, value string) error {
+	switch key {
+	case "device":
+		f.Device = value
+	case "proto":
+		f.Protocol = strings.ToLower(value)
+		if f.Protocol != "tcp" && f.Protocol != "udp" && f.Protocol != "icmp" {
+			return fmt.Errorf("invalid protocol %q, expected tcp, udp or icmp", value)
+		}
+	case "port":
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		f.Port = port
+	case "dst":
+		if !strings.Contains(value, "/") {
+			value += "/32"
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return fmt.Errorf("invalid destination %q, expected an address or CIDR", value)
+		}
+		f.Dest = network
+	default:
+		return fmt.Errorf("unknown filter key %q, expected device, proto, port or dst", key)
+	}
+	return nil
+}
+
+// Empty reports whether the filter matches every connection
+func (f ConnectionFilter) Empty() bool {
+	return f == ConnectionFilter{}
+}
+
+// Apply returns the connections matching the filter, resolving a device
+// given by MAC or hostname through the connected devices
+func (f ConnectionFilter) Apply(connections []Connection, devices []ConnectedDevice) []Connection {
+	if f.Empty() {
+		return connections
+	}
+	addrs := f.deviceAddrs(devices)
+	matched := make([]Connection, 0, len(connections))
+	for _, conn := range connections {
+		if f.match(conn, addrs) {
+			matched = append(matched, conn)
+		}
+	}
+	return matched
+}
+
+// deviceAddrs returns the addresses of the filtered device
+func (f ConnectionFilter) deviceAddrs(devices []ConnectedDevice) map[string]bool {
+	if f.Device == "" {
+		return nil
+	}
+	addrs := map[string]bool{f.Device: true}
+	for _, device := range devices {
+		if strings.EqualFold(device.MAC, f.Device) || strings.EqualFold(device.Hostname, f.Device) {
+			addrs[device.IP] = true
+		}
+	}
+	return addrs
+}
+
+func (f ConnectionFilter) match(conn Connection, deviceAddrs map[string]bool) bool {
+	srcHost, srcPort := splitAddr(conn.Source)
+	dstHost, dstPort := splitAddr(conn.Destination)
+	switch {
+	case f.Protocol != "" && !strings.EqualFold(conn.Protocol, f.Protocol):
+		return false
+	case f.Port != 0 && srcPort != f.Port && dstPort != f.Port:
+		return false
+	case f.Dest != nil && !f.Dest.Contains(net.ParseIP(dstHost)):
+		return false
+	case deviceAddrs != nil && !deviceAddrs[srcHost] && !deviceAddrs[dstHost]:
+		return false
+	}
+	return true
+}
+
+// splitAddr splits an address as printed by pfctl (host:port) or netstat
+// (host.port) into host and port
+func splitAddr(addr string) (string, int) {
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		n, _ := strconv.Atoi(port)
+		return host, n
+	}
+	if i := strings.LastIndex(addr, "."); i > 0 && net.ParseIP(addr[:i]) != nil {
+		n, _ := strconv.Atoi(addr[i+1:])
+		return addr[:i], n
+	}
+	return addr, 0
+}
+
+// SortConnections orders connections by bytes, age or destination, keeping
+// the order of equal connections
+func SortConnections(connections []Connection, by string) error {
+	switch by {
+	case "":
+	case SortBytes:
+		sort.SliceStable(connections, func(i, j int) bool { return connections[i].Bytes > connections[j].Bytes })
+	case SortAge:
+		sort.SliceStable(connections, func(i, j int) bool { return connections[i].Age < connections[j].Age })
+	case SortDestination:
+		sort.SliceStable(connections, func(i, j int) bool {
+			a, aPort := splitAddr(connections[i].Destination)
+			b, bPort := splitAddr(connections[j].Destination)
+			if a != b {
+				return ipLess(a, b)
+			}
+			return aPort < bPort
+		})
+	default:
+		return fmt.Errorf("invalid sort order %q, expected %s, %s or %s", by, SortBytes, SortAge, SortDestination)
+	}
+	return nil
+}
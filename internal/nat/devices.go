@@ -0,0 +1,287 @@
+package nat
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/fingerprint"
+	"github.com/scttfrdmn/macos-nat-manager/internal/names"
+)
+
+// Device sources
+const (
+	SourceDHCP = "dhcp" // holds a lease
+	SourceARP  = "arp"  // only in the ARP table, e.g. a static address
+)
+
+// Device is a device known on the internal network from its DHCP lease or
+// the ARP table
+type Device struct {
+	IP             string    `json:"ip"`
+	MAC            string    `json:"mac"`
+	Vendor         string    `json:"vendor,omitempty"`
+	Hostname       string    `json:"hostname,omitempty"`
+	NameSource     string    `json:"name_source,omitempty"`
+	Type           string    `json:"type,omitempty"`
+	VM             string    `json:"vm,omitempty"` // name of an attached virtual machine
+	Source         string    `json:"source"`
+	Online         bool      `json:"online"`                    // answering ARP on the internal interface
+	LeaseRemaining string    `json:"lease_remaining,omitempty"` // "infinite" or a duration, empty without a lease
+	FirstSeen      time.Time `json:"first_seen"`
+	LastSeen       time.Time `json:"last_seen"`
+}
+
+// VM is a virtual machine attached to the internal network, listed as such
+// among the devices
+type VM struct {
+	Name string
+	Kind string // e.g. Colima VM
+	MAC  string
+}
+
+// Sighting records when a device was first and last seen
+type Sighting struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// arpEntry is a resolved entry of the ARP table
+type arpEntry struct {
+	IP  string
+	MAC string
+}
+
+// parseARP parses the output of "arp -an", skipping incomplete entries and
+// entries of other interfaces. macOS drops leading zeros from MAC octets,
+// which are restored.
+func parseARP(r io.Reader, iface string) []arpEntry {
+	var entries []arpEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// ? (192.168.100.101) at a4:83:e7:1:2:3 on bridge100 ifscope [ethernet]
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[2] != "at" || fields[4] != "on" {
+			continue
+		}
+		if iface != "" && fields[5] != iface {
+			continue
+		}
+		mac, ok := normalizeMAC(fields[3])
+		if !ok {
+			continue
+		}
+		entries = append(entries, arpEntry{IP: strings.Trim(fields[1], "()"), MAC: mac})
+	}
+	return entries
+}
+
+// normalizeMAC pads the octets of a MAC address as printed by arp
+func normalizeMAC(mac string) (string, bool) {
+	octets := strings.Split(strings.ToLower(mac), ":")
+	if len(octets) != 6 {
+		return "", false
+	}
+	for i, octet := range octets {
+		if len(octet) == 0 || len(octet) > 2 || strings.Trim(octet, "0123456789abcdef") != "" {
+			return "", false
+		}
+		octets[i] = fmt.Sprintf("%02s", octet)
+	}
+	normalized := strings.Join(octets, ":")
+	return normalized, normalized != "ff:ff:ff:ff:ff:ff"
+}
+
+// arpTable returns the resolved ARP entries on the internal interface
+func (m *Manager) arpTable() []arpEntry {
+	output := commandOutput("arp", "-an", "-i", m.config.InternalInterface)
+	return parseARP(strings.NewReader(output), m.config.InternalInterface)
+}
+
+// Devices lists the devices holding a lease or present in the ARP table
+// with their vendor, name, type and when they were first and last seen
+func (m *Manager) Devices() ([]Device, error) {
+	if m.config == nil {
+		return []Device{}, nil
+	}
+	leases, err := m.GetLeases()
+	if err != nil {
+		return nil, err
+	}
+	devices := mergeDevices(leases, m.arpTable(), time.Now())
+
+	lookups := make([]names.Device, 0, len(devices))
+	for _, device := range devices {
+		lookups = append(lookups, names.Device{IP: device.IP, MAC: device.MAC, Hostname: device.Hostname})
+	}
+	resolved := m.nameChain().ResolveAll(context.Background(), lookups)
+	fingerprints := m.fingerprints()
+	for i := range devices {
+		devices[i].Hostname, devices[i].NameSource = resolved[i].Name, resolved[i].Source
+		devices[i].Type = deviceType(Lease{MAC: devices[i].MAC, Hostname: lookups[i].Hostname}, fingerprints)
+	}
+	labelVMs(devices, m.config.VMs)
+
+	m.recordSightings(devices, fingerprints, time.Now())
+	return devices, nil
+}
+
+// mergeDevices combines leases and ARP entries by MAC, ordered by address
+func mergeDevices(leases []Lease, arp []arpEntry, now time.Time) []Device {
+	byMAC := make(map[string]*Device)
+	var devices []*Device
+	for _, lease := range leases {
+		mac := strings.ToLower(lease.MAC)
+		remaining := "infinite"
+		if !lease.Expiry.IsZero() {
+			remaining = max(lease.Expiry.Sub(now), 0).Round(time.Minute).String()
+		}
+		device := &Device{IP: lease.IP, MAC: mac, Hostname: lease.Hostname, Source: SourceDHCP, LeaseRemaining: remaining}
+		byMAC[mac] = device
+		devices = append(devices, device)
+	}
+	for _, entry := range arp {
+		if device, ok := byMAC[entry.MAC]; ok {
+			device.Online = true
+			continue
+		}
+		device := &Device{IP: entry.IP, MAC: entry.MAC, Source: SourceARP, Online: true}
+		byMAC[entry.MAC] = device
+		devices = append(devices, device)
+	}
+
+	merged := make([]Device, 0, len(devices))
+	for _, device := range devices {
+		device.Vendor = fingerprint.Vendor(device.MAC)
+		merged = append(merged, *device)
+	}
+	sort.Slice(merged, func(i, j int) bool { return ipLess(merged[i].IP, merged[j].IP) })
+	return merged
+}
+
+// labelVMs names the devices that are attached virtual machines after them
+func labelVMs(devices []Device, vms []VM) {
+	for i := range devices {
+		for _, vm := range vms {
+			if strings.EqualFold(vm.MAC, devices[i].MAC) {
+				devices[i].VM, devices[i].Type = vm.Name, vm.Kind
+				if devices[i].Hostname == "" {
+					devices[i].Hostname = vm.Name
+				}
+			}
+		}
+	}
+}
+
+// ipLess orders dotted IPv4 addresses numerically
+func ipLess(a, b string) bool {
+	x, errA := poolAddress("", a)
+	y, errB := poolAddress("", b)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return x < y
+}
+
+// recordSightings updates the inventory of sightings with the devices
+// online now and the lease events recorded in their fingerprints, and fills
+// in when each device was first and last seen
+func (m *Manager) recordSightings(devices []Device, fingerprints map[string]fingerprint.Observation, now time.Time) {
+	sightings := loadSightings(m.config.InventoryFile)
+	for i := range devices {
+		sighting := sightings[devices[i].MAC]
+		seen := fingerprints[devices[i].MAC].Seen
+		if devices[i].Online {
+			seen = now
+		}
+		if seen.After(sighting.LastSeen) {
+			sighting.LastSeen = seen
+		}
+		if sighting.FirstSeen.IsZero() || (!seen.IsZero() && seen.Before(sighting.FirstSeen)) {
+			sighting.FirstSeen = seen
+		}
+		sightings[devices[i].MAC] = sighting
+		devices[i].FirstSeen, devices[i].LastSeen = sighting.FirstSeen, sighting.LastSeen
+	}
+	if m.config.InventoryFile != "" {
+		_ = saveSightings(m.config.InventoryFile, sightings)
+	}
+}
+
+// loadSightings reads the device inventory keyed by lowercase MAC
+func loadSightings(path string) map[string]Sighting {
+	sightings := make(map[string]Sighting)
+	if path == "" {
+		return sightings
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &sightings)
+	}
+	return sightings
+}
+
+// saveSightings replaces the device inventory
+func saveSightings(path string, sightings map[string]Sighting) error {
+	data, err := json.MarshalIndent(sightings, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create inventory directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write device inventory: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// BlockTargets sorts arguments of block and allow into devices, given by
+// MAC or IP, and domains. Other names are looked up among the known
+// devices, listed on first use, before being taken as domains.
+func BlockTargets(args []string, known func() []Device) (devices, domains []string, err error) {
+	var listed []Device
+	looked := false
+	for _, arg := range args {
+		if ValidateDevice(arg) == nil {
+			devices = append(devices, arg)
+			continue
+		}
+		if !looked {
+			listed, looked = known(), true
+		}
+		if device, ok := deviceByName(listed, arg); ok {
+			devices = append(devices, device)
+			continue
+		}
+		domain := strings.ToLower(strings.TrimSuffix(arg, "."))
+		if !strings.Contains(domain, ".") || net.ParseIP(domain) != nil || strings.ContainsAny(domain, " /:@") {
+			return nil, nil, fmt.Errorf("%q is not a known device, MAC, IPv4 address or domain", arg)
+		}
+		domains = append(domains, domain)
+	}
+	return devices, domains, nil
+}
+
+// deviceByName returns the MAC, or IP without one, of the device with the
+// given hostname
+func deviceByName(devices []Device, name string) (string, bool) {
+	for _, device := range devices {
+		if device.Hostname == "" || !strings.EqualFold(device.Hostname, name) {
+			continue
+		}
+		if device.MAC != "" {
+			return device.MAC, true
+		}
+		return device.IP, true
+	}
+	return "", false
+}
@@ -0,0 +1,251 @@
+package nat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// leaseTimeRe matches dnsmasq lease durations such as 45m, 12h, 7d or infinite
+var leaseTimeRe = regexp.MustCompile(`^(infinite|[0-9]+[smhdw]?)$`)
+
+// DeviceLease overrides the pool lease time for a single device and may
+// reserve it an address
+type DeviceLease struct {
+	MAC   string
+	Lease string // pool lease time if empty
+	IP    string // reserved address, none if empty
+}
+
+// ValidateLeaseTime checks for a dnsmasq lease duration
+func ValidateLeaseTime(lease string) error {
+	if !leaseTimeRe.MatchString(lease) {
+		return fmt.Errorf("invalid lease time %q (e.g. 45m, 12h, 7d or infinite)", lease)
+	}
+	return nil
+}
+
+// poolAddress resolves a pool bound given as a full IPv4 address or as the
+// last octet within network
+func poolAddress(network, value string) (uint32, error) {
+	if !strings.Contains(value, ".") {
+		value = network + "." + value
+	}
+	ip := net.ParseIP(strings.TrimSpace(value)).To4()
+	if ip == nil {
+		return 0, fmt.Errorf("invalid DHCP address %q", value)
+	}
+	if network != "" && !strings.HasPrefix(ip.String(), network+".") {
+		return 0, fmt.Errorf("DHCP address %s must be in %s.0/24", ip, network)
+	}
+	return binary.BigEndian.Uint32(ip), nil
+}
+
+// ipString formats an address produced by poolAddress
+func ipString(addr uint32) string {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, addr)
+	return ip.String()
+}
+
+// parseExclusion parses a single address or a first-last range
+func parseExclusion(network, exclusion string) (uint32, uint32, error) {
+	first, last, isRange := strings.Cut(exclusion, "-")
+	lo, err := poolAddress(network, first)
+	if err != nil {
+		return 0, 0, fmt.Errorf("exclusion %q: %w", exclusion, err)
+	}
+	if !isRange {
+		return lo, lo, nil
+	}
+	hi, err := poolAddress(network, last)
+	if err != nil {
+		return 0, 0, fmt.Errorf("exclusion %q: %w", exclusion, err)
+	}
+	if hi < lo {
+		return 0, 0, fmt.Errorf("exclusion %q: range is reversed", exclusion)
+	}
+	return lo, hi, nil
+}
+
+// poolSegments splits the pool around its exclusions and returns the
+// remaining address ranges in order
+func poolSegments(network string, r DHCPRange) ([][2]uint32, error) {
+	start, err := poolAddress(network, r.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := poolAddress(network, r.End)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		return nil, fmt.Errorf("DHCP range %s-%s is reversed", r.Start, r.End)
+	}
+
+	excluded := make(map[uint32]bool)
+	var errs []error
+	for _, exclusion := range r.Exclude {
+		lo, hi, err := parseExclusion(network, exclusion)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if lo < start || hi > end {
+			errs = append(errs, fmt.Errorf("exclusion %q is outside the DHCP range", exclusion))
+			continue
+		}
+		for addr := lo; addr <= hi; addr++ {
+			excluded[addr] = true
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var segments [][2]uint32
+	for addr := start; addr <= end; addr++ {
+		if excluded[addr] {
+			continue
+		}
+		if n := len(segments); n > 0 && segments[n-1][1] == addr-1 {
+			segments[n-1][1] = addr
+		} else {
+			segments = append(segments, [2]uint32{addr, addr})
+		}
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("exclusions leave no addresses in the DHCP range")
+	}
+	return segments, nil
+}
+
+// ValidateDHCP checks the pool, its exclusions and the per-device lease times
+func ValidateDHCP(r DHCPRange, leases []DeviceLease, network string) error {
+	var errs []error
+	if _, err := poolSegments(network, r); err != nil {
+		errs = append(errs, err)
+	}
+	if r.Lease != "" {
+		errs = append(errs, ValidateLeaseTime(r.Lease))
+	}
+	reserved := make(map[string]string)
+	for _, lease := range leases {
+		if _, err := net.ParseMAC(lease.MAC); err != nil {
+			errs = append(errs, fmt.Errorf("lease for %q: not a MAC address", lease.MAC))
+			continue
+		}
+		if lease.Lease == "" && lease.IP == "" {
+			errs = append(errs, fmt.Errorf("lease for %s: sets neither a lease time nor an address", lease.MAC))
+		}
+		if lease.Lease != "" {
+			if err := ValidateLeaseTime(lease.Lease); err != nil {
+				errs = append(errs, fmt.Errorf("lease for %s: %w", lease.MAC, err))
+			}
+		}
+		if lease.IP == "" {
+			continue
+		}
+		if err := validateReservation(lease.IP, network); err != nil {
+			errs = append(errs, fmt.Errorf("lease for %s: %w", lease.MAC, err))
+		} else if other, taken := reserved[lease.IP]; taken {
+			errs = append(errs, fmt.Errorf("lease for %s: %s is already reserved for %s", lease.MAC, lease.IP, other))
+		}
+		reserved[lease.IP] = lease.MAC
+	}
+	return errors.Join(errs...)
+}
+
+// validateReservation checks that a reserved address is a host of the
+// internal network other than the gateway
+func validateReservation(ip, network string) error {
+	host, ok := strings.CutPrefix(ip, network+".")
+	n, err := strconv.Atoi(host)
+	if !ok || err != nil || net.ParseIP(ip).To4() == nil || n < 2 || n > 254 {
+		return fmt.Errorf("reserved address %s is not a host of %s.0/24 other than the gateway", ip, network)
+	}
+	return nil
+}
+
+// ValidateDHCPOptions checks the search domains and NTP servers advertised
+// to clients. Option 42 carries addresses, so NTP servers must be IPv4.
+func ValidateDHCPOptions(searchDomains, ntpServers []string) error {
+	var errs []error
+	for _, domain := range searchDomains {
+		if !domainRe.MatchString(strings.ToLower(strings.TrimSuffix(domain, "."))) {
+			errs = append(errs, fmt.Errorf("invalid search domain %q", domain))
+		}
+	}
+	for _, server := range ntpServers {
+		if ip := net.ParseIP(server); ip == nil || ip.To4() == nil {
+			errs = append(errs, fmt.Errorf("NTP server %q must be an IPv4 address", server))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dnsmasqDHCPArgs renders one --dhcp-range per pool segment left after the
+// exclusions, one --dhcp-host per device lease override or reservation and
+// the search domain (option 119) and NTP server (option 42) options
+func dnsmasqDHCPArgs(cfg *Config) ([]string, error) {
+	segments, err := poolSegments(cfg.InternalNetwork, cfg.DHCPRange)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, len(segments)+len(cfg.DeviceLeases))
+	for _, segment := range segments {
+		dhcpRange := ipString(segment[0]) + "," + ipString(segment[1])
+		if cfg.DHCPRange.Lease != "" {
+			dhcpRange += "," + cfg.DHCPRange.Lease
+		}
+		args = append(args, "--dhcp-range="+dhcpRange)
+	}
+	for _, lease := range cfg.DeviceLeases {
+		host := strings.ToLower(lease.MAC)
+		for _, field := range []string{lease.IP, lease.Lease} {
+			if field != "" {
+				host += "," + field
+			}
+		}
+		args = append(args, "--dhcp-host="+host)
+	}
+	if len(cfg.SearchDomains) > 0 {
+		args = append(args, "--dhcp-option=option:domain-search,"+strings.Join(cfg.SearchDomains, ","))
+	}
+	if len(cfg.NTPServers) > 0 {
+		args = append(args, "--dhcp-option=option:ntp-server,"+strings.Join(cfg.NTPServers, ","))
+	}
+	return args, nil
+}
+
+// dhcpEventScript renders the wrapper dnsmasq runs on every lease change.
+// dnsmasq passes the action, MAC, IP and hostname as arguments and the
+// request's vendor class and parameter request list in DNSMASQ_* variables.
+func dhcpEventScript(command string) string {
+	quoted := "'" + strings.ReplaceAll(command, "'", `'\''`) + "'"
+	return "#!/bin/sh\nexec " + quoted + " dhcp-event \"$@\"\n"
+}
+
+// writeDHCPEventScript writes the lease change wrapper next to the pidfile
+// and returns its path, or "" when lease events are disabled
+func (m *Manager) writeDHCPEventScript() (string, error) {
+	if m.config.Executable == "" || m.config.PIDFile == "" {
+		return "", nil
+	}
+
+	path := filepath.Join(filepath.Dir(m.config.PIDFile), "dhcp-event.sh")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create DHCP event script directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(dhcpEventScript(m.config.Executable)), 0700); err != nil {
+		return "", fmt.Errorf("failed to write DHCP event script: %w", err)
+	}
+	return path, nil
+}
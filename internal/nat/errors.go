@@ -0,0 +1,28 @@
+package nat
+
+import "errors"
+
+var (
+	// ErrNotRunning is returned by operations that need a running instance
+	ErrNotRunning = errors.New("NAT is not running")
+	// ErrConflict matches errors caused by another running instance, such
+	// as an instance that is already running or owns the same resources
+	ErrConflict = errors.New("conflicts with a running instance")
+	// ErrAlreadyRunning is returned when starting an instance that runs
+	ErrAlreadyRunning = error(conflictError{errors.New("NAT is already running")})
+)
+
+// conflictError marks an error as caused by a running instance
+type conflictError struct {
+	error
+}
+
+// Is reports whether target is ErrConflict
+func (e conflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Unwrap returns the underlying error
+func (e conflictError) Unwrap() error {
+	return e.error
+}
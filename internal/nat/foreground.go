@@ -0,0 +1,280 @@
+package nat
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+)
+
+// How often a foreground run checks leases, pf and the network, and that
+// the DHCP supervisor is alive, and how much longer than a check interval
+// the wall clock must jump for the host to be taken as woken from sleep
+const (
+	foregroundInterval = 5 * time.Second
+	watchdogInterval   = 10 * time.Second
+	sleepGap           = 30 * time.Second
+)
+
+// Log components of a foreground run
+const (
+	componentPF       = "pf"
+	componentDHCP     = "dhcp"
+	componentWatchdog = "watchdog"
+	componentNetwork  = "network"
+)
+
+var (
+	// stateEntriesRe matches the state count in "pfctl -s info"
+	stateEntriesRe = regexp.MustCompile(`current entries\s+(\d+)`)
+	// inetRe matches the IPv4 address in ifconfig output
+	inetRe = regexp.MustCompile(`inet (\d+\.\d+\.\d+\.\d+)`)
+)
+
+// NetworkState is what foreground runs and the TUI watch of the uplink
+type NetworkState struct {
+	ExternalIP   string
+	DefaultRoute string // interface holding the default route
+}
+
+// foreground is the state of a foreground run between checks
+type foreground struct {
+	m       *Manager
+	log     *slog.Logger
+	leases  map[string]Lease // by MAC
+	states  int
+	network NetworkState
+
+	quotaExceeded bool // the quota event was sent
+}
+
+// RunForeground logs what happens to the running instance until ctx is
+// done: DHCP leases granted and released, pf state counts, watchdog
+// restarts of the DHCP supervisor and uplink changes. Rules are re-applied
+// when the uplink changes or the anchor loses them, and the whole host
+// configuration after the host wakes from sleep.
+func (m *Manager) RunForeground(ctx context.Context, log *slog.Logger) {
+	f := &foreground{m: m, log: log, leases: make(map[string]Lease), states: -1}
+	f.network = m.NetworkState()
+	log.Info("watching network", "component", componentNetwork,
+		"external", m.config.ExternalInterface, "external_ip", f.network.ExternalIP, "default_route", f.network.DefaultRoute)
+
+	go m.WatchDHCP(ctx, watchdogInterval, func(msg string) {
+		log.Warn(msg, "component", componentWatchdog)
+	})
+
+	ticker := time.NewTicker(foregroundInterval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		f.check()
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if asleep, ok := slept(last, now); ok {
+				f.wake(asleep)
+			}
+			last = now
+		}
+	}
+}
+
+// slept reports whether the host slept between two checks and for how
+// long. The monotonic clock stops during sleep, so the wall clock is
+// compared.
+func slept(last, now time.Time) (time.Duration, bool) {
+	gap := now.Round(0).Sub(last.Round(0))
+	return gap, gap > foregroundInterval+sleepGap
+}
+
+// wake re-applies the host configuration the sleep may have reset
+func (f *foreground) wake(asleep time.Duration) {
+	f.log.Info("woke from sleep", "component", componentNetwork, "asleep", asleep.Round(time.Second))
+	if err := f.m.Reapply(); err != nil {
+		f.log.Error("failed to re-apply configuration", "component", componentNetwork, "error", err)
+		return
+	}
+	audit.Event("nat reapplied", "wake")
+	f.log.Info("configuration re-applied", "component", componentNetwork)
+}
+
+// check logs what changed since the previous check
+func (f *foreground) check() {
+	if leases, err := f.m.GetLeases(); err == nil {
+		f.checkLeases(leases)
+	}
+	f.checkPF()
+	f.checkNetwork()
+	f.checkQuota()
+}
+
+// checkLeases logs the leases granted and released since the last check
+func (f *foreground) checkLeases(leases []Lease) {
+	current := make(map[string]Lease, len(leases))
+	for _, lease := range leases {
+		current[lease.MAC] = lease
+	}
+	granted, released := diffLeases(f.leases, current)
+	for _, lease := range granted {
+		f.log.Info("lease granted", "component", componentDHCP, "ip", lease.IP, "mac", lease.MAC, "hostname", lease.Hostname)
+	}
+	for _, lease := range released {
+		f.log.Info("lease released", "component", componentDHCP, "ip", lease.IP, "mac", lease.MAC, "hostname", lease.Hostname)
+	}
+	f.leases = current
+}
+
+// diffLeases returns the leases that are new or moved to another address,
+// and those that are gone, ordered by address
+func diffLeases(previous, current map[string]Lease) (granted, released []Lease) {
+	for mac, lease := range current {
+		if old, ok := previous[mac]; !ok || old.IP != lease.IP {
+			granted = append(granted, lease)
+		}
+	}
+	for mac, lease := range previous {
+		if _, ok := current[mac]; !ok {
+			released = append(released, lease)
+		}
+	}
+	byIP := func(leases []Lease) {
+		sort.Slice(leases, func(i, j int) bool { return ipLess(leases[i].IP, leases[j].IP) })
+	}
+	byIP(granted)
+	byIP(released)
+	return granted, released
+}
+
+// checkPF reloads the rules if the anchor lost them and logs changes of
+// the state count
+func (f *foreground) checkPF() {
+	if !f.m.RulesLoaded() {
+		f.log.Warn("NAT rules missing from the anchor, reloading", "component", componentPF, "anchor", f.m.anchorName())
+		stopped := f.m.interfaces()
+		stopped["unexpected"] = "true"
+		stopped["reason"] = "rules missing"
+		f.m.emit(event.NATStopped, stopped)
+		if f.reload("rules missing") {
+			started := f.m.interfaces()
+			started["reason"] = "rules reloaded"
+			f.m.emit(event.NATStarted, started)
+		}
+	}
+	states := parseStateEntries(commandOutput("pfctl", "-s", "info"))
+	if states >= 0 && states != f.states {
+		f.log.Debug("state table", "component", componentPF, "states", states)
+		f.states = states
+	}
+}
+
+// parseStateEntries returns the number of pf states, or -1 if unknown
+func parseStateEntries(info string) int {
+	match := stateEntriesRe.FindStringSubmatch(info)
+	if match == nil {
+		return -1
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// checkNetwork re-applies the rules when the uplink's address or the
+// default route changes
+func (f *foreground) checkNetwork() {
+	current := f.m.NetworkState()
+	if current == f.network {
+		return
+	}
+	f.log.Info("network changed", "component", componentNetwork,
+		"external_ip", current.ExternalIP, "previous_ip", f.network.ExternalIP,
+		"default_route", current.DefaultRoute, "previous_route", f.network.DefaultRoute)
+	if current.ExternalIP == "" {
+		f.log.Warn("external interface has no address", "component", componentNetwork, "interface", f.m.config.ExternalInterface)
+	}
+	if current.ExternalIP != f.network.ExternalIP {
+		data := map[string]string{
+			"interface":   f.m.config.ExternalInterface,
+			"external_ip": current.ExternalIP,
+			"previous_ip": f.network.ExternalIP,
+		}
+		f.m.emit(event.WANIPChanged, data)
+		switch {
+		case current.ExternalIP == "":
+			f.m.emit(event.WANDown, data)
+		case f.network.ExternalIP == "":
+			f.m.emit(event.WANUp, data)
+		}
+	}
+	f.network = current
+	f.reload("network changed")
+}
+
+// reload loads the rules into the anchor again and reports whether it
+// succeeded
+func (f *foreground) reload(reason string) bool {
+	if err := f.m.loadAnchor(); err != nil {
+		f.log.Error("failed to reload rules", "component", componentPF, "reason", reason, "error", err)
+		return false
+	}
+	f.log.Info("rules reloaded", "component", componentPF, "reason", reason)
+	return true
+}
+
+// Reapply sets up the running instance's host configuration again: the
+// internal interface's address, IP forwarding, pf and the anchor's rules.
+// It adopts an instance left running by a previous process and restores
+// what sleep or a network change reset; the DHCP watchdog restarts the
+// server if needed.
+func (m *Manager) Reapply() error {
+	if m.config == nil {
+		return fmt.Errorf("NAT config is nil")
+	}
+	if err := m.validateInterfaces(); err != nil {
+		return fmt.Errorf("invalid NAT configuration: %w", err)
+	}
+	if strings.HasPrefix(m.config.InternalInterface, "bridge") {
+		_ = runCmd(exec.Command("ifconfig", m.config.InternalInterface, "create"))
+		bridgeIP := m.config.InternalNetwork + ".1"
+		if err := runCmd(exec.Command("ifconfig", m.config.InternalInterface, "inet", bridgeIP, "netmask", "255.255.255.0")); err != nil {
+			return fmt.Errorf("failed to configure bridge interface: %w", err)
+		}
+	}
+	if err := runCmd(exec.Command("sysctl", "-w", "net.inet.ip.forwarding=1")); err != nil {
+		return fmt.Errorf("failed to enable IP forwarding: %w", err)
+	}
+	_ = runCmd(exec.Command("pfctl", "-e")) // fails when pf is already enabled
+	if err := pfctlLoad(mainRuleset(DefaultAnchor)); err != nil {
+		return fmt.Errorf("failed to set NAT rule: %w", err)
+	}
+	if err := m.loadAnchor(); err != nil {
+		return fmt.Errorf("failed to set NAT rule: %w", err)
+	}
+	m.config.Active = true
+	return nil
+}
+
+// NetworkState returns the uplink's address and the default route
+func (m *Manager) NetworkState() NetworkState {
+	return m.networkState(commandOutput("route", "-n", "get", "default"))
+}
+
+// networkState returns the uplink's address and the interface of the
+// default route given as printed by "route -n get default"
+func (m *Manager) networkState(route string) NetworkState {
+	state := NetworkState{DefaultRoute: defaultRouteInterface(route)}
+	if match := inetRe.FindStringSubmatch(commandOutput("ifconfig", m.config.ExternalInterface)); match != nil {
+		state.ExternalIP = match[1]
+	}
+	return state
+}
@@ -0,0 +1,302 @@
+package nat
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+)
+
+// DefaultInstance is the name of the instance used when none is selected
+const DefaultInstance = "default"
+
+// maxInstances bounds concurrently running instances; each gets its own
+// range of dummynet pipe numbers
+const maxInstances = 9
+
+// instanceNameRe matches instance names, which become part of the pf anchor
+var instanceNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,23}$`)
+
+// ValidateInstanceName checks that an instance name is usable in pf anchor
+// and file names
+func ValidateInstanceName(name string) error {
+	if !instanceNameRe.MatchString(name) {
+		return fmt.Errorf("invalid instance name %q (lowercase letters, digits, - and _)", name)
+	}
+	return nil
+}
+
+// Resources are the host resources a running instance owns
+type Resources struct {
+	Instance          string    `yaml:"instance" json:"instance"`
+	Anchor            string    `yaml:"anchor" json:"anchor"`
+	InternalInterface string    `yaml:"internal_interface" json:"internal_interface"`
+	InternalNetwork   string    `yaml:"internal_network" json:"internal_network"`
+	PIDFile           string    `yaml:"pid_file,omitempty" json:"pid_file,omitempty"`
+	LeaseFile         string    `yaml:"lease_file,omitempty" json:"lease_file,omitempty"`
+	DummynetSlot      int       `yaml:"dummynet_slot" json:"dummynet_slot"`
+	Started           time.Time `yaml:"started" json:"started"`
+}
+
+// DummynetPipes returns the first and last dummynet object numbers of the
+// instance
+func (r Resources) DummynetPipes() (int, int) {
+	base := dummynetBase(r.DummynetSlot)
+	return base, base + 999
+}
+
+// conflict returns which resource r shares with other, if any
+func (r Resources) conflict(other Resources) string {
+	switch {
+	case r.Anchor == other.Anchor:
+		return "pf anchor " + r.Anchor
+	case r.InternalInterface == other.InternalInterface:
+		return "interface " + r.InternalInterface
+	case r.InternalNetwork == other.InternalNetwork:
+		return "network " + r.InternalNetwork + ".0/24"
+	case r.PIDFile != "" && r.PIDFile == other.PIDFile:
+		return "pidfile " + r.PIDFile
+	case r.LeaseFile != "" && r.LeaseFile == other.LeaseFile:
+		return "lease file " + r.LeaseFile
+	}
+	return ""
+}
+
+// Registry records the resources of running instances
+type Registry struct {
+	Instances map[string]Resources `yaml:"instances"`
+}
+
+// LoadRegistry reads the instance registry; a missing file is empty
+func LoadRegistry(path string) (*Registry, error) {
+	registry := &Registry{Instances: make(map[string]Resources)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read instance registry: %w", err)
+	}
+	if err := yaml.Unmarshal(data, registry); err != nil {
+		return nil, fmt.Errorf("failed to parse instance registry: %w", err)
+	}
+	if registry.Instances == nil {
+		registry.Instances = make(map[string]Resources)
+	}
+	return registry, nil
+}
+
+// Save writes the instance registry
+func (r *Registry) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal instance registry: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write instance registry: %w", err)
+	}
+	return nil
+}
+
+// List returns the registered instances sorted by name
+func (r *Registry) List() []Resources {
+	list := make([]Resources, 0, len(r.Instances))
+	for _, res := range r.Instances {
+		list = append(list, res)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Instance < list[j].Instance })
+	return list
+}
+
+// Claim registers res after dropping instances that are no longer live. It
+// refuses resources already owned by a live instance and assigns the
+// lowest free dummynet slot.
+func (r *Registry) Claim(res Resources, live func(Resources) bool) (Resources, error) {
+	used := make(map[int]bool)
+	var errs []error
+	for name, other := range r.Instances {
+		if !live(other) {
+			delete(r.Instances, name)
+			continue
+		}
+		used[other.DummynetSlot] = true
+		if other.Instance == res.Instance {
+			errs = append(errs, fmt.Errorf("instance %q is already running", res.Instance))
+		} else if what := res.conflict(other); what != "" {
+			errs = append(errs, fmt.Errorf("%s is already in use by running instance %q", what, other.Instance))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return res, conflictError{err}
+	}
+
+	res.DummynetSlot = -1
+	for slot := 0; slot < maxInstances; slot++ {
+		if !used[slot] {
+			res.DummynetSlot = slot
+			break
+		}
+	}
+	if res.DummynetSlot < 0 {
+		return res, conflictError{fmt.Errorf("at most %d instances can run at once", maxInstances)}
+	}
+
+	r.Instances[res.Instance] = res
+	return res, nil
+}
+
+// Release removes an instance from the registry
+func (r *Registry) Release(instance string) {
+	delete(r.Instances, instance)
+}
+
+// InstanceLive reports whether an instance still holds NAT rules or runs
+// its DHCP server
+func InstanceLive(res Resources) bool {
+	if pid := readPIDFile(res.PIDFile); pid > 0 && processAlive(pid) {
+		return true
+	}
+	return strings.Contains(commandOutput("pfctl", "-a", res.Anchor, "-s", "nat"), "nat on")
+}
+
+// instanceName returns the configured instance or the default one
+func (m *Manager) instanceName() string {
+	if m.config == nil || m.config.Instance == "" {
+		return DefaultInstance
+	}
+	return m.config.Instance
+}
+
+// resources describes what this instance owns on the host
+func (m *Manager) resources() Resources {
+	return Resources{
+		Instance:          m.instanceName(),
+		Anchor:            m.anchorName(),
+		InternalInterface: m.config.InternalInterface,
+		InternalNetwork:   m.config.InternalNetwork,
+		PIDFile:           m.config.PIDFile,
+		LeaseFile:         m.config.LeaseFile,
+		Started:           time.Now(),
+	}
+}
+
+// claimResources registers this instance, refusing to start when another
+// running instance owns the same resources
+func (m *Manager) claimResources() error {
+	if m.config.StateFile == "" {
+		return nil
+	}
+	registry, err := LoadRegistry(m.config.StateFile)
+	if err != nil {
+		return err
+	}
+	res, err := registry.Claim(m.resources(), InstanceLive)
+	if err != nil {
+		return err
+	}
+	m.config.Shaping.Base = dummynetBase(res.DummynetSlot)
+	return registry.Save(m.config.StateFile)
+}
+
+// releaseResources removes this instance from the registry and reports
+// whether other instances are still running
+func (m *Manager) releaseResources() bool {
+	if m.config.StateFile == "" {
+		return false
+	}
+	registry, err := LoadRegistry(m.config.StateFile)
+	if err != nil {
+		return false
+	}
+	registry.Release(m.instanceName())
+	_ = registry.Save(m.config.StateFile)
+
+	for _, other := range registry.Instances {
+		if InstanceLive(other) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDummynetBase sets the dummynet numbers recorded for this running
+// instance, so that rule reloads from another process use the same pipes
+func (m *Manager) loadDummynetBase() {
+	if m.config.Shaping.Base != 0 || m.config.StateFile == "" {
+		return
+	}
+	registry, err := LoadRegistry(m.config.StateFile)
+	if err != nil {
+		return
+	}
+	if res, ok := registry.Instances[m.instanceName()]; ok {
+		m.config.Shaping.Base = dummynetBase(res.DummynetSlot)
+	}
+}
+
+// writePIDFile records the PID of the DHCP supervisor, or of dnsmasq itself
+// when it runs unsupervised
+func (m *Manager) writePIDFile(pid int) error {
+	if m.config.PIDFile == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(m.config.PIDFile), 0755); err != nil {
+		return fmt.Errorf("failed to create pidfile directory: %w", err)
+	}
+	return os.WriteFile(m.config.PIDFile, []byte(strconv.Itoa(pid)+"\n"), 0600)
+}
+
+// stopDHCPServer stops this instance's dnsmasq through its supervisor,
+// which terminates dnsmasq on SIGTERM. Without a pidfile, as left by older
+// versions, every dnsmasq is stopped.
+func (m *Manager) stopDHCPServer() {
+	pid := readPIDFile(m.config.PIDFile)
+	if pid <= 0 {
+		_ = runCmd(exec.Command("killall", "dnsmasq"))
+		return
+	}
+	audit.Change("kill", "pid "+strconv.Itoa(pid), syscall.Kill(pid, syscall.SIGTERM))
+	_ = os.Remove(m.config.PIDFile)
+}
+
+// supervisorAlive reports whether the process in the pidfile is running
+func (m *Manager) supervisorAlive() bool {
+	pid := readPIDFile(m.config.PIDFile)
+	return pid > 0 && processAlive(pid)
+}
+
+// readPIDFile returns the PID recorded in path, or 0
+func readPIDFile(path string) int {
+	if path == "" {
+		return 0
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// processAlive reports whether a process with pid exists
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
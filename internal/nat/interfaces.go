@@ -0,0 +1,124 @@
+package nat
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// defaultRouteInterface returns the interface holding the IPv4 default
+// route, from the output of "route -n get default"
+func defaultRouteInterface(output string) string {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "interface:"); ok {
+			return strings.TrimSpace(name)
+		}
+	}
+	return ""
+}
+
+// defaultGateway returns the router of the default route from the output
+// of "route -n get default", or "" without one
+func defaultGateway(output string) string {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if gateway, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "gateway:"); ok {
+			return strings.TrimSpace(gateway)
+		}
+	}
+	return ""
+}
+
+// parseLinkRate returns the link speed in bits per second reported by
+// "ifconfig -v", e.g. "link rate: 1.00 Gbps", or 0 if unknown
+func parseLinkRate(output string) uint64 {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		rate, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "link rate:")
+		if !ok {
+			continue
+		}
+		// Wi-Fi reports "uplink / downlink", the downlink rate is used
+		if _, down, found := strings.Cut(rate, "/"); found {
+			rate = down
+		}
+		fields := strings.Fields(rate)
+		if len(fields) != 2 {
+			return 0
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return 0
+		}
+		multipliers := map[string]float64{"bps": 1, "Kbps": 1e3, "Mbps": 1e6, "Gbps": 1e9}
+		return uint64(value * multipliers[fields[1]])
+	}
+	return 0
+}
+
+// hasDHCPLease reports whether "ipconfig getpacket" shows the DHCP reply
+// an interface was configured with
+func hasDHCPLease(output string) bool {
+	return strings.Contains(output, "op = BOOTREPLY")
+}
+
+// addInterfaceDetails fills in the link speed, default route and DHCP use
+// of interfaces that are up
+func addInterfaceDetails(interfaces []NetworkInterface) {
+	defaultIface := defaultRouteInterface(commandOutput("route", "-n", "get", "default"))
+	for i := range interfaces {
+		iface := &interfaces[i]
+		iface.DefaultRoute = iface.Name == defaultIface
+		if iface.Status != "up" || iface.Type == "Loopback" {
+			continue
+		}
+		iface.LinkSpeed = parseLinkRate(commandOutput("ifconfig", "-v", iface.Name))
+		if iface.IP != "" {
+			iface.DHCP = hasDHCPLease(commandOutput("ipconfig", "getpacket", iface.Name))
+		}
+	}
+}
+
+// HostNetworks returns the IPv4 networks of the host's interfaces
+func HostNetworks() []*net.IPNet {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var networks []*net.IPNet
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil && !ipnet.IP.IsLoopback() {
+			networks = append(networks, ipnet)
+		}
+	}
+	return networks
+}
+
+// SuggestNetwork returns the first private /24 overlapping none of used,
+// as its first three octets: 192.168.100 to 192.168.254, then 10.100.0 to
+// 10.100.255. It returns "" if all of them are taken.
+func SuggestNetwork(used []*net.IPNet) string {
+	free := func(network string) bool {
+		_, candidate, _ := net.ParseCIDR(network + ".0/24")
+		for _, n := range used {
+			if n.Contains(candidate.IP) || candidate.Contains(n.IP) {
+				return false
+			}
+		}
+		return true
+	}
+	for i := 100; i <= 254; i++ {
+		if network := fmt.Sprintf("192.168.%d", i); free(network) {
+			return network
+		}
+	}
+	for i := 0; i <= 255; i++ {
+		if network := fmt.Sprintf("10.100.%d", i); free(network) {
+			return network
+		}
+	}
+	return ""
+}
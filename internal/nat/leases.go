@@ -0,0 +1,201 @@
+package nat
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/fingerprint"
+	"github.com/scttfrdmn/macos-nat-manager/internal/names"
+)
+
+// Lease represents a DHCP lease recorded by dnsmasq
+type Lease struct {
+	Expiry   time.Time
+	MAC      string
+	IP       string
+	Hostname string
+	ClientID string
+}
+
+// DNSRecord represents a name published in the local DNS zone
+type DNSRecord struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+// GetLeases returns the DHCP leases from the lease database of the DHCP
+// backend
+func (m *Manager) GetLeases() ([]Lease, error) {
+	if m.config == nil || m.config.LeaseFile == "" {
+		return []Lease{}, nil
+	}
+
+	file, err := os.Open(m.config.LeaseFile)
+	if os.IsNotExist(err) {
+		return []Lease{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lease file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	if m.dhcpBackend() == BackendKea {
+		return ParseKeaLeases(file)
+	}
+	return ParseLeases(file)
+}
+
+// GetDNSRecords returns the static records and the local zone records
+// registered for DHCP clients
+func (m *Manager) GetDNSRecords() ([]DNSRecord, error) {
+	records := make([]DNSRecord, 0)
+	if m.config == nil {
+		return records, nil
+	}
+	records = append(records, m.config.StaticRecords...)
+	if m.config.LocalDomain == "" {
+		return records, nil
+	}
+
+	leases, err := m.GetLeases()
+	if err != nil {
+		return nil, err
+	}
+
+	records = append(records, DNSRecord{
+		Name:  "gateway." + m.config.LocalDomain,
+		Type:  "A",
+		Value: m.config.InternalNetwork + ".1",
+	})
+	for _, lease := range leases {
+		if lease.Hostname == "" {
+			continue
+		}
+		records = append(records, DNSRecord{
+			Name:  lease.Hostname + "." + m.config.LocalDomain,
+			Type:  "A",
+			Value: lease.IP,
+		})
+	}
+
+	return records, nil
+}
+
+// ParseLeases parses a dnsmasq lease file. Each line has the form
+// "<expiry> <mac> <ip> <hostname> <client-id>" where hostname is "*" if unknown.
+func ParseLeases(r io.Reader) ([]Lease, error) {
+	leases := make([]Lease, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		lease := Lease{
+			MAC: fields[1],
+			IP:  fields[2],
+		}
+		if expiry > 0 {
+			lease.Expiry = time.Unix(expiry, 0)
+		}
+		if fields[3] != "*" {
+			lease.Hostname = fields[3]
+		}
+		if len(fields) > 4 && fields[4] != "*" {
+			lease.ClientID = fields[4]
+		}
+		leases = append(leases, lease)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read leases: %w", err)
+	}
+	return leases, nil
+}
+
+// connectedDevices converts the current leases into connected devices
+func (m *Manager) connectedDevices() []ConnectedDevice {
+	devices := make([]ConnectedDevice, 0)
+	leases, err := m.GetLeases()
+	if err != nil {
+		return devices
+	}
+
+	lookups := make([]names.Device, 0, len(leases))
+	for _, lease := range leases {
+		lookups = append(lookups, names.Device{IP: lease.IP, MAC: lease.MAC, Hostname: lease.Hostname})
+	}
+	resolved := m.nameChain().ResolveAll(context.Background(), lookups)
+	fingerprints := m.fingerprints()
+
+	for i, lease := range leases {
+		remaining := "infinite"
+		if !lease.Expiry.IsZero() {
+			remaining = time.Until(lease.Expiry).Round(time.Minute).String()
+		}
+		devices = append(devices, ConnectedDevice{
+			IP:         lease.IP,
+			MAC:        lease.MAC,
+			Hostname:   resolved[i].Name,
+			NameSource: resolved[i].Source,
+			Type:       deviceType(lease, fingerprints),
+			LeaseTime:  remaining,
+		})
+	}
+	return devices
+}
+
+// fingerprints loads the recorded DHCP fingerprints, if any
+func (m *Manager) fingerprints() map[string]fingerprint.Observation {
+	if m.config == nil || m.config.FingerprintFile == "" {
+		return nil
+	}
+	observations, _ := fingerprint.Load(m.config.FingerprintFile)
+	return observations
+}
+
+// deviceType classifies a leased device from its recorded fingerprint,
+// falling back to its MAC vendor alone
+func deviceType(lease Lease, fingerprints map[string]fingerprint.Observation) string {
+	obs, ok := fingerprints[strings.ToLower(lease.MAC)]
+	if !ok {
+		obs = fingerprint.Observation{MAC: lease.MAC, Hostname: lease.Hostname}
+	}
+	return fingerprint.Classify(obs)
+}
+
+// nameChain returns the device name resolver for the configured sources.
+// An invalid configuration falls back to labels and DHCP hostnames.
+func (m *Manager) nameChain() *names.Chain {
+	m.namesOnce.Do(func() {
+		order := []string{names.SourceDHCP}
+		var labels map[string]string
+		var timeout time.Duration
+		if m.config != nil {
+			labels, timeout = m.config.DeviceLabels, m.config.NameTimeout
+			if len(m.config.NameSources) > 0 {
+				order = m.config.NameSources
+			}
+		}
+
+		sources, err := names.ParseSources(order, labels)
+		if err != nil {
+			sources, _ = names.ParseSources([]string{names.SourceLabel, names.SourceDHCP}, labels)
+		}
+		m.names = names.NewChain(sources, timeout)
+	})
+	return m.names
+}
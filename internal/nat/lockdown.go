@@ -0,0 +1,126 @@
+package nat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// allowedTable is the pf table of destinations reachable in lockdown mode
+const allowedTable = "nat_manager_allowed"
+
+// domainRe matches DNS names such as example.com or exam.school.edu
+var domainRe = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9]$`)
+
+// Lockdown restricts internal clients to an explicit list of destinations.
+// Domains also allow their subdomains and are resolved into the allowed
+// table when rules load and whenever the embedded DNS forwarder answers
+// for them.
+type Lockdown struct {
+	Enabled bool
+	Allow   []string // IPs, CIDRs or domain names
+}
+
+// ValidateDestination checks that an allowed destination is an IPv4
+// address, an IPv4 CIDR or a domain name
+func ValidateDestination(dest string) error {
+	if ip := net.ParseIP(dest); ip != nil && ip.To4() != nil {
+		return nil
+	}
+	if ip, _, err := net.ParseCIDR(dest); err == nil && ip.To4() != nil {
+		return nil
+	}
+	if domainRe.MatchString(strings.ToLower(strings.TrimSuffix(dest, "."))) {
+		return nil
+	}
+	return fmt.Errorf("%q is not an IPv4 address, CIDR or domain name", dest)
+}
+
+// ValidateLockdown checks every allowed destination
+func ValidateLockdown(l Lockdown) error {
+	var errs []error
+	for _, dest := range l.Allow {
+		errs = append(errs, ValidateDestination(dest))
+	}
+	return errors.Join(errs...)
+}
+
+// splitDestinations separates literal addresses and networks, which are
+// rendered into the ruleset, from domains resolved at runtime
+func splitDestinations(allow []string) (addrs, domains []string) {
+	for _, dest := range allow {
+		if net.ParseIP(dest) != nil {
+			addrs = append(addrs, dest)
+		} else if _, network, err := net.ParseCIDR(dest); err == nil {
+			addrs = append(addrs, network.String())
+		} else {
+			domains = append(domains, strings.ToLower(strings.TrimSuffix(dest, ".")))
+		}
+	}
+	sort.Strings(addrs)
+	return addrs, domains
+}
+
+// AllowsName reports whether name is an allowed domain or one of its
+// subdomains
+func (l Lockdown) AllowsName(name string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	_, domains := splitDestinations(l.Allow)
+	for _, domain := range domains {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockdownTable declares the allowed table with the literal destinations.
+// It persists while empty so that resolved domains can be added later.
+func lockdownTable(l Lockdown) string {
+	addrs, _ := splitDestinations(l.Allow)
+	if len(addrs) == 0 {
+		return fmt.Sprintf("table <%s> persist\n", allowedTable)
+	}
+	return fmt.Sprintf("table <%s> persist { %s }\n", allowedTable, strings.Join(addrs, " "))
+}
+
+// lockdownRules let clients reach the allowed table and drop everything
+// else they send
+func lockdownRules(cfg *Config) string {
+	network := cfg.InternalNetwork + ".0/24"
+	return fmt.Sprintf("pass in quick on %s from %s to <%s>\n", cfg.InternalInterface, network, allowedTable) +
+		fmt.Sprintf("block drop in quick on %s from %s to any\n", cfg.InternalInterface, network)
+}
+
+// AllowResolved adds the addresses a DNS answer gave for name to the
+// allowed table when name is an allowed domain
+func (m *Manager) AllowResolved(name string, ips []net.IP) error {
+	if !m.config.Lockdown.Enabled || !m.config.Lockdown.AllowsName(name) {
+		return nil
+	}
+	var addrs []string
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			addrs = append(addrs, ip.String())
+		}
+	}
+	return m.updateTable(allowedTable, "add", addrs)
+}
+
+// resolveAllowedDomains looks up the allowed domains so that clients
+// using another resolver can still reach them
+func (m *Manager) resolveAllowedDomains() error {
+	_, domains := splitDestinations(m.config.Lockdown.Allow)
+	var errs []error
+	for _, domain := range domains {
+		ips, err := net.LookupIP(domain)
+		if err != nil {
+			continue
+		}
+		errs = append(errs, m.AllowResolved(domain, ips))
+	}
+	return errors.Join(errs...)
+}
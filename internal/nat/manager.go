@@ -3,50 +3,110 @@ package nat
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
+	"github.com/scttfrdmn/macos-nat-manager/internal/names"
 )
 
 // Config represents the configuration for NAT
 type Config struct {
+	Instance          string // instance name, DefaultInstance if empty
 	ExternalInterface string
 	InternalInterface string
 	InternalNetwork   string
 	DHCPRange         DHCPRange
+	DeviceLeases      []DeviceLease // per-device lease times
+	SearchDomains     []string      // DHCP option 119
+	NTPServers        []string      // DHCP option 42
 	DNSServers        []string
+	LocalDomain       string
+	LeaseFile         string
+	PIDFile           string // dnsmasq pidfile
+	Executable        string // nat-manager executable supervising dnsmasq and handling lease changes
+	FingerprintFile   string // DHCP fingerprints recorded by lease change events
+	InventoryFile     string // when each device was first and last seen
+	StateFile         string // registry of running instances, shared by all instances
+	EmbeddedDNS       bool
+	DHCPBackend       string              // dnsmasq (the default) or kea
+	DNSBackend        string              // dnsmasq (the default) or coredns
+	DomainServers     map[string][]string // conditional forwarding: domain -> resolvers
+	StaticRecords     []DNSRecord
+	PortForwards      []PortForward
+	BlockedDevices    []string // MAC or IP addresses
+	IsolatedDevices   []string // MAC or IP addresses kept off the internet
+	ClassPolicies     []ClassPolicy
+	Lockdown          Lockdown
+	Portal            Portal
+	Shaping           Shaping
+	WireGuard         WireGuard
+	VMs               []VM              // attached virtual machines, shown among the devices
+	DeviceLabels      map[string]string // MAC or IP -> user-assigned name
+	NameSources       []string          // device name resolution order, DHCP only if empty
+	NameTimeout       time.Duration
+	TrafficQuota      uint64 // bytes through the internal interface that trigger a quota event, 0 for none
 	Active            bool
 }
 
 // DHCPRange represents DHCP IP range configuration
 type DHCPRange struct {
-	Start string
-	End   string
-	Lease string
+	Start   string
+	End     string
+	Lease   string
+	Exclude []string // addresses or first-last ranges kept out of the pool
 }
 
 // NetworkInterface represents a network interface
 type NetworkInterface struct {
-	Name   string
-	Type   string
-	Status string
-	IP     string
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Status       string `json:"status"`
+	IP           string `json:"ip"`
+	Network      string `json:"network,omitempty"` // IPv4 network of IP in CIDR notation
+	MAC          string `json:"mac,omitempty"`
+	MTU          int    `json:"mtu"`
+	LinkSpeed    uint64 `json:"link_speed_bps,omitempty"` // 0 if unknown
+	DefaultRoute bool   `json:"default_route"`            // holds the IPv4 default route
+	DHCP         bool   `json:"dhcp"`                     // configured by DHCP
 }
 
 // Connection represents a network connection
 type Connection struct {
-	Source      string
-	Destination string
-	Protocol    string
-	State       string
+	Source      string        `json:"source"`
+	Destination string        `json:"destination"`
+	Protocol    string        `json:"protocol"`
+	State       string        `json:"state"`
+	Translated  string        `json:"translated,omitempty"` // source after NAT, for translated pf states
+	Bytes       uint64        `json:"bytes,omitempty"`      // both directions, known for pf states
+	Packets     uint64        `json:"packets,omitempty"`    // both directions, known for pf states
+	Age         time.Duration `json:"age_ns,omitempty"`     // known for pf states
+	Entry       string        `json:"-"`                    // pf's description of the state, if from pf
 }
 
 // Manager manages NAT operations
 type Manager struct {
 	config  *Config
 	dhcpPid int
+
+	namesOnce sync.Once
+	names     *names.Chain
+
+	trafficOnce sync.Once
+	traffic     *ifstats.Sampler
+
+	progress func(step string) // told each step of starting and stopping
 }
 
 // NewManager creates a new NAT manager
@@ -56,6 +116,19 @@ func NewManager(config *Config) *Manager {
 	}
 }
 
+// SetProgress sets a function told each step of StartNAT and Stop as it
+// begins, or none if report is nil
+func (m *Manager) SetProgress(report func(step string)) {
+	m.progress = report
+}
+
+// step reports a step of starting or stopping
+func (m *Manager) step(format string, args ...any) {
+	if m.progress != nil {
+		m.progress(fmt.Sprintf(format, args...))
+	}
+}
+
 // GetNetworkInterfaces returns a list of available network interfaces
 func (m *Manager) GetNetworkInterfaces() ([]NetworkInterface, error) {
 	interfaces, err := net.Interfaces()
@@ -70,11 +143,12 @@ func (m *Manager) GetNetworkInterfaces() ([]NetworkInterface, error) {
 			continue
 		}
 
-		var ip string
+		var ip, network string
 		for _, addr := range addrs {
 			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
 				if ipnet.IP.To4() != nil {
 					ip = ipnet.IP.String()
+					network = (&net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}).String()
 					break
 				}
 			}
@@ -86,86 +160,136 @@ func (m *Manager) GetNetworkInterfaces() ([]NetworkInterface, error) {
 		}
 
 		result = append(result, NetworkInterface{
-			Name:   iface.Name,
-			Type:   getInterfaceType(iface.Name),
-			Status: status,
-			IP:     ip,
+			Name:    iface.Name,
+			Type:    getInterfaceType(iface.Name),
+			Status:  status,
+			IP:      ip,
+			Network: network,
+			MAC:     iface.HardwareAddr.String(),
+			MTU:     iface.MTU,
 		})
 	}
+	addInterfaceDetails(result)
 
 	return result, nil
 }
 
 // StartNAT starts the NAT service
 func (m *Manager) StartNAT() error {
+	defer operationDuration.Since("start", time.Now())
 	if m.config == nil {
 		return fmt.Errorf("NAT config is nil")
 	}
+	dhcpErr := ValidateDHCP(m.config.DHCPRange, m.config.DeviceLeases, m.config.InternalNetwork)
+	if err := errors.Join(m.validateInterfaces(), m.validateRules(), dhcpErr); err != nil {
+		return fmt.Errorf("invalid NAT configuration: %w", err)
+	}
+	if err := m.claimResources(); err != nil {
+		return fmt.Errorf("cannot start instance %q: %w", m.instanceName(), err)
+	}
 
 	// Create bridge interface if it doesn't exist
 	if strings.HasPrefix(m.config.InternalInterface, "bridge") {
+		m.step("Bringing up %s", m.config.InternalInterface)
 		cmd := exec.Command("ifconfig", m.config.InternalInterface, "create")
-		_ = cmd.Run() // Interface might already exist, which is fine
+		_ = runCmd(cmd) // Interface might already exist, which is fine
 
 		// Configure bridge interface
 		bridgeIP := m.config.InternalNetwork + ".1"
 		cmd = exec.Command("ifconfig", m.config.InternalInterface, "inet", bridgeIP, "netmask", "255.255.255.0")
-		if err := cmd.Run(); err != nil {
+		if err := runCmd(cmd); err != nil {
 			return fmt.Errorf("failed to configure bridge interface: %w", err)
 		}
 	}
 
 	// Enable IP forwarding
+	m.step("Enabling IP forwarding")
 	cmd := exec.Command("sysctl", "-w", "net.inet.ip.forwarding=1")
-	if err := cmd.Run(); err != nil {
+	if err := runCmd(cmd); err != nil {
 		return fmt.Errorf("failed to enable IP forwarding: %w", err)
 	}
 
-	// Set up NAT rules with pfctl
-	natRule := fmt.Sprintf("nat on %s from %s.0/24 to any -> (%s)",
-		m.config.ExternalInterface, m.config.InternalNetwork, m.config.ExternalInterface)
-
+	m.step("Enabling pf")
 	cmd = exec.Command("pfctl", "-e")
-	if err := cmd.Run(); err != nil {
+	if err := runCmd(cmd); err != nil {
 		return fmt.Errorf("failed to enable pfctl: %w", err)
 	}
 
-	// Write NAT rule to pfctl
-	cmd = exec.Command("sh", "-c", fmt.Sprintf("echo '%s' | pfctl -f -", natRule))
-	if err := cmd.Run(); err != nil {
+	// Hook our anchor into the main ruleset, then load NAT, forwarding and
+	// blocking rules into it
+	m.step("Loading NAT rules")
+	if err := pfctlLoad(mainRuleset(DefaultAnchor)); err != nil {
+		return fmt.Errorf("failed to set NAT rule: %w", err)
+	}
+	if err := m.loadAnchor(); err != nil {
 		return fmt.Errorf("failed to set NAT rule: %w", err)
 	}
+	_ = m.resetAccounting()
 
 	// Start DHCP server
+	m.step("Starting the DHCP server")
 	if err := m.startDHCPServer(); err != nil {
 		return fmt.Errorf("failed to start DHCP server: %w", err)
 	}
 
 	m.config.Active = true
+	audit.Event("nat started", fmt.Sprintf("%s -> %s", m.config.ExternalInterface, m.config.InternalInterface))
+	m.emit(event.NATStarted, m.interfaces())
 	return nil
 }
 
 // StopNAT stops the NAT service
 func (m *Manager) StopNAT() error {
+	return m.Stop(StopOptions{})
+}
+
+// StopOptions select the parts of a running instance that Stop leaves in
+// place
+type StopOptions struct {
+	KeepInterface  bool // leave the internal interface and its address up
+	KeepDHCP       bool // leave the DHCP server running, implies KeepInterface
+	KeepForwarding bool // leave IP forwarding enabled
+}
+
+// Stop removes the instance's NAT rules and tears down the rest of what it
+// set up, except the parts kept by opts
+func (m *Manager) Stop(opts StopOptions) error {
+	defer operationDuration.Since("stop", time.Now())
 	if m.config == nil {
 		return fmt.Errorf("NAT config is nil")
 	}
 
-	// Disable pfctl
-	_ = exec.Command("pfctl", "-d").Run()
+	// Remove this instance's rules and bandwidth guarantees
+	m.step("Removing NAT rules")
+	m.loadDummynetBase()
+	_ = runCmd(exec.Command("pfctl", "-a", m.anchorName(), "-F", "all"))
+	m.removeShaping()
 
 	// Destroy bridge interface if we created it
-	if strings.HasPrefix(m.config.InternalInterface, "bridge") {
-		_ = exec.Command("ifconfig", m.config.InternalInterface, "destroy").Run()
+	if strings.HasPrefix(m.config.InternalInterface, "bridge") && !opts.KeepInterface && !opts.KeepDHCP {
+		m.step("Removing %s", m.config.InternalInterface)
+		_ = runCmd(exec.Command("ifconfig", m.config.InternalInterface, "destroy"))
 	}
 
 	// Stop DHCP server
-	_ = exec.Command("killall", "dnsmasq").Run()
+	if !opts.KeepDHCP {
+		m.step("Stopping the DHCP server")
+		m.stopDHCPServer()
+	}
 
-	// Disable IP forwarding
-	_ = exec.Command("sysctl", "-w", "net.inet.ip.forwarding=0").Run()
+	// Disable pfctl and IP forwarding unless other instances still need them
+	if !m.releaseResources() {
+		m.step("Disabling pf")
+		_ = runCmd(exec.Command("pfctl", "-d"))
+		if !opts.KeepForwarding {
+			m.step("Disabling IP forwarding")
+			_ = runCmd(exec.Command("sysctl", "-w", "net.inet.ip.forwarding=0"))
+		}
+	}
 
 	m.config.Active = false
+	audit.Event("nat stopped", fmt.Sprintf("%s -> %s", m.config.ExternalInterface, m.config.InternalInterface))
+	m.emit(event.NATStopped, m.interfaces())
 	return nil
 }
 
@@ -174,7 +298,7 @@ func (m *Manager) GetActiveConnections() ([]Connection, error) {
 	connections := make([]Connection, 0)
 
 	cmd := exec.Command("netstat", "-n")
-	output, err := cmd.Output()
+	output, err := cmdOutput(cmd)
 	if err != nil {
 		// Return empty slice instead of error to avoid breaking status
 		return connections, nil
@@ -213,65 +337,146 @@ func (m *Manager) GetConfig() *Config {
 
 // Cleanup performs cleanup operations
 func (m *Manager) Cleanup() {
-	_ = exec.Command("pfctl", "-d").Run()
-	_ = exec.Command("killall", "dnsmasq").Run()
-	_ = exec.Command("sysctl", "-w", "net.inet.ip.forwarding=0").Run()
+	_ = runCmd(exec.Command("pfctl", "-d"))
+	_ = runCmd(exec.Command("killall", "dnsmasq"))
+	_ = runCmd(exec.Command("sysctl", "-w", "net.inet.ip.forwarding=0"))
 }
 
-// startDHCPServer starts the DHCP server using dnsmasq
-func (m *Manager) startDHCPServer() error {
-	dhcpRange := fmt.Sprintf("%s.%s,%s.%s,%s",
-		m.config.InternalNetwork, m.config.DHCPRange.Start,
-		m.config.InternalNetwork, m.config.DHCPRange.End,
-		m.config.DHCPRange.Lease)
+// dnsmasqOptions returns the dnsmasq settings for this instance as
+// option=value lines of a dnsmasq.conf
+func (m *Manager) dnsmasqOptions(script string) ([]string, error) {
+	serveDHCP := m.dhcpBackend() == BackendDnsmasq
+	var dhcpArgs []string
+	if serveDHCP {
+		var err error
+		if dhcpArgs, err = dnsmasqDHCPArgs(m.config); err != nil {
+			return nil, err
+		}
+	}
+
+	args := []string{"--interface=" + m.config.InternalInterface}
+	args = append(args, dhcpArgs...)
+	args = append(args, "--log-queries", "--log-dhcp")
 
-	args := []string{
-		"--interface=" + m.config.InternalInterface,
-		"--dhcp-range=" + dhcpRange,
-		"--no-daemon",
-		"--log-queries",
-		"--log-dhcp",
+	if !m.servesDNS() {
+		// DNS is answered by the embedded forwarder or CoreDNS on the gateway
+		args = append(args,
+			"--port=0",
+			"--dhcp-option=option:dns-server,"+m.config.InternalNetwork+".1")
 	}
 
 	// Add DNS servers
 	for _, dns := range m.config.DNSServers {
 		args = append(args, "--server="+dns)
 	}
+	if m.servesDNS() {
+		args = append(args, dnsmasqDomainServers(m.config.DomainServers)...)
+	}
 
-	cmd := exec.Command("dnsmasq", args...)
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start dnsmasq: %w", err)
+	// Register DHCP client hostnames in the local zone
+	if m.config.LocalDomain != "" {
+		args = append(args,
+			"--domain="+m.config.LocalDomain,
+			"--local=/"+m.config.LocalDomain+"/",
+			"--expand-hosts")
+	}
+
+	if serveDHCP && m.config.LeaseFile != "" {
+		args = append(args, "--dhcp-leasefile="+m.config.LeaseFile)
+	}
+	if serveDHCP && script != "" {
+		args = append(args, "--dhcp-script="+script)
+	}
+
+	if m.servesDNS() {
+		args = append(args, dnsmasqStaticRecords(m.config.StaticRecords)...)
+	}
+
+	options := make([]string, 0, len(args))
+	for _, arg := range args {
+		options = append(options, strings.TrimPrefix(arg, "--"))
+	}
+	return options, nil
+}
+
+// startDHCPServer writes the configuration of this instance's DHCP and DNS
+// servers and starts them under a supervisor that restarts them and
+// captures their logs
+func (m *Manager) startDHCPServer() error {
+	script, err := m.writeDHCPEventScript()
+	if err != nil {
+		return err
+	}
+	for _, server := range m.servers() {
+		if err := m.writeServerConf(server, script); err != nil {
+			return err
+		}
+		_ = os.Remove(m.runtimePath(server.Name() + healthSuffix))
+	}
+	if m.dnsBackend() == BackendCoreDNS && !m.config.EmbeddedDNS {
+		if err := m.writeCoreDNSHosts(); err != nil {
+			return err
+		}
+	}
+	return m.spawnDHCP()
+}
+
+// spawnDHCP starts the DHCP supervisor from the written configuration and
+// records its PID. Without a nat-manager executable to supervise it,
+// dnsmasq is run directly, which only covers the default backends.
+func (m *Manager) spawnDHCP() error {
+	servers := m.servers()
+	cmd := exec.Command(dnsmasqBinary, "--conf-file="+m.runtimePath(BackendDnsmasq+confSuffix))
+	if m.config.Executable != "" {
+		cmd = exec.Command(m.config.Executable, "--instance", m.instanceName(), "dhcp-supervise")
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	} else if len(servers) > 1 || servers[0].Name() != BackendDnsmasq {
+		return fmt.Errorf("kea, coredns and the embedded DNS forwarder need the nat-manager supervisor")
+	}
+	err := cmd.Start()
+	audit.Change("start", strings.Join(cmd.Args, " "), err)
+	if err != nil {
+		return fmt.Errorf("failed to start %s: %w", servers[0].Name(), err)
 	}
 
 	m.dhcpPid = cmd.Process.Pid
-	return nil
+	// Reap it if it exits while we run so the watchdog sees it gone
+	go func() { _ = cmd.Wait() }()
+	return m.writePIDFile(m.dhcpPid)
 }
 
 // ConnectedDevice represents a connected device
 type ConnectedDevice struct {
-	IP        string
-	MAC       string
-	Hostname  string
-	LeaseTime string
+	IP         string `json:"ip"`
+	MAC        string `json:"mac"`
+	Hostname   string `json:"hostname"`
+	NameSource string `json:"name_source,omitempty"` // label, dhcp, mdns, netbios or reverse_dns
+	Type       string `json:"type,omitempty"`        // guessed from the DHCP fingerprint and MAC vendor
+	LeaseTime  string `json:"lease_time"`
 }
 
 // Status represents NAT status information
 type Status struct {
-	Active            bool
-	Running           bool // Alias for Active for backward compatibility
-	ExternalIP        string
-	Uptime            string
-	ConnectedDevices  []ConnectedDevice
-	ActiveConnections []Connection
-	BytesIn           uint64
-	BytesOut          uint64
-	IPForwarding      bool
-	PFCTLEnabled      bool
-	DHCPRunning       bool
+	Active            bool                `json:"active"`
+	Running           bool                `json:"running"` // Alias for Active for backward compatibility
+	ExternalIP        string              `json:"external_ip"`
+	Uptime            string              `json:"uptime"`
+	ConnectedDevices  []ConnectedDevice   `json:"connected_devices"`
+	ActiveConnections []Connection        `json:"active_connections"`
+	BytesIn           uint64              `json:"bytes_in"`             // received by NAT clients
+	BytesOut          uint64              `json:"bytes_out"`            // sent by NAT clients
+	Throughput        *ifstats.Throughput `json:"throughput,omitempty"` // since the previous status of this manager
+	Interfaces        []ifstats.Counters  `json:"interfaces,omitempty"` // counters of the internal and external interface
+	IPForwarding      bool                `json:"ip_forwarding"`
+	PFCTLEnabled      bool                `json:"pfctl_enabled"`
+	DHCPRunning       bool                `json:"dhcp_running"`
+	DHCPHealth        *ServerHealth       `json:"dhcp_health,omitempty"`
+	DNSHealth         *ServerHealth       `json:"dns_health,omitempty"` // when DNS runs in a separate server
 }
 
 // GetStatus returns current NAT status
 func (m *Manager) GetStatus() (*Status, error) {
+	defer operationDuration.Since("status", time.Now())
 	connections, _ := m.GetActiveConnections()
 	if connections == nil {
 		connections = []Connection{}
@@ -283,7 +488,7 @@ func (m *Manager) GetStatus() (*Status, error) {
 		Running:           isActive, // Alias for backward compatibility
 		ExternalIP:        "N/A",
 		Uptime:            "N/A",
-		ConnectedDevices:  []ConnectedDevice{},
+		ConnectedDevices:  m.connectedDevices(),
 		ActiveConnections: connections,
 		BytesIn:           0,
 		BytesOut:          0,
@@ -296,10 +501,20 @@ func (m *Manager) GetStatus() (*Status, error) {
 		return status, nil
 	}
 
+	m.sampleTraffic(status)
+
+	if health, err := m.DHCPHealth(); err == nil {
+		status.DHCPHealth = health
+		status.DHCPRunning = isActive && health.PID > 0 && m.supervisorAlive()
+	}
+	if health, err := m.DNSHealth(); err == nil {
+		status.DNSHealth = health
+	}
+
 	// Try to get external IP
 	if m.config.ExternalInterface != "" {
 		cmd := exec.Command("ifconfig", m.config.ExternalInterface)
-		if output, err := cmd.Output(); err == nil {
+		if output, err := cmdOutput(cmd); err == nil {
 			re := regexp.MustCompile(`inet (\d+\.\d+\.\d+\.\d+)`)
 			if matches := re.FindStringSubmatch(string(output)); len(matches) > 1 {
 				status.ExternalIP = matches[1]
@@ -310,6 +525,69 @@ func (m *Manager) GetStatus() (*Status, error) {
 	return status, nil
 }
 
+// sampleTraffic fills in the NAT clients' traffic from the internal
+// interface counters, on which the clients' downloads are output
+func (m *Manager) sampleTraffic(status *Status) {
+	m.trafficOnce.Do(func() {
+		m.traffic = ifstats.NewSampler(m.config.InternalInterface)
+	})
+	counters, rate, err := m.traffic.Sample()
+	if err != nil {
+		return
+	}
+	status.BytesIn, status.BytesOut = counters.BytesOut, counters.BytesIn
+	if rate != nil {
+		status.Throughput = &ifstats.Throughput{In: rate.Out, Out: rate.In}
+	}
+
+	status.Interfaces = append(status.Interfaces, counters)
+	if m.config.ExternalInterface != "" {
+		if external, err := ifstats.Read(m.config.ExternalInterface); err == nil {
+			status.Interfaces = append(status.Interfaces, external)
+		}
+	}
+}
+
+// dnsmasqStaticRecords renders static DNS records as dnsmasq options
+func dnsmasqStaticRecords(records []DNSRecord) []string {
+	var args []string
+	for _, record := range records {
+		switch record.Type {
+		case "A", "AAAA":
+			args = append(args, fmt.Sprintf("--host-record=%s,%s", record.Name, record.Value))
+		case "CNAME":
+			args = append(args, fmt.Sprintf("--cname=%s,%s", record.Name, record.Value))
+		}
+	}
+	return args
+}
+
+// dnsmasqDomainServers renders conditional forwarding as dnsmasq
+// --server=/domain/ip#port options. Encrypted resolvers are only supported by
+// the embedded DNS forwarder and are skipped.
+func dnsmasqDomainServers(domainServers map[string][]string) []string {
+	domains := make([]string, 0, len(domainServers))
+	for domain := range domainServers {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	var args []string
+	for _, domain := range domains {
+		for _, server := range domainServers[domain] {
+			host, port, err := net.SplitHostPort(server)
+			if err != nil {
+				host, port = server, "53"
+			}
+			if net.ParseIP(host) == nil {
+				continue
+			}
+			args = append(args, fmt.Sprintf("--server=/%s/%s#%s", domain, host, port))
+		}
+	}
+	return args
+}
+
 // getInterfaceType determines the type of network interface
 func getInterfaceType(name string) string {
 	if strings.HasPrefix(name, "en") {
@@ -323,3 +601,13 @@ func getInterfaceType(name string) string {
 	}
 	return "Other"
 }
+
+// emit passes an event of the instance to the event sinks
+func (m *Manager) emit(typ string, data map[string]string) {
+	event.Emit(event.Event{Type: typ, Instance: m.instanceName(), Data: data})
+}
+
+// interfaces describes the instance's interfaces in event data
+func (m *Manager) interfaces() map[string]string {
+	return map[string]string{"external": m.config.ExternalInterface, "internal": m.config.InternalInterface}
+}
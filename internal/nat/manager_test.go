@@ -1,7 +1,28 @@
 package nat
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/fingerprint"
+	"github.com/scttfrdmn/macos-nat-manager/internal/vmnet"
 )
 
 func TestNewManager(t *testing.T) {
@@ -177,6 +198,10 @@ func TestStartNATWithNilConfig(t *testing.T) {
 	if err.Error() != expectedErr {
 		t.Errorf("Expected error '%s', got '%s'", expectedErr, err.Error())
 	}
+
+	if err := manager.Stop(StopOptions{KeepInterface: true, KeepDHCP: true}); err == nil {
+		t.Error("Stop should fail with nil config")
+	}
 }
 
 func TestStopNATWithNilConfig(t *testing.T) {
@@ -339,3 +364,1747 @@ func TestStatus(t *testing.T) {
 		t.Error("Status BytesOut not set correctly")
 	}
 }
+
+func TestDetectHostConflicts(t *testing.T) {
+	config := &Config{ExternalInterface: "en0", InternalNetwork: "192.168.100"}
+
+	t.Run("clean host", func(t *testing.T) {
+		state := hostNetworkState{
+			routes: "default            192.168.1.1        UGScg                 en0       \n",
+		}
+		conflicts := detectHostConflicts(state, config)
+		if len(conflicts) != 0 {
+			t.Errorf("Expected no conflicts, got %d", len(conflicts))
+		}
+	})
+
+	t.Run("private relay", func(t *testing.T) {
+		state := hostNetworkState{privateRelay: "{\n    PrivacyProxyServiceStatus = 1;\n}\n"}
+		conflicts := detectHostConflicts(state, config)
+		if len(conflicts) != 1 || conflicts[0].Feature != "iCloud Private Relay" {
+			t.Fatalf("Expected Private Relay conflict, got %+v", conflicts)
+		}
+		if len(conflicts[0].Mitigations) == 0 {
+			t.Error("Private Relay conflict should offer mitigations")
+		}
+	})
+
+	t.Run("full tunnel VPN", func(t *testing.T) {
+		state := hostNetworkState{
+			vpnList: "Available network connection services in the current set (*=enabled):\n" +
+				"* (Connected)      6A2B1C3D-0000-0000-0000-000000000000 IPSec              \"Work VPN\"                       [IPSec]\n",
+			routes: "0/1                10.8.0.1           UGScg               utun3       \n" +
+				"default            192.168.1.1        UGScg                 en0       \n",
+		}
+		conflicts := detectHostConflicts(state, config)
+		if len(conflicts) != 1 {
+			t.Fatalf("Expected 1 conflict, got %d", len(conflicts))
+		}
+		if !strings.Contains(conflicts[0].Detail, "Work VPN") || !strings.Contains(conflicts[0].Detail, "utun3") {
+			t.Errorf("Unexpected detail: %s", conflicts[0].Detail)
+		}
+		if !strings.Contains(strings.Join(conflicts[0].Mitigations, "\n"), "192.168.100.0/24") {
+			t.Error("Mitigations should mention the internal subnet")
+		}
+	})
+
+	t.Run("VPN scoped DNS", func(t *testing.T) {
+		state := hostNetworkState{
+			dns: "DNS configuration\n\nresolver #1\n  nameserver[0] : 192.168.1.1\n  if_index : 6 (en0)\n\n" +
+				"resolver #2\n  domain   : corp.example\n  nameserver[0] : 10.8.0.53\n  if_index : 22 (utun3)\n",
+		}
+		conflicts := detectHostConflicts(state, config)
+		if len(conflicts) != 1 || conflicts[0].Feature != "VPN DNS" {
+			t.Fatalf("Expected VPN DNS conflict, got %+v", conflicts)
+		}
+		if !strings.Contains(conflicts[0].Mitigations[0], "10.8.0.53") {
+			t.Errorf("Mitigation should reference the VPN resolver: %s", conflicts[0].Mitigations[0])
+		}
+	})
+
+	t.Run("VM network on the internal subnet", func(t *testing.T) {
+		config := &Config{ExternalInterface: "en0", InternalInterface: "bridge100", InternalNetwork: "10.211.55"}
+		state := hostNetworkState{vmNetworks: []vmnet.HypervisorNetwork{
+			{Bridge: "bridge101", Hypervisor: vmnet.HypervisorParallels, Name: "Shared", Subnet: netip.MustParsePrefix("10.211.55.0/24")},
+			{Bridge: "bridge102", Hypervisor: vmnet.HypervisorFusion, Name: "vmnet8", Subnet: netip.MustParsePrefix("172.16.2.0/24")},
+			// the internal bridge itself, with attached VMs
+			{Bridge: "bridge100", Hypervisor: vmnet.HypervisorUTM, Subnet: netip.MustParsePrefix("10.211.55.0/24")},
+		}}
+		conflicts := detectHostConflicts(state, config)
+		if len(conflicts) != 1 || conflicts[0].Feature != "Parallels network" {
+			t.Fatalf("Expected Parallels network conflict, got %+v", conflicts)
+		}
+		mitigations := strings.Join(conflicts[0].Mitigations, "\n")
+		if !strings.Contains(mitigations, "Parallels Desktop") || !strings.Contains(mitigations, "--attach-vm-network bridge101") {
+			t.Errorf("Mitigations = %s", mitigations)
+		}
+	})
+}
+
+func TestParseLeases(t *testing.T) {
+	input := "1700000000 aa:bb:cc:dd:ee:ff 192.168.100.101 laptop 01:aa:bb:cc:dd:ee:ff\n" +
+		"0 11:22:33:44:55:66 192.168.100.102 * *\n" +
+		"garbage line\n"
+
+	leases, err := ParseLeases(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseLeases failed: %v", err)
+	}
+
+	if len(leases) != 2 {
+		t.Fatalf("Expected 2 leases, got %d", len(leases))
+	}
+	if leases[0].Hostname != "laptop" || leases[0].IP != "192.168.100.101" {
+		t.Errorf("Unexpected first lease: %+v", leases[0])
+	}
+	if leases[0].Expiry.Unix() != 1700000000 {
+		t.Errorf("Expected expiry 1700000000, got %d", leases[0].Expiry.Unix())
+	}
+	if leases[1].Hostname != "" || leases[1].ClientID != "" {
+		t.Errorf("Unknown hostname and client ID should be empty: %+v", leases[1])
+	}
+	if !leases[1].Expiry.IsZero() {
+		t.Error("Infinite lease should have zero expiry")
+	}
+}
+
+func TestGetDNSRecords(t *testing.T) {
+	leaseFile := filepath.Join(t.TempDir(), "dnsmasq.leases")
+	content := "0 aa:bb:cc:dd:ee:ff 192.168.100.101 laptop *\n0 11:22:33:44:55:66 192.168.100.102 * *\n"
+	if err := os.WriteFile(leaseFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write lease file: %v", err)
+	}
+
+	manager := NewManager(&Config{
+		InternalNetwork: "192.168.100",
+		LocalDomain:     "nat.lan",
+		LeaseFile:       leaseFile,
+	})
+
+	records, err := manager.GetDNSRecords()
+	if err != nil {
+		t.Fatalf("GetDNSRecords failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"gateway.nat.lan": "192.168.100.1",
+		"laptop.nat.lan":  "192.168.100.101",
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, got %d", len(expected), len(records))
+	}
+	for _, record := range records {
+		if expected[record.Name] != record.Value {
+			t.Errorf("Unexpected record %s -> %s", record.Name, record.Value)
+		}
+	}
+
+	status, _ := manager.GetStatus()
+	if len(status.ConnectedDevices) != 2 {
+		t.Errorf("Expected 2 connected devices from leases, got %d", len(status.ConnectedDevices))
+	}
+
+	// Disabled zone publishes nothing
+	disabled := NewManager(&Config{InternalNetwork: "192.168.100", LeaseFile: leaseFile})
+	records, _ = disabled.GetDNSRecords()
+	if len(records) != 0 {
+		t.Errorf("Expected no records without a local domain, got %d", len(records))
+	}
+}
+
+func TestConnectedDeviceTypes(t *testing.T) {
+	dir := t.TempDir()
+	leaseFile := filepath.Join(dir, "dnsmasq.leases")
+	content := "0 aa:bb:cc:dd:ee:ff 192.168.100.101 desktop *\n0 b8:27:eb:00:00:01 192.168.100.102 pi *\n0 00:11:22:33:44:55 192.168.100.103 * *\n"
+	if err := os.WriteFile(leaseFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write lease file: %v", err)
+	}
+	fingerprintFile := filepath.Join(dir, "fingerprints.json")
+	if err := fingerprint.Record(fingerprintFile, fingerprint.Observation{MAC: "AA:BB:CC:DD:EE:FF", VendorClass: "MSFT 5.0"}); err != nil {
+		t.Fatalf("Failed to record fingerprint: %v", err)
+	}
+
+	manager := NewManager(&Config{InternalNetwork: "192.168.100", LeaseFile: leaseFile, FingerprintFile: fingerprintFile})
+	expected := []string{"Windows PC", "Raspberry Pi", ""}
+	devices := manager.connectedDevices()
+	if len(devices) != len(expected) {
+		t.Fatalf("Expected %d devices, got %d", len(expected), len(devices))
+	}
+	for i, device := range devices {
+		if device.Type != expected[i] {
+			t.Errorf("%s: expected type %q, got %q", device.IP, expected[i], device.Type)
+		}
+	}
+}
+
+func TestDHCPEventScript(t *testing.T) {
+	script := dhcpEventScript("/Applications/NAT Manager's/nat-manager")
+	expected := "#!/bin/sh\nexec '/Applications/NAT Manager'\\''s/nat-manager' dhcp-event \"$@\"\n"
+	if script != expected {
+		t.Errorf("dhcpEventScript = %q, expected %q", script, expected)
+	}
+
+	pidFile := filepath.Join(t.TempDir(), "dnsmasq.pid")
+	manager := NewManager(&Config{PIDFile: pidFile, Executable: "/usr/local/bin/nat-manager"})
+	path, err := manager.writeDHCPEventScript()
+	if err != nil || filepath.Dir(path) != filepath.Dir(pidFile) {
+		t.Fatalf("writeDHCPEventScript = %q, %v", path, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Event script should be executable: %v", err)
+	}
+
+	disabled := NewManager(&Config{PIDFile: pidFile})
+	if path, _ := disabled.writeDHCPEventScript(); path != "" {
+		t.Errorf("No script expected without an event command, got %q", path)
+	}
+}
+
+func TestValidatePortForwards(t *testing.T) {
+	valid := []PortForward{
+		{Protocol: "tcp", ExternalPort: 8080, InternalIP: "192.168.100.50", InternalPort: 80},
+		{Protocol: "udp", ExternalPort: 8080, InternalIP: "192.168.100.51", InternalPort: 8080},
+	}
+	if err := ValidatePortForwards(valid, "192.168.100"); err != nil {
+		t.Errorf("Valid forwards rejected: %v", err)
+	}
+
+	invalid := []PortForward{
+		{Protocol: "icmp", ExternalPort: 1, InternalIP: "192.168.100.50", InternalPort: 1},
+		{Protocol: "tcp", ExternalPort: 70000, InternalIP: "192.168.100.50", InternalPort: 80},
+		{Protocol: "tcp", ExternalPort: 22, InternalIP: "10.0.0.5", InternalPort: 22},
+		{Protocol: "tcp", ExternalPort: 443, InternalIP: "192.168.100.50", InternalPort: 443},
+		{Protocol: "tcp/udp", ExternalPort: 443, InternalIP: "192.168.100.52", InternalPort: 443},
+	}
+	err := ValidatePortForwards(invalid, "192.168.100")
+	if err == nil {
+		t.Fatal("Invalid forwards accepted")
+	}
+	// Every problem in the batch should be reported
+	for _, want := range []string{"protocol", "external port", "must be in", "already forwarded"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error mentioning %q, got: %v", want, err)
+		}
+	}
+}
+
+func TestValidateDevice(t *testing.T) {
+	for _, device := range []string{"aa:bb:cc:dd:ee:ff", "192.168.100.50"} {
+		if err := ValidateDevice(device); err != nil {
+			t.Errorf("ValidateDevice(%s) = %v", device, err)
+		}
+	}
+	for _, device := range []string{"laptop", "192.168.100", "aa:bb; block all"} {
+		if err := ValidateDevice(device); err == nil {
+			t.Errorf("ValidateDevice(%s) should fail", device)
+		}
+	}
+}
+
+func TestGenerateRules(t *testing.T) {
+	cfg := &Config{
+		ExternalInterface: "en0",
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+		PortForwards: []PortForward{
+			{Protocol: "tcp/udp", ExternalPort: 53, InternalIP: "192.168.100.10", InternalPort: 5353},
+		},
+		BlockedDevices: []string{"AA:BB:CC:DD:EE:FF", "192.168.100.99"},
+	}
+	leases := []Lease{{MAC: "aa:bb:cc:dd:ee:ff", IP: "192.168.100.42"}}
+
+	rules := GenerateRules(cfg, leases)
+	expected := []string{
+		"table <nat_manager_blocked> { 192.168.100.42 192.168.100.99 }",
+		"nat on en0 from 192.168.100.0/24 to any -> (en0)",
+		"rdr on en0 proto tcp from any to (en0) port 53 -> 192.168.100.10 port 5353",
+		"rdr on en0 proto udp from any to (en0) port 53 -> 192.168.100.10 port 5353",
+		"block drop quick on bridge100 from <nat_manager_blocked> to any",
+	}
+	for _, line := range expected {
+		if !strings.Contains(rules, line+"\n") {
+			t.Errorf("Expected rule %q in:\n%s", line, rules)
+		}
+	}
+
+	// Translation rules must precede filter rules
+	if strings.Index(rules, "rdr on") > strings.Index(rules, "block drop") {
+		t.Error("rdr rules must come before block rules")
+	}
+
+	cfg.BlockedDevices = nil
+	if strings.Contains(GenerateRules(cfg, leases), "block") {
+		t.Error("No block rules expected without blocked devices")
+	}
+}
+
+func TestValidateInterfaces(t *testing.T) {
+	manager := NewManager(&Config{ExternalInterface: "en0", InternalInterface: "bridge100", InternalNetwork: "192.168.100"})
+	if err := manager.validateInterfaces(); err != nil {
+		t.Errorf("Valid interfaces rejected: %v", err)
+	}
+
+	for _, cfg := range []*Config{
+		{ExternalInterface: "en0\nblock all", InternalInterface: "bridge100", InternalNetwork: "192.168.100"},
+		{ExternalInterface: "en0", InternalInterface: "bridge100", InternalNetwork: "192.168.100.0/24"},
+		{ExternalInterface: "", InternalInterface: "bridge100", InternalNetwork: "192.168.100"},
+	} {
+		if err := NewManager(cfg).validateInterfaces(); err == nil {
+			t.Errorf("Invalid config accepted: %+v", cfg)
+		}
+	}
+}
+
+func TestDnsmasqDomainServers(t *testing.T) {
+	args := dnsmasqDomainServers(map[string][]string{
+		"corp.example": {"10.8.0.1", "10.8.0.2:5353", "tls://dns.corp.example"},
+		"a.example":    {"10.9.0.1"},
+	})
+
+	expected := []string{
+		"--server=/a.example/10.9.0.1#53",
+		"--server=/corp.example/10.8.0.1#53",
+		"--server=/corp.example/10.8.0.2#5353",
+	}
+	if strings.Join(args, " ") != strings.Join(expected, " ") {
+		t.Errorf("dnsmasqDomainServers = %v, expected %v", args, expected)
+	}
+}
+
+func TestDnsmasqStaticRecords(t *testing.T) {
+	args := dnsmasqStaticRecords([]DNSRecord{
+		{Name: "registry.lab", Type: "A", Value: "192.168.100.10"},
+		{Name: "registry.lab", Type: "AAAA", Value: "fd00::10"},
+		{Name: "docker.lab", Type: "CNAME", Value: "registry.lab"},
+	})
+
+	expected := "--host-record=registry.lab,192.168.100.10 --host-record=registry.lab,fd00::10 --cname=docker.lab,registry.lab"
+	if strings.Join(args, " ") != expected {
+		t.Errorf("dnsmasqStaticRecords = %v", args)
+	}
+}
+
+func TestDnsmasqDHCPArgs(t *testing.T) {
+	cfg := &Config{
+		InternalNetwork: "192.168.100",
+		DHCPRange: DHCPRange{
+			Start:   "192.168.100.100",
+			End:     "192.168.100.200",
+			Lease:   "12h",
+			Exclude: []string{"192.168.100.150-192.168.100.159", "192.168.100.200", "120"},
+		},
+		DeviceLeases: []DeviceLease{
+			{MAC: "52:54:00:AA:BB:CC", Lease: "infinite"},
+			{MAC: "02:00:00:00:00:01", Lease: "10m"},
+			{MAC: "02:00:00:00:00:02", IP: "192.168.100.20"},
+		},
+	}
+
+	args, err := dnsmasqDHCPArgs(cfg)
+	if err != nil {
+		t.Fatalf("dnsmasqDHCPArgs failed: %v", err)
+	}
+
+	expected := "--dhcp-range=192.168.100.100,192.168.100.119,12h" +
+		" --dhcp-range=192.168.100.121,192.168.100.149,12h" +
+		" --dhcp-range=192.168.100.160,192.168.100.199,12h" +
+		" --dhcp-host=52:54:00:aa:bb:cc,infinite --dhcp-host=02:00:00:00:00:01,10m" +
+		" --dhcp-host=02:00:00:00:00:02,192.168.100.20"
+	if strings.Join(args, " ") != expected {
+		t.Errorf("dnsmasqDHCPArgs = %v", args)
+	}
+}
+
+func TestDHCPOptions(t *testing.T) {
+	cfg := &Config{
+		InternalNetwork: "192.168.100",
+		DHCPRange:       DHCPRange{Start: "100", End: "200"},
+		SearchDomains:   []string{"lab.example.com", "example.com"},
+		NTPServers:      []string{"192.168.100.1", "162.159.200.1"},
+	}
+	args, err := dnsmasqDHCPArgs(cfg)
+	if err != nil {
+		t.Fatalf("dnsmasqDHCPArgs failed: %v", err)
+	}
+	for _, expected := range []string{
+		"--dhcp-option=option:domain-search,lab.example.com,example.com",
+		"--dhcp-option=option:ntp-server,192.168.100.1,162.159.200.1",
+	} {
+		if !slices.Contains(args, expected) {
+			t.Errorf("Expected %s in %v", expected, args)
+		}
+	}
+
+	conf, err := renderKeaConf(cfg)
+	if err != nil || !strings.Contains(conf, `"data": "lab.example.com, example.com"`) || !strings.Contains(conf, `"name": "ntp-servers"`) {
+		t.Errorf("kea config missing DHCP options (%v):\n%s", err, conf)
+	}
+
+	if err := ValidateDHCPOptions(cfg.SearchDomains, cfg.NTPServers); err != nil {
+		t.Errorf("ValidateDHCPOptions failed: %v", err)
+	}
+	if err := ValidateDHCPOptions([]string{"bad domain"}, nil); err == nil {
+		t.Error("Invalid search domain should be rejected")
+	}
+	if err := ValidateDHCPOptions(nil, []string{"time.apple.com"}); err == nil {
+		t.Error("NTP servers given by name should be rejected")
+	}
+}
+
+func TestValidateDHCP(t *testing.T) {
+	pool := DHCPRange{Start: "192.168.100.100", End: "192.168.100.200", Lease: "12h"}
+
+	testCases := []struct {
+		name    string
+		exclude []string
+		leases  []DeviceLease
+		valid   bool
+	}{
+		{"plain pool", nil, nil, true},
+		{"exclusion inside pool", []string{"192.168.100.110-192.168.100.119"}, nil, true},
+		{"exclusion outside pool", []string{"192.168.100.50"}, nil, false},
+		{"exclusion in other network", []string{"10.0.0.150"}, nil, false},
+		{"reversed exclusion", []string{"192.168.100.119-192.168.100.110"}, nil, false},
+		{"everything excluded", []string{"192.168.100.100-192.168.100.200"}, nil, false},
+		{"device lease", nil, []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff", Lease: "7d"}}, true},
+		{"device lease by IP", nil, []DeviceLease{{MAC: "192.168.100.10", Lease: "7d"}}, false},
+		{"invalid lease time", nil, []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff", Lease: "a week"}}, false},
+		{"reservation", nil, []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff", IP: "192.168.100.20"}}, true},
+		{"reservation with lease", nil, []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff", IP: "192.168.100.20", Lease: "infinite"}}, true},
+		{"reservation outside network", nil, []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff", IP: "10.0.0.20"}}, false},
+		{"gateway reserved", nil, []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff", IP: "192.168.100.1"}}, false},
+		{"address reserved twice", nil, []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff", IP: "192.168.100.20"}, {MAC: "aa:bb:cc:dd:ee:00", IP: "192.168.100.20"}}, false},
+		{"empty override", nil, []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff"}}, false},
+	}
+
+	for _, tc := range testCases {
+		r := pool
+		r.Exclude = tc.exclude
+		err := ValidateDHCP(r, tc.leases, "192.168.100")
+		if (err == nil) != tc.valid {
+			t.Errorf("%s: ValidateDHCP() = %v, expected valid=%v", tc.name, err, tc.valid)
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	testCases := []struct {
+		rate     string
+		expected int
+		valid    bool
+	}{
+		{"100Mbit/s", 100000, true},
+		{"512Kbit/s", 512, true},
+		{"1G", 1000000, true},
+		{"2.5mbps", 2500, true},
+		{"100", 0, false},
+		{"fast", 0, false},
+		{"0Mbit/s", 0, false},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseRate(tc.rate)
+		if (err == nil) != tc.valid || got != tc.expected {
+			t.Errorf("ParseRate(%q) = %d, %v; expected %d, valid=%v", tc.rate, got, err, tc.expected, tc.valid)
+		}
+	}
+}
+
+func TestValidateShaping(t *testing.T) {
+	shaping := Shaping{
+		Uplink:   "20Mbit/s",
+		Downlink: "100Mbit/s",
+		Groups: []DeviceGroup{
+			{Name: "lab", Devices: []string{"aa:bb:cc:dd:ee:ff"}, Guarantee: "10Mbit/s"},
+			{Name: "voip", Devices: []string{"192.168.100.30"}, Guarantee: "2Mbit/s"},
+		},
+	}
+	if err := ValidateShaping(shaping); err != nil {
+		t.Errorf("Valid shaping rejected: %v", err)
+	}
+
+	shaping.Groups = append(shaping.Groups,
+		DeviceGroup{Name: "Bulk Transfer", Devices: []string{"not-a-device"}, Guarantee: "10Mbit/s"})
+	err := ValidateShaping(shaping)
+	if err == nil {
+		t.Fatal("Invalid shaping accepted")
+	}
+	for _, want := range []string{"invalid group name", "not a MAC", "exceed the uplink"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in error: %v", want, err)
+		}
+	}
+
+	shaping.Groups = []DeviceGroup{
+		{Name: "lab-a", Devices: []string{"192.168.100.20"}, Guarantee: "1Mbit/s"},
+		{Name: "lab_a", Devices: []string{"192.168.100.21"}, Guarantee: "1Mbit/s"},
+	}
+	shaping.Caps = []DeviceCap{
+		{Name: "kids-tv", Devices: []string{"192.168.100.40"}, Rate: "5Mbit/s"},
+		{Name: "kids_tv", Devices: []string{"192.168.100.41"}, Rate: "5Mbit/s"},
+	}
+	err = ValidateShaping(shaping)
+	for _, want := range []string{`groups "lab-a" and "lab_a" would share`, `caps "kids-tv" and "kids_tv" would share`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in error: %v", want, err)
+		}
+	}
+}
+
+func TestQueueWeights(t *testing.T) {
+	testCases := []struct {
+		guarantees []string
+		expected   []int
+	}{
+		{[]string{"10Mbit/s"}, []int{50, 50}},
+		{[]string{"19Mbit/s", "100Kbit/s", "100Kbit/s", "100Kbit/s"}, []int{95, 1, 1, 1, 2}},
+		{[]string{"10Mbit/s", "10Mbit/s"}, []int{49, 50, 1}},
+		{[]string{"19700Kbit/s", "100Kbit/s", "100Kbit/s", "100Kbit/s"}, []int{96, 1, 1, 1, 1}},
+	}
+	for _, tc := range testCases {
+		var groups []DeviceGroup
+		for _, guarantee := range tc.guarantees {
+			groups = append(groups, DeviceGroup{Guarantee: guarantee})
+		}
+		weights := queueWeights(groups, 20000)
+		total := 0
+		for _, weight := range weights {
+			total += weight
+		}
+		if fmt.Sprint(weights) != fmt.Sprint(tc.expected) || total > 100 {
+			t.Errorf("queueWeights(%v) = %v, expected %v", tc.guarantees, weights, tc.expected)
+		}
+	}
+}
+
+func TestDummynetCommands(t *testing.T) {
+	shaping := Shaping{
+		Uplink:   "20Mbit/s",
+		Downlink: "100Mbit/s",
+		Groups:   []DeviceGroup{{Name: "lab", Devices: []string{"192.168.100.20"}, Guarantee: "10Mbit/s"}},
+	}
+
+	var got []string
+	for _, args := range dummynetCommands(shaping) {
+		got = append(got, strings.Join(args, " "))
+	}
+	expected := []string{
+		"pipe 1000 config bw 20000Kbit/s",
+		"pipe 1001 config bw 100000Kbit/s",
+		"queue 1100 config pipe 1000 weight 50",
+		"queue 1101 config pipe 1000 weight 50",
+		"queue 1200 config pipe 1001 weight 10",
+		"queue 1201 config pipe 1001 weight 90",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("dummynetCommands =\n%s\nexpected\n%s", strings.Join(got, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestGenerateShapingRules(t *testing.T) {
+	cfg := &Config{
+		ExternalInterface: "en0",
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+		BlockedDevices:    []string{"192.168.100.99"},
+		Shaping: Shaping{
+			Uplink:   "20Mbit/s",
+			Downlink: "100Mbit/s",
+			Groups:   []DeviceGroup{{Name: "lab-gear", Devices: []string{"AA:BB:CC:DD:EE:FF"}, Guarantee: "5Mbit/s"}},
+		},
+	}
+	leases := []Lease{{MAC: "aa:bb:cc:dd:ee:ff", IP: "192.168.100.42"}}
+
+	rules := GenerateRules(cfg, leases)
+	expected := []string{
+		"table <nat_manager_group_lab_gear> { 192.168.100.42 }",
+		"dummynet in on bridge100 from 192.168.100.0/24 to ! 192.168.100.0/24 queue 1101",
+		"dummynet in on bridge100 from <nat_manager_group_lab_gear> to ! 192.168.100.0/24 queue 1100",
+		"dummynet out on bridge100 from ! 192.168.100.0/24 to <nat_manager_group_lab_gear> queue 1200",
+	}
+	for _, line := range expected {
+		if !strings.Contains(rules, line+"\n") {
+			t.Errorf("Expected rule %q in:\n%s", line, rules)
+		}
+	}
+
+	// Group rules must follow the default rule to win, and filter rules
+	// come last
+	if strings.Index(rules, "queue 1101") > strings.Index(rules, "queue 1100") ||
+		strings.Index(rules, "dummynet") > strings.Index(rules, "block drop") {
+		t.Errorf("Unexpected rule order:\n%s", rules)
+	}
+
+	if !strings.Contains(mainRuleset(DefaultAnchor), "dummynet-anchor \"nat-manager/*\"") {
+		t.Error("Main ruleset must hook the dummynet anchors")
+	}
+}
+
+func TestRegistryClaim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.yaml")
+	registry, err := LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+	alive := func(res Resources) bool { return res.Instance != "stale" }
+
+	lab := Resources{Instance: "lab", Anchor: "nat-manager/lab", InternalInterface: "bridge100", InternalNetwork: "192.168.100"}
+	if _, err := registry.Claim(lab, alive); err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	registry.Instances["stale"] = Resources{Instance: "stale", Anchor: "nat-manager/stale", InternalInterface: "bridge102", DummynetSlot: 1}
+	if err := registry.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	registry, err = LoadRegistry(path)
+	if err != nil {
+		t.Fatalf("LoadRegistry failed: %v", err)
+	}
+
+	testCases := []struct {
+		res      Resources
+		conflict string
+	}{
+		{lab, `instance "lab" is already running`},
+		{Resources{Instance: "ci", Anchor: "nat-manager/ci", InternalInterface: "bridge100", InternalNetwork: "192.168.101"}, "interface bridge100"},
+		{Resources{Instance: "ci", Anchor: "nat-manager/ci", InternalInterface: "bridge101", InternalNetwork: "192.168.100"}, "network 192.168.100.0/24"},
+	}
+	for _, tc := range testCases {
+		if _, err := registry.Claim(tc.res, alive); err == nil || !strings.Contains(err.Error(), tc.conflict) || !errors.Is(err, ErrConflict) {
+			t.Errorf("Claim(%s) error = %v, expected %q", tc.res.Instance, err, tc.conflict)
+		}
+	}
+
+	// The stale instance is dropped and its dummynet slot reused
+	ci, err := registry.Claim(Resources{Instance: "ci", Anchor: "nat-manager/ci", InternalInterface: "bridge101", InternalNetwork: "192.168.101"}, alive)
+	if err != nil {
+		t.Fatalf("Claim failed: %v", err)
+	}
+	if _, ok := registry.Instances["stale"]; ok {
+		t.Error("Stale instance should be removed")
+	}
+	if first, _ := ci.DummynetPipes(); ci.DummynetSlot != 1 || first != 2000 {
+		t.Errorf("Expected dummynet slot 1 (2000), got %d (%d)", ci.DummynetSlot, first)
+	}
+	if names := registry.List(); len(names) != 2 || names[0].Instance != "ci" {
+		t.Errorf("Unexpected instances: %+v", names)
+	}
+}
+
+func TestInstanceAnchor(t *testing.T) {
+	if got := NewManager(&Config{}).anchorName(); got != "nat-manager/default" {
+		t.Errorf("Default anchor = %s", got)
+	}
+	if got := NewManager(&Config{Instance: "lab"}).anchorName(); got != "nat-manager/lab" {
+		t.Errorf("Instance anchor = %s", got)
+	}
+
+	for _, name := range []string{"lab", "ci-2", "vm_net"} {
+		if err := ValidateInstanceName(name); err != nil {
+			t.Errorf("ValidateInstanceName(%q) failed: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "Lab", "../etc", "a b", "-lab"} {
+		if err := ValidateInstanceName(name); err == nil {
+			t.Errorf("ValidateInstanceName(%q) should fail", name)
+		}
+	}
+}
+
+func TestDnsmasqConf(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "dnsmasq.pid")
+	manager := NewManager(&Config{
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+		DHCPRange:         DHCPRange{Start: "100", End: "200", Lease: "12h"},
+		DNSServers:        []string{"1.1.1.1"},
+		PIDFile:           pidFile,
+	})
+
+	if err := manager.writeServerConf(dnsmasqServer{}, "/tmp/dhcp-event.sh"); err != nil {
+		t.Fatalf("writeServerConf failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(pidFile), "dnsmasq.conf"))
+	if err != nil {
+		t.Fatalf("dnsmasq.conf not written: %v", err)
+	}
+	conf := string(data)
+	for _, line := range []string{
+		"keep-in-foreground\n",
+		"log-facility=-\n",
+		"pid-file=" + filepath.Join(filepath.Dir(pidFile), "dnsmasq-server.pid") + "\n",
+		"interface=bridge100\n",
+		"dhcp-range=192.168.100.100,192.168.100.200,12h\n",
+		"server=1.1.1.1\n",
+		"dhcp-script=/tmp/dhcp-event.sh\n",
+	} {
+		if !strings.Contains(conf, line) {
+			t.Errorf("dnsmasq.conf missing %q:\n%s", line, conf)
+		}
+	}
+	if strings.Contains(conf, "--") || strings.Contains(conf, "no-daemon") {
+		t.Errorf("dnsmasq.conf should hold bare options:\n%s", conf)
+	}
+}
+
+func TestSuperviseDHCP(t *testing.T) {
+	dir := t.TempDir()
+	fake := filepath.Join(dir, "dnsmasq")
+	script := "#!/bin/sh\necho \"dnsmasq: failed to create listening socket: Address already in use\" >&2\nexit 2\n"
+	if err := os.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	binary, delay, maxDelay := dnsmasqBinary, restartDelay, restartMaxDelay
+	dnsmasqBinary, restartDelay, restartMaxDelay = fake, time.Millisecond, 5*time.Millisecond
+	defer func() { dnsmasqBinary, restartDelay, restartMaxDelay = binary, delay, maxDelay }()
+
+	manager := NewManager(&Config{PIDFile: filepath.Join(dir, "dnsmasq.pid")})
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := manager.SuperviseDHCP(ctx); err != nil {
+		t.Fatalf("SuperviseDHCP failed: %v", err)
+	}
+
+	health, err := manager.DHCPHealth()
+	if err != nil {
+		t.Fatalf("DHCPHealth failed: %v", err)
+	}
+	if health.Restarts < 2 || health.PID != 0 {
+		t.Errorf("Expected repeated restarts and no running pid, got %+v", health)
+	}
+	if !strings.Contains(health.LastError, "Address already in use") || !strings.Contains(health.LastError, "exit status 2") {
+		t.Errorf("Unexpected last error %q", health.LastError)
+	}
+
+	log, err := os.ReadFile(health.Log)
+	if err != nil || !strings.Contains(string(log), "restarting in") {
+		t.Errorf("dnsmasq output not captured: %q, %v", log, err)
+	}
+}
+
+func TestLockdownRules(t *testing.T) {
+	cfg := &Config{
+		ExternalInterface: "en0",
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+		BlockedDevices:    []string{"192.168.100.99"},
+		Lockdown: Lockdown{
+			Enabled: true,
+			Allow:   []string{"exam.school.edu", "10.20.0.0/16", "203.0.113.5"},
+		},
+	}
+
+	rules := GenerateRules(cfg, nil)
+	expected := []string{
+		"table <nat_manager_allowed> persist { 10.20.0.0/16 203.0.113.5 }",
+		"pass in quick on bridge100 from 192.168.100.0/24 to 192.168.100.1",
+		"pass in quick on bridge100 proto udp from any port 68 to any port 67",
+		"pass in quick on bridge100 from 192.168.100.0/24 to <nat_manager_allowed>",
+		"block drop in quick on bridge100 from 192.168.100.0/24 to any",
+	}
+	for _, line := range expected {
+		if !strings.Contains(rules, line+"\n") {
+			t.Errorf("Expected rule %q in:\n%s", line, rules)
+		}
+	}
+	if strings.Contains(rules, "exam.school.edu") {
+		t.Error("Domains are resolved at runtime, not rendered into the ruleset")
+	}
+	// Blocked devices stay blocked even when they reach allowed destinations
+	if strings.Index(rules, "from <nat_manager_blocked>") > strings.Index(rules, "to <nat_manager_allowed>") {
+		t.Error("Blocked device rules must come before lockdown rules")
+	}
+
+	cfg.Lockdown.Allow = []string{"exam.school.edu"}
+	if !strings.Contains(GenerateRules(cfg, nil), "table <nat_manager_allowed> persist\n") {
+		t.Error("Allowed table should persist while empty")
+	}
+	cfg.Lockdown.Enabled = false
+	if strings.Contains(GenerateRules(cfg, nil), allowedTable) {
+		t.Error("No lockdown rules expected while disabled")
+	}
+}
+
+func TestLockdownDestinations(t *testing.T) {
+	for _, dest := range []string{"203.0.113.5", "10.20.0.0/16", "exam.school.edu", "Example.COM."} {
+		if err := ValidateDestination(dest); err != nil {
+			t.Errorf("ValidateDestination(%s) failed: %v", dest, err)
+		}
+	}
+	for _, dest := range []string{"localhost", "2001:db8::1", "example.com; pass all", "*.example.com", "10.0.0.0/33"} {
+		if err := ValidateDestination(dest); err == nil {
+			t.Errorf("ValidateDestination(%s) should fail", dest)
+		}
+	}
+
+	lockdown := Lockdown{Enabled: true, Allow: []string{"school.edu", "10.20.0.0/16"}}
+	for name, allowed := range map[string]bool{
+		"school.edu":       true,
+		"Exam.School.edu.": true,
+		"evilschool.edu":   false,
+		"school.edu.evil":  false,
+	} {
+		if lockdown.AllowsName(name) != allowed {
+			t.Errorf("AllowsName(%s) = %v, expected %v", name, !allowed, allowed)
+		}
+	}
+
+	manager := NewManager(&Config{Lockdown: lockdown})
+	if err := manager.AllowResolved("example.com", []net.IP{net.ParseIP("203.0.113.9")}); err != nil {
+		t.Errorf("Names outside the allowlist should be ignored: %v", err)
+	}
+}
+
+func TestWireGuardRules(t *testing.T) {
+	cfg := &Config{
+		ExternalInterface: "en0",
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+		WireGuard:         WireGuard{Enabled: true, Network: "10.8.0", Port: 51820},
+	}
+
+	rules := GenerateRules(cfg, nil)
+	expected := []string{
+		"nat on en0 from 10.8.0.0/24 to any -> (en0)",
+		"pass in quick on en0 proto udp from any to (en0) port 51820",
+	}
+	for _, line := range expected {
+		if !strings.Contains(rules, line+"\n") {
+			t.Errorf("Expected rule %q in:\n%s", line, rules)
+		}
+	}
+	// pf requires translation rules before filter rules
+	if strings.Index(rules, "nat on en0 from 10.8.0.0/24") > strings.Index(rules, "pass in quick on en0") {
+		t.Error("WireGuard NAT must come before the filter rules")
+	}
+
+	if err := ValidateWireGuard(cfg.WireGuard, cfg.InternalNetwork); err != nil {
+		t.Errorf("ValidateWireGuard failed: %v", err)
+	}
+	for _, w := range []WireGuard{
+		{Network: "192.168.100", Port: 51820},
+		{Network: "10.8", Port: 51820},
+		{Network: "10.8.0", Port: 0},
+	} {
+		if err := ValidateWireGuard(w, cfg.InternalNetwork); err == nil {
+			t.Errorf("ValidateWireGuard(%+v) should fail", w)
+		}
+	}
+
+	cfg.WireGuard.Enabled = false
+	if strings.Contains(GenerateRules(cfg, nil), "10.8.0") {
+		t.Error("No WireGuard rules expected while disabled")
+	}
+}
+
+func TestDHCPHealthEvents(t *testing.T) {
+	health := ServerHealth{Server: BackendDnsmasq}
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < maxHealthEvents+5; i++ {
+		health.recordExit(start.Add(time.Duration(i)*time.Minute), fmt.Sprintf("exit %d", i))
+	}
+	if len(health.Events) != maxHealthEvents || health.Events[0].Error != "exit 5" {
+		t.Errorf("Expected the %d most recent events, got %+v", maxHealthEvents, health.Events)
+	}
+	if health.LastError != fmt.Sprintf("exit %d", maxHealthEvents+4) || health.PID != 0 {
+		t.Errorf("Unexpected health %+v", health)
+	}
+
+	// A restarted supervisor continues the record
+	dir := t.TempDir()
+	manager := NewManager(&Config{PIDFile: filepath.Join(dir, "dnsmasq.pid"), Executable: "/usr/local/bin/nat-manager"})
+	health.Restarts = 4
+	manager.writeHealth(health)
+	saved, err := manager.DHCPHealth()
+	if err != nil || saved.Restarts != 4 || len(saved.Events) != maxHealthEvents {
+		t.Errorf("DHCPHealth = %+v, %v", saved, err)
+	}
+
+	// Without a recorded supervisor there is nothing to restart
+	if restarted, err := manager.CheckDHCP(); restarted || err != nil {
+		t.Errorf("CheckDHCP = %v, %v; expected no restart", restarted, err)
+	}
+}
+
+func TestPortalRules(t *testing.T) {
+	cfg := &Config{
+		ExternalInterface: "en0",
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+		Portal:            Portal{Enabled: true, Port: 8880, Admitted: []string{"192.168.100.51", "192.168.100.50", "bogus"}},
+		Lockdown:          Lockdown{Enabled: true, Allow: []string{"10.20.0.0/16"}},
+	}
+
+	rules := GenerateRules(cfg, nil)
+	expected := []string{
+		"table <nat_manager_portal> persist { 192.168.100.50 192.168.100.51 }",
+		"no rdr on bridge100 from <nat_manager_portal> to any",
+		"rdr on bridge100 proto tcp from 192.168.100.0/24 to ! 192.168.100.1 port 80 -> 192.168.100.1 port 8880",
+		"rdr on bridge100 proto udp from 192.168.100.0/24 to ! 192.168.100.1 port 53 -> 192.168.100.1 port 53",
+		"block drop in quick on bridge100 from ! <nat_manager_portal> to any",
+	}
+	for _, line := range expected {
+		if !strings.Contains(rules, line+"\n") {
+			t.Errorf("Expected rule %q in:\n%s", line, rules)
+		}
+	}
+	if strings.Count(rules, "port 68 to any port 67") != 1 {
+		t.Errorf("Gateway rules should be rendered once:\n%s", rules)
+	}
+	// Admitted devices still only reach the lockdown allowlist
+	if strings.Index(rules, "from ! <nat_manager_portal>") > strings.Index(rules, "to <nat_manager_allowed>") {
+		t.Error("Portal rules must come before lockdown rules")
+	}
+	if strings.Index(rules, "no rdr") > strings.Index(rules, "port 80 ->") {
+		t.Error("Admitted devices must be exempted before the portal redirect")
+	}
+
+	manager := NewManager(cfg)
+	if err := manager.AdmitClient("portal.lan"); err == nil {
+		t.Error("AdmitClient should reject non-IPv4 addresses")
+	}
+}
+
+func TestApplyClassPolicies(t *testing.T) {
+	cfg := &Config{
+		ExternalInterface: "en0",
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+		Shaping: Shaping{
+			Uplink:   "20Mbit/s",
+			Downlink: "100Mbit/s",
+			Groups:   []DeviceGroup{{Name: "iot", Guarantee: "2Mbit/s"}},
+		},
+		ClassPolicies: []ClassPolicy{
+			{Class: "printer", Isolate: true, Group: "iot"},
+			{Class: "Camera", Cap: "2Mbit/s"},
+		},
+	}
+	leases := []Lease{
+		{MAC: "00:80:77:12:34:56", IP: "192.168.100.30"},
+		{MAC: "44:19:b6:01:02:03", IP: "192.168.100.31"},
+		{MAC: "aa:bb:cc:dd:ee:ff", IP: "192.168.100.32", Hostname: "laptop"},
+	}
+
+	effective := ApplyClassPolicies(cfg, leases, nil)
+	if len(cfg.IsolatedDevices) != 0 || len(cfg.Shaping.Groups[0].Devices) != 0 {
+		t.Error("ApplyClassPolicies must not change the configuration")
+	}
+	if len(effective.IsolatedDevices) != 1 || effective.IsolatedDevices[0] != "00:80:77:12:34:56" {
+		t.Errorf("IsolatedDevices = %v, expected the printer", effective.IsolatedDevices)
+	}
+	if devices := effective.Shaping.Groups[0].Devices; len(devices) != 1 || devices[0] != "00:80:77:12:34:56" {
+		t.Errorf("iot group = %v, expected the printer", devices)
+	}
+
+	rules := GenerateRules(effective, leases)
+	expected := []string{
+		"table <nat_manager_isolated> { 192.168.100.30 }",
+		"table <nat_manager_cap_class_camera> { 192.168.100.31 }",
+		"block drop in quick on bridge100 from <nat_manager_isolated> to ! 192.168.100.0/24",
+		"dummynet in on bridge100 from <nat_manager_cap_class_camera> to ! 192.168.100.0/24 pipe 1300",
+		"dummynet out on bridge100 from ! 192.168.100.0/24 to <nat_manager_cap_class_camera> pipe 1301",
+	}
+	for _, line := range expected {
+		if !strings.Contains(rules, line+"\n") {
+			t.Errorf("Expected rule %q in:\n%s", line, rules)
+		}
+	}
+
+	if err := ValidateClassPolicies(cfg.ClassPolicies, cfg.Shaping.Groups); err != nil {
+		t.Errorf("ValidateClassPolicies() = %v", err)
+	}
+	invalid := []ClassPolicy{{Class: "Camera", Group: "missing"}, {Class: "camera", Cap: "fast"}, {}}
+	if err := ValidateClassPolicies(invalid, cfg.Shaping.Groups); err == nil {
+		t.Error("Expected invalid class policies to be rejected")
+	}
+}
+
+func TestCommandDuration(t *testing.T) {
+	before := commandDuration.Count("true")
+	if err := runCmd(exec.Command("true")); err != nil {
+		t.Skipf("true not available: %v", err)
+	}
+	if got := commandDuration.Count("true"); got != before+1 {
+		t.Errorf("Count(true) = %d, expected %d", got, before+1)
+	}
+}
+
+func TestBackendServers(t *testing.T) {
+	testCases := []struct {
+		dhcp, dns string
+		embedded  bool
+		expected  string
+	}{
+		{"", "", false, "dnsmasq"},
+		{"", "", true, "dnsmasq,forwarder"},
+		{BackendKea, "", false, "kea,dnsmasq"},
+		{BackendKea, "", true, "kea,forwarder"},
+		{"", BackendCoreDNS, false, "dnsmasq,coredns"},
+		{BackendKea, BackendCoreDNS, false, "kea,coredns"},
+	}
+	for _, tc := range testCases {
+		manager := NewManager(&Config{DHCPBackend: tc.dhcp, DNSBackend: tc.dns, EmbeddedDNS: tc.embedded})
+		var names []string
+		for _, server := range manager.servers() {
+			names = append(names, server.Name())
+		}
+		if strings.Join(names, ",") != tc.expected {
+			t.Errorf("servers(%q, %q, embedded %t) = %v, expected %s", tc.dhcp, tc.dns, tc.embedded, names, tc.expected)
+		}
+	}
+
+	// the embedded forwarder is nat-manager itself, no binary to install
+	manager := NewManager(&Config{EmbeddedDNS: true, Executable: "/usr/local/bin/nat-manager"})
+	if binaries := manager.ServerBinaries(); strings.Join(binaries, ",") != "dnsmasq" {
+		t.Errorf("ServerBinaries = %v", binaries)
+	}
+	cmd := forwarderServer{}.Command(context.Background(), manager)
+	if args := strings.Join(cmd.Args, " "); !strings.HasSuffix(args, "dns serve --supervised") || cmd.Path != "/usr/local/bin/nat-manager" {
+		t.Errorf("forwarder command = %s", args)
+	}
+
+	// dnsmasq answering only DNS next to Kea leaves DHCP alone
+	manager = NewManager(&Config{
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+		DHCPRange:         DHCPRange{Start: "100", End: "200"},
+		LeaseFile:         "/tmp/kea-leases4.csv",
+		DHCPBackend:       BackendKea,
+	})
+	options, err := manager.dnsmasqOptions("/tmp/dhcp-event.sh")
+	if err != nil {
+		t.Fatalf("dnsmasqOptions failed: %v", err)
+	}
+	for _, option := range options {
+		if strings.HasPrefix(option, "dhcp-") || option == "port=0" {
+			t.Errorf("Unexpected option %q for DNS-only dnsmasq", option)
+		}
+	}
+
+	// dnsmasq answering only DHCP next to CoreDNS hands out the gateway
+	manager.config.DHCPBackend, manager.config.DNSBackend = BackendDnsmasq, BackendCoreDNS
+	options, _ = manager.dnsmasqOptions("")
+	if !slices.Contains(options, "port=0") || !slices.Contains(options, "dhcp-option=option:dns-server,192.168.100.1") {
+		t.Errorf("DHCP-only dnsmasq should point clients at the gateway: %v", options)
+	}
+}
+
+func TestKeaConf(t *testing.T) {
+	cfg := &Config{
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+		DHCPRange:         DHCPRange{Start: "100", End: "200", Lease: "12h", Exclude: []string{"150"}},
+		LocalDomain:       "home.lan",
+		LeaseFile:         "/tmp/kea-leases4.csv",
+	}
+	conf, err := renderKeaConf(cfg)
+	if err != nil {
+		t.Fatalf("renderKeaConf failed: %v", err)
+	}
+	var parsed map[string]any
+	if err := json.Unmarshal([]byte(conf), &parsed); err != nil {
+		t.Fatalf("kea config is not JSON: %v", err)
+	}
+	for _, expected := range []string{
+		`"interfaces": [` + "\n" + `        "bridge100"`,
+		`"name": "/tmp/kea-leases4.csv"`,
+		`"valid-lifetime": 43200`,
+		`"pool": "192.168.100.100 - 192.168.100.149"`,
+		`"pool": "192.168.100.151 - 192.168.100.200"`,
+		`"data": "home.lan"`,
+	} {
+		if !strings.Contains(conf, expected) {
+			t.Errorf("kea config missing %s:\n%s", expected, conf)
+		}
+	}
+
+	cfg.DeviceLeases = []DeviceLease{{MAC: "aa:bb:cc:dd:ee:ff", Lease: "1h"}}
+	if _, err := renderKeaConf(cfg); err == nil {
+		t.Error("Per-device lease times should be rejected with kea")
+	}
+
+	for lease, seconds := range map[string]int64{"": 3600, "45m": 2700, "7d": 604800, "90": 90, "infinite": 4294967295} {
+		if got, err := leaseSeconds(lease); err != nil || got != seconds {
+			t.Errorf("leaseSeconds(%q) = %d, %v, expected %d", lease, got, err, seconds)
+		}
+	}
+}
+
+func TestParseKeaLeases(t *testing.T) {
+	data := `address,hwaddr,client_id,valid_lifetime,expire,subnet_id,fqdn_fwd,fqdn_rev,hostname,state,user_context,pool_id
+192.168.100.100,aa:bb:cc:dd:ee:01,,3600,1791000000,1,0,0,laptop.,0,,0
+192.168.100.101,aa:bb:cc:dd:ee:02,,3600,1791000000,1,0,0,,0,,0
+192.168.100.100,aa:bb:cc:dd:ee:01,,3600,1791003600,1,0,0,laptop.,0,,0
+192.168.100.101,aa:bb:cc:dd:ee:02,,0,1791000000,1,0,0,,0,,0
+192.168.100.102,aa:bb:cc:dd:ee:03,,3600,1791000000,1,0,0,phone,1,,0
+`
+	leases, err := ParseKeaLeases(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseKeaLeases failed: %v", err)
+	}
+	if len(leases) != 1 {
+		t.Fatalf("Expected only the active lease, got %+v", leases)
+	}
+	lease := leases[0]
+	if lease.IP != "192.168.100.100" || lease.MAC != "aa:bb:cc:dd:ee:01" || lease.Hostname != "laptop" || lease.Expiry.Unix() != 1791003600 {
+		t.Errorf("Unexpected lease %+v", lease)
+	}
+
+	if leases, err := ParseKeaLeases(strings.NewReader("")); err != nil || len(leases) != 0 {
+		t.Errorf("Empty lease file = %v, %v", leases, err)
+	}
+}
+
+func TestCorefile(t *testing.T) {
+	cfg := &Config{
+		InternalNetwork: "192.168.100",
+		DNSServers:      []string{"1.1.1.1", "9.9.9.9"},
+		LocalDomain:     "home.lan",
+		DomainServers:   map[string][]string{"corp.example.com": {"10.0.0.53"}},
+	}
+	corefile := renderCorefile(cfg, "/tmp/coredns-hosts")
+	for _, expected := range []string{
+		".:53 {\n    bind 192.168.100.1\n    hosts /tmp/coredns-hosts {",
+		"forward . 1.1.1.1 9.9.9.9\n",
+		"home.lan:53 {\n",
+		"corp.example.com:53 {\n    bind 192.168.100.1\n    forward . 10.0.0.53\n",
+	} {
+		if !strings.Contains(corefile, expected) {
+			t.Errorf("Corefile missing %q:\n%s", expected, corefile)
+		}
+	}
+
+	hosts := renderHostsFile([]DNSRecord{
+		{Name: "nas.home.lan", Type: "A", Value: "192.168.100.10"},
+		{Name: "files.home.lan", Type: "CNAME", Value: "nas.home.lan"},
+	})
+	if hosts != "192.168.100.10 nas.home.lan\n" {
+		t.Errorf("Unexpected hosts file %q", hosts)
+	}
+}
+
+func TestParseARP(t *testing.T) {
+	output := `? (192.168.100.1) at 1e:0:a:b:c:64 on bridge100 ifscope permanent [bridge]
+? (192.168.100.101) at a4:83:e7:1:2:3 on bridge100 ifscope [ethernet]
+? (192.168.100.102) at (incomplete) on bridge100 ifscope [ethernet]
+? (192.168.100.255) at ff:ff:ff:ff:ff:ff on bridge100 ifscope [ethernet]
+? (10.0.0.1) at 0:11:22:33:44:55 on en0 ifscope [ethernet]
+`
+	entries := parseARP(strings.NewReader(output), "bridge100")
+	expected := []arpEntry{
+		{IP: "192.168.100.1", MAC: "1e:00:0a:0b:0c:64"},
+		{IP: "192.168.100.101", MAC: "a4:83:e7:01:02:03"},
+	}
+	if !slices.Equal(entries, expected) {
+		t.Errorf("parseARP = %v, expected %v", entries, expected)
+	}
+}
+
+func TestDevices(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	leases := []Lease{
+		{MAC: "A4:83:E7:01:02:03", IP: "192.168.100.101", Hostname: "laptop", Expiry: now.Add(2 * time.Hour)},
+		{MAC: "52:54:00:00:00:01", IP: "192.168.100.20"},
+	}
+	arp := []arpEntry{
+		{IP: "192.168.100.101", MAC: "a4:83:e7:01:02:03"},
+		{IP: "192.168.100.9", MAC: "02:00:00:00:00:09"},
+	}
+
+	devices := mergeDevices(leases, arp, now)
+	if len(devices) != 3 {
+		t.Fatalf("Expected 3 devices, got %+v", devices)
+	}
+	static, vm, laptop := devices[0], devices[1], devices[2]
+	if static.IP != "192.168.100.9" || static.Source != SourceARP || !static.Online || static.LeaseRemaining != "" {
+		t.Errorf("Unexpected static device %+v", static)
+	}
+	if vm.LeaseRemaining != "infinite" || vm.Online || vm.Vendor != "QEMU" {
+		t.Errorf("Unexpected VM %+v", vm)
+	}
+	if laptop.MAC != "a4:83:e7:01:02:03" || laptop.LeaseRemaining != "2h0m0s" || !laptop.Online {
+		t.Errorf("Unexpected laptop %+v", laptop)
+	}
+
+	labelVMs(devices, []VM{{Name: "colima", Kind: "Colima VM", MAC: "52:54:00:00:00:01"}})
+	if devices[1].VM != "colima" || devices[1].Type != "Colima VM" || devices[1].Hostname != "colima" {
+		t.Errorf("Unexpected attached VM %+v", devices[1])
+	}
+	if devices[2].VM != "" || devices[2].Hostname != "laptop" {
+		t.Errorf("Only attached VMs should be labelled: %+v", devices[2])
+	}
+}
+
+func TestDeviceSightings(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	devices := []Device{
+		{MAC: "02:00:00:00:00:09", Online: true},
+		{MAC: "52:54:00:00:00:01"},
+		{MAC: "a4:83:e7:01:02:03", Online: true},
+	}
+
+	// Sightings persist between listings
+	inventory := filepath.Join(t.TempDir(), "devices.json")
+	manager := NewManager(&Config{InventoryFile: inventory})
+	fingerprints := map[string]fingerprint.Observation{"52:54:00:00:00:01": {Seen: now.Add(-time.Hour)}}
+	manager.recordSightings(devices, fingerprints, now.Add(-24*time.Hour))
+	manager.recordSightings(devices, fingerprints, now)
+	if !devices[2].FirstSeen.Equal(now.Add(-24*time.Hour)) || !devices[2].LastSeen.Equal(now) {
+		t.Errorf("Unexpected sightings of an online device: %+v", devices[2])
+	}
+	if !devices[1].LastSeen.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Offline devices should be last seen at their last lease event: %+v", devices[1])
+	}
+	if saved := loadSightings(inventory); len(saved) != 3 {
+		t.Errorf("Expected 3 saved sightings, got %v", saved)
+	}
+}
+
+func TestParseStateSources(t *testing.T) {
+	output := `ALL tcp 93.184.216.34:443 <- 192.168.100.101:52345       ESTABLISHED:ESTABLISHED
+ALL tcp 192.168.1.5:61000 (192.168.100.101:52345) -> 93.184.216.34:443       ESTABLISHED:ESTABLISHED
+ALL udp 192.168.1.5:62000 (192.168.100.20:5353) -> 1.1.1.1:53       MULTIPLE:SINGLE
+ALL udp 192.168.100.1:53 <- 192.168.100.9:5353       MULTIPLE:SINGLE
+ALL tcp 192.168.1.5:22 <- 192.168.1.20:50000       ESTABLISHED:ESTABLISHED
+`
+	sources := parseStateSources(strings.NewReader(output), "192.168.100")
+	expected := []string{"192.168.100.9", "192.168.100.20", "192.168.100.101"}
+	if !slices.Equal(sources, expected) {
+		t.Errorf("parseStateSources = %v, expected %v", sources, expected)
+	}
+}
+
+func TestParseTableCounters(t *testing.T) {
+	output := `   192.168.100.10
+	Cleared:     Fri Oct 16 12:00:00 2026
+	In/Block:    [ Packets: 3                  Bytes: 180                ]
+	In/Pass:     [ Packets: 120                Bytes: 9800               ]
+	Out/Block:   [ Packets: 0                  Bytes: 0                  ]
+	Out/Pass:    [ Packets: 200                Bytes: 250000             ]
+   192.168.100.20
+	Cleared:     Fri Oct 16 12:00:00 2026
+	In/Block:    [ Packets: 0                  Bytes: 0                  ]
+	In/Pass:     [ Packets: 0                  Bytes: 0                  ]
+	Out/Block:   [ Packets: 0                  Bytes: 0                  ]
+	Out/Pass:    [ Packets: 0                  Bytes: 0                  ]
+`
+	counters := parseTableCounters(strings.NewReader(output))
+	expected := map[string]Traffic{
+		"192.168.100.10": {BytesIn: 250000, BytesOut: 9800, PacketsIn: 200, PacketsOut: 120},
+		"192.168.100.20": {},
+	}
+	if !maps.Equal(counters, expected) {
+		t.Errorf("parseTableCounters = %v, expected %v", counters, expected)
+	}
+}
+
+func TestAccountingRules(t *testing.T) {
+	cfg := &Config{ExternalInterface: "en0", InternalInterface: "bridge100", InternalNetwork: "192.168.100"}
+	leases := []Lease{{MAC: "aa:bb:cc:dd:ee:ff", IP: "192.168.100.42"}}
+	rules := GenerateRules(cfg, leases)
+	for _, line := range []string{
+		"table <nat_manager_accounting> counters persist { 192.168.100.42 }",
+		"pass in on bridge100 from <nat_manager_accounting> to any",
+		"pass out on bridge100 from any to <nat_manager_accounting>",
+	} {
+		if !strings.Contains(rules, line+"\n") {
+			t.Errorf("Expected rule %q in:\n%s", line, rules)
+		}
+	}
+
+	// Quick block rules keep precedence over the counting pass rules
+	cfg.BlockedDevices = []string{"192.168.100.99"}
+	rules = GenerateRules(cfg, leases)
+	if strings.Index(rules, "block drop quick") > strings.Index(rules, "pass in on") {
+		t.Error("Accounting rules must come after block rules")
+	}
+}
+
+func TestAccountingLedger(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	uplink := func(bytes uint64) map[string]Traffic { return map[string]Traffic{"en0": {BytesIn: bytes}} }
+	device := func(bytes uint64) map[string]Traffic { return map[string]Traffic{"192.168.100.10": {BytesIn: bytes}} }
+
+	// Uplink counters run since boot and only their growth counts
+	l := newLedger(start, device(0), uplink(5000))
+	l.record(start.Add(30*time.Minute), device(100), uplink(5100))
+	// The anchor was reloaded, resetting the device counters
+	l.record(start.Add(90*time.Minute), device(40), uplink(5300))
+	l.record(start.Add(2*time.Hour), device(70), uplink(5400))
+
+	total := l.usage(start)
+	if total.Devices[0].BytesIn != 170 || total.Uplinks[0].BytesIn != 400 || !total.Since.Equal(start) {
+		t.Errorf("Usage since start = %+v", total)
+	}
+	lastHour := l.usage(start.Add(time.Hour))
+	if lastHour.Devices[0].BytesIn != 70 || lastHour.Uplinks[0].BytesIn != 300 || !lastHour.Since.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("Usage over the last hour = %+v", lastHour)
+	}
+
+	// Samples older than the retention are dropped
+	l.record(start.Add(30*time.Hour), device(80), uplink(5500))
+	if len(l.History) != 1 || l.usage(start).Devices[0].BytesIn != 0 {
+		t.Errorf("Old samples kept: %+v", l.History)
+	}
+}
+
+func TestParseAnchors(t *testing.T) {
+	output := "  nat-manager/lab\n  nat-manager/default\n  com.apple/250.ApplicationFirewall\n  nat-manager/Bad Name\n"
+	expected := []string{"nat-manager/default", "nat-manager/lab"}
+	if anchors := parseAnchors(output); !slices.Equal(anchors, expected) {
+		t.Errorf("parseAnchors = %v, expected %v", anchors, expected)
+	}
+}
+
+func TestCreatedBridge(t *testing.T) {
+	ours := "bridge100: flags=8863<UP,BROADCAST,SMART,RUNNING,SIMPLEX,MULTICAST> mtu 1500\n\tinet 192.168.100.1 netmask 0xffffff00 broadcast 192.168.100.255\n"
+	sharing := ours + "\tmember: en5 flags=3<LEARNING,DISCOVER>\n"
+	tests := []struct {
+		name     string
+		ifconfig string
+		network  string
+		expected bool
+	}{
+		{"left behind", ours, "192.168.100", true},
+		{"with members", sharing, "192.168.100", false},
+		{"other network", ours, "192.168.10", false},
+		{"missing", "", "192.168.100", false},
+	}
+	for _, tt := range tests {
+		if got := createdBridge(tt.ifconfig, tt.network); got != tt.expected {
+			t.Errorf("%s: createdBridge = %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, "state.yaml")
+	cfg := &Config{Instance: "lab", InternalInterface: "en9", InternalNetwork: "10.10.0", PIDFile: filepath.Join(dir, "dnsmasq.pid")}
+
+	registry := &Registry{Instances: map[string]Resources{"lab": {Instance: "lab", Anchor: "nat-manager/lab", PIDFile: cfg.PIDFile}}}
+	if err := registry.Save(stateFile); err != nil {
+		t.Fatal(err)
+	}
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skip("true not available")
+	}
+	files := map[string]string{
+		"dnsmasq.pid":      fmt.Sprintf("%d\n", exited.Process.Pid),
+		"kea-server.pid":   fmt.Sprintf("%d\n", os.Getpid()), // reused by another process
+		"devices.json.tmp": "{",
+		"dnsmasq.leases":   "",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	orphans, err := FindOrphans(stateFile, []*Config{cfg})
+	if err != nil {
+		t.Fatalf("FindOrphans failed: %v", err)
+	}
+	var kinds []string
+	for _, orphan := range orphans {
+		kinds = append(kinds, orphan.Kind)
+		if err := orphan.Remove(); err != nil {
+			t.Errorf("Remove failed: %v", err)
+		}
+	}
+	expected := []string{OrphanPIDFile, OrphanPIDFile, OrphanTemp, OrphanState}
+	if !slices.Equal(kinds, expected) {
+		t.Errorf("Orphan kinds = %v, expected %v", kinds, expected)
+	}
+
+	remaining, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(remaining) != 2 {
+		t.Errorf("Only the lease and state files should remain: %v", remaining)
+	}
+	if registry, err := LoadRegistry(stateFile); err != nil || len(registry.Instances) != 0 {
+		t.Errorf("Stale registry entry kept: %+v, %v", registry, err)
+	}
+}
+
+func TestConnectivityHelpers(t *testing.T) {
+	output := "PING 1.1.1.1 (1.1.1.1): 56 data bytes\n64 bytes from 1.1.1.1: icmp_seq=0 ttl=57 time=12.345 ms\n"
+	if summary := pingSummary(output, "1.1.1.1"); summary != "1.1.1.1 replied in 12.345 ms" {
+		t.Errorf("pingSummary = %q", summary)
+	}
+	if summary := pingSummary("", "1.1.1.1"); summary != "1.1.1.1 replied" {
+		t.Errorf("pingSummary without a time = %q", summary)
+	}
+	if rtt, ok := pingTime(output); !ok || rtt != 12345*time.Microsecond {
+		t.Errorf("pingTime = %v, %t", rtt, ok)
+	}
+
+	states := "ALL icmp 192.168.1.5:41000 (192.168.100.1:41000) -> 1.1.1.1:41000       0:0\n"
+	if !hasTranslation(states, "192.168.100") {
+		t.Error("Translated state not found")
+	}
+	if hasTranslation("ALL tcp 192.168.1.5:22 <- 192.168.1.20:50000       ESTABLISHED:ESTABLISHED\n", "192.168.100") {
+		t.Error("Untranslated state reported as translated")
+	}
+}
+
+func TestParseStateConnections(t *testing.T) {
+	output := `ALL tcp 192.168.1.5:61000 (192.168.100.101:52345) -> 93.184.216.34:443       ESTABLISHED:ESTABLISHED
+   age 00:01:23, expires in 23:59:50, 10:8 pkts, 1200:3400 bytes, rule 0
+ALL udp 192.168.100.1:53 <- 192.168.100.9:5353       MULTIPLE:SINGLE
+   age 00:00:05, expires in 00:00:55, 1:1 pkts, 60:120 bytes, rule 2
+ALL tcp 192.168.1.5:22 <- 192.168.1.20:50000       ESTABLISHED:ESTABLISHED
+   age 02:00:00, expires in 23:59:59, 100:100 pkts, 9000:9000 bytes, rule 1
+`
+	connections := parseStateConnections(strings.NewReader(output), "192.168.100")
+	lines := strings.Split(output, "\n")
+	expected := []Connection{
+		{Source: "192.168.100.101:52345", Destination: "93.184.216.34:443", Protocol: "TCP", State: "ESTABLISHED:ESTABLISHED", Translated: "192.168.1.5:61000",
+			Bytes: 4600, Packets: 18, Age: 83 * time.Second, Entry: lines[0] + "\n" + lines[1]},
+		{Source: "192.168.100.9:5353", Destination: "192.168.100.1:53", Protocol: "UDP", State: "MULTIPLE:SINGLE", Bytes: 180, Packets: 2, Age: 5 * time.Second,
+			Entry: lines[2] + "\n" + lines[3]},
+	}
+	if !slices.Equal(connections, expected) {
+		t.Errorf("parseStateConnections = %+v, expected %+v", connections, expected)
+	}
+}
+
+func TestConnectionFilter(t *testing.T) {
+	connections := []Connection{
+		{Source: "192.168.100.101:52345", Destination: "93.184.216.34:443", Protocol: "TCP", Bytes: 100, Age: time.Minute},
+		{Source: "192.168.100.9:5353", Destination: "1.1.1.1:53", Protocol: "UDP", Bytes: 300, Age: time.Second},
+		{Source: "192.168.100.101.50000", Destination: "10.1.2.3.22", Protocol: "TCP", Bytes: 200, Age: time.Hour},
+	}
+	devices := []ConnectedDevice{{IP: "192.168.100.101", MAC: "aa:bb:cc:dd:ee:ff", Hostname: "build-vm"}}
+
+	testCases := []struct {
+		filters  []string
+		expected int // matching connections
+		wantErr  bool
+	}{
+		{filters: nil, expected: 3},
+		{filters: []string{"device=192.168.100.101"}, expected: 2},
+		{filters: []string{"dev=AA:BB:CC:DD:EE:FF proto=tcp"}, expected: 2},
+		{filters: []string{"device=build-vm", "port=22"}, expected: 1},
+		{filters: []string{"proto=udp"}, expected: 1},
+		{filters: []string{"dst=10.0.0.0/8"}, expected: 1},
+		{filters: []string{"dst=1.1.1.1 port=53"}, expected: 1},
+		{filters: []string{"port=8080"}, expected: 0},
+		{filters: []string{"proto=sctp"}, wantErr: true},
+		{filters: []string{"port=0"}, wantErr: true},
+		{filters: []string{"dst=10.0.0.0/33"}, wantErr: true},
+		{filters: []string{"host=a"}, wantErr: true},
+		{filters: []string{"proto=tcp", "protocol=udp"}, wantErr: true},
+		{filters: []string{"tcp"}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		filter, err := ParseConnectionFilter(tc.filters)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("ParseConnectionFilter(%q) error = %v, wantErr %v", tc.filters, err, tc.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if matched := filter.Apply(connections, devices); len(matched) != tc.expected {
+			t.Errorf("Filter %q matched %d connections, expected %d", tc.filters, len(matched), tc.expected)
+		}
+	}
+
+	if err := SortConnections(connections, SortBytes); err != nil || connections[0].Bytes != 300 || connections[2].Bytes != 100 {
+		t.Errorf("SortConnections by bytes = %+v, %v", connections, err)
+	}
+	if err := SortConnections(connections, SortAge); err != nil || connections[0].Age != time.Second || connections[2].Age != time.Hour {
+		t.Errorf("SortConnections by age = %+v, %v", connections, err)
+	}
+	if err := SortConnections(connections, SortDestination); err != nil || connections[0].Destination != "1.1.1.1:53" || connections[2].Destination != "93.184.216.34:443" {
+		t.Errorf("SortConnections by destination = %+v, %v", connections, err)
+	}
+	if err := SortConnections(connections, "name"); err == nil {
+		t.Error("Unknown sort orders should be rejected")
+	}
+}
+
+func TestInterfaceDetails(t *testing.T) {
+	route := `   route to: default
+destination: default
+       mask: default
+    gateway: 192.168.1.1
+  interface: en0
+      flags: <UP,GATEWAY,DONE,STATIC,PRCLONING,GLOBAL>
+`
+	if got := defaultRouteInterface(route); got != "en0" {
+		t.Errorf("defaultRouteInterface = %q, expected en0", got)
+	}
+	if got := defaultRouteInterface("route: writing to routing socket: not in table"); got != "" {
+		t.Errorf("defaultRouteInterface without a default route = %q", got)
+	}
+	if got := defaultGateway(route); got != "192.168.1.1" {
+		t.Errorf("defaultGateway = %q, expected 192.168.1.1", got)
+	}
+
+	testCases := []struct {
+		output   string
+		expected uint64
+	}{
+		{"\ttype: Ethernet\n\tlink rate: 1.00 Gbps\n", 1000000000},
+		{"\ttype: Wi-Fi\n\tlink rate: 144.00 Mbps / 866.70 Mbps\n", 866700000},
+		{"\tlink rate: 10.00 Kbps\n", 10000},
+		{"\tstatus: inactive\n", 0},
+	}
+	for _, tc := range testCases {
+		if got := parseLinkRate(tc.output); got != tc.expected {
+			t.Errorf("parseLinkRate(%q) = %d, expected %d", tc.output, got, tc.expected)
+		}
+	}
+
+	if !hasDHCPLease("op = BOOTREPLY\nhtype = 1\nyiaddr = 192.168.1.5\n") {
+		t.Error("A DHCP reply should count as a lease")
+	}
+	if hasDHCPLease("") {
+		t.Error("No packet should not count as a lease")
+	}
+}
+
+func TestForegroundLeases(t *testing.T) {
+	var out bytes.Buffer
+	f := &foreground{log: slog.New(slog.NewTextHandler(&out, nil)), leases: make(map[string]Lease)}
+
+	f.checkLeases([]Lease{
+		{MAC: "aa:aa:aa:aa:aa:01", IP: "192.168.100.20", Hostname: "vm"},
+		{MAC: "aa:aa:aa:aa:aa:02", IP: "192.168.100.3"},
+	})
+	f.checkLeases([]Lease{
+		{MAC: "aa:aa:aa:aa:aa:01", IP: "192.168.100.21", Hostname: "vm"},
+	})
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expected := []string{
+		"lease granted\" component=dhcp ip=192.168.100.3 ",
+		"lease granted\" component=dhcp ip=192.168.100.20 ",
+		"lease granted\" component=dhcp ip=192.168.100.21 ",
+		"lease released\" component=dhcp ip=192.168.100.3 ",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d log lines, got:\n%s", len(expected), out.String())
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, expected[i]) {
+			t.Errorf("Line %d = %q, expected it to contain %q", i, line, expected[i])
+		}
+	}
+
+	if n := parseStateEntries("State Table                          Total             Rate\n  current entries                       42               \n"); n != 42 {
+		t.Errorf("parseStateEntries = %d, expected 42", n)
+	}
+	if n := parseStateEntries(""); n != -1 {
+		t.Errorf("parseStateEntries without output = %d, expected -1", n)
+	}
+}
+
+func TestSlept(t *testing.T) {
+	last := time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)
+	if _, ok := slept(last, last.Add(foregroundInterval)); ok {
+		t.Error("A regular check should not count as sleep")
+	}
+	if _, ok := slept(last, last.Add(20*time.Second)); ok {
+		t.Error("A slow check should not count as sleep")
+	}
+	if asleep, ok := slept(last, last.Add(8*time.Hour)); !ok || asleep != 8*time.Hour {
+		t.Errorf("slept over night = %s, %v, expected 8h0m0s, true", asleep, ok)
+	}
+}
+
+func TestSpeedTransfers(t *testing.T) {
+	var received int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			received, _ = io.Copy(io.Discard, r.Body)
+			return
+		}
+		_, _ = w.Write(make([]byte, 1<<20))
+	}))
+	defer server.Close()
+
+	client := speedClient("")
+	result := measure("download", func() (uint64, time.Duration, error) {
+		return download(context.Background(), client, server.URL, time.Second)
+	})
+	if !result.Passed || result.Bytes != 1<<20 || result.BitsPerSec <= 0 {
+		t.Errorf("download = %+v", result)
+	}
+	bytes, _, err := upload(context.Background(), client, server.URL, 50*time.Millisecond)
+	if err != nil || bytes == 0 || int64(bytes) != received {
+		t.Errorf("upload sent %d bytes, server received %d: %v", bytes, received, err)
+	}
+	if result := measure("download", func() (uint64, time.Duration, error) {
+		return download(context.Background(), client, server.URL+"/missing\x7f", time.Second)
+	}); result.Passed {
+		t.Errorf("Invalid URL measured: %+v", result)
+	}
+}
+
+func TestParseIperf(t *testing.T) {
+	report := `{"start": {"connected": [{"remote_host": "192.168.100.50"}], "test_start": {"reverse": %d}},
+		"end": {"sum_sent": {"seconds": 10, "bytes": 12500000, "bits_per_second": 10000000},
+		"sum_received": {"seconds": 10, "bytes": 2500000, "bits_per_second": 2000000}}}`
+
+	upload := parseIperf([]byte(fmt.Sprintf(report, 0)), "192.168.100.50")
+	if !upload.Passed || upload.Name != "device 192.168.100.50 upload" || upload.BitsPerSec != 2e6 || upload.Duration != 10*time.Second {
+		t.Errorf("upload = %+v", upload)
+	}
+	downloadResult := parseIperf([]byte(fmt.Sprintf(report, 1)), "192.168.100.50")
+	if downloadResult.Name != "device 192.168.100.50 download" || downloadResult.BitsPerSec != 1e7 {
+		t.Errorf("download = %+v", downloadResult)
+	}
+	if other := parseIperf([]byte(fmt.Sprintf(report, 0)), "192.168.100.60"); other.Passed {
+		t.Errorf("Test from another device accepted: %+v", other)
+	}
+	if failed := parseIperf([]byte(`{"error": "unable to start listener"}`), "192.168.100.50"); failed.Passed || !strings.Contains(failed.Detail, "listener") {
+		t.Errorf("iperf3 error = %+v", failed)
+	}
+}
+
+func TestJudgeSpeed(t *testing.T) {
+	leases := []Lease{{IP: "192.168.100.50", MAC: "aa:bb:cc:dd:ee:ff"}}
+	caps := []DeviceCap{{Name: "kids", Devices: []string{"AA:BB:CC:DD:EE:FF"}, Rate: "2Mbit/s"}}
+	if rate := deviceCap(caps, "192.168.100.50", leases); rate != "2Mbit/s" {
+		t.Errorf("deviceCap = %q", rate)
+	}
+	if rate := deviceCap(caps, "192.168.100.51", leases); rate != "" {
+		t.Errorf("deviceCap of an uncapped device = %q", rate)
+	}
+
+	testCases := []struct {
+		bps    float64
+		judge  func(*SpeedResult)
+		passed bool
+		detail string
+	}{
+		{2.1e6, func(r *SpeedResult) { judgeCap(r, "2Mbit/s") }, true, "within the cap"},
+		{5e6, func(r *SpeedResult) { judgeCap(r, "2Mbit/s") }, false, "not enforced"},
+		{5e6, func(r *SpeedResult) { judgeCap(r, "") }, true, "no cap"},
+		{95e6, func(r *SpeedResult) { judgeLink(r, "100Mbit/s") }, true, "matches"},
+		{300e6, func(r *SpeedResult) { judgeLink(r, "100Mbit/s") }, false, "too slow a link"},
+		{20e6, func(r *SpeedResult) { judgeLink(r, "100Mbit/s") }, false, "cannot be met"},
+	}
+	for _, tc := range testCases {
+		result := SpeedResult{BitsPerSec: tc.bps, Passed: true, Detail: FormatBitRate(tc.bps)}
+		tc.judge(&result)
+		if result.Passed != tc.passed || !strings.Contains(result.Detail, tc.detail) {
+			t.Errorf("%.0f bit/s: passed %v, %q; expected %v, %q", tc.bps, result.Passed, result.Detail, tc.passed, tc.detail)
+		}
+	}
+
+	if s := FormatBitRate(94.2e6); s != "94.2 Mbit/s" {
+		t.Errorf("FormatBitRate = %q", s)
+	}
+}
+
+func TestSuggestNetwork(t *testing.T) {
+	parse := func(cidrs ...string) []*net.IPNet {
+		var networks []*net.IPNet
+		for _, cidr := range cidrs {
+			ip, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			network.IP = ip // interfaces report their own address
+			networks = append(networks, network)
+		}
+		return networks
+	}
+
+	testCases := []struct {
+		used     []*net.IPNet
+		expected string
+	}{
+		{nil, "192.168.100"},
+		{parse("192.168.1.20/24", "10.0.0.5/8"), "192.168.100"},
+		{parse("192.168.100.1/24", "192.168.101.7/24"), "192.168.102"},
+		{parse("192.168.96.4/20"), "192.168.112"},
+		{parse("192.168.0.1/16"), "10.100.0"},
+	}
+	for _, tc := range testCases {
+		if got := SuggestNetwork(tc.used); got != tc.expected {
+			t.Errorf("SuggestNetwork(%v) = %q, expected %q", tc.used, got, tc.expected)
+		}
+	}
+}
+
+func TestMagicPacket(t *testing.T) {
+	packet, err := MagicPacket("AA:BB:CC:DD:EE:01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packet) != 102 || !bytes.Equal(packet[:6], bytes.Repeat([]byte{0xff}, 6)) {
+		t.Fatalf("Expected 6 bytes of 0xff and 16 copies of the MAC, got %x", packet)
+	}
+	if !bytes.Equal(packet[96:], []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0x01}) {
+		t.Errorf("Expected the packet to end with the MAC, got %x", packet[96:])
+	}
+	if _, err := MagicPacket("192.168.100.20"); err == nil {
+		t.Error("Expected an IP address to be rejected")
+	}
+}
+
+func TestBlockTargets(t *testing.T) {
+	lookups := 0
+	known := func() []Device {
+		lookups++
+		return []Device{
+			{IP: "192.168.100.20", MAC: "aa:bb:cc:dd:ee:01", Hostname: "kids-ipad"},
+			{IP: "192.168.100.21", Hostname: "printer.lan"},
+		}
+	}
+
+	devices, domains, err := BlockTargets([]string{"192.168.100.50", "Kids-iPad", "printer.lan", "TikTok.com."}, known)
+	if err != nil {
+		t.Fatalf("BlockTargets failed: %v", err)
+	}
+	if got := strings.Join(devices, ","); got != "192.168.100.50,aa:bb:cc:dd:ee:01,192.168.100.21" {
+		t.Errorf("devices = %s", got)
+	}
+	if got := strings.Join(domains, ","); got != "tiktok.com" {
+		t.Errorf("domains = %s", got)
+	}
+	if lookups != 1 {
+		t.Errorf("known devices listed %d times, expected once", lookups)
+	}
+
+	for _, arg := range []string{"unknown-host", "10.0.0.1/8", "::1"} {
+		if _, _, err := BlockTargets([]string{arg}, known); err == nil {
+			t.Errorf("BlockTargets(%q) should fail", arg)
+		}
+	}
+
+	if _, _, err := BlockTargets([]string{"aa:bb:cc:dd:ee:ff"}, nil); err != nil {
+		t.Errorf("MACs should not need the known devices: %v", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	testCases := []struct {
+		size     string
+		expected uint64
+		valid    bool
+	}{
+		{"50GB", 50 << 30, true},
+		{"500 MB", 500 << 20, true},
+		{"1.5T", 3 << 39, true},
+		{"2GiB", 2 << 30, true},
+		{"1024", 1024, true},
+		{"0GB", 0, false},
+		{"lots", 0, false},
+		{"5PB", 0, false},
+	}
+	for _, tc := range testCases {
+		got, err := ParseSize(tc.size)
+		if (err == nil) != tc.valid || got != tc.expected {
+			t.Errorf("ParseSize(%q) = %d, %v, expected %d", tc.size, got, err, tc.expected)
+		}
+	}
+}
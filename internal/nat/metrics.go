@@ -0,0 +1,45 @@
+package nat
+
+import (
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/metrics"
+)
+
+// Latency histograms of the manager's operations and the system commands
+// they run
+var (
+	operationDuration = metrics.Default.NewHistogram("nat_manager_operation_duration_seconds",
+		"Duration of NAT manager operations.", "operation")
+	commandDuration = metrics.Default.NewHistogram("nat_manager_command_duration_seconds",
+		"Duration of system commands run by the NAT manager.", "command")
+)
+
+// timed runs a system command through fn, recording its duration under the
+// command's name and auditing it if it changes the machine
+func timed[T any](cmd *exec.Cmd, fn func() (T, error)) (T, error) {
+	defer commandDuration.Since(filepath.Base(cmd.Args[0]), time.Now())
+	result, err := fn()
+	audit.Command(cmd.Args, err)
+	return result, err
+}
+
+// runCmd runs a system command and records its duration
+func runCmd(cmd *exec.Cmd) error {
+	_, err := timed(cmd, func() (struct{}, error) { return struct{}{}, cmd.Run() })
+	return err
+}
+
+// cmdOutput runs a system command, records its duration and returns its output
+func cmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return timed(cmd, cmd.Output)
+}
+
+// cmdCombinedOutput runs a system command, records its duration and returns
+// its output and error output
+func cmdCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	return timed(cmd, cmd.CombinedOutput)
+}
@@ -0,0 +1,123 @@
+package nat
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/fingerprint"
+)
+
+// isolatedTable is the pf table of devices kept off the internet
+const isolatedTable = "nat_manager_isolated"
+
+// nonNameRe matches the characters of a device class not allowed in cap names
+var nonNameRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// ClassPolicy applies defaults to every device of a detected class, such as
+// "Printer" or "Camera". Settings made for individual devices still apply.
+type ClassPolicy struct {
+	Class   string // as reported by device classification, case-insensitive
+	Block   bool   // block the devices entirely
+	Isolate bool   // let the devices reach the internal network only
+	Group   string // bandwidth group the devices join
+	Cap     string // bandwidth the class shares in each direction, e.g. 2Mbit/s
+}
+
+// ValidateClassPolicies checks the policies against the configured groups
+func ValidateClassPolicies(policies []ClassPolicy, groups []DeviceGroup) error {
+	known := make(map[string]bool)
+	for _, group := range groups {
+		known[group.Name] = true
+	}
+
+	var errs []error
+	seen := make(map[string]bool)
+	for _, p := range policies {
+		class := strings.ToLower(p.Class)
+		switch {
+		case class == "":
+			errs = append(errs, fmt.Errorf("device class policy without a class"))
+			continue
+		case seen[class]:
+			errs = append(errs, fmt.Errorf("device class %q has two policies", p.Class))
+		}
+		seen[class] = true
+
+		if p.Group != "" && !known[p.Group] {
+			errs = append(errs, fmt.Errorf("device class %q: unknown bandwidth group %q", p.Class, p.Group))
+		}
+		if p.Cap != "" {
+			if _, err := ParseRate(p.Cap); err != nil {
+				errs = append(errs, fmt.Errorf("device class %q: %w", p.Class, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// classCapName names the cap created for a device class
+func classCapName(class string) string {
+	name := "class-" + strings.Trim(nonNameRe.ReplaceAllString(strings.ToLower(class), "-"), "-")
+	if len(name) > 24 {
+		name = name[:24]
+	}
+	return name
+}
+
+// classMembers returns the MACs of the leased devices in each class,
+// keyed by lowercase class
+func classMembers(leases []Lease, fingerprints map[string]fingerprint.Observation) map[string][]string {
+	members := make(map[string][]string)
+	for _, lease := range leases {
+		class := strings.ToLower(deviceType(lease, fingerprints))
+		if class != "" {
+			members[class] = append(members[class], strings.ToLower(lease.MAC))
+		}
+	}
+	return members
+}
+
+// ApplyClassPolicies returns a copy of cfg with the leased devices of each
+// policy's class added to the block list, the isolated devices, the
+// policy's bandwidth group and a cap shared by the class
+func ApplyClassPolicies(cfg *Config, leases []Lease, fingerprints map[string]fingerprint.Observation) *Config {
+	if len(cfg.ClassPolicies) == 0 {
+		return cfg
+	}
+
+	effective := *cfg
+	effective.BlockedDevices = append([]string{}, cfg.BlockedDevices...)
+	effective.IsolatedDevices = append([]string{}, cfg.IsolatedDevices...)
+	effective.Shaping.Groups = append([]DeviceGroup{}, cfg.Shaping.Groups...)
+	effective.Shaping.Caps = append([]DeviceCap{}, cfg.Shaping.Caps...)
+
+	members := classMembers(leases, fingerprints)
+	for _, p := range cfg.ClassPolicies {
+		macs := members[strings.ToLower(p.Class)]
+		if p.Block {
+			effective.BlockedDevices = append(effective.BlockedDevices, macs...)
+		}
+		if p.Isolate {
+			effective.IsolatedDevices = append(effective.IsolatedDevices, macs...)
+		}
+		if p.Cap != "" {
+			effective.Shaping.Caps = append(effective.Shaping.Caps, DeviceCap{Name: classCapName(p.Class), Devices: macs, Rate: p.Cap})
+		}
+		for i, group := range effective.Shaping.Groups {
+			if group.Name == p.Group {
+				group.Devices = append(append([]string{}, group.Devices...), macs...)
+				effective.Shaping.Groups[i] = group
+			}
+		}
+	}
+	return &effective
+}
+
+// isolationFilter drops everything isolated devices send off the internal
+// network
+func isolationFilter(cfg *Config) string {
+	return fmt.Sprintf("block drop in quick on %s from <%s> to ! %s.0/24\n",
+		cfg.InternalInterface, isolatedTable, cfg.InternalNetwork)
+}
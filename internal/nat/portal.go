@@ -0,0 +1,93 @@
+package nat
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// portalTable is the pf table of devices admitted through the captive portal
+const portalTable = "nat_manager_portal"
+
+// Portal holds devices that have not accepted the captive portal back:
+// their web and DNS traffic is redirected to the portal on the gateway and
+// everything else they send is dropped
+type Portal struct {
+	Enabled  bool
+	Port     int      // gateway port of the portal web server
+	Admitted []string // IPs granted internet access
+}
+
+// portalTableRule declares the admitted table. It persists while empty so
+// that devices can be admitted later.
+func portalTableRule(p Portal) string {
+	var ips []string
+	for _, ip := range p.Admitted {
+		if net.ParseIP(ip).To4() != nil {
+			ips = append(ips, ip)
+		}
+	}
+	sort.Strings(ips)
+	if len(ips) == 0 {
+		return fmt.Sprintf("table <%s> persist\n", portalTable)
+	}
+	return fmt.Sprintf("table <%s> persist { %s }\n", portalTable, strings.Join(ips, " "))
+}
+
+// portalRedirects sends the web and DNS traffic of devices not yet admitted
+// to the gateway
+func portalRedirects(cfg *Config) string {
+	var b strings.Builder
+	network := cfg.InternalNetwork + ".0/24"
+	gateway := cfg.InternalNetwork + ".1"
+	fmt.Fprintf(&b, "no rdr on %s from <%s> to any\n", cfg.InternalInterface, portalTable)
+	fmt.Fprintf(&b, "rdr on %s proto tcp from %s to ! %s port 80 -> %s port %d\n",
+		cfg.InternalInterface, network, gateway, gateway, cfg.Portal.Port)
+	for _, proto := range []string{"tcp", "udp"} {
+		fmt.Fprintf(&b, "rdr on %s proto %s from %s to ! %s port 53 -> %s port 53\n",
+			cfg.InternalInterface, proto, network, gateway, gateway)
+	}
+	return b.String()
+}
+
+// gatewayRules keep the gateway and DHCP reachable for clients that
+// lockdown or the portal otherwise restrict
+func gatewayRules(cfg *Config) string {
+	return fmt.Sprintf("pass in quick on %s from %s.0/24 to %s.1\n", cfg.InternalInterface, cfg.InternalNetwork, cfg.InternalNetwork) +
+		fmt.Sprintf("pass in quick on %s proto udp from any port 68 to any port 67\n", cfg.InternalInterface)
+}
+
+// portalRules drop everything devices not yet admitted send elsewhere
+func portalRules(cfg *Config) string {
+	return fmt.Sprintf("block drop in quick on %s from ! <%s> to any\n", cfg.InternalInterface, portalTable)
+}
+
+// updateTable adds or deletes addresses in a table of the loaded anchor
+func (m *Manager) updateTable(table, op string, ips []string) error {
+	if len(ips) == 0 {
+		return nil
+	}
+	args := append([]string{"-a", m.anchorName(), "-t", table, "-T", op}, ips...)
+	if output, err := cmdCombinedOutput(exec.Command("pfctl", args...)); err != nil {
+		return fmt.Errorf("failed to update pf table %s: %w: %s", table, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// AdmitClient grants a device internet access past the captive portal
+func (m *Manager) AdmitClient(ip string) error {
+	if net.ParseIP(ip).To4() == nil {
+		return fmt.Errorf("%q is not an IPv4 address", ip)
+	}
+	return m.updateTable(portalTable, "add", []string{ip})
+}
+
+// RevokeClient sends a device back to the captive portal
+func (m *Manager) RevokeClient(ip string) error {
+	if net.ParseIP(ip).To4() == nil {
+		return fmt.Errorf("%q is not an IPv4 address", ip)
+	}
+	return m.updateTable(portalTable, "delete", []string{ip})
+}
@@ -0,0 +1,57 @@
+package nat
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
+)
+
+// sizeRe matches an amount of data such as 50GB, 1.5T or 500 MiB
+var sizeRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([kmgt]?)(?:i?b)?$`)
+
+// ParseSize parses an amount of data such as 500MB, 50GB or 1.5TB, in
+// multiples of 1024, and returns it in bytes
+func ParseSize(size string) (uint64, error) {
+	matches := sizeRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(size)))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 500MB, 50GB or 1TB)", size)
+	}
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+	multiplier := map[string]float64{"": 1, "k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40}[matches[2]]
+	bytes := uint64(value * multiplier)
+	if bytes == 0 {
+		return 0, fmt.Errorf("size %q must be positive", size)
+	}
+	return bytes, nil
+}
+
+// checkQuota sends a quota event, once per run, when the traffic through
+// the internal interface reaches the configured quota
+func (f *foreground) checkQuota() {
+	quota := f.m.config.TrafficQuota
+	if quota == 0 || f.quotaExceeded {
+		return
+	}
+	counters, err := ifstats.Read(f.m.config.InternalInterface)
+	if err != nil {
+		return
+	}
+	total := counters.BytesIn + counters.BytesOut
+	if total < quota {
+		return
+	}
+	f.quotaExceeded = true
+	f.log.Warn("traffic quota exceeded", "component", componentNetwork, "bytes", total, "quota", quota)
+	f.m.emit(event.QuotaExceeded, map[string]string{
+		"interface": f.m.config.InternalInterface,
+		"bytes":     strconv.FormatUint(total, 10),
+		"quota":     strconv.FormatUint(quota, 10),
+	})
+}
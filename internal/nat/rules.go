@@ -0,0 +1,327 @@
+package nat
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultAnchor is the pf anchor holding the NAT manager's rules. Each
+// instance loads its rules into a child anchor, DefaultAnchor/<instance>.
+const DefaultAnchor = "nat-manager"
+
+// blockedTable is the pf table of blocked device IPs inside the anchor
+const blockedTable = "nat_manager_blocked"
+
+// interfaceNameRe matches BSD network interface names
+var interfaceNameRe = regexp.MustCompile(`^[a-z][a-z0-9]{0,14}$`)
+
+// PortForward redirects an external port to a device on the internal network
+type PortForward struct {
+	Protocol     string // tcp, udp or tcp/udp
+	ExternalPort int
+	InternalIP   string
+	InternalPort int
+	Description  string
+}
+
+// String returns a short description of the forward
+func (f PortForward) String() string {
+	return fmt.Sprintf("%s %d -> %s:%d", f.Protocol, f.ExternalPort, f.InternalIP, f.InternalPort)
+}
+
+// protocols returns the pf protocol names the forward applies to
+func (f PortForward) protocols() []string {
+	if f.Protocol == "tcp/udp" {
+		return []string{"tcp", "udp"}
+	}
+	return []string{f.Protocol}
+}
+
+// ValidatePortForward checks a single forward against the internal network
+func ValidatePortForward(f PortForward, network string) error {
+	switch f.Protocol {
+	case "tcp", "udp", "tcp/udp":
+	default:
+		return fmt.Errorf("%s: protocol must be tcp, udp or tcp/udp", f)
+	}
+	if f.ExternalPort < 1 || f.ExternalPort > 65535 {
+		return fmt.Errorf("%s: external port must be 1-65535", f)
+	}
+	if f.InternalPort < 1 || f.InternalPort > 65535 {
+		return fmt.Errorf("%s: internal port must be 1-65535", f)
+	}
+	ip := net.ParseIP(f.InternalIP).To4()
+	if ip == nil {
+		return fmt.Errorf("%s: invalid internal IP", f)
+	}
+	if network != "" && !strings.HasPrefix(ip.String(), network+".") {
+		return fmt.Errorf("%s: internal IP must be in %s.0/24", f, network)
+	}
+	return nil
+}
+
+// ValidatePortForwards checks a whole batch of forwards, reporting every
+// invalid entry and every external port claimed twice
+func ValidatePortForwards(forwards []PortForward, network string) error {
+	var errs []error
+	claimed := make(map[string]PortForward)
+	for _, f := range forwards {
+		if err := ValidatePortForward(f, network); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, proto := range f.protocols() {
+			key := fmt.Sprintf("%s/%d", proto, f.ExternalPort)
+			if other, ok := claimed[key]; ok {
+				errs = append(errs, fmt.Errorf("%s: %s port %d already forwarded by %s", f, proto, f.ExternalPort, other))
+				continue
+			}
+			claimed[key] = f
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateDevice checks that a blocked device is a MAC or IPv4 address
+func ValidateDevice(device string) error {
+	if _, err := net.ParseMAC(device); err == nil {
+		return nil
+	}
+	if net.ParseIP(device).To4() != nil {
+		return nil
+	}
+	return fmt.Errorf("%q is not a MAC or IPv4 address", device)
+}
+
+// validateInterfaceName checks for a BSD interface name such as en0 or bridge100
+func validateInterfaceName(name string) error {
+	if !interfaceNameRe.MatchString(name) {
+		return fmt.Errorf("invalid interface name %q", name)
+	}
+	return nil
+}
+
+// validateNetwork checks for a /24 network prefix such as 192.168.100
+func validateNetwork(network string) error {
+	if net.ParseIP(network+".0").To4() == nil || strings.Count(network, ".") != 2 {
+		return fmt.Errorf("invalid internal network %q", network)
+	}
+	return nil
+}
+
+// deviceIPs resolves device MACs to their leased IPs and returns the
+// sorted, de-duplicated set of IPs
+func deviceIPs(devices []string, leases []Lease) []string {
+	byMAC := make(map[string][]string)
+	for _, lease := range leases {
+		mac := strings.ToLower(lease.MAC)
+		byMAC[mac] = append(byMAC[mac], lease.IP)
+	}
+
+	seen := make(map[string]bool)
+	for _, device := range devices {
+		if net.ParseIP(device) != nil {
+			seen[device] = true
+			continue
+		}
+		for _, ip := range byMAC[strings.ToLower(device)] {
+			seen[ip] = true
+		}
+	}
+
+	ips := make([]string, 0, len(seen))
+	for ip := range seen {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// GenerateRules renders the anchor ruleset: outbound NAT, port forwards,
+// bandwidth shaping, blocked and isolated devices, the captive portal,
+// lockdown and traffic accounting. Device MACs are resolved through leases.
+func GenerateRules(cfg *Config, leases []Lease) string {
+	var b strings.Builder
+
+	ips := deviceIPs(cfg.BlockedDevices, leases)
+	b.WriteString(tableRules(cfg, ips, leases))
+
+	fmt.Fprintf(&b, "nat on %s from %s.0/24 to any -> (%s)\n",
+		cfg.ExternalInterface, cfg.InternalNetwork, cfg.ExternalInterface)
+	if cfg.WireGuard.Enabled {
+		b.WriteString(wireGuardNAT(cfg))
+	}
+
+	for _, f := range cfg.PortForwards {
+		for _, proto := range f.protocols() {
+			fmt.Fprintf(&b, "rdr on %s proto %s from any to (%s) port %d -> %s port %d\n",
+				cfg.ExternalInterface, proto, cfg.ExternalInterface, f.ExternalPort, f.InternalIP, f.InternalPort)
+		}
+	}
+
+	if cfg.Portal.Enabled {
+		b.WriteString(portalRedirects(cfg))
+	}
+
+	if cfg.Shaping.Enabled() {
+		b.WriteString(shapingRules(cfg))
+	}
+
+	b.WriteString(filterRules(cfg, len(ips) > 0))
+	return b.String()
+}
+
+// tableRules declares the pf tables the rules refer to, blocked holding the
+// blocked device IPs and accounting the leased ones
+func tableRules(cfg *Config, blocked []string, leases []Lease) string {
+	var b strings.Builder
+	if len(blocked) > 0 {
+		fmt.Fprintf(&b, "table <%s> { %s }\n", blockedTable, strings.Join(blocked, " "))
+	}
+	if cfg.Shaping.Enabled() {
+		b.WriteString(shapingTables(cfg, leases))
+	}
+	if len(cfg.IsolatedDevices) > 0 {
+		b.WriteString(deviceTable(isolatedTable, cfg.IsolatedDevices, leases))
+	}
+	if cfg.Lockdown.Enabled {
+		b.WriteString(lockdownTable(cfg.Lockdown))
+	}
+	if cfg.Portal.Enabled {
+		b.WriteString(portalTableRule(cfg.Portal))
+	}
+	b.WriteString(accountingTableRule(leases))
+	return b.String()
+}
+
+// filterRules renders the filter rules, blocked devices first and traffic
+// accounting last
+func filterRules(cfg *Config, blocked bool) string {
+	var b strings.Builder
+	if blocked {
+		fmt.Fprintf(&b, "block drop quick on %s from <%s> to any\n", cfg.InternalInterface, blockedTable)
+		fmt.Fprintf(&b, "block drop quick on %s from any to <%s>\n", cfg.InternalInterface, blockedTable)
+	}
+	if len(cfg.IsolatedDevices) > 0 {
+		b.WriteString(isolationFilter(cfg))
+	}
+
+	if cfg.WireGuard.Enabled {
+		b.WriteString(wireGuardRules(cfg))
+	}
+	if cfg.Lockdown.Enabled || cfg.Portal.Enabled {
+		b.WriteString(gatewayRules(cfg))
+	}
+	if cfg.Portal.Enabled {
+		b.WriteString(portalRules(cfg))
+	}
+	if cfg.Lockdown.Enabled {
+		b.WriteString(lockdownRules(cfg))
+	}
+	b.WriteString(accountingFilter(cfg))
+	return b.String()
+}
+
+// mainRuleset hooks every instance anchor below anchor into the main pf
+// ruleset
+func mainRuleset(anchor string) string {
+	anchor += "/*"
+	return fmt.Sprintf("nat-anchor \"%s\"\nrdr-anchor \"%s\"\ndummynet-anchor \"%s\"\nanchor \"%s\"\n",
+		anchor, anchor, anchor, anchor)
+}
+
+// anchorName returns the pf anchor of this instance
+func (m *Manager) anchorName() string {
+	return DefaultAnchor + "/" + m.instanceName()
+}
+
+// ApplyRules validates the configured forwards and blocked devices and
+// reloads the anchor in a single pfctl call. It is a no-op when NAT rules
+// are not loaded.
+func (m *Manager) ApplyRules() error {
+	defer operationDuration.Since("apply_rules", time.Now())
+	if m.config == nil {
+		return fmt.Errorf("NAT config is nil")
+	}
+	if err := m.validateRules(); err != nil {
+		return err
+	}
+	if !m.RulesLoaded() {
+		return nil
+	}
+	if err := m.validateInterfaces(); err != nil {
+		return err
+	}
+	return m.loadAnchor()
+}
+
+// RulesLoaded reports whether the anchor currently holds NAT rules
+func (m *Manager) RulesLoaded() bool {
+	return strings.Contains(commandOutput("pfctl", "-a", m.anchorName(), "-s", "nat"), "nat on")
+}
+
+// validateInterfaces checks the interfaces and network rendered into the
+// ruleset so that configuration values can never inject pf syntax
+func (m *Manager) validateInterfaces() error {
+	return errors.Join(
+		validateInterfaceName(m.config.ExternalInterface),
+		validateInterfaceName(m.config.InternalInterface),
+		validateNetwork(m.config.InternalNetwork),
+	)
+}
+
+// validateRules checks the configured forwards, blocked devices, bandwidth
+// shaping, lockdown destinations, portal port and device class policies
+func (m *Manager) validateRules() error {
+	errs := []error{
+		ValidatePortForwards(m.config.PortForwards, m.config.InternalNetwork),
+		ValidateShaping(m.config.Shaping),
+		ValidateLockdown(m.config.Lockdown),
+		ValidateClassPolicies(m.config.ClassPolicies, m.config.Shaping.Groups),
+	}
+	if m.config.Portal.Enabled && (m.config.Portal.Port < 1 || m.config.Portal.Port > 65535) {
+		errs = append(errs, fmt.Errorf("portal port must be 1-65535"))
+	}
+	if m.config.WireGuard.Enabled {
+		errs = append(errs, ValidateWireGuard(m.config.WireGuard, m.config.InternalNetwork))
+	}
+	for _, device := range append(m.config.BlockedDevices, m.config.IsolatedDevices...) {
+		errs = append(errs, ValidateDevice(device))
+	}
+	return errors.Join(errs...)
+}
+
+// loadAnchor applies the device class policies to the leased devices,
+// configures the dummynet queues, renders the rules, loads them into the
+// anchor and fills the lockdown table with the allowed domains
+func (m *Manager) loadAnchor() error {
+	m.loadDummynetBase()
+	leases, _ := m.GetLeases()
+	effective := ApplyClassPolicies(m.config, leases, m.fingerprints())
+	if err := m.configureShaping(effective.Shaping); err != nil {
+		return err
+	}
+	if err := pfctlLoad(GenerateRules(effective, leases), "-a", m.anchorName()); err != nil {
+		return err
+	}
+	if m.config.Lockdown.Enabled {
+		return m.resolveAllowedDomains()
+	}
+	return nil
+}
+
+// pfctlLoad feeds a ruleset to pfctl on stdin
+func pfctlLoad(ruleset string, args ...string) error {
+	cmd := exec.Command("pfctl", append(args, "-f", "-")...)
+	cmd.Stdin = strings.NewReader(ruleset)
+	if output, err := cmdCombinedOutput(cmd); err != nil {
+		return fmt.Errorf("pfctl rejected ruleset: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package nat
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dummynet object numbers relative to an instance's base. Each direction
+// has one pipe at link capacity with a weighted queue per device group plus
+// a default queue for all other devices.
+const (
+	uplinkPipe          = 0
+	downlinkPipe        = 1
+	uplinkQueueOffset   = 100
+	downlinkQueueOffset = 200
+	capPipeOffset       = 300 // two pipes per cap, uplink then downlink
+	maxGroups           = 32
+	maxCaps             = 32
+)
+
+// dummynetBase returns the first dummynet number of an instance slot
+func dummynetBase(slot int) int {
+	return (slot + 1) * 1000
+}
+
+// groupNameRe matches device group names, which become pf table names
+var groupNameRe = regexp.MustCompile(`^[a-z0-9_-]{1,24}$`)
+
+// rateRe matches a bandwidth such as 100Mbit/s, 512k or 1G
+var rateRe = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([kmg])(?:bit/s|bps|b)?$`)
+
+// Shaping configures minimum bandwidth guarantees for device groups and
+// hard caps for sets of devices. Idle bandwidth is always shared, so
+// guarantees only take effect when the link is saturated.
+type Shaping struct {
+	Uplink   string // link capacity, e.g. 100Mbit/s
+	Downlink string
+	Groups   []DeviceGroup
+	Caps     []DeviceCap
+	Base     int // first dummynet number, set per instance; 0 means 1000
+}
+
+// base returns the first dummynet number
+func (s Shaping) base() int {
+	if s.Base == 0 {
+		return dummynetBase(0)
+	}
+	return s.Base
+}
+
+// DeviceGroup is a set of devices sharing a minimum bandwidth guarantee
+type DeviceGroup struct {
+	Name      string
+	Devices   []string // MAC or IP addresses
+	Guarantee string   // minimum share in each direction, e.g. 20Mbit/s
+}
+
+// DeviceCap limits the bandwidth a set of devices shares in each direction
+type DeviceCap struct {
+	Name    string
+	Devices []string // MAC or IP addresses
+	Rate    string   // e.g. 2Mbit/s
+}
+
+// Enabled reports whether any guarantees or caps are configured
+func (s Shaping) Enabled() bool {
+	return len(s.Groups) > 0 || len(s.Caps) > 0
+}
+
+// ParseRate parses a bandwidth such as 100Mbit/s, 512Kbit/s or 1G and
+// returns it in Kbit/s
+func ParseRate(rate string) (int, error) {
+	matches := rateRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(rate)))
+	if matches == nil {
+		return 0, fmt.Errorf("invalid bandwidth %q (use e.g. 512Kbit/s, 100Mbit/s or 1Gbit/s)", rate)
+	}
+
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth %q", rate)
+	}
+	multiplier := map[string]float64{"k": 1, "m": 1000, "g": 1000 * 1000}[matches[2]]
+	kbits := int(value * multiplier)
+	if kbits <= 0 {
+		return 0, fmt.Errorf("bandwidth %q must be positive", rate)
+	}
+	return kbits, nil
+}
+
+// ValidateShaping checks the link capacities, group names, devices and that
+// the guarantees fit within each link, as well as the caps. Groups may be
+// empty when device class policies fill them.
+func ValidateShaping(s Shaping) error {
+	errs := []error{validateCaps(s.Caps)}
+	if len(s.Groups) == 0 {
+		return errors.Join(errs...)
+	}
+
+	uplink, err := ParseRate(s.Uplink)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("uplink: %w", err))
+	}
+	downlink, err := ParseRate(s.Downlink)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("downlink: %w", err))
+	}
+
+	if len(s.Groups) > maxGroups {
+		errs = append(errs, fmt.Errorf("at most %d device groups are supported", maxGroups))
+	}
+
+	total := 0
+	seen := make(map[string]string) // group names by pf table
+	for _, group := range s.Groups {
+		table := groupTable(group)
+		if !groupNameRe.MatchString(group.Name) {
+			errs = append(errs, fmt.Errorf("invalid group name %q", group.Name))
+		} else if other, ok := seen[table]; ok && other == group.Name {
+			errs = append(errs, fmt.Errorf("group %q defined twice", group.Name))
+		} else if ok {
+			errs = append(errs, fmt.Errorf("groups %q and %q would share a pf table, rename one", other, group.Name))
+		}
+		seen[table] = group.Name
+
+		for _, device := range group.Devices {
+			errs = append(errs, ValidateDevice(device))
+		}
+
+		guarantee, err := ParseRate(group.Guarantee)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("group %q: %w", group.Name, err))
+		}
+		total += guarantee
+	}
+
+	if uplink > 0 && total > uplink {
+		errs = append(errs, fmt.Errorf("guarantees (%d Kbit/s) exceed the uplink (%d Kbit/s)", total, uplink))
+	}
+	if downlink > 0 && total > downlink {
+		errs = append(errs, fmt.Errorf("guarantees (%d Kbit/s) exceed the downlink (%d Kbit/s)", total, downlink))
+	}
+	return errors.Join(errs...)
+}
+
+// validateCaps checks cap names, devices and rates
+func validateCaps(caps []DeviceCap) error {
+	var errs []error
+	if len(caps) > maxCaps {
+		errs = append(errs, fmt.Errorf("at most %d bandwidth caps are supported", maxCaps))
+	}
+	seen := make(map[string]string) // cap names by pf table
+	for _, c := range caps {
+		table := capTable(c)
+		if !groupNameRe.MatchString(c.Name) {
+			errs = append(errs, fmt.Errorf("invalid cap name %q", c.Name))
+		} else if other, ok := seen[table]; ok && other == c.Name {
+			errs = append(errs, fmt.Errorf("cap %q defined twice", c.Name))
+		} else if ok {
+			errs = append(errs, fmt.Errorf("caps %q and %q would share a pf table, rename one", other, c.Name))
+		}
+		seen[table] = c.Name
+
+		for _, device := range c.Devices {
+			errs = append(errs, ValidateDevice(device))
+		}
+		if _, err := ParseRate(c.Rate); err != nil {
+			errs = append(errs, fmt.Errorf("cap %q: %w", c.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// queueWeights converts the group guarantees into dummynet weights (1-100)
+// for a link, followed by the weight of the default queue which gets the
+// unreserved share. Every queue gets at least 1, and as that can take the
+// total over 100 the largest weights give up the excess.
+func queueWeights(groups []DeviceGroup, link int) []int {
+	weights := make([]int, 0, len(groups)+1)
+	reserved := 0
+	for _, group := range groups {
+		guarantee, _ := ParseRate(group.Guarantee)
+		weight := max(1, min(100, guarantee*100/link))
+		weights = append(weights, weight)
+		reserved += weight
+	}
+	weights = append(weights, max(1, 100-reserved))
+
+	for total := reserved + weights[len(groups)]; total > 100; total-- {
+		largest := 0
+		for i, weight := range weights {
+			if weight > weights[largest] {
+				largest = i
+			}
+		}
+		weights[largest]--
+	}
+	return weights
+}
+
+// dummynetCommands returns the dnctl invocations creating the pipes and
+// queues for a validated shaping configuration
+func dummynetCommands(s Shaping) [][]string {
+	base := s.base()
+	commands := capCommands(s.Caps, base)
+	if len(s.Groups) == 0 {
+		return commands
+	}
+
+	uplink, _ := ParseRate(s.Uplink)
+	downlink, _ := ParseRate(s.Downlink)
+	commands = append(commands, [][]string{
+		{"pipe", strconv.Itoa(base + uplinkPipe), "config", "bw", fmt.Sprintf("%dKbit/s", uplink)},
+		{"pipe", strconv.Itoa(base + downlinkPipe), "config", "bw", fmt.Sprintf("%dKbit/s", downlink)},
+	}...)
+	for i, weight := range queueWeights(s.Groups, uplink) {
+		commands = append(commands, []string{"queue", strconv.Itoa(base + uplinkQueueOffset + i),
+			"config", "pipe", strconv.Itoa(base + uplinkPipe), "weight", strconv.Itoa(weight)})
+	}
+	for i, weight := range queueWeights(s.Groups, downlink) {
+		commands = append(commands, []string{"queue", strconv.Itoa(base + downlinkQueueOffset + i),
+			"config", "pipe", strconv.Itoa(base + downlinkPipe), "weight", strconv.Itoa(weight)})
+	}
+	return commands
+}
+
+// capCommands returns the dnctl invocations creating an uplink and a
+// downlink pipe at each cap's rate
+func capCommands(caps []DeviceCap, base int) [][]string {
+	var commands [][]string
+	for i, c := range caps {
+		rate, _ := ParseRate(c.Rate)
+		for pipe := capPipe(base, i); pipe <= capPipe(base, i)+1; pipe++ {
+			commands = append(commands, []string{"pipe", strconv.Itoa(pipe), "config", "bw", fmt.Sprintf("%dKbit/s", rate)})
+		}
+	}
+	return commands
+}
+
+// capPipe returns the uplink pipe of the i-th cap; its downlink pipe follows
+func capPipe(base, i int) int {
+	return base + capPipeOffset + 2*i
+}
+
+// dummynetDeletes returns the dnctl invocations removing every pipe and
+// queue an instance may have created
+func dummynetDeletes(base int) [][]string {
+	pipes := []string{"-q", "pipe", "delete", strconv.Itoa(base + uplinkPipe), strconv.Itoa(base + downlinkPipe)}
+	for i := 0; i < maxCaps; i++ {
+		pipes = append(pipes, strconv.Itoa(capPipe(base, i)), strconv.Itoa(capPipe(base, i)+1))
+	}
+	queues := []string{"-q", "queue", "delete"}
+	for i := 0; i <= maxGroups; i++ {
+		queues = append(queues, strconv.Itoa(base+uplinkQueueOffset+i), strconv.Itoa(base+downlinkQueueOffset+i))
+	}
+	return [][]string{queues, pipes}
+}
+
+// groupTable returns the pf table holding a group's device IPs
+func groupTable(group DeviceGroup) string {
+	return "nat_manager_group_" + strings.ReplaceAll(group.Name, "-", "_")
+}
+
+// capTable returns the pf table holding a cap's device IPs
+func capTable(c DeviceCap) string {
+	return "nat_manager_cap_" + strings.ReplaceAll(c.Name, "-", "_")
+}
+
+// deviceTable declares a table of device IPs, which persists while empty
+// so that rules referring to it still load
+func deviceTable(name string, devices []string, leases []Lease) string {
+	ips := deviceIPs(devices, leases)
+	if len(ips) == 0 {
+		return fmt.Sprintf("table <%s> persist\n", name)
+	}
+	return fmt.Sprintf("table <%s> { %s }\n", name, strings.Join(ips, " "))
+}
+
+// shapingTables renders the pf tables of the group and cap device IPs
+func shapingTables(cfg *Config, leases []Lease) string {
+	var b strings.Builder
+	for _, group := range cfg.Shaping.Groups {
+		b.WriteString(deviceTable(groupTable(group), group.Devices, leases))
+	}
+	for _, c := range cfg.Shaping.Caps {
+		b.WriteString(deviceTable(capTable(c), c.Devices, leases))
+	}
+	return b.String()
+}
+
+// shapingRules renders the dummynet rules sending traffic of the internal
+// network to the default queues, traffic of grouped devices to their
+// group's queues and traffic of capped devices through their cap's pipes.
+// pf uses the last matching rule, so group rules follow the default rule
+// and caps come last.
+func shapingRules(cfg *Config) string {
+	var b strings.Builder
+	iface, network := cfg.InternalInterface, cfg.InternalNetwork+".0/24"
+	up, down := cfg.Shaping.base()+uplinkQueueOffset, cfg.Shaping.base()+downlinkQueueOffset
+
+	if n := len(cfg.Shaping.Groups); n > 0 {
+		fmt.Fprintf(&b, "dummynet in on %s from %s to ! %s queue %d\n", iface, network, network, up+n)
+		fmt.Fprintf(&b, "dummynet out on %s from ! %s to %s queue %d\n", iface, network, network, down+n)
+	}
+	for i, group := range cfg.Shaping.Groups {
+		table := groupTable(group)
+		fmt.Fprintf(&b, "dummynet in on %s from <%s> to ! %s queue %d\n", iface, table, network, up+i)
+		fmt.Fprintf(&b, "dummynet out on %s from ! %s to <%s> queue %d\n", iface, network, table, down+i)
+	}
+	for i, c := range cfg.Shaping.Caps {
+		table, pipe := capTable(c), capPipe(cfg.Shaping.base(), i)
+		fmt.Fprintf(&b, "dummynet in on %s from <%s> to ! %s pipe %d\n", iface, table, network, pipe)
+		fmt.Fprintf(&b, "dummynet out on %s from ! %s to <%s> pipe %d\n", iface, network, table, pipe+1)
+	}
+	return b.String()
+}
+
+// configureShaping replaces this instance's dummynet pipes and queues with
+// those of s
+func (m *Manager) configureShaping(s Shaping) error {
+	if !s.Enabled() {
+		return nil
+	}
+	m.removeShaping()
+	for _, args := range dummynetCommands(s) {
+		if output, err := cmdCombinedOutput(exec.Command("dnctl", args...)); err != nil {
+			return fmt.Errorf("failed to configure dummynet %s: %w: %s",
+				strings.Join(args[:2], " "), err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+// removeShaping deletes this instance's dummynet pipes and queues
+func (m *Manager) removeShaping() {
+	for _, args := range dummynetDeletes(m.config.Shaping.base()) {
+		_ = runCmd(exec.Command("dnctl", args...))
+	}
+}
@@ -0,0 +1,321 @@
+package nat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Speed test defaults
+const (
+	DefaultDownloadURL = "https://speed.cloudflare.com/__down?bytes=1000000000"
+	DefaultUploadURL   = "https://speed.cloudflare.com/__up"
+	DefaultIperfPort   = 5201
+)
+
+// speedTolerance is how far a measured rate may exceed a configured one
+const speedTolerance = 1.10
+
+// iperf3Binary is the iperf3 server run for device tests, overridden in tests
+var iperf3Binary = "iperf3"
+
+// SpeedTestOptions configure a speed test
+type SpeedTestOptions struct {
+	DownloadURL string        // DefaultDownloadURL if empty
+	UploadURL   string        // DefaultUploadURL if empty
+	Duration    time.Duration // of each direction
+	Device      string        // internal client running iperf3, none if empty
+	Port        int           // iperf3 port, DefaultIperfPort if zero
+	Wait        time.Duration // how long to wait for the device to connect
+}
+
+// SpeedResult is the throughput measured in one direction
+type SpeedResult struct {
+	Name       string        `json:"name"`
+	Bytes      uint64        `json:"bytes"`
+	Duration   time.Duration `json:"duration_ns"`
+	BitsPerSec float64       `json:"bits_per_second"`
+	Expected   string        `json:"expected,omitempty"` // configured rate it is judged against
+	Passed     bool          `json:"passed"`
+	Detail     string        `json:"detail"`
+}
+
+// SpeedTest measures throughput from the host out the external interface
+// and, with a device, between that device and the host's external address,
+// which crosses the shaping rules of the internal interface. Results are
+// judged against the configured link capacities and device caps.
+func (m *Manager) SpeedTest(ctx context.Context, opts SpeedTestOptions) []SpeedResult {
+	if opts.DownloadURL == "" {
+		opts.DownloadURL = DefaultDownloadURL
+	}
+	if opts.UploadURL == "" {
+		opts.UploadURL = DefaultUploadURL
+	}
+	external := m.NetworkState().ExternalIP
+	client := speedClient(external)
+
+	results := []SpeedResult{
+		measure("download", func() (uint64, time.Duration, error) {
+			return download(ctx, client, opts.DownloadURL, opts.Duration)
+		}),
+		measure("upload", func() (uint64, time.Duration, error) {
+			return upload(ctx, client, opts.UploadURL, opts.Duration)
+		}),
+	}
+	if len(m.config.Shaping.Groups) > 0 {
+		judgeLink(&results[0], m.config.Shaping.Downlink)
+		judgeLink(&results[1], m.config.Shaping.Uplink)
+	}
+	if opts.Device == "" {
+		return results
+	}
+
+	result := m.deviceSpeed(ctx, external, opts)
+	if result.Passed {
+		leases, _ := m.GetLeases()
+		judgeCap(&result, deviceCap(m.config.Shaping.Caps, opts.Device, leases))
+	}
+	return append(results, result)
+}
+
+// measure runs a transfer and reports its throughput
+func measure(name string, transfer func() (uint64, time.Duration, error)) SpeedResult {
+	bytes, elapsed, err := transfer()
+	result := SpeedResult{Name: name, Bytes: bytes, Duration: elapsed, Passed: err == nil}
+	if err != nil {
+		result.Detail = err.Error()
+		return result
+	}
+	result.BitsPerSec = bitsPerSecond(bytes, elapsed)
+	result.Detail = FormatBitRate(result.BitsPerSec)
+	return result
+}
+
+// speedClient returns an HTTP client whose connections leave from the
+// address of the external interface, if known
+func speedClient(source string) *http.Client {
+	dialer := &net.Dialer{Timeout: connectivityTimeout}
+	if ip := net.ParseIP(source); ip != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Compression would measure the payload rather than the link
+	transport.DisableCompression = true
+	return &http.Client{Transport: transport}
+}
+
+// download reads url for up to duration and returns the bytes received
+func download(ctx context.Context, client *http.Client, url string, duration time.Duration) (uint64, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, fmt.Errorf("download failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return uint64(n), time.Since(started), fmt.Errorf("download failed: %w", err)
+	}
+	return uint64(n), time.Since(started), nil
+}
+
+// upload sends data to url for up to duration and returns the bytes sent
+func upload(ctx context.Context, client *http.Client, url string, duration time.Duration) (uint64, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, duration+2*connectivityTimeout)
+	defer cancel()
+	body := &timedReader{until: time.Now().Add(duration)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	started := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return body.n, time.Since(started), fmt.Errorf("upload failed: %w", err)
+	}
+	elapsed := time.Since(started)
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return body.n, elapsed, fmt.Errorf("upload failed: %s", resp.Status)
+	}
+	return body.n, elapsed, nil
+}
+
+// timedReader yields zeros until a deadline and counts them
+type timedReader struct {
+	until time.Time
+	n     uint64
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	if !time.Now().Before(r.until) {
+		return 0, io.EOF
+	}
+	clear(p)
+	r.n += uint64(len(p))
+	return len(p), nil
+}
+
+// deviceSpeed runs a one-off iperf3 server on the host's external address
+// and reports the test the device runs against it
+func (m *Manager) deviceSpeed(ctx context.Context, external string, opts SpeedTestOptions) SpeedResult {
+	result := SpeedResult{Name: "device " + opts.Device}
+	if external == "" {
+		result.Detail = fmt.Sprintf("%s has no address to test against", m.config.ExternalInterface)
+		return result
+	}
+	port := opts.Port
+	if port == 0 {
+		port = DefaultIperfPort
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Wait)
+	defer cancel()
+	output, err := cmdOutput(exec.CommandContext(ctx, iperf3Binary, "-s", "-1", "-J", "-B", external, "-p", strconv.Itoa(port)))
+	if err != nil && len(output) == 0 {
+		result.Detail = fmt.Sprintf("iperf3 server failed: %v", err)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			result.Detail = fmt.Sprintf("no iperf3 test from %s within %s", opts.Device, opts.Wait)
+		}
+		return result
+	}
+	return parseIperf(output, opts.Device)
+}
+
+// iperfReport is the part of iperf3's JSON output a speed test uses
+type iperfReport struct {
+	Start struct {
+		Connected []struct {
+			RemoteHost string `json:"remote_host"`
+		} `json:"connected"`
+		TestStart struct {
+			Reverse int `json:"reverse"`
+		} `json:"test_start"`
+	} `json:"start"`
+	End struct {
+		SumSent     iperfSum `json:"sum_sent"`
+		SumReceived iperfSum `json:"sum_received"`
+	} `json:"end"`
+	Error string `json:"error"`
+}
+
+type iperfSum struct {
+	Seconds       float64 `json:"seconds"`
+	Bytes         uint64  `json:"bytes"`
+	BitsPerSecond float64 `json:"bits_per_second"`
+}
+
+// parseIperf reads the JSON report of an iperf3 server. The device's
+// upload is what the server received; a reverse test is its download.
+func parseIperf(output []byte, device string) SpeedResult {
+	result := SpeedResult{Name: "device " + device + " upload"}
+	var report iperfReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		result.Detail = fmt.Sprintf("invalid iperf3 report: %v", err)
+		return result
+	}
+	if report.Error != "" {
+		result.Detail = "iperf3: " + report.Error
+		return result
+	}
+	if len(report.Start.Connected) > 0 && report.Start.Connected[0].RemoteHost != device {
+		result.Detail = fmt.Sprintf("test came from %s, not %s", report.Start.Connected[0].RemoteHost, device)
+		return result
+	}
+
+	sum := report.End.SumReceived
+	if report.Start.TestStart.Reverse != 0 {
+		result.Name, sum = "device "+device+" download", report.End.SumSent
+	}
+	result.Bytes, result.Duration = sum.Bytes, time.Duration(sum.Seconds*float64(time.Second))
+	result.BitsPerSec, result.Passed = sum.BitsPerSecond, true
+	result.Detail = FormatBitRate(sum.BitsPerSecond)
+	return result
+}
+
+// deviceCap returns the rate of the first cap covering ip, or "" if none
+func deviceCap(caps []DeviceCap, ip string, leases []Lease) string {
+	for _, c := range caps {
+		if slices.Contains(deviceIPs(c.Devices, leases), ip) {
+			return c.Rate
+		}
+	}
+	return ""
+}
+
+// judgeCap checks that a device stayed within its cap
+func judgeCap(result *SpeedResult, rate string) {
+	if rate == "" {
+		result.Detail += ", no cap configured"
+		return
+	}
+	kbits, err := ParseRate(rate)
+	if err != nil {
+		return
+	}
+	result.Expected = rate
+	if result.BitsPerSec > float64(kbits)*1000*speedTolerance {
+		result.Passed = false
+		result.Detail += fmt.Sprintf(", exceeds the cap of %s: shaping is not enforced", rate)
+		return
+	}
+	result.Detail += fmt.Sprintf(", within the cap of %s", rate)
+}
+
+// judgeLink checks a measurement of the uplink against the capacity the
+// bandwidth guarantees are computed from
+func judgeLink(result *SpeedResult, capacity string) {
+	kbits, err := ParseRate(capacity)
+	if !result.Passed || err != nil {
+		return
+	}
+	result.Expected = capacity
+	configured := float64(kbits) * 1000
+	switch {
+	case result.BitsPerSec > configured*speedTolerance:
+		result.Passed = false
+		result.Detail += fmt.Sprintf(", faster than the configured %s: guarantees assume too slow a link", capacity)
+	case result.BitsPerSec < configured/2:
+		result.Passed = false
+		result.Detail += fmt.Sprintf(", under half the configured %s: guarantees cannot be met", capacity)
+	default:
+		result.Detail += fmt.Sprintf(", matches the configured %s", capacity)
+	}
+}
+
+// bitsPerSecond returns the throughput of a transfer
+func bitsPerSecond(bytes uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / elapsed.Seconds()
+}
+
+// FormatBitRate renders a throughput such as "94.2 Mbit/s"
+func FormatBitRate(bps float64) string {
+	switch {
+	case bps >= 1e9:
+		return fmt.Sprintf("%.2f Gbit/s", bps/1e9)
+	case bps >= 1e6:
+		return fmt.Sprintf("%.1f Mbit/s", bps/1e6)
+	}
+	return fmt.Sprintf("%.0f Kbit/s", bps/1e3)
+}
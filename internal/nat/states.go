@@ -0,0 +1,181 @@
+package nat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// killedRe matches the summary pfctl prints after killing states
+var killedRe = regexp.MustCompile(`killed (\d+) states`)
+
+// parseStateSources returns the internal addresses with pf states, from the
+// output of "pfctl -s state". Translated states show the internal address in
+// parentheses after the translated one.
+func parseStateSources(r io.Reader, network string) []string {
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// ALL tcp 192.168.1.5:52345 (192.168.100.10:52345) -> 93.184.216.34:443  ESTABLISHED:ESTABLISHED
+		for _, field := range strings.Fields(scanner.Text()) {
+			host, _, err := net.SplitHostPort(strings.Trim(field, "()"))
+			if err != nil || !strings.HasPrefix(host, network+".") || host == network+".1" {
+				continue
+			}
+			seen[host] = true
+		}
+	}
+
+	sources := make([]string, 0, len(seen))
+	for source := range seen {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool { return ipLess(sources[i], sources[j]) })
+	return sources
+}
+
+// parseStateConnections returns the connections of the internal network
+// from the output of "pfctl -s state -v": a line per state, followed by
+// indented lines with its age and byte counts
+func parseStateConnections(r io.Reader, network string) []Connection {
+	connections := make([]Connection, 0)
+	var current *Connection
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if current != nil {
+				parseStateCounters(strings.TrimSpace(line), current)
+				current.Entry += "\n" + line
+			}
+			continue
+		}
+		current = nil
+		if conn, ok := parseStateLine(line, network); ok {
+			conn.Entry = line
+			connections = append(connections, conn)
+			current = &connections[len(connections)-1]
+		}
+	}
+	return connections
+}
+
+// parseStateLine parses a state such as
+//
+//	ALL tcp 192.168.1.5:52345 (192.168.100.10:52345) -> 93.184.216.34:443  ESTABLISHED:ESTABLISHED
+//
+// with the internal address in parentheses when translated. It reports
+// false for states outside the internal network.
+func parseStateLine(line, network string) (Connection, bool) {
+	fields := strings.Fields(line)
+	arrow := -1
+	for i, field := range fields {
+		if field == "->" || field == "<-" {
+			arrow = i
+			break
+		}
+	}
+	if arrow < 3 || arrow+1 >= len(fields) {
+		return Connection{}, false
+	}
+
+	conn := Connection{Protocol: strings.ToUpper(fields[1])}
+	local := fields[2]
+	if arrow > 3 {
+		local = strings.Trim(fields[3], "()")
+	}
+	if fields[arrow] == "->" {
+		conn.Source, conn.Destination = local, fields[arrow+1]
+		if arrow > 3 {
+			conn.Translated = fields[2]
+		}
+	} else {
+		conn.Source, conn.Destination = fields[arrow+1], fields[2]
+	}
+	if arrow+2 < len(fields) {
+		conn.State = fields[arrow+2]
+	}
+
+	src, _ := splitAddr(conn.Source)
+	dst, _ := splitAddr(conn.Destination)
+	if !strings.HasPrefix(src, network+".") && !strings.HasPrefix(dst, network+".") {
+		return Connection{}, false
+	}
+	return conn, true
+}
+
+// parseStateCounters reads the age, packet and byte counts from a detail line
+// such as "age 00:01:23, expires in 23:59:50, 10:8 pkts, 1234:5678 bytes"
+func parseStateCounters(line string, conn *Connection) {
+	for _, part := range strings.Split(line, ",") {
+		fields := strings.Fields(part)
+		switch {
+		case len(fields) == 2 && fields[0] == "age":
+			var h, m, s int
+			if _, err := fmt.Sscanf(fields[1], "%d:%d:%d", &h, &m, &s); err == nil {
+				conn.Age = time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+			}
+		case len(fields) == 2 && fields[1] == "bytes":
+			conn.Bytes = parseCounterPair(fields[0])
+		case len(fields) == 2 && fields[1] == "pkts":
+			conn.Packets = parseCounterPair(fields[0])
+		}
+	}
+}
+
+// parseCounterPair returns the sum of counters such as "1234:5678"
+func parseCounterPair(pair string) uint64 {
+	out, in, _ := strings.Cut(pair, ":")
+	a, _ := strconv.ParseUint(out, 10, 64)
+	b, _ := strconv.ParseUint(in, 10, 64)
+	return a + b
+}
+
+// NATConnections lists the pf states of the internal network with their
+// age and byte counts
+func (m *Manager) NATConnections() []Connection {
+	if m.config == nil {
+		return []Connection{}
+	}
+	output := commandOutput("pfctl", "-s", "state", "-v")
+	return parseStateConnections(strings.NewReader(output), m.config.InternalNetwork)
+}
+
+// StateCount returns the number of pf states of all interfaces, or -1 if
+// pf does not report it
+func (m *Manager) StateCount() int {
+	return parseStateEntries(commandOutput("pfctl", "-s", "info"))
+}
+
+// StateSources lists the internal addresses that have pf states
+func (m *Manager) StateSources() []string {
+	if m.config == nil {
+		return []string{}
+	}
+	output := commandOutput("pfctl", "-s", "state")
+	return parseStateSources(strings.NewReader(output), m.config.InternalNetwork)
+}
+
+// KillStates drops the pf states of connections from ip, cutting them off
+// until the device reconnects, and returns how many were dropped
+func (m *Manager) KillStates(ip string) (int, error) {
+	if net.ParseIP(ip).To4() == nil {
+		return 0, fmt.Errorf("%q is not an IPv4 address", ip)
+	}
+	output, err := cmdCombinedOutput(exec.Command("pfctl", "-k", ip))
+	if err != nil {
+		return 0, fmt.Errorf("failed to kill states of %s: %w: %s", ip, err, strings.TrimSpace(string(output)))
+	}
+	killed := 0
+	if match := killedRe.FindStringSubmatch(string(output)); match != nil {
+		killed, _ = strconv.Atoi(match[1])
+	}
+	return killed, nil
+}
@@ -0,0 +1,370 @@
+package nat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/logfile"
+)
+
+// Runtime files of a supervised server, named after the server and kept
+// next to the pidfile, e.g. dnsmasq.conf and dnsmasq-health.json
+const (
+	confSuffix   = ".conf"
+	logSuffix    = ".log"
+	healthSuffix = "-health.json"
+	pidSuffix    = "-server.pid"
+)
+
+// Server log rotation
+const (
+	serverLogSize    = 5 << 20
+	serverLogBackups = 3
+)
+
+// maxHealthEvents is how many recent exits the health record keeps
+const maxHealthEvents = 10
+
+// Restart backoff: the delay doubles on every crash up to restartMaxDelay
+// and is reset once a server stays up for stableRun
+var (
+	restartDelay    = time.Second
+	restartMaxDelay = time.Minute
+	stableRun       = time.Minute
+)
+
+// ServerHealth is the supervisor's record of a DHCP or DNS server
+type ServerHealth struct {
+	Server    string        `json:"server"`
+	PID       int           `json:"pid"` // 0 while the server is down
+	Started   time.Time     `json:"started"`
+	Restarts  int           `json:"restarts"`
+	LastError string        `json:"last_error,omitempty"`
+	LastExit  time.Time     `json:"last_exit,omitempty"`
+	Events    []ServerEvent `json:"events,omitempty"` // most recent exits, oldest first
+	Log       string        `json:"log"`
+}
+
+// ServerEvent records an exit of a server or of its supervisor
+type ServerEvent struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// recordExit notes an exit in the health record
+func (h *ServerHealth) recordExit(at time.Time, reason string) {
+	h.PID = 0
+	h.LastError = reason
+	h.LastExit = at
+	h.Events = append(h.Events, ServerEvent{Time: at, Error: reason})
+	if len(h.Events) > maxHealthEvents {
+		h.Events = h.Events[len(h.Events)-maxHealthEvents:]
+	}
+}
+
+// runtimePath returns the path of a runtime file of this instance
+func (m *Manager) runtimePath(name string) string {
+	dir := os.TempDir()
+	if m.config.PIDFile != "" {
+		dir = filepath.Dir(m.config.PIDFile)
+	}
+	return filepath.Join(dir, name)
+}
+
+// renderDnsmasqConf renders a dnsmasq.conf from option=value lines. dnsmasq
+// stays in the foreground and logs to stderr, which the supervisor captures.
+func renderDnsmasqConf(options []string, pidFile string) string {
+	var b strings.Builder
+	b.WriteString("# Generated by nat-manager, changes are overwritten on start\n")
+	b.WriteString("keep-in-foreground\n")
+	b.WriteString("log-facility=-\n")
+	b.WriteString("pid-file=" + pidFile + "\n")
+	for _, option := range options {
+		b.WriteString(option + "\n")
+	}
+	return b.String()
+}
+
+// writeServerConf renders a server's configuration into its runtime file
+func (m *Manager) writeServerConf(s Server, script string) error {
+	conf, err := s.Render(m, script)
+	if err != nil {
+		return err
+	}
+	path := m.runtimePath(s.Name() + confSuffix)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s config directory: %w", s.Name(), err)
+	}
+	if err := os.WriteFile(path, []byte(conf), 0644); err != nil {
+		return fmt.Errorf("failed to write %s config: %w", s.Name(), err)
+	}
+	return nil
+}
+
+// DHCPHealth returns the supervisor's last record of the DHCP server
+func (m *Manager) DHCPHealth() (*ServerHealth, error) {
+	return m.serverHealth(m.servers()[0].Name())
+}
+
+// DNSHealth returns the supervisor's last record of the DNS server when it
+// runs separately from the DHCP server
+func (m *Manager) DNSHealth() (*ServerHealth, error) {
+	servers := m.servers()
+	if len(servers) < 2 {
+		return nil, os.ErrNotExist
+	}
+	return m.serverHealth(servers[1].Name())
+}
+
+// ServerLogs returns the log file of each of this instance's DHCP and DNS
+// servers by server name
+func (m *Manager) ServerLogs() map[string]string {
+	logs := make(map[string]string)
+	for _, s := range m.servers() {
+		logs[s.Name()] = m.runtimePath(s.Name() + logSuffix)
+	}
+	return logs
+}
+
+// serverHealth reads the health record of the named server
+func (m *Manager) serverHealth(name string) (*ServerHealth, error) {
+	data, err := os.ReadFile(m.runtimePath(name + healthSuffix))
+	if err != nil {
+		return nil, err
+	}
+	var health ServerHealth
+	if err := json.Unmarshal(data, &health); err != nil {
+		return nil, fmt.Errorf("failed to parse %s health: %w", name, err)
+	}
+	return &health, nil
+}
+
+// writeHealth records a server's health for status
+func (m *Manager) writeHealth(health ServerHealth) {
+	data, err := json.MarshalIndent(health, "", "  ")
+	if err != nil {
+		return
+	}
+	path := m.runtimePath(health.Server + healthSuffix)
+	if err := os.WriteFile(path+".tmp", data, 0644); err == nil {
+		_ = os.Rename(path+".tmp", path)
+	}
+}
+
+// lastLine remembers the last non-empty line written to it
+type lastLine struct {
+	mu      sync.Mutex
+	partial []byte
+	line    string
+}
+
+func (l *lastLine) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(l.partial[:i])); line != "" {
+			l.line = line
+		}
+		l.partial = l.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+func (l *lastLine) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if line := strings.TrimSpace(string(l.partial)); line != "" {
+		return line
+	}
+	return l.line
+}
+
+// exitError describes why a server stopped, using its last output line
+func exitError(err error, output string) string {
+	reason := "exited"
+	if err != nil {
+		reason = err.Error()
+	}
+	if output == "" {
+		return reason
+	}
+	return output + " (" + reason + ")"
+}
+
+// SuperviseDHCP runs this instance's DHCP and DNS servers from their
+// generated configuration until ctx is done, restarting each with backoff
+// when it exits, and samples the traffic counters into the ledger
+func (m *Manager) SuperviseDHCP(ctx context.Context) error {
+	if m.config.DNSBackend == BackendCoreDNS && !m.config.EmbeddedDNS {
+		go m.maintainCoreDNSHosts(ctx)
+	}
+	go m.maintainAccounting(ctx)
+
+	servers := m.servers()
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.supervise(ctx, s)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// supervise runs a server until ctx is done, restarting it with backoff
+// when it exits. Its output goes to a rotating <server>.log and its health
+// to <server>-health.json.
+func (m *Manager) supervise(ctx context.Context, s Server) error {
+	logPath := m.runtimePath(s.Name() + logSuffix)
+	log, err := logfile.Open(logPath, serverLogSize, serverLogBackups)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = log.Close() }()
+
+	// Continue the record of a supervisor restarted by the watchdog
+	health := ServerHealth{}
+	if previous, err := m.serverHealth(s.Name()); err == nil {
+		health = *previous
+	}
+	health.Server, health.Log = s.Name(), logPath
+
+	// A server orphaned by a killed supervisor still holds its ports
+	if pid := readPIDFile(m.runtimePath(s.Name() + pidSuffix)); pid > 0 && isProcess(pid, m.processName(s)) {
+		_ = syscall.Kill(pid, syscall.SIGTERM)
+		time.Sleep(time.Second)
+	}
+
+	delay := restartDelay
+	for {
+		started, err := m.runServer(ctx, s, log, &health)
+		if ctx.Err() != nil {
+			health.PID = 0
+			m.writeHealth(health)
+			return nil
+		}
+
+		health.recordExit(time.Now(), err)
+		m.writeHealth(health)
+		_, _ = fmt.Fprintf(log, "nat-manager: %s stopped: %s, restarting in %s\n", s.Name(), err, delay)
+
+		if time.Since(started) >= stableRun {
+			delay = restartDelay
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, restartMaxDelay)
+		health.Restarts++
+	}
+}
+
+// runServer runs a server once and returns when it started and why it
+// exited
+func (m *Manager) runServer(ctx context.Context, s Server, log io.Writer, health *ServerHealth) (time.Time, string) {
+	tail := &lastLine{}
+	output := io.MultiWriter(log, tail)
+
+	cmd := s.Command(ctx, m)
+	cmd.Stdout, cmd.Stderr = output, output
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	cmd.WaitDelay = 5 * time.Second
+
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		return started, err.Error()
+	}
+	health.PID, health.Started = cmd.Process.Pid, started
+	m.writeHealth(*health)
+	_ = os.WriteFile(m.runtimePath(s.Name()+pidSuffix), []byte(strconv.Itoa(health.PID)+"\n"), 0644)
+
+	err := cmd.Wait()
+	return started, exitError(err, tail.String())
+}
+
+// processName returns the command name of a server's process: the
+// embedded forwarder runs as nat-manager itself
+func (m *Manager) processName(s Server) string {
+	if s.Name() == embeddedDNS {
+		return filepath.Base(m.config.Executable)
+	}
+	return s.Name()
+}
+
+// isProcess reports whether pid is a running process whose command name
+// contains name, so that a reused PID in a stale pidfile is never signalled
+func isProcess(pid int, name string) bool {
+	return processAlive(pid) && strings.Contains(commandOutput("ps", "-p", strconv.Itoa(pid), "-o", "comm="), name)
+}
+
+// CheckDHCP restarts the DHCP supervisor when it has died while this
+// instance's NAT rules are loaded. It reports whether it restarted it.
+func (m *Manager) CheckDHCP() (bool, error) {
+	if m.config == nil || m.config.PIDFile == "" || m.config.Executable == "" {
+		return false, nil
+	}
+	if pid := readPIDFile(m.config.PIDFile); pid <= 0 || processAlive(pid) {
+		return false, nil
+	}
+	if !m.RulesLoaded() {
+		return false, nil
+	}
+
+	if health, err := m.DHCPHealth(); err == nil {
+		health.recordExit(time.Now(), "DHCP supervisor exited")
+		health.Restarts++
+		m.writeHealth(*health)
+	}
+	if err := m.spawnDHCP(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchDHCP checks the DHCP supervisor every interval until ctx is done,
+// reporting restarts and failures
+func (m *Manager) WatchDHCP(ctx context.Context, interval time.Duration, report func(string)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			restarted, err := m.CheckDHCP()
+			if err != nil {
+				m.emit(event.DHCPFailed, map[string]string{"interface": m.config.InternalInterface, "error": err.Error()})
+				report(fmt.Sprintf("DHCP watchdog: %v", err))
+			} else if restarted {
+				audit.Event("dhcp restarted", m.config.InternalInterface)
+				m.emit(event.DHCPFailed, map[string]string{"interface": m.config.InternalInterface, "restarted": "true"})
+				report("DHCP supervisor had exited and was restarted")
+			}
+		}
+	}
+}
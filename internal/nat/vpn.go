@@ -0,0 +1,241 @@
+package nat
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/vmnet"
+)
+
+// HostConflict describes a host feature (iCloud Private Relay, a system VPN
+// profile, ...) that alters routing or DNS in a way that interacts with NAT
+type HostConflict struct {
+	Feature     string   `json:"feature"`
+	Detail      string   `json:"detail"`
+	Impact      string   `json:"impact"`
+	Mitigations []string `json:"mitigations"`
+}
+
+// hostNetworkState holds the raw command output used for conflict detection
+type hostNetworkState struct {
+	vpnList      string // scutil --nc list
+	routes       string // netstat -rn -f inet
+	dns          string // scutil --dns
+	privateRelay string // defaults read com.apple.networkserviceproxy
+	vmNetworks   []vmnet.HypervisorNetwork
+}
+
+var (
+	ncConnectedRe      = regexp.MustCompile(`^\*\s+\(Connected\)\s+\S+\s+.*"([^"]+)"`)
+	resolverIfRe       = regexp.MustCompile(`if_index\s*:\s*\d+\s*\((utun\d+|ipsec\d+|ppp\d+)\)`)
+	nameserverRe       = regexp.MustCompile(`nameserver\[\d+\]\s*:\s*(\S+)`)
+	privateRelayRe     = regexp.MustCompile(`(?i)PrivacyProxy\w*Status\w*"?\s*=\s*1\b`)
+	splitDefaultRoutes = []string{"0/1", "128.0/1", "0.0.0.0/1", "128.0.0.0/1"}
+)
+
+// DetectHostConflicts inspects the host for iCloud Private Relay and system
+// VPN profiles that change routing or DNS underneath the NAT
+func (m *Manager) DetectHostConflicts() []HostConflict {
+	state := hostNetworkState{
+		vpnList:      commandOutput("scutil", "--nc", "list"),
+		routes:       commandOutput("netstat", "-rn", "-f", "inet"),
+		dns:          commandOutput("scutil", "--dns"),
+		privateRelay: commandOutput("defaults", "read", "com.apple.networkserviceproxy"),
+	}
+	state.vmNetworks, _ = vmnet.HypervisorNetworks()
+	return detectHostConflicts(state, m.config)
+}
+
+// detectHostConflicts evaluates the collected host state against the NAT config
+func detectHostConflicts(state hostNetworkState, cfg *Config) []HostConflict {
+	conflicts := make([]HostConflict, 0)
+
+	subnet := "the internal subnet"
+	external := "the external interface"
+	if cfg != nil {
+		if cfg.InternalNetwork != "" {
+			subnet = cfg.InternalNetwork + ".0/24"
+		}
+		if cfg.ExternalInterface != "" {
+			external = cfg.ExternalInterface
+		}
+	}
+
+	if privateRelayRe.MatchString(state.privateRelay) {
+		conflicts = append(conflicts, HostConflict{
+			Feature: "iCloud Private Relay",
+			Detail:  "Private Relay is enabled for this Mac",
+			Impact: "Only the host's own Safari and DNS traffic is relayed; NAT clients egress directly via " +
+				external + " and can see different DNS answers than the host",
+			Mitigations: []string{
+				"Set explicit DNS servers for clients (--dns) so their resolution does not depend on the host resolver",
+				"Turn off 'Limit IP address tracking' for the upstream network if host and client results must match",
+			},
+		})
+	}
+
+	vpnNames := parseConnectedVPNs(state.vpnList)
+	tunnel := vpnDefaultRouteInterface(state.routes)
+	if len(vpnNames) > 0 || tunnel != "" {
+		conflicts = append(conflicts, vpnConflict(vpnNames, tunnel, subnet, external))
+	}
+
+	if iface, servers := vpnScopedResolvers(state.dns); iface != "" {
+		conflicts = append(conflicts, HostConflict{
+			Feature: "VPN DNS",
+			Detail:  fmt.Sprintf("Resolvers %s are scoped to %s", strings.Join(servers, ", "), iface),
+			Impact:  "Internal names published by the VPN will not resolve for NAT clients using public DNS servers",
+			Mitigations: []string{
+				fmt.Sprintf("Point client DNS at the VPN resolver (--dns %s) if clients need VPN-internal names", servers[0]),
+			},
+		})
+	}
+
+	if cfg != nil {
+		for _, network := range state.vmNetworks {
+			if network.Bridge != cfg.InternalInterface && network.Overlaps(cfg.InternalNetwork) {
+				conflicts = append(conflicts, vmNetworkConflict(network, subnet))
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// vmNetworkConflict builds the conflict entry for a hypervisor network using
+// the internal subnet
+func vmNetworkConflict(network vmnet.HypervisorNetwork, subnet string) HostConflict {
+	name := network.Bridge
+	if network.Name != "" {
+		name = network.Name + " on " + network.Bridge
+	}
+	conflict := HostConflict{
+		Feature: network.Hypervisor + " network",
+		Detail:  fmt.Sprintf("%s (%s) uses %s", name, network.Hypervisor, network.Subnet),
+		Impact: "The VMs and NAT clients get addresses from the same range and the host routes " +
+			subnet + " to only one of the bridges",
+		Mitigations: []string{
+			"Use another internal network, e.g. --network 192.168.150",
+		},
+	}
+	switch network.Hypervisor {
+	case vmnet.HypervisorFusion:
+		conflict.Mitigations = append(conflict.Mitigations,
+			fmt.Sprintf("Change the subnet of %s in VMware Fusion > Settings > Network", name))
+	case vmnet.HypervisorParallels:
+		conflict.Mitigations = append(conflict.Mitigations,
+			fmt.Sprintf("Change the range of %s in Parallels Desktop > Settings > Network", name))
+	default:
+		conflict.Mitigations = append(conflict.Mitigations,
+			"Change the vmnet shared network: sudo defaults write /Library/Preferences/SystemConfiguration/com.apple.vmnet Shared_Net_Address -string 192.168.65.1")
+	}
+	conflict.Mitigations = append(conflict.Mitigations,
+		fmt.Sprintf("Or put the VMs on the internal network with --attach-vm-network %s", network.Bridge))
+	return conflict
+}
+
+// vpnConflict builds the conflict entry for an active system VPN
+func vpnConflict(names []string, tunnel, subnet, external string) HostConflict {
+	detail := "A system VPN profile is connected"
+	if len(names) > 0 {
+		detail = fmt.Sprintf("VPN profile %s is connected", strings.Join(names, ", "))
+	}
+
+	conflict := HostConflict{
+		Feature: "System VPN",
+		Detail:  detail,
+		Impact:  "Split-tunnel VPN: NAT clients egress via " + external + " outside the tunnel",
+		Mitigations: []string{
+			"Exclude " + subnet + " from the VPN profile if the VPN client supports excluded routes",
+		},
+	}
+
+	if tunnel != "" {
+		conflict.Detail += fmt.Sprintf(" and owns the default route via %s", tunnel)
+		conflict.Impact = "Full-tunnel VPN: traffic translated on " + external +
+			" may be routed into the tunnel or dropped by the VPN's kill switch"
+		conflict.Mitigations = append(conflict.Mitigations,
+			fmt.Sprintf("Use the tunnel as the external interface (--external %s) to send client traffic through the VPN", tunnel),
+			"Enable split tunneling so "+external+" keeps a direct default route")
+	}
+
+	return conflict
+}
+
+// parseConnectedVPNs returns the names of connected profiles in `scutil --nc list` output
+func parseConnectedVPNs(output string) []string {
+	var names []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if matches := ncConnectedRe.FindStringSubmatch(strings.TrimSpace(scanner.Text())); len(matches) == 2 {
+			names = append(names, matches[1])
+		}
+	}
+	return names
+}
+
+// vpnDefaultRouteInterface returns the tunnel interface holding the default
+// route (or the 0/1 + 128.0/1 split default used by most VPN clients)
+func vpnDefaultRouteInterface(output string) string {
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		if fields[0] != "default" && !containsString(splitDefaultRoutes, fields[0]) {
+			continue
+		}
+		for _, field := range fields[3:] {
+			if isTunnelInterface(field) {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// vpnScopedResolvers returns the first tunnel interface with scoped DNS
+// resolvers in `scutil --dns` output, along with its nameservers
+func vpnScopedResolvers(output string) (string, []string) {
+	for _, block := range strings.Split(output, "resolver #") {
+		matches := resolverIfRe.FindStringSubmatch(block)
+		if len(matches) != 2 {
+			continue
+		}
+		var servers []string
+		for _, ns := range nameserverRe.FindAllStringSubmatch(block, -1) {
+			servers = append(servers, ns[1])
+		}
+		if len(servers) > 0 {
+			return matches[1], servers
+		}
+	}
+	return "", nil
+}
+
+// isTunnelInterface reports whether the interface name belongs to a VPN tunnel
+func isTunnelInterface(name string) bool {
+	return strings.HasPrefix(name, "utun") || strings.HasPrefix(name, "ipsec") || strings.HasPrefix(name, "ppp")
+}
+
+// commandOutput runs a command and returns its output, or "" on failure
+func commandOutput(name string, args ...string) string {
+	output, err := cmdOutput(exec.Command(name, args...))
+	if err != nil {
+		return ""
+	}
+	return string(output)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
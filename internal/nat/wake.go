@@ -0,0 +1,42 @@
+package nat
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+)
+
+// wakePort is the UDP port magic packets are sent to
+const wakePort = 9
+
+// MagicPacket returns the Wake-on-LAN packet of a MAC address: six 0xff
+// bytes followed by the address sixteen times
+func MagicPacket(mac string) ([]byte, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return nil, fmt.Errorf("invalid MAC address %q", mac)
+	}
+	packet := bytes.Repeat([]byte{0xff}, 6)
+	return append(packet, bytes.Repeat(hw, 16)...), nil
+}
+
+// Wake sends a Wake-on-LAN magic packet for mac to the broadcast address
+// of the internal network
+func (m *Manager) Wake(mac string) error {
+	packet, err := MagicPacket(mac)
+	if err != nil {
+		return err
+	}
+	if err := validateNetwork(m.config.InternalNetwork); err != nil {
+		return err
+	}
+	conn, err := net.Dial("udp4", fmt.Sprintf("%s.255:%d", m.config.InternalNetwork, wakePort))
+	if err != nil {
+		return fmt.Errorf("failed to wake %s: %w", mac, err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write(packet); err != nil {
+		return fmt.Errorf("failed to wake %s: %w", mac, err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package nat
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// WANHealth is the state of the uplink: its address, the default route and
+// whether the router of the default route answers
+type WANHealth struct {
+	NetworkState
+	Gateway   string        // router of the default route
+	Reachable bool          // the gateway answered a ping
+	Latency   time.Duration // round trip to the gateway, when known
+	Checked   time.Time
+}
+
+// WANHealth reads the uplink's address and default route and pings the
+// default gateway
+func (m *Manager) WANHealth(ctx context.Context) WANHealth {
+	route := commandOutput("route", "-n", "get", "default")
+	health := WANHealth{NetworkState: m.networkState(route), Gateway: defaultGateway(route), Checked: time.Now()}
+	if health.Gateway == "" {
+		return health
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, connectivityTimeout)
+	defer cancel()
+	output, err := cmdCombinedOutput(exec.CommandContext(ctx, "ping", "-c", "1", "-t", "2", health.Gateway))
+	if err == nil {
+		health.Reachable = true
+		health.Latency, _ = pingTime(string(output))
+	}
+	return health
+}
@@ -0,0 +1,40 @@
+package nat
+
+import "fmt"
+
+// WireGuard lets the peers of the WireGuard endpoint reach the internal
+// network, and the internet through the external interface
+type WireGuard struct {
+	Enabled bool
+	Network string // /24 prefix of the peers, e.g. 10.8.0
+	Port    int    // UDP port of the endpoint
+}
+
+// ValidateWireGuard checks the peers' network, which must not overlap the
+// internal network, and the endpoint port
+func ValidateWireGuard(w WireGuard, internalNetwork string) error {
+	if err := validateNetwork(w.Network); err != nil {
+		return fmt.Errorf("invalid WireGuard network %q", w.Network)
+	}
+	if w.Network == internalNetwork {
+		return fmt.Errorf("WireGuard network %s.0/24 is the internal network", w.Network)
+	}
+	if w.Port < 1 || w.Port > 65535 {
+		return fmt.Errorf("WireGuard port must be 1-65535")
+	}
+	return nil
+}
+
+// wireGuardNAT translates what the peers send out of the external
+// interface, for peers routing all their traffic through the tunnel
+func wireGuardNAT(cfg *Config) string {
+	return fmt.Sprintf("nat on %s from %s.0/24 to any -> (%s)\n",
+		cfg.ExternalInterface, cfg.WireGuard.Network, cfg.ExternalInterface)
+}
+
+// wireGuardRules let the peers' handshakes and tunnelled packets in on the
+// external interface
+func wireGuardRules(cfg *Config) string {
+	return fmt.Sprintf("pass in quick on %s proto udp from any to (%s) port %d\n",
+		cfg.ExternalInterface, cfg.ExternalInterface, cfg.WireGuard.Port)
+}
@@ -0,0 +1,180 @@
+// Package notify shows events of an instance as macOS Notification Center
+// alerts
+package notify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Alerts that can be turned on
+const (
+	UnknownDevice = "unknown_device" // a device never seen before joined
+	WANDown       = "wan_down"       // the uplink lost its address
+	QuotaExceeded = "quota_exceeded" // traffic reached the quota
+	NATStopped    = "nat_stopped"    // NAT stopped without being asked to
+)
+
+// Alerts lists every alert
+var Alerts = []string{UnknownDevice, WANDown, QuotaExceeded, NATStopped}
+
+// title heads every notification
+const title = "NAT Manager"
+
+// Notification is an alert shown in Notification Center
+type Notification struct {
+	Title    string
+	Subtitle string
+	Message  string
+}
+
+// Alert returns the alert e raises and its notification, if any
+func Alert(e event.Event) (string, Notification, bool) {
+	n := Notification{Title: title}
+	if e.Instance != "" && e.Instance != nat.DefaultInstance {
+		n.Title += " (" + e.Instance + ")"
+	}
+	switch {
+	case e.Type == event.DeviceJoined && e.Data["known"] == "false":
+		name := e.Data["hostname"]
+		if name == "" {
+			name = e.Data["mac"]
+		}
+		n.Subtitle = "Unknown device joined"
+		n.Message = fmt.Sprintf("%s got %s", name, e.Data["ip"])
+		return UnknownDevice, n, true
+	case e.Type == event.WANDown:
+		n.Subtitle = "Uplink down"
+		n.Message = fmt.Sprintf("%s lost its address %s", e.Data["interface"], e.Data["previous_ip"])
+		return WANDown, n, true
+	case e.Type == event.QuotaExceeded:
+		used, _ := strconv.ParseUint(e.Data["bytes"], 10, 64)
+		quota, _ := strconv.ParseUint(e.Data["quota"], 10, 64)
+		n.Subtitle = "Traffic quota exceeded"
+		n.Message = fmt.Sprintf("%s used of %s", formatBytes(used), formatBytes(quota))
+		return QuotaExceeded, n, true
+	case e.Type == event.NATStopped && e.Data["unexpected"] == "true":
+		n.Subtitle = "NAT stopped unexpectedly"
+		n.Message = fmt.Sprintf("Sharing %s through %s stopped: %s", e.Data["external"], e.Data["internal"], e.Data["reason"])
+		return NATStopped, n, true
+	}
+	return "", Notification{}, false
+}
+
+// Notifier shows the events of the alerts turned on in the background. It
+// is an event.Sink.
+type Notifier struct {
+	alerts  []string
+	show    func(Notification) error
+	onError func(error)
+	wg      sync.WaitGroup
+}
+
+var _ event.Sink = (*Notifier)(nil)
+
+// New returns a notifier of alerts. onError, when set, is told about
+// notifications that could not be shown.
+func New(alerts []string, onError func(error)) *Notifier {
+	return &Notifier{alerts: alerts, show: Show, onError: onError}
+}
+
+// Send shows e in the background if it raises an alert turned on
+func (n *Notifier) Send(e event.Event) {
+	alert, notification, ok := Alert(e)
+	if !ok || !slices.Contains(n.alerts, alert) {
+		return
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		if err := n.show(notification); err != nil && n.onError != nil {
+			n.onError(err)
+		}
+	}()
+}
+
+// Close waits until the notifications in progress are shown or ctx is
+// done
+func (n *Notifier) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notifications still pending: %w", ctx.Err())
+	}
+}
+
+// Show shows n with osascript. Run as root, as by the daemon, it is shown
+// in the session of the user logged in at the console.
+func Show(n Notification) error {
+	args := []string{"osascript", "-e", script(n)}
+	if os.Geteuid() == 0 {
+		if u, ok := consoleUser(); ok {
+			args = append([]string{"launchctl", "asuser", u.Uid, "sudo", "-u", u.Username}, args...)
+		}
+	}
+	if output, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to show notification: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// consoleUser returns the user logged in at the console, other than root
+func consoleUser() (*user.User, bool) {
+	info, err := os.Stat("/dev/console")
+	if err != nil {
+		return nil, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Uid == 0 {
+		return nil, false
+	}
+	u, err := user.LookupId(strconv.FormatUint(uint64(stat.Uid), 10))
+	if err != nil {
+		return nil, false
+	}
+	return u, true
+}
+
+// script returns the AppleScript showing n
+func script(n Notification) string {
+	s := fmt.Sprintf("display notification %s with title %s", quote(n.Message), quote(n.Title))
+	if n.Subtitle != "" {
+		s += " subtitle " + quote(n.Subtitle)
+	}
+	return s
+}
+
+// quote returns s as an AppleScript string literal
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+)
+
+func TestAlert(t *testing.T) {
+	testCases := []struct {
+		name    string
+		event   event.Event
+		alert   string
+		message string
+	}{
+		{"unknown device", event.Event{Type: event.DeviceJoined, Data: map[string]string{"mac": "aa:bb:cc:dd:ee:ff", "ip": "192.168.100.50", "known": "false"}},
+			UnknownDevice, "aa:bb:cc:dd:ee:ff got 192.168.100.50"},
+		{"known device", event.Event{Type: event.DeviceJoined, Data: map[string]string{"mac": "aa:bb:cc:dd:ee:ff", "known": "true"}}, "", ""},
+		{"wan down", event.Event{Type: event.WANDown, Data: map[string]string{"interface": "en0", "previous_ip": "10.0.0.5"}},
+			WANDown, "en0 lost its address 10.0.0.5"},
+		{"quota", event.Event{Type: event.QuotaExceeded, Data: map[string]string{"bytes": "53687091200", "quota": "53687091200"}},
+			QuotaExceeded, "50.0 GB used of 50.0 GB"},
+		{"stopped unexpectedly", event.Event{Type: event.NATStopped, Data: map[string]string{"external": "en0", "internal": "bridge100", "unexpected": "true", "reason": "rules missing"}},
+			NATStopped, "Sharing en0 through bridge100 stopped: rules missing"},
+		{"stopped", event.Event{Type: event.NATStopped, Data: map[string]string{"external": "en0"}}, "", ""},
+		{"wan up", event.Event{Type: event.WANUp}, "", ""},
+	}
+	for _, tc := range testCases {
+		alert, n, ok := Alert(tc.event)
+		if ok != (tc.alert != "") || alert != tc.alert || n.Message != tc.message {
+			t.Errorf("%s: Alert = %q, %+v, %t", tc.name, alert, n, ok)
+		}
+	}
+
+	if _, n, _ := Alert(event.Event{Type: event.WANDown, Instance: "lab"}); n.Title != "NAT Manager (lab)" {
+		t.Errorf("Title = %q", n.Title)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var shown []Notification
+	n := New([]string{WANDown}, nil)
+	n.show = func(notification Notification) error {
+		mu.Lock()
+		defer mu.Unlock()
+		shown = append(shown, notification)
+		return nil
+	}
+
+	n.Send(event.Event{Type: event.WANDown, Data: map[string]string{"interface": "en0"}})
+	n.Send(event.Event{Type: event.QuotaExceeded, Data: map[string]string{"bytes": "1", "quota": "1"}})
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(shown) != 1 || shown[0].Subtitle != "Uplink down" {
+		t.Errorf("Expected only the uplink alert, got %+v", shown)
+	}
+}
+
+func TestScript(t *testing.T) {
+	got := script(Notification{Title: "NAT Manager", Subtitle: "Unknown device joined", Message: `Bob's "phone" \o/`})
+	want := `display notification "Bob's \"phone\" \\o/" with title "NAT Manager" subtitle "Unknown device joined"`
+	if got != want {
+		t.Errorf("script = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,242 @@
+// Package portal serves the captive portal that new devices on the internal
+// network must click through, or enter a passphrase on, before they are
+// granted internet access
+package portal
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+)
+
+// DefaultPort is the gateway port the portal listens on
+const DefaultPort = 8880
+
+// Passphrase lockout: after freeAttempts wrong passphrases a device must
+// wait lockoutDelay before its next attempt, doubled for every further
+// wrong one up to lockoutMaxDelay. Failures are forgotten after
+// failureMemory without an attempt.
+const (
+	freeAttempts    = 5
+	lockoutDelay    = 30 * time.Second
+	lockoutMaxDelay = 15 * time.Minute
+	failureMemory   = time.Hour
+)
+
+// Config configures the portal
+type Config struct {
+	Listen     string        // gateway host:port
+	Title      string        // page heading
+	Message    string        // terms shown above the accept button
+	Passphrase string        // required to accept when set
+	Duration   time.Duration // how long access lasts, 0 until revoked
+
+	// Admit grants a device internet access
+	Admit func(Admission) error
+
+	// Audit records every accept attempt when set
+	Audit *audit.Log
+}
+
+// page is the acceptance page and its outcome
+type page struct {
+	Title      string
+	Message    string
+	Passphrase bool
+	Error      string
+	Admitted   bool
+	Expires    time.Time
+}
+
+var pageTemplate = template.Must(template.New("portal").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, sans-serif; max-width: 32em; margin: 3em auto; padding: 0 1em; }
+.error { color: #b00020; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Admitted}}
+<p>You are connected.{{if not .Expires.IsZero}} Access lasts until {{.Expires.Format "Jan 2 15:04"}}.{{end}}</p>
+{{else}}
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/accept">
+{{if .Passphrase}}<p><label>Passphrase <input type="password" name="passphrase" autofocus></label></p>{{end}}
+<p><button type="submit">Accept and connect</button></p>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// failures counts the wrong passphrases of a device
+type failures struct {
+	count  int
+	last   time.Time // last wrong passphrase
+	locked time.Time // no attempts are checked before this
+}
+
+// Server is the captive portal web server
+type Server struct {
+	config Config
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]*failures // by client IP
+}
+
+// New creates a portal server
+func New(cfg Config) *Server {
+	if cfg.Title == "" {
+		cfg.Title = "Welcome"
+	}
+	return &Server{config: cfg, now: time.Now, failures: make(map[string]*failures)}
+}
+
+// Handler answers every path with the acceptance page, which makes the
+// captive network detection of macOS, iOS, Android and Windows show it,
+// and admits devices posting to /accept
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /accept", s.accept)
+	mux.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
+		s.render(w, http.StatusOK, page{})
+	})
+	return mux
+}
+
+// accept checks the passphrase and admits the requesting device
+func (s *Server) accept(w http.ResponseWriter, r *http.Request) {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	now := s.now()
+	if s.config.Passphrase != "" {
+		if wait := s.lockedFor(ip, now); wait > 0 {
+			s.record(ip, "denied", "locked out")
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+			s.render(w, http.StatusTooManyRequests, page{Error: fmt.Sprintf("Too many wrong passphrases, please try again in %s.", wait.Round(time.Second))})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.PostFormValue("passphrase")), []byte(s.config.Passphrase)) != 1 {
+			s.fail(ip, now)
+			s.record(ip, "denied", "wrong passphrase")
+			s.render(w, http.StatusForbidden, page{Error: "Wrong passphrase, please try again."})
+			return
+		}
+		s.mu.Lock()
+		delete(s.failures, ip)
+		s.mu.Unlock()
+	}
+
+	admission := Admission{IP: ip, Admitted: now}
+	if s.config.Duration > 0 {
+		admission.Expires = now.Add(s.config.Duration)
+	}
+	if err := s.config.Admit(admission); err != nil {
+		s.record(ip, "failed", err.Error())
+		s.render(w, http.StatusInternalServerError, page{Error: "Access could not be granted, please ask the network owner."})
+		return
+	}
+
+	s.record(ip, "granted", r.UserAgent())
+	s.render(w, http.StatusOK, page{Admitted: true, Expires: admission.Expires})
+}
+
+// lockedFor returns how long ip must wait before its passphrase is checked
+// again
+func (s *Server) lockedFor(ip string, now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.failures[ip]; ok && now.Before(f.locked) {
+		return f.locked.Sub(now)
+	}
+	return 0
+}
+
+// fail counts a wrong passphrase of ip, locking it out once it used up its
+// free attempts, and forgets devices that stopped trying
+func (s *Server) fail(ip string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for other, f := range s.failures {
+		if now.Sub(f.last) > failureMemory {
+			delete(s.failures, other)
+		}
+	}
+
+	f, ok := s.failures[ip]
+	if !ok {
+		f = &failures{}
+		s.failures[ip] = f
+	}
+	f.count++
+	f.last = now
+	if excess := f.count - freeAttempts; excess > 0 {
+		delay := lockoutDelay << min(excess-1, 10)
+		f.locked = now.Add(min(delay, lockoutMaxDelay))
+	}
+}
+
+func (s *Server) record(ip, result, detail string) {
+	_ = s.config.Audit.Record(audit.Entry{
+		Source: audit.SourcePortal,
+		Actor:  ip,
+		Action: "redeem",
+		Result: result,
+		Detail: detail,
+	})
+}
+
+func (s *Server) render(w http.ResponseWriter, status int, p page) {
+	p.Title = s.config.Title
+	p.Message = s.config.Message
+	p.Passphrase = s.config.Passphrase != ""
+
+	// Never let a detection probe cache the portal as the real answer
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = pageTemplate.Execute(w, p)
+}
+
+// ListenAndServe serves the portal until ctx is cancelled
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.config.Listen, err)
+	}
+
+	server := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package portal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+)
+
+func TestStore(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "portal.json"))
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	admissions := []Admission{
+		{IP: "192.168.100.51", Admitted: now, Expires: now.Add(time.Hour)},
+		{IP: "192.168.100.50", Admitted: now},
+		{IP: "192.168.100.51", MAC: "aa:bb:cc:dd:ee:ff", Admitted: now, Expires: now.Add(2 * time.Hour)},
+	}
+	for _, a := range admissions {
+		if err := store.Add(a); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	list, err := store.List()
+	if err != nil || len(list) != 2 || list[0].IP != "192.168.100.50" || list[1].MAC != "aa:bb:cc:dd:ee:ff" {
+		t.Fatalf("List = %+v, %v; expected the later admission to replace the earlier", list, err)
+	}
+
+	expired, err := store.Expire(now.Add(2 * time.Hour))
+	if err != nil || len(expired) != 1 || expired[0].IP != "192.168.100.51" {
+		t.Errorf("Expire = %+v, %v", expired, err)
+	}
+	if removed, err := store.Remove("192.168.100.50"); !removed || err != nil {
+		t.Errorf("Remove = %v, %v", removed, err)
+	}
+	if removed, _ := store.Remove("192.168.100.50"); removed {
+		t.Error("Removing twice should report nothing removed")
+	}
+	if list, _ := store.List(); len(list) != 0 {
+		t.Errorf("Expected no admissions left, got %+v", list)
+	}
+}
+
+func TestPortalAccept(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	auditLog, err := audit.Open(logPath, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = auditLog.Close() }()
+
+	var admitted []Admission
+	server := New(Config{
+		Title:      "Lab Network",
+		Message:    "Be nice.",
+		Passphrase: "open sesame",
+		Duration:   time.Hour,
+		Audit:      auditLog,
+		Admit: func(a Admission) error {
+			admitted = append(admitted, a)
+			return nil
+		},
+	})
+	handler := server.Handler()
+
+	// Any page, e.g. a captive network probe, shows the portal
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hotspot-detect.html", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Lab Network") || !strings.Contains(rec.Body.String(), `name="passphrase"`) {
+		t.Errorf("Unexpected portal page %d:\n%s", rec.Code, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		passphrase string
+		code       int
+	}{
+		{"guess", http.StatusForbidden},
+		{"open sesame", http.StatusOK},
+	} {
+		form := url.Values{"passphrase": {tc.passphrase}}
+		req := httptest.NewRequest(http.MethodPost, "/accept", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "192.168.100.50:51234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Errorf("Passphrase %q: status %d, expected %d", tc.passphrase, rec.Code, tc.code)
+		}
+	}
+
+	if len(admitted) != 1 || admitted[0].IP != "192.168.100.50" || admitted[0].Expires.Sub(admitted[0].Admitted) != time.Hour {
+		t.Errorf("Unexpected admissions %+v", admitted)
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	entries, err := audit.Read(file, audit.Query{Source: audit.SourcePortal})
+	if err != nil || len(entries) != 2 || entries[0].Result != "denied" || entries[1].Result != "granted" {
+		t.Errorf("Unexpected audit entries %+v, %v", entries, err)
+	}
+}
+
+func TestPortalLockout(t *testing.T) {
+	server := New(Config{
+		Passphrase: "open sesame",
+		Admit:      func(Admission) error { return nil },
+	})
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	handler := server.Handler()
+
+	try := func(ip, passphrase string) *httptest.ResponseRecorder {
+		form := url.Values{"passphrase": {passphrase}}
+		req := httptest.NewRequest(http.MethodPost, "/accept", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = ip + ":51234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for i := 0; i < freeAttempts; i++ {
+		if rec := try("192.168.100.50", "guess"); rec.Code != http.StatusForbidden {
+			t.Fatalf("Attempt %d: status %d, expected %d", i+1, rec.Code, http.StatusForbidden)
+		}
+	}
+	// the attempt after the free ones still fails and starts the lockout
+	if rec := try("192.168.100.50", "guess"); rec.Code != http.StatusForbidden {
+		t.Fatalf("Status %d, expected %d", rec.Code, http.StatusForbidden)
+	}
+	rec := try("192.168.100.50", "open sesame")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "30" {
+		t.Errorf("Locked out device: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := try("192.168.100.51", "open sesame"); rec.Code != http.StatusOK {
+		t.Errorf("Other devices should not be locked out, got %d", rec.Code)
+	}
+
+	// every further wrong passphrase doubles the wait
+	now = now.Add(lockoutDelay)
+	try("192.168.100.50", "guess")
+	if rec := try("192.168.100.50", "open sesame"); rec.Header().Get("Retry-After") != "60" {
+		t.Errorf("Retry-After %q, expected the lockout to double", rec.Header().Get("Retry-After"))
+	}
+
+	now = now.Add(2 * lockoutDelay)
+	if rec := try("192.168.100.50", "open sesame"); rec.Code != http.StatusOK {
+		t.Errorf("Status %d after the lockout, expected %d", rec.Code, http.StatusOK)
+	}
+	if rec := try("192.168.100.50", "guess"); rec.Code != http.StatusForbidden {
+		t.Errorf("A correct passphrase should reset the failures, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,137 @@
+package portal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Admission is a device granted internet access through the portal
+type Admission struct {
+	IP       string    `json:"ip"`
+	MAC      string    `json:"mac,omitempty"`
+	Admitted time.Time `json:"admitted"`
+	Expires  time.Time `json:"expires,omitempty"` // zero until revoked
+}
+
+// Expired reports whether the admission has run out at now
+func (a Admission) Expired(now time.Time) bool {
+	return !a.Expires.IsZero() && !now.Before(a.Expires)
+}
+
+// Store keeps the admitted devices in a JSON file so that they survive
+// restarts and rule reloads
+type Store struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewStore returns the store kept at path
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// List returns the admissions ordered by IP, including expired ones not yet
+// removed by Expire
+func (s *Store) List() ([]Admission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load()
+}
+
+// Add admits a device, replacing an earlier admission of its IP
+func (s *Store) Add(a Admission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	admissions, err := s.load()
+	if err != nil {
+		return err
+	}
+	admissions = without(admissions, a.IP)
+	return s.save(append(admissions, a))
+}
+
+// Remove revokes the admission of ip and reports whether there was one
+func (s *Store) Remove(ip string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	admissions, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	remaining := without(admissions, ip)
+	if len(remaining) == len(admissions) {
+		return false, nil
+	}
+	return true, s.save(remaining)
+}
+
+// Expire removes and returns the admissions that have run out at now
+func (s *Store) Expire(now time.Time) ([]Admission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	admissions, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	var expired, remaining []Admission
+	for _, a := range admissions {
+		if a.Expired(now) {
+			expired = append(expired, a)
+		} else {
+			remaining = append(remaining, a)
+		}
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+	return expired, s.save(remaining)
+}
+
+func without(admissions []Admission, ip string) []Admission {
+	result := make([]Admission, 0, len(admissions))
+	for _, a := range admissions {
+		if a.IP != ip {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+func (s *Store) load() ([]Admission, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return []Admission{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read portal admissions: %w", err)
+	}
+	var admissions []Admission
+	if err := json.Unmarshal(data, &admissions); err != nil {
+		return nil, fmt.Errorf("failed to parse portal admissions: %w", err)
+	}
+	return admissions, nil
+}
+
+func (s *Store) save(admissions []Admission) error {
+	sort.Slice(admissions, func(i, j int) bool { return admissions[i].IP < admissions[j].IP })
+	data, err := json.MarshalIndent(admissions, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create portal directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to save portal admissions: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,1443 @@
+// gRPC control API of nat-manager, served by 'nat-manager serve --grpc'.
+//
+// Regenerate the Go code in internal/rpc/natmanagerv1 after changing this
+// file with 'make proto'.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        v5.29.3
+// source: natmanager/v1/nat_manager.proto
+
+package natmanagerv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Change is what happened to a connection or device
+type Change int32
+
+const (
+	Change_CHANGE_UNSPECIFIED Change = 0
+	Change_CHANGE_ADDED       Change = 1 // opened or joined
+	Change_CHANGE_UPDATED     Change = 2 // state or details changed
+	Change_CHANGE_REMOVED     Change = 3 // closed or left
+)
+
+// Enum value maps for Change.
+var (
+	Change_name = map[int32]string{
+		0: "CHANGE_UNSPECIFIED",
+		1: "CHANGE_ADDED",
+		2: "CHANGE_UPDATED",
+		3: "CHANGE_REMOVED",
+	}
+	Change_value = map[string]int32{
+		"CHANGE_UNSPECIFIED": 0,
+		"CHANGE_ADDED":       1,
+		"CHANGE_UPDATED":     2,
+		"CHANGE_REMOVED":     3,
+	}
+)
+
+func (x Change) Enum() *Change {
+	p := new(Change)
+	*p = x
+	return p
+}
+
+func (x Change) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Change) Descriptor() protoreflect.EnumDescriptor {
+	return file_natmanager_v1_nat_manager_proto_enumTypes[0].Descriptor()
+}
+
+func (Change) Type() protoreflect.EnumType {
+	return &file_natmanager_v1_nat_manager_proto_enumTypes[0]
+}
+
+func (x Change) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Change.Descriptor instead.
+func (Change) EnumDescriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{0}
+}
+
+type GetStatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStatusRequest) Reset() {
+	*x = GetStatusRequest{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStatusRequest) ProtoMessage() {}
+
+func (x *GetStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStatusRequest.ProtoReflect.Descriptor instead.
+func (*GetStatusRequest) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{0}
+}
+
+type Status struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Active            bool                   `protobuf:"varint,1,opt,name=active,proto3" json:"active,omitempty"`
+	ExternalIp        string                 `protobuf:"bytes,2,opt,name=external_ip,json=externalIp,proto3" json:"external_ip,omitempty"`
+	BytesIn           uint64                 `protobuf:"varint,3,opt,name=bytes_in,json=bytesIn,proto3" json:"bytes_in,omitempty"`    // received by NAT clients
+	BytesOut          uint64                 `protobuf:"varint,4,opt,name=bytes_out,json=bytesOut,proto3" json:"bytes_out,omitempty"` // sent by NAT clients
+	IpForwarding      bool                   `protobuf:"varint,5,opt,name=ip_forwarding,json=ipForwarding,proto3" json:"ip_forwarding,omitempty"`
+	PfEnabled         bool                   `protobuf:"varint,6,opt,name=pf_enabled,json=pfEnabled,proto3" json:"pf_enabled,omitempty"`
+	DhcpRunning       bool                   `protobuf:"varint,7,opt,name=dhcp_running,json=dhcpRunning,proto3" json:"dhcp_running,omitempty"`
+	ConnectedDevices  int32                  `protobuf:"varint,8,opt,name=connected_devices,json=connectedDevices,proto3" json:"connected_devices,omitempty"`
+	ActiveConnections int32                  `protobuf:"varint,9,opt,name=active_connections,json=activeConnections,proto3" json:"active_connections,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *Status) Reset() {
+	*x = Status{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Status) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Status) ProtoMessage() {}
+
+func (x *Status) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Status.ProtoReflect.Descriptor instead.
+func (*Status) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Status) GetActive() bool {
+	if x != nil {
+		return x.Active
+	}
+	return false
+}
+
+func (x *Status) GetExternalIp() string {
+	if x != nil {
+		return x.ExternalIp
+	}
+	return ""
+}
+
+func (x *Status) GetBytesIn() uint64 {
+	if x != nil {
+		return x.BytesIn
+	}
+	return 0
+}
+
+func (x *Status) GetBytesOut() uint64 {
+	if x != nil {
+		return x.BytesOut
+	}
+	return 0
+}
+
+func (x *Status) GetIpForwarding() bool {
+	if x != nil {
+		return x.IpForwarding
+	}
+	return false
+}
+
+func (x *Status) GetPfEnabled() bool {
+	if x != nil {
+		return x.PfEnabled
+	}
+	return false
+}
+
+func (x *Status) GetDhcpRunning() bool {
+	if x != nil {
+		return x.DhcpRunning
+	}
+	return false
+}
+
+func (x *Status) GetConnectedDevices() int32 {
+	if x != nil {
+		return x.ConnectedDevices
+	}
+	return 0
+}
+
+func (x *Status) GetActiveConnections() int32 {
+	if x != nil {
+		return x.ActiveConnections
+	}
+	return 0
+}
+
+type Device struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Ip             string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	Mac            string                 `protobuf:"bytes,2,opt,name=mac,proto3" json:"mac,omitempty"`
+	Vendor         string                 `protobuf:"bytes,3,opt,name=vendor,proto3" json:"vendor,omitempty"`
+	Hostname       string                 `protobuf:"bytes,4,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Type           string                 `protobuf:"bytes,5,opt,name=type,proto3" json:"type,omitempty"`
+	Online         bool                   `protobuf:"varint,6,opt,name=online,proto3" json:"online,omitempty"`
+	LeaseRemaining string                 `protobuf:"bytes,7,opt,name=lease_remaining,json=leaseRemaining,proto3" json:"lease_remaining,omitempty"` // "infinite" or a duration, empty without a lease
+	FirstSeen      *timestamppb.Timestamp `protobuf:"bytes,8,opt,name=first_seen,json=firstSeen,proto3" json:"first_seen,omitempty"`
+	LastSeen       *timestamppb.Timestamp `protobuf:"bytes,9,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Device) Reset() {
+	*x = Device{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Device) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Device) ProtoMessage() {}
+
+func (x *Device) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Device.ProtoReflect.Descriptor instead.
+func (*Device) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Device) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *Device) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *Device) GetVendor() string {
+	if x != nil {
+		return x.Vendor
+	}
+	return ""
+}
+
+func (x *Device) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *Device) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Device) GetOnline() bool {
+	if x != nil {
+		return x.Online
+	}
+	return false
+}
+
+func (x *Device) GetLeaseRemaining() string {
+	if x != nil {
+		return x.LeaseRemaining
+	}
+	return ""
+}
+
+func (x *Device) GetFirstSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FirstSeen
+	}
+	return nil
+}
+
+func (x *Device) GetLastSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeen
+	}
+	return nil
+}
+
+type ListDevicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDevicesRequest) Reset() {
+	*x = ListDevicesRequest{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDevicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDevicesRequest) ProtoMessage() {}
+
+func (x *ListDevicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDevicesRequest.ProtoReflect.Descriptor instead.
+func (*ListDevicesRequest) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{3}
+}
+
+type ListDevicesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Devices       []*Device              `protobuf:"bytes,1,rep,name=devices,proto3" json:"devices,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListDevicesResponse) Reset() {
+	*x = ListDevicesResponse{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListDevicesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDevicesResponse) ProtoMessage() {}
+
+func (x *ListDevicesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDevicesResponse.ProtoReflect.Descriptor instead.
+func (*ListDevicesResponse) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListDevicesResponse) GetDevices() []*Device {
+	if x != nil {
+		return x.Devices
+	}
+	return nil
+}
+
+type Connection struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Source        string                 `protobuf:"bytes,1,opt,name=source,proto3" json:"source,omitempty"`
+	Destination   string                 `protobuf:"bytes,2,opt,name=destination,proto3" json:"destination,omitempty"`
+	Protocol      string                 `protobuf:"bytes,3,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	State         string                 `protobuf:"bytes,4,opt,name=state,proto3" json:"state,omitempty"`
+	Bytes         uint64                 `protobuf:"varint,5,opt,name=bytes,proto3" json:"bytes,omitempty"` // both directions, when known
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Connection) Reset() {
+	*x = Connection{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Connection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Connection) ProtoMessage() {}
+
+func (x *Connection) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Connection.ProtoReflect.Descriptor instead.
+func (*Connection) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Connection) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Connection) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+func (x *Connection) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
+	}
+	return ""
+}
+
+func (x *Connection) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Connection) GetBytes() uint64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+type ListConnectionsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsRequest) Reset() {
+	*x = ListConnectionsRequest{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsRequest) ProtoMessage() {}
+
+func (x *ListConnectionsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsRequest.ProtoReflect.Descriptor instead.
+func (*ListConnectionsRequest) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{6}
+}
+
+type ListConnectionsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Connections   []*Connection          `protobuf:"bytes,1,rep,name=connections,proto3" json:"connections,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConnectionsResponse) Reset() {
+	*x = ListConnectionsResponse{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConnectionsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConnectionsResponse) ProtoMessage() {}
+
+func (x *ListConnectionsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConnectionsResponse.ProtoReflect.Descriptor instead.
+func (*ListConnectionsResponse) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListConnectionsResponse) GetConnections() []*Connection {
+	if x != nil {
+		return x.Connections
+	}
+	return nil
+}
+
+type PortForward struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Protocol      string                 `protobuf:"bytes,1,opt,name=protocol,proto3" json:"protocol,omitempty"` // tcp, udp or tcp/udp
+	ExternalPort  int32                  `protobuf:"varint,2,opt,name=external_port,json=externalPort,proto3" json:"external_port,omitempty"`
+	InternalIp    string                 `protobuf:"bytes,3,opt,name=internal_ip,json=internalIp,proto3" json:"internal_ip,omitempty"`
+	InternalPort  int32                  `protobuf:"varint,4,opt,name=internal_port,json=internalPort,proto3" json:"internal_port,omitempty"`
+	Description   string                 `protobuf:"bytes,5,opt,name=description,proto3" json:"description,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PortForward) Reset() {
+	*x = PortForward{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PortForward) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PortForward) ProtoMessage() {}
+
+func (x *PortForward) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PortForward.ProtoReflect.Descriptor instead.
+func (*PortForward) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PortForward) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
+	}
+	return ""
+}
+
+func (x *PortForward) GetExternalPort() int32 {
+	if x != nil {
+		return x.ExternalPort
+	}
+	return 0
+}
+
+func (x *PortForward) GetInternalIp() string {
+	if x != nil {
+		return x.InternalIp
+	}
+	return ""
+}
+
+func (x *PortForward) GetInternalPort() int32 {
+	if x != nil {
+		return x.InternalPort
+	}
+	return 0
+}
+
+func (x *PortForward) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+type ListForwardsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListForwardsRequest) Reset() {
+	*x = ListForwardsRequest{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListForwardsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListForwardsRequest) ProtoMessage() {}
+
+func (x *ListForwardsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListForwardsRequest.ProtoReflect.Descriptor instead.
+func (*ListForwardsRequest) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{9}
+}
+
+type ListForwardsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Forwards      []*PortForward         `protobuf:"bytes,1,rep,name=forwards,proto3" json:"forwards,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListForwardsResponse) Reset() {
+	*x = ListForwardsResponse{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListForwardsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListForwardsResponse) ProtoMessage() {}
+
+func (x *ListForwardsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListForwardsResponse.ProtoReflect.Descriptor instead.
+func (*ListForwardsResponse) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListForwardsResponse) GetForwards() []*PortForward {
+	if x != nil {
+		return x.Forwards
+	}
+	return nil
+}
+
+type AddForwardRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Forward       *PortForward           `protobuf:"bytes,1,opt,name=forward,proto3" json:"forward,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AddForwardRequest) Reset() {
+	*x = AddForwardRequest{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AddForwardRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AddForwardRequest) ProtoMessage() {}
+
+func (x *AddForwardRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AddForwardRequest.ProtoReflect.Descriptor instead.
+func (*AddForwardRequest) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *AddForwardRequest) GetForward() *PortForward {
+	if x != nil {
+		return x.Forward
+	}
+	return nil
+}
+
+type RemoveForwardRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ExternalPort  int32                  `protobuf:"varint,1,opt,name=external_port,json=externalPort,proto3" json:"external_port,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveForwardRequest) Reset() {
+	*x = RemoveForwardRequest{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveForwardRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveForwardRequest) ProtoMessage() {}
+
+func (x *RemoveForwardRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveForwardRequest.ProtoReflect.Descriptor instead.
+func (*RemoveForwardRequest) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RemoveForwardRequest) GetExternalPort() int32 {
+	if x != nil {
+		return x.ExternalPort
+	}
+	return 0
+}
+
+type RemoveForwardResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RemoveForwardResponse) Reset() {
+	*x = RemoveForwardResponse{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RemoveForwardResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveForwardResponse) ProtoMessage() {}
+
+func (x *RemoveForwardResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveForwardResponse.ProtoReflect.Descriptor instead.
+func (*RemoveForwardResponse) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{13}
+}
+
+type StartRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartRequest) Reset() {
+	*x = StartRequest{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartRequest) ProtoMessage() {}
+
+func (x *StartRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartRequest.ProtoReflect.Descriptor instead.
+func (*StartRequest) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{14}
+}
+
+type StopRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StopRequest) Reset() {
+	*x = StopRequest{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StopRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StopRequest) ProtoMessage() {}
+
+func (x *StopRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StopRequest.ProtoReflect.Descriptor instead.
+func (*StopRequest) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{15}
+}
+
+type WatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// How often the instance is polled for changes, 2 seconds if unset
+	IntervalMs    uint32 `protobuf:"varint,1,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *WatchRequest) GetIntervalMs() uint32 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+type ConnectionEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Change        Change                 `protobuf:"varint,2,opt,name=change,proto3,enum=natmanager.v1.Change" json:"change,omitempty"`
+	Connection    *Connection            `protobuf:"bytes,3,opt,name=connection,proto3" json:"connection,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConnectionEvent) Reset() {
+	*x = ConnectionEvent{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConnectionEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConnectionEvent) ProtoMessage() {}
+
+func (x *ConnectionEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConnectionEvent.ProtoReflect.Descriptor instead.
+func (*ConnectionEvent) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *ConnectionEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *ConnectionEvent) GetChange() Change {
+	if x != nil {
+		return x.Change
+	}
+	return Change_CHANGE_UNSPECIFIED
+}
+
+func (x *ConnectionEvent) GetConnection() *Connection {
+	if x != nil {
+		return x.Connection
+	}
+	return nil
+}
+
+type DeviceEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Change        Change                 `protobuf:"varint,2,opt,name=change,proto3,enum=natmanager.v1.Change" json:"change,omitempty"`
+	Device        *Device                `protobuf:"bytes,3,opt,name=device,proto3" json:"device,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeviceEvent) Reset() {
+	*x = DeviceEvent{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeviceEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeviceEvent) ProtoMessage() {}
+
+func (x *DeviceEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeviceEvent.ProtoReflect.Descriptor instead.
+func (*DeviceEvent) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *DeviceEvent) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *DeviceEvent) GetChange() Change {
+	if x != nil {
+		return x.Change
+	}
+	return Change_CHANGE_UNSPECIFIED
+}
+
+func (x *DeviceEvent) GetDevice() *Device {
+	if x != nil {
+		return x.Device
+	}
+	return nil
+}
+
+type DeviceTraffic struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ip            string                 `protobuf:"bytes,1,opt,name=ip,proto3" json:"ip,omitempty"`
+	BytesIn       uint64                 `protobuf:"varint,2,opt,name=bytes_in,json=bytesIn,proto3" json:"bytes_in,omitempty"`
+	BytesOut      uint64                 `protobuf:"varint,3,opt,name=bytes_out,json=bytesOut,proto3" json:"bytes_out,omitempty"`
+	PacketsIn     uint64                 `protobuf:"varint,4,opt,name=packets_in,json=packetsIn,proto3" json:"packets_in,omitempty"`
+	PacketsOut    uint64                 `protobuf:"varint,5,opt,name=packets_out,json=packetsOut,proto3" json:"packets_out,omitempty"`
+	RateIn        float64                `protobuf:"fixed64,6,opt,name=rate_in,json=rateIn,proto3" json:"rate_in,omitempty"`    // bytes per second since the previous sample
+	RateOut       float64                `protobuf:"fixed64,7,opt,name=rate_out,json=rateOut,proto3" json:"rate_out,omitempty"` // bytes per second since the previous sample
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeviceTraffic) Reset() {
+	*x = DeviceTraffic{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeviceTraffic) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeviceTraffic) ProtoMessage() {}
+
+func (x *DeviceTraffic) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeviceTraffic.ProtoReflect.Descriptor instead.
+func (*DeviceTraffic) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *DeviceTraffic) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *DeviceTraffic) GetBytesIn() uint64 {
+	if x != nil {
+		return x.BytesIn
+	}
+	return 0
+}
+
+func (x *DeviceTraffic) GetBytesOut() uint64 {
+	if x != nil {
+		return x.BytesOut
+	}
+	return 0
+}
+
+func (x *DeviceTraffic) GetPacketsIn() uint64 {
+	if x != nil {
+		return x.PacketsIn
+	}
+	return 0
+}
+
+func (x *DeviceTraffic) GetPacketsOut() uint64 {
+	if x != nil {
+		return x.PacketsOut
+	}
+	return 0
+}
+
+func (x *DeviceTraffic) GetRateIn() float64 {
+	if x != nil {
+		return x.RateIn
+	}
+	return 0
+}
+
+func (x *DeviceTraffic) GetRateOut() float64 {
+	if x != nil {
+		return x.RateOut
+	}
+	return 0
+}
+
+type TrafficSample struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Devices       []*DeviceTraffic       `protobuf:"bytes,2,rep,name=devices,proto3" json:"devices,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TrafficSample) Reset() {
+	*x = TrafficSample{}
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TrafficSample) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TrafficSample) ProtoMessage() {}
+
+func (x *TrafficSample) ProtoReflect() protoreflect.Message {
+	mi := &file_natmanager_v1_nat_manager_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TrafficSample.ProtoReflect.Descriptor instead.
+func (*TrafficSample) Descriptor() ([]byte, []int) {
+	return file_natmanager_v1_nat_manager_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *TrafficSample) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *TrafficSample) GetDevices() []*DeviceTraffic {
+	if x != nil {
+		return x.Devices
+	}
+	return nil
+}
+
+var File_natmanager_v1_nat_manager_proto protoreflect.FileDescriptor
+
+const file_natmanager_v1_nat_manager_proto_rawDesc = "" +
+	"\n" +
+	"\x1fnatmanager/v1/nat_manager.proto\x12\rnatmanager.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x12\n" +
+	"\x10GetStatusRequest\"\xbc\x02\n" +
+	"\x06Status\x12\x16\n" +
+	"\x06active\x18\x01 \x01(\bR\x06active\x12\x1f\n" +
+	"\vexternal_ip\x18\x02 \x01(\tR\n" +
+	"externalIp\x12\x19\n" +
+	"\bbytes_in\x18\x03 \x01(\x04R\abytesIn\x12\x1b\n" +
+	"\tbytes_out\x18\x04 \x01(\x04R\bbytesOut\x12#\n" +
+	"\rip_forwarding\x18\x05 \x01(\bR\fipForwarding\x12\x1d\n" +
+	"\n" +
+	"pf_enabled\x18\x06 \x01(\bR\tpfEnabled\x12!\n" +
+	"\fdhcp_running\x18\a \x01(\bR\vdhcpRunning\x12+\n" +
+	"\x11connected_devices\x18\b \x01(\x05R\x10connectedDevices\x12-\n" +
+	"\x12active_connections\x18\t \x01(\x05R\x11activeConnections\"\xa7\x02\n" +
+	"\x06Device\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x10\n" +
+	"\x03mac\x18\x02 \x01(\tR\x03mac\x12\x16\n" +
+	"\x06vendor\x18\x03 \x01(\tR\x06vendor\x12\x1a\n" +
+	"\bhostname\x18\x04 \x01(\tR\bhostname\x12\x12\n" +
+	"\x04type\x18\x05 \x01(\tR\x04type\x12\x16\n" +
+	"\x06online\x18\x06 \x01(\bR\x06online\x12'\n" +
+	"\x0flease_remaining\x18\a \x01(\tR\x0eleaseRemaining\x129\n" +
+	"\n" +
+	"first_seen\x18\b \x01(\v2\x1a.google.protobuf.TimestampR\tfirstSeen\x127\n" +
+	"\tlast_seen\x18\t \x01(\v2\x1a.google.protobuf.TimestampR\blastSeen\"\x14\n" +
+	"\x12ListDevicesRequest\"F\n" +
+	"\x13ListDevicesResponse\x12/\n" +
+	"\adevices\x18\x01 \x03(\v2\x15.natmanager.v1.DeviceR\adevices\"\x8e\x01\n" +
+	"\n" +
+	"Connection\x12\x16\n" +
+	"\x06source\x18\x01 \x01(\tR\x06source\x12 \n" +
+	"\vdestination\x18\x02 \x01(\tR\vdestination\x12\x1a\n" +
+	"\bprotocol\x18\x03 \x01(\tR\bprotocol\x12\x14\n" +
+	"\x05state\x18\x04 \x01(\tR\x05state\x12\x14\n" +
+	"\x05bytes\x18\x05 \x01(\x04R\x05bytes\"\x18\n" +
+	"\x16ListConnectionsRequest\"V\n" +
+	"\x17ListConnectionsResponse\x12;\n" +
+	"\vconnections\x18\x01 \x03(\v2\x19.natmanager.v1.ConnectionR\vconnections\"\xb6\x01\n" +
+	"\vPortForward\x12\x1a\n" +
+	"\bprotocol\x18\x01 \x01(\tR\bprotocol\x12#\n" +
+	"\rexternal_port\x18\x02 \x01(\x05R\fexternalPort\x12\x1f\n" +
+	"\vinternal_ip\x18\x03 \x01(\tR\n" +
+	"internalIp\x12#\n" +
+	"\rinternal_port\x18\x04 \x01(\x05R\finternalPort\x12 \n" +
+	"\vdescription\x18\x05 \x01(\tR\vdescription\"\x15\n" +
+	"\x13ListForwardsRequest\"N\n" +
+	"\x14ListForwardsResponse\x126\n" +
+	"\bforwards\x18\x01 \x03(\v2\x1a.natmanager.v1.PortForwardR\bforwards\"I\n" +
+	"\x11AddForwardRequest\x124\n" +
+	"\aforward\x18\x01 \x01(\v2\x1a.natmanager.v1.PortForwardR\aforward\";\n" +
+	"\x14RemoveForwardRequest\x12#\n" +
+	"\rexternal_port\x18\x01 \x01(\x05R\fexternalPort\"\x17\n" +
+	"\x15RemoveForwardResponse\"\x0e\n" +
+	"\fStartRequest\"\r\n" +
+	"\vStopRequest\"/\n" +
+	"\fWatchRequest\x12\x1f\n" +
+	"\vinterval_ms\x18\x01 \x01(\rR\n" +
+	"intervalMs\"\xab\x01\n" +
+	"\x0fConnectionEvent\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12-\n" +
+	"\x06change\x18\x02 \x01(\x0e2\x15.natmanager.v1.ChangeR\x06change\x129\n" +
+	"\n" +
+	"connection\x18\x03 \x01(\v2\x19.natmanager.v1.ConnectionR\n" +
+	"connection\"\x9b\x01\n" +
+	"\vDeviceEvent\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12-\n" +
+	"\x06change\x18\x02 \x01(\x0e2\x15.natmanager.v1.ChangeR\x06change\x12-\n" +
+	"\x06device\x18\x03 \x01(\v2\x15.natmanager.v1.DeviceR\x06device\"\xcb\x01\n" +
+	"\rDeviceTraffic\x12\x0e\n" +
+	"\x02ip\x18\x01 \x01(\tR\x02ip\x12\x19\n" +
+	"\bbytes_in\x18\x02 \x01(\x04R\abytesIn\x12\x1b\n" +
+	"\tbytes_out\x18\x03 \x01(\x04R\bbytesOut\x12\x1d\n" +
+	"\n" +
+	"packets_in\x18\x04 \x01(\x04R\tpacketsIn\x12\x1f\n" +
+	"\vpackets_out\x18\x05 \x01(\x04R\n" +
+	"packetsOut\x12\x17\n" +
+	"\arate_in\x18\x06 \x01(\x01R\x06rateIn\x12\x19\n" +
+	"\brate_out\x18\a \x01(\x01R\arateOut\"w\n" +
+	"\rTrafficSample\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x126\n" +
+	"\adevices\x18\x02 \x03(\v2\x1c.natmanager.v1.DeviceTrafficR\adevices*Z\n" +
+	"\x06Change\x12\x16\n" +
+	"\x12CHANGE_UNSPECIFIED\x10\x00\x12\x10\n" +
+	"\fCHANGE_ADDED\x10\x01\x12\x12\n" +
+	"\x0eCHANGE_UPDATED\x10\x02\x12\x12\n" +
+	"\x0eCHANGE_REMOVED\x10\x032\xed\x06\n" +
+	"\n" +
+	"NATManager\x12C\n" +
+	"\tGetStatus\x12\x1f.natmanager.v1.GetStatusRequest\x1a\x15.natmanager.v1.Status\x12T\n" +
+	"\vListDevices\x12!.natmanager.v1.ListDevicesRequest\x1a\".natmanager.v1.ListDevicesResponse\x12`\n" +
+	"\x0fListConnections\x12%.natmanager.v1.ListConnectionsRequest\x1a&.natmanager.v1.ListConnectionsResponse\x12W\n" +
+	"\fListForwards\x12\".natmanager.v1.ListForwardsRequest\x1a#.natmanager.v1.ListForwardsResponse\x12J\n" +
+	"\n" +
+	"AddForward\x12 .natmanager.v1.AddForwardRequest\x1a\x1a.natmanager.v1.PortForward\x12Z\n" +
+	"\rRemoveForward\x12#.natmanager.v1.RemoveForwardRequest\x1a$.natmanager.v1.RemoveForwardResponse\x12;\n" +
+	"\x05Start\x12\x1b.natmanager.v1.StartRequest\x1a\x15.natmanager.v1.Status\x129\n" +
+	"\x04Stop\x12\x1a.natmanager.v1.StopRequest\x1a\x15.natmanager.v1.Status\x12Q\n" +
+	"\x10WatchConnections\x12\x1b.natmanager.v1.WatchRequest\x1a\x1e.natmanager.v1.ConnectionEvent0\x01\x12I\n" +
+	"\fWatchDevices\x12\x1b.natmanager.v1.WatchRequest\x1a\x1a.natmanager.v1.DeviceEvent0\x01\x12K\n" +
+	"\fWatchTraffic\x12\x1b.natmanager.v1.WatchRequest\x1a\x1c.natmanager.v1.TrafficSample0\x01BOZMgithub.com/scttfrdmn/macos-nat-manager/internal/rpc/natmanagerv1;natmanagerv1b\x06proto3"
+
+var (
+	file_natmanager_v1_nat_manager_proto_rawDescOnce sync.Once
+	file_natmanager_v1_nat_manager_proto_rawDescData []byte
+)
+
+func file_natmanager_v1_nat_manager_proto_rawDescGZIP() []byte {
+	file_natmanager_v1_nat_manager_proto_rawDescOnce.Do(func() {
+		file_natmanager_v1_nat_manager_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_natmanager_v1_nat_manager_proto_rawDesc), len(file_natmanager_v1_nat_manager_proto_rawDesc)))
+	})
+	return file_natmanager_v1_nat_manager_proto_rawDescData
+}
+
+var file_natmanager_v1_nat_manager_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_natmanager_v1_nat_manager_proto_msgTypes = make([]protoimpl.MessageInfo, 21)
+var file_natmanager_v1_nat_manager_proto_goTypes = []any{
+	(Change)(0),                     // 0: natmanager.v1.Change
+	(*GetStatusRequest)(nil),        // 1: natmanager.v1.GetStatusRequest
+	(*Status)(nil),                  // 2: natmanager.v1.Status
+	(*Device)(nil),                  // 3: natmanager.v1.Device
+	(*ListDevicesRequest)(nil),      // 4: natmanager.v1.ListDevicesRequest
+	(*ListDevicesResponse)(nil),     // 5: natmanager.v1.ListDevicesResponse
+	(*Connection)(nil),              // 6: natmanager.v1.Connection
+	(*ListConnectionsRequest)(nil),  // 7: natmanager.v1.ListConnectionsRequest
+	(*ListConnectionsResponse)(nil), // 8: natmanager.v1.ListConnectionsResponse
+	(*PortForward)(nil),             // 9: natmanager.v1.PortForward
+	(*ListForwardsRequest)(nil),     // 10: natmanager.v1.ListForwardsRequest
+	(*ListForwardsResponse)(nil),    // 11: natmanager.v1.ListForwardsResponse
+	(*AddForwardRequest)(nil),       // 12: natmanager.v1.AddForwardRequest
+	(*RemoveForwardRequest)(nil),    // 13: natmanager.v1.RemoveForwardRequest
+	(*RemoveForwardResponse)(nil),   // 14: natmanager.v1.RemoveForwardResponse
+	(*StartRequest)(nil),            // 15: natmanager.v1.StartRequest
+	(*StopRequest)(nil),             // 16: natmanager.v1.StopRequest
+	(*WatchRequest)(nil),            // 17: natmanager.v1.WatchRequest
+	(*ConnectionEvent)(nil),         // 18: natmanager.v1.ConnectionEvent
+	(*DeviceEvent)(nil),             // 19: natmanager.v1.DeviceEvent
+	(*DeviceTraffic)(nil),           // 20: natmanager.v1.DeviceTraffic
+	(*TrafficSample)(nil),           // 21: natmanager.v1.TrafficSample
+	(*timestamppb.Timestamp)(nil),   // 22: google.protobuf.Timestamp
+}
+var file_natmanager_v1_nat_manager_proto_depIdxs = []int32{
+	22, // 0: natmanager.v1.Device.first_seen:type_name -> google.protobuf.Timestamp
+	22, // 1: natmanager.v1.Device.last_seen:type_name -> google.protobuf.Timestamp
+	3,  // 2: natmanager.v1.ListDevicesResponse.devices:type_name -> natmanager.v1.Device
+	6,  // 3: natmanager.v1.ListConnectionsResponse.connections:type_name -> natmanager.v1.Connection
+	9,  // 4: natmanager.v1.ListForwardsResponse.forwards:type_name -> natmanager.v1.PortForward
+	9,  // 5: natmanager.v1.AddForwardRequest.forward:type_name -> natmanager.v1.PortForward
+	22, // 6: natmanager.v1.ConnectionEvent.time:type_name -> google.protobuf.Timestamp
+	0,  // 7: natmanager.v1.ConnectionEvent.change:type_name -> natmanager.v1.Change
+	6,  // 8: natmanager.v1.ConnectionEvent.connection:type_name -> natmanager.v1.Connection
+	22, // 9: natmanager.v1.DeviceEvent.time:type_name -> google.protobuf.Timestamp
+	0,  // 10: natmanager.v1.DeviceEvent.change:type_name -> natmanager.v1.Change
+	3,  // 11: natmanager.v1.DeviceEvent.device:type_name -> natmanager.v1.Device
+	22, // 12: natmanager.v1.TrafficSample.time:type_name -> google.protobuf.Timestamp
+	20, // 13: natmanager.v1.TrafficSample.devices:type_name -> natmanager.v1.DeviceTraffic
+	1,  // 14: natmanager.v1.NATManager.GetStatus:input_type -> natmanager.v1.GetStatusRequest
+	4,  // 15: natmanager.v1.NATManager.ListDevices:input_type -> natmanager.v1.ListDevicesRequest
+	7,  // 16: natmanager.v1.NATManager.ListConnections:input_type -> natmanager.v1.ListConnectionsRequest
+	10, // 17: natmanager.v1.NATManager.ListForwards:input_type -> natmanager.v1.ListForwardsRequest
+	12, // 18: natmanager.v1.NATManager.AddForward:input_type -> natmanager.v1.AddForwardRequest
+	13, // 19: natmanager.v1.NATManager.RemoveForward:input_type -> natmanager.v1.RemoveForwardRequest
+	15, // 20: natmanager.v1.NATManager.Start:input_type -> natmanager.v1.StartRequest
+	16, // 21: natmanager.v1.NATManager.Stop:input_type -> natmanager.v1.StopRequest
+	17, // 22: natmanager.v1.NATManager.WatchConnections:input_type -> natmanager.v1.WatchRequest
+	17, // 23: natmanager.v1.NATManager.WatchDevices:input_type -> natmanager.v1.WatchRequest
+	17, // 24: natmanager.v1.NATManager.WatchTraffic:input_type -> natmanager.v1.WatchRequest
+	2,  // 25: natmanager.v1.NATManager.GetStatus:output_type -> natmanager.v1.Status
+	5,  // 26: natmanager.v1.NATManager.ListDevices:output_type -> natmanager.v1.ListDevicesResponse
+	8,  // 27: natmanager.v1.NATManager.ListConnections:output_type -> natmanager.v1.ListConnectionsResponse
+	11, // 28: natmanager.v1.NATManager.ListForwards:output_type -> natmanager.v1.ListForwardsResponse
+	9,  // 29: natmanager.v1.NATManager.AddForward:output_type -> natmanager.v1.PortForward
+	14, // 30: natmanager.v1.NATManager.RemoveForward:output_type -> natmanager.v1.RemoveForwardResponse
+	2,  // 31: natmanager.v1.NATManager.Start:output_type -> natmanager.v1.Status
+	2,  // 32: natmanager.v1.NATManager.Stop:output_type -> natmanager.v1.Status
+	18, // 33: natmanager.v1.NATManager.WatchConnections:output_type -> natmanager.v1.ConnectionEvent
+	19, // 34: natmanager.v1.NATManager.WatchDevices:output_type -> natmanager.v1.DeviceEvent
+	21, // 35: natmanager.v1.NATManager.WatchTraffic:output_type -> natmanager.v1.TrafficSample
+	25, // [25:36] is the sub-list for method output_type
+	14, // [14:25] is the sub-list for method input_type
+	14, // [14:14] is the sub-list for extension type_name
+	14, // [14:14] is the sub-list for extension extendee
+	0,  // [0:14] is the sub-list for field type_name
+}
+
+func init() { file_natmanager_v1_nat_manager_proto_init() }
+func file_natmanager_v1_nat_manager_proto_init() {
+	if File_natmanager_v1_nat_manager_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_natmanager_v1_nat_manager_proto_rawDesc), len(file_natmanager_v1_nat_manager_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   21,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_natmanager_v1_nat_manager_proto_goTypes,
+		DependencyIndexes: file_natmanager_v1_nat_manager_proto_depIdxs,
+		EnumInfos:         file_natmanager_v1_nat_manager_proto_enumTypes,
+		MessageInfos:      file_natmanager_v1_nat_manager_proto_msgTypes,
+	}.Build()
+	File_natmanager_v1_nat_manager_proto = out.File
+	file_natmanager_v1_nat_manager_proto_goTypes = nil
+	file_natmanager_v1_nat_manager_proto_depIdxs = nil
+}
@@ -0,0 +1,544 @@
+// gRPC control API of nat-manager, served by 'nat-manager serve --grpc'.
+//
+// Regenerate the Go code in internal/rpc/natmanagerv1 after changing this
+// file with 'make proto'.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: natmanager/v1/nat_manager.proto
+
+package natmanagerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	NATManager_GetStatus_FullMethodName        = "/natmanager.v1.NATManager/GetStatus"
+	NATManager_ListDevices_FullMethodName      = "/natmanager.v1.NATManager/ListDevices"
+	NATManager_ListConnections_FullMethodName  = "/natmanager.v1.NATManager/ListConnections"
+	NATManager_ListForwards_FullMethodName     = "/natmanager.v1.NATManager/ListForwards"
+	NATManager_AddForward_FullMethodName       = "/natmanager.v1.NATManager/AddForward"
+	NATManager_RemoveForward_FullMethodName    = "/natmanager.v1.NATManager/RemoveForward"
+	NATManager_Start_FullMethodName            = "/natmanager.v1.NATManager/Start"
+	NATManager_Stop_FullMethodName             = "/natmanager.v1.NATManager/Stop"
+	NATManager_WatchConnections_FullMethodName = "/natmanager.v1.NATManager/WatchConnections"
+	NATManager_WatchDevices_FullMethodName     = "/natmanager.v1.NATManager/WatchDevices"
+	NATManager_WatchTraffic_FullMethodName     = "/natmanager.v1.NATManager/WatchTraffic"
+)
+
+// NATManagerClient is the client API for NATManager service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// NATManager reads and controls one nat-manager instance. Every call must
+// send the API token as "authorization: Bearer <token>" metadata.
+type NATManagerClient interface {
+	// GetStatus returns the status of the instance
+	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Status, error)
+	// ListDevices returns the devices known on the internal network
+	ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error)
+	// ListConnections returns the active connections
+	ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error)
+	// ListForwards returns the configured port forwards
+	ListForwards(ctx context.Context, in *ListForwardsRequest, opts ...grpc.CallOption) (*ListForwardsResponse, error)
+	// AddForward adds a port forward and reloads the rules
+	AddForward(ctx context.Context, in *AddForwardRequest, opts ...grpc.CallOption) (*PortForward, error)
+	// RemoveForward removes the port forwards of an external port
+	RemoveForward(ctx context.Context, in *RemoveForwardRequest, opts ...grpc.CallOption) (*RemoveForwardResponse, error)
+	// Start starts NAT with the saved configuration
+	Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*Status, error)
+	// Stop stops NAT
+	Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*Status, error)
+	// WatchConnections streams connections as they open and close
+	WatchConnections(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConnectionEvent], error)
+	// WatchDevices streams devices as they join, change and leave
+	WatchDevices(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DeviceEvent], error)
+	// WatchTraffic streams the traffic of each device at every interval
+	WatchTraffic(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TrafficSample], error)
+}
+
+type nATManagerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewNATManagerClient(cc grpc.ClientConnInterface) NATManagerClient {
+	return &nATManagerClient{cc}
+}
+
+func (c *nATManagerClient) GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*Status, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Status)
+	err := c.cc.Invoke(ctx, NATManager_GetStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nATManagerClient) ListDevices(ctx context.Context, in *ListDevicesRequest, opts ...grpc.CallOption) (*ListDevicesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListDevicesResponse)
+	err := c.cc.Invoke(ctx, NATManager_ListDevices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nATManagerClient) ListConnections(ctx context.Context, in *ListConnectionsRequest, opts ...grpc.CallOption) (*ListConnectionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListConnectionsResponse)
+	err := c.cc.Invoke(ctx, NATManager_ListConnections_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nATManagerClient) ListForwards(ctx context.Context, in *ListForwardsRequest, opts ...grpc.CallOption) (*ListForwardsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListForwardsResponse)
+	err := c.cc.Invoke(ctx, NATManager_ListForwards_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nATManagerClient) AddForward(ctx context.Context, in *AddForwardRequest, opts ...grpc.CallOption) (*PortForward, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PortForward)
+	err := c.cc.Invoke(ctx, NATManager_AddForward_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nATManagerClient) RemoveForward(ctx context.Context, in *RemoveForwardRequest, opts ...grpc.CallOption) (*RemoveForwardResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemoveForwardResponse)
+	err := c.cc.Invoke(ctx, NATManager_RemoveForward_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nATManagerClient) Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*Status, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Status)
+	err := c.cc.Invoke(ctx, NATManager_Start_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nATManagerClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (*Status, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Status)
+	err := c.cc.Invoke(ctx, NATManager_Stop_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nATManagerClient) WatchConnections(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ConnectionEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &NATManager_ServiceDesc.Streams[0], NATManager_WatchConnections_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, ConnectionEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NATManager_WatchConnectionsClient = grpc.ServerStreamingClient[ConnectionEvent]
+
+func (c *nATManagerClient) WatchDevices(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DeviceEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &NATManager_ServiceDesc.Streams[1], NATManager_WatchDevices_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, DeviceEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NATManager_WatchDevicesClient = grpc.ServerStreamingClient[DeviceEvent]
+
+func (c *nATManagerClient) WatchTraffic(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TrafficSample], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &NATManager_ServiceDesc.Streams[2], NATManager_WatchTraffic_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, TrafficSample]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NATManager_WatchTrafficClient = grpc.ServerStreamingClient[TrafficSample]
+
+// NATManagerServer is the server API for NATManager service.
+// All implementations must embed UnimplementedNATManagerServer
+// for forward compatibility.
+//
+// NATManager reads and controls one nat-manager instance. Every call must
+// send the API token as "authorization: Bearer <token>" metadata.
+type NATManagerServer interface {
+	// GetStatus returns the status of the instance
+	GetStatus(context.Context, *GetStatusRequest) (*Status, error)
+	// ListDevices returns the devices known on the internal network
+	ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error)
+	// ListConnections returns the active connections
+	ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error)
+	// ListForwards returns the configured port forwards
+	ListForwards(context.Context, *ListForwardsRequest) (*ListForwardsResponse, error)
+	// AddForward adds a port forward and reloads the rules
+	AddForward(context.Context, *AddForwardRequest) (*PortForward, error)
+	// RemoveForward removes the port forwards of an external port
+	RemoveForward(context.Context, *RemoveForwardRequest) (*RemoveForwardResponse, error)
+	// Start starts NAT with the saved configuration
+	Start(context.Context, *StartRequest) (*Status, error)
+	// Stop stops NAT
+	Stop(context.Context, *StopRequest) (*Status, error)
+	// WatchConnections streams connections as they open and close
+	WatchConnections(*WatchRequest, grpc.ServerStreamingServer[ConnectionEvent]) error
+	// WatchDevices streams devices as they join, change and leave
+	WatchDevices(*WatchRequest, grpc.ServerStreamingServer[DeviceEvent]) error
+	// WatchTraffic streams the traffic of each device at every interval
+	WatchTraffic(*WatchRequest, grpc.ServerStreamingServer[TrafficSample]) error
+	mustEmbedUnimplementedNATManagerServer()
+}
+
+// UnimplementedNATManagerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedNATManagerServer struct{}
+
+func (UnimplementedNATManagerServer) GetStatus(context.Context, *GetStatusRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStatus not implemented")
+}
+func (UnimplementedNATManagerServer) ListDevices(context.Context, *ListDevicesRequest) (*ListDevicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDevices not implemented")
+}
+func (UnimplementedNATManagerServer) ListConnections(context.Context, *ListConnectionsRequest) (*ListConnectionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConnections not implemented")
+}
+func (UnimplementedNATManagerServer) ListForwards(context.Context, *ListForwardsRequest) (*ListForwardsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListForwards not implemented")
+}
+func (UnimplementedNATManagerServer) AddForward(context.Context, *AddForwardRequest) (*PortForward, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddForward not implemented")
+}
+func (UnimplementedNATManagerServer) RemoveForward(context.Context, *RemoveForwardRequest) (*RemoveForwardResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveForward not implemented")
+}
+func (UnimplementedNATManagerServer) Start(context.Context, *StartRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Start not implemented")
+}
+func (UnimplementedNATManagerServer) Stop(context.Context, *StopRequest) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
+}
+func (UnimplementedNATManagerServer) WatchConnections(*WatchRequest, grpc.ServerStreamingServer[ConnectionEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchConnections not implemented")
+}
+func (UnimplementedNATManagerServer) WatchDevices(*WatchRequest, grpc.ServerStreamingServer[DeviceEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchDevices not implemented")
+}
+func (UnimplementedNATManagerServer) WatchTraffic(*WatchRequest, grpc.ServerStreamingServer[TrafficSample]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchTraffic not implemented")
+}
+func (UnimplementedNATManagerServer) mustEmbedUnimplementedNATManagerServer() {}
+func (UnimplementedNATManagerServer) testEmbeddedByValue()                    {}
+
+// UnsafeNATManagerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to NATManagerServer will
+// result in compilation errors.
+type UnsafeNATManagerServer interface {
+	mustEmbedUnimplementedNATManagerServer()
+}
+
+func RegisterNATManagerServer(s grpc.ServiceRegistrar, srv NATManagerServer) {
+	// If the following call pancis, it indicates UnimplementedNATManagerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&NATManager_ServiceDesc, srv)
+}
+
+func _NATManager_GetStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NATManagerServer).GetStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NATManager_GetStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NATManagerServer).GetStatus(ctx, req.(*GetStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NATManager_ListDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NATManagerServer).ListDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NATManager_ListDevices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NATManagerServer).ListDevices(ctx, req.(*ListDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NATManager_ListConnections_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConnectionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NATManagerServer).ListConnections(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NATManager_ListConnections_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NATManagerServer).ListConnections(ctx, req.(*ListConnectionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NATManager_ListForwards_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListForwardsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NATManagerServer).ListForwards(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NATManager_ListForwards_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NATManagerServer).ListForwards(ctx, req.(*ListForwardsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NATManager_AddForward_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddForwardRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NATManagerServer).AddForward(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NATManager_AddForward_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NATManagerServer).AddForward(ctx, req.(*AddForwardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NATManager_RemoveForward_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveForwardRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NATManagerServer).RemoveForward(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NATManager_RemoveForward_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NATManagerServer).RemoveForward(ctx, req.(*RemoveForwardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NATManager_Start_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NATManagerServer).Start(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NATManager_Start_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NATManagerServer).Start(ctx, req.(*StartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NATManager_Stop_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NATManagerServer).Stop(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NATManager_Stop_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NATManagerServer).Stop(ctx, req.(*StopRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NATManager_WatchConnections_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NATManagerServer).WatchConnections(m, &grpc.GenericServerStream[WatchRequest, ConnectionEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NATManager_WatchConnectionsServer = grpc.ServerStreamingServer[ConnectionEvent]
+
+func _NATManager_WatchDevices_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NATManagerServer).WatchDevices(m, &grpc.GenericServerStream[WatchRequest, DeviceEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NATManager_WatchDevicesServer = grpc.ServerStreamingServer[DeviceEvent]
+
+func _NATManager_WatchTraffic_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NATManagerServer).WatchTraffic(m, &grpc.GenericServerStream[WatchRequest, TrafficSample]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type NATManager_WatchTrafficServer = grpc.ServerStreamingServer[TrafficSample]
+
+// NATManager_ServiceDesc is the grpc.ServiceDesc for NATManager service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var NATManager_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "natmanager.v1.NATManager",
+	HandlerType: (*NATManagerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStatus",
+			Handler:    _NATManager_GetStatus_Handler,
+		},
+		{
+			MethodName: "ListDevices",
+			Handler:    _NATManager_ListDevices_Handler,
+		},
+		{
+			MethodName: "ListConnections",
+			Handler:    _NATManager_ListConnections_Handler,
+		},
+		{
+			MethodName: "ListForwards",
+			Handler:    _NATManager_ListForwards_Handler,
+		},
+		{
+			MethodName: "AddForward",
+			Handler:    _NATManager_AddForward_Handler,
+		},
+		{
+			MethodName: "RemoveForward",
+			Handler:    _NATManager_RemoveForward_Handler,
+		},
+		{
+			MethodName: "Start",
+			Handler:    _NATManager_Start_Handler,
+		},
+		{
+			MethodName: "Stop",
+			Handler:    _NATManager_Stop_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchConnections",
+			Handler:       _NATManager_WatchConnections_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchDevices",
+			Handler:       _NATManager_WatchDevices_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchTraffic",
+			Handler:       _NATManager_WatchTraffic_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "natmanager/v1/nat_manager.proto",
+}
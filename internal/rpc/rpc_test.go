@@ -0,0 +1,218 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	pb "github.com/scttfrdmn/macos-nat-manager/internal/rpc/natmanagerv1"
+)
+
+// stubController serves devices and connections set by the test
+type stubController struct {
+	mu          sync.Mutex
+	devices     []nat.Device
+	connections []nat.Connection
+	forwards    []config.PortForward
+	running     bool
+}
+
+func (c *stubController) Status() (*nat.Status, error) {
+	return &nat.Status{Active: c.running, ExternalIP: "10.0.0.5"}, nil
+}
+
+func (c *stubController) Devices() ([]nat.Device, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]nat.Device{}, c.devices...), nil
+}
+
+func (c *stubController) Connections() ([]nat.Connection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]nat.Connection{}, c.connections...), nil
+}
+
+func (c *stubController) KillConnections(string) (int, error) {
+	return 0, nil
+}
+
+func (c *stubController) Traffic() (map[string]nat.Traffic, error) {
+	return map[string]nat.Traffic{"192.168.100.10": {BytesIn: 1000}}, nil
+}
+
+func (c *stubController) Forwards() ([]config.PortForward, error) {
+	return c.forwards, nil
+}
+
+func (c *stubController) AddForward(forward config.PortForward) error {
+	if forward.ExternalPort == 0 {
+		return fmt.Errorf("%w: external port missing", api.ErrInvalid)
+	}
+	c.forwards = append(c.forwards, forward)
+	return nil
+}
+
+func (c *stubController) RemoveForward(port int) error {
+	return fmt.Errorf("%w: no port forward for port %d", api.ErrNotFound, port)
+}
+
+func (c *stubController) Start() (*nat.Status, error) {
+	if c.running {
+		return nil, nat.ErrAlreadyRunning
+	}
+	c.running = true
+	return c.Status()
+}
+
+func (c *stubController) Stop() (*nat.Status, error) {
+	if !c.running {
+		return nil, nat.ErrNotRunning
+	}
+	c.running = false
+	return c.Status()
+}
+
+// dial serves ctrl in memory and returns a client for it
+func dial(t *testing.T, ctrl Controller) pb.NATManagerClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := New(ctrl, Config{Token: "secret"})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewNATManagerClient(conn)
+}
+
+// withToken returns a context sending token
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestControl(t *testing.T) {
+	client := dial(t, &stubController{})
+	ctx := withToken("secret")
+
+	for _, token := range []string{"", "wrong"} {
+		if _, err := client.GetStatus(withToken(token), &pb.GetStatusRequest{}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("Token %q: expected Unauthenticated, got %v", token, err)
+		}
+	}
+
+	st, err := client.Start(ctx, &pb.StartRequest{})
+	if err != nil || !st.GetActive() || st.GetExternalIp() != "10.0.0.5" {
+		t.Fatalf("Start = %v, %v", st, err)
+	}
+	if _, err := client.Start(ctx, &pb.StartRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Starting twice: expected FailedPrecondition, got %v", err)
+	}
+
+	forward := &pb.PortForward{Protocol: "tcp", ExternalPort: 8080, InternalIp: "192.168.100.50", InternalPort: 80}
+	if _, err := client.AddForward(ctx, &pb.AddForwardRequest{Forward: forward}); err != nil {
+		t.Errorf("AddForward failed: %v", err)
+	}
+	if _, err := client.AddForward(ctx, &pb.AddForwardRequest{Forward: &pb.PortForward{Protocol: "tcp"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Invalid forward: expected InvalidArgument, got %v", err)
+	}
+	forwards, err := client.ListForwards(ctx, &pb.ListForwardsRequest{})
+	if err != nil || len(forwards.GetForwards()) != 1 || forwards.Forwards[0].GetInternalPort() != 80 {
+		t.Errorf("ListForwards = %v, %v", forwards, err)
+	}
+	if _, err := client.RemoveForward(ctx, &pb.RemoveForwardRequest{ExternalPort: 9090}); status.Code(err) != codes.NotFound {
+		t.Errorf("Missing forward: expected NotFound, got %v", err)
+	}
+}
+
+func TestWatchDevices(t *testing.T) {
+	ctrl := &stubController{devices: []nat.Device{{IP: "192.168.100.10", MAC: "aa:aa:aa:aa:aa:01", Online: true}}}
+	client := dial(t, ctrl)
+
+	ctx, cancel := context.WithCancel(withToken("secret"))
+	defer cancel()
+	stream, err := client.WatchDevices(ctx, &pb.WatchRequest{IntervalMs: 1})
+	if err != nil {
+		t.Fatalf("WatchDevices failed: %v", err)
+	}
+	event, err := stream.Recv()
+	if err != nil || event.GetChange() != pb.Change_CHANGE_ADDED || event.GetDevice().GetMac() != "aa:aa:aa:aa:aa:01" {
+		t.Fatalf("First event = %v, %v", event, err)
+	}
+
+	ctrl.mu.Lock()
+	ctrl.devices = []nat.Device{{IP: "192.168.100.11", MAC: "aa:aa:aa:aa:aa:02"}}
+	ctrl.mu.Unlock()
+
+	var changes []string
+	for len(changes) < 2 {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		changes = append(changes, fmt.Sprintf("%s %s", event.GetChange(), event.GetDevice().GetIp()))
+	}
+	if changes[0] != "CHANGE_ADDED 192.168.100.11" || changes[1] != "CHANGE_REMOVED 192.168.100.10" {
+		t.Errorf("Changes = %v", changes)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	previous := map[string]nat.Connection{
+		"tcp a b": {State: "ESTABLISHED"},
+		"tcp a c": {State: "SYN_SENT"},
+		"udp a d": {State: "SINGLE"},
+	}
+	current := map[string]nat.Connection{
+		"tcp a b": {State: "ESTABLISHED"},
+		"tcp a c": {State: "ESTABLISHED"},
+		"tcp a e": {State: "SYN_SENT"},
+	}
+	changes := diff(previous, current, func(before, after nat.Connection) bool { return before.State != after.State })
+	expected := []change{
+		{"tcp a e", pb.Change_CHANGE_ADDED},
+		{"tcp a c", pb.Change_CHANGE_UPDATED},
+		{"udp a d", pb.Change_CHANGE_REMOVED},
+	}
+	if fmt.Sprint(changes) != fmt.Sprint(expected) {
+		t.Errorf("diff = %v, expected %v", changes, expected)
+	}
+}
+
+func TestTrafficSample(t *testing.T) {
+	at := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	previous := map[string]nat.Traffic{"192.168.100.10": {BytesIn: 1000, BytesOut: 500}}
+	current := map[string]nat.Traffic{
+		"192.168.100.10": {BytesIn: 3000, BytesOut: 100},
+		"192.168.100.2":  {BytesIn: 10},
+	}
+	sample := trafficSample(previous, current, 2*time.Second, at)
+	if len(sample.GetDevices()) != 2 || sample.Devices[0].GetIp() != "192.168.100.10" {
+		t.Fatalf("Sample = %v", sample)
+	}
+	first := sample.Devices[0]
+	if first.GetRateIn() != 1000 || first.GetRateOut() != 0 {
+		t.Errorf("Rates = %v in, %v out, expected 1000 in and 0 after the counter reset", first.GetRateIn(), first.GetRateOut())
+	}
+	if sample.Devices[1].GetRateIn() != 0 {
+		t.Errorf("A new device should have no rate yet, got %v", sample.Devices[1].GetRateIn())
+	}
+}
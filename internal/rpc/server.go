@@ -0,0 +1,280 @@
+// Package rpc serves the gRPC control API defined in
+// proto/natmanager/v1/nat_manager.proto
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/api"
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	pb "github.com/scttfrdmn/macos-nat-manager/internal/rpc/natmanagerv1"
+)
+
+// Controller is what the gRPC API reads and changes: what the REST API
+// serves and the traffic counters of the devices
+type Controller interface {
+	api.Controller
+	Traffic() (map[string]nat.Traffic, error)
+}
+
+// Config configures the gRPC server
+type Config struct {
+	Token string     // API token every call must send
+	Audit *audit.Log // records every call when set
+}
+
+// server implements the NATManager service on a Controller
+type server struct {
+	pb.UnimplementedNATManagerServer
+	ctrl Controller
+}
+
+// New returns a gRPC server serving the NATManager service from ctrl
+func New(ctrl Controller, cfg Config) *grpc.Server {
+	a := authenticator{token: cfg.Token, audit: cfg.Audit}
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(a.unary),
+		grpc.ChainStreamInterceptor(a.stream),
+	)
+	pb.RegisterNATManagerServer(s, &server{ctrl: ctrl})
+	return s
+}
+
+// Listen binds listen, which must be a loopback address
+func Listen(listen string) (net.Listener, error) {
+	if err := api.ValidateLoopback(listen); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", listen, err)
+	}
+	return listener, nil
+}
+
+func (s *server) GetStatus(context.Context, *pb.GetStatusRequest) (*pb.Status, error) {
+	st, err := s.ctrl.Status()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toStatus(st), nil
+}
+
+func (s *server) ListDevices(context.Context, *pb.ListDevicesRequest) (*pb.ListDevicesResponse, error) {
+	devices, err := s.ctrl.Devices()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	resp := &pb.ListDevicesResponse{}
+	for _, device := range devices {
+		resp.Devices = append(resp.Devices, toDevice(device))
+	}
+	return resp, nil
+}
+
+func (s *server) ListConnections(context.Context, *pb.ListConnectionsRequest) (*pb.ListConnectionsResponse, error) {
+	connections, err := s.ctrl.Connections()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	resp := &pb.ListConnectionsResponse{}
+	for _, connection := range connections {
+		resp.Connections = append(resp.Connections, toConnection(connection))
+	}
+	return resp, nil
+}
+
+func (s *server) ListForwards(context.Context, *pb.ListForwardsRequest) (*pb.ListForwardsResponse, error) {
+	forwards, err := s.ctrl.Forwards()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	resp := &pb.ListForwardsResponse{}
+	for _, forward := range forwards {
+		resp.Forwards = append(resp.Forwards, toForward(forward))
+	}
+	return resp, nil
+}
+
+func (s *server) AddForward(_ context.Context, req *pb.AddForwardRequest) (*pb.PortForward, error) {
+	if req.GetForward() == nil {
+		return nil, status.Error(codes.InvalidArgument, "forward missing")
+	}
+	forward := config.PortForward{
+		Protocol:     req.Forward.GetProtocol(),
+		ExternalPort: int(req.Forward.GetExternalPort()),
+		InternalIP:   req.Forward.GetInternalIp(),
+		InternalPort: int(req.Forward.GetInternalPort()),
+		Description:  req.Forward.GetDescription(),
+	}
+	if err := s.ctrl.AddForward(forward); err != nil {
+		return nil, statusError(err)
+	}
+	return toForward(forward), nil
+}
+
+func (s *server) RemoveForward(_ context.Context, req *pb.RemoveForwardRequest) (*pb.RemoveForwardResponse, error) {
+	if err := s.ctrl.RemoveForward(int(req.GetExternalPort())); err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.RemoveForwardResponse{}, nil
+}
+
+func (s *server) Start(context.Context, *pb.StartRequest) (*pb.Status, error) {
+	st, err := s.ctrl.Start()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toStatus(st), nil
+}
+
+func (s *server) Stop(context.Context, *pb.StopRequest) (*pb.Status, error) {
+	st, err := s.ctrl.Stop()
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return toStatus(st), nil
+}
+
+// statusError maps a controller error to the gRPC status of its kind
+func statusError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, api.ErrInvalid):
+		code = codes.InvalidArgument
+	case errors.Is(err, api.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, nat.ErrConflict), errors.Is(err, nat.ErrNotRunning):
+		code = codes.FailedPrecondition
+	}
+	return status.Error(code, err.Error())
+}
+
+// authenticator checks the API token of every call and records the calls
+// in the audit log
+type authenticator struct {
+	token string
+	audit *audit.Log
+}
+
+func (a authenticator) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := a.check(ctx); err != nil {
+		a.record(ctx, info.FullMethod, err)
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	a.record(ctx, info.FullMethod, err)
+	return resp, err
+}
+
+func (a authenticator) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.check(ss.Context()); err != nil {
+		a.record(ss.Context(), info.FullMethod, err)
+		return err
+	}
+	a.record(ss.Context(), info.FullMethod, nil)
+	return handler(srv, ss)
+}
+
+// check rejects calls without the bearer token
+func (a authenticator) check(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		given, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && a.token != "" && subtle.ConstantTimeCompare([]byte(given), []byte(a.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid API token")
+}
+
+// record adds a call to the audit log
+func (a authenticator) record(ctx context.Context, method string, err error) {
+	if a.audit == nil {
+		return
+	}
+	actor := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		actor = p.Addr.String()
+		if host, _, err := net.SplitHostPort(actor); err == nil {
+			actor = host
+		}
+	}
+	_ = a.audit.Record(audit.Entry{
+		Source: audit.SourceAPI,
+		Actor:  actor,
+		Action: "gRPC " + method,
+		Result: status.Code(err).String(),
+	})
+}
+
+func toStatus(st *nat.Status) *pb.Status {
+	return &pb.Status{
+		Active:            st.Active,
+		ExternalIp:        st.ExternalIP,
+		BytesIn:           st.BytesIn,
+		BytesOut:          st.BytesOut,
+		IpForwarding:      st.IPForwarding,
+		PfEnabled:         st.PFCTLEnabled,
+		DhcpRunning:       st.DHCPRunning,
+		ConnectedDevices:  int32(len(st.ConnectedDevices)),
+		ActiveConnections: int32(len(st.ActiveConnections)),
+	}
+}
+
+func toDevice(device nat.Device) *pb.Device {
+	return &pb.Device{
+		Ip:             device.IP,
+		Mac:            device.MAC,
+		Vendor:         device.Vendor,
+		Hostname:       device.Hostname,
+		Type:           device.Type,
+		Online:         device.Online,
+		LeaseRemaining: device.LeaseRemaining,
+		FirstSeen:      timestamp(device.FirstSeen),
+		LastSeen:       timestamp(device.LastSeen),
+	}
+}
+
+func toConnection(connection nat.Connection) *pb.Connection {
+	return &pb.Connection{
+		Source:      connection.Source,
+		Destination: connection.Destination,
+		Protocol:    connection.Protocol,
+		State:       connection.State,
+		Bytes:       connection.Bytes,
+	}
+}
+
+func toForward(forward config.PortForward) *pb.PortForward {
+	return &pb.PortForward{
+		Protocol:     forward.Protocol,
+		ExternalPort: int32(forward.ExternalPort),
+		InternalIp:   forward.InternalIP,
+		InternalPort: int32(forward.InternalPort),
+		Description:  forward.Description,
+	}
+}
+
+// timestamp converts t, leaving unknown times unset
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
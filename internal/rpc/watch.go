@@ -0,0 +1,204 @@
+package rpc
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	pb "github.com/scttfrdmn/macos-nat-manager/internal/rpc/natmanagerv1"
+)
+
+// Polling intervals of watches
+const (
+	DefaultInterval = 2 * time.Second
+	minInterval     = 500 * time.Millisecond
+)
+
+// change is what happened to the object of a key between two polls
+type change struct {
+	key    string
+	change pb.Change
+}
+
+// diff returns the keys added to, changed in and removed from previous,
+// each ordered by key. updated tells whether an object changed.
+func diff[T any](previous, current map[string]T, updated func(before, after T) bool) []change {
+	var changes []change
+	for key, object := range current {
+		old, ok := previous[key]
+		switch {
+		case !ok:
+			changes = append(changes, change{key, pb.Change_CHANGE_ADDED})
+		case updated(old, object):
+			changes = append(changes, change{key, pb.Change_CHANGE_UPDATED})
+		}
+	}
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			changes = append(changes, change{key, pb.Change_CHANGE_REMOVED})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].change != changes[j].change {
+			return changes[i].change < changes[j].change
+		}
+		return changes[i].key < changes[j].key
+	})
+	return changes
+}
+
+// poll calls check right away and then every interval of req until ctx is
+// done or check fails
+func poll(ctx context.Context, req *pb.WatchRequest, check func(now time.Time) error) error {
+	interval := DefaultInterval
+	if req.GetIntervalMs() > 0 {
+		interval = max(time.Duration(req.GetIntervalMs())*time.Millisecond, minInterval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := check(time.Now()); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// connectionKey identifies a connection across polls
+func connectionKey(c nat.Connection) string {
+	return c.Protocol + " " + c.Source + " " + c.Destination
+}
+
+// deviceKey identifies a device across polls
+func deviceKey(d nat.Device) string {
+	if d.MAC != "" {
+		return d.MAC
+	}
+	return d.IP
+}
+
+// WatchConnections sends every connection open at the first poll as added,
+// then connections as they open, change state and close
+func (s *server) WatchConnections(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.ConnectionEvent]) error {
+	previous := map[string]nat.Connection{}
+	return poll(stream.Context(), req, func(now time.Time) error {
+		connections, err := s.ctrl.Connections()
+		if err != nil {
+			return statusError(err)
+		}
+		current := make(map[string]nat.Connection, len(connections))
+		for _, connection := range connections {
+			current[connectionKey(connection)] = connection
+		}
+		for _, c := range diff(previous, current, func(before, after nat.Connection) bool { return before.State != after.State }) {
+			connection, ok := current[c.key]
+			if !ok {
+				connection = previous[c.key]
+			}
+			event := &pb.ConnectionEvent{Time: timestamppb.New(now), Change: c.change, Connection: toConnection(connection)}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+		previous = current
+		return nil
+	})
+}
+
+// WatchDevices sends every device known at the first poll as added, then
+// devices as they join, change address, name or presence, and leave
+func (s *server) WatchDevices(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.DeviceEvent]) error {
+	previous := map[string]nat.Device{}
+	return poll(stream.Context(), req, func(now time.Time) error {
+		devices, err := s.ctrl.Devices()
+		if err != nil {
+			return statusError(err)
+		}
+		current := make(map[string]nat.Device, len(devices))
+		for _, device := range devices {
+			current[deviceKey(device)] = device
+		}
+		for _, c := range diff(previous, current, deviceChanged) {
+			device, ok := current[c.key]
+			if !ok {
+				device = previous[c.key]
+			}
+			event := &pb.DeviceEvent{Time: timestamppb.New(now), Change: c.change, Device: toDevice(device)}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+		previous = current
+		return nil
+	})
+}
+
+// deviceChanged reports whether a device changed in a way worth an event;
+// the lease countdown and last seen time change at every poll
+func deviceChanged(before, after nat.Device) bool {
+	return before.IP != after.IP || before.Hostname != after.Hostname || before.Online != after.Online ||
+		before.Vendor != after.Vendor || before.Type != after.Type
+}
+
+// WatchTraffic sends the counters of every device at each poll, with the
+// rates since the previous poll
+func (s *server) WatchTraffic(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.TrafficSample]) error {
+	var previous map[string]nat.Traffic
+	var last time.Time
+	return poll(stream.Context(), req, func(now time.Time) error {
+		traffic, err := s.ctrl.Traffic()
+		if err != nil {
+			return statusError(err)
+		}
+		if err := stream.Send(trafficSample(previous, traffic, now.Sub(last), now)); err != nil {
+			return err
+		}
+		previous, last = traffic, now
+		return nil
+	})
+}
+
+// trafficSample returns the sample of the current counters, ordered by
+// address, with rates over elapsed when previous counters are known
+func trafficSample(previous, current map[string]nat.Traffic, elapsed time.Duration, now time.Time) *pb.TrafficSample {
+	ips := make([]string, 0, len(current))
+	for ip := range current {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	sample := &pb.TrafficSample{Time: timestamppb.New(now)}
+	for _, ip := range ips {
+		t := current[ip]
+		device := &pb.DeviceTraffic{
+			Ip:         ip,
+			BytesIn:    t.BytesIn,
+			BytesOut:   t.BytesOut,
+			PacketsIn:  t.PacketsIn,
+			PacketsOut: t.PacketsOut,
+		}
+		if old, ok := previous[ip]; ok && elapsed > 0 {
+			device.RateIn = rate(old.BytesIn, t.BytesIn, elapsed)
+			device.RateOut = rate(old.BytesOut, t.BytesOut, elapsed)
+		}
+		sample.Devices = append(sample.Devices, device)
+	}
+	return sample
+}
+
+// rate returns the bytes per second between two counter readings, 0 when
+// the counters were reset in between
+func rate(before, after uint64, elapsed time.Duration) float64 {
+	if after < before {
+		return 0
+	}
+	return float64(after-before) / elapsed.Seconds()
+}
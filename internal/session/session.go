@@ -0,0 +1,122 @@
+// Package session records monitor snapshots to a file and loads them back
+// for replay
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Version is the current session file format version
+const Version = 1
+
+// Header describes the NAT setup a session was recorded on
+type Header struct {
+	Version           int       `json:"version"`
+	Started           time.Time `json:"started"`
+	ExternalInterface string    `json:"external_interface"`
+	InternalInterface string    `json:"internal_interface"`
+	InternalNetwork   string    `json:"internal_network"`
+}
+
+// Frame is a single recorded monitor snapshot
+type Frame struct {
+	Time   time.Time   `json:"time"`
+	Status *nat.Status `json:"status"`
+}
+
+// Session is a loaded recording
+type Session struct {
+	Header Header
+	Frames []Frame
+}
+
+// Duration returns the time between the first and last frame
+func (s *Session) Duration() time.Duration {
+	if len(s.Frames) < 2 {
+		return 0
+	}
+	return s.Frames[len(s.Frames)-1].Time.Sub(s.Frames[0].Time)
+}
+
+// Recorder appends frames to a session file. The file is JSON Lines: a
+// header object followed by one frame per line, so a recording interrupted
+// overnight is still readable up to its last complete frame.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewRecorder writes the header and returns a recorder appending to w
+func NewRecorder(w io.Writer, header Header) (*Recorder, error) {
+	header.Version = Version
+	if header.Started.IsZero() {
+		header.Started = time.Now()
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("failed to write session header: %w", err)
+	}
+	return &Recorder{enc: enc}, nil
+}
+
+// Record appends a frame
+func (r *Recorder) Record(at time.Time, status *nat.Status) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.enc.Encode(Frame{Time: at, Status: status}); err != nil {
+		return fmt.Errorf("failed to record frame: %w", err)
+	}
+	return nil
+}
+
+// Load reads a session recording. A truncated final line, as left by an
+// interrupted recording, is ignored.
+func Load(r io.Reader) (*Session, error) {
+	reader := bufio.NewReader(r)
+
+	line, err := reader.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("failed to read session header: %w", err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(line, &s.Header); err != nil {
+		return nil, fmt.Errorf("invalid session header: %w", err)
+	}
+	if s.Header.Version != Version {
+		return nil, fmt.Errorf("unsupported session version %d", s.Header.Version)
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var frame Frame
+			if jsonErr := json.Unmarshal(line, &frame); jsonErr != nil {
+				if err == io.EOF {
+					break // truncated last frame
+				}
+				return nil, fmt.Errorf("invalid frame %d: %w", len(s.Frames)+1, jsonErr)
+			}
+			if frame.Status != nil {
+				s.Frames = append(s.Frames, frame)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read session: %w", err)
+		}
+	}
+
+	return &s, nil
+}
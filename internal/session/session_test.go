@@ -0,0 +1,85 @@
+package session
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/fake"
+)
+
+func TestRecordAndLoad(t *testing.T) {
+	g := fake.New(1, "192.168.100")
+	devices := g.Devices(3)
+	conns := g.Connections(devices, 10)
+
+	var buf bytes.Buffer
+	recorder, err := NewRecorder(&buf, Header{
+		Started:           fake.Epoch,
+		ExternalInterface: "en0",
+		InternalInterface: "bridge100",
+		InternalNetwork:   "192.168.100",
+	})
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		conns = g.Step(devices, conns)
+		status := g.Status(devices, conns)
+		if err := recorder.Record(fake.Epoch.Add(time.Duration(i)*time.Minute), status); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	recording, err := Load(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if recording.Header.Version != Version || recording.Header.ExternalInterface != "en0" {
+		t.Errorf("Unexpected header: %+v", recording.Header)
+	}
+	if len(recording.Frames) != 3 {
+		t.Fatalf("Expected 3 frames, got %d", len(recording.Frames))
+	}
+	if recording.Duration() != 2*time.Minute {
+		t.Errorf("Expected duration 2m, got %s", recording.Duration())
+	}
+	if !reflect.DeepEqual(recording.Frames[0].Status.ConnectedDevices, devices) {
+		t.Error("Devices did not round-trip")
+	}
+}
+
+func TestLoadTruncatedSession(t *testing.T) {
+	var buf bytes.Buffer
+	recorder, _ := NewRecorder(&buf, Header{})
+	_ = recorder.Record(time.Now(), fake.New(2, "").Status(nil, nil))
+
+	// Simulate a recording killed halfway through writing a frame
+	data := buf.String() + `{"time":"2025-01-01T12:00:00Z","status":{"act`
+
+	recording, err := Load(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("Load failed on truncated session: %v", err)
+	}
+	if len(recording.Frames) != 1 {
+		t.Errorf("Expected 1 complete frame, got %d", len(recording.Frames))
+	}
+}
+
+func TestLoadRejectsInvalidSessions(t *testing.T) {
+	testCases := []string{
+		"",
+		"not json\n",
+		`{"version":99}` + "\n",
+		`{"version":1}` + "\n" + "garbage\n" + `{"time":"2025-01-01T12:00:00Z","status":{}}` + "\n",
+	}
+
+	for _, data := range testCases {
+		if _, err := Load(strings.NewReader(data)); err == nil {
+			t.Errorf("Load(%q) should fail", data)
+		}
+	}
+}
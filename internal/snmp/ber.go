@@ -0,0 +1,391 @@
+package snmp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tags of the ASN.1 and SNMP types used
+const (
+	tagInteger        = 0x02
+	tagOctetString    = 0x04
+	tagNull           = 0x05
+	tagOID            = 0x06
+	tagSequence       = 0x30
+	tagIPAddress      = 0x40
+	tagCounter32      = 0x41
+	tagGauge32        = 0x42
+	tagTimeTicks      = 0x43
+	tagCounter64      = 0x46
+	tagNoSuchObject   = 0x80
+	tagNoSuchInstance = 0x81
+	tagEndOfMibView   = 0x82
+
+	pduGet      = 0xa0
+	pduGetNext  = 0xa1
+	pduResponse = 0xa2
+	pduSet      = 0xa3
+	pduGetBulk  = 0xa5
+)
+
+var errMalformed = errors.New("malformed SNMP message")
+
+// OID is an object identifier
+type OID []uint32
+
+// ParseOID parses a dotted object identifier such as 1.3.6.1.2.1.1
+func ParseOID(s string) (OID, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", s)
+	}
+	oid := make(OID, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", s)
+		}
+		oid[i] = uint32(n)
+	}
+	return oid, nil
+}
+
+// mustOID parses an OID known to be valid
+func mustOID(s string) OID {
+	oid, err := ParseOID(s)
+	if err != nil {
+		panic(err)
+	}
+	return oid
+}
+
+func (o OID) String() string {
+	parts := make([]string, len(o))
+	for i, n := range o {
+		parts[i] = strconv.FormatUint(uint64(n), 10)
+	}
+	return strings.Join(parts, ".")
+}
+
+// HasPrefix reports whether o is within the subtree of prefix
+func (o OID) HasPrefix(prefix OID) bool {
+	return len(o) >= len(prefix) && slices.Equal(o[:len(prefix)], prefix)
+}
+
+// Append returns o followed by arcs
+func (o OID) Append(arcs ...uint32) OID {
+	return append(slices.Clip(o), arcs...)
+}
+
+// Value is the type and encoded content of a variable
+type Value struct {
+	Tag     byte
+	Content []byte
+}
+
+// Integer returns an INTEGER
+func Integer(v int64) Value {
+	return Value{tagInteger, encodeInt(v)}
+}
+
+// OctetString returns an OCTET STRING
+func OctetString(s string) Value {
+	return Value{tagOctetString, []byte(s)}
+}
+
+// TruthValue returns true(1) or false(2)
+func TruthValue(b bool) Value {
+	if b {
+		return Integer(1)
+	}
+	return Integer(2)
+}
+
+// IPAddress returns an IpAddress, 0.0.0.0 for anything but IPv4
+func IPAddress(addr netip.Addr) Value {
+	if !addr.Is4() {
+		addr = netip.IPv4Unspecified()
+	}
+	ip := addr.As4()
+	return Value{tagIPAddress, ip[:]}
+}
+
+// Counter32 returns a Counter32, which wraps around
+func Counter32(v uint64) Value {
+	return Value{tagCounter32, encodeUint(v & math.MaxUint32)}
+}
+
+// Gauge32 returns a Gauge32, which sticks at its maximum
+func Gauge32(v uint64) Value {
+	return Value{tagGauge32, encodeUint(min(v, math.MaxUint32))}
+}
+
+// Counter64 returns a Counter64, which SNMPv1 does not have
+func Counter64(v uint64) Value {
+	return Value{tagCounter64, encodeUint(v)}
+}
+
+// TimeTicks returns d in hundredths of a second
+func TimeTicks(d time.Duration) Value {
+	return Value{tagTimeTicks, encodeUint(uint64(d/(10*time.Millisecond)) & math.MaxUint32)}
+}
+
+// ObjectID returns an OBJECT IDENTIFIER
+func ObjectID(oid OID) Value {
+	return Value{tagOID, encodeOID(oid)}
+}
+
+// exception values of SNMPv2 responses, and the NULL of requests
+var (
+	null           = Value{Tag: tagNull}
+	noSuchObject   = Value{Tag: tagNoSuchObject}
+	noSuchInstance = Value{Tag: tagNoSuchInstance}
+	endOfMibView   = Value{Tag: tagEndOfMibView}
+)
+
+// appendTLV appends a tag, the definite length of content and content
+func appendTLV(b []byte, tag byte, content []byte) []byte {
+	b = append(b, tag)
+	switch n := len(content); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xff:
+		b = append(b, 0x81, byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	return append(b, content...)
+}
+
+// encodeInt returns the shortest two's complement of v
+func encodeInt(v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 127 || v < -128 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return b
+}
+
+// encodeUint returns the shortest encoding of v that reads as positive
+func encodeUint(v uint64) []byte {
+	b := []byte{byte(v)}
+	for v > 127 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return b
+}
+
+// encodeOID encodes the first two arcs as one, and every arc in base 128
+func encodeOID(oid OID) []byte {
+	if len(oid) < 2 {
+		return []byte{0}
+	}
+	arcs := make([]uint64, 0, len(oid)-1)
+	arcs = append(arcs, uint64(oid[0])*40+uint64(oid[1]))
+	for _, arc := range oid[2:] {
+		arcs = append(arcs, uint64(arc))
+	}
+	var b []byte
+	for _, arc := range arcs {
+		chunk := []byte{byte(arc & 0x7f)}
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			chunk = append([]byte{byte(arc&0x7f) | 0x80}, chunk...)
+		}
+		b = append(b, chunk...)
+	}
+	return b
+}
+
+// decodeInt decodes a two's complement integer of up to 8 bytes
+func decodeInt(b []byte) (int64, error) {
+	if len(b) == 0 || len(b) > 8 {
+		return 0, errMalformed
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v, nil
+}
+
+// decodeOID decodes an OBJECT IDENTIFIER
+func decodeOID(b []byte) (OID, error) {
+	var arcs []uint64
+	var arc uint64
+	for i, c := range b {
+		if arc > math.MaxUint32>>7 {
+			return nil, errMalformed
+		}
+		arc = arc<<7 | uint64(c&0x7f)
+		if c&0x80 == 0 {
+			arcs = append(arcs, arc)
+			arc = 0
+		} else if i == len(b)-1 {
+			return nil, errMalformed
+		}
+	}
+	if len(arcs) == 0 {
+		return nil, errMalformed
+	}
+	first := min(arcs[0]/40, 2)
+	oid := OID{uint32(first), uint32(arcs[0] - first*40)}
+	for _, arc := range arcs[1:] {
+		oid = append(oid, uint32(arc))
+	}
+	return oid, nil
+}
+
+// decoder reads the TLVs of a buffer in turn
+type decoder struct {
+	b []byte
+}
+
+// next returns the tag and content of the next TLV
+func (d *decoder) next() (byte, []byte, error) {
+	if len(d.b) < 2 {
+		return 0, nil, errMalformed
+	}
+	tag, n, rest := d.b[0], int(d.b[1]), d.b[2:]
+	if n >= 0x80 {
+		size := n & 0x7f
+		if size == 0 || size > 3 || len(rest) < size {
+			return 0, nil, errMalformed
+		}
+		n = 0
+		for _, c := range rest[:size] {
+			n = n<<8 | int(c)
+		}
+		rest = rest[size:]
+	}
+	if len(rest) < n {
+		return 0, nil, errMalformed
+	}
+	d.b = rest[n:]
+	return tag, rest[:n], nil
+}
+
+// expect returns the content of the next TLV, which must have tag
+func (d *decoder) expect(tag byte) ([]byte, error) {
+	got, content, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	if got != tag {
+		return nil, fmt.Errorf("%w: tag 0x%02x instead of 0x%02x", errMalformed, got, tag)
+	}
+	return content, nil
+}
+
+// integer returns the next INTEGER
+func (d *decoder) integer() (int64, error) {
+	content, err := d.expect(tagInteger)
+	if err != nil {
+		return 0, err
+	}
+	return decodeInt(content)
+}
+
+// binding is a variable binding of a PDU
+type binding struct {
+	oid   OID
+	value Value
+}
+
+// message is an SNMPv1 or SNMPv2c message
+type message struct {
+	version   int64
+	community string
+	pdu       byte
+	requestID int64
+	status    int64 // non-repeaters of a GetBulkRequest
+	index     int64 // max-repetitions of a GetBulkRequest
+	bindings  []binding
+}
+
+// parseMessage decodes a community-based message
+func parseMessage(b []byte) (message, error) {
+	var m message
+	outer := decoder{b}
+	content, err := outer.expect(tagSequence)
+	if err != nil {
+		return m, err
+	}
+	d := decoder{content}
+	if m.version, err = d.integer(); err != nil {
+		return m, err
+	}
+	community, err := d.expect(tagOctetString)
+	if err != nil {
+		return m, err
+	}
+	m.community = string(community)
+	var pdu []byte
+	if m.pdu, pdu, err = d.next(); err != nil {
+		return m, err
+	}
+
+	d = decoder{pdu}
+	if m.requestID, err = d.integer(); err != nil {
+		return m, err
+	}
+	if m.status, err = d.integer(); err != nil {
+		return m, err
+	}
+	if m.index, err = d.integer(); err != nil {
+		return m, err
+	}
+	list, err := d.expect(tagSequence)
+	if err != nil {
+		return m, err
+	}
+	for bindings := (decoder{list}); len(bindings.b) > 0; {
+		content, err := bindings.expect(tagSequence)
+		if err != nil {
+			return m, err
+		}
+		vb := decoder{content}
+		raw, err := vb.expect(tagOID)
+		if err != nil {
+			return m, err
+		}
+		oid, err := decodeOID(raw)
+		if err != nil {
+			return m, err
+		}
+		tag, value, err := vb.next()
+		if err != nil {
+			return m, err
+		}
+		m.bindings = append(m.bindings, binding{oid, Value{tag, value}})
+	}
+	return m, nil
+}
+
+// encode returns the message in BER
+func (m message) encode() []byte {
+	var list []byte
+	for _, b := range m.bindings {
+		vb := appendTLV(nil, tagOID, encodeOID(b.oid))
+		vb = appendTLV(vb, b.value.Tag, b.value.Content)
+		list = appendTLV(list, tagSequence, vb)
+	}
+	pdu := appendTLV(nil, tagInteger, encodeInt(m.requestID))
+	pdu = appendTLV(pdu, tagInteger, encodeInt(m.status))
+	pdu = appendTLV(pdu, tagInteger, encodeInt(m.index))
+	pdu = appendTLV(pdu, tagSequence, list)
+
+	content := appendTLV(nil, tagInteger, encodeInt(m.version))
+	content = appendTLV(content, tagOctetString, []byte(m.community))
+	content = appendTLV(content, m.pdu, pdu)
+	return appendTLV(nil, tagSequence, content)
+}
@@ -0,0 +1,158 @@
+package snmp
+
+import (
+	_ "embed"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// MIBText is NAT-MANAGER-MIB, which describes the NAT objects for
+// management tools
+//
+//go:embed NAT-MANAGER-MIB.txt
+var MIBText string
+
+// NATManagerOID is the root of NAT-MANAGER-MIB, in the Net-SNMP playpen
+// reserved for local use
+var NATManagerOID = mustOID("1.3.6.1.4.1.8072.9999.9999.1")
+
+// Subtrees of the standard MIBs served
+var (
+	systemOID   = mustOID("1.3.6.1.2.1.1")     // SNMPv2-MIB system
+	ifNumberOID = mustOID("1.3.6.1.2.1.2.1.0") // IF-MIB ifNumber
+	ifEntryOID  = mustOID("1.3.6.1.2.1.2.2.1")
+	ifXEntryOID = mustOID("1.3.6.1.2.1.31.1.1.1")
+)
+
+// Interface is a network interface with its counters
+type Interface struct {
+	Index       int
+	Up          bool
+	MTU         int
+	PhysAddress net.HardwareAddr
+	Counters    ifstats.Counters
+}
+
+// Interfaces returns counters with the index, state and address of their
+// interface. Interfaces that are gone are numbered after the others.
+func Interfaces(counters []ifstats.Counters) []Interface {
+	var interfaces []Interface
+	last := 0
+	for _, c := range counters {
+		i := Interface{Counters: c}
+		if iface, err := net.InterfaceByName(c.Interface); err == nil {
+			i.Index, i.Up, i.MTU, i.PhysAddress = iface.Index, iface.Flags&net.FlagUp != 0, iface.MTU, iface.HardwareAddr
+			last = max(last, i.Index)
+		}
+		interfaces = append(interfaces, i)
+	}
+	for n := range interfaces {
+		if interfaces[n].Index == 0 {
+			last++
+			interfaces[n].Index = last
+		}
+	}
+	return interfaces
+}
+
+// ifType returns the IANAifType of an interface by its name
+func ifType(name string) int64 {
+	switch {
+	case strings.HasPrefix(name, "bridge"):
+		return 209 // bridge
+	case strings.HasPrefix(name, "en"):
+		return 6 // ethernetCsmacd
+	case strings.HasPrefix(name, "utun"), strings.HasPrefix(name, "ipsec"):
+		return 131 // tunnel
+	case strings.HasPrefix(name, "ppp"):
+		return 23 // ppp
+	}
+	return 1 // other
+}
+
+// Snapshot is the state of an instance served by the agent
+type Snapshot struct {
+	Description string // sysDescr
+	Name        string // sysName
+	Contact     string
+	Location    string
+	Uptime      time.Duration // of the agent
+	Instance    string
+	Status      *nat.Status
+	Interfaces  []Interface
+	Devices     []nat.Device
+	Leases      int
+}
+
+// Build returns the objects of a snapshot: the system group, the ifTable
+// and ifXTable of the interfaces and the scalars of NAT-MANAGER-MIB
+func Build(s Snapshot) *MIB {
+	mib := &MIB{}
+
+	mib.Add(systemOID.Append(1, 0), OctetString(s.Description))
+	mib.Add(systemOID.Append(2, 0), ObjectID(NATManagerOID))
+	mib.Add(systemOID.Append(3, 0), TimeTicks(s.Uptime))
+	mib.Add(systemOID.Append(4, 0), OctetString(s.Contact))
+	mib.Add(systemOID.Append(5, 0), OctetString(s.Name))
+	mib.Add(systemOID.Append(6, 0), OctetString(s.Location))
+	mib.Add(systemOID.Append(7, 0), Integer(4)) // sysServices: internet
+
+	mib.Add(ifNumberOID, Integer(int64(len(s.Interfaces))))
+	for _, i := range s.Interfaces {
+		index := uint32(i.Index)
+		status := int64(2) // down
+		if i.Up {
+			status = 1
+		}
+		c := i.Counters
+		mib.Add(ifEntryOID.Append(1, index), Integer(int64(i.Index)))
+		mib.Add(ifEntryOID.Append(2, index), OctetString(c.Interface))
+		mib.Add(ifEntryOID.Append(3, index), Integer(ifType(c.Interface)))
+		mib.Add(ifEntryOID.Append(4, index), Integer(int64(i.MTU)))
+		mib.Add(ifEntryOID.Append(6, index), OctetString(string(i.PhysAddress)))
+		mib.Add(ifEntryOID.Append(7, index), Integer(status))
+		mib.Add(ifEntryOID.Append(8, index), Integer(status))
+		mib.Add(ifEntryOID.Append(10, index), Counter32(c.BytesIn))
+		mib.Add(ifEntryOID.Append(11, index), Counter32(c.PacketsIn))
+		mib.Add(ifEntryOID.Append(13, index), Counter32(c.DropsIn))
+		mib.Add(ifEntryOID.Append(14, index), Counter32(c.ErrorsIn))
+		mib.Add(ifEntryOID.Append(16, index), Counter32(c.BytesOut))
+		mib.Add(ifEntryOID.Append(17, index), Counter32(c.PacketsOut))
+		mib.Add(ifEntryOID.Append(20, index), Counter32(c.ErrorsOut))
+
+		mib.Add(ifXEntryOID.Append(1, index), OctetString(c.Interface))
+		mib.Add(ifXEntryOID.Append(6, index), Counter64(c.BytesIn))
+		mib.Add(ifXEntryOID.Append(7, index), Counter64(c.PacketsIn))
+		mib.Add(ifXEntryOID.Append(10, index), Counter64(c.BytesOut))
+		mib.Add(ifXEntryOID.Append(11, index), Counter64(c.PacketsOut))
+	}
+
+	status := s.Status
+	if status == nil {
+		status = &nat.Status{}
+	}
+	online := 0
+	for _, d := range s.Devices {
+		if d.Online {
+			online++
+		}
+	}
+	external, _ := netip.ParseAddr(status.ExternalIP)
+	scalars := NATManagerOID.Append(1)
+	mib.Add(scalars.Append(1, 0), OctetString(s.Instance))
+	mib.Add(scalars.Append(2, 0), TruthValue(status.Active))
+	mib.Add(scalars.Append(3, 0), IPAddress(external))
+	mib.Add(scalars.Append(4, 0), Gauge32(uint64(len(status.ActiveConnections))))
+	mib.Add(scalars.Append(5, 0), Gauge32(uint64(len(s.Devices))))
+	mib.Add(scalars.Append(6, 0), Gauge32(uint64(online)))
+	mib.Add(scalars.Append(7, 0), Gauge32(uint64(s.Leases)))
+	mib.Add(scalars.Append(8, 0), TruthValue(status.DHCPRunning))
+	mib.Add(scalars.Append(9, 0), Counter64(status.BytesIn))
+	mib.Add(scalars.Append(10, 0), Counter64(status.BytesOut))
+	return mib
+}
@@ -0,0 +1,288 @@
+// Package snmp is a minimal read-only SNMPv1 and SNMPv2c agent, exposing
+// the interface counters, lease counts and NAT state of an instance to
+// classic network management tools
+package snmp
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+)
+
+// Defaults of Options
+const (
+	DefaultPort      = 161
+	DefaultCommunity = "public"
+)
+
+const (
+	version1  = 0
+	version2c = 1
+
+	maxMessageSize = 1472 // fits an Ethernet frame
+	maxRepetitions = 64   // of a GetBulkRequest
+	cacheTTL       = 5 * time.Second
+)
+
+// Error statuses of responses
+const (
+	errTooBig      = 1
+	errNoSuchName  = 2
+	errGenErr      = 5
+	errNotWritable = 17
+)
+
+// ErrRejected wraps the errors of requests that get no response: malformed
+// messages, unknown versions and wrong communities
+var ErrRejected = errors.New("SNMP request rejected")
+
+// MIB holds the objects of the agent, looked up in OID order
+type MIB struct {
+	entries []binding
+	sorted  bool
+}
+
+// Add sets the value of oid
+func (m *MIB) Add(oid OID, value Value) {
+	m.entries = append(m.entries, binding{oid, value})
+	m.sorted = false
+}
+
+// search returns the position of oid, or where it would be
+func (m *MIB) search(oid OID) (int, bool) {
+	if !m.sorted {
+		slices.SortFunc(m.entries, func(a, b binding) int { return slices.Compare(a.oid, b.oid) })
+		m.sorted = true
+	}
+	return slices.BinarySearchFunc(m.entries, oid, func(e binding, oid OID) int { return slices.Compare(e.oid, oid) })
+}
+
+// Get returns the value of oid
+func (m *MIB) Get(oid OID) (Value, bool) {
+	i, found := m.search(oid)
+	if !found {
+		return Value{}, false
+	}
+	return m.entries[i].value, true
+}
+
+// Next returns the first object after oid
+func (m *MIB) Next(oid OID) (OID, Value, bool) {
+	i, found := m.search(oid)
+	if found {
+		i++
+	}
+	if i == len(m.entries) {
+		return nil, Value{}, false
+	}
+	return m.entries[i].oid, m.entries[i].value, true
+}
+
+// missing returns noSuchInstance for an OID next to the instances of an
+// object, and noSuchObject otherwise
+func (m *MIB) missing(oid OID) Value {
+	if len(oid) > 1 {
+		object := oid[:len(oid)-1]
+		if next, _, ok := m.Next(object); ok && next.HasPrefix(object) && len(next) == len(oid) {
+			return noSuchInstance
+		}
+	}
+	return noSuchObject
+}
+
+// next returns the first object after oid that the version can carry
+func (m *MIB) next(oid OID, version int64) (OID, Value, bool) {
+	for {
+		next, value, ok := m.Next(oid)
+		if !ok || version != version1 || value.Tag != tagCounter64 {
+			return next, value, ok
+		}
+		oid = next
+	}
+}
+
+// respond returns the response to req, and false for PDUs that get none
+func respond(req message, mib *MIB) (message, bool) {
+	resp := message{version: req.version, community: req.community, pdu: pduResponse, requestID: req.requestID}
+	failed := func(status int64, i int) message {
+		resp.status, resp.index, resp.bindings = status, int64(i+1), req.bindings
+		return resp
+	}
+
+	switch req.pdu {
+	case pduGet:
+		for i, b := range req.bindings {
+			value, ok := mib.Get(b.oid)
+			if ok && req.version == version1 && value.Tag == tagCounter64 {
+				ok = false
+			}
+			if !ok {
+				if req.version == version1 {
+					return failed(errNoSuchName, i), true
+				}
+				value = mib.missing(b.oid)
+			}
+			resp.bindings = append(resp.bindings, binding{b.oid, value})
+		}
+	case pduGetNext:
+		for i, b := range req.bindings {
+			oid, value, ok := mib.next(b.oid, req.version)
+			if !ok {
+				if req.version == version1 {
+					return failed(errNoSuchName, i), true
+				}
+				oid, value = b.oid, endOfMibView
+			}
+			resp.bindings = append(resp.bindings, binding{oid, value})
+		}
+	case pduGetBulk:
+		if req.version == version1 {
+			return resp, false
+		}
+		nonRepeaters := int(min(max(req.status, 0), int64(len(req.bindings))))
+		repetitions := int(min(max(req.index, 0), maxRepetitions))
+		for _, b := range req.bindings[:nonRepeaters] {
+			oid, value, ok := mib.Next(b.oid)
+			if !ok {
+				oid, value = b.oid, endOfMibView
+			}
+			resp.bindings = append(resp.bindings, binding{oid, value})
+		}
+		var oids []OID
+		for _, b := range req.bindings[nonRepeaters:] {
+			oids = append(oids, b.oid)
+		}
+		for range repetitions {
+			ended := true
+			for j, oid := range oids {
+				next, value, ok := mib.Next(oid)
+				if ok {
+					ended = false
+				} else {
+					next, value = oid, endOfMibView
+				}
+				resp.bindings = append(resp.bindings, binding{next, value})
+				oids[j] = next
+			}
+			if ended {
+				break
+			}
+		}
+	case pduSet:
+		if req.version == version1 {
+			return failed(errNoSuchName, 0), true
+		}
+		return failed(errNotWritable, 0), true
+	default:
+		return resp, false
+	}
+	return resp, true
+}
+
+// Options configures an agent
+type Options struct {
+	Listen    string // e.g. 192.168.100.1:161
+	Community string // public by default
+}
+
+// Agent answers SNMP requests from the objects collected, which are kept
+// for a few seconds so that walks see a consistent state
+type Agent struct {
+	conn      net.PacketConn
+	community string
+	collect   func() (*MIB, error)
+	mib       *MIB
+	collected time.Time
+}
+
+// Listen binds an agent to opts.Listen, collecting its objects with
+// collect
+func Listen(opts Options, collect func() (*MIB, error)) (*Agent, error) {
+	conn, err := net.ListenPacket("udp", opts.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", opts.Listen, err)
+	}
+	community := opts.Community
+	if community == "" {
+		community = DefaultCommunity
+	}
+	return &Agent{conn: conn, community: community, collect: collect}, nil
+}
+
+// Addr returns the address the agent listens on
+func (a *Agent) Addr() net.Addr {
+	return a.conn.LocalAddr()
+}
+
+// Close stops the agent
+func (a *Agent) Close() error {
+	return a.conn.Close()
+}
+
+// Serve answers requests until ctx is done, passing the errors of
+// requests to onError
+func (a *Agent) Serve(ctx context.Context, onError func(error)) error {
+	stop := context.AfterFunc(ctx, func() { _ = a.conn.Close() })
+	defer stop()
+
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		reply, err := a.handle(buf[:n], time.Now())
+		if err != nil {
+			onError(fmt.Errorf("request from %s: %w", addr, err))
+		}
+		if reply != nil {
+			_, _ = a.conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+// handle returns the reply to a request, if any
+func (a *Agent) handle(packet []byte, now time.Time) ([]byte, error) {
+	req, err := parseMessage(packet)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRejected, err)
+	}
+	if req.version != version1 && req.version != version2c {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrRejected, req.version)
+	}
+	if subtle.ConstantTimeCompare([]byte(req.community), []byte(a.community)) != 1 {
+		return nil, fmt.Errorf("%w: wrong community", ErrRejected)
+	}
+
+	if a.mib == nil || now.Sub(a.collected) >= cacheTTL {
+		mib, err := a.collect()
+		if err != nil {
+			resp := message{version: req.version, community: req.community, pdu: pduResponse,
+				requestID: req.requestID, status: errGenErr, bindings: req.bindings}
+			return resp.encode(), err
+		}
+		a.mib, a.collected = mib, now
+	}
+
+	resp, ok := respond(req, a.mib)
+	if !ok {
+		return nil, nil
+	}
+	reply := resp.encode()
+	for len(reply) > maxMessageSize {
+		if req.pdu != pduGetBulk || len(resp.bindings) <= 1 {
+			resp.status, resp.index, resp.bindings = errTooBig, 0, nil
+			return resp.encode(), nil
+		}
+		resp.bindings = resp.bindings[:len(resp.bindings)-1]
+		reply = resp.encode()
+	}
+	return reply, nil
+}
@@ -0,0 +1,302 @@
+package snmp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+func TestOID(t *testing.T) {
+	for _, s := range []string{"1.3.6.1.2.1.1.1.0", "1.3.6.1.4.1.8072.9999.9999.1", "2.999.4294967295", "0.0"} {
+		oid, err := ParseOID("." + s)
+		if err != nil {
+			t.Fatalf("ParseOID(%s): %v", s, err)
+		}
+		decoded, err := decodeOID(encodeOID(oid))
+		if err != nil || decoded.String() != s {
+			t.Errorf("round trip of %s = %s, %v", s, decoded, err)
+		}
+	}
+	for _, s := range []string{"", "1", "1.3.x", "1.3.4294967296"} {
+		if _, err := ParseOID(s); err == nil {
+			t.Errorf("ParseOID(%q) succeeded", s)
+		}
+	}
+	if got := hex.EncodeToString(encodeOID(mustOID("1.3.6.1.4.1.8072"))); got != "2b06010401bf08" {
+		t.Errorf("encodeOID = %s", got)
+	}
+}
+
+func TestIntegers(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 40, -1 << 63} {
+		got, err := decodeInt(encodeInt(v))
+		if err != nil || got != v {
+			t.Errorf("round trip of %d = %d, %v", v, got, err)
+		}
+	}
+	if got := hex.EncodeToString(Counter32(1<<32 + 5).Content); got != "05" {
+		t.Errorf("Counter32 does not wrap: %s", got)
+	}
+	if got := hex.EncodeToString(Gauge32(1 << 40).Content); got != "00ffffffff" {
+		t.Errorf("Gauge32 does not stick: %s", got)
+	}
+	if got := hex.EncodeToString(Counter64(1<<64 - 1).Content); got != "00ffffffffffffffff" {
+		t.Errorf("Counter64 = %s", got)
+	}
+	if got := hex.EncodeToString(TimeTicks(90 * time.Second).Content); got != "2328" {
+		t.Errorf("TimeTicks = %s", got)
+	}
+}
+
+// request returns a request for oids
+func request(version int64, community string, pdu byte, status, index int64, oids ...string) message {
+	req := message{version: version, community: community, pdu: pdu, requestID: 0x12345678, status: status, index: index}
+	for _, oid := range oids {
+		req.bindings = append(req.bindings, binding{mustOID(oid), null})
+	}
+	return req
+}
+
+func TestMessage(t *testing.T) {
+	// snmpget -v2c -c public HOST sysDescr.0
+	want := "302902010104067075626c6963a01c0204123456780201000201003" +
+		"00e300c06082b060102010101000500"
+	req := request(version2c, "public", pduGet, 0, 0, "1.3.6.1.2.1.1.1.0")
+	encoded := req.encode()
+	if hex.EncodeToString(encoded) != want {
+		t.Fatalf("encode = %x, want %s", encoded, want)
+	}
+	decoded, err := parseMessage(encoded)
+	if err != nil {
+		t.Fatalf("parseMessage: %v", err)
+	}
+	if decoded.version != version2c || decoded.community != "public" || decoded.pdu != pduGet || decoded.requestID != 0x12345678 ||
+		len(decoded.bindings) != 1 || decoded.bindings[0].oid.String() != "1.3.6.1.2.1.1.1.0" || decoded.bindings[0].value.Tag != tagNull {
+		t.Errorf("parseMessage = %+v", decoded)
+	}
+
+	long := message{pdu: pduResponse, bindings: []binding{{mustOID("1.3.6.1"), OctetString(strings.Repeat("x", 300))}}}
+	if decoded, err := parseMessage(long.encode()); err != nil || len(decoded.bindings[0].value.Content) != 300 {
+		t.Errorf("long form lengths: %v", err)
+	}
+	for i := range encoded {
+		if _, err := parseMessage(encoded[:i]); err == nil {
+			t.Errorf("parseMessage accepted %d of %d bytes", i, len(encoded))
+		}
+	}
+}
+
+// snapshot returns the state of an instance with a bridge and an uplink
+func snapshot() Snapshot {
+	return Snapshot{
+		Description: "macOS NAT Manager",
+		Name:        "lab-gateway",
+		Uptime:      time.Minute,
+		Instance:    "default",
+		Status: &nat.Status{Active: true, ExternalIP: "203.0.113.7", BytesIn: 5 << 32, BytesOut: 1000,
+			ActiveConnections: make([]nat.Connection, 4), DHCPRunning: true},
+		Interfaces: []Interface{
+			{Index: 12, Up: true, MTU: 1500, Counters: ifstats.Counters{Interface: "bridge100", BytesIn: 1000, BytesOut: 5<<32 + 7}},
+			{Index: 4, Up: true, MTU: 1500, PhysAddress: net.HardwareAddr{0xaa, 0xbb, 0xcc, 0, 0, 1},
+				Counters: ifstats.Counters{Interface: "en0", BytesIn: 5<<32 + 9, BytesOut: 1200}},
+		},
+		Devices: []nat.Device{{IP: "192.168.100.10", Online: true}, {IP: "192.168.100.11"}},
+		Leases:  2,
+	}
+}
+
+func TestBuild(t *testing.T) {
+	mib := Build(snapshot())
+	testCases := []struct {
+		oid  string
+		want Value
+	}{
+		{"1.3.6.1.2.1.1.5.0", OctetString("lab-gateway")},
+		{"1.3.6.1.2.1.1.3.0", TimeTicks(time.Minute)},
+		{"1.3.6.1.2.1.2.1.0", Integer(2)},
+		{"1.3.6.1.2.1.2.2.1.2.12", OctetString("bridge100")},
+		{"1.3.6.1.2.1.2.2.1.3.12", Integer(209)},
+		{"1.3.6.1.2.1.2.2.1.6.4", OctetString("\xaa\xbb\xcc\x00\x00\x01")},
+		{"1.3.6.1.2.1.2.2.1.10.4", Counter32(9)},
+		{"1.3.6.1.2.1.31.1.1.1.6.4", Counter64(5<<32 + 9)},
+		{"1.3.6.1.4.1.8072.9999.9999.1.1.2.0", TruthValue(true)},
+		{"1.3.6.1.4.1.8072.9999.9999.1.1.3.0", IPAddress(netip.MustParseAddr("203.0.113.7"))},
+		{"1.3.6.1.4.1.8072.9999.9999.1.1.4.0", Gauge32(4)},
+		{"1.3.6.1.4.1.8072.9999.9999.1.1.6.0", Gauge32(1)},
+		{"1.3.6.1.4.1.8072.9999.9999.1.1.7.0", Gauge32(2)},
+		{"1.3.6.1.4.1.8072.9999.9999.1.1.9.0", Counter64(5 << 32)},
+	}
+	for _, tc := range testCases {
+		got, ok := mib.Get(mustOID(tc.oid))
+		if !ok || got.Tag != tc.want.Tag || !bytes.Equal(got.Content, tc.want.Content) {
+			t.Errorf("%s = %+v, %t, want %+v", tc.oid, got, ok, tc.want)
+		}
+	}
+
+	// walking the ifTable goes down a column, by interface index
+	oid, _, _ := mib.Next(mustOID("1.3.6.1.2.1.2.2.1.2"))
+	next, _, _ := mib.Next(oid)
+	if oid.String() != "1.3.6.1.2.1.2.2.1.2.4" || next.String() != "1.3.6.1.2.1.2.2.1.2.12" {
+		t.Errorf("ifDescr walk = %s, %s", oid, next)
+	}
+	if !strings.Contains(MIBText, "natLeases") {
+		t.Error("MIBText does not define natLeases")
+	}
+}
+
+// testAgent returns an agent serving snapshot, without a socket
+func testAgent(collect func() (*MIB, error)) *Agent {
+	return &Agent{community: "s3cret", collect: collect}
+}
+
+// ask returns the response of agent to req
+func ask(t *testing.T, agent *Agent, req message) message {
+	t.Helper()
+	reply, err := agent.handle(req.encode(), time.Now())
+	if err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	resp, err := parseMessage(reply)
+	if err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	if resp.pdu != pduResponse || resp.requestID != req.requestID || resp.community != req.community {
+		t.Errorf("unexpected response header %+v", resp)
+	}
+	return resp
+}
+
+func TestRespond(t *testing.T) {
+	agent := testAgent(func() (*MIB, error) { return Build(snapshot()), nil })
+	const hcInOctets = "1.3.6.1.2.1.31.1.1.1.6.4"
+
+	resp := ask(t, agent, request(version2c, "s3cret", pduGet, 0, 0, "1.3.6.1.2.1.1.5.0", hcInOctets, "1.3.6.1.2.1.1.5.1", "1.3.6.1.9"))
+	if resp.status != 0 || len(resp.bindings) != 4 || string(resp.bindings[0].value.Content) != "lab-gateway" ||
+		resp.bindings[1].value.Tag != tagCounter64 || resp.bindings[2].value.Tag != tagNoSuchInstance || resp.bindings[3].value.Tag != tagNoSuchObject {
+		t.Errorf("v2c get = %+v", resp)
+	}
+
+	resp = ask(t, agent, request(version1, "s3cret", pduGet, 0, 0, "1.3.6.1.2.1.1.5.0", hcInOctets))
+	if resp.status != errNoSuchName || resp.index != 2 {
+		t.Errorf("v1 get of a Counter64 = %+v", resp)
+	}
+	resp = ask(t, agent, request(version1, "s3cret", pduGetNext, 0, 0, "1.3.6.1.2.1.31.1.1.1.1.12"))
+	if resp.status != 0 || resp.bindings[0].oid.String() != "1.3.6.1.4.1.8072.9999.9999.1.1.1.0" {
+		t.Errorf("v1 getnext does not skip Counter64 objects: %+v", resp.bindings)
+	}
+
+	resp = ask(t, agent, request(version2c, "s3cret", pduGetNext, 0, 0, "1.3.6.1.2.1.1", "1.3.6.1.4.1.8072.9999.9999.1.1.10.0"))
+	if resp.bindings[0].oid.String() != "1.3.6.1.2.1.1.1.0" || resp.bindings[1].value.Tag != tagEndOfMibView {
+		t.Errorf("v2c getnext = %+v", resp.bindings)
+	}
+
+	resp = ask(t, agent, request(version2c, "s3cret", pduGetBulk, 1, 3, "1.3.6.1.2.1.2.1", "1.3.6.1.2.1.2.2.1.2", "1.3.6.1.4.1.8072.9999.9999.1.1.9.0"))
+	var oids []string
+	for _, b := range resp.bindings {
+		oids = append(oids, b.oid.String())
+	}
+	want := []string{
+		"1.3.6.1.2.1.2.1.0",
+		"1.3.6.1.2.1.2.2.1.2.4", "1.3.6.1.4.1.8072.9999.9999.1.1.10.0",
+		"1.3.6.1.2.1.2.2.1.2.12", "1.3.6.1.4.1.8072.9999.9999.1.1.10.0",
+		"1.3.6.1.2.1.2.2.1.3.4", "1.3.6.1.4.1.8072.9999.9999.1.1.10.0",
+	}
+	if !slices.Equal(oids, want) || resp.bindings[4].value.Tag != tagEndOfMibView {
+		t.Errorf("getbulk = %v", oids)
+	}
+
+	resp = ask(t, agent, request(version2c, "s3cret", pduGetBulk, 0, 1000, "1.3.6.1"))
+	if resp.status != 0 || len(resp.bindings) == 0 || len(resp.encode()) > maxMessageSize {
+		t.Errorf("getbulk of the whole tree: %d bindings, %d bytes", len(resp.bindings), len(resp.encode()))
+	}
+
+	resp = ask(t, agent, request(version2c, "s3cret", pduSet, 0, 0, "1.3.6.1.2.1.1.5.0"))
+	if resp.status != errNotWritable || resp.index != 1 {
+		t.Errorf("set = %+v", resp)
+	}
+}
+
+func TestHandleRejects(t *testing.T) {
+	collected := 0
+	agent := testAgent(func() (*MIB, error) {
+		collected++
+		if collected > 1 {
+			return nil, errors.New("pfctl failed")
+		}
+		return Build(snapshot()), nil
+	})
+	now := time.Now()
+	for _, packet := range [][]byte{
+		request(version2c, "public", pduGet, 0, 0, "1.3.6.1.2.1.1.5.0").encode(),
+		request(3, "s3cret", pduGet, 0, 0, "1.3.6.1.2.1.1.5.0").encode(),
+		[]byte("not snmp"),
+	} {
+		if reply, err := agent.handle(packet, now); reply != nil || !errors.Is(err, ErrRejected) {
+			t.Errorf("handle(%x) = %x, %v", packet, reply, err)
+		}
+	}
+	if collected != 0 {
+		t.Error("rejected requests collected the state")
+	}
+
+	get := request(version2c, "s3cret", pduGet, 0, 0, "1.3.6.1.2.1.1.5.0").encode()
+	for _, at := range []time.Duration{0, time.Second} {
+		if _, err := agent.handle(get, now.Add(at)); err != nil {
+			t.Fatalf("handle: %v", err)
+		}
+	}
+	if collected != 1 {
+		t.Errorf("collected %d times within the cache time", collected)
+	}
+	reply, err := agent.handle(get, now.Add(cacheTTL))
+	if err == nil {
+		t.Fatal("the failure to collect was not reported")
+	}
+	if resp, _ := parseMessage(reply); resp.status != errGenErr {
+		t.Errorf("response = %+v, want genErr", resp)
+	}
+}
+
+func TestServe(t *testing.T) {
+	agent, err := Listen(Options{Listen: "127.0.0.1:0", Community: "s3cret"}, func() (*MIB, error) { return Build(snapshot()), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- agent.Serve(ctx, func(error) {}) }()
+
+	conn, err := net.Dial("udp", agent.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Write(request(version2c, "s3cret", pduGet, 0, 0, "1.3.6.1.4.1.8072.9999.9999.1.1.1.0").encode()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	resp, err := parseMessage(buf[:n])
+	if err != nil || string(resp.bindings[0].value.Content) != "default" {
+		t.Errorf("response = %+v, %v", resp, err)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+// Package top samples per-device bandwidth, the busiest destinations and pf
+// state counts for the live top dashboard
+package top
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Orders of the device table
+const (
+	SortRate        = "rate" // current traffic in and out
+	SortIn          = "in"
+	SortOut         = "out"
+	SortTotal       = "total" // traffic since the rules were loaded
+	SortConnections = "connections"
+	SortName        = "name"
+)
+
+// sortKeys are the single keystrokes selecting an order
+var sortKeys = map[string]string{
+	"r": SortRate, "i": SortIn, "o": SortOut, "t": SortTotal, "c": SortConnections, "n": SortName,
+}
+
+// Source is what the dashboard samples, implemented by *nat.Manager
+type Source interface {
+	DeviceTraffic() map[string]nat.Traffic
+	NATConnections() []nat.Connection
+	StateCount() int
+	Devices() ([]nat.Device, error)
+}
+
+// Sample is one reading of a source
+type Sample struct {
+	Time        time.Time
+	Traffic     map[string]nat.Traffic // counters by device address
+	Connections []nat.Connection
+	States      int               // pf states of all interfaces, -1 if unknown
+	Names       map[string]string // hostnames by device address
+}
+
+// Take reads a sample from src
+func Take(src Source, now time.Time) Sample {
+	s := Sample{
+		Time:        now,
+		Traffic:     src.DeviceTraffic(),
+		Connections: src.NATConnections(),
+		States:      src.StateCount(),
+		Names:       make(map[string]string),
+	}
+	if devices, err := src.Devices(); err == nil {
+		for _, device := range devices {
+			if device.Hostname != "" {
+				s.Names[device.IP] = device.Hostname
+			}
+		}
+	}
+	return s
+}
+
+// DeviceRow is a line of the device table
+type DeviceRow struct {
+	IP          string
+	Name        string
+	RateIn      float64 // bytes per second since the previous sample
+	RateOut     float64
+	BytesIn     uint64 // since the rules were loaded
+	BytesOut    uint64
+	Connections int
+}
+
+// Destination is a remote host and the traffic of its connections
+type Destination struct {
+	Host        string
+	Bytes       uint64
+	Connections int
+}
+
+// Frame is what the dashboard shows of two consecutive samples
+type Frame struct {
+	Time         time.Time
+	Devices      []DeviceRow
+	Destinations []Destination // busiest first
+	States       int
+	Connections  int            // NAT connections of the internal network
+	ByProtocol   map[string]int // NAT connections by protocol
+}
+
+// NewFrame computes the frame of the current sample, with rates over the
+// time since the previous one, which is zero for the first sample.
+// Addresses in network, such as "192.168.100", are the devices.
+func NewFrame(previous, current Sample, network, sortBy string) Frame {
+	f := Frame{
+		Time:        current.Time,
+		States:      current.States,
+		Connections: len(current.Connections),
+		ByProtocol:  make(map[string]int),
+	}
+
+	rows := make(map[string]*DeviceRow)
+	row := func(ip string) *DeviceRow {
+		if rows[ip] == nil {
+			rows[ip] = &DeviceRow{IP: ip, Name: current.Names[ip]}
+		}
+		return rows[ip]
+	}
+
+	elapsed := current.Time.Sub(previous.Time).Seconds()
+	for ip, traffic := range current.Traffic {
+		r := row(ip)
+		r.BytesIn, r.BytesOut = traffic.BytesIn, traffic.BytesOut
+		if last, ok := previous.Traffic[ip]; ok && elapsed > 0 {
+			delta := traffic.Since(last)
+			r.RateIn, r.RateOut = float64(delta.BytesIn)/elapsed, float64(delta.BytesOut)/elapsed
+		}
+	}
+
+	destinations := make(map[string]*Destination)
+	for _, conn := range current.Connections {
+		f.ByProtocol[conn.Protocol]++
+		device, remote := host(conn.Source), host(conn.Destination)
+		if !strings.HasPrefix(device, network+".") {
+			device, remote = remote, device
+		}
+		row(device).Connections++
+		if destinations[remote] == nil {
+			destinations[remote] = &Destination{Host: remote}
+		}
+		destinations[remote].Bytes += conn.Bytes
+		destinations[remote].Connections++
+	}
+
+	for _, r := range rows {
+		f.Devices = append(f.Devices, *r)
+	}
+	SortDevices(f.Devices, sortBy)
+	for _, d := range destinations {
+		f.Destinations = append(f.Destinations, *d)
+	}
+	sort.Slice(f.Destinations, func(i, j int) bool {
+		a, b := f.Destinations[i], f.Destinations[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		if a.Connections != b.Connections {
+			return a.Connections > b.Connections
+		}
+		return a.Host < b.Host
+	})
+	return f
+}
+
+// ValidateSort checks an order of the device table
+func ValidateSort(by string) error {
+	for _, order := range sortKeys {
+		if by == order {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid sort %q, expected rate, in, out, total, connections or name", by)
+}
+
+// SortDevices orders the device table, the busiest first and by address
+// for ties
+func SortDevices(rows []DeviceRow, by string) {
+	key := func(r DeviceRow) float64 {
+		switch by {
+		case SortIn:
+			return r.RateIn
+		case SortOut:
+			return r.RateOut
+		case SortTotal:
+			return float64(r.BytesIn + r.BytesOut)
+		case SortConnections:
+			return float64(r.Connections)
+		}
+		return r.RateIn + r.RateOut
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if by == SortName && displayName(a) != displayName(b) {
+			return displayName(a) < displayName(b)
+		}
+		if ka, kb := key(a), key(b); by != SortName && ka != kb {
+			return ka > kb
+		}
+		return ipLess(a.IP, b.IP)
+	})
+}
+
+// displayName is the hostname of a device, or its address without one
+func displayName(r DeviceRow) string {
+	if r.Name != "" {
+		return strings.ToLower(r.Name)
+	}
+	return r.IP
+}
+
+// host returns the address of "address:port"
+func host(addr string) string {
+	if i := strings.LastIndex(addr, ":"); i >= 0 && strings.Count(addr, ":") == 1 {
+		return addr[:i]
+	}
+	return addr
+}
+
+// ipLess orders dotted addresses numerically
+func ipLess(a, b string) bool {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if len(pa[i]) != len(pb[i]) {
+			return len(pa[i]) < len(pb[i])
+		}
+		if pa[i] != pb[i] {
+			return pa[i] < pb[i]
+		}
+	}
+	return len(pa) < len(pb)
+}
@@ -0,0 +1,121 @@
+package top
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// fakeSource returns fixed readings
+type fakeSource struct {
+	traffic map[string]nat.Traffic
+}
+
+func (f fakeSource) DeviceTraffic() map[string]nat.Traffic { return f.traffic }
+func (f fakeSource) StateCount() int                       { return 42 }
+
+func (f fakeSource) NATConnections() []nat.Connection {
+	return []nat.Connection{
+		{Source: "192.168.100.10:50000", Destination: "93.184.216.34:443", Protocol: "TCP", Bytes: 5000},
+		{Source: "192.168.100.10:50001", Destination: "93.184.216.34:443", Protocol: "TCP", Bytes: 1000},
+		{Source: "192.168.100.20:5353", Destination: "1.1.1.1:53", Protocol: "UDP", Bytes: 200},
+		{Source: "203.0.113.9:40000", Destination: "192.168.100.20:22", Protocol: "TCP", Bytes: 300},
+	}
+}
+
+func (f fakeSource) Devices() ([]nat.Device, error) {
+	return []nat.Device{{IP: "192.168.100.10", Hostname: "laptop"}, {IP: "192.168.100.20", Hostname: "nas"}}, nil
+}
+
+// testFrames returns the frame of two samples and of the second alone
+func testFrames() (Frame, Frame) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	previous := Take(fakeSource{map[string]nat.Traffic{
+		"192.168.100.10": {BytesIn: 1000, BytesOut: 100},
+		"192.168.100.20": {BytesIn: 50000, BytesOut: 50000},
+	}}, start)
+	current := Take(fakeSource{map[string]nat.Traffic{
+		"192.168.100.10": {BytesIn: 21000, BytesOut: 2100},
+		"192.168.100.20": {BytesIn: 50200, BytesOut: 50000},
+		"192.168.100.30": {BytesIn: 10},
+	}}, start.Add(2*time.Second))
+
+	return NewFrame(previous, current, "192.168.100", SortRate), NewFrame(Sample{}, current, "192.168.100", SortRate)
+}
+
+func TestNewFrame(t *testing.T) {
+	f, first := testFrames()
+	if len(f.Devices) != 3 || f.States != 42 || f.Connections != 4 || f.ByProtocol["TCP"] != 3 {
+		t.Fatalf("Unexpected frame %+v", f)
+	}
+	expected := []DeviceRow{
+		{IP: "192.168.100.10", Name: "laptop", RateIn: 10000, RateOut: 1000, BytesIn: 21000, BytesOut: 2100, Connections: 2},
+		{IP: "192.168.100.20", Name: "nas", RateIn: 100, BytesIn: 50200, BytesOut: 50000, Connections: 2},
+		{IP: "192.168.100.30", BytesIn: 10},
+	}
+	if !reflect.DeepEqual(f.Devices, expected) {
+		t.Errorf("Devices = %+v, expected %+v", f.Devices, expected)
+	}
+	// Inbound connections count for the remote host
+	destinations := []Destination{{"93.184.216.34", 6000, 2}, {"203.0.113.9", 300, 1}, {"1.1.1.1", 200, 1}}
+	if !reflect.DeepEqual(f.Destinations, destinations) {
+		t.Errorf("Destinations = %+v, expected %+v", f.Destinations, destinations)
+	}
+
+	// The first sample has no rates
+	if first.Devices[0].RateIn != 0 {
+		t.Errorf("First frame has rates: %+v", first.Devices)
+	}
+}
+
+func TestSortDevices(t *testing.T) {
+	f, _ := testFrames()
+	SortDevices(f.Devices, SortTotal)
+	if f.Devices[0].IP != "192.168.100.20" {
+		t.Errorf("Sort by total: %+v", f.Devices)
+	}
+	SortDevices(f.Devices, SortName)
+	if f.Devices[0].IP != "192.168.100.30" || f.Devices[1].Name != "laptop" {
+		t.Errorf("Sort by name: %+v", f.Devices)
+	}
+	SortDevices(f.Devices, SortConnections)
+	if f.Devices[2].IP != "192.168.100.30" {
+		t.Errorf("Sort by connections: %+v", f.Devices)
+	}
+}
+
+func TestModel(t *testing.T) {
+	src := fakeSource{map[string]nat.Traffic{"192.168.100.10": {BytesIn: 10}, "192.168.100.20": {BytesIn: 20}}}
+	var model tea.Model = New(src, Options{Interval: time.Second, Rows: 10, Network: "192.168.100"})
+	if view := model.View(); !strings.Contains(view, "Sampling") {
+		t.Errorf("View before the first sample = %q", view)
+	}
+
+	model, cmd := model.Update(sampleMsg(Take(src, time.Now())))
+	if cmd == nil {
+		t.Error("No tick scheduled after a sample")
+	}
+	view := model.View()
+	for _, want := range []string{"sort: rate", "States: 42 pf, 4 NAT (TCP 3, UDP 1)", "laptop", "93.184.216.34", "q quit"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("View lacks %q:\n%s", want, view)
+		}
+	}
+
+	model, _ = model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'t'}})
+	if m := model.(Model); m.opts.Sort != SortTotal || m.frame.Devices[0].IP != "192.168.100.20" {
+		t.Errorf("Key t: sort %q, devices %+v", m.opts.Sort, m.frame.Devices)
+	}
+	if _, cmd := model.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}}); cmd == nil {
+		t.Error("Key q does not quit")
+	}
+
+	if err := ValidateSort("bytes"); err == nil {
+		t.Error("Invalid sort accepted")
+	}
+}
@@ -0,0 +1,163 @@
+package top
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Options configure the dashboard
+type Options struct {
+	Interval time.Duration // time between samples
+	Rows     int           // lines of the device and destination tables
+	Sort     string        // initial order of the device table
+	Network  string        // internal network, such as "192.168.100"
+}
+
+// Model is the bubbletea model of the dashboard
+type Model struct {
+	src      Source
+	opts     Options
+	previous Sample
+	current  Sample
+	frame    Frame
+	sampled  bool
+}
+
+// sampleMsg carries a new sample
+type sampleMsg Sample
+
+// tickMsg asks for the next sample
+type tickMsg struct{}
+
+// New returns the dashboard model for src
+func New(src Source, opts Options) Model {
+	if opts.Sort == "" {
+		opts.Sort = SortRate
+	}
+	return Model{src: src, opts: opts}
+}
+
+// Run shows the dashboard until q or Ctrl+C is pressed
+func Run(src Source, opts Options) error {
+	_, err := tea.NewProgram(New(src, opts), tea.WithAltScreen()).Run()
+	return err
+}
+
+// Init takes the first sample
+func (m Model) Init() tea.Cmd {
+	return m.sample()
+}
+
+func (m Model) sample() tea.Cmd {
+	return func() tea.Msg {
+		return sampleMsg(Take(m.src, time.Now()))
+	}
+}
+
+// Update handles samples and keystrokes
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case sampleMsg:
+		m.previous, m.current, m.sampled = m.current, Sample(msg), true
+		m.frame = NewFrame(m.previous, m.current, m.opts.Network, m.opts.Sort)
+		return m, tea.Tick(m.opts.Interval, func(time.Time) tea.Msg { return tickMsg{} })
+	case tickMsg:
+		return m, m.sample()
+	case tea.KeyMsg:
+		key := msg.String()
+		if key == "q" || key == "esc" || key == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if by, ok := sortKeys[key]; ok {
+			m.opts.Sort = by
+			m.frame.Devices = append([]DeviceRow{}, m.frame.Devices...)
+			SortDevices(m.frame.Devices, by)
+		}
+	}
+	return m, nil
+}
+
+// View renders the dashboard
+func (m Model) View() string {
+	if !m.sampled {
+		return "Sampling...\n"
+	}
+	var b strings.Builder
+	f := m.frame
+	fmt.Fprintf(&b, "nat-manager top - %s  sort: %s\n", f.Time.Format("15:04:05"), m.opts.Sort)
+	fmt.Fprintf(&b, "States: %s pf, %d NAT%s | Devices: %d\n\n", formatStates(f.States), f.Connections, formatProtocols(f.ByProtocol), len(f.Devices))
+
+	fmt.Fprintf(&b, "%-15s %-20s %10s %10s %10s %10s %6s\n", "DEVICE", "NAME", "IN/s", "OUT/s", "TOTAL IN", "TOTAL OUT", "CONNS")
+	for i, r := range f.Devices {
+		if i >= m.opts.Rows {
+			fmt.Fprintf(&b, "... and %d more\n", len(f.Devices)-m.opts.Rows)
+			break
+		}
+		fmt.Fprintf(&b, "%-15s %-20s %10s %10s %10s %10s %6d\n", r.IP, truncate(r.Name, 20),
+			formatBytes(uint64(r.RateIn)), formatBytes(uint64(r.RateOut)),
+			formatBytes(r.BytesIn), formatBytes(r.BytesOut), r.Connections)
+	}
+
+	fmt.Fprintf(&b, "\n%-36s %10s %6s\n", "TOP DESTINATIONS", "BYTES", "CONNS")
+	for i, d := range f.Destinations {
+		if i >= m.opts.Rows {
+			break
+		}
+		fmt.Fprintf(&b, "%-36s %10s %6d\n", truncate(d.Host, 36), formatBytes(d.Bytes), d.Connections)
+	}
+
+	b.WriteString("\nr rate  i in  o out  t total  c connections  n name  q quit\n")
+	return b.String()
+}
+
+// formatStates renders the pf state count, if known
+func formatStates(states int) string {
+	if states < 0 {
+		return "?"
+	}
+	return fmt.Sprint(states)
+}
+
+// formatProtocols renders connection counts by protocol, such as
+// " (TCP 40, UDP 15)"
+func formatProtocols(counts map[string]int) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	protocols := make([]string, 0, len(counts))
+	for protocol := range counts {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+	parts := make([]string, len(protocols))
+	for i, protocol := range protocols {
+		parts[i] = fmt.Sprintf("%s %d", protocol, counts[protocol])
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
+
+// truncate shortens s to n characters
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "…"
+}
+
+// formatBytes renders a byte count with a binary unit
+func formatBytes(bytes uint64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
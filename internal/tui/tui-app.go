@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/charmbracelet/bubbles/list"
-	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 
@@ -19,35 +18,52 @@ import (
 
 // App represents the TUI application
 type App struct {
-	config  *config.Config
-	manager *nat.Manager
+	config    *config.Config
+	manager   *nat.Manager
+	exportDir string // where view snapshots are written, the working directory if empty
+	clipboard func(text string) error
+	readOnly  bool      // running without root, see SetReadOnly
+	helper    Helper    // reads what needs root when set, see SetHelper
+	replay    *replayer // session Run plays in the monitor, see SetReplay
+
+	saveSchedule func(cfg *config.Config) error // saves the schedule and updates its launchd jobs
 }
 
 // NewApp creates a new TUI application
 func NewApp(cfg *config.Config) *App {
 	// Convert config.Config to nat.Config
-	natConfig := &nat.Config{
-		ExternalInterface: cfg.ExternalInterface,
-		InternalInterface: cfg.InternalInterface,
-		InternalNetwork:   cfg.InternalNetwork,
-		DHCPRange: nat.DHCPRange{
-			Start: cfg.DHCPRange.Start,
-			End:   cfg.DHCPRange.End,
-			Lease: cfg.DHCPRange.Lease,
-		},
-		DNSServers: cfg.DNSServers,
-		Active:     cfg.Active,
-	}
+	natConfig := cfg.ToNATConfig()
+	applyTheme(cfg.TUI)
 
 	return &App{
-		config:  cfg,
-		manager: nat.NewManager(natConfig),
+		config:    cfg,
+		manager:   nat.NewManager(natConfig),
+		clipboard: copyToClipboard,
+		saveSchedule: func(cfg *config.Config) error {
+			if err := config.ValidateSchedule(cfg.Schedule); err != nil {
+				return err
+			}
+			return cfg.Save()
+		},
 	}
 }
 
+// SetScheduleSaver sets how schedule changes are saved, so that they also
+// install and remove launchd jobs. By default they are only saved.
+func (a *App) SetScheduleSaver(save func(cfg *config.Config) error) {
+	a.saveSchedule = save
+}
+
 // Run starts the TUI application
 func (a *App) Run() error {
-	p := tea.NewProgram(a.initialModel(), tea.WithAltScreen())
+	// Without any configuration yet, start with the setup wizard
+	var model tea.Model = a.initialModel()
+	if a.replay != nil {
+		model = model.(Model).startReplay(*a.replay)
+	} else if firstRun() && !a.readOnly {
+		model, _ = model.(Model).startWizard()
+	}
+	p := tea.NewProgram(model, tea.WithAltScreen())
 
 	// Handle cleanup on interrupt
 	c := make(chan os.Signal, 1)
@@ -75,32 +91,28 @@ func (a *App) initialModel() Model {
 	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
 	l.Title = "Network Interfaces"
 
-	// Initialize table
-	columns := []table.Column{
-		{Title: "Source", Width: 20},
-		{Title: "Destination", Width: 20},
-		{Title: "Protocol", Width: 10},
-		{Title: "State", Width: 12},
-	}
-	t := table.New(
-		table.WithColumns(columns),
-		table.WithFocused(true),
-		table.WithHeight(10),
-	)
-
 	return Model{
-		app:         a,
-		config:      a.config,
-		manager:     a.manager,
-		state:       "menu",
-		currentView: "menu",
-		list:        l,
-		table:       t,
-		textInput:   ti,
+		app:          a,
+		config:       a.config,
+		manager:      a.manager,
+		state:        "menu",
+		currentView:  "menu",
+		list:         l,
+		table:        newConnectionTable(),
+		conns:        connectionTable{search: newConnectionSearch()},
+		settings:     configEditor{input: newConfigInput()},
+		deviceTable:  newDeviceTable(),
+		forwardTable: newForwardTable(),
+		profileTable: newProfileTable(),
+		rulesTable:   newRulesTable(),
+		textInput:    ti,
 	}
 }
 
 func (a *App) cleanup() {
+	if a.readOnly {
+		return
+	}
 	// Attempt to stop NAT service if running
 	if a.manager.IsActive() {
 		log.Println("Stopping NAT service...")
@@ -121,12 +133,16 @@ type connectionsMsg struct {
 }
 type natResultMsg struct {
 	success bool
+	result  string // what happened, on success
 	err     error
 }
 
 // Commands
+
+// tick beats at the shortest refresh interval; each view refreshes on the
+// beats its own interval allows, see config.RefreshConfig
 func tick() tea.Cmd {
-	return tea.Tick(time.Second*2, func(t time.Time) tea.Msg {
+	return tea.Tick(config.MinRefresh, func(t time.Time) tea.Msg {
 		return tickMsg(t)
 	})
 }
@@ -140,33 +156,3 @@ func getInterfaces(manager *nat.Manager) tea.Cmd {
 		return interfacesMsg{interfaces: interfaces}
 	}
 }
-
-func getConnections(manager *nat.Manager) tea.Cmd {
-	return func() tea.Msg {
-		connections, err := manager.GetActiveConnections()
-		if err != nil {
-			return connectionsMsg{connections: []nat.Connection{}}
-		}
-		return connectionsMsg{connections: connections}
-	}
-}
-
-func setupNAT(manager *nat.Manager) tea.Cmd {
-	return func() tea.Msg {
-		err := manager.StartNAT()
-		if err != nil {
-			return natResultMsg{success: false, err: err}
-		}
-		return natResultMsg{success: true, err: nil}
-	}
-}
-
-func teardownNAT(manager *nat.Manager) tea.Cmd {
-	return func() tea.Msg {
-		err := manager.StopNAT()
-		if err != nil {
-			return natResultMsg{success: false, err: err}
-		}
-		return natResultMsg{success: true, err: nil}
-	}
-}
@@ -0,0 +1,389 @@
+package tui
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// instanceConfig is the profile choice of the instance's own config.yaml
+const instanceConfig = "(instance configuration)"
+
+// configField is a setting of the configuration editor
+type configField struct {
+	section string // heading shown above the field
+	label   string
+	hint    string // example shown while typing
+	value   func(cfg *config.Config) string
+	note    func(cfg *config.Config) string // derived values shown below the field
+	set     func(m *Model, value string) error
+	choices func(m Model) []string // offered in a dropdown instead of typed
+}
+
+// configEditor is the state of the configuration view
+type configEditor struct {
+	cursor  int
+	input   textinput.Model
+	typing  bool
+	choices []string // options of the open dropdown
+	choice  int
+	message string // why the value being entered is invalid
+}
+
+// configFields returns the settings of the configuration view, numbered
+// from 1 in this order. set changes nothing unless the value is valid.
+func configFields() []configField {
+	return []configField{
+		{section: "🔌 Interfaces", label: "External Interface", choices: interfaceChoices, set: setExternalInterface,
+			value: func(cfg *config.Config) string { return cfg.ExternalInterface }},
+		{label: "Internal Interface", choices: interfaceChoices, set: setInternalInterface,
+			value: func(cfg *config.Config) string { return cfg.InternalInterface }},
+		{section: "🌐 Network Settings", label: "Internal Network", hint: "192.168.100", set: setInternalNetwork,
+			value: func(cfg *config.Config) string { return cfg.InternalNetwork },
+			note: func(cfg *config.Config) string {
+				return fmt.Sprintf("subnet %s, gateway %s", cfg.GetInternalCIDR(), cfg.GetGatewayIP())
+			}},
+		{label: "DHCP Start", hint: "192.168.100.100", set: setting("dhcp_range.start"),
+			value: func(cfg *config.Config) string { return cfg.DHCPRange.Start }},
+		{label: "DHCP End", hint: "192.168.100.200", set: setting("dhcp_range.end"),
+			value: func(cfg *config.Config) string { return cfg.DHCPRange.End }},
+		{label: "DHCP Lease", hint: "45m, 12h, 7d or infinite", set: setting("dhcp_range.lease"),
+			value: func(cfg *config.Config) string { return cfg.DHCPRange.Lease }},
+		{label: "DNS Servers", hint: "1.1.1.1, 8.8.8.8", set: setDNSServers,
+			value: func(cfg *config.Config) string { return strings.Join(cfg.DNSServers, ", ") },
+			note: func(cfg *config.Config) string {
+				if cfg.LocalDomain == "" {
+					return "local domain disabled"
+				}
+				return "local domain " + cfg.LocalDomain
+			}},
+		{section: "📁 Profile", label: "Profile", choices: profileChoices, set: setProfile,
+			value: func(*config.Config) string {
+				if config.Profile() == "" {
+					return instanceConfig
+				}
+				return config.Profile()
+			}},
+	}
+}
+
+// setting stores a typed value at a dotted configuration key
+func setting(key string) func(m *Model, value string) error {
+	return func(m *Model, value string) error {
+		return m.config.Set(key, strconv.Quote(value))
+	}
+}
+
+func setExternalInterface(m *Model, value string) error {
+	if value == m.config.InternalInterface {
+		return fmt.Errorf("%s is already the internal interface", value)
+	}
+	m.config.ExternalInterface = value
+	return nil
+}
+
+func setInternalInterface(m *Model, value string) error {
+	if value == m.config.ExternalInterface {
+		return fmt.Errorf("%s is already the external interface", value)
+	}
+	m.config.InternalInterface = value
+	return nil
+}
+
+func setInternalNetwork(m *Model, value string) error {
+	return changeNetwork(m.config, value)
+}
+
+// changeNetwork changes the network prefix, moving the DHCP pool along
+// with it
+func changeNetwork(cfg *config.Config, value string) error {
+	if strings.Count(value, ".") != 2 || net.ParseIP(value+".0").To4() == nil {
+		return fmt.Errorf("enter the first three octets of the network, e.g. 192.168.100")
+	}
+	rebase := func(addr string) string {
+		if host, ok := strings.CutPrefix(addr, cfg.InternalNetwork+"."); ok {
+			return value + "." + host
+		}
+		return addr
+	}
+	updated := *cfg
+	updated.DHCPRange.Start = rebase(updated.DHCPRange.Start)
+	updated.DHCPRange.End = rebase(updated.DHCPRange.End)
+	if err := updated.Set("internal_network", strconv.Quote(value)); err != nil {
+		return err
+	}
+	*cfg = updated
+	return nil
+}
+
+// setDNSServers sets the servers from a comma or space separated list. They
+// are passed to dnsmasq, which needs IP addresses.
+func setDNSServers(m *Model, value string) error {
+	servers := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+	if len(servers) == 0 {
+		return fmt.Errorf("at least one DNS server is required")
+	}
+	for _, server := range servers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid DNS server %q: expected an IP address", server)
+		}
+	}
+	m.config.DNSServers = servers
+	return nil
+}
+
+// setProfile switches to a profile's configuration, which NAT only picks up
+// when started, so not while it runs
+func setProfile(m *Model, value string) error {
+	if m.manager.IsActive() {
+		return fmt.Errorf("stop NAT before switching profiles")
+	}
+	name := value
+	if value == instanceConfig {
+		name = ""
+	}
+	previous := config.Profile()
+	if err := config.SetProfile(name); err != nil {
+		return err
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		_ = config.SetProfile(previous)
+		return fmt.Errorf("failed to load profile: %w", err)
+	}
+	*m.config = *cfg
+	return nil
+}
+
+func interfaceChoices(m Model) []string {
+	names := make([]string, len(m.interfaces))
+	for i, iface := range m.interfaces {
+		names[i] = iface.Name
+	}
+	return names
+}
+
+func profileChoices(Model) []string {
+	names, _ := config.ListProfiles()
+	return append([]string{instanceConfig}, names...)
+}
+
+// newConfigInput returns the input of the configuration editor
+func newConfigInput() textinput.Model {
+	ti := textinput.New()
+	ti.CharLimit = 100
+	ti.Width = 40
+	return ti
+}
+
+func (m Model) handleConfigKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.settings.typing:
+		return m.handleConfigInputKeys(msg)
+	case m.settings.choices != nil:
+		return m.handleConfigChoiceKeys(msg)
+	}
+
+	key := msg.String()
+	fields := configFields()
+	if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(fields) {
+		m.settings.cursor = n - 1
+		return m.editConfigField()
+	}
+	switch key {
+	case "q", "esc":
+		m.currentView = "menu"
+	case "up", "k":
+		m.settings.cursor = max(m.settings.cursor-1, 0)
+	case "down", "j":
+		m.settings.cursor = min(m.settings.cursor+1, len(fields)-1)
+	case "enter":
+		return m.editConfigField()
+	case "r":
+		return m, getInterfaces(m.manager)
+	}
+	return m, nil
+}
+
+// editConfigField opens the dropdown or the input of the selected field
+func (m Model) editConfigField() (tea.Model, tea.Cmd) {
+	if m.refuseReadOnly("Changing settings") {
+		return m, nil
+	}
+	field := configFields()[m.settings.cursor]
+	m.settings.message = ""
+	if field.choices == nil {
+		m.settings.typing = true
+		m.settings.input.Placeholder = field.hint
+		m.settings.input.SetValue(field.value(m.config))
+		m.settings.input.CursorEnd()
+		m.settings.input.Focus()
+		return m, textinput.Blink
+	}
+
+	choices := field.choices(m)
+	if len(choices) == 0 {
+		m.showError(fmt.Errorf("no %s choices, press 'r' to rescan the interfaces", strings.ToLower(field.label)))
+		return m, nil
+	}
+	m.settings.choices, m.settings.choice = choices, 0
+	for i, choice := range choices {
+		if choice == field.value(m.config) {
+			m.settings.choice = i
+		}
+	}
+	return m, nil
+}
+
+// handleConfigInputKeys edits a typed value, validating it as it is typed
+func (m Model) handleConfigInputKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		return m.applyConfigField(strings.TrimSpace(m.settings.input.Value()))
+	case "esc":
+		m.settings.typing = false
+		m.settings.message = ""
+		m.settings.input.Blur()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.settings.input, cmd = m.settings.input.Update(msg)
+	m.settings.message = ""
+	if err := m.checkConfigField(strings.TrimSpace(m.settings.input.Value())); err != nil {
+		m.settings.message = err.Error()
+	}
+	return m, cmd
+}
+
+// handleConfigChoiceKeys picks a value from the dropdown
+func (m Model) handleConfigChoiceKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "up", "k":
+		m.settings.choice = max(m.settings.choice-1, 0)
+	case "down", "j":
+		m.settings.choice = min(m.settings.choice+1, len(m.settings.choices)-1)
+	case "enter":
+		return m.applyConfigField(m.settings.choices[m.settings.choice])
+	case "esc", "q":
+		m.settings.choices = nil
+		m.settings.message = ""
+	}
+	return m, nil
+}
+
+// checkConfigField validates a value of the selected field against a copy
+// of the configuration
+func (m Model) checkConfigField(value string) error {
+	check := *m.config
+	m.config = &check
+	return configFields()[m.settings.cursor].set(&m, value)
+}
+
+// applyConfigField sets and saves the selected field, keeping the editor
+// open with the reason when the value is invalid
+func (m Model) applyConfigField(value string) (tea.Model, tea.Cmd) {
+	field := configFields()[m.settings.cursor]
+	if err := field.set(&m, value); err != nil {
+		m.settings.message = err.Error()
+		return m, nil
+	}
+	m.settings.typing, m.settings.choices, m.settings.message = false, nil, ""
+	m.settings.input.Blur()
+	if err := m.config.Save(); err != nil {
+		m.showError(fmt.Errorf("failed to save config: %w", err))
+		return m, nil
+	}
+	m.useConfig()
+	notice := fmt.Sprintf("✅ %s set to %s", field.label, field.value(m.config))
+	if m.manager.IsActive() {
+		notice += ", restart NAT to apply"
+	}
+	m.showNotice(notice)
+	return m, nil
+}
+
+// useConfig rebuilds the manager from the edited configuration. A running
+// NAT keeps its settings until it is stopped.
+func (m *Model) useConfig() {
+	if m.manager.IsActive() {
+		return
+	}
+	m.app.manager = nat.NewManager(m.config.ToNATConfig())
+	m.manager = m.app.manager
+}
+
+func (m Model) configView() string {
+	content := titleStyle.Render("NAT Configuration") + "\n\n"
+
+	for i, field := range configFields() {
+		if field.section != "" {
+			if i > 0 {
+				content += "\n"
+			}
+			content += field.section + ":\n"
+		}
+		content += m.configFieldView(i, field)
+	}
+	content += "\n"
+
+	// Status
+	if m.config.ExternalInterface != "" && m.config.InternalInterface != "" {
+		content += successStyle.Render("✅ Configuration ready") + "\n\n"
+	} else {
+		content += errorStyle.Render("❌ Missing interface configuration") + "\n\n"
+	}
+
+	switch {
+	case m.settings.typing:
+		content += helpStyle.Render("Enter to save, Esc to cancel")
+	case m.settings.choices != nil:
+		content += helpStyle.Render("'↑/↓' choose, 'enter' select, 'esc' cancel")
+	default:
+		content += helpStyle.Render("'↑/↓' or number to select, 'enter' edit, 'r' rescan interfaces, 'esc' back")
+	}
+	return content
+}
+
+// configFieldView renders a field with its input or dropdown while edited
+func (m Model) configFieldView(i int, field configField) string {
+	selected := i == m.settings.cursor
+	cursor := "  "
+	if selected {
+		cursor = "▸ "
+	}
+	value := field.value(m.config)
+	if value == "" {
+		value = errorStyle.Render("Not set")
+	}
+	if selected && m.settings.typing {
+		value = m.settings.input.View()
+	}
+	content := fmt.Sprintf("%s%d. %s: %s\n", cursor, i+1, field.label, value)
+	if field.note != nil {
+		content += fmt.Sprintf("      %s\n", field.note(m.config))
+	}
+	if !selected {
+		return content
+	}
+
+	for j, choice := range m.settings.choices {
+		if j == m.settings.choice {
+			content += successStyle.Render("      ▸ "+choice) + "\n"
+		} else {
+			content += "        " + choice + "\n"
+		}
+	}
+	if m.settings.message != "" {
+		content += errorStyle.Render("      ✗ "+m.settings.message) + "\n"
+	}
+	return content
+}
@@ -0,0 +1,50 @@
+package tui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// confirmDialog asks before running an action that disrupts the network
+type confirmDialog struct {
+	prompt string
+	action func(m Model) (tea.Model, tea.Cmd)
+}
+
+// confirmAction runs action once the user confirms prompt, or right away
+// when confirmations are turned off with tui.skip_confirm
+func (m Model) confirmAction(prompt string, action func(m Model) (tea.Model, tea.Cmd)) (tea.Model, tea.Cmd) {
+	if m.config.TUI.SkipConfirm {
+		return action(m)
+	}
+	m.dialog = &confirmDialog{prompt: prompt, action: action}
+	return m, nil
+}
+
+// handleDialogKeys runs or drops the pending action
+func (m Model) handleDialogKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	dialog := m.dialog
+	switch msg.String() {
+	case "y", "Y", "enter":
+		m.dialog = nil
+		return dialog.action(m)
+	case "n", "N", "esc", "q":
+		m.dialog = nil
+	}
+	return m, nil
+}
+
+func (m Model) dialogView() string {
+	return dialogStyle.Render(m.dialog.prompt + "\n\n" + helpStyle.Render("'y' confirm, 'n' cancel"))
+}
+
+// quit stops NAT and exits, asking first if that takes the network down
+func (m Model) quit() (tea.Model, tea.Cmd) {
+	exit := func(m Model) (tea.Model, tea.Cmd) {
+		m.app.cleanup()
+		return m, tea.Quit
+	}
+	if m.app.readOnly || !m.manager.IsActive() {
+		return exit(m)
+	}
+	return m.confirmAction("Quit and stop NAT? Clients lose internet access.", exit)
+}
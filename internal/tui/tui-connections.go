@@ -0,0 +1,296 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// connectionSortKeys select the order of the connections table
+var connectionSortKeys = map[string]string{"b": nat.SortBytes, "a": nat.SortAge, "d": nat.SortDestination}
+
+// connectionTable is the search, order and selection of the monitor's
+// connections table
+type connectionTable struct {
+	search    textinput.Model
+	searching bool
+	query     string
+	sortBy    string
+	reverse   bool
+	paused    bool             // frozen for reading, refreshes are dropped
+	shown     []nat.Connection // rows of the table, in order
+	detail    *nat.Connection  // connection shown in the details pane
+	err       error            // why the query is invalid
+}
+
+// newConnectionTable returns the table of the connection monitor
+func newConnectionTable() table.Model {
+	return table.New(
+		table.WithColumns([]table.Column{
+			{Title: "Source", Width: 22},
+			{Title: "Destination", Width: 22},
+			{Title: "Protocol", Width: 8},
+			{Title: "State", Width: 24},
+			{Title: "Bytes", Width: 10},
+			{Title: "Age", Width: 9},
+		}),
+		table.WithFocused(true),
+		table.WithHeight(10),
+	)
+}
+
+// newConnectionSearch returns the input of the connection search
+func newConnectionSearch() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "/"
+	ti.Placeholder = "text or device=… proto=… port=… dst=…"
+	ti.CharLimit = 100
+	ti.Width = 50
+	return ti
+}
+
+// getConnections reads the NAT's pf states, or the host's connections when
+// pf reports none, through the helper when one is set
+func (m Model) getConnections() tea.Cmd {
+	manager, helper := m.manager, m.app.helper
+	return func() tea.Msg {
+		if helper != nil {
+			connections, err := helper.Connections()
+			if err != nil {
+				return connectionsMsg{connections: []nat.Connection{}}
+			}
+			return connectionsMsg{connections: connections}
+		}
+		if connections := manager.NATConnections(); len(connections) > 0 {
+			return connectionsMsg{connections: connections}
+		}
+		connections, err := manager.GetActiveConnections()
+		if err != nil {
+			return connectionsMsg{connections: []nat.Connection{}}
+		}
+		return connectionsMsg{connections: connections}
+	}
+}
+
+func (m Model) handleConnections(msg connectionsMsg) (tea.Model, tea.Cmd) {
+	if m.conns.paused && m.currentView == "monitor" {
+		return m, nil
+	}
+	m.connections = msg.connections
+	m.refreshConnections()
+	return m, nil
+}
+
+// refreshConnections filters and orders the connections into the table
+func (m *Model) refreshConnections() {
+	shown, err := searchConnections(m.connections, m.conns.query)
+	m.conns.err = err
+	_ = nat.SortConnections(shown, m.conns.sortBy)
+	if m.conns.reverse {
+		slices.Reverse(shown)
+	}
+	m.conns.shown = shown
+
+	rows := make([]table.Row, len(shown))
+	for i, conn := range shown {
+		rows[i] = table.Row{conn.Source, conn.Destination, conn.Protocol, conn.State, formatConnBytes(conn), formatAge(conn.Age)}
+	}
+	m.table.SetRows(rows)
+}
+
+// searchConnections returns the connections matching query: key=value
+// terms as in "monitor --filter", or else text found in any column
+func searchConnections(connections []nat.Connection, query string) ([]nat.Connection, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return slices.Clone(connections), nil
+	}
+	if strings.Contains(query, "=") {
+		filter, err := nat.ParseConnectionFilter([]string{query})
+		if err != nil {
+			return nil, err
+		}
+		return filter.Apply(connections, nil), nil
+	}
+
+	query = strings.ToLower(query)
+	var shown []nat.Connection
+	for _, conn := range connections {
+		text := strings.ToLower(strings.Join([]string{conn.Source, conn.Destination, conn.Protocol, conn.State}, " "))
+		if strings.Contains(text, query) {
+			shown = append(shown, conn)
+		}
+	}
+	return shown, nil
+}
+
+func (m Model) handleMonitorKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.conns.searching {
+		return m.handleSearchKeys(msg)
+	}
+	if m.conns.detail != nil {
+		return m.handleDetailKeys(msg)
+	}
+	if m.replaying() {
+		if model, cmd, handled := m.handleReplayKeys(msg); handled {
+			return model, cmd
+		}
+	}
+
+	key := msg.String()
+	if by, ok := connectionSortKeys[key]; ok {
+		// Pressing the key of the current order reverses it
+		m.conns.reverse = m.conns.sortBy == by && !m.conns.reverse
+		m.conns.sortBy = by
+		m.refreshConnections()
+		return m, nil
+	}
+
+	switch key {
+	case "q", "esc":
+		if m.conns.query != "" {
+			m.conns.query = ""
+			m.refreshConnections()
+			return m, nil
+		}
+		m.currentView = "menu"
+		return m, nil
+	case "r":
+		m.conns.paused = false
+		return m, m.getConnections()
+	case "p", " ":
+		m.conns.paused = !m.conns.paused
+		if !m.conns.paused {
+			return m, m.getConnections()
+		}
+		return m, nil
+	case "/":
+		m.conns.searching = true
+		m.conns.search.SetValue(m.conns.query)
+		m.conns.search.Focus()
+		return m, textinput.Blink
+	case "y":
+		return m.copyRow()
+	case "D":
+		if device, ok := m.connectionDevice(); ok {
+			return m.openDevice(device)
+		}
+		return m, nil
+	case "enter":
+		if i := m.table.Cursor(); i >= 0 && i < len(m.conns.shown) {
+			conn := m.conns.shown[i]
+			m.conns.detail = &conn
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+// handleSearchKeys edits the search, filtering the table as it is typed
+func (m Model) handleSearchKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter":
+		m.conns.searching = false
+		m.conns.search.Blur()
+		return m, nil
+	case "esc":
+		m.conns.searching = false
+		m.conns.search.Blur()
+		m.conns.query = ""
+		m.refreshConnections()
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.conns.search, cmd = m.conns.search.Update(msg)
+	m.conns.query = m.conns.search.Value()
+	m.refreshConnections()
+	return m, cmd
+}
+
+// handleDetailKeys closes the details pane
+func (m Model) handleDetailKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "q", "enter":
+		m.conns.detail = nil
+	}
+	return m, nil
+}
+
+// connectionsHeader describes the search and order of the table
+func (m Model) connectionsHeader() string {
+	header := fmt.Sprintf("📊 Active connections: %d", len(m.connections))
+	if m.conns.query != "" {
+		header += fmt.Sprintf(" (%d matching %q)", len(m.conns.shown), m.conns.query)
+	}
+	if m.conns.sortBy != "" {
+		order := map[bool]string{false: "", true: ", reversed"}[m.conns.reverse]
+		header += fmt.Sprintf(" | sorted by %s%s", m.conns.sortBy, order)
+	}
+	if m.replaying() {
+		header += " | " + m.replayPosition()
+	} else if m.conns.paused {
+		header += " | " + warnStyle.Render("⏸ paused")
+	} else {
+		header += fmt.Sprintf(" | every %s", m.config.TUI.Refresh.GetInterval("monitor", m.manager.IsActive()))
+	}
+	header += "\n"
+	if m.conns.searching {
+		header += m.conns.search.View() + "\n"
+	}
+	if m.conns.err != nil {
+		header += errorStyle.Render("✗ "+m.conns.err.Error()) + "\n"
+	}
+	return header + "\n"
+}
+
+func (m Model) connectionDetailView() string {
+	conn := m.conns.detail
+	content := titleStyle.Render("Connection Details") + "\n\n"
+	content += fmt.Sprintf("Protocol:    %s\n", conn.Protocol)
+	content += fmt.Sprintf("Source:      %s\n", conn.Source)
+	content += fmt.Sprintf("Destination: %s\n", conn.Destination)
+	content += fmt.Sprintf("State:       %s\n", conn.State)
+	content += fmt.Sprintf("Bytes:       %s\n", formatConnBytes(*conn))
+	content += fmt.Sprintf("Age:         %s\n", formatAge(conn.Age))
+	if conn.Entry != "" {
+		content += "\npf state entry:\n" + conn.Entry + "\n"
+	}
+	content += "\n" + helpStyle.Render("'esc' back to the table")
+	return content
+}
+
+// formatConnBytes renders the traffic of a connection, if known
+func formatConnBytes(conn nat.Connection) string {
+	if conn.Entry == "" && conn.Bytes == 0 {
+		return "-"
+	}
+	const unit = 1024
+	if conn.Bytes < unit {
+		return fmt.Sprintf("%d B", conn.Bytes)
+	}
+	div, exp := uint64(unit), 0
+	for n := conn.Bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(conn.Bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// formatAge renders the age of a connection, if known
+func formatAge(age time.Duration) string {
+	if age == 0 {
+		return "-"
+	}
+	return age.String()
+}
@@ -0,0 +1,115 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// copiedMsg reports copying text to the clipboard
+type copiedMsg struct {
+	what string // what was copied, e.g. "connection"
+	err  error
+}
+
+// copyText places text on the clipboard
+func copyText(what, text string, clipboard func(string) error) tea.Cmd {
+	return func() tea.Msg {
+		if err := clipboard(text); err != nil {
+			return copiedMsg{what: what, err: fmt.Errorf("failed to copy the %s to the clipboard: %w", what, err)}
+		}
+		return copiedMsg{what: what}
+	}
+}
+
+func (m Model) handleCopied(msg copiedMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.showError(msg.err)
+		return m, nil
+	}
+	m.showNotice(fmt.Sprintf("📋 Copied the %s to the clipboard", msg.what))
+	return m, nil
+}
+
+// copyRow copies the selected connection or device of the current view
+func (m Model) copyRow() (tea.Model, tea.Cmd) {
+	switch m.currentView {
+	case "monitor":
+		if i := m.table.Cursor(); i >= 0 && i < len(m.conns.shown) {
+			return m, copyText("connection", connectionLine(m.conns.shown[i]), m.app.clipboard)
+		}
+	case "devices":
+		if device, ok := m.selectedDevice(); ok {
+			return m, copyText("device", m.deviceLine(device), m.app.clipboard)
+		}
+	case "device":
+		return m, copyText("device", m.deviceLine(m.device.device), m.app.clipboard)
+	}
+	return m, nil
+}
+
+// copyStatus copies the status summary
+func (m Model) copyStatus() (tea.Model, tea.Cmd) {
+	return m, copyText("status summary", m.statusSummary(time.Now()), m.app.clipboard)
+}
+
+// connectionLine describes a connection on one line
+func connectionLine(conn nat.Connection) string {
+	line := fmt.Sprintf("%s %s -> %s %s %s", conn.Protocol, conn.Source, conn.Destination, conn.State, formatConnBytes(conn))
+	if conn.Age > 0 {
+		line += " " + formatAge(conn.Age)
+	}
+	return line
+}
+
+// deviceLine describes a device on one line
+func (m Model) deviceLine(device nat.Device) string {
+	fields := []string{deviceName(m.config, device), device.IP, orNone(device.MAC), orNone(device.Vendor)}
+	if device.LeaseRemaining != "" {
+		fields = append(fields, "lease "+device.LeaseRemaining)
+	}
+	if deviceBlocked(m.config, device) {
+		fields = append(fields, "blocked")
+	}
+	return strings.Join(fields, " ")
+}
+
+// statusSummary describes the NAT, its networks and clients in plain text,
+// for bug reports and sharing lab details
+func (m Model) statusSummary(at time.Time) string {
+	state := "inactive"
+	if m.manager.IsActive() {
+		state = "active"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "macOS NAT Manager status at %s\n", at.Format(time.RFC3339))
+	fmt.Fprintf(&b, "NAT:         %s\n", state)
+	fmt.Fprintf(&b, "Profile:     %s\n", activeProfile())
+
+	external := orNone(m.config.ExternalInterface)
+	if health := m.wan.health; health != nil {
+		external += " " + orNone(health.ExternalIP)
+		if health.Gateway != "" {
+			reachable := map[bool]string{true: "reachable", false: "unreachable"}[health.Reachable]
+			external += fmt.Sprintf(", gateway %s %s", health.Gateway, reachable)
+		}
+		if health.DefaultRoute != "" && health.DefaultRoute != m.config.ExternalInterface {
+			external += ", default route on " + health.DefaultRoute
+		}
+	}
+	fmt.Fprintf(&b, "External:    %s\n", external)
+	fmt.Fprintf(&b, "Internal:    %s %s\n", orNone(m.config.InternalInterface), m.config.GetInternalCIDR())
+	fmt.Fprintf(&b, "DHCP:        %s-%s, lease %s\n", m.config.DHCPRange.Start, m.config.DHCPRange.End, orNone(m.config.DHCPRange.Lease))
+	fmt.Fprintf(&b, "DNS:         %s\n", orNone(strings.Join(m.config.DNSServers, ", ")))
+	fmt.Fprintf(&b, "Forwards:    %d\n", len(m.config.PortForwards))
+	fmt.Fprintf(&b, "Connections: %d\n", len(m.connections))
+	fmt.Fprintf(&b, "Devices:     %d\n", len(m.devices))
+	for _, device := range m.devices {
+		fmt.Fprintf(&b, "  %s\n", m.deviceLine(device))
+	}
+	return b.String()
+}
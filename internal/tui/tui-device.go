@@ -0,0 +1,279 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/dns"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Limits of the device screen
+const (
+	deviceConnections = 10 // newest connections listed
+	deviceQueries     = 10 // newest DNS queries listed
+)
+
+// deviceDetail is the drill-down screen of one device
+type deviceDetail struct {
+	device   nat.Device
+	back     string // view the screen returns to
+	queries  []dns.LoggedQuery
+	queryErr error
+}
+
+// queriesMsg carries the newest DNS queries of a device
+type queriesMsg struct {
+	ip      string
+	queries []dns.LoggedQuery
+	err     error
+}
+
+// getQueries reads the newest entries of the query log from ip
+func getQueries(ip string) tea.Cmd {
+	return func() tea.Msg {
+		path, err := config.GetQueryLogPath()
+		if err != nil {
+			return queriesMsg{ip: ip, err: err}
+		}
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return queriesMsg{ip: ip}
+		}
+		if err != nil {
+			return queriesMsg{ip: ip, err: err}
+		}
+		defer func() { _ = file.Close() }()
+		queries, err := dns.ReadQueryLog(file, func(q dns.LoggedQuery) bool { return q.Client == ip })
+		return queriesMsg{ip: ip, queries: queries[max(len(queries)-deviceQueries, 0):], err: err}
+	}
+}
+
+func (m Model) handleQueries(msg queriesMsg) (tea.Model, tea.Cmd) {
+	if msg.ip == m.device.device.IP {
+		m.device.queries, m.device.queryErr = msg.queries, msg.err
+	}
+	return m, nil
+}
+
+// openDevice shows the device screen, returning to the current view
+func (m Model) openDevice(device nat.Device) (tea.Model, tea.Cmd) {
+	m.device = deviceDetail{device: device, back: m.currentView}
+	m.currentView = "device"
+	return m, m.refreshDevice()
+}
+
+// refreshDevice reads the device's connections, traffic and queries
+func (m Model) refreshDevice() tea.Cmd {
+	cmds := []tea.Cmd{getQueries(m.device.device.IP)}
+	if m.manager.IsActive() {
+		cmds = append(cmds, m.getConnections(), m.getTraffic())
+	}
+	return tea.Batch(cmds...)
+}
+
+// connectionDevice returns the internal device of the selected connection
+func (m Model) connectionDevice() (nat.Device, bool) {
+	i := m.table.Cursor()
+	if i < 0 || i >= len(m.conns.shown) {
+		return nat.Device{}, false
+	}
+	conn := m.conns.shown[i]
+	for _, addr := range []string{conn.Source, conn.Destination} {
+		ip := hostOf(addr)
+		if i := slices.IndexFunc(m.devices, func(d nat.Device) bool { return d.IP == ip }); i >= 0 {
+			return m.devices[i], true
+		}
+		if strings.HasPrefix(ip, m.config.InternalNetwork+".") {
+			return nat.Device{IP: ip}, true
+		}
+	}
+	return nat.Device{}, false
+}
+
+// hostOf strips the port of an address as printed by pfctl (host:port) or
+// netstat (host.port)
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	if i := strings.LastIndex(addr, "."); i > 0 && net.ParseIP(addr[:i]) != nil {
+		return addr[:i]
+	}
+	return addr
+}
+
+// deviceConns returns the connections of the device, newest first
+func (m Model) deviceConns() []nat.Connection {
+	ip := m.device.device.IP
+	var conns []nat.Connection
+	for _, conn := range m.connections {
+		if hostOf(conn.Source) == ip || hostOf(conn.Destination) == ip {
+			conns = append(conns, conn)
+		}
+	}
+	_ = nat.SortConnections(conns, nat.SortAge)
+	return conns
+}
+
+// updateDevice takes the screen's device from the refreshed device list
+func (m *Model) updateDevice() {
+	for _, device := range m.devices {
+		if device.IP == m.device.device.IP || device.MAC != "" && strings.EqualFold(device.MAC, m.device.device.MAC) {
+			m.device.device = device
+			return
+		}
+	}
+}
+
+func (m Model) handleDeviceKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	device := m.device.device
+	switch msg.String() {
+	case "q", "esc":
+		return m.switchView(m.device.back)
+	case "r":
+		return m, m.refreshDevice()
+	case "y":
+		return m.copyRow()
+	case "b", "t":
+		if m.refuseReadOnly("Changing devices") {
+			return m, nil
+		}
+		if msg.String() == "b" {
+			return m.confirmBlock(device)
+		}
+		return m.editThrottle(device)
+	case "w":
+		return m.wakeDevice(device)
+	}
+	return m, nil
+}
+
+// capName returns the name of the bandwidth cap throttling a device
+func capName(device nat.Device) string {
+	return "dev-" + strings.NewReplacer(":", "-", ".", "-").Replace(deviceKey(device))
+}
+
+// deviceThrottle returns the rate a device is throttled to, or ""
+func deviceThrottle(cfg *config.Config, device nat.Device) string {
+	for _, c := range cfg.Bandwidth.Caps {
+		if c.Name == capName(device) {
+			return c.Rate
+		}
+	}
+	return ""
+}
+
+// editThrottle opens the input for a device's bandwidth cap
+func (m Model) editThrottle(device nat.Device) (tea.Model, tea.Cmd) {
+	m.currentView = "input"
+	m.inputField = "throttle"
+	m.inputReturn = "device"
+	m.textInput.SetValue(deviceThrottle(m.config, device))
+	m.textInput.Focus()
+	return m, nil
+}
+
+// setThrottle caps the device at rate, or lifts the cap when rate is empty,
+// and reloads the rules
+func (m Model) setThrottle(rate string) Model {
+	device := m.device.device
+	rate = strings.TrimSpace(rate)
+	previous := m.config.Bandwidth.Caps
+	caps := slices.DeleteFunc(slices.Clone(previous), func(c config.DeviceCapConfig) bool { return c.Name == capName(device) })
+	notice := fmt.Sprintf("Lifted the bandwidth cap of %s", deviceName(m.config, device))
+	if rate != "" {
+		if _, err := nat.ParseRate(rate); err != nil {
+			m.showError(err)
+			return m
+		}
+		caps = append(caps, config.DeviceCapConfig{Name: capName(device), Devices: []string{deviceKey(device)}, Rate: rate})
+		notice = fmt.Sprintf("Throttled %s to %s", deviceName(m.config, device), rate)
+	}
+
+	m.config.Bandwidth.Caps = caps
+	if err := applyConfig(m.config); err != nil {
+		m.config.Bandwidth.Caps = previous
+		m.showError(err)
+		return m
+	}
+	m.showNotice(notice)
+	return m
+}
+
+// wakeDevice sends the device a Wake-on-LAN packet
+func (m Model) wakeDevice(device nat.Device) (tea.Model, tea.Cmd) {
+	if device.MAC == "" {
+		m.showError(fmt.Errorf("%s has no MAC address to wake it by", device.IP))
+		return m, nil
+	}
+	if err := m.manager.Wake(device.MAC); err != nil {
+		m.showError(err)
+		return m, nil
+	}
+	m.showNotice(fmt.Sprintf("Sent a wake-up packet to %s", deviceName(m.config, device)))
+	return m, nil
+}
+
+func (m Model) deviceView() string {
+	device := m.device.device
+	content := titleStyle.Render("Device: "+deviceName(m.config, device)) + "\n\n"
+	content += fmt.Sprintf("IP:       %s\n", device.IP)
+	content += fmt.Sprintf("MAC:      %s\n", orNone(device.MAC))
+	content += fmt.Sprintf("Vendor:   %s\n", orNone(device.Vendor))
+	if device.Type != "" {
+		content += fmt.Sprintf("Type:     %s\n", device.Type)
+	}
+	content += fmt.Sprintf("Lease:    %s\n", orNone(device.LeaseRemaining))
+	var flags []string
+	if deviceBlocked(m.config, device) {
+		flags = append(flags, "blocked")
+	}
+	if ip := reservedIP(m.config, device.MAC); ip != "" {
+		flags = append(flags, "reserved "+ip)
+	}
+	if rate := deviceThrottle(m.config, device); rate != "" {
+		flags = append(flags, "throttled to "+rate)
+	}
+	content += fmt.Sprintf("Status:   %s\n\n", orNone(strings.Join(flags, ", ")))
+
+	content += "📶 Bandwidth\n"
+	if s, ok := m.traffic.devices[device.IP]; ok && len(s.down) > 0 {
+		down, up := s.current()
+		content += fmt.Sprintf("   ↓ %s %12s\n", sparkline(s.down, trafficSamples), formatRate(down))
+		content += fmt.Sprintf("   ↑ %s %12s\n\n", sparkline(s.up, trafficSamples), formatRate(up))
+	} else {
+		content += "   No traffic measured yet\n\n"
+	}
+
+	conns := m.deviceConns()
+	content += fmt.Sprintf("📊 Active connections: %d\n", len(conns))
+	for _, conn := range conns[:min(len(conns), deviceConnections)] {
+		content += fmt.Sprintf("   %-5s %-22s → %-22s %-12s %s\n", conn.Protocol, conn.Source, conn.Destination, conn.State, formatConnBytes(conn))
+	}
+
+	content += "\n🌐 Recent DNS queries\n"
+	switch {
+	case m.device.queryErr != nil:
+		content += "   " + errorStyle.Render("✗ "+m.device.queryErr.Error()) + "\n"
+	case len(m.device.queries) == 0 && !m.config.DNSForwarder.QueryLog.Enabled:
+		content += "   The query log is off, turn it on with 'nat-manager dns log enable'\n"
+	case len(m.device.queries) == 0:
+		content += "   No queries logged\n"
+	}
+	for i := len(m.device.queries) - 1; i >= 0; i-- {
+		q := m.device.queries[i]
+		content += fmt.Sprintf("   %s %-5s %s\n", q.Time.Local().Format("15:04:05"), q.Type, q.Name)
+	}
+
+	content += "\n" + helpStyle.Render("'t' throttle, 'b' block/unblock, 'w' wake, 'y' copy, 'r' refresh, 'esc' back")
+	return content
+}
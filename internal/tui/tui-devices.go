@@ -0,0 +1,295 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// devicesMsg carries the devices on the internal network
+type devicesMsg struct {
+	devices []nat.Device
+	err     error
+}
+
+// getDevices reads the devices, through the helper when one is set
+func (m Model) getDevices() tea.Cmd {
+	manager, helper := m.manager, m.app.helper
+	return func() tea.Msg {
+		if helper != nil {
+			devices, err := helper.Devices()
+			return devicesMsg{devices: devices, err: err}
+		}
+		devices, err := manager.Devices()
+		return devicesMsg{devices: devices, err: err}
+	}
+}
+
+// newDeviceTable returns the table of the devices view
+func newDeviceTable() table.Model {
+	return table.New(
+		table.WithColumns([]table.Column{
+			{Title: "IP", Width: 15},
+			{Title: "MAC", Width: 17},
+			{Title: "Vendor", Width: 16},
+			{Title: "Name", Width: 20},
+			{Title: "Lease", Width: 10},
+			{Title: "Flags", Width: 16},
+		}),
+		table.WithFocused(true),
+		table.WithHeight(12),
+	)
+}
+
+func (m Model) handleDevices(msg devicesMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.showError(fmt.Errorf("failed to list devices: %w", msg.err))
+		return m, nil
+	}
+	m.devices = msg.devices
+	m.noticeDevices(msg.devices)
+	m.updateDevice()
+	m.deviceTable.SetRows(m.deviceRows())
+	return m, nil
+}
+
+// deviceRows renders the devices with their nickname, blocking and
+// reservation
+func (m Model) deviceRows() []table.Row {
+	rows := make([]table.Row, len(m.devices))
+	for i, device := range m.devices {
+		lease := device.LeaseRemaining
+		if lease == "" {
+			lease = "-"
+		}
+		var flags []string
+		if deviceBlocked(m.config, device) {
+			flags = append(flags, "blocked")
+		}
+		if ip := reservedIP(m.config, device.MAC); ip != "" {
+			flags = append(flags, "reserved")
+		}
+		rows[i] = table.Row{device.IP, device.MAC, device.Vendor, deviceName(m.config, device), lease, strings.Join(flags, ",")}
+	}
+	return rows
+}
+
+// selectedDevice returns the device under the cursor
+func (m Model) selectedDevice() (nat.Device, bool) {
+	i := m.deviceTable.Cursor()
+	if i < 0 || i >= len(m.devices) {
+		return nat.Device{}, false
+	}
+	return m.devices[i], true
+}
+
+func (m Model) handleDevicesKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		m.currentView = "menu"
+		return m, nil
+	case "r":
+		return m, m.getDevices()
+	case "y":
+		return m.copyRow()
+	case "enter":
+		if device, ok := m.selectedDevice(); ok {
+			return m.openDevice(device)
+		}
+		return m, nil
+	case "b", "R", "n":
+		device, ok := m.selectedDevice()
+		if !ok || m.refuseReadOnly("Changing devices") {
+			return m, nil
+		}
+		switch msg.String() {
+		case "b":
+			return m.confirmBlock(device)
+		case "R":
+			return m.toggleReservation(device)
+		}
+		return m.editNickname(device)
+	}
+
+	var cmd tea.Cmd
+	m.deviceTable, cmd = m.deviceTable.Update(msg)
+	return m, cmd
+}
+
+// confirmBlock asks before blocking a device; unblocking needs no
+// confirmation
+func (m Model) confirmBlock(device nat.Device) (tea.Model, tea.Cmd) {
+	if deviceBlocked(m.config, device) {
+		return m.toggleBlock(device)
+	}
+	prompt := fmt.Sprintf("Block %s (%s)? It loses internet access.", deviceName(m.config, device), device.IP)
+	return m.confirmAction(prompt, func(m Model) (tea.Model, tea.Cmd) {
+		return m.toggleBlock(device)
+	})
+}
+
+// toggleBlock blocks or unblocks a device and reloads the rules
+func (m Model) toggleBlock(device nat.Device) (tea.Model, tea.Cmd) {
+	previous := m.config.BlockedDevices
+	verb, mark := "Blocked", "🚫"
+	if deviceBlocked(m.config, device) {
+		verb, mark = "Unblocked", "✅"
+		m.config.BlockedDevices = slices.DeleteFunc(slices.Clone(previous), func(entry string) bool {
+			return matchesDevice(entry, device)
+		})
+	} else {
+		m.config.BlockedDevices = append(slices.Clone(previous), deviceKey(device))
+	}
+
+	if err := applyConfig(m.config); err != nil {
+		m.config.BlockedDevices = previous
+		m.showError(err)
+		return m, nil
+	}
+	m.showNotice(fmt.Sprintf("%s %s %s", mark, verb, deviceName(m.config, device)))
+	m.deviceTable.SetRows(m.deviceRows())
+	return m, nil
+}
+
+// toggleReservation reserves a device's current address for its MAC, or
+// releases the reservation
+func (m Model) toggleReservation(device nat.Device) (tea.Model, tea.Cmd) {
+	if device.MAC == "" {
+		m.showError(fmt.Errorf("%s has no MAC address to reserve it for", device.IP))
+		return m, nil
+	}
+	previous := m.config.DHCPLeases
+	leases := slices.Clone(previous)
+	i := slices.IndexFunc(leases, func(lease config.DeviceLease) bool { return strings.EqualFold(lease.MAC, device.MAC) })
+
+	notice := fmt.Sprintf("📌 Reserved %s for %s", device.IP, deviceName(m.config, device))
+	switch {
+	case i >= 0 && leases[i].IP != "":
+		notice = fmt.Sprintf("📌 Released the reservation of %s", deviceName(m.config, device))
+		leases[i].IP = ""
+		if leases[i].Lease == "" {
+			leases = slices.Delete(leases, i, i+1)
+		}
+	case i >= 0:
+		leases[i].IP = device.IP
+	default:
+		leases = append(leases, config.DeviceLease{MAC: strings.ToLower(device.MAC), IP: device.IP})
+	}
+
+	m.config.DHCPLeases = leases
+	natConfig := m.config.ToNATConfig()
+	err := nat.ValidateDHCP(natConfig.DHCPRange, natConfig.DeviceLeases, natConfig.InternalNetwork)
+	if err == nil {
+		err = m.config.Save()
+	}
+	if err != nil {
+		m.config.DHCPLeases = previous
+		m.showError(err)
+		return m, nil
+	}
+	if m.manager.IsActive() {
+		notice += "; restart NAT to apply"
+	}
+	m.showNotice(notice)
+	m.deviceTable.SetRows(m.deviceRows())
+	return m, nil
+}
+
+// editNickname opens the input for a device's nickname
+func (m Model) editNickname(device nat.Device) (tea.Model, tea.Cmd) {
+	m.currentView = "input"
+	m.inputField = "nickname"
+	m.inputReturn = "devices"
+	m.inputDevice = deviceKey(device)
+	m.textInput.SetValue(m.config.DeviceLabels[m.inputDevice])
+	m.textInput.Focus()
+	return m, nil
+}
+
+// setNickname labels the device being edited, or removes its label when
+// the name is empty
+func (m Model) setNickname(name string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		delete(m.config.DeviceLabels, m.inputDevice)
+		return
+	}
+	if m.config.DeviceLabels == nil {
+		m.config.DeviceLabels = make(map[string]string)
+	}
+	m.config.DeviceLabels[m.inputDevice] = name
+}
+
+// applyConfig reloads the rules of a running NAT and saves the
+// configuration, leaving both unchanged if the rules are invalid
+func applyConfig(cfg *config.Config) error {
+	if err := nat.NewManager(cfg.ToNATConfig()).ApplyRules(); err != nil {
+		return err
+	}
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// deviceKey identifies a device in the configuration: by MAC, or by
+// address without one
+func deviceKey(device nat.Device) string {
+	if device.MAC != "" {
+		return strings.ToLower(device.MAC)
+	}
+	return device.IP
+}
+
+// matchesDevice reports whether a configured MAC or IP refers to device
+func matchesDevice(entry string, device nat.Device) bool {
+	return entry == device.IP || device.MAC != "" && strings.EqualFold(entry, device.MAC)
+}
+
+// deviceBlocked reports whether device is on the block list
+func deviceBlocked(cfg *config.Config, device nat.Device) bool {
+	return slices.ContainsFunc(cfg.BlockedDevices, func(entry string) bool { return matchesDevice(entry, device) })
+}
+
+// reservedIP returns the address reserved for a MAC, or ""
+func reservedIP(cfg *config.Config, mac string) string {
+	for _, lease := range cfg.DHCPLeases {
+		if mac != "" && strings.EqualFold(lease.MAC, mac) {
+			return lease.IP
+		}
+	}
+	return ""
+}
+
+// deviceName returns a device's nickname, or the name it was resolved to
+func deviceName(cfg *config.Config, device nat.Device) string {
+	for key, label := range cfg.DeviceLabels {
+		if matchesDevice(key, device) {
+			return label
+		}
+	}
+	if device.Hostname != "" {
+		return device.Hostname
+	}
+	return device.IP
+}
+
+func (m Model) devicesView() string {
+	content := titleStyle.Render("Connected Devices") + "\n\n"
+	content += fmt.Sprintf("📱 %d devices on %s.0/24\n\n", len(m.devices), m.config.InternalNetwork)
+
+	if len(m.devices) > 0 {
+		content += m.deviceTable.View() + "\n\n"
+	} else {
+		content += "No devices seen yet\n\n"
+	}
+
+	content += helpStyle.Render("'enter' details, 'b' block/unblock, 'R' reserve address, 'n' nickname, 'y' copy, 'r' refresh, 'esc' back")
+	return content
+}
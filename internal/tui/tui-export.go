@@ -0,0 +1,95 @@
+package tui
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Export formats
+const (
+	exportText = "text"
+	exportHTML = "html"
+)
+
+// ansiRe matches terminal escape sequences emitted by lipgloss
+var ansiRe = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// exportMsg reports the result of exporting a view
+type exportMsg struct {
+	path   string
+	copied bool
+	err    error
+}
+
+// stripANSI removes colors and other escape sequences
+func stripANSI(s string) string {
+	return ansiRe.ReplaceAllString(s, "")
+}
+
+// renderExport formats a snapshot of a view as plain text or HTML
+func renderExport(view, content, format string, at time.Time) string {
+	title := fmt.Sprintf("macOS NAT Manager: %s (%s)", view, at.Format(time.RFC3339))
+	content = strings.TrimSpace(stripANSI(content))
+
+	if format == exportHTML {
+		return fmt.Sprintf("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n<pre>\n%s\n</pre>\n</body>\n</html>\n",
+			html.EscapeString(title), html.EscapeString(content))
+	}
+	return title + "\n\n" + content + "\n"
+}
+
+// exportFileName names a snapshot after the view and time it was taken
+func exportFileName(view, format string, at time.Time) string {
+	ext := "txt"
+	if format == exportHTML {
+		ext = "html"
+	}
+	return fmt.Sprintf("nat-manager-%s-%s.%s", view, at.Format("20060102-150405"), ext)
+}
+
+// exportView writes the snapshot to dir and copies it to the clipboard
+func exportView(dir, view, content, format string, clipboard func(string) error) tea.Cmd {
+	return func() tea.Msg {
+		at := time.Now()
+		snapshot := renderExport(view, content, format, at)
+
+		path := filepath.Join(dir, exportFileName(view, format, at))
+		if err := os.WriteFile(path, []byte(snapshot), 0644); err != nil {
+			return exportMsg{err: fmt.Errorf("failed to export view: %w", err)}
+		}
+		return exportMsg{path: path, copied: clipboard(snapshot) == nil}
+	}
+}
+
+// copyToClipboard places text on the macOS clipboard
+func copyToClipboard(text string) error {
+	cmd := exec.Command("pbcopy")
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// exportCurrentView snapshots the view on screen
+func (m Model) exportCurrentView(format string) (tea.Model, tea.Cmd) {
+	return m, exportView(m.app.exportDir, m.currentView, m.currentViewContent(), format, m.app.clipboard)
+}
+
+func (m Model) handleExport(msg exportMsg) (tea.Model, tea.Cmd) {
+	if msg.err != nil {
+		m.showError(msg.err)
+		return m, nil
+	}
+	notice := "📸 View exported to " + msg.path
+	if msg.copied {
+		notice += " and copied to the clipboard"
+	}
+	m.showNotice(notice)
+	return m, nil
+}
@@ -0,0 +1,271 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Fields of the port forward editor
+const (
+	forwardProtocol = iota
+	forwardExternalPort
+	forwardTargetIP
+	forwardTargetPort
+	forwardDescription
+	forwardFieldCount
+)
+
+var forwardFieldNames = [forwardFieldCount]string{"Protocol", "External port", "Target IP", "Target port", "Description"}
+
+// forwardForm is the state of the port forward editor
+type forwardForm struct {
+	inputs [forwardFieldCount]textinput.Model
+	focus  int
+	index  int   // forward being edited, -1 for a new one
+	err    error // validation of the current values
+}
+
+// newForwardTable returns the table of the port forwards view
+func newForwardTable() table.Model {
+	return table.New(
+		table.WithColumns([]table.Column{
+			{Title: "Proto", Width: 8},
+			{Title: "Port", Width: 6},
+			{Title: "Target", Width: 22},
+			{Title: "Description", Width: 24},
+		}),
+		table.WithFocused(true),
+		table.WithHeight(10),
+	)
+}
+
+// forwardRows renders the configured port forwards
+func (m Model) forwardRows() []table.Row {
+	rows := make([]table.Row, len(m.config.PortForwards))
+	for i, f := range m.config.PortForwards {
+		rows[i] = table.Row{f.Protocol, strconv.Itoa(f.ExternalPort),
+			fmt.Sprintf("%s:%d", f.InternalIP, f.InternalPort), f.Description}
+	}
+	return rows
+}
+
+func (m Model) handleForwardsKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		m.currentView = "menu"
+		return m, nil
+	case "a":
+		return m.editForward(-1)
+	case "e", "enter":
+		if i := m.forwardTable.Cursor(); i >= 0 && i < len(m.config.PortForwards) {
+			return m.editForward(i)
+		}
+		return m, nil
+	case "d":
+		if i := m.forwardTable.Cursor(); i >= 0 && i < len(m.config.PortForwards) && !m.refuseReadOnly("Changing port forwards") {
+			f := m.config.PortForwards[i]
+			prompt := fmt.Sprintf("Delete port forward %s %d → %s:%d?", f.Protocol, f.ExternalPort, f.InternalIP, f.InternalPort)
+			return m.confirmAction(prompt, func(m Model) (tea.Model, tea.Cmd) {
+				return m.deleteForward(i)
+			})
+		}
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.forwardTable, cmd = m.forwardTable.Update(msg)
+	return m, cmd
+}
+
+// editForward opens the editor on forward i, or on a new forward if i is -1
+func (m Model) editForward(i int) (tea.Model, tea.Cmd) {
+	if m.refuseReadOnly("Changing port forwards") {
+		return m, nil
+	}
+	forward := config.PortForward{Protocol: "tcp"}
+	if i >= 0 {
+		forward = m.config.PortForwards[i]
+	}
+	values := [forwardFieldCount]string{forward.Protocol, portValue(forward.ExternalPort),
+		forward.InternalIP, portValue(forward.InternalPort), forward.Description}
+
+	form := forwardForm{index: i}
+	for field := range form.inputs {
+		input := textinput.New()
+		input.CharLimit = 50
+		input.Width = 30
+		input.SetValue(values[field])
+		form.inputs[field] = input
+	}
+	form.inputs[forwardTargetIP].Placeholder = m.config.InternalNetwork + ".x"
+	form.inputs[forwardTargetPort].Placeholder = "same as the external port"
+	form.inputs[forwardProtocol].Focus()
+	m.forwardForm = form
+	m.forwardForm.err = m.validateForwardForm()
+	m.currentView = "forward_edit"
+	return m, textinput.Blink
+}
+
+// portValue renders a port for editing, leaving an unset one empty
+func portValue(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return strconv.Itoa(port)
+}
+
+func (m Model) handleForwardEditKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.currentView = "forwards"
+		return m, nil
+	case "tab", "down":
+		return m.focusForwardField(m.forwardForm.focus + 1), nil
+	case "shift+tab", "up":
+		return m.focusForwardField(m.forwardForm.focus - 1), nil
+	case "enter":
+		return m.saveForward()
+	}
+
+	var cmd tea.Cmd
+	focus := m.forwardForm.focus
+	m.forwardForm.inputs[focus], cmd = m.forwardForm.inputs[focus].Update(msg)
+	m.forwardForm.err = m.validateForwardForm()
+	return m, cmd
+}
+
+// focusForwardField moves the editor's cursor to a field, wrapping around
+func (m Model) focusForwardField(field int) Model {
+	field = (field + forwardFieldCount) % forwardFieldCount
+	m.forwardForm.inputs[m.forwardForm.focus].Blur()
+	m.forwardForm.inputs[field].Focus()
+	m.forwardForm.focus = field
+	return m
+}
+
+// formForward builds the port forward the editor describes
+func (m Model) formForward() (config.PortForward, error) {
+	value := func(field int) string { return strings.TrimSpace(m.forwardForm.inputs[field].Value()) }
+	external, err := strconv.Atoi(value(forwardExternalPort))
+	if err != nil {
+		return config.PortForward{}, fmt.Errorf("external port must be a number")
+	}
+	internal := external
+	if value(forwardTargetPort) != "" {
+		if internal, err = strconv.Atoi(value(forwardTargetPort)); err != nil {
+			return config.PortForward{}, fmt.Errorf("target port must be a number")
+		}
+	}
+	return config.PortForward{
+		Protocol:     strings.ToLower(value(forwardProtocol)),
+		ExternalPort: external,
+		InternalIP:   value(forwardTargetIP),
+		InternalPort: internal,
+		Description:  value(forwardDescription),
+	}, nil
+}
+
+// formForwards returns the configured forwards with the editor's applied
+func (m Model) formForwards() ([]config.PortForward, error) {
+	forward, err := m.formForward()
+	if err != nil {
+		return nil, err
+	}
+	forwards := slices.Clone(m.config.PortForwards)
+	if m.forwardForm.index >= 0 {
+		forwards[m.forwardForm.index] = forward
+	} else {
+		forwards = append(forwards, forward)
+	}
+	return forwards, nil
+}
+
+// validateForwardForm checks the editor's forward on its own and against
+// the other forwards, as the CLI does before saving
+func (m Model) validateForwardForm() error {
+	forwards, err := m.formForwards()
+	if err != nil {
+		return err
+	}
+	candidate := *m.config
+	candidate.PortForwards = forwards
+	return nat.ValidatePortForwards(candidate.NATPortForwards(), m.config.InternalNetwork)
+}
+
+// saveForward writes the edited forward to the configuration and reloads
+// the rules of a running NAT
+func (m Model) saveForward() (tea.Model, tea.Cmd) {
+	if m.forwardForm.err = m.validateForwardForm(); m.forwardForm.err != nil {
+		return m, nil
+	}
+	forwards, _ := m.formForwards()
+	verb, saved := "Added", forwards[len(forwards)-1]
+	if m.forwardForm.index >= 0 {
+		verb, saved = "Updated", forwards[m.forwardForm.index]
+	}
+	return m.setForwards(forwards, fmt.Sprintf("✅ %s port forward %s %d", verb, saved.Protocol, saved.ExternalPort))
+}
+
+// deleteForward removes forward i
+func (m Model) deleteForward(i int) (tea.Model, tea.Cmd) {
+	removed := m.config.PortForwards[i]
+	forwards := slices.Delete(slices.Clone(m.config.PortForwards), i, i+1)
+	return m.setForwards(forwards, fmt.Sprintf("🗑️  Deleted port forward %s %d", removed.Protocol, removed.ExternalPort))
+}
+
+// setForwards saves and applies forwards, keeping the previous ones if
+// that fails
+func (m Model) setForwards(forwards []config.PortForward, notice string) (tea.Model, tea.Cmd) {
+	previous := m.config.PortForwards
+	m.config.PortForwards = forwards
+	if err := applyConfig(m.config); err != nil {
+		m.config.PortForwards = previous
+		m.showError(err)
+		return m, nil
+	}
+	m.showNotice(notice)
+	m.currentView = "forwards"
+	m.forwardTable.SetRows(m.forwardRows())
+	return m, nil
+}
+
+func (m Model) forwardsView() string {
+	content := titleStyle.Render("Port Forwards") + "\n\n"
+	if len(m.config.PortForwards) > 0 {
+		content += m.forwardTable.View() + "\n\n"
+	} else {
+		content += "No port forwards configured\n\n"
+	}
+
+	content += helpStyle.Render("'a' add, 'e' edit, 'd' delete, 'esc' back")
+	return content
+}
+
+func (m Model) forwardEditView() string {
+	title := "Add Port Forward"
+	if m.forwardForm.index >= 0 {
+		title = "Edit Port Forward"
+	}
+	content := titleStyle.Render(title) + "\n\n"
+	for field, input := range m.forwardForm.inputs {
+		content += fmt.Sprintf("%-14s %s\n", forwardFieldNames[field]+":", input.View())
+	}
+	content += "\n"
+
+	if m.forwardForm.err != nil {
+		content += errorStyle.Render("✗ "+m.forwardForm.err.Error()) + "\n\n"
+	} else {
+		content += successStyle.Render("✓ Valid") + "\n\n"
+	}
+	content += helpStyle.Render("Protocol is tcp, udp or tcp/udp. 'tab' next field, 'enter' save, 'esc' cancel")
+	return content
+}
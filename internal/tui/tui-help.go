@@ -0,0 +1,167 @@
+package tui
+
+import (
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// viewKeys are the keybindings of a view, in columns of related keys
+type viewKeys struct {
+	title   string
+	columns [][]key.Binding
+}
+
+// ShortHelp returns the first column of keys
+func (k viewKeys) ShortHelp() []key.Binding {
+	return k.columns[0]
+}
+
+// FullHelp returns every column of keys
+func (k viewKeys) FullHelp() [][]key.Binding {
+	return k.columns
+}
+
+// binding describes keys for the help overlay
+func binding(help string, keys ...string) key.Binding {
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(keys[0], help))
+}
+
+// globalKeys work in every view except while a text field is edited
+var globalKeys = []key.Binding{
+	binding("command palette", "ctrl+k"),
+	binding("export view", "ctrl+s"),
+	binding("notification history", "ctrl+n"),
+	binding("copy status summary", "Y"),
+	binding("this help", "?"),
+}
+
+// backKeys return to the main menu
+var backKeys = binding("back to menu", "esc", "q")
+
+// tableKeys move through a list or table
+var tableKeys = []key.Binding{
+	binding("move up", "↑", "k"),
+	binding("move down", "↓", "j"),
+}
+
+// helpKeys returns the keybindings of a view
+func helpKeys(view string) viewKeys {
+	switch view {
+	case "interfaces":
+		return viewKeys{"Network Interfaces", [][]key.Binding{
+			{binding("set external", "e"), binding("set internal", "i"), binding("refresh", "r"), backKeys},
+			append(tableKeys, binding("filter", "/")),
+		}}
+	case "config":
+		return viewKeys{"NAT Configuration", [][]key.Binding{
+			{binding("edit", "enter"), binding("edit setting n", "1-8"), binding("rescan interfaces", "r"), backKeys},
+			tableKeys,
+			{binding("save value or choice", "enter"), binding("cancel edit", "esc")},
+		}}
+	case "monitor":
+		return viewKeys{"Connection Monitor", [][]key.Binding{
+			{binding("search", "/"), binding("details", "enter"), binding("device of connection", "D"), binding("refresh", "r"),
+				binding("pause/resume", "p", "space"), binding("copy row", "y"),
+				binding("clear search/back", "esc", "q")},
+			{binding("sort by bytes", "b"), binding("sort by age", "a"), binding("sort by destination", "d")},
+			tableKeys,
+		}}
+	case "replay":
+		return viewKeys{"Session Replay", [][]key.Binding{
+			{binding("pause/resume", "p", "space"), binding("next frame", "→", "."), binding("previous frame", "←", ","),
+				binding("restart", "r"), binding("clear search/quit", "esc", "q")},
+			{binding("search", "/"), binding("details", "enter"), binding("copy row", "y"),
+				binding("sort by bytes", "b"), binding("sort by age", "a"), binding("sort by destination", "d")},
+			tableKeys,
+		}}
+	case "devices":
+		return viewKeys{"Connected Devices", [][]key.Binding{
+			{binding("details", "enter"), binding("block/unblock", "b"), binding("reserve address", "R"), binding("nickname", "n"),
+				binding("copy row", "y"), binding("refresh", "r"), backKeys},
+			tableKeys,
+		}}
+	case "device":
+		return viewKeys{"Device", [][]key.Binding{
+			{binding("throttle", "t"), binding("block/unblock", "b"), binding("wake", "w"), binding("copy", "y"),
+				binding("refresh", "r"), binding("back", "esc", "q")},
+		}}
+	case "forwards":
+		return viewKeys{"Port Forwards", [][]key.Binding{
+			{binding("add", "a"), binding("edit", "e", "enter"), binding("delete", "d"), backKeys},
+			tableKeys,
+		}}
+	case "forward_edit":
+		return viewKeys{"Port Forward Editor", [][]key.Binding{
+			{binding("next field", "tab", "↓"), binding("previous field", "shift+tab", "↑"), binding("save", "enter"), binding("cancel", "esc")},
+		}}
+	case "logs":
+		return viewKeys{"Logs", [][]key.Binding{
+			{binding("pause/resume", "p", "space"), binding("filter component", "f"), binding("clear", "c"), backKeys},
+			{binding("scroll up", "↑", "k"), binding("scroll down", "↓", "j"), binding("page up", "pgup"),
+				binding("page down", "pgdown"), binding("follow", "G", "end")},
+		}}
+	case "timeline":
+		return viewKeys{"Event Timeline", [][]key.Binding{
+			{binding("search", "/"), binding("filter source", "f"), binding("refresh", "r"), binding("clear search/back", "esc", "q")},
+			{binding("scroll up", "↑", "k"), binding("scroll down", "↓", "j"), binding("page up", "pgup"),
+				binding("page down", "pgdown"), binding("newest", "G", "end")},
+		}}
+	case "wizard":
+		return viewKeys{"Setup Wizard", [][]key.Binding{
+			{binding("next step", "enter"), binding("previous step", "esc"), binding("rescan or check again", "r")},
+			tableKeys,
+		}}
+	case "profiles":
+		return viewKeys{"Profiles", [][]key.Binding{
+			{binding("switch", "enter"), binding("switch and start NAT", "s"), binding("new from selected", "n"),
+				binding("delete", "d"), binding("refresh", "r"), backKeys},
+			tableKeys,
+		}}
+	case "rules":
+		return viewKeys{"Firewall Rules", [][]key.Binding{
+			{binding("block device or domain", "b"), binding("allow device or domain", "a"), binding("add schedule entry", "s"),
+				binding("delete", "d"), binding("refresh", "r"), backKeys},
+			tableKeys,
+		}}
+	case "notifications":
+		return viewKeys{"Notifications", [][]key.Binding{{binding("clear", "c"), backKeys}}}
+	case "input":
+		return viewKeys{"Edit Value", [][]key.Binding{{binding("save", "enter"), binding("cancel", "esc")}}}
+	}
+	return viewKeys{"Main Menu", [][]key.Binding{
+		{binding("interfaces", "1"), binding("NAT settings", "2"), binding("start NAT", "3"), binding("monitor", "4")},
+		{binding("stop NAT", "5"), binding("devices", "6"), binding("port forwards", "7"), binding("logs", "8")},
+		{binding("setup wizard", "9"), binding("profiles", "p"), binding("firewall rules", "f"), binding("event timeline", "t")},
+		{binding("quit", "q", "esc", "ctrl+c")},
+	}}
+}
+
+// handleHelpKeys closes the help overlay
+func (m Model) handleHelpKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "?", "esc", "q", "enter":
+		m.showHelp = false
+	}
+	return m, nil
+}
+
+func (m Model) helpView() string {
+	view := m.currentView
+	if view == "monitor" && m.replaying() {
+		view = "replay"
+	}
+	keys := helpKeys(view)
+	h := help.New()
+	h.ShowAll = true
+	if m.width > 0 {
+		h.Width = m.width
+	}
+
+	content := titleStyle.Render("Keys: "+keys.title) + "\n\n"
+	content += h.View(keys) + "\n\n"
+	content += titleStyle.Render("Everywhere") + "\n\n"
+	content += h.FullHelpView([][]key.Binding{globalKeys}) + "\n\n"
+	content += helpStyle.Render("'?' or 'esc' to close")
+	return content
+}
@@ -0,0 +1,81 @@
+package tui
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/charmbracelet/bubbles/list"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// interfaceHint describes how suitable an interface is for either side of
+// NAT: the external one needs the default route, the internal one is best
+// a bridge or a spare adapter
+func interfaceHint(iface nat.NetworkInterface) string {
+	switch {
+	case iface.Status != "up":
+		return "down"
+	case iface.DefaultRoute:
+		return "✓ default route, external candidate"
+	case iface.Type == "Bridge":
+		return "internal candidate"
+	case iface.IP == "":
+		return "no address, internal candidate"
+	}
+	return "no default route"
+}
+
+// interfaceRole returns "external" or "internal" if the interface is
+// selected as either
+func interfaceRole(cfg *config.Config, name string) string {
+	switch name {
+	case cfg.ExternalInterface:
+		return "external"
+	case cfg.InternalInterface:
+		return "internal"
+	}
+	return ""
+}
+
+// refreshInterfaceItems lists the interfaces with their hints and roles,
+// keeping the selection
+func (m *Model) refreshInterfaceItems() {
+	items := make([]list.Item, len(m.interfaces))
+	for i, iface := range m.interfaces {
+		items[i] = interfaceItem{iface: iface, role: interfaceRole(m.config, iface.Name), hint: interfaceHint(iface)}
+	}
+	m.list.SetItems(items)
+}
+
+// interfaceWarnings returns the conflicts of the selected interfaces and
+// the internal network
+func interfaceWarnings(cfg *config.Config, interfaces []nat.NetworkInterface) []string {
+	var warnings []string
+	if cfg.ExternalInterface != "" && cfg.ExternalInterface == cfg.InternalInterface {
+		warnings = append(warnings, fmt.Sprintf("External and internal interface are both %s", cfg.ExternalInterface))
+	}
+
+	for _, iface := range interfaces {
+		if iface.Name != cfg.ExternalInterface || iface.Name == cfg.InternalInterface {
+			continue
+		}
+		if iface.Status != "up" {
+			warnings = append(warnings, fmt.Sprintf("External interface %s is down", iface.Name))
+		} else if !iface.DefaultRoute {
+			warnings = append(warnings, fmt.Sprintf("External interface %s does not hold the default route, clients may not reach the internet", iface.Name))
+		}
+		if overlaps(cfg.GetInternalCIDR(), iface.Network) {
+			warnings = append(warnings, fmt.Sprintf("Internal network %s overlaps %s on %s", cfg.GetInternalCIDR(), iface.Network, iface.Name))
+		}
+	}
+	return warnings
+}
+
+// overlaps reports whether two networks in CIDR notation overlap
+func overlaps(a, b string) bool {
+	_, na, errA := net.ParseCIDR(a)
+	_, nb, errB := net.ParseCIDR(b)
+	return errA == nil && errB == nil && (na.Contains(nb.IP) || nb.Contains(na.IP))
+}
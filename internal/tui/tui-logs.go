@@ -0,0 +1,312 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Log viewer limits
+const (
+	maxLogLines  = 1000     // lines kept for scrollback
+	logBacklog   = 64 << 10 // bytes of history read when a log is opened
+	logPageLines = 15       // lines shown at once
+)
+
+// Components of the manager's own log lines; servers use their name
+const (
+	componentNAT = "manager"
+	componentPF  = "pf"
+)
+
+// Severities of log lines
+const (
+	severityInfo  = "info"
+	severityWarn  = "warn"
+	severityError = "error"
+)
+
+// logLine is a line of the log viewer
+type logLine struct {
+	time      time.Time
+	component string // manager, pf or the server's name, such as dnsmasq
+	severity  string
+	text      string
+}
+
+// logTail follows a log file from the offset read so far
+type logTail struct {
+	path   string
+	audit  bool   // JSON Lines audit log rather than plain server output
+	server string // component of a server log
+	offset int64  // -1 until the file has been opened
+}
+
+// logViewer is the state of the logs view
+type logViewer struct {
+	tails   []logTail
+	lines   []logLine
+	reading bool
+	paused  bool
+	scroll  int    // lines scrolled back from the newest
+	filter  string // component shown, all if empty
+}
+
+// logsMsg carries the lines appended to the logs since the last read
+type logsMsg struct {
+	tails []logTail
+	lines []logLine
+}
+
+// logTails returns the logs the viewer follows: the audit log of the
+// manager's changes, including pf, and the output of the supervised servers
+func logTails(manager *nat.Manager) []logTail {
+	var tails []logTail
+	if path, err := config.GetAuditLogPath(); err == nil {
+		tails = append(tails, logTail{path: path, audit: true, offset: -1})
+	}
+	logs := manager.ServerLogs()
+	servers := make([]string, 0, len(logs))
+	for server := range logs {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		tails = append(tails, logTail{path: logs[server], server: server, offset: -1})
+	}
+	return tails
+}
+
+// readLogs reads what was appended to each log since its offset
+func readLogs(tails []logTail) tea.Cmd {
+	tails = append([]logTail{}, tails...)
+	return func() tea.Msg {
+		var lines []logLine
+		for i := range tails {
+			lines = append(lines, tails[i].read(time.Now())...)
+		}
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].time.Before(lines[j].time) })
+		return logsMsg{tails: tails, lines: lines}
+	}
+}
+
+// read returns the complete lines appended since the last read. A file
+// opened for the first time starts with its recent history and a file
+// smaller than the offset has been rotated and is read from the start.
+func (t *logTail) read(now time.Time) []logLine {
+	file, err := os.Open(t.path)
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+
+	start, skipPartial := t.offset, false
+	switch {
+	case t.offset < 0:
+		start, skipPartial = max(info.Size()-logBacklog, 0), info.Size() > logBacklog
+	case info.Size() < t.offset:
+		start = 0
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return nil
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil
+	}
+
+	// Leave a partially written last line for the next read
+	end := strings.LastIndexByte(string(data), '\n') + 1
+	t.offset = start + int64(end)
+	text := string(data[:end])
+	if skipPartial {
+		_, text, _ = strings.Cut(text, "\n")
+	}
+
+	var lines []logLine
+	for _, raw := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if line, ok := t.parse(raw, now); ok {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// parse turns a raw line of the log into a viewer line
+func (t *logTail) parse(raw string, now time.Time) (logLine, bool) {
+	if strings.TrimSpace(raw) == "" {
+		return logLine{}, false
+	}
+	if !t.audit {
+		return logLine{time: now, component: t.server, severity: serverSeverity(raw), text: raw}, true
+	}
+
+	var entry audit.Entry
+	if json.Unmarshal([]byte(raw), &entry) != nil {
+		return logLine{}, false
+	}
+	if entry.Instance != "" && entry.Instance != config.Instance() {
+		return logLine{}, false
+	}
+	line := logLine{time: entry.Time, component: componentNAT, severity: severityInfo}
+	if entry.Action == "pfctl" {
+		line.component = componentPF
+	}
+	line.text = strings.TrimSpace(fmt.Sprintf("%s %s %s: %s", entry.Actor, entry.Action, entry.Target, entry.Result))
+	if entry.Result == "failed" {
+		line.severity, line.text = severityError, line.text+" ("+entry.Detail+")"
+	}
+	return line, true
+}
+
+// serverSeverity guesses the severity of a line of server output
+func serverSeverity(line string) string {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.Contains(lower, "error"), strings.Contains(lower, "fail"), strings.Contains(lower, "fatal"):
+		return severityError
+	case strings.Contains(lower, "warn"), strings.Contains(lower, "stopped"):
+		return severityWarn
+	}
+	return severityInfo
+}
+
+// handleLogs appends new lines, keeping the scrolled position in place
+func (m Model) handleLogs(msg logsMsg) (tea.Model, tea.Cmd) {
+	m.logs.reading = false
+	m.logs.tails = msg.tails
+	if m.logs.scroll > 0 {
+		m.logs.scroll += len(m.logs.visible(msg.lines))
+	}
+	m.logs.lines = append(m.logs.lines, msg.lines...)
+	if excess := len(m.logs.lines) - maxLogLines; excess > 0 {
+		m.logs.lines = m.logs.lines[excess:]
+		m.logs.scrollBy(0)
+	}
+	return m, nil
+}
+
+// pollLogs reads the logs unless the viewer is paused or already reading
+func (m Model) pollLogs() (Model, tea.Cmd) {
+	if m.logs.paused || m.logs.reading {
+		return m, nil
+	}
+	if m.logs.tails == nil {
+		m.logs.tails = logTails(m.manager)
+	}
+	m.logs.reading = true
+	return m, readLogs(m.logs.tails)
+}
+
+func (m Model) handleLogsKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		m.currentView = "menu"
+	case "p", " ":
+		m.logs.paused = !m.logs.paused
+		if !m.logs.paused {
+			return m.pollLogs()
+		}
+	case "f":
+		m.logs.filter = m.logs.nextFilter()
+		m.logs.scroll = 0
+	case "c":
+		m.logs.lines, m.logs.scroll = nil, 0
+	case "up", "k":
+		m.logs.scrollBy(1)
+	case "down", "j":
+		m.logs.scrollBy(-1)
+	case "pgup":
+		m.logs.scrollBy(logPageLines)
+	case "pgdown":
+		m.logs.scrollBy(-logPageLines)
+	case "G", "end":
+		m.logs.scroll = 0
+	}
+	return m, nil
+}
+
+// scrollBy moves back by n lines, or forward for a negative n, staying
+// within the lines shown
+func (v *logViewer) scrollBy(n int) {
+	limit := max(len(v.visible(v.lines))-logPageLines, 0)
+	v.scroll = min(max(v.scroll+n, 0), limit)
+}
+
+// visible returns the lines passing the component filter
+func (v *logViewer) visible(lines []logLine) []logLine {
+	if v.filter == "" {
+		return lines
+	}
+	var shown []logLine
+	for _, line := range lines {
+		if line.component == v.filter {
+			shown = append(shown, line)
+		}
+	}
+	return shown
+}
+
+// nextFilter cycles the component filter through all components
+func (v *logViewer) nextFilter() string {
+	components := []string{"", componentNAT, componentPF}
+	for _, tail := range v.tails {
+		if tail.server != "" {
+			components = append(components, tail.server)
+		}
+	}
+	for i, component := range components {
+		if component == v.filter {
+			return components[(i+1)%len(components)]
+		}
+	}
+	return ""
+}
+
+func (m Model) logsView() string {
+	content := titleStyle.Render("Logs") + "\n\n"
+
+	filter, state := "all", "following"
+	if m.logs.filter != "" {
+		filter = m.logs.filter
+	}
+	if m.logs.paused {
+		state = "paused"
+	} else if m.logs.scroll > 0 {
+		state = fmt.Sprintf("%d lines back", m.logs.scroll)
+	}
+	content += fmt.Sprintf("Component: %s | %s\n\n", filter, state)
+
+	lines := m.logs.visible(m.logs.lines)
+	end := len(lines) - m.logs.scroll
+	if len(lines) == 0 {
+		content += "No log lines yet\n"
+	}
+	for _, line := range lines[max(end-logPageLines, 0):end] {
+		text := fmt.Sprintf("%s %-8s %s", line.time.Local().Format("15:04:05"), line.component, line.text)
+		switch line.severity {
+		case severityError:
+			text = errorStyle.Render(text)
+		case severityWarn:
+			text = warnStyle.Render(text)
+		}
+		content += text + "\n"
+	}
+
+	content += "\n" + helpStyle.Render("'p' pause, 'f' filter component, '↑/↓/pgup/pgdown' scroll, 'G' follow, 'c' clear, 'esc' back")
+	return content
+}
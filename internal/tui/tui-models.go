@@ -2,8 +2,10 @@ package tui
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
@@ -14,24 +16,51 @@ import (
 
 // Model represents the TUI application model
 type Model struct {
-	app         *App
-	config      *config.Config
-	manager     *nat.Manager
-	state       string
-	interfaces  []nat.NetworkInterface
-	connections []nat.Connection
-	list        list.Model
-	table       table.Model
-	textInput   textinput.Model
-	err         error
-	width       int
-	height      int
-	currentView string
-	inputField  string
+	app          *App
+	config       *config.Config
+	manager      *nat.Manager
+	state        string
+	interfaces   []nat.NetworkInterface
+	connections  []nat.Connection
+	devices      []nat.Device
+	device       deviceDetail
+	list         list.Model
+	table        table.Model
+	deviceTable  table.Model
+	textInput    textinput.Model
+	forwardTable table.Model
+	profileTable table.Model
+	profiles     []profileEntry
+	rulesTable   table.Model
+	rules        []firewallRule
+	forwardForm  forwardForm
+	logs         logViewer
+	traffic      trafficHistory
+	showHelp     bool
+	conns        connectionTable
+	dialog       *confirmDialog
+	width        int
+	height       int
+	currentView  string
+	inputField   string
+	inputReturn  string // view the input returns to, the configuration if empty
+	inputDevice  string // MAC or IP of the device being named
+	palette      palette
+	settings     configEditor
+	wizard       setupWizard
+	toasts       notifications
+	wan          wanStatus
+	refreshed    time.Time // when the current view's data was last reloaded
+	progress     natProgress
+	timeline     timeline
+	replay       replayer // recorded session shown in the monitor, see SetReplay
 }
 
 // Init initializes the model
 func (m Model) Init() tea.Cmd {
+	if m.replaying() {
+		return tea.Batch(tick(), m.nextFrame())
+	}
 	return tea.Batch(
 		getInterfaces(m.manager),
 		tick(),
@@ -47,8 +76,30 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.handleInterfaces(msg)
 	case connectionsMsg:
 		return m.handleConnections(msg)
+	case devicesMsg:
+		return m.handleDevices(msg)
+	case queriesMsg:
+		return m.handleQueries(msg)
+	case logsMsg:
+		return m.handleLogs(msg)
+	case timelineMsg:
+		return m.handleTimeline(msg)
+	case trafficMsg:
+		return m.handleTraffic(msg)
+	case replayMsg:
+		return m.handleReplay(msg)
 	case natResultMsg:
 		return m.handleNATResult(msg)
+	case natStepMsg:
+		return m.handleNATStep(msg)
+	case spinner.TickMsg:
+		return m.handleSpinner(msg)
+	case wanMsg:
+		return m.handleWAN(msg)
+	case exportMsg:
+		return m.handleExport(msg)
+	case copiedMsg:
+		return m.handleCopied(msg)
 	case tickMsg:
 		return m.handleTick()
 	case tea.KeyMsg:
@@ -66,41 +117,99 @@ func (m Model) handleWindowSize(msg tea.WindowSizeMsg) (tea.Model, tea.Cmd) {
 
 func (m Model) handleInterfaces(msg interfacesMsg) (tea.Model, tea.Cmd) {
 	m.interfaces = msg.interfaces
-	items := make([]list.Item, len(m.interfaces))
-	for i, iface := range m.interfaces {
-		items[i] = interfaceItem{iface}
-	}
-	m.list.SetItems(items)
-	return m, nil
-}
-
-func (m Model) handleConnections(msg connectionsMsg) (tea.Model, tea.Cmd) {
-	m.connections = msg.connections
-	rows := make([]table.Row, len(m.connections))
-	for i, conn := range m.connections {
-		rows[i] = table.Row{conn.Source, conn.Destination, conn.Protocol, conn.State}
+	if m.currentView == "wizard" && m.wizard.step <= stepInternal {
+		m.wizard.preselect(m.interfaces)
 	}
-	m.table.SetRows(rows)
+	m.refreshInterfaceItems()
 	return m, nil
 }
 
 func (m Model) handleNATResult(msg natResultMsg) (tea.Model, tea.Cmd) {
+	m.progress = natProgress{}
 	if msg.success {
-		m.err = nil
+		m.showNotice(msg.result)
 	} else {
-		m.err = msg.err
+		m.showError(msg.err)
 	}
 	return m, nil
 }
 
+// handleTick refreshes the current view once its refresh interval passed
+// and, while NAT runs or the main menu shows its health, watches the
+// devices and the uplink for notifications. A paused monitor keeps its
+// connections and traffic.
 func (m Model) handleTick() (tea.Model, tea.Cmd) {
-	if m.manager.IsActive() {
-		return m, tea.Batch(getConnections(m.manager), tick())
+	now := time.Now()
+	m.toasts.expire(now)
+	cmds := []tea.Cmd{tick()}
+	if m.replaying() {
+		return m, tea.Batch(cmds...)
+	}
+	if now.Sub(m.refreshed) < m.config.TUI.Refresh.GetInterval(m.currentView, m.manager.IsActive()) {
+		return m, tea.Batch(cmds...)
+	}
+	m.refreshed = now
+
+	paused := m.currentView == "monitor" && m.conns.paused
+	if m.currentView == "logs" {
+		var cmd tea.Cmd
+		m, cmd = m.pollLogs()
+		cmds = append(cmds, cmd)
+	}
+	if m.currentView == "timeline" {
+		var cmd tea.Cmd
+		m, cmd = m.pollTimeline()
+		cmds = append(cmds, cmd)
+	}
+	if m.currentView == "devices" || m.currentView == "device" || m.currentView == "rules" || m.manager.IsActive() {
+		cmds = append(cmds, m.getDevices())
 	}
-	return m, tick()
+	if m.manager.IsActive() && !paused {
+		cmds = append(cmds, m.getConnections())
+	}
+	if m.currentView == "menu" || m.manager.IsActive() {
+		cmds = append(cmds, m.checkWAN())
+	}
+	if (m.currentView == "monitor" || m.currentView == "device") && m.manager.IsActive() && !paused {
+		cmds = append(cmds, m.getTraffic())
+	}
+	if m.currentView == "device" {
+		cmds = append(cmds, getQueries(m.device.device.IP))
+	}
+	return m, tea.Batch(cmds...)
 }
 
 func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.dialog != nil:
+		return m.handleDialogKeys(msg)
+	case m.palette.open:
+		return m.handlePaletteKeys(msg)
+	case m.showHelp:
+		return m.handleHelpKeys(msg)
+	case m.editing():
+		// Text fields get every key, so ctrl+k keeps its delete-to-end meaning
+		return m.handleViewKeys(msg)
+	}
+
+	switch msg.String() {
+	case "?":
+		m.showHelp = true
+		return m, nil
+	case "ctrl+k":
+		return m.openPalette()
+	case "ctrl+s":
+		return m.exportCurrentView(exportText)
+	case "ctrl+n":
+		return m.switchView("notifications")
+	case "Y":
+		return m.copyStatus()
+	}
+	return m.handleViewKeys(msg)
+}
+
+// handleViewKeys passes a key to the current view
+func (m Model) handleViewKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch m.currentView {
 	case "menu":
 		return m.handleMenuKeys(msg)
@@ -110,8 +219,28 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleConfigKeys(msg)
 	case "monitor":
 		return m.handleMonitorKeys(msg)
+	case "devices":
+		return m.handleDevicesKeys(msg)
+	case "device":
+		return m.handleDeviceKeys(msg)
+	case "forwards":
+		return m.handleForwardsKeys(msg)
+	case "forward_edit":
+		return m.handleForwardEditKeys(msg)
+	case "logs":
+		return m.handleLogsKeys(msg)
 	case "input":
 		return m.handleInputKeys(msg)
+	case "wizard":
+		return m.handleWizardKeys(msg)
+	case "profiles":
+		return m.handleProfilesKeys(msg)
+	case "rules":
+		return m.handleRulesKeys(msg)
+	case "notifications":
+		return m.handleNotificationsKeys(msg)
+	case "timeline":
+		return m.handleTimelineKeys(msg)
 	}
 	return m, nil
 }
@@ -119,34 +248,97 @@ func (m Model) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (m Model) handleMenuKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "q", "esc", "ctrl+c":
-		m.app.cleanup()
-		return m, tea.Quit
+		return m.quit()
 	case "1":
-		m.currentView = "interfaces"
-		return m, getInterfaces(m.manager)
+		return m.switchView("interfaces")
 	case "2":
-		m.currentView = "config"
-		return m, nil
+		return m.switchView("config")
 	case "3":
-		if m.config.ExternalInterface != "" && m.config.InternalInterface != "" {
-			return m, setupNAT(m.manager)
-		}
-		m.err = fmt.Errorf("please configure interfaces first")
-		return m, nil
+		return m.startNAT()
 	case "4":
-		if m.manager.IsActive() {
-			m.currentView = "monitor"
-			return m, getConnections(m.manager)
-		}
-		m.err = fmt.Errorf("NAT is not active")
-		return m, nil
+		return m.switchView("monitor")
 	case "5":
-		if m.manager.IsActive() {
-			return m, teardownNAT(m.manager)
+		return m.stopNAT()
+	case "6":
+		return m.switchView("devices")
+	case "7":
+		return m.switchView("forwards")
+	case "8":
+		return m.switchView("logs")
+	case "9":
+		return m.startWizard()
+	case "p":
+		return m.switchView("profiles")
+	case "f":
+		return m.switchView("rules")
+	case "t":
+		return m.switchView("timeline")
+	}
+	return m, nil
+}
+
+// switchView changes the current view and loads the data it displays
+func (m Model) switchView(view string) (tea.Model, tea.Cmd) {
+	switch view {
+	case "interfaces", "config":
+		m.currentView = view
+		return m, getInterfaces(m.manager)
+	case "monitor":
+		if !m.manager.IsActive() {
+			m.showError(fmt.Errorf("NAT is not active"))
+			return m, nil
 		}
-		m.err = fmt.Errorf("NAT is not active")
+		m.currentView = view
+		return m, tea.Batch(m.getConnections(), m.getTraffic())
+	case "devices":
+		m.currentView = view
+		return m, m.getDevices()
+	case "forwards":
+		m.forwardTable.SetRows(m.forwardRows())
+	case "profiles":
+		m.refreshProfiles(activeProfile())
+	case "rules":
+		m.refreshRules()
+		m.currentView = view
+		return m, m.getDevices()
+	case "logs":
+		m.currentView = view
+		return m.pollLogs()
+	case "timeline":
+		m.currentView = view
+		return m.pollTimeline()
+	}
+	m.currentView = view
+	return m, nil
+}
+
+// startNAT starts NAT once both interfaces are configured
+func (m Model) startNAT() (tea.Model, tea.Cmd) {
+	if m.refuseReadOnly("Starting NAT") || m.busy() {
 		return m, nil
 	}
+	if m.config.ExternalInterface != "" && m.config.InternalInterface != "" {
+		prompt := fmt.Sprintf("Start NAT from %s to %s?", m.config.ExternalInterface, m.config.InternalInterface)
+		return m.confirmAction(prompt, func(m Model) (tea.Model, tea.Cmd) {
+			m.useConfig()
+			return m.runNAT(true)
+		})
+	}
+	m.showError(fmt.Errorf("please configure interfaces first"))
+	return m, nil
+}
+
+// stopNAT stops NAT if it is running
+func (m Model) stopNAT() (tea.Model, tea.Cmd) {
+	if m.refuseReadOnly("Stopping NAT") || m.busy() {
+		return m, nil
+	}
+	if m.manager.IsActive() {
+		return m.confirmAction("Stop NAT? Clients lose internet access.", func(m Model) (tea.Model, tea.Cmd) {
+			return m.runNAT(false)
+		})
+	}
+	m.showError(fmt.Errorf("NAT is not active"))
 	return m, nil
 }
 
@@ -156,15 +348,23 @@ func (m Model) handleInterfaceKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.currentView = "menu"
 		return m, nil
 	case "e":
+		if m.refuseReadOnly("Choosing interfaces") {
+			return m, nil
+		}
 		if len(m.interfaces) > 0 {
 			selected := m.list.SelectedItem().(interfaceItem)
 			m.config.ExternalInterface = selected.iface.Name
+			m.refreshInterfaceItems()
 		}
 		return m, nil
 	case "i":
+		if m.refuseReadOnly("Choosing interfaces") {
+			return m, nil
+		}
 		if len(m.interfaces) > 0 {
 			selected := m.list.SelectedItem().(interfaceItem)
 			m.config.InternalInterface = selected.iface.Name
+			m.refreshInterfaceItems()
 		}
 		return m, nil
 	case "r":
@@ -176,73 +376,34 @@ func (m Model) handleInterfaceKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
-func (m Model) handleConfigKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "q", "esc":
-		m.currentView = "menu"
-		return m, nil
-	case "1":
-		m.currentView = "input"
-		m.inputField = "network"
-		m.textInput.SetValue(m.config.InternalNetwork)
-		m.textInput.Focus()
-		return m, nil
-	case "2":
-		m.currentView = "input"
-		m.inputField = "dhcp_start"
-		m.textInput.SetValue(m.config.DHCPRange.Start)
-		m.textInput.Focus()
-		return m, nil
-	case "3":
-		m.currentView = "input"
-		m.inputField = "dhcp_end"
-		m.textInput.SetValue(m.config.DHCPRange.End)
-		m.textInput.Focus()
-		return m, nil
-	}
-	return m, nil
-}
-
-func (m Model) handleMonitorKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "q", "esc":
-		m.currentView = "menu"
-		return m, nil
-	case "r":
-		return m, getConnections(m.manager)
-	}
-
-	var cmd tea.Cmd
-	m.table, cmd = m.table.Update(msg)
-	return m, cmd
-}
-
 func (m Model) handleInputKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter":
 		value := m.textInput.Value()
-		switch m.inputField {
-		case "network":
-			m.config.InternalNetwork = value
-		case "dhcp_start":
-			m.config.DHCPRange.Start = value
-		case "dhcp_end":
-			m.config.DHCPRange.End = value
-		}
 		m.textInput.Blur()
 		m.textInput.SetValue("")
-		m.currentView = "config"
-
-		// Save configuration
-		if err := m.config.Save(); err != nil {
-			m.err = fmt.Errorf("failed to save config: %w", err)
+		m.currentView = m.returnView()
+		switch m.inputField {
+		case "nickname":
+			m.setNickname(value)
+			m.deviceTable.SetRows(m.deviceRows())
+			if err := m.config.Save(); err != nil {
+				m.showError(fmt.Errorf("failed to save config: %w", err))
+			}
+		case "profile":
+			m.createProfile(value)
+		case "throttle":
+			m = m.setThrottle(value)
+		case "block", "allow":
+			m = m.blockOrAllow(value, m.inputField == "block")
+		case "schedule":
+			m = m.addSchedule(value)
 		}
-
 		return m, nil
 	case "esc":
 		m.textInput.Blur()
 		m.textInput.SetValue("")
-		m.currentView = "config"
+		m.currentView = m.returnView()
 		return m, nil
 	}
 
@@ -251,17 +412,43 @@ func (m Model) handleInputKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// editing reports whether a text field has the keyboard
+func (m Model) editing() bool {
+	return m.currentView == "input" || m.currentView == "forward_edit" ||
+		m.currentView == "monitor" && m.conns.searching || m.currentView == "config" && m.settings.typing ||
+		m.currentView == "wizard" && m.wizard.typing() || m.currentView == "timeline" && m.timeline.searching
+}
+
+// returnView returns the view an input goes back to and forgets it
+func (m *Model) returnView() string {
+	view := m.inputReturn
+	m.inputReturn = ""
+	if view == "" {
+		return "config"
+	}
+	return view
+}
+
 // Interface item for list
 type interfaceItem struct {
 	iface nat.NetworkInterface
+	role  string // "external" or "internal" when selected
+	hint  string // suitability, see interfaceHint
 }
 
 func (i interfaceItem) Title() string {
+	if i.role != "" {
+		return fmt.Sprintf("%s [%s]", i.iface.Name, i.role)
+	}
 	return i.iface.Name
 }
 
 func (i interfaceItem) Description() string {
-	return fmt.Sprintf("%s - %s (%s)", i.iface.Type, i.iface.IP, i.iface.Status)
+	description := fmt.Sprintf("%s - %s (%s)", i.iface.Type, i.iface.IP, i.iface.Status)
+	if i.hint != "" {
+		description += " · " + i.hint
+	}
+	return description
 }
 
 func (i interfaceItem) FilterValue() string {
@@ -0,0 +1,190 @@
+package tui
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// paletteAction is an entry in the command palette
+type paletteAction struct {
+	title       string
+	description string
+	run         func(m Model) (tea.Model, tea.Cmd)
+}
+
+// palette holds the command palette state
+type palette struct {
+	open    bool
+	input   textinput.Model
+	cursor  int
+	matches []paletteAction
+}
+
+// paletteActions returns every action reachable from the command palette
+func paletteActions() []paletteAction {
+	return []paletteAction{
+		{"Start NAT", "Start NAT with the configured interfaces", Model.startNAT},
+		{"Stop NAT", "Stop NAT and tear down the internal network", Model.stopNAT},
+		{"Go to Main Menu", "Switch to the main menu", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("menu")
+		}},
+		{"Go to Interfaces", "Select external and internal interfaces", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("interfaces")
+		}},
+		{"Go to Configuration", "Edit network, DHCP and DNS settings", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("config")
+		}},
+		{"Go to Connection Monitor", "Watch active connections through NAT", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("monitor")
+		}},
+		{"Go to Devices", "List connected devices and block, reserve or name them", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("devices")
+		}},
+		{"Go to Firewall Rules", "Block and allow devices and domains, schedule NAT", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("rules")
+		}},
+		{"Go to Port Forwards", "List, add, edit and delete port forwards", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("forwards")
+		}},
+		{"Add Port Forward", "Forward an external port to an internal device", func(m Model) (tea.Model, tea.Cmd) {
+			return m.editForward(-1)
+		}},
+		{"Go to Logs", "Follow the manager, pf and DHCP/DNS server logs", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("logs")
+		}},
+		{"Go to Event Timeline", "Browse NAT, device, WAN and API events in order", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("timeline")
+		}},
+		{"Go to Profiles", "Preview, switch, create and delete configuration profiles", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("profiles")
+		}},
+		{"Run Setup Wizard", "Detect the interfaces, propose a free network and save a profile", Model.startWizard},
+		{"Show Notifications", "List past errors and events", func(m Model) (tea.Model, tea.Cmd) {
+			return m.switchView("notifications")
+		}},
+		{"Show Keybindings", "List every key of the current view", func(m Model) (tea.Model, tea.Cmd) {
+			m.showHelp = true
+			return m, nil
+		}},
+		{"Refresh Interfaces", "Reload the list of network interfaces", func(m Model) (tea.Model, tea.Cmd) {
+			return m, getInterfaces(m.manager)
+		}},
+		{"Copy Status Summary", "Copy the NAT's status, networks and clients to the clipboard", Model.copyStatus},
+		{"Export View as Text", "Save the current view to a text file and the clipboard", func(m Model) (tea.Model, tea.Cmd) {
+			return m.exportCurrentView(exportText)
+		}},
+		{"Export View as HTML", "Save the current view to an HTML file and the clipboard", func(m Model) (tea.Model, tea.Cmd) {
+			return m.exportCurrentView(exportHTML)
+		}},
+		{"Quit", "Stop NAT and exit", Model.quit},
+	}
+}
+
+// openPalette shows the command palette with all actions listed
+func (m Model) openPalette() (tea.Model, tea.Cmd) {
+	ti := textinput.New()
+	ti.Placeholder = "Type a command..."
+	ti.CharLimit = 50
+	ti.Width = 40
+	ti.Focus()
+
+	m.palette = palette{
+		open:    true,
+		input:   ti,
+		matches: filterPaletteActions(paletteActions(), ""),
+	}
+	return m, textinput.Blink
+}
+
+func (m Model) handlePaletteKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc", "ctrl+k", "ctrl+c":
+		m.palette.open = false
+		return m, nil
+	case "up", "ctrl+p":
+		if m.palette.cursor > 0 {
+			m.palette.cursor--
+		}
+		return m, nil
+	case "down", "ctrl+n":
+		if m.palette.cursor < len(m.palette.matches)-1 {
+			m.palette.cursor++
+		}
+		return m, nil
+	case "enter":
+		m.palette.open = false
+		if len(m.palette.matches) == 0 {
+			return m, nil
+		}
+		return m.palette.matches[m.palette.cursor].run(m)
+	}
+
+	var cmd tea.Cmd
+	m.palette.input, cmd = m.palette.input.Update(msg)
+	m.palette.matches = filterPaletteActions(paletteActions(), m.palette.input.Value())
+	m.palette.cursor = 0
+	return m, cmd
+}
+
+// filterPaletteActions returns the actions fuzzily matching the query, best first
+func filterPaletteActions(actions []paletteAction, query string) []paletteAction {
+	type scored struct {
+		action paletteAction
+		score  int
+	}
+
+	var results []scored
+	for _, action := range actions {
+		if score, ok := fuzzyScore(query, action.title); ok {
+			results = append(results, scored{action, score})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].score > results[j].score
+	})
+
+	matches := make([]paletteAction, len(results))
+	for i, result := range results {
+		matches[i] = result.action
+	}
+	return matches
+}
+
+// fuzzyScore reports whether every character of query appears in target in
+// order, scoring consecutive runs and word-start matches higher
+func fuzzyScore(query, target string) (int, bool) {
+	query = strings.ToLower(strings.ReplaceAll(query, " ", ""))
+	if query == "" {
+		return 0, true
+	}
+
+	runes := []rune(target)
+	score, qi, last := 0, 0, -1
+	qr := []rune(query)
+	for i, r := range runes {
+		if qi == len(qr) {
+			break
+		}
+		if unicode.ToLower(r) != qr[qi] {
+			continue
+		}
+		score++
+		if last == i-1 {
+			score += 2
+		}
+		if i == 0 || runes[i-1] == ' ' {
+			score += 3
+		}
+		last = i
+		qi++
+	}
+
+	if qi < len(qr) {
+		return 0, false
+	}
+	return score, true
+}
@@ -0,0 +1,232 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+)
+
+// profileEntry is a row of the profile switcher: the instance's own
+// configuration or a named profile
+type profileEntry struct {
+	name string
+	cfg  *config.Config
+	err  error // why the configuration could not be read
+}
+
+// newProfileTable returns the table of the profile switcher
+func newProfileTable() table.Model {
+	return table.New(
+		table.WithColumns([]table.Column{
+			{Title: "Profile", Width: 26},
+			{Title: "External", Width: 10},
+			{Title: "Internal", Width: 10},
+			{Title: "Network", Width: 18},
+		}),
+		table.WithFocused(true),
+		table.WithHeight(8),
+	)
+}
+
+// loadProfiles reads the instance's configuration and every profile
+func loadProfiles() ([]profileEntry, error) {
+	names, err := config.ListProfiles()
+	if err != nil {
+		return nil, err
+	}
+	instance := profileEntry{name: instanceConfig}
+	path, err := config.InstanceConfigPath()
+	if err == nil {
+		instance.cfg, instance.err = config.LoadFrom(path)
+	} else {
+		instance.err = err
+	}
+
+	entries := []profileEntry{instance}
+	for _, name := range names {
+		cfg, err := config.LoadProfile(name)
+		entries = append(entries, profileEntry{name: name, cfg: cfg, err: err})
+	}
+	return entries, nil
+}
+
+// activeProfile returns the entry name of the configuration in use
+func activeProfile() string {
+	if name := config.Profile(); name != "" {
+		return name
+	}
+	return instanceConfig
+}
+
+// refreshProfiles reloads the profiles into the table, keeping the cursor
+// on the profile named by selected
+func (m *Model) refreshProfiles(selected string) {
+	entries, err := loadProfiles()
+	if err != nil {
+		m.showError(err)
+		return
+	}
+	m.profiles = entries
+
+	rows := make([]table.Row, len(entries))
+	cursor := 0
+	for i, entry := range entries {
+		name := "  " + entry.name
+		if entry.name == activeProfile() {
+			name = "● " + entry.name
+		}
+		if entry.name == selected {
+			cursor = i
+		}
+		if entry.err != nil {
+			rows[i] = table.Row{name, "-", "-", "unreadable"}
+			continue
+		}
+		rows[i] = table.Row{name, orNone(entry.cfg.ExternalInterface), orNone(entry.cfg.InternalInterface), entry.cfg.GetInternalCIDR()}
+	}
+	m.profileTable.SetRows(rows)
+	m.profileTable.SetCursor(cursor)
+}
+
+// selectedProfile returns the entry under the cursor, if any
+func (m Model) selectedProfile() (profileEntry, bool) {
+	i := m.profileTable.Cursor()
+	if i < 0 || i >= len(m.profiles) {
+		return profileEntry{}, false
+	}
+	return m.profiles[i], true
+}
+
+func (m Model) handleProfilesKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		m.currentView = "menu"
+		return m, nil
+	case "enter", "s", "n", "d":
+		if m.refuseReadOnly("Changing profiles") {
+			return m, nil
+		}
+	}
+
+	switch msg.String() {
+	case "r":
+		entry, _ := m.selectedProfile()
+		m.refreshProfiles(entry.name)
+		return m, nil
+	case "enter":
+		next, _ := m.switchProfile()
+		return next, nil
+	case "s":
+		next, ok := m.switchProfile()
+		if !ok {
+			return next, nil
+		}
+		return next.startNAT()
+	case "n":
+		if _, ok := m.selectedProfile(); ok {
+			m.currentView = "input"
+			m.inputField = "profile"
+			m.inputReturn = "profiles"
+			m.textInput.SetValue("")
+			m.textInput.Focus()
+		}
+		return m, nil
+	case "d":
+		return m.deleteProfile()
+	}
+
+	var cmd tea.Cmd
+	m.profileTable, cmd = m.profileTable.Update(msg)
+	return m, cmd
+}
+
+// switchProfile makes the selected profile the configuration in use
+func (m Model) switchProfile() (Model, bool) {
+	entry, ok := m.selectedProfile()
+	if !ok {
+		return m, false
+	}
+	if err := setProfile(&m, entry.name); err != nil {
+		m.showError(err)
+		return m, false
+	}
+	m.useConfig()
+	m.refreshProfiles(entry.name)
+	m.showNotice(fmt.Sprintf("✅ Switched to %s", entry.name))
+	return m, true
+}
+
+// createProfile saves the selected profile's settings as a new profile
+func (m *Model) createProfile(name string) {
+	entry, ok := m.selectedProfile()
+	if !ok {
+		return
+	}
+	name = strings.TrimSpace(name)
+	if entry.err != nil {
+		m.showError(fmt.Errorf("cannot copy %s: %w", entry.name, entry.err))
+		return
+	}
+	if err := config.CreateProfile(name, entry.cfg); err != nil {
+		m.showError(err)
+		return
+	}
+	m.refreshProfiles(name)
+	m.showNotice(fmt.Sprintf("✅ Created profile %s from %s", name, entry.name))
+}
+
+// deleteProfile removes the selected profile after confirmation. Neither
+// the instance's configuration nor the profile in use can be deleted.
+func (m Model) deleteProfile() (tea.Model, tea.Cmd) {
+	entry, ok := m.selectedProfile()
+	switch {
+	case !ok:
+		return m, nil
+	case entry.name == instanceConfig:
+		m.showError(fmt.Errorf("the instance configuration cannot be deleted"))
+		return m, nil
+	case entry.name == activeProfile():
+		m.showError(fmt.Errorf("profile %s is in use, switch to another one first", entry.name))
+		return m, nil
+	}
+	return m.confirmAction(fmt.Sprintf("Delete profile %s?", entry.name), func(m Model) (tea.Model, tea.Cmd) {
+		if err := config.DeleteProfile(entry.name); err != nil {
+			m.showError(err)
+			return m, nil
+		}
+		m.refreshProfiles(activeProfile())
+		m.showNotice(fmt.Sprintf("🗑️ Deleted profile %s", entry.name))
+		return m, nil
+	})
+}
+
+func (m Model) profilesView() string {
+	content := titleStyle.Render("Profiles") + "\n\n"
+	content += fmt.Sprintf("In use: %s\n\n", activeProfile())
+	content += m.profileTable.View() + "\n\n"
+	content += m.profilePreview() + "\n"
+	content += helpStyle.Render("'enter' switch, 's' switch and start NAT, 'n' new from selected, 'd' delete, 'r' refresh, 'esc' back")
+	return content
+}
+
+// profilePreview describes the settings of the selected profile
+func (m Model) profilePreview() string {
+	entry, ok := m.selectedProfile()
+	if !ok {
+		return ""
+	}
+	if entry.err != nil {
+		return errorStyle.Render("✗ "+entry.err.Error()) + "\n"
+	}
+	cfg := entry.cfg
+	content := fmt.Sprintf("Interfaces:    %s → %s\n", orNone(cfg.ExternalInterface), orNone(cfg.InternalInterface))
+	content += fmt.Sprintf("Network:       %s, gateway %s\n", cfg.GetInternalCIDR(), cfg.GetGatewayIP())
+	content += fmt.Sprintf("DHCP:          %s - %s, lease %s\n", cfg.DHCPRange.Start, cfg.DHCPRange.End, cfg.DHCPRange.Lease)
+	content += fmt.Sprintf("DNS servers:   %s\n", strings.Join(cfg.DNSServers, ", "))
+	content += fmt.Sprintf("Port forwards: %d\n", len(cfg.PortForwards))
+	return content
+}
@@ -0,0 +1,116 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// natProgress is NAT starting or stopping in the background
+type natProgress struct {
+	action  string   // "Starting NAT" or "Stopping NAT", empty when idle
+	steps   []string // steps begun, the last one under way
+	spinner spinner.Model
+}
+
+// natStepMsg carries a step begun while starting or stopping NAT
+type natStepMsg struct {
+	step string
+	next tea.Cmd // waits for the following step or the result
+}
+
+// runNAT starts or stops NAT in the background, showing each step as it
+// begins
+func (m Model) runNAT(start bool) (tea.Model, tea.Cmd) {
+	action := "Stopping NAT"
+	if start {
+		action = "Starting NAT"
+	}
+	kind := spinner.Dot
+	if asciiOnly {
+		kind = spinner.Line
+	}
+	m.progress = natProgress{action: action, spinner: spinner.New(spinner.WithSpinner(kind))}
+	return m, tea.Batch(natOperation(m.manager, start), m.progress.spinner.Tick)
+}
+
+// natOperation starts or stops NAT, streaming its steps as natStepMsgs
+// followed by a natResultMsg
+func natOperation(manager *nat.Manager, start bool) tea.Cmd {
+	steps := make(chan string, 16)
+	result := new(natResultMsg)
+	return func() tea.Msg {
+		go func() {
+			manager.SetProgress(func(step string) { steps <- step })
+			if start {
+				*result = natResultMsg{success: true, result: "🟢 NAT started"}
+				if err := manager.StartNAT(); err != nil {
+					*result = natResultMsg{err: fmt.Errorf("failed to start NAT: %w", err)}
+				}
+			} else {
+				*result = natResultMsg{success: true, result: "🔴 NAT stopped"}
+				if err := manager.StopNAT(); err != nil {
+					*result = natResultMsg{err: fmt.Errorf("failed to stop NAT: %w", err)}
+				}
+			}
+			manager.SetProgress(nil)
+			close(steps)
+		}()
+		return nextStep(steps, result)()
+	}
+}
+
+// nextStep waits for the next step, or for the result once there are no
+// more
+func nextStep(steps <-chan string, result *natResultMsg) tea.Cmd {
+	return func() tea.Msg {
+		if step, ok := <-steps; ok {
+			return natStepMsg{step: step, next: nextStep(steps, result)}
+		}
+		return *result
+	}
+}
+
+func (m Model) handleNATStep(msg natStepMsg) (tea.Model, tea.Cmd) {
+	if m.progress.action != "" {
+		m.progress.steps = append(m.progress.steps, msg.step)
+	}
+	return m, msg.next
+}
+
+func (m Model) handleSpinner(msg spinner.TickMsg) (tea.Model, tea.Cmd) {
+	if m.progress.action == "" {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.progress.spinner, cmd = m.progress.spinner.Update(msg)
+	return m, cmd
+}
+
+// busy refuses to start or stop NAT while it is already starting or
+// stopping, reporting whether it did
+func (m *Model) busy() bool {
+	if m.progress.action == "" {
+		return false
+	}
+	m.showError(fmt.Errorf("%s, please wait", m.progress.action))
+	return true
+}
+
+// progressView shows the steps of starting or stopping NAT, the one under
+// way with the spinner
+func (m Model) progressView() string {
+	p := m.progress
+	content := fmt.Sprintf("%s %s...\n", p.spinner.View(), p.action)
+	for i, step := range p.steps {
+		mark := successStyle.Render("✓")
+		if i == len(p.steps)-1 {
+			mark = p.spinner.View()
+		}
+		content += fmt.Sprintf("   %s %s\n", mark, step)
+	}
+	return statusStyle.Render(content)
+}
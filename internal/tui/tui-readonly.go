@@ -0,0 +1,45 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Helper reads what needs root through the privileged helper
+type Helper interface {
+	Devices() ([]nat.Device, error)
+	Connections() ([]nat.Connection, error)
+}
+
+// SetReadOnly disables every action that changes the system or the
+// configuration, for running without root privileges. Status, devices,
+// connections and logs are still shown as far as they can be read.
+func (a *App) SetReadOnly(readOnly bool) {
+	a.readOnly = readOnly
+}
+
+// SetHelper makes the TUI read devices and connections through helper, for
+// running read-only without root
+func (a *App) SetHelper(helper Helper) {
+	a.helper = helper
+}
+
+// refuseReadOnly reports whether action is refused because the TUI runs
+// read-only, explaining why in a toast
+func (m *Model) refuseReadOnly(action string) bool {
+	if !m.app.readOnly {
+		return false
+	}
+	m.showError(fmt.Errorf("%s needs root privileges, restart nat-manager with sudo", action))
+	return true
+}
+
+// menuItem renders an entry of the main menu, dimmed when it needs root
+// and the TUI runs read-only
+func (m Model) menuItem(label string, changes bool) string {
+	if changes && m.app.readOnly {
+		return helpStyle.UnsetMargins().Render(label+" (needs root)") + "\n"
+	}
+	return label + "\n"
+}
@@ -0,0 +1,157 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/session"
+)
+
+// replayer plays a recorded monitor session in the connection monitor
+type replayer struct {
+	session *session.Session
+	speed   float64 // multiple of the recorded pace, 0 steps by hand only
+	frame   int     // index of the shown frame
+	paused  bool
+	seq     int // bumped on every pause and seek, dropping scheduled frames
+}
+
+// replayMsg advances a replay by a frame
+type replayMsg struct {
+	seq int
+}
+
+// SetReplay makes Run play a recorded monitor session in the connection
+// monitor, at speed times the recorded pace, instead of watching NAT.
+// Nothing is changed while replaying.
+func (a *App) SetReplay(recording *session.Session, speed float64) {
+	a.replay = &replayer{session: recording, speed: speed}
+	a.readOnly = true
+}
+
+// replaying reports whether the monitor shows a recorded session
+func (m Model) replaying() bool {
+	return m.replay.session != nil
+}
+
+// startReplay opens the connection monitor on the first frame of r, with
+// the interfaces the session was recorded on
+func (m Model) startReplay(r replayer) Model {
+	cfg := *m.config
+	cfg.ExternalInterface = r.session.Header.ExternalInterface
+	cfg.InternalInterface = r.session.Header.InternalInterface
+	cfg.InternalNetwork = r.session.Header.InternalNetwork
+	m.config = &cfg
+	m.replay = r
+	m.currentView = "monitor"
+	return m.showFrame(0)
+}
+
+// showFrame shows frame i of the replay. Throughput is the rate between
+// successive frames, so it starts over after a seek.
+func (m Model) showFrame(i int) Model {
+	frame := m.replay.session.Frames[i]
+	if i != m.replay.frame+1 {
+		m.traffic = trafficHistory{}
+	}
+	m.replay.frame = i
+	m.connections = frame.Status.ActiveConnections
+	m.refreshConnections()
+	m.traffic.add(frameTraffic(frame, m.config.ExternalInterface, m.config.InternalInterface))
+	return m
+}
+
+// frameTraffic returns the interface counters of a frame, with the
+// internal interface's turned around like getTraffic does
+func frameTraffic(frame session.Frame, external, internal string) trafficMsg {
+	msg := trafficMsg{time: frame.Time, interfaces: make(map[string]nat.Traffic)}
+	for _, c := range frame.Status.Interfaces {
+		switch c.Interface {
+		case external:
+			msg.interfaces[external] = nat.Traffic{BytesIn: c.BytesIn, BytesOut: c.BytesOut}
+		case internal:
+			msg.interfaces[internal] = nat.Traffic{BytesIn: c.BytesOut, BytesOut: c.BytesIn}
+		}
+	}
+	return msg
+}
+
+// nextFrame schedules the next frame after the recorded gap, scaled by
+// the replay speed
+func (m Model) nextFrame() tea.Cmd {
+	r := m.replay
+	if r.paused || r.speed <= 0 || r.frame+1 >= len(r.session.Frames) {
+		return nil
+	}
+	gap := r.session.Frames[r.frame+1].Time.Sub(r.session.Frames[r.frame].Time)
+	seq := r.seq
+	return tea.Tick(time.Duration(float64(gap)/r.speed), func(time.Time) tea.Msg {
+		return replayMsg{seq: seq}
+	})
+}
+
+func (m Model) handleReplay(msg replayMsg) (tea.Model, tea.Cmd) {
+	if !m.replaying() || msg.seq != m.replay.seq || m.replay.paused {
+		return m, nil
+	}
+	m = m.showFrame(m.replay.frame + 1)
+	return m, m.nextFrame()
+}
+
+// handleReplayKeys pauses, steps and restarts the replay, and quits it
+// instead of going back to the menu. It reports false for keys the
+// monitor handles.
+func (m Model) handleReplayKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	last := len(m.replay.session.Frames) - 1
+	switch msg.String() {
+	case "p", " ":
+		m.replay.paused = !m.replay.paused
+		m.replay.seq++
+		return m, m.nextFrame(), true
+	case "right", ".":
+		m.replay.paused = true
+		m.replay.seq++
+		return m.showFrame(min(m.replay.frame+1, last)), nil, true
+	case "left", ",":
+		m.replay.paused = true
+		m.replay.seq++
+		return m.showFrame(max(m.replay.frame-1, 0)), nil, true
+	case "r":
+		m.replay.paused = false
+		m.replay.seq++
+		m = m.showFrame(0)
+		return m, m.nextFrame(), true
+	case "q", "esc":
+		if m.conns.query == "" {
+			model, cmd := m.quit()
+			return model, cmd, true
+		}
+	}
+	return m, nil, false
+}
+
+// replayPosition describes the shown frame for the connections header
+func (m Model) replayPosition() string {
+	r := m.replay
+	position := fmt.Sprintf("⏪ frame %d/%d at %s", r.frame+1, len(r.session.Frames),
+		r.session.Frames[r.frame].Time.Format("2006-01-02 15:04:05"))
+	switch {
+	case r.paused:
+		position += " " + warnStyle.Render("⏸ paused")
+	case r.speed > 0 && r.speed != 1:
+		position += fmt.Sprintf(" (%gx)", r.speed)
+	}
+	return position
+}
+
+// monitorStatus returns the status the monitor shows: the shown frame's
+// while replaying, else the running NAT's
+func (m Model) monitorStatus() (*nat.Status, error) {
+	if m.replaying() {
+		return m.replay.session.Frames[m.replay.frame].Status, nil
+	}
+	return m.manager.GetStatus()
+}
@@ -0,0 +1,258 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Kinds of firewall rules
+const (
+	ruleBlockDevice = "block device"
+	ruleBlockDomain = "block domain"
+	ruleAllowDomain = "allow domain"
+	ruleSchedule    = "schedule"
+)
+
+// firewallRule is a row of the firewall rules view
+type firewallRule struct {
+	kind   string
+	target string // device, domain or schedule entry name
+}
+
+// newRulesTable returns the table of the firewall rules view
+func newRulesTable() table.Model {
+	return table.New(
+		table.WithColumns([]table.Column{
+			{Title: "Rule", Width: 14},
+			{Title: "Target", Width: 28},
+			{Title: "Details", Width: 30},
+		}),
+		table.WithFocused(true),
+		table.WithHeight(12),
+	)
+}
+
+// firewallRules lists the blocked devices, blocked and allowed domains and
+// the schedule of cfg
+func firewallRules(cfg *config.Config) []firewallRule {
+	var rules []firewallRule
+	for _, device := range cfg.BlockedDevices {
+		rules = append(rules, firewallRule{ruleBlockDevice, device})
+	}
+	for _, domain := range cfg.DNSBlocklist.Domains {
+		rules = append(rules, firewallRule{ruleBlockDomain, domain})
+	}
+	for _, domain := range cfg.DNSBlocklist.Allowlist {
+		rules = append(rules, firewallRule{ruleAllowDomain, domain})
+	}
+	for _, entry := range cfg.Schedule {
+		rules = append(rules, firewallRule{ruleSchedule, entry.Name})
+	}
+	return rules
+}
+
+// refreshRules reloads the rules into the table
+func (m *Model) refreshRules() {
+	m.rules = firewallRules(m.config)
+	rows := make([]table.Row, len(m.rules))
+	for i, rule := range m.rules {
+		rows[i] = table.Row{rule.kind, rule.target, m.ruleDetails(rule)}
+	}
+	m.rulesTable.SetRows(rows)
+	if m.rulesTable.Cursor() >= len(rows) {
+		m.rulesTable.SetCursor(max(len(rows)-1, 0))
+	}
+}
+
+// ruleDetails describes the device blocked or when a schedule entry runs
+func (m Model) ruleDetails(rule firewallRule) string {
+	switch rule.kind {
+	case ruleBlockDevice:
+		for _, device := range m.devices {
+			if matchesDevice(rule.target, device) {
+				return deviceName(m.config, device)
+			}
+		}
+		if label := m.config.DeviceLabels[strings.ToLower(rule.target)]; label != "" {
+			return label
+		}
+	case ruleSchedule:
+		for _, entry := range m.config.Schedule {
+			if entry.Name == rule.target {
+				return fmt.Sprintf("%s NAT at %s %s", entry.Action, entry.At, orDaily(entry.Days))
+			}
+		}
+	}
+	return ""
+}
+
+// orDaily shows schedule entries without days as daily
+func orDaily(days string) string {
+	if days == "" {
+		return "daily"
+	}
+	return days
+}
+
+func (m Model) handleRulesKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		m.currentView = "menu"
+		return m, nil
+	case "r":
+		m.refreshRules()
+		return m, m.getDevices()
+	case "b", "a", "s", "d":
+		if m.refuseReadOnly("Changing firewall rules") {
+			return m, nil
+		}
+	}
+
+	switch msg.String() {
+	case "b", "a", "s":
+		field := map[string]string{"b": "block", "a": "allow", "s": "schedule"}[msg.String()]
+		m.currentView = "input"
+		m.inputField = field
+		m.inputReturn = "rules"
+		m.textInput.SetValue("")
+		m.textInput.Focus()
+		return m, nil
+	case "d":
+		i := m.rulesTable.Cursor()
+		if i < 0 || i >= len(m.rules) {
+			return m, nil
+		}
+		rule := m.rules[i]
+		return m.confirmAction(fmt.Sprintf("Delete rule %s %s?", rule.kind, rule.target), func(m Model) (tea.Model, tea.Cmd) {
+			m = m.deleteRule(rule)
+			return m, nil
+		})
+	}
+
+	var cmd tea.Cmd
+	m.rulesTable, cmd = m.rulesTable.Update(msg)
+	return m, cmd
+}
+
+// blockOrAllow blocks or allows the devices and domains in value, like the
+// block and allow commands
+func (m Model) blockOrAllow(value string, block bool) Model {
+	args := strings.Fields(value)
+	if len(args) == 0 {
+		return m
+	}
+	devices, domains, err := nat.BlockTargets(args, func() []nat.Device { return m.devices })
+	if err != nil {
+		m.showError(err)
+		return m
+	}
+
+	verb := "Allowed"
+	if block {
+		verb = "Blocked"
+	}
+	m = m.changeRules(len(devices) > 0, func(cfg *config.Config) {
+		cfg.UpdateBlocks(devices, domains, block)
+	}, fmt.Sprintf("%s %s", verb, strings.Join(append(devices, domains...), ", ")))
+	if len(domains) > 0 && !m.config.DNSForwarder.Enabled {
+		m.toasts.notify(toastInfo, "⚠️  Domain blocking requires the embedded DNS forwarder (dns_forwarder.enabled)")
+	}
+	return m
+}
+
+// addSchedule adds a schedule entry given as "<start|stop> HH:MM [days]"
+func (m Model) addSchedule(value string) Model {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return m
+	}
+	if len(fields) < 2 || len(fields) > 3 {
+		m.showError(fmt.Errorf("expected <start|stop> HH:MM [days], e.g. start 09:00 mon-fri"))
+		return m
+	}
+	entry := config.ScheduleEntry{Action: fields[0], At: fields[1], Name: fields[0] + "-" + strings.ReplaceAll(fields[1], ":", "")}
+	if len(fields) == 3 {
+		entry.Days = fields[2]
+	}
+	return m.changeSchedule(func(schedule []config.ScheduleEntry) []config.ScheduleEntry {
+		return append(schedule, entry)
+	}, fmt.Sprintf("Scheduled %s NAT at %s %s", entry.Action, entry.At, orDaily(entry.Days)))
+}
+
+// deleteRule removes a rule and applies the change
+func (m Model) deleteRule(rule firewallRule) Model {
+	notice := fmt.Sprintf("Deleted rule %s %s", rule.kind, rule.target)
+	if rule.kind == ruleSchedule {
+		return m.changeSchedule(func(schedule []config.ScheduleEntry) []config.ScheduleEntry {
+			return slices.DeleteFunc(schedule, func(entry config.ScheduleEntry) bool { return entry.Name == rule.target })
+		}, notice)
+	}
+	return m.changeRules(rule.kind == ruleBlockDevice, func(cfg *config.Config) {
+		switch rule.kind {
+		case ruleBlockDevice:
+			cfg.BlockedDevices = config.RemoveItems(cfg.BlockedDevices, []string{rule.target})
+		case ruleBlockDomain:
+			cfg.DNSBlocklist.Domains = config.RemoveItems(cfg.DNSBlocklist.Domains, []string{rule.target})
+		case ruleAllowDomain:
+			cfg.DNSBlocklist.Allowlist = config.RemoveItems(cfg.DNSBlocklist.Allowlist, []string{rule.target})
+		}
+	}, notice)
+}
+
+// changeRules updates the block lists and saves them, reloading the pf
+// rules when devices changed. A running 'dns serve' picks up domains by
+// itself. On failure the configuration is left unchanged.
+func (m Model) changeRules(reload bool, update func(cfg *config.Config), notice string) Model {
+	devices, blocklist := m.config.BlockedDevices, m.config.DNSBlocklist
+	update(m.config)
+	var err error
+	if reload {
+		err = applyConfig(m.config)
+	} else if err = m.config.Save(); err != nil {
+		err = fmt.Errorf("failed to save config: %w", err)
+	}
+	if err != nil {
+		m.config.BlockedDevices, m.config.DNSBlocklist = devices, blocklist
+		m.showError(err)
+		return m
+	}
+	m.showNotice("✅ " + notice)
+	m.refreshRules()
+	return m
+}
+
+// changeSchedule updates the schedule, saves it and updates its jobs
+func (m Model) changeSchedule(update func([]config.ScheduleEntry) []config.ScheduleEntry, notice string) Model {
+	previous := m.config.Schedule
+	m.config.Schedule = update(slices.Clone(previous))
+	if err := m.app.saveSchedule(m.config); err != nil {
+		m.config.Schedule = previous
+		m.showError(err)
+		return m
+	}
+	m.showNotice("✅ " + notice)
+	m.refreshRules()
+	return m
+}
+
+func (m Model) rulesView() string {
+	content := titleStyle.Render("Firewall Rules") + "\n\n"
+	content += fmt.Sprintf("🚫 %d devices and %d domains blocked, %d domains allowed, %d schedule entries\n\n",
+		len(m.config.BlockedDevices), len(m.config.DNSBlocklist.Domains), len(m.config.DNSBlocklist.Allowlist), len(m.config.Schedule))
+
+	if len(m.rules) > 0 {
+		content += m.rulesTable.View() + "\n\n"
+	} else {
+		content += "No rules yet\n\n"
+	}
+
+	content += helpStyle.Render("'b' block device/domain, 'a' allow, 's' schedule, 'd' delete, 'r' refresh, 'esc' back")
+	return content
+}
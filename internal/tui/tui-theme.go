@@ -0,0 +1,124 @@
+package tui
+
+import (
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+)
+
+// theme colors the interface by role, see config.ColorRoles. Roles
+// without a color are rendered in the terminal's default color.
+type theme struct {
+	colors map[string]string
+	plain  bool // no colors at all, including those of lists and tables
+	ascii  bool // ASCII borders and symbols only
+}
+
+var themes = map[string]theme{
+	config.ThemeDefault: {colors: map[string]string{
+		"title": "205", "help": "241", "error": "196", "success": "46", "warning": "214", "accent": "62",
+	}},
+	config.ThemeLight: {colors: map[string]string{
+		"title": "127", "help": "244", "error": "160", "success": "28", "warning": "166", "accent": "25",
+	}},
+	config.ThemeMono:  {plain: true},
+	config.ThemeASCII: {plain: true, ascii: true},
+}
+
+// Styles, set by applyTheme
+var (
+	titleStyle   lipgloss.Style
+	helpStyle    lipgloss.Style
+	errorStyle   lipgloss.Style
+	successStyle lipgloss.Style
+	warnStyle    lipgloss.Style
+	statusStyle  lipgloss.Style
+	dialogStyle  lipgloss.Style
+	toastStyles  map[string]lipgloss.Style
+
+	asciiOnly bool // replace symbols in the rendered views
+)
+
+// asciiBorder draws boxes with plain ASCII characters
+var asciiBorder = lipgloss.Border{
+	Top: "-", Bottom: "-", Left: "|", Right: "|",
+	TopLeft: "+", TopRight: "+", BottomLeft: "+", BottomRight: "+",
+}
+
+// asciiSymbols replaces the symbols of the views and of the bubbles
+// widgets in the ASCII theme
+var asciiSymbols = strings.NewReplacer(
+	"\ufe0f", "",
+	"🟢", "[on]", "🔴", "[off]", "✅", "[ok]", "❌", "[x]", "⚠", "[!]", "🚫", "[blocked]",
+	"📌", "[reserved]", "📱", "", "🌍", "", "🔌", "", "🌐", "", "📁", "", "🗑", "", "📊", "",
+	"📸", "", "📶", "", "💡", "", "🔗", "", "📈", "", "🩺", "", "🔒", "", "⏸", "||", "📋", "",
+	"✓", "v", "✗", "x", "▸", ">", "●", "*", "…", "...", "→", "->", "←", "<-", "↑", "^", "↓", "v",
+	"▁", "_", "▂", ".", "▃", "-", "▄", "=", "▅", "+", "▆", "*", "▇", "%", "█", "#", "░", ".",
+	"─", "-", "│", "|", "┃", "|", "╭", "+", "╮", "+", "╰", "+", "╯", "+", "┌", "+", "┐", "+", "└", "+", "┘", "+",
+	"•", "*", "·", "-",
+)
+
+func init() {
+	setStyles(themes[config.ThemeDefault])
+}
+
+// applyTheme styles the interface with the configured theme and colors.
+// Without a theme, NO_COLOR in the environment selects the mono theme.
+func applyTheme(cfg config.TUIConfig) {
+	name := cfg.Theme
+	if name == "" && os.Getenv("NO_COLOR") != "" {
+		name = config.ThemeMono
+	}
+	t, ok := themes[name]
+	if !ok {
+		t = themes[config.ThemeDefault]
+	}
+
+	colors := make(map[string]string, len(t.colors)+len(cfg.Colors))
+	for role, color := range t.colors {
+		colors[role] = color
+	}
+	for role, color := range cfg.Colors {
+		colors[role] = color
+	}
+	t.colors = colors
+
+	if t.plain {
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+	setStyles(t)
+}
+
+// setStyles builds the styles of t
+func setStyles(t theme) {
+	color := func(role string) lipgloss.TerminalColor {
+		if c, ok := t.colors[role]; ok && !t.plain {
+			return lipgloss.Color(c)
+		}
+		return lipgloss.NoColor{}
+	}
+	border := lipgloss.RoundedBorder()
+	if t.ascii {
+		border = asciiBorder
+	}
+
+	titleStyle = lipgloss.NewStyle().Foreground(color("title")).Bold(true).Margin(1, 0)
+	helpStyle = lipgloss.NewStyle().Foreground(color("help")).Margin(1, 0)
+	errorStyle = lipgloss.NewStyle().Foreground(color("error")).Bold(true)
+	successStyle = lipgloss.NewStyle().Foreground(color("success")).Bold(true)
+	warnStyle = lipgloss.NewStyle().Foreground(color("warning"))
+	statusStyle = lipgloss.NewStyle().Padding(1, 2).Border(border).BorderForeground(color("accent"))
+	dialogStyle = lipgloss.NewStyle().Padding(1, 2).Border(border).BorderForeground(color("warning"))
+
+	toast := lipgloss.NewStyle().Padding(0, 1).Border(border)
+	toastStyles = map[string]lipgloss.Style{
+		toastInfo:    toast.BorderForeground(color("accent")),
+		toastSuccess: toast.BorderForeground(color("success")),
+		toastError:   toast.BorderForeground(color("error")),
+	}
+	asciiOnly = t.ascii
+}
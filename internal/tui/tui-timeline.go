@@ -0,0 +1,279 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+)
+
+// Timeline limits
+const (
+	timelineLimit = 500 // newest audit log events read
+	timelinePage  = 15  // events shown at once
+)
+
+// Sources of timeline events: the instance's events, API calls and portal
+// redemptions and failed system commands from the audit log, and the
+// notifications of this session
+const (
+	timelineNAT     = "nat"
+	timelineAPI     = "api"
+	timelinePortal  = "portal"
+	timelineSystem  = "system"
+	timelineSession = "session"
+)
+
+// timelineSources are the filters of the timeline, all sources first
+var timelineSources = []string{"", timelineNAT, timelineSession, timelineAPI, timelinePortal, timelineSystem}
+
+// timelineEvent is a line of the timeline
+type timelineEvent struct {
+	time   time.Time
+	source string
+	failed bool
+	text   string
+}
+
+// timeline is the state of the event timeline view
+type timeline struct {
+	events    []timelineEvent // read from the audit log
+	err       error
+	reading   bool
+	scroll    int    // events scrolled back from the newest
+	source    string // source shown, all if empty
+	query     string // text the events shown contain
+	search    textinput.Model
+	searching bool
+}
+
+// timelineMsg carries the events read from the audit log
+type timelineMsg struct {
+	events []timelineEvent
+	err    error
+}
+
+// readTimeline reads the instance's newest events from the audit log
+func readTimeline() tea.Cmd {
+	return func() tea.Msg {
+		path, err := config.GetAuditLogPath()
+		if err != nil {
+			return timelineMsg{err: err}
+		}
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return timelineMsg{}
+		}
+		if err != nil {
+			return timelineMsg{err: err}
+		}
+		defer func() { _ = file.Close() }()
+		entries, err := audit.Read(file, audit.Query{})
+		if err != nil {
+			return timelineMsg{err: err}
+		}
+
+		var events []timelineEvent
+		for _, entry := range entries {
+			if event, ok := auditEvent(entry); ok {
+				events = append(events, event)
+			}
+		}
+		return timelineMsg{events: events[max(len(events)-timelineLimit, 0):]}
+	}
+}
+
+// auditEvent turns an audit entry of the instance into a timeline event.
+// Successful system commands are left to the logs view.
+func auditEvent(entry audit.Entry) (timelineEvent, bool) {
+	if entry.Instance != "" && entry.Instance != config.Instance() {
+		return timelineEvent{}, false
+	}
+	event := timelineEvent{time: entry.Time, failed: entry.Result == "failed"}
+	switch entry.Source {
+	case audit.SourceEvent:
+		event.source = timelineNAT
+		event.text = strings.TrimSpace(entry.Action + " " + entry.Target)
+	case audit.SourceSystem:
+		if !event.failed {
+			return timelineEvent{}, false
+		}
+		event.source = timelineSystem
+		event.text = fmt.Sprintf("%s %s failed: %s", entry.Action, entry.Target, entry.Detail)
+	case audit.SourceAPI, audit.SourcePortal:
+		event.source = entry.Source
+		event.text = strings.TrimSpace(fmt.Sprintf("%s %s %s: %s", entry.Actor, entry.Action, entry.Target, entry.Result))
+	default:
+		return timelineEvent{}, false
+	}
+	return event, true
+}
+
+func (m Model) handleTimeline(msg timelineMsg) (tea.Model, tea.Cmd) {
+	m.timeline.reading = false
+	m.timeline.err = msg.err
+	if msg.err == nil {
+		shown := len(m.timelineEvents())
+		m.timeline.events = msg.events
+		if m.timeline.scroll > 0 {
+			m.timeline.scrollBy(len(m.timelineEvents()) - shown)
+		}
+	}
+	return m, nil
+}
+
+// pollTimeline reads the audit log unless a read is under way
+func (m Model) pollTimeline() (Model, tea.Cmd) {
+	if m.timeline.reading {
+		return m, nil
+	}
+	m.timeline.reading = true
+	return m, readTimeline()
+}
+
+// timelineEvents merges the audit log's events with this session's
+// notifications, oldest first, and keeps those passing the filters
+func (m Model) timelineEvents() []timelineEvent {
+	events := append([]timelineEvent{}, m.timeline.events...)
+	for _, t := range m.toasts.history {
+		events = append(events, timelineEvent{time: t.time, source: timelineSession, failed: t.level == toastError, text: t.text})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].time.Before(events[j].time) })
+
+	query := strings.ToLower(m.timeline.query)
+	var shown []timelineEvent
+	for _, event := range events {
+		if m.timeline.source != "" && event.source != m.timeline.source {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(event.text), query) {
+			continue
+		}
+		shown = append(shown, event)
+	}
+	return shown
+}
+
+// scrollBy moves back by n events, or forward for a negative n
+func (t *timeline) scrollBy(n int) {
+	t.scroll = max(t.scroll+n, 0)
+}
+
+// clampScroll keeps the scrolled position within the events shown
+func (m *Model) clampScroll() {
+	m.timeline.scroll = min(m.timeline.scroll, max(len(m.timelineEvents())-timelinePage, 0))
+}
+
+func (m Model) handleTimelineKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.timeline.searching {
+		switch msg.String() {
+		case "enter", "esc":
+			m.timeline.searching = false
+			m.timeline.search.Blur()
+			if msg.String() == "enter" {
+				m.timeline.query = strings.TrimSpace(m.timeline.search.Value())
+				m.timeline.scroll = 0
+			}
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.timeline.search, cmd = m.timeline.search.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "q", "esc":
+		if m.timeline.query != "" {
+			m.timeline.query = ""
+			return m, nil
+		}
+		m.currentView = "menu"
+	case "r":
+		return m.pollTimeline()
+	case "/":
+		m.timeline.searching = true
+		m.timeline.search = newTimelineSearch()
+		m.timeline.search.SetValue(m.timeline.query)
+		m.timeline.search.Focus()
+		return m, textinput.Blink
+	case "f":
+		for i, source := range timelineSources {
+			if source == m.timeline.source {
+				m.timeline.source = timelineSources[(i+1)%len(timelineSources)]
+				break
+			}
+		}
+		m.timeline.scroll = 0
+	case "up", "k":
+		m.timeline.scrollBy(1)
+	case "down", "j":
+		m.timeline.scrollBy(-1)
+	case "pgup":
+		m.timeline.scrollBy(timelinePage)
+	case "pgdown":
+		m.timeline.scrollBy(-timelinePage)
+	case "G", "end":
+		m.timeline.scroll = 0
+	}
+	m.clampScroll()
+	return m, nil
+}
+
+// newTimelineSearch returns the text input of the timeline search
+func newTimelineSearch() textinput.Model {
+	ti := textinput.New()
+	ti.Prompt = "/ "
+	ti.Placeholder = "text, e.g. started or 192.168.100.10"
+	ti.CharLimit = 60
+	ti.Width = 40
+	return ti
+}
+
+func (m Model) timelineView() string {
+	content := titleStyle.Render("Event Timeline") + "\n\n"
+
+	events := m.timelineEvents()
+	source, state := "all", "newest"
+	if m.timeline.source != "" {
+		source = m.timeline.source
+	}
+	if m.timeline.scroll > 0 {
+		state = fmt.Sprintf("%d events back", m.timeline.scroll)
+	}
+	header := fmt.Sprintf("Source: %s | %d events | %s", source, len(events), state)
+	if m.timeline.query != "" {
+		header += fmt.Sprintf(" | matching %q", m.timeline.query)
+	}
+	content += header + "\n"
+	if m.timeline.searching {
+		content += m.timeline.search.View() + "\n"
+	}
+	if m.timeline.err != nil {
+		content += errorStyle.Render("✗ "+m.timeline.err.Error()) + "\n"
+	}
+	content += "\n"
+
+	end := len(events) - m.timeline.scroll
+	if len(events) == 0 {
+		content += "No events yet\n"
+	}
+	for _, event := range events[max(end-timelinePage, 0):end] {
+		text := fmt.Sprintf("%s %-7s %s", event.time.Local().Format("Jan 02 15:04:05"), event.source, event.text)
+		if event.failed {
+			text = errorStyle.Render(text)
+		}
+		content += text + "\n"
+	}
+
+	content += "\n" + helpStyle.Render("'/' search, 'f' filter source, '↑/↓/pgup/pgdown' scroll, 'G' newest, 'r' refresh, 'esc' back")
+	return content
+}
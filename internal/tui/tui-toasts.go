@@ -0,0 +1,152 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Levels of notifications
+const (
+	toastInfo    = "info"
+	toastSuccess = "success"
+	toastError   = "error"
+)
+
+// Notification limits
+const (
+	toastLifetime      = 5 * time.Second  // how long a toast is shown
+	errorToastLifetime = 15 * time.Second // errors stay up longer
+	maxToasts          = 3                // toasts shown at once
+	maxToastHistory    = 200              // notifications kept for the history
+	historyLines       = 30               // newest notifications listed
+)
+
+// toast is a notification of an error or event
+type toast struct {
+	time  time.Time
+	level string
+	text  string
+}
+
+// notifications are the toasts on screen and the history of all of them
+type notifications struct {
+	shown   []toast         // oldest first, until they expire
+	history []toast         // oldest first
+	devices map[string]bool // devices seen, to notice those joining
+}
+
+// notify queues a toast and records it in the history
+func (n *notifications) notify(level, text string) {
+	t := toast{time: time.Now(), level: level, text: text}
+	n.shown = append(n.shown, t)
+	if excess := len(n.shown) - maxToasts; excess > 0 {
+		n.shown = n.shown[excess:]
+	}
+	n.history = append(n.history, t)
+	if excess := len(n.history) - maxToastHistory; excess > 0 {
+		n.history = n.history[excess:]
+	}
+}
+
+// expire takes down the toasts shown for their lifetime
+func (n *notifications) expire(now time.Time) {
+	var shown []toast
+	for _, t := range n.shown {
+		lifetime := toastLifetime
+		if t.level == toastError {
+			lifetime = errorToastLifetime
+		}
+		if now.Sub(t.time) < lifetime {
+			shown = append(shown, t)
+		}
+	}
+	n.shown = shown
+}
+
+// lastError returns the newest error on screen, if any
+func (n *notifications) lastError() error {
+	for i := len(n.shown) - 1; i >= 0; i-- {
+		if n.shown[i].level == toastError {
+			return fmt.Errorf("%s", n.shown[i].text)
+		}
+	}
+	return nil
+}
+
+// showError reports an error in a toast
+func (m *Model) showError(err error) {
+	m.toasts.notify(toastError, err.Error())
+}
+
+// showNotice reports the outcome of an action in a toast
+func (m *Model) showNotice(text string) {
+	m.toasts.notify(toastSuccess, text)
+}
+
+// noticeDevices reports devices that joined since the last listing. The
+// first listing only learns the devices already there.
+func (m *Model) noticeDevices(devices []nat.Device) {
+	first := m.toasts.devices == nil
+	if first {
+		m.toasts.devices = make(map[string]bool)
+	}
+	for _, device := range devices {
+		key := deviceKey(device)
+		if !m.toasts.devices[key] && !first {
+			m.toasts.notify(toastInfo, fmt.Sprintf("📱 %s joined (%s)", deviceName(m.config, device), device.IP))
+		}
+		m.toasts.devices[key] = true
+	}
+}
+
+// orNone shows an empty value as none
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// toastsView renders the toasts on screen, newest last
+func (m Model) toastsView() string {
+	var boxes []string
+	for _, t := range m.toasts.shown {
+		boxes = append(boxes, toastStyles[t.level].Render(t.text))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, boxes...)
+}
+
+func (m Model) handleNotificationsKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "q", "esc":
+		m.currentView = "menu"
+	case "c":
+		m.toasts.history, m.toasts.shown = nil, nil
+	}
+	return m, nil
+}
+
+func (m Model) notificationsView() string {
+	content := titleStyle.Render("Notifications") + "\n\n"
+	if len(m.toasts.history) == 0 {
+		content += "No notifications yet\n"
+	}
+	for i := len(m.toasts.history) - 1; i >= 0 && len(m.toasts.history)-i <= historyLines; i-- {
+		t := m.toasts.history[i]
+		line := fmt.Sprintf("%s %-7s %s", t.time.Local().Format("15:04:05"), t.level, t.text)
+		switch t.level {
+		case toastError:
+			line = errorStyle.Render(line)
+		case toastSuccess:
+			line = successStyle.Render(line)
+		}
+		content += line + "\n"
+	}
+	content += "\n" + helpStyle.Render("'c' clear, 'esc' back")
+	return content
+}
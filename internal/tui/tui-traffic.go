@@ -0,0 +1,226 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Throughput display of the monitor view
+const (
+	trafficSamples = 30 // rates kept per series, a minute at the refresh interval
+	sparkWidth     = 20
+	gaugeWidth     = 10
+	trafficDevices = 5 // busiest devices shown
+)
+
+// sparkLevels are the bars of a sparkline, lowest first
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// trafficMsg carries cumulative counters. In is traffic towards the
+// clients, so an interface's is what the clients download through it.
+type trafficMsg struct {
+	time       time.Time
+	interfaces map[string]nat.Traffic
+	devices    map[string]nat.Traffic
+}
+
+// rateSeries is the recent throughput of an interface or device in bytes
+// per second, oldest first
+type rateSeries struct {
+	down []float64
+	up   []float64
+}
+
+// current returns the latest rates
+func (s *rateSeries) current() (down, up float64) {
+	if len(s.down) == 0 {
+		return 0, 0
+	}
+	return s.down[len(s.down)-1], s.up[len(s.up)-1]
+}
+
+// trafficHistory turns successive counters into rate series
+type trafficHistory struct {
+	last       trafficMsg
+	interfaces map[string]*rateSeries
+	devices    map[string]*rateSeries
+}
+
+// getTraffic reads the counters of the NAT's interfaces and devices
+func getTraffic(manager *nat.Manager, external, internal string) tea.Cmd {
+	return func() tea.Msg {
+		msg := trafficMsg{time: time.Now(), interfaces: make(map[string]nat.Traffic), devices: manager.DeviceTraffic()}
+		if c, err := ifstats.Read(external); err == nil {
+			msg.interfaces[external] = nat.Traffic{BytesIn: c.BytesIn, BytesOut: c.BytesOut}
+		}
+		// The clients' downloads are output on the internal interface
+		if c, err := ifstats.Read(internal); err == nil {
+			msg.interfaces[internal] = nat.Traffic{BytesIn: c.BytesOut, BytesOut: c.BytesIn}
+		}
+		return msg
+	}
+}
+
+// getTraffic reads the counters of the configured interfaces
+func (m Model) getTraffic() tea.Cmd {
+	return getTraffic(m.manager, m.config.ExternalInterface, m.config.InternalInterface)
+}
+
+func (m Model) handleTraffic(msg trafficMsg) (tea.Model, tea.Cmd) {
+	m.traffic.add(msg)
+	return m, nil
+}
+
+// add appends the rates since the previous counters
+func (h *trafficHistory) add(msg trafficMsg) {
+	h.interfaces = updateSeries(h.interfaces, h.last.interfaces, msg.interfaces, msg.time.Sub(h.last.time))
+	h.devices = updateSeries(h.devices, h.last.devices, msg.devices, msg.time.Sub(h.last.time))
+	h.last = msg
+}
+
+// updateSeries appends the rates between two readings of counters, dropping
+// the series of whatever is gone
+func updateSeries(series map[string]*rateSeries, previous, current map[string]nat.Traffic, elapsed time.Duration) map[string]*rateSeries {
+	updated := make(map[string]*rateSeries, len(current))
+	for key, counters := range current {
+		s := &rateSeries{}
+		if old := series[key]; old != nil {
+			*s = *old
+		}
+		if last, ok := previous[key]; ok && elapsed > 0 {
+			delta := counters.Since(last)
+			s.down = appendRate(s.down, float64(delta.BytesIn)/elapsed.Seconds())
+			s.up = appendRate(s.up, float64(delta.BytesOut)/elapsed.Seconds())
+		}
+		updated[key] = s
+	}
+	return updated
+}
+
+// appendRate adds a rate to a series, keeping the most recent ones
+func appendRate(rates []float64, rate float64) []float64 {
+	rates = append(rates, rate)
+	if len(rates) > trafficSamples {
+		rates = rates[len(rates)-trafficSamples:]
+	}
+	return rates
+}
+
+// sparkline renders the last width rates scaled to their peak, padded on
+// the left while the series is short
+func sparkline(rates []float64, width int) string {
+	if len(rates) > width {
+		rates = rates[len(rates)-width:]
+	}
+	peak := 0.0
+	for _, rate := range rates {
+		peak = max(peak, rate)
+	}
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", width-len(rates)))
+	for _, rate := range rates {
+		level := 0
+		if peak > 0 {
+			level = int(rate / peak * float64(len(sparkLevels)-1))
+		}
+		b.WriteRune(sparkLevels[level])
+	}
+	return b.String()
+}
+
+// gauge renders value as a share of limit
+func gauge(value, limit float64, width int) string {
+	share := 0.0
+	if limit > 0 {
+		share = min(value/limit, 1)
+	}
+	filled := int(share*float64(width) + 0.5)
+	return fmt.Sprintf("%s%s %3.0f%%", strings.Repeat("█", filled), strings.Repeat("░", width-filled), share*100)
+}
+
+// linkCapacity returns a configured link rate in bytes per second, or 0
+func linkCapacity(rate string) float64 {
+	kbits, err := nat.ParseRate(rate)
+	if rate == "" || err != nil {
+		return 0
+	}
+	return float64(kbits) * 1000 / 8
+}
+
+// formatRate renders a rate in bytes per second as bits per second
+func formatRate(bytesPerSec float64) string {
+	return nat.FormatBitRate(bytesPerSec * 8)
+}
+
+// trafficView renders the throughput of the interfaces and the busiest
+// devices as sparklines, with gauges of the link's configured capacity and
+// of each device's share of the link's download
+func (m Model) trafficView() string {
+	if len(m.traffic.interfaces) == 0 && len(m.traffic.devices) == 0 {
+		return ""
+	}
+	content := fmt.Sprintf("📶 Throughput\n   %-15s %-*s %12s   %s\n", "", sparkWidth, "↓ download", "", "↑ upload")
+	row := func(name string, s *rateSeries) string {
+		down, up := s.current()
+		return fmt.Sprintf("   %-15s %s %12s   %s %12s", name, sparkline(s.down, sparkWidth), formatRate(down),
+			sparkline(s.up, sparkWidth), formatRate(up))
+	}
+
+	var linkDown, linkUp float64
+	for _, name := range []string{m.config.ExternalInterface, m.config.InternalInterface} {
+		if s, ok := m.traffic.interfaces[name]; ok {
+			content += row(name, s) + "\n"
+		}
+	}
+	if s, ok := m.traffic.interfaces[m.config.ExternalInterface]; ok {
+		linkDown, linkUp = s.current()
+		downlink, uplink := linkCapacity(m.config.Bandwidth.Downlink), linkCapacity(m.config.Bandwidth.Uplink)
+		if downlink > 0 && uplink > 0 {
+			content += fmt.Sprintf("   %-15s %s of %-9s %s of %s\n", "link usage", gauge(linkDown, downlink, gaugeWidth),
+				m.config.Bandwidth.Downlink, gauge(linkUp, uplink, gaugeWidth), m.config.Bandwidth.Uplink)
+		}
+	}
+
+	devices := m.busiestDevices()
+	if len(devices) > 0 {
+		content += "\n"
+	}
+	for _, ip := range devices {
+		s := m.traffic.devices[ip]
+		down, _ := s.current()
+		scale := linkDown
+		if scale == 0 {
+			scale, _ = m.traffic.devices[devices[0]].current()
+		}
+		content += row(ip, s) + "  " + gauge(down, scale, gaugeWidth) + "\n"
+	}
+	return content + "\n"
+}
+
+// busiestDevices returns the devices with the most current traffic
+func (m Model) busiestDevices() []string {
+	ips := make([]string, 0, len(m.traffic.devices))
+	for ip, s := range m.traffic.devices {
+		if len(s.down) > 0 {
+			ips = append(ips, ip)
+		}
+	}
+	total := func(ip string) float64 {
+		down, up := m.traffic.devices[ip].current()
+		return down + up
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		if total(ips[i]) != total(ips[j]) {
+			return total(ips[i]) > total(ips[j])
+		}
+		return ips[i] < ips[j]
+	})
+	return ips[:min(len(ips), trafficDevices)]
+}
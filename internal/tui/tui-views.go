@@ -1,40 +1,41 @@
 package tui
 
-import (
-	"fmt"
-	"strings"
-
-	"github.com/charmbracelet/lipgloss"
-	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
-)
-
-// Styles
-var (
-	titleStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("205")).
-			Bold(true).
-			Margin(1, 0)
-
-	helpStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("241")).
-			Margin(1, 0)
-
-	errorStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("196")).
-			Bold(true)
-
-	successStyle = lipgloss.NewStyle().
-			Foreground(lipgloss.Color("46")).
-			Bold(true)
-
-	statusStyle = lipgloss.NewStyle().
-			Padding(1, 2).
-			Border(lipgloss.RoundedBorder()).
-			BorderForeground(lipgloss.Color("62"))
-)
+import "fmt"
 
 // View renders the current view
 func (m Model) View() string {
+	content := m.screen()
+	if asciiOnly {
+		return asciiSymbols.Replace(content)
+	}
+	return content
+}
+
+// screen renders the palette, the help or the current view with its dialog,
+// the progress of starting or stopping NAT and toasts
+func (m Model) screen() string {
+	if m.palette.open {
+		return m.paletteView()
+	}
+	if m.showHelp {
+		return m.helpView()
+	}
+
+	content := m.currentViewContent()
+	if m.dialog != nil {
+		content += "\n\n" + m.dialogView()
+	}
+	if m.progress.action != "" {
+		content += "\n\n" + m.progressView()
+	}
+	if len(m.toasts.shown) > 0 {
+		content += "\n\n" + m.toastsView()
+	}
+	return content
+}
+
+// currentViewContent renders the current view without transient notices
+func (m Model) currentViewContent() string {
 	switch m.currentView {
 	case "menu":
 		return m.menuView()
@@ -44,8 +45,28 @@ func (m Model) View() string {
 		return m.configView()
 	case "monitor":
 		return m.monitorView()
+	case "devices":
+		return m.devicesView()
+	case "device":
+		return m.deviceView()
+	case "forwards":
+		return m.forwardsView()
+	case "forward_edit":
+		return m.forwardEditView()
+	case "logs":
+		return m.logsView()
 	case "input":
 		return m.inputView()
+	case "wizard":
+		return m.wizardView()
+	case "profiles":
+		return m.profilesView()
+	case "rules":
+		return m.rulesView()
+	case "notifications":
+		return m.notificationsView()
+	case "timeline":
+		return m.timelineView()
 	default:
 		return m.menuView()
 	}
@@ -58,9 +79,13 @@ func (m Model) menuView() string {
 	} else {
 		status = errorStyle.Render("🔴 NAT Inactive")
 	}
+	if m.app.readOnly {
+		status += "\n" + warnStyle.Render("🔒 Read-only: run with sudo to make changes")
+	}
 
 	content := titleStyle.Render("macOS NAT Manager") + "\n\n"
 	content += statusStyle.Render(status) + "\n\n"
+	content += m.wanView()
 
 	if m.config.ExternalInterface != "" && m.config.InternalInterface != "" {
 		content += fmt.Sprintf("External: %s → Internal: %s\n", m.config.ExternalInterface, m.config.InternalInterface)
@@ -69,17 +94,20 @@ func (m Model) menuView() string {
 		content += "⚠️  Please configure interfaces before starting NAT\n\n"
 	}
 
-	content += "1. Configure Interfaces\n"
-	content += "2. Configure NAT Settings\n"
-	content += "3. Start NAT\n"
-	content += "4. Monitor Connections\n"
-	content += "5. Stop NAT\n\n"
-
-	if m.err != nil {
-		content += errorStyle.Render(fmt.Sprintf("Error: %s", m.err)) + "\n\n"
-	}
-
-	content += helpStyle.Render("Press number to select, 'q' to quit")
+	content += m.menuItem("1. Configure Interfaces", false)
+	content += m.menuItem("2. Configure NAT Settings", false)
+	content += m.menuItem("3. Start NAT", true)
+	content += m.menuItem("4. Monitor Connections", false)
+	content += m.menuItem("5. Stop NAT", true)
+	content += m.menuItem("6. Connected Devices", false)
+	content += m.menuItem("7. Port Forwards", false)
+	content += m.menuItem("8. Logs", false)
+	content += m.menuItem("9. Setup Wizard", true)
+	content += m.menuItem("p. Profiles", false)
+	content += m.menuItem("f. Firewall Rules", false)
+	content += m.menuItem("t. Event Timeline", false) + "\n"
+
+	content += helpStyle.Render("Press number to select, '?' all keys, 'ctrl+k' command palette, 'ctrl+s' export view, 'ctrl+n' notifications, 'q' to quit")
 	return content
 }
 
@@ -90,6 +118,12 @@ func (m Model) interfacesView() string {
 		content += fmt.Sprintf("Current selection - External: %s | Internal: %s\n\n",
 			m.config.ExternalInterface, m.config.InternalInterface)
 	}
+	if warnings := interfaceWarnings(m.config, m.interfaces); len(warnings) > 0 {
+		for _, warning := range warnings {
+			content += warnStyle.Render("⚠️  "+warning) + "\n"
+		}
+		content += "\n"
+	}
 
 	content += m.list.View() + "\n\n"
 
@@ -102,45 +136,26 @@ func (m Model) interfacesView() string {
 	return content
 }
 
-func (m Model) configView() string {
-	content := titleStyle.Render("NAT Configuration") + "\n\n"
-
-	// Interface configuration
-	content += "🔌 Interfaces:\n"
-	content += fmt.Sprintf("   External: %s\n", getConfigValue(m.config.ExternalInterface, "Not set"))
-	content += fmt.Sprintf("   Internal: %s\n\n", getConfigValue(m.config.InternalInterface, "Not set"))
-
-	// Network configuration
-	content += "🌐 Network Settings:\n"
-	content += fmt.Sprintf("1. Internal Network: %s.0/24\n", m.config.InternalNetwork)
-	content += fmt.Sprintf("2. DHCP Start: %s\n", m.config.DHCPRange.Start)
-	content += fmt.Sprintf("3. DHCP End: %s\n", m.config.DHCPRange.End)
-	content += fmt.Sprintf("   DHCP Lease: %s\n", m.config.DHCPRange.Lease)
-	content += fmt.Sprintf("   DNS Servers: %s\n\n", strings.Join(m.config.DNSServers, ", "))
-
-	// Status
-	if m.config.ExternalInterface != "" && m.config.InternalInterface != "" {
-		content += successStyle.Render("✅ Configuration ready") + "\n\n"
-	} else {
-		content += errorStyle.Render("❌ Missing interface configuration") + "\n\n"
-	}
-
-	content += helpStyle.Render("Press number to edit, 'esc' to go back")
-	return content
-}
-
 func (m Model) monitorView() string {
-	content := titleStyle.Render("Connection Monitor") + "\n\n"
+	if m.conns.detail != nil {
+		return m.connectionDetailView()
+	}
+	title := "Connection Monitor"
+	if m.replaying() {
+		title += " (replay of " + m.replay.session.Header.Started.Format("2006-01-02 15:04") + ")"
+	}
+	content := titleStyle.Render(title) + "\n\n"
 
 	// Show current configuration
 	content += fmt.Sprintf("🔗 %s (%s) → %s (%s.1/24)\n\n",
 		m.config.ExternalInterface,
-		getExternalIP(m.manager),
+		getExternalIP(m),
 		m.config.InternalInterface,
 		m.config.InternalNetwork)
 
-	// Connection count
-	content += fmt.Sprintf("📊 Active connections: %d\n\n", len(m.connections))
+	content += m.trafficView()
+
+	content += m.connectionsHeader()
 
 	// Connections table
 	if len(m.connections) > 0 {
@@ -150,12 +165,24 @@ func (m Model) monitorView() string {
 	}
 
 	// Statistics
-	if status, err := m.manager.GetStatus(); err == nil {
+	if status, err := m.monitorStatus(); err == nil {
 		content += fmt.Sprintf("📈 Uptime: %s\n", status.Uptime)
-		content += fmt.Sprintf("📱 Connected devices: %d\n\n", len(status.ConnectedDevices))
+		content += fmt.Sprintf("📱 Connected devices: %d\n", len(status.ConnectedDevices))
+		for _, device := range status.ConnectedDevices {
+			deviceType := device.Type
+			if deviceType == "" {
+				deviceType = "unknown type"
+			}
+			content += fmt.Sprintf("   %-15s %-20s %s\n", device.IP, device.Hostname, deviceType)
+		}
+		content += "\n"
 	}
 
-	content += helpStyle.Render("'r' refresh, 'esc' back")
+	if m.replaying() {
+		content += helpStyle.Render("'p' pause, '←'/'→' step, 'r' restart, '/' search, 'b'/'a'/'d' sort, 'enter' details, 'y' copy, 'esc' quit")
+		return content
+	}
+	content += helpStyle.Render("'/' search, 'b'/'a'/'d' sort by bytes/age/destination, 'enter' details, 'D' device, 'p' pause, 'y' copy, 'r' refresh, 'esc' back")
 	return content
 }
 
@@ -166,15 +193,14 @@ func (m Model) inputView() string {
 	fieldDescription := ""
 
 	switch m.inputField {
-	case "network":
-		fieldName = "Internal Network"
-		fieldDescription = "Network prefix for internal devices (e.g., 192.168.100)"
-	case "dhcp_start":
-		fieldName = "DHCP Range Start"
-		fieldDescription = "First IP address in DHCP range (e.g., 192.168.100.100)"
-	case "dhcp_end":
-		fieldName = "DHCP Range End"
-		fieldDescription = "Last IP address in DHCP range (e.g., 192.168.100.200)"
+	case "nickname":
+		fieldName = "Device Nickname"
+		fieldDescription = "Name shown for " + m.inputDevice + " (empty to remove)"
+	case "profile":
+		fieldName = "New Profile"
+		if entry, ok := m.selectedProfile(); ok {
+			fieldDescription = "Name of the profile created from " + entry.name
+		}
 	}
 
 	content += fmt.Sprintf("Field: %s\n", fieldName)
@@ -184,6 +210,25 @@ func (m Model) inputView() string {
 	return content
 }
 
+func (m Model) paletteView() string {
+	content := titleStyle.Render("Command Palette") + "\n\n"
+	content += m.palette.input.View() + "\n\n"
+
+	if len(m.palette.matches) == 0 {
+		content += "No matching commands\n"
+	}
+	for i, action := range m.palette.matches {
+		line := fmt.Sprintf("  %-26s %s", action.title, action.description)
+		if i == m.palette.cursor {
+			line = successStyle.Render(fmt.Sprintf("▸ %-26s %s", action.title, action.description))
+		}
+		content += line + "\n"
+	}
+
+	content += "\n" + helpStyle.Render("↑/↓ select, Enter run, Esc close")
+	return content
+}
+
 // Helper functions
 func getConfigValue(value, defaultText string) string {
 	if value == "" {
@@ -192,8 +237,8 @@ func getConfigValue(value, defaultText string) string {
 	return successStyle.Render(value)
 }
 
-func getExternalIP(manager *nat.Manager) string {
-	if status, err := manager.GetStatus(); err == nil {
+func getExternalIP(m Model) string {
+	if status, err := m.monitorStatus(); err == nil {
 		return status.ExternalIP
 	}
 	return "N/A"
@@ -0,0 +1,97 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// wanStatus is the health of the uplink shown on the main menu
+type wanStatus struct {
+	health   *nat.WANHealth // last check, nil until the first
+	changed  time.Time      // when the address last changed, zero if not seen
+	checking bool           // a check is under way
+}
+
+// wanMsg carries the uplink's address, default route and gateway
+type wanMsg nat.WANHealth
+
+// getWAN checks the uplink and its gateway
+func getWAN(manager *nat.Manager) tea.Cmd {
+	return func() tea.Msg {
+		return wanMsg(manager.WANHealth(context.Background()))
+	}
+}
+
+// checkWAN starts a check of the uplink unless one is under way
+func (m *Model) checkWAN() tea.Cmd {
+	if m.wan.checking || m.config.ExternalInterface == "" {
+		return nil
+	}
+	m.wan.checking = true
+	return getWAN(m.manager)
+}
+
+// handleWAN records the uplink's health and reports changes of its address
+// or default route
+func (m Model) handleWAN(msg wanMsg) (tea.Model, tea.Cmd) {
+	current := nat.WANHealth(msg)
+	previous := m.wan.health
+	m.wan.health = &current
+	m.wan.checking = false
+	if previous == nil {
+		return m, nil
+	}
+	if current.ExternalIP != previous.ExternalIP {
+		m.wan.changed = current.Checked
+		m.toasts.notify(toastInfo, fmt.Sprintf("🌍 WAN address of %s changed from %s to %s", m.config.ExternalInterface,
+			orNone(previous.ExternalIP), orNone(current.ExternalIP)))
+	}
+	if current.DefaultRoute != previous.DefaultRoute {
+		m.toasts.notify(toastInfo, fmt.Sprintf("🌍 Default route moved from %s to %s",
+			orNone(previous.DefaultRoute), orNone(current.DefaultRoute)))
+	}
+	return m, nil
+}
+
+// wanView renders the uplink's health for the main menu
+func (m Model) wanView() string {
+	health := m.wan.health
+	if m.config.ExternalInterface == "" {
+		return ""
+	}
+	content := fmt.Sprintf("🌍 WAN %s\n", m.config.ExternalInterface)
+	if health == nil {
+		return content + "   Checking...\n\n"
+	}
+
+	address := orNone(health.ExternalIP)
+	if health.ExternalIP == "" {
+		address = errorStyle.Render("no address")
+	}
+	if !m.wan.changed.IsZero() {
+		address += fmt.Sprintf(" (changed %s, %s ago)", m.wan.changed.Local().Format("15:04"),
+			time.Since(m.wan.changed).Round(time.Second))
+	}
+	content += fmt.Sprintf("   Address:  %s\n", address)
+
+	gateway := errorStyle.Render("no default route")
+	switch {
+	case health.Gateway != "" && health.Reachable && health.Latency > 0:
+		gateway = fmt.Sprintf("%s %s, %s", health.Gateway, successStyle.Render("reachable"), health.Latency.Round(10*time.Microsecond))
+	case health.Gateway != "" && health.Reachable:
+		gateway = fmt.Sprintf("%s %s", health.Gateway, successStyle.Render("reachable"))
+	case health.Gateway != "":
+		gateway = fmt.Sprintf("%s %s", health.Gateway, errorStyle.Render("unreachable"))
+	}
+	content += fmt.Sprintf("   Gateway:  %s\n", gateway)
+
+	if health.DefaultRoute != "" && health.DefaultRoute != m.config.ExternalInterface {
+		content += warnStyle.Render(fmt.Sprintf("   ⚠️  The default route is on %s, not %s", health.DefaultRoute, m.config.ExternalInterface)) + "\n"
+	}
+	return content + "\n"
+}
@@ -0,0 +1,337 @@
+package tui
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+)
+
+// Steps of the setup wizard, in order
+const (
+	stepExternal = iota
+	stepInternal
+	stepNetwork
+	stepChecks
+	stepProfile
+	wizardSteps
+)
+
+// defaultProfile is the name proposed for the wizard's profile
+const defaultProfile = "home"
+
+// brewFormulas are the Homebrew packages of the server binaries
+var brewFormulas = map[string]string{"dnsmasq": "dnsmasq", "kea-dhcp4": "kea", "coredns": "coredns"}
+
+// setupWizard guides through a first configuration, saved as a profile
+type setupWizard struct {
+	step    int
+	draft   *config.Config
+	choice  int // selected interface
+	input   textinput.Model
+	message string   // why the value entered is invalid
+	missing []string // DHCP and DNS servers not installed
+}
+
+// firstRun reports whether neither a configuration nor a profile has been
+// saved yet
+func firstRun() bool {
+	if config.Profile() != "" || configSaved() {
+		return false
+	}
+	profiles, err := config.ListProfiles()
+	return err == nil && len(profiles) == 0
+}
+
+// startWizard opens the setup wizard with a draft of the current settings
+func (m Model) startWizard() (tea.Model, tea.Cmd) {
+	if m.refuseReadOnly("The setup wizard") {
+		return m, nil
+	}
+	if m.manager.IsActive() {
+		m.showError(fmt.Errorf("stop NAT before running the setup wizard"))
+		return m, nil
+	}
+	draft := *m.config
+	m.wizard = setupWizard{draft: &draft, input: newConfigInput()}
+	m.currentView = "wizard"
+	m = m.enterWizardStep(stepExternal)
+	return m, getInterfaces(m.manager)
+}
+
+// enterWizardStep moves to a step and prepares its proposal
+func (m Model) enterWizardStep(step int) Model {
+	w := &m.wizard
+	w.step, w.message = step, ""
+	w.input.Blur()
+	switch step {
+	case stepExternal, stepInternal:
+		w.preselect(m.interfaces)
+	case stepNetwork:
+		network := nat.SuggestNetwork(usedNetworks())
+		if network == "" {
+			network = w.draft.InternalNetwork
+		}
+		w.input.SetValue(network)
+	case stepChecks:
+		w.missing = missingServers(w.draft)
+	case stepProfile:
+		w.input.SetValue(defaultProfile)
+	}
+	if w.typing() {
+		w.input.CursorEnd()
+		w.input.Focus()
+	}
+	return m
+}
+
+// typing reports whether the current step takes a typed value
+func (w *setupWizard) typing() bool {
+	return w.step == stepNetwork || w.step == stepProfile
+}
+
+// preselect points an interface step at its proposal: the interface holding
+// the default route, or the configured internal interface
+func (w *setupWizard) preselect(interfaces []nat.NetworkInterface) {
+	w.choice = 0
+	for i, iface := range interfaces {
+		if w.step == stepExternal && iface.DefaultRoute || w.step == stepInternal && iface.Name == w.draft.InternalInterface {
+			w.choice = i
+		}
+	}
+}
+
+// usedNetworks returns the networks the internal network must not overlap:
+// the host's and those of the existing profiles
+func usedNetworks() []*net.IPNet {
+	used := nat.HostNetworks()
+	profiles, _ := config.ListProfiles()
+	for _, name := range profiles {
+		cfg, err := config.LoadProfile(name)
+		if err != nil {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(cfg.GetInternalCIDR()); err == nil {
+			used = append(used, network)
+		}
+	}
+	return used
+}
+
+// missingServers returns the DHCP and DNS server binaries not in PATH
+func missingServers(cfg *config.Config) []string {
+	var missing []string
+	for _, binary := range nat.NewManager(cfg.ToNATConfig()).ServerBinaries() {
+		if _, err := exec.LookPath(binary); err != nil {
+			missing = append(missing, binary)
+		}
+	}
+	return missing
+}
+
+func (m Model) handleWizardKeys(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	w := &m.wizard
+	switch msg.String() {
+	case "esc":
+		if w.step == stepExternal {
+			m.currentView = "menu"
+			return m, nil
+		}
+		return m.enterWizardStep(w.step - 1), nil
+	case "enter":
+		return m.completeWizardStep()
+	}
+
+	if w.typing() {
+		var cmd tea.Cmd
+		w.input, cmd = w.input.Update(msg)
+		w.message = ""
+		if err := m.checkWizardValue(strings.TrimSpace(w.input.Value())); err != nil {
+			w.message = err.Error()
+		}
+		return m, cmd
+	}
+	switch msg.String() {
+	case "up", "k":
+		w.choice = max(w.choice-1, 0)
+	case "down", "j":
+		w.choice = min(w.choice+1, len(m.interfaces)-1)
+	case "r":
+		if w.step == stepChecks {
+			w.missing = missingServers(w.draft)
+			return m, nil
+		}
+		return m, getInterfaces(m.manager)
+	}
+	return m, nil
+}
+
+// checkWizardValue validates a typed value against a copy of the draft
+func (m Model) checkWizardValue(value string) error {
+	switch m.wizard.step {
+	case stepNetwork:
+		check := *m.wizard.draft
+		return changeNetwork(&check, value)
+	case stepProfile:
+		if err := config.ValidateProfileName(value); err != nil {
+			return err
+		}
+		if config.ProfileExists(value) {
+			return fmt.Errorf("profile %q already exists", value)
+		}
+	}
+	return nil
+}
+
+// completeWizardStep takes the value of the current step and moves on,
+// creating the profile after the last step
+func (m Model) completeWizardStep() (tea.Model, tea.Cmd) {
+	w := &m.wizard
+	value := strings.TrimSpace(w.input.Value())
+	if err := m.checkWizardValue(value); err != nil {
+		w.message = err.Error()
+		return m, nil
+	}
+
+	switch w.step {
+	case stepExternal, stepInternal:
+		if len(m.interfaces) == 0 {
+			w.message = "no interfaces found, press 'r' to rescan"
+			return m, nil
+		}
+		name := m.interfaces[w.choice].Name
+		if w.step == stepExternal {
+			w.draft.ExternalInterface = name
+		} else if name == w.draft.ExternalInterface {
+			w.message = fmt.Sprintf("%s is already the external interface", name)
+			return m, nil
+		} else {
+			w.draft.InternalInterface = name
+		}
+	case stepNetwork:
+		_ = changeNetwork(w.draft, value)
+	case stepProfile:
+		return m.finishWizard(value)
+	}
+	return m.enterWizardStep(w.step + 1), nil
+}
+
+// finishWizard saves the draft as a new profile and switches to it. A
+// first configuration also becomes the instance's own, which commands use
+// without --profile.
+func (m Model) finishWizard(name string) (tea.Model, tea.Cmd) {
+	if err := config.CreateProfile(name, m.wizard.draft); err != nil {
+		m.wizard.message = err.Error()
+		return m, nil
+	}
+	if config.Profile() == "" && !configSaved() {
+		if err := m.wizard.draft.Save(); err != nil {
+			m.showError(fmt.Errorf("failed to save config: %w", err))
+		}
+	}
+	if err := setProfile(&m, name); err != nil {
+		m.showError(err)
+		return m, nil
+	}
+	m.wizard.input.Blur()
+	m.useConfig()
+	m.currentView = "menu"
+	m.showNotice(fmt.Sprintf("✅ Created profile %s, press 3 to start NAT", name))
+	return m, nil
+}
+
+// configSaved reports whether the selected configuration file exists
+func configSaved() bool {
+	path, err := config.GetConfigPath()
+	if err != nil {
+		return true
+	}
+	_, err = os.Stat(path)
+	return !os.IsNotExist(err)
+}
+
+func (m Model) wizardView() string {
+	w := m.wizard
+	content := titleStyle.Render("Setup Wizard") + "\n\n"
+	content += fmt.Sprintf("Step %d of %d\n\n", w.step+1, wizardSteps)
+
+	switch w.step {
+	case stepExternal:
+		content += "🌍 Which interface connects this Mac to the internet?\n\n"
+		content += m.wizardInterfaces()
+	case stepInternal:
+		content += "🔌 Which interface do the NAT clients connect to?\n\n"
+		content += m.wizardInterfaces()
+	case stepNetwork:
+		content += "🌐 Internal network for the clients, proposed so that it overlaps none\n"
+		content += "   of this Mac's networks or of the existing profiles:\n\n"
+		content += "   " + w.input.View() + "\n"
+		if check := *w.draft; changeNetwork(&check, strings.TrimSpace(w.input.Value())) == nil {
+			content += fmt.Sprintf("   subnet %s, gateway %s, DHCP %s - %s\n", check.GetInternalCIDR(), check.GetGatewayIP(),
+				check.DHCPRange.Start, check.DHCPRange.End)
+		}
+	case stepChecks:
+		content += m.wizardChecks()
+	case stepProfile:
+		content += "📁 Save the configuration as profile:\n\n"
+		content += "   " + w.input.View() + "\n"
+	}
+	if w.message != "" {
+		content += "\n" + errorStyle.Render("✗ "+w.message) + "\n"
+	}
+
+	help := "'↑/↓' choose, 'enter' next, 'r' rescan, 'esc' back"
+	switch {
+	case w.typing():
+		help = "'enter' next, 'esc' back"
+	case w.step == stepChecks:
+		help = "'enter' next, 'r' check again, 'esc' back"
+	}
+	content += "\n" + helpStyle.Render(help)
+	return content
+}
+
+// wizardInterfaces lists the interfaces to choose from
+func (m Model) wizardInterfaces() string {
+	if len(m.interfaces) == 0 {
+		return "   Looking for interfaces...\n"
+	}
+	content := ""
+	for i, iface := range m.interfaces {
+		line := fmt.Sprintf("%-12s %-10s %-15s", iface.Name, iface.Status, iface.IP)
+		if iface.DefaultRoute {
+			line += " default route"
+		}
+		if i == m.wizard.choice {
+			content += successStyle.Render("▸ "+line) + "\n"
+		} else {
+			content += "  " + line + "\n"
+		}
+	}
+	return content
+}
+
+// wizardChecks reports whether the DHCP and DNS servers are installed
+func (m Model) wizardChecks() string {
+	content := "🩺 DHCP and DNS servers:\n\n"
+	servers := nat.NewManager(m.wizard.draft.ToNATConfig()).ServerBinaries()
+	for _, binary := range servers {
+		if slices.Contains(m.wizard.missing, binary) {
+			content += errorStyle.Render(fmt.Sprintf("   ❌ %s not found, install it with 'brew install %s'", binary, brewFormulas[binary])) + "\n"
+		} else {
+			content += successStyle.Render("   ✅ "+binary) + "\n"
+		}
+	}
+	if len(m.wizard.missing) > 0 {
+		content += "\n   NAT cannot start until the missing servers are installed.\n"
+	}
+	return content
+}
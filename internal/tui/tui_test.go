@@ -1,12 +1,22 @@
 package tui
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
 	"github.com/scttfrdmn/macos-nat-manager/internal/config"
+	"github.com/scttfrdmn/macos-nat-manager/internal/fake"
+	"github.com/scttfrdmn/macos-nat-manager/internal/ifstats"
 	"github.com/scttfrdmn/macos-nat-manager/internal/nat"
+	"github.com/scttfrdmn/macos-nat-manager/internal/session"
 )
 
 func TestNewApp(t *testing.T) {
@@ -164,7 +174,7 @@ func TestModelHandleNATResult(t *testing.T) {
 	newModelInterface, cmd := model.handleNATResult(successMsg)
 	newModel := newModelInterface.(Model)
 
-	if newModel.err != nil {
+	if newModel.toasts.lastError() != nil {
 		t.Error("Error should be nil for successful result")
 	}
 	if cmd != nil {
@@ -184,6 +194,101 @@ func TestModelHandleTick(t *testing.T) {
 	}
 }
 
+func TestRefreshAndPause(t *testing.T) {
+	cfg := config.Default()
+	cfg.TUI.Refresh = config.RefreshConfig{Views: map[string]string{"monitor": "1s"}}
+	model := NewApp(cfg).initialModel()
+
+	// The first tick refreshes, the next ones wait for the interval
+	next, _ := model.handleTick()
+	model = next.(Model)
+	refreshed := model.refreshed
+	if refreshed.IsZero() {
+		t.Fatal("Expected the first tick to refresh")
+	}
+	if next, _ = model.handleTick(); !next.(Model).refreshed.Equal(refreshed) {
+		t.Error("Expected no refresh before the interval passed")
+	}
+
+	// A paused monitor keeps its connections
+	model.currentView = "monitor"
+	model.connections = []nat.Connection{{Source: "192.168.100.10:5000", Destination: "1.1.1.1:443", Protocol: "tcp"}}
+	model = pressKeys(model, keyRunes("p"))
+	if !model.conns.paused || !strings.Contains(model.View(), "paused") {
+		t.Fatalf("Expected 'p' to pause the monitor:\n%s", model.View())
+	}
+	next, _ = model.Update(connectionsMsg{connections: []nat.Connection{}})
+	if model = next.(Model); len(model.connections) != 1 {
+		t.Error("Expected a paused monitor to drop refreshes")
+	}
+	if model = pressKeys(model, keyRunes("p")); model.conns.paused {
+		t.Error("Expected 'p' to resume the monitor")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2026, 10, 16, 2, 0, 0, 0, time.UTC)
+	frame := func(offset time.Duration, destinations ...string) session.Frame {
+		status := &nat.Status{ExternalIP: "203.0.113.7"}
+		for _, destination := range destinations {
+			status.ActiveConnections = append(status.ActiveConnections,
+				nat.Connection{Source: "192.168.100.10:5000", Destination: destination, Protocol: "tcp"})
+		}
+		status.Interfaces = []ifstats.Counters{{Interface: "en0", BytesIn: uint64(offset.Seconds()) * 1000}}
+		return session.Frame{Time: start.Add(offset), Status: status}
+	}
+	recording := &session.Session{
+		Header: session.Header{Started: start, ExternalInterface: "en0", InternalInterface: "bridge100", InternalNetwork: "192.168.100"},
+		Frames: []session.Frame{frame(0, "1.1.1.1:443"), frame(time.Minute, "1.1.1.1:443", "8.8.8.8:53"), frame(2 * time.Minute)},
+	}
+
+	app := NewApp(&config.Config{ExternalInterface: "en1"})
+	app.SetReplay(recording, 60)
+	model := app.initialModel().startReplay(*app.replay)
+	if model.currentView != "monitor" || len(model.connections) != 1 || model.config.ExternalInterface != "en0" {
+		t.Fatalf("Expected the monitor on the first frame, got view %s with %+v", model.currentView, model.connections)
+	}
+	if app.config.ExternalInterface != "en1" {
+		t.Error("Replaying should not change the configuration")
+	}
+	if view := model.View(); !strings.Contains(view, "frame 1/3") || !strings.Contains(view, "203.0.113.7") {
+		t.Errorf("Expected the frame position and recorded address:\n%s", view)
+	}
+	if model.nextFrame() == nil {
+		t.Error("Expected the next frame to be scheduled")
+	}
+
+	next, _ := model.Update(replayMsg{seq: model.replay.seq})
+	if model = next.(Model); model.replay.frame != 1 || len(model.connections) != 2 {
+		t.Errorf("Expected the second frame, got frame %d with %+v", model.replay.frame, model.connections)
+	}
+	if down, _ := model.traffic.interfaces["en0"].current(); down != 1000 {
+		t.Errorf("Expected the rate between the frames, got %v", down)
+	}
+
+	// Pausing drops the scheduled frame, stepping moves by hand
+	model = pressKeys(model, keyRunes("p"))
+	next, _ = model.Update(replayMsg{seq: model.replay.seq - 1})
+	if model = next.(Model); !model.replay.paused || model.replay.frame != 1 || !strings.Contains(model.View(), "paused") {
+		t.Errorf("Expected the paused replay to stay on frame 2, got frame %d", model.replay.frame+1)
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyRight}, tea.KeyMsg{Type: tea.KeyRight})
+	if model.replay.frame != 2 || len(model.connections) != 0 {
+		t.Errorf("Expected to step to the last frame, got frame %d", model.replay.frame+1)
+	}
+	if model = pressKeys(model, tea.KeyMsg{Type: tea.KeyLeft}); model.replay.frame != 1 {
+		t.Errorf("Expected to step back to frame 2, got frame %d", model.replay.frame+1)
+	}
+	if model = pressKeys(model, keyRunes("r")); model.replay.frame != 0 || model.replay.paused {
+		t.Errorf("Expected 'r' to restart the replay, got frame %d", model.replay.frame+1)
+	}
+
+	// Ticks never read the live NAT while replaying
+	if _, cmd := model.handleTick(); cmd == nil {
+		t.Error("handleTick should return a tick command")
+	}
+}
+
 func TestInterfaceItem(t *testing.T) {
 	iface := nat.NetworkInterface{
 		Name:   "en0",
@@ -192,7 +297,7 @@ func TestInterfaceItem(t *testing.T) {
 		IP:     "192.168.1.100",
 	}
 
-	item := interfaceItem{iface}
+	item := interfaceItem{iface: iface}
 
 	title := item.Title()
 	if title != "en0" {
@@ -293,3 +398,1138 @@ func findSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestFuzzyScore(t *testing.T) {
+	testCases := []struct {
+		query   string
+		target  string
+		matches bool
+	}{
+		{"", "Start NAT", true},
+		{"start", "Start NAT", true},
+		{"snat", "Start NAT", true},
+		{"go mon", "Go to Connection Monitor", true},
+		{"xyz", "Start NAT", false},
+		{"tats", "Start NAT", false},
+	}
+
+	for _, tc := range testCases {
+		if _, ok := fuzzyScore(tc.query, tc.target); ok != tc.matches {
+			t.Errorf("fuzzyScore(%q, %q) matched = %t, expected %t", tc.query, tc.target, ok, tc.matches)
+		}
+	}
+
+	prefix, _ := fuzzyScore("st", "Stop NAT")
+	scattered, _ := fuzzyScore("st", "Go to Interfaces")
+	if prefix <= scattered {
+		t.Errorf("Word-start match should score higher: %d <= %d", prefix, scattered)
+	}
+}
+
+func TestCommandPalette(t *testing.T) {
+	cfg := &config.Config{ExternalInterface: "en0"}
+	app := NewApp(cfg)
+	model := app.initialModel()
+
+	// Ctrl+K opens the palette with every action listed
+	newModelInterface, _ := model.handleKeyMsg(tea.KeyMsg{Type: tea.KeyCtrlK})
+	model = newModelInterface.(Model)
+	if !model.palette.open {
+		t.Fatal("Ctrl+K should open the command palette")
+	}
+	if len(model.palette.matches) != len(paletteActions()) {
+		t.Errorf("Expected all %d actions, got %d", len(paletteActions()), len(model.palette.matches))
+	}
+
+	// Typing filters the actions
+	for _, r := range "config" {
+		newModelInterface, _ = model.handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		model = newModelInterface.(Model)
+	}
+	if len(model.palette.matches) == 0 || model.palette.matches[0].title != "Go to Configuration" {
+		t.Fatalf("Expected 'Go to Configuration' as best match, got %+v", model.palette.matches)
+	}
+
+	// Enter runs the selected action and closes the palette
+	newModelInterface, _ = model.handleKeyMsg(tea.KeyMsg{Type: tea.KeyEnter})
+	model = newModelInterface.(Model)
+	if model.palette.open {
+		t.Error("Palette should close after running an action")
+	}
+	if model.currentView != "config" {
+		t.Errorf("Expected view 'config', got '%s'", model.currentView)
+	}
+
+	// Ctrl+K keeps its text editing meaning in input fields
+	model.currentView = "input"
+	newModelInterface, _ = model.handleKeyMsg(tea.KeyMsg{Type: tea.KeyCtrlK})
+	model = newModelInterface.(Model)
+	if model.palette.open {
+		t.Error("Ctrl+K should not open the palette while editing a field")
+	}
+}
+
+func TestRenderExport(t *testing.T) {
+	at := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	content := "\x1b[1mNAT Configuration\x1b[0m\n  External: <en0>\n"
+
+	text := renderExport("config", content, exportText, at)
+	if strings.Contains(text, "\x1b") || !strings.Contains(text, "External: <en0>") {
+		t.Errorf("Text export should be plain text, got %q", text)
+	}
+
+	page := renderExport("config", content, exportHTML, at)
+	if !strings.Contains(page, "<pre>") || !strings.Contains(page, "External: &lt;en0&gt;") {
+		t.Errorf("HTML export should escape the view inside <pre>, got %q", page)
+	}
+
+	if name := exportFileName("monitor", exportHTML, at); name != "nat-manager-monitor-20261016-093000.html" {
+		t.Errorf("Unexpected export file name %q", name)
+	}
+}
+
+func TestExportCurrentView(t *testing.T) {
+	app := NewApp(config.Default())
+	app.exportDir = t.TempDir()
+	var copied string
+	app.clipboard = func(text string) error {
+		copied = text
+		return nil
+	}
+	model := app.initialModel()
+	model.currentView = "config"
+
+	newModelInterface, cmd := model.handleKeyMsg(tea.KeyMsg{Type: tea.KeyCtrlS})
+	if cmd == nil {
+		t.Fatal("Ctrl+S should export the current view")
+	}
+	msg, ok := cmd().(exportMsg)
+	if !ok || msg.err != nil {
+		t.Fatalf("Expected a successful export, got %+v", msg)
+	}
+
+	data, err := os.ReadFile(msg.path)
+	if err != nil {
+		t.Fatalf("Export file not written: %v", err)
+	}
+	if !strings.Contains(string(data), "NAT Configuration") {
+		t.Errorf("Export should contain the config view, got %q", data)
+	}
+	if !msg.copied || copied != string(data) {
+		t.Error("Export should be copied to the clipboard")
+	}
+
+	newModelInterface, _ = newModelInterface.(Model).Update(msg)
+	if view := newModelInterface.View(); !strings.Contains(view, msg.path) {
+		t.Error("View should report where the export was written")
+	}
+}
+
+func TestDevicesView(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.Default()
+	cfg.ExternalInterface = "en0"
+	cfg.InternalInterface = "bridge100"
+	model := NewApp(cfg).initialModel()
+
+	newModelInterface, _ := model.switchView("devices")
+	model = newModelInterface.(Model)
+	newModelInterface, _ = model.Update(devicesMsg{devices: []nat.Device{
+		{IP: "192.168.100.20", MAC: "02:00:00:00:00:02", Hostname: "laptop", LeaseRemaining: "1h0m"},
+	}})
+	model = newModelInterface.(Model)
+	if rows := model.deviceTable.Rows(); len(rows) != 1 || rows[0][3] != "laptop" || rows[0][5] != "" {
+		t.Fatalf("Unexpected device rows %v", rows)
+	}
+
+	model = pressKeys(model, keyRunes("b"), keyRunes("y"), keyRunes("R"))
+	if model.toasts.lastError() != nil {
+		t.Fatalf("Unexpected error: %v", model.toasts.lastError())
+	}
+	if flags := model.deviceTable.Rows()[0][5]; flags != "blocked,reserved" {
+		t.Errorf("Expected the device blocked and reserved, got %q", flags)
+	}
+	if ip := reservedIP(model.config, "02:00:00:00:00:02"); ip != "192.168.100.20" {
+		t.Errorf("Expected a reservation of 192.168.100.20, got %q", ip)
+	}
+
+	model = pressKeys(model, keyRunes("n"))
+	if model.currentView != "input" || model.inputField != "nickname" {
+		t.Fatalf("'n' should edit the nickname, got view %q field %q", model.currentView, model.inputField)
+	}
+	model = pressKeys(model, keyRunes("Work laptop"), tea.KeyMsg{Type: tea.KeyEnter})
+	if model.currentView != "devices" {
+		t.Errorf("Expected to return to the devices view, got %q", model.currentView)
+	}
+	if name := model.deviceTable.Rows()[0][3]; name != "Work laptop" {
+		t.Errorf("Expected the nickname in the table, got %q", name)
+	}
+
+	model = pressKeys(model, keyRunes("b"), keyRunes("R"))
+	if flags := model.deviceTable.Rows()[0][5]; flags != "" || len(model.config.BlockedDevices) != 0 || len(model.config.DHCPLeases) != 0 {
+		t.Errorf("Expected the block and reservation removed, got %q %v %v", flags, model.config.BlockedDevices, model.config.DHCPLeases)
+	}
+}
+
+func TestDeviceScreen(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.Default()
+	cfg.ExternalInterface = "en0"
+	cfg.InternalInterface = "bridge100"
+	model := NewApp(cfg).initialModel()
+	model = pressKeys(model, keyRunes("6"))
+	next, _ := model.Update(devicesMsg{devices: []nat.Device{
+		{IP: "192.168.100.20", MAC: "02:00:00:00:00:02", Hostname: "laptop"},
+	}})
+	model = next.(Model)
+	model.connections = []nat.Connection{
+		{Source: "192.168.100.20:51000", Destination: "1.1.1.1:443", Protocol: "tcp", State: "ESTABLISHED"},
+		{Source: "192.168.100.30:52000", Destination: "8.8.8.8:53", Protocol: "udp"},
+	}
+
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.currentView != "device" || model.device.device.Hostname != "laptop" {
+		t.Fatalf("'enter' should open the device screen, got view %q", model.currentView)
+	}
+	if conns := model.deviceConns(); len(conns) != 1 || conns[0].Destination != "1.1.1.1:443" {
+		t.Errorf("Expected only the device's connection, got %v", conns)
+	}
+
+	// Throttle, then lift the cap
+	model = pressKeys(model, keyRunes("t"), keyRunes("2Mbit/s"), tea.KeyMsg{Type: tea.KeyEnter})
+	if model.currentView != "device" || deviceThrottle(model.config, model.device.device) != "2Mbit/s" {
+		t.Fatalf("Expected the device throttled to 2Mbit/s, got %v", model.config.Bandwidth.Caps)
+	}
+	if caps := model.config.ToNATConfig().Shaping.Caps; len(caps) != 1 || caps[0].Devices[0] != "02:00:00:00:00:02" {
+		t.Errorf("Expected a cap of the device's MAC, got %v", caps)
+	}
+	if view := model.View(); !strings.Contains(view, "throttled to 2Mbit/s") {
+		t.Errorf("Expected the throttle shown, got:\n%s", view)
+	}
+	model = pressKeys(model, keyRunes("t"), tea.KeyMsg{Type: tea.KeyCtrlU}, tea.KeyMsg{Type: tea.KeyEnter})
+	if len(model.config.Bandwidth.Caps) != 0 {
+		t.Errorf("Expected the cap lifted, got %v", model.config.Bandwidth.Caps)
+	}
+
+	if model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEsc}); model.currentView != "devices" {
+		t.Errorf("'esc' should return to the devices, got %q", model.currentView)
+	}
+}
+
+func TestFirewallRules(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.Default()
+	cfg.ExternalInterface = "en0"
+	cfg.InternalInterface = "bridge100"
+	cfg.DNSBlocklist.Allowlist = []string{"tiktok.com"}
+	model := NewApp(cfg).initialModel()
+	model.devices = []nat.Device{{IP: "192.168.100.20", MAC: "aa:bb:cc:dd:ee:01", Hostname: "kids-ipad"}}
+	enter := tea.KeyMsg{Type: tea.KeyEnter}
+
+	model = pressKeys(model, keyRunes("f"))
+	if model.currentView != "rules" || len(model.rules) != 1 {
+		t.Fatalf("'f' should list the allowlisted domain, got view %q with %v", model.currentView, model.rules)
+	}
+
+	// Blocking by hostname and domain works like the block command
+	model = pressKeys(model, keyRunes("b"), keyRunes("kids-ipad tiktok.com"), enter)
+	if model.currentView != "rules" || model.toasts.lastError() != nil {
+		t.Fatalf("Expected the block applied, got view %q error %v", model.currentView, model.toasts.lastError())
+	}
+	if strings.Join(cfg.BlockedDevices, ",") != "aa:bb:cc:dd:ee:01" || strings.Join(cfg.DNSBlocklist.Domains, ",") != "tiktok.com" ||
+		len(cfg.DNSBlocklist.Allowlist) != 0 {
+		t.Errorf("Unexpected blocks %v %+v", cfg.BlockedDevices, cfg.DNSBlocklist)
+	}
+	if view := model.View(); !strings.Contains(view, "kids-ipad") {
+		t.Errorf("Expected the blocked device named, got:\n%s", view)
+	}
+
+	// Schedule entries are validated and saved
+	model = pressKeys(model, keyRunes("s"), keyRunes("start 25:00"), enter)
+	if len(cfg.Schedule) != 0 || model.toasts.lastError() == nil {
+		t.Error("An invalid time should be refused")
+	}
+	model = pressKeys(model, keyRunes("s"), keyRunes("stop 19:00 mon-fri"), enter)
+	if len(cfg.Schedule) != 1 || cfg.Schedule[0].Name != "stop-1900" || len(model.rules) != 3 {
+		t.Fatalf("Expected a schedule entry stop-1900, got %v", cfg.Schedule)
+	}
+	saved, err := config.Load()
+	if err != nil || len(saved.Schedule) != 1 || len(saved.BlockedDevices) != 1 {
+		t.Errorf("Expected the rules saved, got %v", err)
+	}
+
+	// Deleting the device block lets it back on
+	model = pressKeys(model, keyRunes("d"), keyRunes("y"))
+	if len(cfg.BlockedDevices) != 0 || len(model.rules) != 2 {
+		t.Errorf("Expected the device block deleted, got %v", model.rules)
+	}
+}
+
+// pressKeys sends keys to model and returns the result
+func pressKeys(model Model, keys ...tea.KeyMsg) Model {
+	for _, key := range keys {
+		next, _ := model.handleKeyMsg(key)
+		model = next.(Model)
+	}
+	return model
+}
+
+func keyRunes(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestForwardEditorValidation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	model := NewApp(config.Default()).initialModel()
+	tab := tea.KeyMsg{Type: tea.KeyTab}
+
+	model = pressKeys(model, keyRunes("7"), keyRunes("a"))
+	if model.currentView != "forward_edit" {
+		t.Fatalf("'a' should open the editor, got view %q", model.currentView)
+	}
+
+	// The editor validates as the fields are typed and refuses to save
+	model = pressKeys(model, tab, keyRunes("70000"), tab, keyRunes("10.0.0.5"))
+	if err := model.forwardForm.err; err == nil || !strings.Contains(err.Error(), "external port must be 1-65535") {
+		t.Errorf("Expected a port range error, got %v", err)
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.currentView != "forward_edit" || len(model.config.PortForwards) != 0 {
+		t.Fatal("An invalid forward should not be saved")
+	}
+
+	model = model.focusForwardField(forwardExternalPort)
+	model.forwardForm.inputs[forwardExternalPort].SetValue("")
+	model = pressKeys(model, keyRunes("8080"))
+	if err := model.forwardForm.err; err == nil || !strings.Contains(err.Error(), "must be in 192.168.100.0/24") {
+		t.Errorf("Expected a subnet error, got %v", err)
+	}
+}
+
+func TestForwardEditorSave(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	model := NewApp(config.Default()).initialModel()
+	tab := tea.KeyMsg{Type: tea.KeyTab}
+	enter := tea.KeyMsg{Type: tea.KeyEnter}
+
+	model = pressKeys(model, keyRunes("7"), keyRunes("a"), tab, keyRunes("8080"), tab,
+		keyRunes("192.168.100.50"), tab, keyRunes("80"), enter)
+	if model.currentView != "forwards" || model.toasts.lastError() != nil {
+		t.Fatalf("Expected the forward saved, got view %q err %v", model.currentView, model.toasts.lastError())
+	}
+	want := config.PortForward{Protocol: "tcp", ExternalPort: 8080, InternalIP: "192.168.100.50", InternalPort: 80}
+	if len(model.config.PortForwards) != 1 || model.config.PortForwards[0] != want {
+		t.Fatalf("Expected %+v, got %+v", want, model.config.PortForwards)
+	}
+	saved, err := config.Load()
+	if err != nil || len(saved.PortForwards) != 1 {
+		t.Fatalf("Forward should be written to the config file, got %+v (%v)", saved.PortForwards, err)
+	}
+
+	// Editing keeps the forward's place; deleting removes it
+	model = pressKeys(model, keyRunes("e"), tab, tab, tab, tab, keyRunes("web"), enter)
+	if len(model.config.PortForwards) != 1 || model.config.PortForwards[0].Description != "web" {
+		t.Errorf("Expected the description edited, got %+v", model.config.PortForwards)
+	}
+	model = pressKeys(model, keyRunes("d"), keyRunes("y"))
+	if len(model.config.PortForwards) != 0 || len(model.forwardTable.Rows()) != 0 {
+		t.Errorf("Expected the forward deleted, got %+v", model.config.PortForwards)
+	}
+}
+
+func TestLogTail(t *testing.T) {
+	dir := t.TempDir()
+	auditLog := dir + "/audit.log"
+	serverLog := dir + "/dnsmasq.log"
+	writeFile := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(auditLog, `{"time":"2026-10-16T09:00:00Z","source":"system","actor":"admin","action":"pfctl","target":"-a nat-manager -f -","result":"ok"}
+{"time":"2026-10-16T09:00:01Z","source":"system","actor":"admin","action":"ifconfig","target":"bridge100 up","result":"failed","detail":"exit status 1"}
+{"time":"2026-10-16T09:00:02Z","source":"system","instance":"lab","actor":"admin","action":"sysctl","result":"ok"}
+`)
+	writeFile(serverLog, "dnsmasq: started\ndnsmasq: failed to bind DHCP server socket\npartial")
+
+	model := NewApp(config.Default()).initialModel()
+	model.logs.tails = []logTail{{path: auditLog, audit: true, offset: -1}, {path: serverLog, server: "dnsmasq", offset: -1}}
+	model.currentView = "logs"
+	model, cmd := model.pollLogs()
+	next, _ := model.Update(cmd())
+	model = next.(Model)
+
+	var got []string
+	for _, line := range model.logs.lines {
+		got = append(got, line.component+"/"+line.severity)
+	}
+	want := []string{"pf/info", "manager/error", "dnsmasq/info", "dnsmasq/error"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("Expected lines %v, got %v", want, got)
+	}
+
+	// Only complete new lines are read, and not while paused
+	writeFile(serverLog, "dnsmasq: started\ndnsmasq: failed to bind DHCP server socket\npartial line\n")
+	model = pressKeys(model, keyRunes("p"))
+	if model, cmd = model.pollLogs(); cmd != nil {
+		t.Error("A paused viewer should not read the logs")
+	}
+	next, cmd = model.handleKeyMsg(keyRunes("p"))
+	next, _ = next.(Model).Update(cmd())
+	model = next.(Model)
+	if n := len(model.logs.lines); n != 5 || model.logs.lines[4].text != "partial line" {
+		t.Errorf("Expected the completed line appended, got %d lines", n)
+	}
+
+	model = pressKeys(model, keyRunes("f"), keyRunes("f"), keyRunes("f"))
+	if model.logs.filter != "dnsmasq" || len(model.logs.visible(model.logs.lines)) != 3 {
+		t.Errorf("Expected the dnsmasq lines filtered, got %q", model.logs.filter)
+	}
+	if view := model.logsView(); strings.Contains(view, "pfctl") || !strings.Contains(view, "partial line") {
+		t.Errorf("Filtered view shows the wrong lines:\n%s", view)
+	}
+}
+
+func TestTrafficView(t *testing.T) {
+	cfg := &config.Config{ExternalInterface: "en0", InternalInterface: "bridge100"}
+	cfg.Bandwidth.Downlink, cfg.Bandwidth.Uplink = "8Mbit/s", "1Mbit/s"
+	model := NewApp(cfg).initialModel()
+
+	start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	sample := func(at time.Duration, link, laptop, phone uint64) {
+		next, _ := model.Update(trafficMsg{
+			time:       start.Add(at),
+			interfaces: map[string]nat.Traffic{"en0": {BytesIn: link, BytesOut: link / 4}},
+			devices: map[string]nat.Traffic{
+				"192.168.100.10": {BytesIn: laptop},
+				"192.168.100.11": {BytesIn: phone},
+			},
+		})
+		model = next.(Model)
+	}
+	sample(0, 0, 0, 0)
+	sample(2*time.Second, 1_000_000, 750_000, 250_000)
+	sample(4*time.Second, 1_500_000, 1_000_000, 500_000)
+
+	if s := model.traffic.interfaces["en0"]; len(s.down) != 2 || s.down[0] != 500_000 || s.down[1] != 250_000 {
+		t.Fatalf("Unexpected download rates %+v", model.traffic.interfaces["en0"])
+	}
+	if got := model.busiestDevices(); len(got) != 2 || got[0] != "192.168.100.10" {
+		t.Errorf("Expected the laptop busiest, got %v", got)
+	}
+
+	view := model.trafficView()
+	for _, want := range []string{"en0", "█▄", "2.0 Mbit/s", "███░░░░░░░  25% of 8Mbit/s", "192.168.100.10", "50%"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Traffic view should contain %q:\n%s", want, view)
+		}
+	}
+
+	// Devices that disappear lose their series
+	next, _ := model.Update(trafficMsg{time: start.Add(6 * time.Second), interfaces: map[string]nat.Traffic{}})
+	if model = next.(Model); len(model.traffic.devices) != 0 {
+		t.Errorf("Expected no device series, got %v", model.traffic.devices)
+	}
+}
+
+func TestSparklineAndGauge(t *testing.T) {
+	if got := sparkline([]float64{0, 50, 100}, 5); got != "  ▁▄█" {
+		t.Errorf("sparkline = %q", got)
+	}
+	if got := sparkline(nil, 3); got != "   " {
+		t.Errorf("empty sparkline = %q", got)
+	}
+	if got := gauge(75, 100, 4); got != "███░  75%" {
+		t.Errorf("gauge = %q", got)
+	}
+	if got := gauge(5, 0, 4); got != "░░░░   0%" {
+		t.Errorf("gauge without a limit = %q", got)
+	}
+}
+
+func TestHelpOverlay(t *testing.T) {
+	model := NewApp(config.Default()).initialModel()
+	model.currentView = "devices"
+
+	model = pressKeys(model, keyRunes("?"))
+	if !model.showHelp {
+		t.Fatal("'?' should open the help overlay")
+	}
+	view := model.View()
+	for _, want := range []string{"Connected Devices", "block/unblock", "reserve address", "command palette"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Help should list %q:\n%s", want, view)
+		}
+	}
+
+	// Keys go to the overlay while it is open
+	model = pressKeys(model, keyRunes("b"))
+	if !model.showHelp || len(model.config.BlockedDevices) != 0 {
+		t.Error("Keys other than '?' and 'esc' should be ignored by the overlay")
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEsc})
+	if model.showHelp || model.currentView != "devices" {
+		t.Errorf("'esc' should close the overlay and stay in the view, got %q", model.currentView)
+	}
+
+	// '?' is typed while editing text
+	model.currentView = "input"
+	model.textInput.Focus()
+	model = pressKeys(model, keyRunes("?"))
+	if model.showHelp || model.textInput.Value() != "?" {
+		t.Errorf("'?' should be typed into the field, got %q", model.textInput.Value())
+	}
+}
+
+func TestConfirmDialog(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cfg := config.Default()
+	cfg.PortForwards = []config.PortForward{{Protocol: "tcp", ExternalPort: 8080, InternalIP: "192.168.100.50", InternalPort: 80}}
+	model := NewApp(cfg).initialModel()
+	model.devices = []nat.Device{{IP: "192.168.100.20"}}
+	model.deviceTable.SetRows(model.deviceRows())
+	model.currentView = "devices"
+
+	// Blocking asks first and 'n' cancels
+	model = pressKeys(model, keyRunes("b"))
+	if model.dialog == nil || !strings.Contains(model.View(), "Block 192.168.100.20") {
+		t.Fatalf("Blocking should ask for confirmation:\n%s", model.View())
+	}
+	model = pressKeys(model, keyRunes("x"), keyRunes("n"))
+	if model.dialog != nil || len(model.config.BlockedDevices) != 0 {
+		t.Fatal("'n' should cancel without blocking")
+	}
+
+	// Deleting a forward asks first and 'y' confirms
+	model = pressKeys(model, keyRunes("q"), keyRunes("7"), keyRunes("d"))
+	if model.dialog == nil || len(model.config.PortForwards) != 1 {
+		t.Fatal("Deleting a forward should ask for confirmation")
+	}
+	model = pressKeys(model, keyRunes("y"))
+	if model.dialog != nil || len(model.config.PortForwards) != 0 {
+		t.Error("'y' should delete the forward")
+	}
+
+	// tui.skip_confirm acts right away
+	model.config.TUI.SkipConfirm = true
+	model.currentView = "devices"
+	model = pressKeys(model, keyRunes("b"))
+	if model.dialog != nil || len(model.config.BlockedDevices) != 1 {
+		t.Errorf("Expected the device blocked without asking, got %v", model.config.BlockedDevices)
+	}
+}
+
+func TestConnectionsTable(t *testing.T) {
+	model := NewApp(config.Default()).initialModel()
+	model.currentView = "monitor"
+	next, _ := model.Update(connectionsMsg{connections: []nat.Connection{
+		{Source: "192.168.100.10:50000", Destination: "93.184.216.34:443", Protocol: "TCP", Bytes: 500, Age: time.Minute,
+			Entry: "ALL tcp 192.168.1.5:61000 (192.168.100.10:50000) -> 93.184.216.34:443 ESTABLISHED:ESTABLISHED"},
+		{Source: "192.168.100.11:5353", Destination: "1.1.1.1:53", Protocol: "UDP", Bytes: 2048, Age: time.Second},
+		{Source: "192.168.100.10:50001", Destination: "10.0.0.5:22", Protocol: "TCP", Bytes: 100, Age: time.Hour},
+	}})
+	model = next.(Model)
+	destinations := func() string {
+		var d []string
+		for _, row := range model.table.Rows() {
+			d = append(d, row[1])
+		}
+		return strings.Join(d, " ")
+	}
+
+	model = pressKeys(model, keyRunes("b"))
+	if got := destinations(); got != "1.1.1.1:53 93.184.216.34:443 10.0.0.5:22" {
+		t.Errorf("Sorted by bytes: %s", got)
+	}
+	model = pressKeys(model, keyRunes("d"), keyRunes("d"))
+	if got := destinations(); got != "93.184.216.34:443 10.0.0.5:22 1.1.1.1:53" {
+		t.Errorf("Sorted by destination, reversed: %s", got)
+	}
+
+	// Searching filters as it is typed, by text or by filter terms
+	model = pressKeys(model, keyRunes("/"), keyRunes("tcp"))
+	if !model.conns.searching || len(model.table.Rows()) != 2 {
+		t.Fatalf("Expected 2 TCP connections while searching, got %d", len(model.table.Rows()))
+	}
+	model.conns.search.SetValue("")
+	model = pressKeys(model, keyRunes("port=22"), tea.KeyMsg{Type: tea.KeyEnter})
+	if model.conns.searching || destinations() != "10.0.0.5:22" {
+		t.Errorf("Expected the port 22 connection, got %s", destinations())
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEsc})
+	if model.currentView != "monitor" || len(model.table.Rows()) != 3 {
+		t.Errorf("'esc' should clear the search first, got view %q with %d rows", model.currentView, len(model.table.Rows()))
+	}
+
+	// Enter shows the full state entry of the selected connection
+	model = pressKeys(model, keyRunes("b"), tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.conns.detail == nil || !strings.Contains(model.View(), "ALL tcp 192.168.1.5:61000") {
+		t.Errorf("Expected the details of the selected connection:\n%s", model.View())
+	}
+	if model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEsc}); model.conns.detail != nil || model.currentView != "monitor" {
+		t.Error("'esc' should close the details")
+	}
+}
+
+func TestConfigEditor(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	model := NewApp(config.Default()).initialModel()
+	model.interfaces = []nat.NetworkInterface{{Name: "en0"}, {Name: "en1"}, {Name: "bridge100"}}
+	model.currentView = "config"
+
+	// Interfaces are picked from a dropdown
+	model = pressKeys(model, keyRunes("1"), tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.config.ExternalInterface != "en1" || model.settings.choices != nil {
+		t.Errorf("Expected en1 picked as external interface, got %q", model.config.ExternalInterface)
+	}
+	model = pressKeys(model, keyRunes("2"), tea.KeyMsg{Type: tea.KeyUp}, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.settings.message == "" || model.config.InternalInterface != "bridge100" {
+		t.Errorf("Picking the external interface as internal should be refused, got %q", model.config.InternalInterface)
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEsc})
+
+	// Typed values are validated as they are typed and kept out until valid
+	model = pressKeys(model, keyRunes("7"), tea.KeyMsg{Type: tea.KeyCtrlU}, keyRunes("1.1.1.1, dns.example"))
+	if !model.editing() || !strings.Contains(model.View(), "invalid DNS server") {
+		t.Errorf("Expected an inline validation message:\n%s", model.View())
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if !model.settings.typing || len(model.config.DNSServers) != 2 {
+		t.Error("An invalid value should not be saved")
+	}
+	model.settings.input.SetValue("1.1.1.1 9.9.9.9")
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if got := strings.Join(model.config.DNSServers, " "); got != "1.1.1.1 9.9.9.9" || model.settings.typing {
+		t.Errorf("Expected the new DNS servers, got %q", got)
+	}
+}
+
+func TestConfigEditorNetwork(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	model := NewApp(config.Default()).initialModel()
+	model.currentView = "config"
+
+	model = pressKeys(model, keyRunes("6"), tea.KeyMsg{Type: tea.KeyCtrlU}, keyRunes("soon"))
+	if model.settings.message == "" {
+		t.Error("Expected an invalid lease time to be reported")
+	}
+	model.settings.input.SetValue("7d")
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.config.DHCPRange.Lease != "7d" {
+		t.Errorf("Expected lease 7d, got %q", model.config.DHCPRange.Lease)
+	}
+
+	// The DHCP pool, subnet and gateway move with the network
+	model = pressKeys(model, keyRunes("3"))
+	model.settings.input.SetValue("10.0.5")
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.config.DHCPRange.Start != "10.0.5.100" || !strings.Contains(model.View(), "gateway 10.0.5.1") {
+		t.Errorf("Expected the pool and gateway on 10.0.5, got start %q", model.config.DHCPRange.Start)
+	}
+
+	saved, err := config.Load()
+	if err != nil || saved.InternalNetwork != "10.0.5" || saved.DHCPRange.Lease != "7d" {
+		t.Errorf("Expected the edits saved, got %+v (%v)", saved, err)
+	}
+}
+
+func TestConfigEditorProfiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { _ = config.SetProfile("") })
+	lab := config.Default()
+	lab.InternalNetwork = "192.168.50"
+	lab.DHCPRange = config.DHCPRange{Start: "192.168.50.10", End: "192.168.50.20", Lease: "1h"}
+	if err := config.CreateProfile("lab", lab); err != nil {
+		t.Fatal(err)
+	}
+	model := NewApp(config.Default()).initialModel()
+	model.currentView = "config"
+
+	model = pressKeys(model, keyRunes("8"), tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyEnter})
+	if config.Profile() != "lab" || model.config.InternalNetwork != "192.168.50" || model.app.config.InternalNetwork != "192.168.50" {
+		t.Errorf("Expected the lab profile loaded, got profile %q network %q", config.Profile(), model.config.InternalNetwork)
+	}
+	model = pressKeys(model, keyRunes("8"), tea.KeyMsg{Type: tea.KeyUp}, tea.KeyMsg{Type: tea.KeyEnter})
+	if config.Profile() != "" || model.config.InternalNetwork != "192.168.100" {
+		t.Errorf("Expected the instance configuration back, got profile %q", config.Profile())
+	}
+}
+
+// wizardModel opens the setup wizard on a fresh configuration with en0
+// holding the default route
+func wizardModel(t *testing.T) Model {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { _ = config.SetProfile("") })
+	model := pressKeys(NewApp(config.Default()).initialModel(), keyRunes("9"))
+	next, _ := model.Update(interfacesMsg{interfaces: []nat.NetworkInterface{{Name: "lo0"}, {Name: "en0", DefaultRoute: true}, {Name: "bridge100"}}})
+	return next.(Model)
+}
+
+func TestSetupWizardInterfaces(t *testing.T) {
+	model := wizardModel(t)
+	if !firstRun() {
+		t.Error("Expected a first run without any configuration")
+	}
+	if model.currentView != "wizard" || model.wizard.choice != 1 {
+		t.Fatalf("Expected the default route interface proposed, got view %q choice %d", model.currentView, model.wizard.choice)
+	}
+
+	// External, then internal: the bridge is proposed and en0 refused
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.wizard.step != stepInternal || model.wizard.choice != 2 {
+		t.Fatalf("Expected bridge100 proposed as internal interface, got step %d choice %d", model.wizard.step, model.wizard.choice)
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyUp}, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.wizard.step != stepInternal || model.wizard.message == "" {
+		t.Error("The external interface should be refused as internal interface")
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEsc})
+	if model.wizard.step != stepExternal {
+		t.Errorf("'esc' should go back a step, got step %d", model.wizard.step)
+	}
+
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter}, tea.KeyMsg{Type: tea.KeyEnter},
+		tea.KeyMsg{Type: tea.KeyCtrlU}, keyRunes("10.0"), tea.KeyMsg{Type: tea.KeyEnter})
+	if model.wizard.step != stepNetwork || !strings.Contains(model.View(), "first three octets") {
+		t.Error("An invalid network should be refused")
+	}
+}
+
+func TestSetupWizard(t *testing.T) {
+	model := wizardModel(t)
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter}, tea.KeyMsg{Type: tea.KeyEnter})
+
+	// A free network is proposed and checked as it is typed
+	if model.wizard.step != stepNetwork || model.wizard.input.Value() == "" || !model.editing() {
+		t.Fatalf("Expected a proposed network, got step %d value %q", model.wizard.step, model.wizard.input.Value())
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyCtrlU}, keyRunes("10.0.7"), tea.KeyMsg{Type: tea.KeyEnter})
+	if model.wizard.step != stepChecks || !strings.Contains(model.View(), "dnsmasq") {
+		t.Fatalf("Expected the dnsmasq check, got step %d:\n%s", model.wizard.step, model.View())
+	}
+
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyEnter}, tea.KeyMsg{Type: tea.KeyEnter})
+	if model.currentView != "menu" || config.Profile() != defaultProfile || model.config.InternalNetwork != "10.0.7" {
+		t.Fatalf("Expected the %s profile created and selected, got view %q profile %q", defaultProfile, model.currentView, config.Profile())
+	}
+	saved, err := config.LoadProfile(defaultProfile)
+	if err != nil || saved.ExternalInterface != "en0" || saved.InternalInterface != "bridge100" || saved.DHCPRange.Start != "10.0.7.100" || firstRun() {
+		t.Errorf("Unexpected profile %+v (%v)", saved, err)
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	model := NewApp(config.Default()).initialModel()
+	update := func(msg tea.Msg) {
+		next, _ := model.Update(msg)
+		model = next.(Model)
+	}
+
+	update(natResultMsg{success: false, err: errors.New("failed to start NAT: pfctl missing")})
+	update(natResultMsg{success: true, result: "🟢 NAT started"})
+	if view := model.View(); !strings.Contains(view, "pfctl missing") || !strings.Contains(view, "NAT started") {
+		t.Errorf("Expected toasts for the NAT results:\n%s", view)
+	}
+
+	// Devices joining and WAN changes are noticed once something is known
+	update(devicesMsg{devices: []nat.Device{{IP: "192.168.100.10", MAC: "aa:bb:cc:dd:ee:01"}}})
+	update(devicesMsg{devices: []nat.Device{{IP: "192.168.100.10", MAC: "aa:bb:cc:dd:ee:01"}, {IP: "192.168.100.11"}}})
+	update(wanMsg{NetworkState: nat.NetworkState{ExternalIP: "203.0.113.5", DefaultRoute: "en0"}})
+	update(wanMsg{NetworkState: nat.NetworkState{ExternalIP: "198.51.100.7", DefaultRoute: "en0"}})
+	var texts []string
+	for _, toast := range model.toasts.history {
+		texts = append(texts, toast.text)
+	}
+	if got := strings.Join(texts, "|"); len(texts) != 4 || !strings.Contains(got, "192.168.100.11") || !strings.Contains(got, "to 198.51.100.7") {
+		t.Errorf("Expected the NAT results, one device and one WAN change, got %q", got)
+	}
+
+	// Toasts expire, the history keeps them
+	model.toasts.expire(time.Now().Add(errorToastLifetime))
+	if len(model.toasts.shown) != 0 || strings.Contains(model.View(), "pfctl missing") {
+		t.Error("Toasts should expire")
+	}
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyCtrlN})
+	if model.currentView != "notifications" || !strings.Contains(model.View(), "pfctl missing") {
+		t.Errorf("Expected the history to list past errors:\n%s", model.View())
+	}
+	if model = pressKeys(model, keyRunes("c")); len(model.toasts.history) != 0 {
+		t.Error("'c' should clear the history")
+	}
+}
+
+func TestWANWidget(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExternalInterface = "en0"
+	model := NewApp(cfg).initialModel()
+	if view := model.View(); !strings.Contains(view, "WAN en0") || !strings.Contains(view, "Checking") {
+		t.Errorf("Expected the menu to show the WAN before the first check:\n%s", view)
+	}
+
+	checked := time.Now()
+	next, _ := model.Update(wanMsg{
+		NetworkState: nat.NetworkState{ExternalIP: "203.0.113.5", DefaultRoute: "en0"},
+		Gateway:      "203.0.113.1", Reachable: true, Latency: 1500 * time.Microsecond, Checked: checked,
+	})
+	model = next.(Model)
+	view := model.View()
+	for _, want := range []string{"203.0.113.5", "203.0.113.1", "reachable", "1.5ms"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Expected %q in the menu:\n%s", want, view)
+		}
+	}
+
+	next, _ = model.Update(wanMsg{
+		NetworkState: nat.NetworkState{ExternalIP: "198.51.100.7", DefaultRoute: "en1"},
+		Gateway:      "198.51.100.1", Checked: checked.Add(time.Minute),
+	})
+	model = next.(Model)
+	view = model.View()
+	for _, want := range []string{"198.51.100.7 (changed", "unreachable", "default route is on en1"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Expected %q in the menu:\n%s", want, view)
+		}
+	}
+	if !model.wan.changed.Equal(checked.Add(time.Minute)) {
+		t.Errorf("Expected the address change at %s, got %s", checked.Add(time.Minute), model.wan.changed)
+	}
+}
+
+// profilesModel opens the profile switcher with profiles home and lab
+func profilesModel(t *testing.T) Model {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(func() { _ = config.SetProfile("") })
+	for name, network := range map[string]string{"home": "192.168.110", "lab": "10.100.7"} {
+		cfg := config.Default()
+		cfg.ExternalInterface, cfg.InternalInterface = "en0", "bridge100"
+		if err := changeNetwork(cfg, network); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.CreateProfile(name, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return pressKeys(NewApp(config.Default()).initialModel(), keyRunes("p"))
+}
+
+func TestProfileSwitcher(t *testing.T) {
+	model := profilesModel(t)
+	if model.currentView != "profiles" || len(model.profiles) != 3 || model.profileTable.Cursor() != 0 {
+		t.Fatalf("Expected the instance configuration and two profiles, got view %q with %d", model.currentView, len(model.profiles))
+	}
+
+	// Switch to lab and preview it
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyEnter})
+	if config.Profile() != "lab" || model.config.InternalNetwork != "10.100.7" {
+		t.Fatalf("Expected profile lab in use, got %q with network %s", config.Profile(), model.config.InternalNetwork)
+	}
+	if view := model.View(); !strings.Contains(view, "In use: lab") || !strings.Contains(view, "10.100.7.0/24, gateway 10.100.7.1") {
+		t.Errorf("Expected lab previewed as in use, got:\n%s", view)
+	}
+
+	// Starting NAT with home switches first, then asks
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyUp}, keyRunes("s"))
+	if config.Profile() != "home" || model.dialog == nil {
+		t.Errorf("Expected home in use and NAT start confirmed, got %q", config.Profile())
+	}
+}
+
+func TestProfileSwitcherCreateDelete(t *testing.T) {
+	model := profilesModel(t)
+	model = pressKeys(model, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyDown}, tea.KeyMsg{Type: tea.KeyEnter})
+
+	// The profile in use cannot be deleted
+	model = pressKeys(model, keyRunes("d"))
+	if model.dialog != nil || model.toasts.lastError() == nil {
+		t.Error("Deleting the profile in use should be refused")
+	}
+
+	// Copy lab, then delete the copy
+	model = pressKeys(model, keyRunes("n"), keyRunes("lab-copy"), tea.KeyMsg{Type: tea.KeyEnter})
+	if !config.ProfileExists("lab-copy") || model.currentView != "profiles" || model.profileTable.Cursor() != 3 {
+		t.Fatalf("Expected lab-copy created and selected, got view %q cursor %d", model.currentView, model.profileTable.Cursor())
+	}
+	if cfg, err := config.LoadProfile("lab-copy"); err != nil || cfg.InternalNetwork != "10.100.7" {
+		t.Errorf("Expected lab-copy to copy lab, got %v", err)
+	}
+	model = pressKeys(model, keyRunes("d"), keyRunes("y"))
+	if config.ProfileExists("lab-copy") || len(model.profiles) != 3 {
+		t.Error("Expected lab-copy deleted")
+	}
+}
+
+func TestThemes(t *testing.T) {
+	t.Cleanup(func() { applyTheme(config.TUIConfig{}) })
+
+	cfg := config.Default()
+	cfg.TUI = config.TUIConfig{Theme: config.ThemeASCII}
+	model := NewApp(cfg).initialModel()
+	model.showError(errors.New("failed"))
+	view := model.View()
+	for _, r := range view {
+		if r > 127 {
+			t.Fatalf("Expected only ASCII in the ascii theme, got %q in:\n%s", r, view)
+		}
+	}
+	if !strings.Contains(view, "[off] NAT Inactive") || !strings.Contains(view, "+---") {
+		t.Errorf("Expected ASCII status and borders, got:\n%s", view)
+	}
+
+	// Colors override the theme's by role
+	applyTheme(config.TUIConfig{Colors: map[string]string{"title": "#ff8800"}})
+	if titleStyle.GetForeground() != lipgloss.Color("#ff8800") || asciiOnly {
+		t.Errorf("Expected the title colored #ff8800, got %v", titleStyle.GetForeground())
+	}
+	if errorStyle.GetForeground() != lipgloss.Color("196") {
+		t.Errorf("Expected the default theme's error color, got %v", errorStyle.GetForeground())
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExternalInterface, cfg.InternalInterface = "en0", "bridge100"
+	app := NewApp(cfg)
+	app.SetReadOnly(true)
+	model := app.initialModel()
+
+	view := model.View()
+	if !strings.Contains(view, "Read-only") || !strings.Contains(view, "3. Start NAT (needs root)") {
+		t.Errorf("Expected the menu to show read-only mode:\n%s", view)
+	}
+
+	// Actions that change something are refused without a confirmation
+	for _, keys := range [][]tea.KeyMsg{{keyRunes("3")}, {keyRunes("9")}, {keyRunes("f"), keyRunes("b")}} {
+		model.currentView = "menu"
+		model = pressKeys(model, keys...)
+		if model.dialog != nil || model.currentView == "wizard" || model.currentView == "input" {
+			t.Errorf("Expected %v to be refused, got view %q", keys, model.currentView)
+		}
+	}
+	if err := model.toasts.lastError(); err == nil || !strings.Contains(err.Error(), "needs root privileges") {
+		t.Errorf("Expected a toast explaining read-only mode, got %q", err)
+	}
+
+	// Views that only show things still open
+	model.currentView = "menu"
+	if model = pressKeys(model, keyRunes("6")); model.currentView != "devices" {
+		t.Errorf("Expected the devices view, got %q", model.currentView)
+	}
+}
+
+func TestNATProgress(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExternalInterface, cfg.InternalInterface = "en0", "bridge100"
+	cfg.TUI.SkipConfirm = true
+	model := NewApp(cfg).initialModel()
+	update := func(msg tea.Msg) tea.Cmd {
+		next, cmd := model.Update(msg)
+		model = next.(Model)
+		return cmd
+	}
+
+	if model = pressKeys(model, keyRunes("3")); model.progress.action != "Starting NAT" {
+		t.Fatalf("Expected NAT to be starting, got %q", model.progress.action)
+	}
+	if model = pressKeys(model, keyRunes("5")); model.toasts.lastError() == nil {
+		t.Error("Expected stopping to wait for the start to finish")
+	}
+
+	// Steps arrive one by one, then the result
+	steps := make(chan string, 2)
+	result := &natResultMsg{success: true, result: "🟢 NAT started"}
+	steps <- "Enabling IP forwarding"
+	steps <- "Enabling pf"
+	close(steps)
+	cmd := nextStep(steps, result)
+	for cmd != nil {
+		cmd = update(cmd())
+		if view := model.View(); model.progress.action != "" && !strings.Contains(view, "Starting NAT...") {
+			t.Errorf("Expected the progress while starting:\n%s", view)
+		}
+		if len(model.progress.steps) == 2 && !strings.Contains(model.View(), "✓ Enabling IP forwarding") {
+			t.Errorf("Expected the first step done:\n%s", model.View())
+		}
+	}
+	if model.progress.action != "" || !strings.Contains(model.View(), "NAT started") {
+		t.Errorf("Expected the progress to give way to the result:\n%s", model.View())
+	}
+}
+
+func TestInterfaceHints(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExternalInterface, cfg.InternalInterface = "en0", "bridge100"
+	interfaces := []nat.NetworkInterface{
+		{Name: "en0", Type: "Ethernet", Status: "up", IP: "192.168.1.20", Network: "192.168.1.0/24", DefaultRoute: true},
+		{Name: "en5", Type: "Ethernet", Status: "up"},
+		{Name: "bridge100", Type: "Bridge", Status: "up"},
+		{Name: "en1", Type: "Ethernet", Status: "down"},
+	}
+	for iface, want := range map[int]string{0: "external candidate", 1: "no address, internal candidate", 2: "internal candidate", 3: "down"} {
+		if got := interfaceHint(interfaces[iface]); got != want && !strings.HasSuffix(got, want) {
+			t.Errorf("interfaceHint(%s) = %q, expected %q", interfaces[iface].Name, got, want)
+		}
+	}
+	if warnings := interfaceWarnings(cfg, interfaces); len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %q", warnings)
+	}
+
+	// Same interface on both sides, and a network overlapping the uplink's
+	cfg.InternalInterface = "en0"
+	cfg.InternalNetwork = "192.168.1"
+	if warnings := interfaceWarnings(cfg, interfaces); len(warnings) != 1 || !strings.Contains(warnings[0], "both en0") {
+		t.Errorf("Expected the same interface on both sides, got %q", warnings)
+	}
+	cfg.InternalInterface = "bridge100"
+	if warnings := interfaceWarnings(cfg, interfaces); len(warnings) != 1 || !strings.Contains(warnings[0], "overlaps 192.168.1.0/24 on en0") {
+		t.Errorf("Expected the overlap with en0, got %q", warnings)
+	}
+
+	// An uplink without the default route, shown in the view with roles
+	cfg.ExternalInterface, cfg.InternalNetwork = "en5", "192.168.100"
+	model := NewApp(cfg).initialModel()
+	model.currentView = "interfaces"
+	next, _ := model.Update(tea.WindowSizeMsg{Width: 120, Height: 50})
+	next, _ = next.(Model).Update(interfacesMsg{interfaces: interfaces})
+	model = next.(Model)
+	view := model.View()
+	for _, want := range []string{"does not hold the default route", "en5 [external]", "bridge100 [internal]"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Expected %q in the interfaces view:\n%s", want, view)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExternalInterface, cfg.InternalInterface = "en0", "bridge100"
+	cfg.DeviceLabels = map[string]string{"aa:bb:cc:dd:ee:01": "laptop"}
+	app := NewApp(cfg)
+	var copied string
+	app.clipboard = func(text string) error {
+		copied = text
+		return nil
+	}
+	model := app.initialModel()
+	run := func(cmd tea.Cmd) {
+		if cmd == nil {
+			t.Fatal("Expected a copy command")
+		}
+		next, _ := model.Update(cmd())
+		model = next.(Model)
+	}
+
+	next, _ := model.Update(devicesMsg{devices: []nat.Device{{IP: "192.168.100.10", MAC: "aa:bb:cc:dd:ee:01", Vendor: "Apple"}}})
+	model = next.(Model)
+	model.currentView = "devices"
+	_, cmd := model.handleKeyMsg(keyRunes("y"))
+	run(cmd)
+	if copied != "laptop 192.168.100.10 aa:bb:cc:dd:ee:01 Apple" {
+		t.Errorf("Unexpected device row %q", copied)
+	}
+	if !strings.Contains(model.View(), "Copied the device") {
+		t.Errorf("Expected a notice of the copy:\n%s", model.View())
+	}
+
+	model.currentView = "monitor"
+	model.connections = []nat.Connection{{Protocol: "tcp", Source: "192.168.100.10:5000", Destination: "1.1.1.1:443", State: "ESTABLISHED"}}
+	model.refreshConnections()
+	_, cmd = model.handleKeyMsg(keyRunes("y"))
+	run(cmd)
+	if copied != "tcp 192.168.100.10:5000 -> 1.1.1.1:443 ESTABLISHED -" {
+		t.Errorf("Unexpected connection row %q", copied)
+	}
+
+	_, cmd = model.handleKeyMsg(keyRunes("Y"))
+	run(cmd)
+	for _, want := range []string{"NAT:         inactive", "bridge100 192.168.100.0/24", "Connections: 1", "  laptop 192.168.100.10"} {
+		if !strings.Contains(copied, want) {
+			t.Errorf("Expected %q in the status summary:\n%s", want, copied)
+		}
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	path, err := config.GetAuditLogPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := audit.Open(path, config.Instance())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Hour)
+	for _, entry := range []audit.Entry{
+		{Time: start, Source: audit.SourceEvent, Actor: "root", Action: "nat started", Target: "en0 -> bridge100", Result: "ok"},
+		{Time: start.Add(time.Minute), Source: audit.SourceSystem, Actor: "root", Action: "pfctl", Target: "-e", Result: "ok"},
+		{Time: start.Add(2 * time.Minute), Source: audit.SourceSystem, Actor: "root", Action: "kill", Target: "pid 42", Result: "failed", Detail: "no such process"},
+		{Time: start.Add(3 * time.Minute), Source: audit.SourceEvent, Actor: "root", Action: "dhcp restarted", Target: "bridge100", Result: "ok"},
+		{Time: start.Add(4 * time.Minute), Source: audit.SourceEvent, Instance: "lab", Actor: "root", Action: "nat started", Result: "ok"},
+	} {
+		if err := log.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = log.Close()
+
+	model := NewApp(config.Default()).initialModel()
+	model.toasts.notify(toastInfo, "📱 New device 192.168.100.11 joined")
+	next, cmd := model.switchView("timeline")
+	model = next.(Model)
+	next, _ = model.Update(cmd())
+	model = next.(Model)
+
+	view := model.View()
+	for _, want := range []string{"nat started en0 -> bridge100", "kill pid 42 failed", "dhcp restarted", "192.168.100.11 joined", "4 events"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("Expected %q in the timeline:\n%s", want, view)
+		}
+	}
+	if strings.Contains(view, "pfctl -e") {
+		t.Errorf("Successful system commands belong to the logs view:\n%s", view)
+	}
+	if strings.Index(view, "nat started") > strings.Index(view, "joined") {
+		t.Errorf("Expected the events in order:\n%s", view)
+	}
+
+	// Filter by source, then search
+	if model = pressKeys(model, keyRunes("f")); !strings.Contains(model.View(), "Source: nat | 2 events") {
+		t.Errorf("Expected the NAT events only:\n%s", model.View())
+	}
+	model = pressKeys(model, keyRunes("/"), keyRunes("dhcp"), tea.KeyMsg{Type: tea.KeyEnter})
+	if view := model.View(); !strings.Contains(view, "1 events") || strings.Contains(view, "nat started") {
+		t.Errorf("Expected the DHCP restart only:\n%s", view)
+	}
+}
+
+// BenchmarkConnectionMonitor pushes generated connection tables through the
+// connection monitor, from a new frame to the rendered view
+func BenchmarkConnectionMonitor(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			g := fake.New(1, "192.168.100")
+			devices := g.Devices(50)
+			connections := g.Connections(devices, n)
+			recording := &session.Session{
+				Header: session.Header{ExternalInterface: "en0", InternalInterface: "bridge100", InternalNetwork: "192.168.100"},
+			}
+			for i := 0; i < 2; i++ {
+				recording.Frames = append(recording.Frames, session.Frame{
+					Time:   fake.Epoch.Add(time.Duration(i) * time.Second),
+					Status: g.Status(devices, connections),
+				})
+				connections = g.Step(devices, connections)
+			}
+
+			app := NewApp(&config.Config{})
+			app.SetReplay(recording, 0)
+			model := app.initialModel().startReplay(*app.replay)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				model = model.showFrame(i % 2)
+				_ = model.View()
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package vmnet
+
+import (
+	"bufio"
+	"net"
+	"net/netip"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/fingerprint"
+)
+
+// Hypervisors whose networks are recognized
+const (
+	HypervisorFusion    = "VMware Fusion"
+	HypervisorParallels = "Parallels"
+	HypervisorUTM       = "UTM"
+	HypervisorLima      = "Lima"
+	HypervisorVMnet     = "vmnet" // Apple's Virtualization framework, any app
+)
+
+// FusionNetworking is the network configuration of VMware Fusion
+var FusionNetworking = "/Library/Preferences/VMware Fusion/networking"
+
+// parallelsNetworks are the default subnets of the Parallels networks
+var parallelsNetworks = map[netip.Prefix]string{
+	netip.MustParsePrefix("10.211.55.0/24"): "Shared",
+	netip.MustParsePrefix("10.37.129.0/24"): "Host-Only",
+}
+
+// vendorHypervisors are the hypervisors whose VMs have MAC addresses of an
+// OUI vendor
+var vendorHypervisors = map[string]string{
+	"VMware":    HypervisorFusion,
+	"Parallels": HypervisorParallels,
+	"QEMU":      HypervisorUTM,
+}
+
+// limaOUI starts the MAC addresses Lima gives its VMs
+const limaOUI = "52:55:55:"
+
+// HypervisorNetwork is a network a hypervisor shares with its VMs through a
+// vmnet bridge of the host
+type HypervisorNetwork struct {
+	Bridge     string       `json:"bridge"`
+	Hypervisor string       `json:"hypervisor"`
+	Name       string       `json:"name,omitempty"` // e.g. vmnet8 or Shared
+	Subnet     netip.Prefix `json:"subnet"`
+	Members    []string     `json:"members"` // VM interfaces, e.g. vmenet0
+}
+
+// Matches reports whether selector names n: its bridge, name, subnet, the
+// first three octets of its subnet or a word of its hypervisor (e.g.
+// vmware)
+func (n HypervisorNetwork) Matches(selector string) bool {
+	candidates := append([]string{n.Bridge, n.Name}, strings.Fields(n.Hypervisor)...)
+	if n.Subnet.IsValid() {
+		octets := strings.Split(n.Subnet.Addr().String(), ".")
+		candidates = append(candidates, n.Subnet.String(), strings.Join(octets[:3], "."))
+	}
+	for _, candidate := range candidates {
+		if candidate != "" && strings.EqualFold(candidate, selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps reports whether the subnet of n overlaps the /24 network with
+// the three-octet prefix network, such as the internal network
+func (n HypervisorNetwork) Overlaps(network string) bool {
+	prefix, err := netip.ParsePrefix(network + ".0/24")
+	return err == nil && n.Subnet.IsValid() && n.Subnet.Overlaps(prefix)
+}
+
+var fusionSubnetRe = regexp.MustCompile(`^answer VNET_(\d+)_HOSTONLY_(SUBNET|NETMASK) (\S+)$`)
+
+// ParseFusionNetworking parses the subnets of the vmnet networks of VMware
+// Fusion, such as vmnet8, out of its networking file
+func ParseFusionNetworking(content string) map[string]netip.Prefix {
+	subnets := make(map[string]string)
+	masks := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		// answer VNET_8_HOSTONLY_SUBNET 172.16.2.0
+		matches := fusionSubnetRe.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if matches == nil {
+			continue
+		}
+		if matches[2] == "SUBNET" {
+			subnets["vmnet"+matches[1]] = matches[3]
+		} else {
+			masks["vmnet"+matches[1]] = matches[3]
+		}
+	}
+	networks := make(map[string]netip.Prefix)
+	for name, address := range subnets {
+		addr, err := netip.ParseAddr(address)
+		if err != nil {
+			continue
+		}
+		ones := 24
+		if mask, err := netip.ParseAddr(masks[name]); err == nil && mask.Is4() {
+			ones, _ = net.IPMask(mask.AsSlice()).Size()
+		}
+		if prefix, err := addr.Prefix(ones); err == nil {
+			networks[name] = prefix
+		}
+	}
+	return networks
+}
+
+// classifyNetworks returns the bridges that share a hypervisor network
+// with VMs: those with vmenet members or the subnet of a Fusion or
+// Parallels network. learned holds the addresses each bridge learned.
+func classifyNetworks(bridges []Bridge, learned map[string]map[string]string, fusion map[string]netip.Prefix) []HypervisorNetwork {
+	networks := []HypervisorNetwork{}
+	for _, bridge := range bridges {
+		network := HypervisorNetwork{Bridge: bridge.Name, Subnet: bridge.Subnet, Members: []string{}}
+		for _, member := range bridge.Members {
+			if strings.HasPrefix(member, "vmenet") {
+				network.Members = append(network.Members, member)
+			}
+		}
+		for name, prefix := range fusion {
+			if prefix == bridge.Subnet {
+				network.Hypervisor, network.Name = HypervisorFusion, name
+			}
+		}
+		if name, ok := parallelsNetworks[bridge.Subnet]; ok && network.Hypervisor == "" {
+			network.Hypervisor, network.Name = HypervisorParallels, name
+		}
+		if len(network.Members) == 0 && network.Hypervisor == "" {
+			continue
+		}
+		if network.Hypervisor == "" {
+			network.Hypervisor = learnedHypervisor(learned[bridge.Name])
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// learnedHypervisor guesses the hypervisor running the VMs whose addresses
+// a bridge learned from the vendor of the addresses
+func learnedHypervisor(learned map[string]string) string {
+	for mac, member := range learned {
+		if !strings.HasPrefix(member, "vmenet") {
+			continue
+		}
+		if strings.HasPrefix(mac, limaOUI) {
+			return HypervisorLima
+		}
+		if hypervisor, ok := vendorHypervisors[fingerprint.Vendor(mac)]; ok {
+			return hypervisor
+		}
+	}
+	return HypervisorVMnet
+}
+
+// HypervisorNetworks returns the hypervisor networks of the host
+func HypervisorNetworks() ([]HypervisorNetwork, error) {
+	bridges, err := Bridges()
+	if err != nil {
+		return nil, err
+	}
+	learned := make(map[string]map[string]string)
+	for _, bridge := range bridges {
+		if output, err := exec.Command("ifconfig", bridge.Name, "addr").Output(); err == nil {
+			learned[bridge.Name] = ParseLearned(string(output))
+		}
+	}
+	var fusion map[string]netip.Prefix
+	if content, err := os.ReadFile(FusionNetworking); err == nil {
+		fusion = ParseFusionNetworking(string(content))
+	}
+	return classifyNetworks(bridges, learned, fusion), nil
+}
+
+// AttachNetwork moves the VM interfaces of n into bridge and returns them
+func AttachNetwork(n HypervisorNetwork, bridge string) ([]string, error) {
+	var moved []string
+	for _, member := range n.Members {
+		if err := Move(Location{Bridge: n.Bridge, Member: member}, bridge); err != nil {
+			return moved, err
+		}
+		moved = append(moved, member)
+	}
+	return moved, nil
+}
@@ -0,0 +1,195 @@
+package vmnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+)
+
+// Container runtimes whose VMs are found
+const (
+	RuntimeLima   = "lima"
+	RuntimeColima = "colima" // runs its VMs with Lima, under ~/.colima/_lima
+)
+
+// Runtimes lists the container runtimes whose VMs are found
+var Runtimes = []string{RuntimeLima, RuntimeColima}
+
+// Instance is a Lima VM, such as one Colima runs for Docker or containerd
+type Instance struct {
+	Name     string    `json:"name"`
+	Runtime  string    `json:"runtime"`
+	Status   string    `json:"status"`  // Running, Stopped or Broken
+	VMType   string    `json:"vm_type"` // qemu or vz
+	Networks []Network `json:"networks"`
+}
+
+// Network is an interface of a VM on a vmnet bridge of the host, through
+// socket_vmnet or Virtualization.framework's NAT
+type Network struct {
+	MAC       string `json:"mac"`
+	Interface string `json:"interface,omitempty"` // in the guest, e.g. lima0 or col0
+}
+
+// limaInstance is an instance as printed by 'limactl list --json'
+type limaInstance struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	VMType  string `json:"vmType"`
+	Network []struct {
+		MACAddress string `json:"macAddress"`
+		Interface  string `json:"interface"`
+	} `json:"network"`
+}
+
+// ParseLimaList parses the output of 'limactl list --json', a JSON object
+// per instance
+func ParseLimaList(r io.Reader, runtime string) ([]Instance, error) {
+	var instances []Instance
+	decoder := json.NewDecoder(r)
+	for decoder.More() {
+		var li limaInstance
+		if err := decoder.Decode(&li); err != nil {
+			return nil, fmt.Errorf("failed to parse limactl list: %w", err)
+		}
+		instance := Instance{Name: li.Name, Runtime: runtime, Status: li.Status, VMType: li.VMType, Networks: []Network{}}
+		for _, n := range li.Network {
+			if mac, ok := NormalizeMAC(n.MACAddress); ok {
+				instance.Networks = append(instance.Networks, Network{MAC: mac, Interface: n.Interface})
+			}
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+// limaHomes returns the Lima directories of each runtime that exist
+func limaHomes() map[string]string {
+	home, _ := os.UserHomeDir()
+	homes := map[string]string{
+		RuntimeLima:   os.Getenv("LIMA_HOME"),
+		RuntimeColima: os.Getenv("COLIMA_HOME"),
+	}
+	if homes[RuntimeLima] == "" {
+		homes[RuntimeLima] = filepath.Join(home, ".lima")
+	}
+	if homes[RuntimeColima] == "" {
+		homes[RuntimeColima] = filepath.Join(home, ".colima")
+	}
+	homes[RuntimeColima] = filepath.Join(homes[RuntimeColima], "_lima")
+	for runtime, dir := range homes {
+		if _, err := os.Stat(dir); err != nil {
+			delete(homes, runtime)
+		}
+	}
+	return homes
+}
+
+// Instances returns the Lima and Colima VMs of the user
+func Instances() ([]Instance, error) {
+	homes := limaHomes()
+	if len(homes) == 0 {
+		return []Instance{}, nil
+	}
+	if _, err := exec.LookPath("limactl"); err != nil {
+		return nil, fmt.Errorf("limactl not found (brew install lima)")
+	}
+	instances := []Instance{}
+	for _, runtime := range Runtimes {
+		home, ok := homes[runtime]
+		if !ok {
+			continue
+		}
+		output, err := userCommand(home, "limactl", "list", "--json").Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s VMs: %w", runtime, err)
+		}
+		found, err := ParseLimaList(bytes.NewReader(output), runtime)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, found...)
+	}
+	return instances, nil
+}
+
+// FindInstance returns the VM called name
+func FindInstance(name string) (Instance, error) {
+	instances, err := Instances()
+	if err != nil {
+		return Instance{}, err
+	}
+	for _, instance := range instances {
+		if instance.Name == name {
+			return instance, nil
+		}
+	}
+	return Instance{}, fmt.Errorf("no Lima or Colima VM named %s (see 'nat-manager containers list')", name)
+}
+
+// Renew makes the guest of the VM name of runtime ask for a new DHCP lease
+// on its interface iface, once the interface moved to another network
+func Renew(runtime, name, iface string) error {
+	homes := limaHomes()
+	home, ok := homes[runtime]
+	if !ok {
+		return fmt.Errorf("no %s directory", runtime)
+	}
+	script := fmt.Sprintf("networkctl renew %[1]s 2>/dev/null || (dhclient -r %[1]s && dhclient %[1]s) || udhcpc -n -q -i %[1]s", iface)
+	cmd := userCommand(home, "limactl", "shell", name, "sudo", "sh", "-c", script)
+	output, err := cmd.CombinedOutput()
+	audit.Command(cmd.Args, err)
+	if err != nil {
+		return fmt.Errorf("failed to renew the lease of %s: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// userCommand returns a command running limactl, which refuses to run as
+// root, as the owner of the home directory with LIMA_HOME set to home
+func userCommand(home, name string, args ...string) *exec.Cmd {
+	env := "LIMA_HOME=" + home
+	if os.Geteuid() == 0 {
+		if owner := homeOwner(); owner != "" && owner != "root" {
+			return exec.Command("sudo", append([]string{"-u", owner, "env", env, name}, args...)...)
+		}
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), env)
+	return cmd
+}
+
+// homeOwner returns the user who ran sudo, else the owner of the home
+// directory, as for the daemon
+func homeOwner() string {
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	info, err := os.Stat(home)
+	if err != nil {
+		return ""
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	owner, err := user.LookupId(strconv.FormatUint(uint64(stat.Uid), 10))
+	if err != nil {
+		return ""
+	}
+	return owner.Username
+}
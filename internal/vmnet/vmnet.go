@@ -0,0 +1,187 @@
+// Package vmnet finds the virtual machines that reach the host through
+// bridges of Apple's vmnet framework, such as the Lima and Colima VMs
+// running containers and the networks of UTM, VMware Fusion and Parallels,
+// and moves their interfaces into the managed bridge
+package vmnet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+)
+
+// Bridge is a bridge interface of the host with its members
+type Bridge struct {
+	Name    string       `json:"name"`
+	Address string       `json:"address,omitempty"` // IPv4 address, if any
+	Subnet  netip.Prefix `json:"subnet"`            // of the address
+	Members []string     `json:"members"`           // e.g. vmenet0 for a VM, en1
+}
+
+// ParseBridges parses the bridges out of the output of 'ifconfig -a'
+func ParseBridges(output string) []Bridge {
+	var bridges []Bridge
+	var current *Bridge
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" && line[0] != ' ' && line[0] != '\t' {
+			current = nil
+			// bridge100: flags=8863<UP,BROADCAST,...> mtu 1500
+			name, _, ok := strings.Cut(line, ":")
+			if ok && strings.HasPrefix(name, "bridge") {
+				bridges = append(bridges, Bridge{Name: name, Members: []string{}})
+				current = &bridges[len(bridges)-1]
+			}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 2 && fields[0] == "inet" && current.Address == "":
+			// inet 192.168.64.1 netmask 0xffffff00 broadcast 192.168.64.255
+			current.Address = fields[1]
+			if len(fields) >= 4 && fields[2] == "netmask" {
+				current.Subnet = subnet(fields[1], fields[3])
+			}
+		case len(fields) >= 2 && fields[0] == "member:":
+			current.Members = append(current.Members, fields[1])
+		}
+	}
+	return bridges
+}
+
+// subnet returns the network of address with the hexadecimal netmask
+// ifconfig prints, or the zero prefix
+func subnet(address, netmask string) netip.Prefix {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return netip.Prefix{}
+	}
+	mask, err := strconv.ParseUint(strings.TrimPrefix(netmask, "0x"), 16, 32)
+	if err != nil {
+		return netip.Prefix{}
+	}
+	ones, bits := net.IPMask(binary.BigEndian.AppendUint32(nil, uint32(mask))).Size()
+	if bits == 0 {
+		return netip.Prefix{}
+	}
+	prefix, _ := addr.Prefix(ones)
+	return prefix
+}
+
+// ParseLearned parses the addresses a bridge learned, and the member each
+// was learned on, out of the output of 'ifconfig <bridge> addr'
+func ParseLearned(output string) map[string]string {
+	learned := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		// 52:55:55:a:b:c Vlan1 vmenet0 1185 flags=0<>
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || !strings.HasPrefix(fields[1], "Vlan") {
+			continue
+		}
+		if mac, ok := NormalizeMAC(fields[0]); ok {
+			learned[mac] = fields[2]
+		}
+	}
+	return learned
+}
+
+// NormalizeMAC pads the octets of a MAC address as printed by ifconfig
+// and arp, which drop leading zeros
+func NormalizeMAC(mac string) (string, bool) {
+	octets := strings.Split(strings.ToLower(mac), ":")
+	if len(octets) != 6 {
+		return "", false
+	}
+	for i, octet := range octets {
+		if len(octet) == 1 {
+			octets[i] = "0" + octet
+		}
+	}
+	hw, err := net.ParseMAC(strings.Join(octets, ":"))
+	if err != nil {
+		return "", false
+	}
+	return hw.String(), true
+}
+
+// Bridges returns the bridges of the host
+func Bridges() ([]Bridge, error) {
+	output, err := exec.Command("ifconfig", "-a").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	return ParseBridges(string(output)), nil
+}
+
+// Location is the bridge member a VM's interface is attached to
+type Location struct {
+	Bridge string `json:"bridge"`
+	Member string `json:"member"`
+}
+
+// Locate returns where the interface with MAC address mac is attached,
+// from the addresses the bridges learned. A VM is only found once it sent
+// something, which it does when it boots.
+func Locate(mac string) (Location, error) {
+	mac, ok := NormalizeMAC(mac)
+	if !ok {
+		return Location{}, fmt.Errorf("invalid MAC address %q", mac)
+	}
+	bridges, err := Bridges()
+	if err != nil {
+		return Location{}, err
+	}
+	for _, bridge := range bridges {
+		output, err := exec.Command("ifconfig", bridge.Name, "addr").Output()
+		if err != nil {
+			continue
+		}
+		if member, ok := ParseLearned(string(output))[mac]; ok {
+			return Location{Bridge: bridge.Name, Member: member}, nil
+		}
+	}
+	return Location{}, fmt.Errorf("%s was not seen on any bridge (is the VM running with a vmnet network?)", mac)
+}
+
+// Move takes the member of loc out of its bridge and adds it to bridge
+func Move(loc Location, bridge string) error {
+	if loc.Bridge == bridge {
+		return nil
+	}
+	if err := run("ifconfig", loc.Bridge, "deletem", loc.Member); err != nil {
+		return err
+	}
+	if err := run("ifconfig", bridge, "addm", loc.Member); err != nil {
+		// put it back rather than leave the VM without a network
+		_ = run("ifconfig", loc.Bridge, "addm", loc.Member)
+		return err
+	}
+	return nil
+}
+
+// Remove takes member out of bridge
+func Remove(bridge, member string) error {
+	return run("ifconfig", bridge, "deletem", member)
+}
+
+// run runs a command that changes the machine, auditing it
+func run(args ...string) error {
+	output, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	audit.Command(args, err)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
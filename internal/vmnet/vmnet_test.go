@@ -0,0 +1,184 @@
+package vmnet
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+const ifconfigOutput = `lo0: flags=8049<UP,LOOPBACK,RUNNING,MULTICAST> mtu 16384
+	inet 127.0.0.1 netmask 0xff000000
+en0: flags=8863<UP,BROADCAST,SMART,RUNNING,SIMPLEX,MULTICAST> mtu 1500
+	ether 3c:22:fb:01:02:03
+	inet 192.168.1.20 netmask 0xffffff00 broadcast 192.168.1.255
+vmenet0: flags=8963<UP,BROADCAST,SMART,RUNNING,PROMISC,SIMPLEX,MULTICAST> mtu 1500
+	ether 9a:1b:2c:3d:4e:5f
+bridge100: flags=8a63<UP,BROADCAST,SMART,RUNNING,ALLMULTI,SIMPLEX,MULTICAST> mtu 1500
+	options=3<RXCSUM,TXCSUM>
+	ether 3e:22:fb:01:02:64
+	inet 192.168.105.1 netmask 0xffffff00 broadcast 192.168.105.255
+	inet6 fe80::3c22:fbff:fe01:264%bridge100 prefixlen 64 scopeid 0x15
+	Configuration:
+		id 0:0:0:0:0:0 priority 0 hellotime 0 fwddelay 0
+	member: vmenet0 flags=3<LEARNING,DISCOVER>
+	        ifmaxaddr 0 port 20 priority 0 path cost 0
+	status: active
+bridge0: flags=8863<UP,BROADCAST,SMART,RUNNING,SIMPLEX,MULTICAST> mtu 1500
+	ether 3e:22:fb:01:02:00
+	member: en1 flags=3<LEARNING,DISCOVER>
+	member: en2 flags=3<LEARNING,DISCOVER>
+	status: inactive
+`
+
+func TestParseBridges(t *testing.T) {
+	bridges := ParseBridges(ifconfigOutput)
+	if len(bridges) != 2 {
+		t.Fatalf("Expected 2 bridges, got %+v", bridges)
+	}
+	if b := bridges[0]; b.Name != "bridge100" || b.Address != "192.168.105.1" || b.Subnet.String() != "192.168.105.0/24" ||
+		strings.Join(b.Members, ",") != "vmenet0" {
+		t.Errorf("bridges[0] = %+v", b)
+	}
+	if b := bridges[1]; b.Name != "bridge0" || b.Address != "" || b.Subnet.IsValid() || strings.Join(b.Members, ",") != "en1,en2" {
+		t.Errorf("bridges[1] = %+v", b)
+	}
+	if bridges := ParseBridges(""); len(bridges) != 0 {
+		t.Errorf("ParseBridges of nothing = %+v", bridges)
+	}
+}
+
+func TestParseLearned(t *testing.T) {
+	output := `52:55:55:a:b:c Vlan1 vmenet0 1185 flags=0<>
+3c:22:fb:1:2:3 Vlan1 en1 300 flags=0<>
+`
+	learned := ParseLearned(output)
+	if len(learned) != 2 || learned["52:55:55:0a:0b:0c"] != "vmenet0" || learned["3c:22:fb:01:02:03"] != "en1" {
+		t.Errorf("ParseLearned = %v", learned)
+	}
+	if learned := ParseLearned("bridge100: no addresses\n"); len(learned) != 0 {
+		t.Errorf("ParseLearned = %v", learned)
+	}
+}
+
+func TestNormalizeMAC(t *testing.T) {
+	testCases := []struct {
+		mac      string
+		expected string
+		valid    bool
+	}{
+		{"52:55:55:a:b:c", "52:55:55:0a:0b:0c", true},
+		{"52:55:55:0A:0B:0C", "52:55:55:0a:0b:0c", true},
+		{"52:55:55:0a:0b", "", false},
+		{"52:55:55:0a:0b:zz", "", false},
+		{"", "", false},
+	}
+	for _, tc := range testCases {
+		mac, ok := NormalizeMAC(tc.mac)
+		if mac != tc.expected || ok != tc.valid {
+			t.Errorf("NormalizeMAC(%q) = %q, %t", tc.mac, mac, ok)
+		}
+	}
+}
+
+func TestParseLimaList(t *testing.T) {
+	output := `{"name":"colima","status":"Running","vmType":"vz","network":[{"vzNAT":true,"macAddress":"52:55:55:a:b:c","interface":"col0"}]}
+{"name":"default","status":"Stopped","vmType":"qemu","network":null}
+`
+	instances, err := ParseLimaList(strings.NewReader(output), RuntimeColima)
+	if err != nil {
+		t.Fatalf("ParseLimaList failed: %v", err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("Expected 2 instances, got %+v", instances)
+	}
+	colima := instances[0]
+	if colima.Name != "colima" || colima.Runtime != RuntimeColima || colima.Status != "Running" || colima.VMType != "vz" ||
+		len(colima.Networks) != 1 || colima.Networks[0] != (Network{MAC: "52:55:55:0a:0b:0c", Interface: "col0"}) {
+		t.Errorf("instances[0] = %+v", colima)
+	}
+	if len(instances[1].Networks) != 0 {
+		t.Errorf("instances[1] = %+v", instances[1])
+	}
+
+	if _, err := ParseLimaList(strings.NewReader("{broken"), RuntimeLima); err == nil {
+		t.Error("ParseLimaList should reject malformed output")
+	}
+}
+
+func TestParseFusionNetworking(t *testing.T) {
+	content := `VERSION=1,0
+answer VNET_1_DHCP yes
+answer VNET_1_HOSTONLY_NETMASK 255.255.255.0
+answer VNET_1_HOSTONLY_SUBNET 192.168.143.0
+answer VNET_8_DHCP yes
+answer VNET_8_HOSTONLY_NETMASK 255.255.0.0
+answer VNET_8_HOSTONLY_SUBNET 172.16.2.0
+answer VNET_8_NAT yes
+answer VNET_9_HOSTONLY_SUBNET not-an-address
+`
+	networks := ParseFusionNetworking(content)
+	if len(networks) != 2 || networks["vmnet1"].String() != "192.168.143.0/24" || networks["vmnet8"].String() != "172.16.0.0/16" {
+		t.Errorf("ParseFusionNetworking = %v", networks)
+	}
+}
+
+func TestClassifyNetworks(t *testing.T) {
+	bridges := []Bridge{
+		{Name: "bridge0", Members: []string{"en1", "en2"}},
+		{Name: "bridge100", Subnet: netip.MustParsePrefix("192.168.64.0/24"), Members: []string{"vmenet0", "vmenet1"}},
+		{Name: "bridge101", Subnet: netip.MustParsePrefix("10.211.55.0/24"), Members: []string{}},
+		{Name: "bridge102", Subnet: netip.MustParsePrefix("172.16.2.0/24"), Members: []string{"vmenet2"}},
+		{Name: "bridge103", Subnet: netip.MustParsePrefix("192.168.105.0/24"), Members: []string{"vmenet3"}},
+	}
+	learned := map[string]map[string]string{
+		"bridge100": {"52:54:00:12:34:56": "vmenet1"},
+		"bridge103": {"52:55:55:0a:0b:0c": "vmenet3"},
+	}
+	fusion := map[string]netip.Prefix{"vmnet8": netip.MustParsePrefix("172.16.2.0/24")}
+
+	networks := classifyNetworks(bridges, learned, fusion)
+	expected := []struct {
+		bridge, hypervisor, name, members string
+	}{
+		{"bridge100", HypervisorUTM, "", "vmenet0,vmenet1"},
+		{"bridge101", HypervisorParallels, "Shared", ""},
+		{"bridge102", HypervisorFusion, "vmnet8", "vmenet2"},
+		{"bridge103", HypervisorLima, "", "vmenet3"},
+	}
+	if len(networks) != len(expected) {
+		t.Fatalf("Expected %d networks, got %+v", len(expected), networks)
+	}
+	for i, e := range expected {
+		n := networks[i]
+		if n.Bridge != e.bridge || n.Hypervisor != e.hypervisor || n.Name != e.name || strings.Join(n.Members, ",") != e.members {
+			t.Errorf("networks[%d] = %+v", i, n)
+		}
+	}
+
+	if networks := classifyNetworks(bridges[:1], nil, nil); len(networks) != 0 {
+		t.Errorf("A bridge without VMs is no hypervisor network: %+v", networks)
+	}
+	bridges[1].Members = []string{"vmenet0"}
+	if networks := classifyNetworks(bridges[1:2], nil, nil); len(networks) != 1 || networks[0].Hypervisor != HypervisorVMnet {
+		t.Errorf("Unknown VMs should be on a vmnet network: %+v", networks)
+	}
+}
+
+func TestHypervisorNetworkMatches(t *testing.T) {
+	network := HypervisorNetwork{
+		Bridge:     "bridge102",
+		Hypervisor: HypervisorFusion,
+		Name:       "vmnet8",
+		Subnet:     netip.MustParsePrefix("172.16.2.0/24"),
+	}
+	for _, selector := range []string{"bridge102", "vmnet8", "VMware", "fusion", "172.16.2.0/24", "172.16.2"} {
+		if !network.Matches(selector) {
+			t.Errorf("%s should match", selector)
+		}
+	}
+	for _, selector := range []string{"", "bridge100", "vmnet1", "parallels", "172.16"} {
+		if network.Matches(selector) {
+			t.Errorf("%s should not match", selector)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package webhook posts events as JSON to configured URLs, retrying failed
+// deliveries and signing payloads with HMAC-SHA256
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+)
+
+// Request headers of deliveries
+const (
+	EventHeader     = "X-NAT-Manager-Event"
+	TimestampHeader = "X-NAT-Manager-Timestamp" // Unix time the delivery was signed at
+	SignatureHeader = "X-NAT-Manager-Signature" // "sha256=" and the hex HMAC of the timestamp, "." and the body
+)
+
+// Tolerance is how far the timestamp of a delivery may be from the clock of
+// its receiver. Receivers should reject older deliveries, which may be
+// replayed.
+const Tolerance = 5 * time.Minute
+
+// Delivery limits
+const (
+	attempts       = 4
+	defaultBackoff = time.Second // before the first retry, doubled for each next one
+	requestTimeout = 10 * time.Second
+)
+
+// Hook is a URL receiving events
+type Hook struct {
+	URL    string
+	Secret string   // signs payloads when set
+	Events []string // event types sent, all if empty
+}
+
+// Wants reports whether the hook receives events of typ
+func (h Hook) Wants(typ string) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, typ)
+}
+
+// Notifier delivers events to hooks in the background. It is an
+// event.Sink.
+type Notifier struct {
+	hooks   []Hook
+	client  *http.Client
+	backoff time.Duration
+	onError func(url string, err error)
+	wg      sync.WaitGroup
+}
+
+var _ event.Sink = (*Notifier)(nil)
+
+// New returns a notifier delivering to hooks. onError, when set, is told
+// about deliveries that failed every attempt.
+func New(hooks []Hook, onError func(url string, err error)) *Notifier {
+	return &Notifier{
+		hooks:   hooks,
+		client:  &http.Client{Timeout: requestTimeout},
+		backoff: defaultBackoff,
+		onError: onError,
+	}
+}
+
+// Send delivers e to the hooks that want it in the background
+func (n *Notifier) Send(e event.Event) {
+	for _, hook := range n.hooks {
+		if !hook.Wants(e.Type) {
+			continue
+		}
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			if err := n.Deliver(context.Background(), hook, e); err != nil && n.onError != nil {
+				n.onError(hook.URL, err)
+			}
+		}()
+	}
+}
+
+// Close waits until the deliveries in progress end or ctx is done
+func (n *Notifier) Close(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook deliveries still pending: %w", ctx.Err())
+	}
+}
+
+// Deliver posts e to hook, retrying with growing delays when the request
+// fails or the server answers with a 5xx, 408 or 429 status
+func (n *Notifier) Deliver(ctx context.Context, hook Hook, e event.Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	delay := n.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(ctx, hook, e.Type, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt == attempts {
+			return fmt.Errorf("failed to deliver %s to %s after %d attempts: %w", e.Type, hook.URL, attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends a single delivery and reports whether a failure is worth
+// retrying
+func (n *Notifier) post(ctx context.Context, hook Hook, typ string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "nat-manager")
+	req.Header.Set(EventHeader, typ)
+	if hook.Secret != "" {
+		// every attempt is signed anew, so retries are not taken for replays
+		timestamp := time.Now().Unix()
+		req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, timestamp, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return true, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("server answered %s", resp.Status)
+}
+
+// Sign returns the signature of body sent at timestamp with secret as sent
+// in SignatureHeader
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a delivery of body
+// received at now, as a receiver written in Go would
+func Verify(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header: %w", TimestampHeader, err)
+	}
+	if age := now.Sub(time.Unix(timestamp, 0)); age > Tolerance || age < -Tolerance {
+		return fmt.Errorf("delivery signed %s ago, outside the tolerance of %s", age.Round(time.Second), Tolerance)
+	}
+	if !hmac.Equal([]byte(header.Get(SignatureHeader)), []byte(Sign(secret, timestamp, body))) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
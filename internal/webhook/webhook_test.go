@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/event"
+)
+
+func TestSign(t *testing.T) {
+	// Known HMAC-SHA256 of "1700000000.hello" with key "secret"
+	const expected = "sha256=47b1df0ab12338b2685470b0d2b37033add7c3b2bc8172f313e77413f1bb78c8"
+	if got := Sign("secret", 1700000000, []byte("hello")); got != expected {
+		t.Errorf("Sign = %s, expected %s", got, expected)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	signed := time.Unix(1700000000, 0)
+	header := http.Header{}
+	header.Set(TimestampHeader, "1700000000")
+	header.Set(SignatureHeader, Sign("secret", signed.Unix(), []byte("hello")))
+
+	if err := Verify("secret", header, []byte("hello"), signed.Add(Tolerance)); err != nil {
+		t.Errorf("Verify within the tolerance failed: %v", err)
+	}
+	if err := Verify("secret", header, []byte("hello"), signed.Add(Tolerance+time.Second)); err == nil {
+		t.Error("Verify should reject deliveries older than the tolerance")
+	}
+	if err := Verify("secret", header, []byte("hello!"), signed); err == nil {
+		t.Error("Verify should reject a changed body")
+	}
+	header.Set(TimestampHeader, "1700000001")
+	if err := Verify("secret", header, []byte("hello"), signed); err == nil {
+		t.Error("Verify should reject a changed timestamp")
+	}
+}
+
+func TestWants(t *testing.T) {
+	all := Hook{URL: "https://example.com"}
+	some := Hook{URL: "https://example.com", Events: []string{event.NATStarted}}
+	if !all.Wants(event.DeviceJoined) || !some.Wants(event.NATStarted) || some.Wants(event.DeviceJoined) {
+		t.Error("Hooks should receive all events or only the listed ones")
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	status := []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify("s3cret", r.Header, body, time.Now()); err != nil {
+			t.Errorf("Bad signature %q: %v", r.Header.Get(SignatureHeader), err)
+		}
+		if r.Header.Get(EventHeader) != event.NATStarted {
+			t.Errorf("Event header = %q", r.Header.Get(EventHeader))
+		}
+		w.WriteHeader(status[len(bodies)])
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+
+	n := New(nil, nil)
+	n.backoff = time.Millisecond
+	e := event.Event{Type: event.NATStarted, Instance: "default", Data: map[string]string{"external": "en0"}}
+	if err := n.Deliver(context.Background(), Hook{URL: server.URL, Secret: "s3cret"}, e); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	if len(bodies) != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", len(bodies))
+	}
+	var got event.Event
+	if err := json.Unmarshal(bodies[2], &got); err != nil || got.Type != event.NATStarted || got.Data["external"] != "en0" {
+		t.Errorf("Payload = %s, %v", bodies[2], err)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	attemptsMade := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attemptsMade++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	var failed []string
+	n := New([]Hook{{URL: server.URL}}, func(url string, _ error) { failed = append(failed, url) })
+	n.backoff = time.Millisecond
+	n.Send(event.Event{Type: event.DeviceLeft})
+	if err := n.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if attemptsMade != 1 {
+		t.Errorf("Client errors should not be retried, got %d attempts", attemptsMade)
+	}
+	if len(failed) != 1 || failed[0] != server.URL {
+		t.Errorf("Expected the failure reported, got %v", failed)
+	}
+}
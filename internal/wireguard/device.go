@@ -0,0 +1,182 @@
+package wireguard
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/scttfrdmn/macos-nat-manager/internal/audit"
+)
+
+// RunDir holds the control sockets of wireguard-go and the names of the
+// interfaces of the endpoints
+var RunDir = "/var/run/wireguard"
+
+// Binaries are the tools running the endpoint, from the wireguard-go and
+// wireguard-tools Homebrew formulas
+var Binaries = []string{"wireguard-go", "wg"}
+
+// ErrNotRunning is returned for a device that is not up
+var ErrNotRunning = errors.New("WireGuard endpoint is not running")
+
+// Device is an endpoint run by wireguard-go on the next free utun
+// interface, found again by name across commands
+type Device struct {
+	Name string // e.g. nat-manager
+}
+
+// nameFile is where wireguard-go writes the utun interface of d
+func (d Device) nameFile() string {
+	return filepath.Join(RunDir, d.Name+".name")
+}
+
+// Interface returns the utun interface of d while it runs
+func (d Device) Interface() (string, bool) {
+	data, err := os.ReadFile(d.nameFile())
+	iface := strings.TrimSpace(string(data))
+	if err != nil || iface == "" {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(RunDir, iface+".sock")); err != nil {
+		return "", false
+	}
+	return iface, true
+}
+
+// Up starts d with server's keys and peers and assigns it address, routing
+// the peers' network through it. A running device only gets the new
+// configuration.
+func (d Device) Up(server Server, address netip.Prefix) (string, error) {
+	if iface, ok := d.Interface(); ok {
+		return iface, Sync(iface, server)
+	}
+	if err := os.MkdirAll(RunDir, 0755); err != nil {
+		return "", err
+	}
+	cmd := exec.Command("wireguard-go", "utun")
+	cmd.Env = append(os.Environ(), "WG_TUN_NAME_FILE="+d.nameFile())
+	output, err := cmd.CombinedOutput()
+	audit.Command(cmd.Args, err)
+	if err != nil {
+		return "", fmt.Errorf("failed to start wireguard-go: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	iface, ok := d.Interface()
+	if !ok {
+		return "", fmt.Errorf("wireguard-go did not report its interface")
+	}
+
+	steps := [][]string{
+		{"ifconfig", iface, "inet", address.String(), address.Addr().String(), "alias"},
+		{"ifconfig", iface, "mtu", strconv.Itoa(MTU)},
+		{"ifconfig", iface, "up"},
+		{"route", "-q", "-n", "add", "-inet", address.Masked().String(), "-interface", iface},
+	}
+	err = Sync(iface, server)
+	for _, step := range steps {
+		if err != nil {
+			break
+		}
+		err = run(step...)
+	}
+	if err != nil {
+		_ = d.Down()
+		return "", err
+	}
+	return iface, nil
+}
+
+// Down stops d, which removes its interface and routes
+func (d Device) Down() error {
+	iface, ok := d.Interface()
+	if !ok {
+		return ErrNotRunning
+	}
+	// wireguard-go exits when its control socket goes away
+	err := os.Remove(filepath.Join(RunDir, iface+".sock"))
+	audit.Change("stop", "wireguard-go "+iface, err)
+	if err != nil {
+		return fmt.Errorf("failed to stop wireguard-go: %w", err)
+	}
+	_ = os.Remove(d.nameFile())
+	return nil
+}
+
+// Sync replaces the keys and peers of the running interface iface with
+// server's, keeping the sessions of unchanged peers
+func Sync(iface string, server Server) error {
+	file, err := os.CreateTemp("", "nat-manager-wg-*.conf")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+	if _, err := file.WriteString(server.Config()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return run("wg", "syncconf", iface, file.Name())
+}
+
+// PeerStatus is the state of a peer of a running interface
+type PeerStatus struct {
+	PublicKey     Key
+	Endpoint      string    // where the peer last connected from, if ever
+	LastHandshake time.Time // zero before the first handshake
+	Received      uint64    // bytes
+	Sent          uint64
+}
+
+// Show returns the state of the peers of the running interface iface
+func Show(iface string) ([]PeerStatus, error) {
+	output, err := exec.Command("wg", "show", iface, "dump").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run wg show: %w", err)
+	}
+	return ParseDump(string(output))
+}
+
+// ParseDump parses the peers out of the output of 'wg show <iface> dump':
+// a line for the interface, then a tab-separated line per peer
+func ParseDump(dump string) ([]PeerStatus, error) {
+	lines := strings.Split(strings.TrimSpace(dump), "\n")
+	var peers []PeerStatus
+	for _, line := range lines[min(1, len(lines)):] {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 8 {
+			return nil, fmt.Errorf("unexpected wg dump line %q", line)
+		}
+		key, err := ParseKey(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		peer := PeerStatus{PublicKey: key}
+		if fields[2] != "(none)" {
+			peer.Endpoint = fields[2]
+		}
+		if handshake, _ := strconv.ParseInt(fields[4], 10, 64); handshake > 0 {
+			peer.LastHandshake = time.Unix(handshake, 0)
+		}
+		peer.Received, _ = strconv.ParseUint(fields[5], 10, 64)
+		peer.Sent, _ = strconv.ParseUint(fields[6], 10, 64)
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// run runs a command that changes the machine, auditing it
+func run(args ...string) error {
+	output, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+	audit.Command(args, err)
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+// Package wireguard runs a WireGuard endpoint on a utun interface, through
+// wireguard-go and wg, so remote peers can reach the internal network
+package wireguard
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Defaults of the endpoint
+const (
+	DefaultPort    = 51820
+	DefaultNetwork = "10.8.0" // /24 of the peers, the endpoint being .1
+	KeepAlive      = 25       // seconds between the keepalives of clients behind NAT
+	MTU            = 1420
+)
+
+// Key is a Curve25519 private or public key, or a preshared key
+type Key [32]byte
+
+// GenerateKey returns a new private key
+func GenerateKey() (Key, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key(private.Bytes()), nil
+}
+
+// GeneratePresharedKey returns a new random preshared key
+func GeneratePresharedKey() (Key, error) {
+	var k Key
+	_, err := rand.Read(k[:])
+	return k, err
+}
+
+// ParseKey parses a key in base64, as wg prints them
+func ParseKey(s string) (Key, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(data) != len(Key{}) {
+		return Key{}, fmt.Errorf("invalid WireGuard key %q", s)
+	}
+	return Key(data), nil
+}
+
+// String returns k in base64
+func (k Key) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+// IsZero reports whether k is unset
+func (k Key) IsZero() bool {
+	return k == Key{}
+}
+
+// PublicKey returns the public key of private key k
+func (k Key) PublicKey() Key {
+	private, err := ecdh.X25519().NewPrivateKey(k[:])
+	if err != nil {
+		// only fails for keys that are not 32 bytes
+		panic(err)
+	}
+	return Key(private.PublicKey().Bytes())
+}
+
+// Peer is a remote device allowed to connect, with its address in the
+// peers' network
+type Peer struct {
+	Name         string
+	PublicKey    Key
+	PresharedKey Key // none when zero
+	Address      netip.Addr
+}
+
+// Server is the configuration of the endpoint
+type Server struct {
+	PrivateKey Key
+	Port       int
+	Peers      []Peer
+}
+
+// Config renders s in the format of 'wg setconf'
+func (s Server) Config() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Interface]\nPrivateKey = %s\nListenPort = %d\n", s.PrivateKey, s.Port)
+	for _, p := range s.Peers {
+		fmt.Fprintf(&b, "\n[Peer]\n# %s\nPublicKey = %s\n", p.Name, p.PublicKey)
+		if !p.PresharedKey.IsZero() {
+			fmt.Fprintf(&b, "PresharedKey = %s\n", p.PresharedKey)
+		}
+		fmt.Fprintf(&b, "AllowedIPs = %s\n", netip.PrefixFrom(p.Address, 32))
+	}
+	return b.String()
+}
+
+// Client is the configuration of a peer connecting to the endpoint
+type Client struct {
+	PrivateKey   Key // left out when zero, for peers that brought their own key
+	Address      netip.Addr
+	DNS          []string
+	ServerKey    Key // public key of the endpoint
+	PresharedKey Key
+	Endpoint     string // host the peer reaches the endpoint at
+	Port         int
+	AllowedIPs   []netip.Prefix // routed through the tunnel
+}
+
+// Config renders c in the format of wg-quick and the WireGuard apps
+func (c Client) Config() string {
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	if !c.PrivateKey.IsZero() {
+		fmt.Fprintf(&b, "PrivateKey = %s\n", c.PrivateKey)
+	}
+	fmt.Fprintf(&b, "Address = %s\n", netip.PrefixFrom(c.Address, 32))
+	if len(c.DNS) > 0 {
+		fmt.Fprintf(&b, "DNS = %s\n", strings.Join(c.DNS, ", "))
+	}
+	fmt.Fprintf(&b, "\n[Peer]\nPublicKey = %s\n", c.ServerKey)
+	if !c.PresharedKey.IsZero() {
+		fmt.Fprintf(&b, "PresharedKey = %s\n", c.PresharedKey)
+	}
+	fmt.Fprintf(&b, "Endpoint = %s\n", net.JoinHostPort(c.Endpoint, strconv.Itoa(c.Port)))
+	allowed := make([]string, 0, len(c.AllowedIPs))
+	for _, prefix := range c.AllowedIPs {
+		allowed = append(allowed, prefix.String())
+	}
+	fmt.Fprintf(&b, "AllowedIPs = %s\nPersistentKeepalive = %d\n", strings.Join(allowed, ", "), KeepAlive)
+	return b.String()
+}
+
+// Prefix returns the /24 of a network prefix such as 10.8.0
+func Prefix(network string) (netip.Prefix, error) {
+	addr, err := netip.ParseAddr(network + ".0")
+	if err != nil || !addr.Is4() || strings.Count(network, ".") != 2 {
+		return netip.Prefix{}, fmt.Errorf("invalid network %q (e.g. %s)", network, DefaultNetwork)
+	}
+	return netip.PrefixFrom(addr, 24), nil
+}
+
+// Gateway returns the address of the endpoint in network, its .1
+func Gateway(network netip.Prefix) netip.Addr {
+	return network.Addr().Next()
+}
+
+// NextAddress returns the first address of network, after the endpoint's,
+// that no peer uses
+func NextAddress(network netip.Prefix, peers []Peer) (netip.Addr, error) {
+	used := make(map[netip.Addr]bool)
+	for _, p := range peers {
+		used[p.Address] = true
+	}
+	for addr := Gateway(network).Next(); network.Contains(addr); addr = addr.Next() {
+		if addr.As4()[3] == 255 {
+			break
+		}
+		if !used[addr] {
+			return addr, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("no address left in %s", network)
+}
@@ -0,0 +1,174 @@
+package wireguard
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	// RFC 7748 section 6.1
+	private, _ := hex.DecodeString("77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a")
+	public, _ := hex.DecodeString("8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a")
+	if got := Key(private).PublicKey(); got != Key(public) {
+		t.Errorf("PublicKey = %x", got)
+	}
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	parsed, err := ParseKey(key.String())
+	if err != nil || parsed != key {
+		t.Errorf("ParseKey(%s) = %s, %v", key, parsed, err)
+	}
+	if key.IsZero() || key.PublicKey() == key {
+		t.Error("Generated keys should be set and differ from their public key")
+	}
+	for _, s := range []string{"", "not base64!", "AAAA"} {
+		if _, err := ParseKey(s); err == nil {
+			t.Errorf("ParseKey(%q) should fail", s)
+		}
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	server := Server{
+		PrivateKey: Key{1},
+		Port:       51820,
+		Peers: []Peer{
+			{Name: "laptop", PublicKey: Key{2}, PresharedKey: Key{3}, Address: netip.MustParseAddr("10.8.0.2")},
+			{Name: "phone", PublicKey: Key{4}, Address: netip.MustParseAddr("10.8.0.3")},
+		},
+	}
+	config := server.Config()
+	expected := []string{
+		fmt.Sprintf("[Interface]\nPrivateKey = %s\nListenPort = 51820\n", Key{1}),
+		fmt.Sprintf("[Peer]\n# laptop\nPublicKey = %s\nPresharedKey = %s\nAllowedIPs = 10.8.0.2/32\n", Key{2}, Key{3}),
+		fmt.Sprintf("[Peer]\n# phone\nPublicKey = %s\nAllowedIPs = 10.8.0.3/32\n", Key{4}),
+	}
+	for _, part := range expected {
+		if !strings.Contains(config, part) {
+			t.Errorf("Expected %q in:\n%s", part, config)
+		}
+	}
+	if strings.Contains(config, "Address") {
+		t.Error("wg setconf does not accept addresses")
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	client := Client{
+		PrivateKey:   Key{1},
+		Address:      netip.MustParseAddr("10.8.0.2"),
+		ServerKey:    Key{2},
+		PresharedKey: Key{3},
+		Endpoint:     "lab.example.com",
+		Port:         51820,
+		AllowedIPs:   []netip.Prefix{netip.MustParsePrefix("10.8.0.0/24"), netip.MustParsePrefix("192.168.100.0/24")},
+	}
+	config := client.Config()
+	expected := fmt.Sprintf("[Interface]\nPrivateKey = %s\nAddress = 10.8.0.2/32\n\n"+
+		"[Peer]\nPublicKey = %s\nPresharedKey = %s\n"+
+		"Endpoint = lab.example.com:51820\nAllowedIPs = 10.8.0.0/24, 192.168.100.0/24\nPersistentKeepalive = 25\n", Key{1}, Key{2}, Key{3})
+	if config != expected {
+		t.Errorf("Config =\n%s\nexpected\n%s", config, expected)
+	}
+
+	client.PrivateKey = Key{}
+	client.Endpoint = "2001:db8::1"
+	config = client.Config()
+	if strings.Contains(config, "PrivateKey") || !strings.Contains(config, "Endpoint = [2001:db8::1]:51820\n") {
+		t.Errorf("Config =\n%s", config)
+	}
+}
+
+func TestNextAddress(t *testing.T) {
+	network, err := Prefix("10.8.0")
+	if err != nil {
+		t.Fatalf("Prefix failed: %v", err)
+	}
+	if gateway := Gateway(network); gateway.String() != "10.8.0.1" {
+		t.Errorf("Gateway = %s", gateway)
+	}
+	peers := []Peer{{Address: netip.MustParseAddr("10.8.0.2")}, {Address: netip.MustParseAddr("10.8.0.4")}}
+	if addr, err := NextAddress(network, peers); err != nil || addr.String() != "10.8.0.3" {
+		t.Errorf("NextAddress = %s, %v", addr, err)
+	}
+
+	peers = nil
+	for addr := netip.MustParseAddr("10.8.0.2"); addr.String() != "10.8.0.255"; addr = addr.Next() {
+		peers = append(peers, Peer{Address: addr})
+	}
+	if _, err := NextAddress(network, peers); err == nil {
+		t.Error("NextAddress should fail once every address is used")
+	}
+
+	for _, network := range []string{"10.8", "10.8.0.0", "fd00::"} {
+		if _, err := Prefix(network); err == nil {
+			t.Errorf("Prefix(%s) should fail", network)
+		}
+	}
+}
+
+func TestParseDump(t *testing.T) {
+	dump := Key{1}.String() + "\t" + Key{1}.PublicKey().String() + "\t51820\toff\n" +
+		Key{2}.String() + "\t(none)\t203.0.113.7:61234\t10.8.0.2/32\t1700000000\t1024\t2048\toff\n" +
+		Key{4}.String() + "\t(none)\t(none)\t10.8.0.3/32\t0\t0\t0\toff\n"
+	peers, err := ParseDump(dump)
+	if err != nil {
+		t.Fatalf("ParseDump failed: %v", err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("Expected 2 peers, got %d", len(peers))
+	}
+	if p := peers[0]; p.PublicKey != (Key{2}) || p.Endpoint != "203.0.113.7:61234" ||
+		!p.LastHandshake.Equal(time.Unix(1700000000, 0)) || p.Received != 1024 || p.Sent != 2048 {
+		t.Errorf("peers[0] = %+v", p)
+	}
+	if p := peers[1]; p.Endpoint != "" || !p.LastHandshake.IsZero() {
+		t.Errorf("peers[1] = %+v", p)
+	}
+
+	if peers, err := ParseDump(""); err != nil || len(peers) != 0 {
+		t.Errorf("ParseDump of no interface = %v, %v", peers, err)
+	}
+	if _, err := ParseDump("header\nbroken line"); err == nil {
+		t.Error("ParseDump should reject malformed lines")
+	}
+}
+
+func TestDeviceInterface(t *testing.T) {
+	RunDir = t.TempDir()
+	device := Device{Name: "nat-manager"}
+	if _, ok := device.Interface(); ok {
+		t.Error("No interface expected before wireguard-go runs")
+	}
+	if err := device.Down(); err != ErrNotRunning {
+		t.Errorf("Down = %v, expected ErrNotRunning", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(RunDir, "nat-manager.name"), []byte("utun7\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := device.Interface(); ok {
+		t.Error("An interface without control socket is not running")
+	}
+	if err := os.WriteFile(filepath.Join(RunDir, "utun7.sock"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if iface, ok := device.Interface(); !ok || iface != "utun7" {
+		t.Errorf("Interface = %s, %t", iface, ok)
+	}
+	if err := device.Down(); err != nil {
+		t.Errorf("Down failed: %v", err)
+	}
+	if _, ok := device.Interface(); ok {
+		t.Error("Down should remove the control socket")
+	}
+}